@@ -0,0 +1,398 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/misc"
+	"github.com/mirzakhany/gox/pii"
+	"github.com/mirzakhany/gox/rest"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+
+	DefaultPrimaryKey = "id"
+)
+
+// Action is an operation of the admin endpoints, passed to the Authorizer and in audit entries.
+type Action string
+
+const (
+	ActionList   Action = "list"
+	ActionGet    Action = "get"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Authorizer decides whether the request may do action, a returned error is written with status 403
+// unless it carries its own code, see errs.CodeOf.
+type Authorizer func(r *http.Request, action Action) error
+
+// AuditEntry records a change made through the admin endpoints.
+type AuditEntry struct {
+	Action Action
+	Table  string
+	ID     string
+	// Actor is the user id of the rest.RequestMeta of the request, if any
+	Actor  string
+	Before interface{}
+	After  interface{}
+}
+
+// Auditor stores audit entries, by default they are logged with the fields tagged with pii masked.
+type Auditor func(ctx context.Context, entry AuditEntry)
+
+// DB is the part of *pgxpool.Pool used by the admin endpoints.
+type DB interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+type config struct {
+	key       string
+	authorize Authorizer
+	audit     Auditor
+	logger    *zap.Logger
+	filters   []string
+	pageSize  int
+	readOnly  bool
+}
+
+type Option func(*config) error
+
+// WithPrimaryKey sets the primary key column, DefaultPrimaryKey by default. it is never written by
+// create and update, the database is expected to generate it.
+func WithPrimaryKey(column string) Option {
+	return func(c *config) error {
+		c.key = column
+		return nil
+	}
+}
+
+// WithAuthorizer is called for every request before it is handled.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(c *config) error {
+		c.authorize = authorize
+		return nil
+	}
+}
+
+// WithAuditor sets where audit entries of create, update and delete go.
+func WithAuditor(audit Auditor) Option {
+	return func(c *config) error {
+		c.audit = audit
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(c *config) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithFilters sets the columns the list endpoint can be filtered and ordered by.
+func WithFilters(columns ...string) Option {
+	return func(c *config) error {
+		c.filters = columns
+		return nil
+	}
+}
+
+func WithPageSize(n int) Option {
+	return func(c *config) error {
+		if n <= 0 || n > MaxPageSize {
+			return fmt.Errorf("admin: page size must be between 1 and %d", MaxPageSize)
+		}
+		c.pageSize = n
+		return nil
+	}
+}
+
+// WithReadOnly only mounts the list and get endpoints.
+func WithReadOnly() Option {
+	return func(c *config) error {
+		c.readOnly = true
+		return nil
+	}
+}
+
+// Mount adds list, get, create, update and delete endpoints for the rows of table, stored as T, to router.
+// list accepts the WithFilters columns as query params for equality filters and order=column or
+// order=-column, with limit and offset for paging. without WithAuthorizer every request is allowed,
+// so router must be protected otherwise.
+// example:
+//
+//	type Product struct {
+//		ID    int64  `db:"id" json:"id"`
+//		Name  string `db:"name" json:"name"`
+//		State string `db:"state" json:"state"`
+//	}
+//
+//	router.Route("/admin/products", func(r chi.Router) {
+//		err = admin.Mount[Product](r, pool, "products",
+//			admin.WithFilters("state"),
+//			admin.WithAuthorizer(requireRole("backoffice")),
+//			admin.WithZapLogger(logger))
+//	})
+func Mount[T any](router chi.Router, db DB, table string, options ...Option) error {
+	cfg := &config{
+		key:      DefaultPrimaryKey,
+		pageSize: DefaultPageSize,
+		logger:   zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return err
+		}
+	}
+
+	e, err := newEntity(reflect.TypeOf((*T)(nil)).Elem(), table, cfg.key)
+	if err != nil {
+		return err
+	}
+	for _, f := range cfg.filters {
+		if !e.hasColumn(f) {
+			return errors.New("admin: filter column " + f + " is not a column of " + table)
+		}
+	}
+
+	if cfg.audit == nil {
+		logger := cfg.logger
+		cfg.audit = func(_ context.Context, entry AuditEntry) {
+			logger.Info("admin change", zap.String("action", string(entry.Action)), zap.String("table", entry.Table),
+				zap.String("id", entry.ID), zap.String("actor", entry.Actor),
+				zap.Any("before", pii.Scrub(entry.Before)), zap.Any("after", pii.Scrub(entry.After)))
+		}
+	}
+
+	h := &handler[T]{cfg: cfg, db: db, entity: e}
+	router.Get("/", h.authorized(ActionList, h.list))
+	router.Get("/{id}", h.authorized(ActionGet, h.get))
+	if !cfg.readOnly {
+		router.Post("/", h.authorized(ActionCreate, h.create))
+		router.Put("/{id}", h.authorized(ActionUpdate, h.update))
+		router.Delete("/{id}", h.authorized(ActionDelete, h.delete))
+	}
+	return nil
+}
+
+// Page is the response of the list endpoint.
+type Page[T any] struct {
+	Items []T   `json:"items"`
+	Total int64 `json:"total"`
+}
+
+type handler[T any] struct {
+	cfg    *config
+	db     DB
+	entity *entity
+}
+
+func (h *handler[T]) authorized(action Action, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.cfg.authorize != nil {
+			if err := h.cfg.authorize(r, action); err != nil {
+				if errs.CodeOf(err) == errs.CodeUnknown {
+					err = errs.WithCode(err, errs.CodePermissionDenied)
+				}
+				rest.WriteErr(w, err)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (h *handler[T]) list(w http.ResponseWriter, r *http.Request) {
+	q, err := h.parseQuery(r)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+
+	listSQL, countSQL, args := h.entity.listSQL(q)
+	rows, err := h.db.Query(r.Context(), listSQL, args...)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	defer rows.Close()
+
+	page := Page[T]{Items: []T{}}
+	for rows.Next() {
+		var item T
+		if err := rows.Scan(h.entity.targets(reflect.ValueOf(&item).Elem())...); err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+
+	if err := h.db.QueryRow(r.Context(), countSQL, args...).Scan(&page.Total); err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *handler[T]) get(w http.ResponseWriter, r *http.Request) {
+	item, err := h.find(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *handler[T]) create(w http.ResponseWriter, r *http.Request) {
+	var item T
+	if code, err := rest.BindJSON(r, &item); err != nil {
+		rest.WriteError(w, code, err.Error())
+		return
+	}
+
+	columns, values := h.entity.values(reflect.ValueOf(&item).Elem())
+	var created T
+	err := h.db.QueryRow(r.Context(), h.entity.insertSQL(columns), values...).
+		Scan(h.entity.targets(reflect.ValueOf(&created).Elem())...)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+
+	h.audit(r, ActionCreate, h.id(created), nil, created)
+	rest.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *handler[T]) update(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	before, err := h.find(r.Context(), id)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+
+	var item T
+	if code, err := rest.BindJSON(r, &item); err != nil {
+		rest.WriteError(w, code, err.Error())
+		return
+	}
+
+	columns, values := h.entity.values(reflect.ValueOf(&item).Elem())
+	var updated T
+	err = h.db.QueryRow(r.Context(), h.entity.updateSQL(columns), append(values, id)...).
+		Scan(h.entity.targets(reflect.ValueOf(&updated).Elem())...)
+	if err != nil {
+		rest.WriteErr(w, notFound(err, id))
+		return
+	}
+
+	h.audit(r, ActionUpdate, id, before, updated)
+	rest.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *handler[T]) delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	before, err := h.find(r.Context(), id)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+
+	if _, err := h.db.Exec(r.Context(), h.entity.deleteSQL(), id); err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+
+	h.audit(r, ActionDelete, id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[T]) find(ctx context.Context, id string) (*T, error) {
+	var item T
+	if err := h.db.QueryRow(ctx, h.entity.getSQL(), id).Scan(h.entity.targets(reflect.ValueOf(&item).Elem())...); err != nil {
+		return nil, notFound(err, id)
+	}
+	return &item, nil
+}
+
+func (h *handler[T]) id(item T) string {
+	for i, c := range h.entity.columns {
+		if c == h.entity.key {
+			return fmt.Sprint(reflect.ValueOf(item).FieldByIndex(h.entity.fields[i]).Interface())
+		}
+	}
+	return ""
+}
+
+func (h *handler[T]) audit(r *http.Request, action Action, id string, before, after interface{}) {
+	entry := AuditEntry{Action: action, Table: h.entity.table, ID: id, Before: before, After: after}
+	if meta, ok := rest.RequestMetaFrom(r.Context()); ok {
+		entry.Actor = meta.UserID
+	}
+	h.cfg.audit(r.Context(), entry)
+}
+
+func (h *handler[T]) parseQuery(r *http.Request) (query, error) {
+	values := r.URL.Query()
+	q := query{filters: map[string]string{}, limit: h.cfg.pageSize}
+
+	for _, f := range h.cfg.filters {
+		if v := values.Get(f); v != "" {
+			q.filters[f] = v
+		}
+	}
+
+	if order := values.Get("order"); order != "" {
+		q.desc = strings.HasPrefix(order, "-")
+		q.order = strings.TrimPrefix(order, "-")
+		if q.order != h.entity.key && !contains(h.cfg.filters, q.order) {
+			return q, errs.Invalid("can not order by %s", q.order)
+		}
+	}
+
+	var err error
+	if q.limit, err = misc.ParseInt(values.Get("limit"), h.cfg.pageSize, 1, MaxPageSize); err != nil {
+		return q, errs.Invalid("limit must be between 1 and %d", MaxPageSize)
+	}
+	if q.offset, err = misc.ParseInt(values.Get("offset"), 0, 0, math.MaxInt); err != nil {
+		return q, errs.Invalid("offset must not be negative")
+	}
+	return q, nil
+}
+
+func notFound(err error, id string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.NotFound("%s not found", id)
+	}
+	return err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
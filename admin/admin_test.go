@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type product struct {
+	ID       int64  `db:"id" json:"id"`
+	Name     string `db:"name" json:"name"`
+	State    string `json:"state"`
+	Internal string `db:"-" json:"-"`
+}
+
+func TestEntitySQL(t *testing.T) {
+	e, err := newEntity(reflect.TypeOf(product{}), "shop.products", "id")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name", "state"}, e.columns)
+
+	list, count, args := e.listSQL(query{filters: map[string]string{"state": "active"}, order: "name", desc: true, limit: 10, offset: 20})
+	require.Equal(t, `SELECT "id", "name", "state" FROM "shop"."products" WHERE "state" = $1 ORDER BY "name" DESC LIMIT 10 OFFSET 20`, list)
+	require.Equal(t, `SELECT count(*) FROM "shop"."products" WHERE "state" = $1`, count)
+	require.Equal(t, []interface{}{"active"}, args)
+
+	columns, values := e.values(reflect.ValueOf(product{ID: 1, Name: "pen", State: "active"}))
+	require.Equal(t, []interface{}{"pen", "active"}, values)
+	require.Equal(t, `INSERT INTO "shop"."products" ("name", "state") VALUES ($1, $2) RETURNING "id", "name", "state"`, e.insertSQL(columns))
+	require.Equal(t, `UPDATE "shop"."products" SET "name" = $1, "state" = $2 WHERE "id" = $3 RETURNING "id", "name", "state"`, e.updateSQL(columns))
+
+	_, err = newEntity(reflect.TypeOf(product{}), "products", "uuid")
+	require.Error(t, err)
+}
+
+type noDB struct{}
+
+func (noDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+func (noDB) QueryRow(context.Context, string, ...interface{}) pgx.Row { return nil }
+func (noDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return nil, errors.New("unexpected exec")
+}
+
+func TestMount(t *testing.T) {
+	router := chi.NewRouter()
+	err := Mount[product](router, noDB{}, "products",
+		WithFilters("state"),
+		WithReadOnly(),
+		WithAuthorizer(func(r *http.Request, action Action) error {
+			if r.Header.Get("X-Role") != "admin" {
+				return errors.New("admins only")
+			}
+			return nil
+		}))
+	require.NoError(t, err)
+
+	serve := func(method, target, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set("X-Role", role)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	{ // unauthorized requests are rejected
+		require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/", "user").Code)
+	}
+
+	{ // only filter columns can be ordered by
+		w := serve(http.MethodGet, "/?order=-name", "admin")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.JSONEq(t, `{"code": "ErrBadRequest", "message": "can not order by name"}`, w.Body.String())
+	}
+
+	{ // read only resources have no write endpoints
+		require.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "/1", "admin").Code)
+	}
+
+	{ // unknown filter columns are rejected when mounting
+		require.Error(t, Mount[product](chi.NewRouter(), noDB{}, "products", WithFilters("price")))
+	}
+}
@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/store"
+)
+
+// entity describes how a struct is stored in its table. columns are taken from `db` tags, fields
+// without one use their lower cased name and fields tagged `db:"-"` are skipped.
+type entity struct {
+	table   string
+	key     string
+	columns []string
+	fields  [][]int
+}
+
+func newEntity(t reflect.Type, table, key string) (*entity, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("admin: entity of table %s must be a struct, got %s", table, t)
+	}
+
+	e := &entity{table: table, key: key}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		column := f.Tag.Get("db")
+		if column == "-" {
+			continue
+		}
+		if column == "" {
+			column = strings.ToLower(f.Name)
+		}
+		e.columns = append(e.columns, column)
+		e.fields = append(e.fields, f.Index)
+	}
+
+	if !e.hasColumn(key) {
+		return nil, fmt.Errorf("admin: entity of table %s has no primary key column %s", table, key)
+	}
+	return e, nil
+}
+
+func (e *entity) hasColumn(column string) bool {
+	for _, c := range e.columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// targets returns pointers to the fields of v in the order of columns, for Scan.
+func (e *entity) targets(v reflect.Value) []interface{} {
+	targets := make([]interface{}, len(e.fields))
+	for i, index := range e.fields {
+		targets[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+	return targets
+}
+
+// values returns the columns and values of v without the primary key, which is set by the database.
+func (e *entity) values(v reflect.Value) ([]string, []interface{}) {
+	columns := make([]string, 0, len(e.columns))
+	values := make([]interface{}, 0, len(e.columns))
+	for i, column := range e.columns {
+		if column == e.key {
+			continue
+		}
+		columns = append(columns, column)
+		values = append(values, v.FieldByIndex(e.fields[i]).Interface())
+	}
+	return columns, values
+}
+
+func (e *entity) selectList() string {
+	quoted := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		quoted[i] = quote(c)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// query is a list query, filters are ANDed equality conditions.
+type query struct {
+	filters map[string]string
+	order   string
+	desc    bool
+	limit   int
+	offset  int
+}
+
+func (e *entity) listSQL(q query) (string, string, []interface{}) {
+	var where []string
+	var args []interface{}
+	for _, column := range e.columns {
+		if v, ok := q.filters[column]; ok {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("%s = $%d", quote(column), len(args)))
+		}
+	}
+
+	from := " FROM " + store.QuoteIdentifier(e.table)
+	if len(where) > 0 {
+		from += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	order := q.order
+	if order == "" {
+		order = e.key
+	}
+	direction := "ASC"
+	if q.desc {
+		direction = "DESC"
+	}
+
+	list := "SELECT " + e.selectList() + from + " ORDER BY " + quote(order) + " " + direction +
+		" LIMIT " + strconv.Itoa(q.limit) + " OFFSET " + strconv.Itoa(q.offset)
+	return list, "SELECT count(*)" + from, args
+}
+
+func (e *entity) getSQL() string {
+	return "SELECT " + e.selectList() + " FROM " + store.QuoteIdentifier(e.table) + " WHERE " + quote(e.key) + " = $1"
+}
+
+func (e *entity) insertSQL(columns []string) string {
+	quoted := make([]string, len(columns))
+	params := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quote(c)
+		params[i] = "$" + strconv.Itoa(i+1)
+	}
+	return "INSERT INTO " + store.QuoteIdentifier(e.table) + " (" + strings.Join(quoted, ", ") + ") VALUES (" +
+		strings.Join(params, ", ") + ") RETURNING " + e.selectList()
+}
+
+// updateSQL expects the primary key as the last argument.
+func (e *entity) updateSQL(columns []string) string {
+	sets := make([]string, len(columns))
+	for i, c := range columns {
+		sets[i] = quote(c) + " = $" + strconv.Itoa(i+1)
+	}
+	return "UPDATE " + store.QuoteIdentifier(e.table) + " SET " + strings.Join(sets, ", ") + " WHERE " + quote(e.key) +
+		" = $" + strconv.Itoa(len(columns)+1) + " RETURNING " + e.selectList()
+}
+
+func (e *entity) deleteSQL() string {
+	return "DELETE FROM " + store.QuoteIdentifier(e.table) + " WHERE " + quote(e.key) + " = $1"
+}
+
+func quote(column string) string {
+	return pgx.Identifier{column}.Sanitize()
+}
@@ -0,0 +1,234 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	stdos "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicies = Policies{
+	{ID: "admins", Effect: Allow, Actions: []string{"*"}, Conditions: []Condition{
+		{Attr: "subject.roles", Op: OpContains, Value: "admin"},
+	}},
+	{ID: "owners", Effect: Allow, Actions: []string{"documents.update"}, Conditions: []Condition{
+		{Attr: "resource.owner.id", Op: OpEquals, Ref: "subject.id"},
+	}},
+	{ID: "readers", Effect: Allow, Actions: []string{"documents.read"}, Conditions: []Condition{
+		{Attr: "subject.level", Op: OpGreater, Value: 2},
+		{Attr: "resource.status", Op: OpIn, Value: []interface{}{"published", "archived"}},
+	}},
+	{ID: "locked", Effect: Deny, Actions: []string{"*"}, Conditions: []Condition{
+		{Attr: "resource.locked", Op: OpExists},
+	}},
+}
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+	e, err := NewEngine(ctx, testPolicies, WithCacheTTL(0))
+	require.NoError(t, err)
+
+	ann := Attributes{"id": "ann", "level": 3}
+	admin := Attributes{"id": "root", "roles": []string{"admin"}}
+	doc := Attributes{"owner": map[string]interface{}{"id": "ann"}, "status": "draft"}
+
+	require.Equal(t, Decision{Allowed: true, Policy: "owners"}, e.Decide(ctx, Request{Subject: ann, Resource: doc, Action: "documents.update"}))
+	require.Equal(t, Decision{}, e.Decide(ctx, Request{Subject: ann, Resource: doc, Action: "documents.delete"}))
+	require.Equal(t, Decision{Allowed: true, Policy: "admins"}, e.Decide(ctx, Request{Subject: admin, Resource: doc, Action: "documents.delete"}))
+
+	{ // numbers compare by value and lists of values
+		require.False(t, e.Decide(ctx, Request{Subject: ann, Resource: doc, Action: "documents.read"}).Allowed)
+		published := Attributes{"status": "published"}
+		require.True(t, e.Decide(ctx, Request{Subject: ann, Resource: published, Action: "documents.read"}).Allowed)
+		require.False(t, e.Decide(ctx, Request{Subject: Attributes{"level": 2.0}, Resource: published, Action: "documents.read"}).Allowed)
+	}
+
+	{ // deny policies win
+		locked := Attributes{"owner": map[string]interface{}{"id": "ann"}, "locked": true}
+		require.Equal(t, Decision{Policy: "locked"}, e.Decide(ctx, Request{Subject: admin, Resource: locked, Action: "documents.update"}))
+	}
+
+	{ // invalid policies are refused
+		_, err := NewEngine(ctx, Policies{{ID: "x", Effect: "maybe", Actions: []string{"*"}}})
+		require.Error(t, err)
+		_, err = NewEngine(ctx, Policies{{ID: "x", Effect: Allow, Actions: []string{"*"}, Conditions: []Condition{{Attr: "role", Op: OpEquals}}}})
+		require.Error(t, err)
+		_, err = NewEngine(ctx, Policies{{ID: "x", Effect: Allow, Actions: []string{"*"}, Conditions: []Condition{{Attr: "subject.level", Op: OpGreater, Value: "high"}}}})
+		require.Error(t, err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	require.NoError(t, stdos.WriteFile(path, []byte(`
+- id: support
+  effect: allow
+  actions: [tickets.read]
+  conditions:
+    - {attr: subject.team, op: eq, value: support}
+    - {attr: subject.level, op: lt, value: 5}
+`), 0o600))
+
+	e, err := NewEngine(context.Background(), FileStore(path))
+	require.NoError(t, err)
+	require.True(t, e.Decide(context.Background(), Request{Subject: Attributes{"team": "support", "level": 1}, Action: "tickets.read"}).Allowed)
+
+	_, err = NewEngine(context.Background(), FileStore(filepath.Join(t.TempDir(), "missing.yaml")))
+	require.Error(t, err)
+}
+
+// switchStore returns the policies it holds at the time of the call.
+type switchStore struct{ policies Policies }
+
+func (s *switchStore) Policies(context.Context) ([]Policy, error) {
+	return s.policies, nil
+}
+
+func TestEngineCacheAndAudit(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	fake := goxtest.NewFakeClock(now)
+	ctx := clock.WithContext(context.Background(), fake)
+
+	var denials []Denial
+	s := &switchStore{policies: testPolicies}
+	e, err := NewEngine(ctx, s, WithCacheTTL(time.Minute), WithAuditor(func(_ context.Context, d Denial) {
+		denials = append(denials, d)
+	}))
+	require.NoError(t, err)
+
+	req := Request{Subject: Attributes{"id": "ann"}, Resource: Attributes{"owner": map[string]interface{}{"id": "ann"}}, Action: "documents.update"}
+	require.True(t, e.Decide(ctx, req).Allowed)
+
+	{ // decisions are cached until they expire or policies are reloaded
+		require.Len(t, e.cache, 1)
+		cached, ok := e.cached(req, now.Add(time.Minute-1))
+		require.True(t, ok)
+		require.True(t, cached.Allowed)
+		_, ok = e.cached(req, now.Add(time.Minute))
+		require.False(t, ok)
+
+		s.policies = Policies{}
+		fake.Advance(time.Minute)
+		require.True(t, e.Decide(ctx, req).Allowed)
+		require.NoError(t, e.Reload(ctx))
+		require.Empty(t, e.cache)
+		require.False(t, e.Decide(ctx, req).Allowed)
+		require.False(t, e.Decide(ctx, req).Allowed)
+	}
+
+	{ // every denial is audited, cached or not
+		require.Len(t, denials, 2)
+		require.Equal(t, Denial{Request: req, Time: now.Add(time.Minute)}, denials[0])
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	e, err := NewEngine(context.Background(), testPolicies)
+	require.NoError(t, err)
+
+	handler := Subject(func(r *http.Request) (Attributes, error) {
+		if id := r.Header.Get("X-User"); id != "" {
+			return Attributes{"id": id}, nil
+		}
+		return nil, nil
+	})(e.Middleware("documents.update", func(r *http.Request) (Attributes, error) {
+		if r.URL.Path == "/documents/missing" {
+			return nil, errs.NotFound("document not found")
+		}
+		return Attributes{"owner": map[string]interface{}{"id": "ann"}}, nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	serve := func(path, user string) int {
+		r := httptest.NewRequest(http.MethodPut, path, nil)
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusNoContent, serve("/documents/1", "ann"))
+	require.Equal(t, http.StatusForbidden, serve("/documents/1", "bob"))
+	require.Equal(t, http.StatusUnauthorized, serve("/documents/1", ""))
+	require.Equal(t, http.StatusNotFound, serve("/documents/missing", "ann"))
+
+	{ // explicit checks use the subject of ctx
+		ctx := WithSubject(context.Background(), Attributes{"id": "bob"})
+		err := e.Check(ctx, "documents.update", Attributes{"owner": map[string]interface{}{"id": "ann"}})
+		require.Equal(t, errs.CodePermissionDenied, errs.CodeOf(err))
+	}
+}
+
+type fakeEnforcer map[[3]interface{}]bool
+
+func (f fakeEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	if len(rvals) != 3 {
+		return false, errors.New("invalid request size")
+	}
+	return f[[3]interface{}{rvals[0], rvals[1], rvals[2]}], nil
+}
+
+func TestDeciders(t *testing.T) {
+	ctx := context.Background()
+	req := Request{Subject: Attributes{"id": "ann"}, Resource: Attributes{"id": "doc-1"}, Action: "read"}
+
+	{ // casbin
+		e, err := NewEngine(ctx, nil, WithDecider(Casbin(fakeEnforcer{{"ann", "doc-1", "read"}: true}, nil)))
+		require.NoError(t, err)
+		require.Equal(t, Decision{Allowed: true, Policy: "casbin"}, e.Decide(ctx, req))
+		require.False(t, e.Decide(ctx, Request{Subject: Attributes{"id": "bob"}, Resource: Attributes{"id": "doc-1"}, Action: "read"}).Allowed)
+	}
+
+	{ // opa with boolean, object and undefined results, decisions are cached
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			var body struct{ Input Request }
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			switch body.Input.Subject["id"] {
+			case "ann":
+				_, _ = w.Write([]byte(`{"result": true}`))
+			case "bob":
+				_, _ = w.Write([]byte(`{"result": {"allow": true}}`))
+			case "eve":
+				_, _ = w.Write([]byte(`{}`))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer srv.Close()
+
+		e, err := NewEngine(ctx, nil, WithDecider(OPA(srv.URL+"/v1/data/authz", srv.Client())))
+		require.NoError(t, err)
+		require.Equal(t, Decision{Allowed: true, Policy: "opa"}, e.Decide(ctx, req))
+		require.Equal(t, Decision{Allowed: true, Policy: "opa"}, e.Decide(ctx, req))
+		require.Equal(t, 1, calls)
+		require.True(t, e.Decide(ctx, Request{Subject: Attributes{"id": "bob"}, Action: "read"}).Allowed)
+		require.False(t, e.Decide(ctx, Request{Subject: Attributes{"id": "eve"}, Action: "read"}).Allowed)
+
+		{ // failures deny requests and are not cached, unless failing open
+			require.False(t, e.Decide(ctx, Request{Subject: Attributes{"id": "mallory"}, Action: "read"}).Allowed)
+			require.False(t, e.Decide(ctx, Request{Subject: Attributes{"id": "mallory"}, Action: "read"}).Allowed)
+			require.Equal(t, 5, calls)
+
+			open, err := NewEngine(ctx, nil, WithDecider(OPA(srv.URL, srv.Client())), WithFailOpen())
+			require.NoError(t, err)
+			require.True(t, open.Decide(ctx, Request{Subject: Attributes{"id": "mallory"}, Action: "read"}).Allowed)
+		}
+	}
+
+	_, err := NewEngine(ctx, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Decider decides requests for an Engine set up WithDecider, like an adapter of an existing
+// authorization system.
+type Decider interface {
+	Decide(ctx context.Context, req Request) (Decision, error)
+}
+
+// DeciderFunc adapts a function to Decider.
+type DeciderFunc func(ctx context.Context, req Request) (Decision, error)
+
+func (f DeciderFunc) Decide(ctx context.Context, req Request) (Decision, error) {
+	return f(ctx, req)
+}
+
+// CasbinEnforcer is implemented by *casbin.Enforcer and *casbin.SyncedEnforcer.
+type CasbinEnforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+}
+
+// Casbin returns a decider enforcing the model of enforcer with the request values args returns for
+// a request. nil args passes the "id" attributes of the subject and the resource and the action, which
+// fits the sub, obj, act request definition of most models.
+// example:
+//
+//	enforcer, err := casbin.NewSyncedEnforcer("model.conf", "policy.csv")
+//	engine, err := authz.NewEngine(ctx, nil, authz.WithDecider(authz.Casbin(enforcer, nil)))
+func Casbin(enforcer CasbinEnforcer, args func(req Request) []interface{}) Decider {
+	if args == nil {
+		args = func(req Request) []interface{} {
+			return []interface{}{req.Subject["id"], req.Resource["id"], req.Action}
+		}
+	}
+	return DeciderFunc(func(_ context.Context, req Request) (Decision, error) {
+		ok, err := enforcer.Enforce(args(req)...)
+		if err != nil {
+			return Decision{}, fmt.Errorf("casbin: %w", err)
+		}
+		return Decision{Allowed: ok, Policy: "casbin"}, nil
+	})
+}
+
+// OPA returns a decider querying the decision at url of an OPA server, like the sidecar at
+// http://localhost:8181/v1/data/httpapi/authz/allow. the request is the input of the query, its
+// result must be a boolean or an object with an allow boolean. undefined decisions deny requests.
+// client may be nil for http.DefaultClient, it should have a short timeout.
+// example:
+//
+//	opa := authz.OPA("http://localhost:8181/v1/data/httpapi/authz", &http.Client{Timeout: 200 * time.Millisecond})
+//	engine, err := authz.NewEngine(ctx, nil, authz.WithDecider(opa), authz.WithCacheTTL(10*time.Second))
+func OPA(url string, client *http.Client) Decider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return DeciderFunc(func(ctx context.Context, req Request) (Decision, error) {
+		body, err := json.Marshal(map[string]interface{}{"input": req})
+		if err != nil {
+			return Decision{}, err
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return Decision{}, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		res, err := client.Do(httpReq)
+		if err != nil {
+			return Decision{}, fmt.Errorf("opa: %w", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			_, _ = io.Copy(io.Discard, res.Body)
+			return Decision{}, fmt.Errorf("opa: unexpected status %d", res.StatusCode)
+		}
+
+		var out struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			return Decision{}, fmt.Errorf("opa: %w", err)
+		}
+		if len(out.Result) == 0 {
+			return Decision{Policy: "opa"}, nil
+		}
+
+		var allowed bool
+		if err := json.Unmarshal(out.Result, &allowed); err != nil {
+			var doc struct {
+				Allow bool `json:"allow"`
+			}
+			if err := json.Unmarshal(out.Result, &doc); err != nil {
+				return Decision{}, fmt.Errorf("opa: result is neither a boolean nor an object with allow")
+			}
+			allowed = doc.Allow
+		}
+		return Decision{Allowed: allowed, Policy: "opa"}, nil
+	})
+}
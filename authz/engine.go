@@ -0,0 +1,308 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/errs"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultCacheTTL       = time.Minute
+	DefaultCacheSize      = 10000
+	DefaultReloadInterval = 30 * time.Second
+)
+
+var subjectKey = ctxutil.NewKey[Attributes]("authz subject")
+
+// WithSubject returns a copy of ctx holding the attributes of the authenticated subject, which
+// Engine.Check and the middlewares decide for. authentication middlewares set it.
+func WithSubject(ctx context.Context, subject Attributes) context.Context {
+	return subjectKey.Set(ctx, subject)
+}
+
+// SubjectFrom returns the subject stored in ctx.
+func SubjectFrom(ctx context.Context) Attributes {
+	subject, _ := subjectKey.Get(ctx)
+	return subject
+}
+
+// Decision is the outcome of a request, Policy is the id of the policy which decided it, empty when
+// no policy matched.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+// Denial records a denied request for auditing.
+type Denial struct {
+	Request Request
+	Policy  string
+	Time    time.Time
+}
+
+// Auditor records denials, by default they are logged.
+type Auditor func(ctx context.Context, d Denial)
+
+type Option func(*Engine) error
+
+// WithCacheTTL sets how long decisions are cached, zero disables caching. the cache is cleared when
+// policies are reloaded.
+func WithCacheTTL(d time.Duration) Option {
+	return func(e *Engine) error {
+		e.cacheTTL = d
+		return nil
+	}
+}
+
+// WithCacheSize sets how many decisions are cached, the cache is cleared once it is full.
+func WithCacheSize(n int) Option {
+	return func(e *Engine) error {
+		e.cacheSize = n
+		return nil
+	}
+}
+
+// WithReloadInterval sets how often Run loads the policies from the store again.
+func WithReloadInterval(d time.Duration) Option {
+	return func(e *Engine) error {
+		e.reloadInterval = d
+		return nil
+	}
+}
+
+// WithAuditor sets where denials go.
+func WithAuditor(audit Auditor) Option {
+	return func(e *Engine) error {
+		e.audit = audit
+		return nil
+	}
+}
+
+// WithDecider delegates decisions to d, like Casbin or OPA, instead of the policies of the store,
+// which may be nil then. decisions of d are cached and audited like the ones of policies.
+func WithDecider(d Decider) Option {
+	return func(e *Engine) error {
+		e.decider = d
+		return nil
+	}
+}
+
+// WithFailOpen allows requests when the decider fails, by default they are denied.
+func WithFailOpen() Option {
+	return func(e *Engine) error {
+		e.failOpen = true
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(e *Engine) error {
+		e.logger = logger
+		return nil
+	}
+}
+
+type cachedDecision struct {
+	decision Decision
+	expires  time.Time
+}
+
+// Engine decides requests with attribute based policies.
+type Engine struct {
+	store          Store
+	cacheTTL       time.Duration
+	cacheSize      int
+	reloadInterval time.Duration
+	audit          Auditor
+	decider        Decider
+	failOpen       bool
+	logger         *zap.Logger
+
+	mu       sync.RWMutex
+	policies []Policy
+	cache    map[string]cachedDecision
+}
+
+// NewEngine returns an engine with the policies of store, it is a gox.Component reloading them. store
+// may be nil when decisions are delegated WithDecider.
+// example:
+//
+//	engine, err := authz.NewEngine(ctx, authz.FileStore("policies.yaml"), authz.WithZapLogger(logger))
+//	router.With(engine.Middleware("documents.update", documentAttributes)).Put("/documents/{id}", updateDocument)
+//	...
+//	if err := engine.Check(ctx, "documents.share", authz.Attributes{"type": "document", "owner_id": doc.OwnerID}); err != nil {
+//		rest.WriteErr(w, err)
+//		return
+//	}
+func NewEngine(ctx context.Context, store Store, options ...Option) (*Engine, error) {
+	e := &Engine{
+		store:          store,
+		cacheTTL:       DefaultCacheTTL,
+		cacheSize:      DefaultCacheSize,
+		reloadInterval: DefaultReloadInterval,
+		logger:         zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(e); err != nil {
+			return nil, err
+		}
+	}
+	if store == nil && e.decider == nil {
+		return nil, errors.New("authz: a store or a decider is required")
+	}
+	if e.audit == nil {
+		e.audit = func(_ context.Context, d Denial) {
+			e.logger.Warn("access denied", zap.String("action", d.Request.Action), zap.Any("subject", d.Request.Subject),
+				zap.Any("resource", d.Request.Resource), zap.String("policy", d.Policy))
+		}
+	}
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload loads the policies from the store, invalid policies fail the reload and the current ones stay.
+// the decision cache is cleared.
+func (e *Engine) Reload(ctx context.Context) error {
+	var policies []Policy
+	if e.store != nil {
+		var err error
+		if policies, err = e.store.Policies(ctx); err != nil {
+			return err
+		}
+	}
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policies = policies
+	e.cache = make(map[string]cachedDecision)
+	return nil
+}
+
+func (e *Engine) Name() string {
+	return "authz"
+}
+
+// Run reloads the policies every reload interval until ctx is done, failures are logged.
+func (e *Engine) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for {
+		select {
+		case <-clk.After(e.reloadInterval):
+		case <-ctx.Done():
+			return nil
+		}
+		if err := e.Reload(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Error("reload policies failed", zap.Error(err))
+		}
+	}
+}
+
+// Decide evaluates req, denials are audited. failures of the decider deny req unless WithFailOpen is set.
+func (e *Engine) Decide(ctx context.Context, req Request) Decision {
+	now := clock.FromContext(ctx).Now()
+	d, cached := e.cached(req, now)
+	if !cached {
+		var err error
+		if d, err = e.decide(ctx, req); err != nil {
+			e.logger.Error("authorization decision failed", zap.String("action", req.Action), zap.Bool("fail_open", e.failOpen), zap.Error(err))
+			d = Decision{Allowed: e.failOpen}
+		} else {
+			e.remember(req, d, now)
+		}
+	}
+	if !d.Allowed {
+		e.audit(ctx, Denial{Request: req, Policy: d.Policy, Time: now})
+	}
+	return d
+}
+
+// Check decides action on resource for the subject of ctx, denials are errs.Forbidden errors.
+func (e *Engine) Check(ctx context.Context, action string, resource Attributes) error {
+	d := e.Decide(ctx, Request{Subject: SubjectFrom(ctx), Resource: resource, Action: action})
+	if !d.Allowed {
+		return errs.Forbidden("%s is not allowed", action)
+	}
+	return nil
+}
+
+func (e *Engine) decide(ctx context.Context, req Request) (Decision, error) {
+	if e.decider != nil {
+		return e.decider.Decide(ctx, req)
+	}
+	return e.evaluate(req), nil
+}
+
+func (e *Engine) evaluate(req Request) Decision {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var allow *Policy
+	for i, p := range e.policies {
+		if !p.Matches(req) {
+			continue
+		}
+		if p.Effect == Deny {
+			return Decision{Policy: p.ID}
+		}
+		if allow == nil {
+			allow = &e.policies[i]
+		}
+	}
+	if allow == nil {
+		return Decision{}
+	}
+	return Decision{Allowed: true, Policy: allow.ID}
+}
+
+// cacheKey returns the json of req, which sorts the keys of attributes.
+func cacheKey(req Request) (string, bool) {
+	b, err := json.Marshal(req)
+	return string(b), err == nil
+}
+
+func (e *Engine) cached(req Request, now time.Time) (Decision, bool) {
+	if e.cacheTTL <= 0 {
+		return Decision{}, false
+	}
+	key, ok := cacheKey(req)
+	if !ok {
+		return Decision{}, false
+	}
+	e.mu.RLock()
+	c, ok := e.cache[key]
+	e.mu.RUnlock()
+	if !ok || !now.Before(c.expires) {
+		return Decision{}, false
+	}
+	return c.decision, true
+}
+
+func (e *Engine) remember(req Request, d Decision, now time.Time) {
+	if e.cacheTTL <= 0 {
+		return
+	}
+	key, ok := cacheKey(req)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.cache) >= e.cacheSize {
+		e.cache = make(map[string]cachedDecision)
+	}
+	e.cache[key] = cachedDecision{decision: d, expires: now.Add(e.cacheTTL)}
+}
@@ -0,0 +1,57 @@
+package authz
+
+import (
+	"net/http"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+)
+
+// ResourceFunc returns the attributes of the resource of r, like loaded by the id in its path.
+type ResourceFunc func(r *http.Request) (Attributes, error)
+
+// Middleware allows requests only when the subject of their context may do action on the resource
+// returned by resource, which may be nil for actions without a resource. denials are written with
+// status 403, errors of resource with their own code.
+// example:
+//
+//	router.With(engine.Middleware("reports.read", nil)).Get("/reports", listReports)
+func (e *Engine) Middleware(action string, resource ResourceFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var attrs Attributes
+			if resource != nil {
+				var err error
+				if attrs, err = resource(r); err != nil {
+					rest.WriteErr(w, err)
+					return
+				}
+			}
+			if err := e.Check(r.Context(), action, attrs); err != nil {
+				rest.WriteErr(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Subject sets the subject of requests to the attributes returned by subject, like read from the
+// claims of a token. requests without a subject are answered with status 401 when subject returns
+// a nil map.
+func Subject(subject func(r *http.Request) (Attributes, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs, err := subject(r)
+			if err != nil {
+				rest.WriteErr(w, err)
+				return
+			}
+			if attrs == nil {
+				rest.WriteErr(w, errs.Unauthorized("authentication required"))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithSubject(r.Context(), attrs)))
+		})
+	}
+}
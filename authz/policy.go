@@ -0,0 +1,230 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Attributes describe the subject or the resource of a request, nested attributes are maps.
+type Attributes map[string]interface{}
+
+// Request asks whether Subject may do Action on Resource.
+type Request struct {
+	Subject  Attributes `json:"subject"`
+	Resource Attributes `json:"resource"`
+	Action   string     `json:"action"`
+}
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Operator compares the attribute of a condition with its value.
+type Operator string
+
+const (
+	OpEquals    Operator = "eq"
+	OpNotEquals Operator = "ne"
+	// OpIn matches attributes equal to one of the values of a list
+	OpIn Operator = "in"
+	// OpContains matches list attributes holding the value
+	OpContains Operator = "contains"
+	OpExists   Operator = "exists"
+	OpGreater  Operator = "gt"
+	OpLess     Operator = "lt"
+)
+
+// Condition compares the attribute at Attr, like "subject.role" or "resource.owner.id", with Value or
+// with the attribute at Ref, like "subject.id".
+type Condition struct {
+	Attr  string      `json:"attr" yaml:"attr"`
+	Op    Operator    `json:"op" yaml:"op"`
+	Value interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	Ref   string      `json:"ref,omitempty" yaml:"ref,omitempty"`
+}
+
+// Policy applies its effect to requests of one of its actions when all of its conditions hold. "*"
+// matches any action. deny policies win over allow policies, requests no policy allows are denied.
+// example:
+//
+//	authz.Policy{
+//		ID:      "owners-edit-documents",
+//		Effect:  authz.Allow,
+//		Actions: []string{"documents.update", "documents.delete"},
+//		Conditions: []authz.Condition{
+//			{Attr: "resource.type", Op: authz.OpEquals, Value: "document"},
+//			{Attr: "resource.owner_id", Op: authz.OpEquals, Ref: "subject.id"},
+//		},
+//	}
+type Policy struct {
+	ID          string      `json:"id" yaml:"id"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Effect      Effect      `json:"effect" yaml:"effect"`
+	Actions     []string    `json:"actions" yaml:"actions"`
+	Conditions  []Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// Validate checks the effect, actions and conditions of p.
+func (p Policy) Validate() error {
+	if p.ID == "" {
+		return errors.New("authz: policy needs an id")
+	}
+	if p.Effect != Allow && p.Effect != Deny {
+		return fmt.Errorf("authz: policy %s has invalid effect %q", p.ID, p.Effect)
+	}
+	if len(p.Actions) == 0 {
+		return fmt.Errorf("authz: policy %s has no actions", p.ID)
+	}
+	for _, c := range p.Conditions {
+		if !validAttr(c.Attr) || (c.Ref != "" && !validAttr(c.Ref)) {
+			return fmt.Errorf("authz: policy %s: attributes must start with subject. or resource.", p.ID)
+		}
+		switch c.Op {
+		case OpEquals, OpNotEquals, OpContains, OpExists:
+		case OpIn:
+			if c.Ref == "" && reflect.ValueOf(c.Value).Kind() != reflect.Slice {
+				return fmt.Errorf("authz: policy %s: in needs a list", p.ID)
+			}
+		case OpGreater, OpLess:
+			if _, ok := number(c.Value); c.Ref == "" && !ok {
+				return fmt.Errorf("authz: policy %s: %s needs a number", p.ID, c.Op)
+			}
+		default:
+			return fmt.Errorf("authz: policy %s has invalid operator %q", p.ID, c.Op)
+		}
+	}
+	return nil
+}
+
+func validAttr(attr string) bool {
+	return strings.HasPrefix(attr, "subject.") || strings.HasPrefix(attr, "resource.")
+}
+
+// Matches reports whether p applies to req.
+func (p Policy) Matches(req Request) bool {
+	matched := false
+	for _, a := range p.Actions {
+		if a == "*" || a == req.Action {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, c := range p.Conditions {
+		if !c.holds(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) holds(req Request) bool {
+	v, ok := lookup(req, c.Attr)
+	if c.Op == OpExists {
+		return ok
+	}
+	if !ok {
+		return c.Op == OpNotEquals
+	}
+	want := c.Value
+	if c.Ref != "" {
+		if want, ok = lookup(req, c.Ref); !ok {
+			return c.Op == OpNotEquals
+		}
+	}
+
+	switch c.Op {
+	case OpEquals:
+		return equal(v, want)
+	case OpNotEquals:
+		return !equal(v, want)
+	case OpIn:
+		return contains(want, v)
+	case OpContains:
+		return contains(v, want)
+	case OpGreater, OpLess:
+		a, ok1 := number(v)
+		b, ok2 := number(want)
+		if !ok1 || !ok2 {
+			return false
+		}
+		if c.Op == OpGreater {
+			return a > b
+		}
+		return a < b
+	}
+	return false
+}
+
+// lookup returns the attribute at a path like "subject.org.id".
+func lookup(req Request, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	var v interface{}
+	switch parts[0] {
+	case "subject":
+		v = map[string]interface{}(req.Subject)
+	case "resource":
+		v = map[string]interface{}(req.Resource)
+	default:
+		return nil, false
+	}
+	for _, p := range parts[1:] {
+		var m map[string]interface{}
+		switch mv := v.(type) {
+		case map[string]interface{}:
+			m = mv
+		case Attributes:
+			m = mv
+		default:
+			return nil, false
+		}
+		var ok bool
+		if v, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// equal compares attributes, numbers of any type are equal by value since policies decoded from
+// files hold other number types than attributes set in code.
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(list, v interface{}) bool {
+	l := reflect.ValueOf(list)
+	if l.Kind() != reflect.Slice && l.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < l.Len(); i++ {
+		if equal(l.Index(i).Interface(), v) {
+			return true
+		}
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,109 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	stdos "os"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+	"gopkg.in/yaml.v3"
+)
+
+const policiesTable = "gox_authz_policies"
+
+// Store provides the policies of an Engine, which loads them again on Reload.
+type Store interface {
+	Policies(ctx context.Context) ([]Policy, error)
+}
+
+// Policies is a Store of fixed policies.
+type Policies []Policy
+
+func (p Policies) Policies(context.Context) ([]Policy, error) {
+	return p, nil
+}
+
+// FileStore reads policies from a yaml or json file holding a list of policies.
+type FileStore string
+
+func (f FileStore) Policies(context.Context) ([]Policy, error) {
+	b, err := stdos.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	// json is yaml, so one decoder reads both
+	var policies []Policy
+	if err := yaml.Unmarshal(b, &policies); err != nil {
+		return nil, fmt.Errorf("authz: read %s: %w", f, err)
+	}
+	return policies, nil
+}
+
+// PgStore keeps policies in postgres, so they can be changed without deploys.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the policies of db, creating their table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+policiesTable+` (
+		id text PRIMARY KEY,
+		policy jsonb NOT NULL,
+		updated_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+func (s *PgStore) Policies(ctx context.Context) ([]Policy, error) {
+	rows, err := s.db.Query(ctx, "SELECT policy FROM "+policiesTable+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []Policy
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var p Policy
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// Put creates or replaces the policy with the id of p.
+func (s *PgStore) Put(ctx context.Context, p Policy) error {
+	if err := p.Validate(); err != nil {
+		return errs.Invalid("%s", err)
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, "INSERT INTO "+policiesTable+" (id, policy, updated_at) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (id) DO UPDATE SET policy = excluded.policy, updated_at = excluded.updated_at",
+		p.ID, string(raw), clock.FromContext(ctx).Now())
+	return err
+}
+
+func (s *PgStore) Delete(ctx context.Context, id string) error {
+	tag, err := s.db.Exec(ctx, "DELETE FROM "+policiesTable+" WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.NotFound("policy %s not found", id)
+	}
+	return nil
+}
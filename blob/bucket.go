@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+)
+
+// Bucket is a blob backend able to read and write objects, like S3.
+type Bucket interface {
+	// List returns the keys of the objects whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Get returns the content of the object at key, an errs.NotFound error if there is none
+	Get(ctx context.Context, key string) (body io.ReadCloser, contentType string, err error)
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		res, err := s.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("blob: list %s: %w", prefix, err)
+		}
+
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return res.Body, res.Header.Get("Content-Type"), nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	headers := map[string]string{"content-length": strconv.FormatInt(size, 10)}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+	res, err := s.do(ctx, http.MethodPut, key, nil, headers, body)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// do sends a presigned request and returns its response if it succeeded.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, headers map[string]string, body io.Reader) (*http.Response, error) {
+	u := s.presign(method, key, query, headers, time.Minute, clock.FromContext(ctx).Now().UTC())
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if n, err := strconv.ParseInt(headers["content-length"], 10, 64); err == nil {
+		req.ContentLength = n
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return res, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errs.NotFound("object %s does not exist", key)
+	}
+	return nil, fmt.Errorf("blob: %s %s failed with status %d: %s", method, key, res.StatusCode, msg)
+}
@@ -0,0 +1,251 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+)
+
+const (
+	amzAlgorithm  = "AWS4-HMAC-SHA256"
+	amzDateFormat = "20060102T150405Z"
+)
+
+// S3Config is the bucket uploads go to, on AWS or a S3 compatible storage like MinIO.
+type S3Config struct {
+	// Endpoint like https://s3.eu-central-1.amazonaws.com
+	Endpoint        string `env:"BLOB_S3_ENDPOINT,required" validate:"url"`
+	Region          string `env:"BLOB_S3_REGION" envDefault:"us-east-1"`
+	Bucket          string `env:"BLOB_S3_BUCKET,required"`
+	AccessKeyID     string `env:"BLOB_S3_ACCESS_KEY_ID,required"`
+	SecretAccessKey string `env:"BLOB_S3_SECRET_ACCESS_KEY,required"`
+	// PathStyle addresses the bucket in the path instead of the host name, most S3 compatible storages need it
+	PathStyle bool `env:"BLOB_S3_PATH_STYLE"`
+}
+
+// S3 presigns requests to a S3 bucket with signature version 4.
+type S3 struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 returns a S3 presigner, client is used by Stat and may be nil for http.DefaultClient.
+func NewS3(conf S3Config, client *http.Client) (*S3, error) {
+	u, err := url.Parse(conf.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("blob: invalid endpoint %q", conf.Endpoint)
+	}
+	if conf.Bucket == "" {
+		return nil, errors.New("blob: bucket is required")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{conf: conf, endpoint: u, client: client}, nil
+}
+
+// PresignUpload returns a PUT request signing the content type and the declared size, or with
+// c.Post a form POST whose policy limits the size to c.MaxSize.
+func (s *S3) PresignUpload(ctx context.Context, key string, c UploadConstraints) (*PresignedUpload, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	if c.Post {
+		return s.presignPost(key, c, now)
+	}
+
+	// the length is signed even when it is 0, an unsigned one would let the client upload any size
+	headers := map[string]string{"content-type": c.ContentType, "content-length": strconv.FormatInt(c.Size, 10)}
+	u := s.presign(http.MethodPut, key, nil, headers, c.Expires, now)
+
+	return &PresignedUpload{
+		Method:    http.MethodPut,
+		URL:       u,
+		Headers:   map[string]string{"Content-Type": c.ContentType},
+		ExpiresAt: now.Add(c.Expires),
+	}, nil
+}
+
+// Stat returns the size and content type of the object at key, an errs.NotFound error if there is none.
+func (s *S3) Stat(ctx context.Context, key string) (int64, string, error) {
+	u := s.presign(http.MethodHead, key, nil, nil, time.Minute, clock.FromContext(ctx).Now().UTC())
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return 0, "", errs.NotFound("object %s does not exist", key)
+	case res.StatusCode != http.StatusOK:
+		return 0, "", fmt.Errorf("blob: stat %s failed with status %d", key, res.StatusCode)
+	}
+	return res.ContentLength, res.Header.Get("Content-Type"), nil
+}
+
+// objectURL returns the url of key and the host it is signed for.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + key
+	if s.conf.PathStyle {
+		path = "/" + s.conf.Bucket + path
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = escapePath(path)
+	return &u
+}
+
+// presign returns the url of a query string signed request with the parameters of query, headers are
+// lower case and must be sent as given.
+func (s *S3) presign(method, key string, query url.Values, headers map[string]string, expires time.Duration, now time.Time) string {
+	u := s.objectURL(key)
+	date := now.Format(amzDateFormat)
+	scope := now.Format("20060102") + "/" + s.conf.Region + "/s3/aws4_request"
+
+	signed := map[string]string{"host": u.Host}
+	for k, v := range headers {
+		signed[k] = v
+	}
+	names := make([]string, 0, len(signed))
+	for k := range signed {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(signed[k]) + "\n")
+	}
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("X-Amz-Algorithm", amzAlgorithm)
+	q.Set("X-Amz-Credential", s.conf.AccessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", date)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", strings.Join(names, ";"))
+	canonical := canonicalQuery(q)
+
+	canonicalRequest := strings.Join([]string{
+		method, u.RawPath, canonical, canonicalHeaders.String(), strings.Join(names, ";"), "UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := amzAlgorithm + "\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	signature := hex.EncodeToString(hmacSHA256(s.signingKey(now), stringToSign))
+	u.RawQuery = canonical + "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+func (s *S3) presignPost(key string, c UploadConstraints, now time.Time) (*PresignedUpload, error) {
+	date := now.Format(amzDateFormat)
+	credential := s.conf.AccessKeyID + "/" + now.Format("20060102") + "/" + s.conf.Region + "/s3/aws4_request"
+	expiresAt := now.Add(c.Expires)
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expiresAt.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": []interface{}{
+			map[string]string{"bucket": s.conf.Bucket},
+			[]string{"eq", "$key", key},
+			[]string{"eq", "$Content-Type", c.ContentType},
+			[]interface{}{"content-length-range", 0, c.MaxSize},
+			map[string]string{"x-amz-algorithm": amzAlgorithm},
+			map[string]string{"x-amz-credential": credential},
+			map[string]string{"x-amz-date": date},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(policy)
+
+	u := s.objectURL("")
+	u.Path, u.RawPath = strings.TrimSuffix(u.Path, "/")+"/", ""
+	return &PresignedUpload{
+		Method: http.MethodPost,
+		URL:    u.String(),
+		Fields: map[string]string{
+			"key":              key,
+			"Content-Type":     c.ContentType,
+			"policy":           encoded,
+			"x-amz-algorithm":  amzAlgorithm,
+			"x-amz-credential": credential,
+			"x-amz-date":       date,
+			"x-amz-signature":  hex.EncodeToString(hmacSHA256(s.signingKey(now), encoded)),
+		},
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *S3) signingKey(now time.Time) []byte {
+	k := hmacSHA256([]byte("AWS4"+s.conf.SecretAccessKey), now.Format("20060102"))
+	k = hmacSHA256(k, s.conf.Region)
+	k = hmacSHA256(k, "s3")
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes q sorted by key with the uri encoding of signature version 4.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapePath(path string) string {
+	return uriEncode(path, false)
+}
+
+// uriEncode escapes everything but unreserved characters, and slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,381 @@
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/mirzakhany/gox/store"
+)
+
+const (
+	DefaultUploadExpiry = 15 * time.Minute
+	DefaultMaxSize      = 10 << 20
+
+	uploadsTable = "gox_uploads"
+)
+
+// UploadConstraints limit what a presigned upload accepts.
+type UploadConstraints struct {
+	ContentType string
+	// Size is the size the client declared, PUT uploads must have exactly this size
+	Size int64
+	// MaxSize is enforced by the storage for POST uploads and by Confirm for both
+	MaxSize int64
+	Expires time.Duration
+	// Post uses a form POST with a policy instead of a PUT
+	Post bool
+}
+
+// PresignedUpload is what the client needs to upload directly to the storage. for PUT the Headers
+// must be sent as given, for POST the Fields are sent as form fields before the file field.
+type PresignedUpload struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Presigner is a blob backend able to presign uploads, like S3.
+type Presigner interface {
+	PresignUpload(ctx context.Context, key string, c UploadConstraints) (*PresignedUpload, error)
+	// Stat returns the size and content type of the object at key, an errs.NotFound error if there is none
+	Stat(ctx context.Context, key string) (size int64, contentType string, err error)
+}
+
+type UploadState string
+
+const (
+	UploadPending   UploadState = "pending"
+	UploadConfirmed UploadState = "confirmed"
+)
+
+// Upload records an issued presigned upload, until it is confirmed the object may not exist.
+type Upload struct {
+	ID          string      `json:"id"`
+	Key         string      `json:"key"`
+	Owner       string      `json:"-"`
+	ContentType string      `json:"content_type"`
+	MaxSize     int64       `json:"max_size"`
+	Size        int64       `json:"size,omitempty"`
+	State       UploadState `json:"state"`
+	CreatedAt   time.Time   `json:"created_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	ConfirmedAt *time.Time  `json:"confirmed_at,omitempty"`
+}
+
+// Uploads stores upload records in postgres.
+type Uploads struct {
+	db store.Querier
+}
+
+// NewUploads returns the upload records of db, creating their table if needed.
+func NewUploads(ctx context.Context, db store.Querier) (*Uploads, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+uploadsTable+` (
+		id text PRIMARY KEY,
+		key text NOT NULL,
+		owner text NOT NULL,
+		content_type text NOT NULL,
+		max_size bigint NOT NULL,
+		size bigint NOT NULL DEFAULT 0,
+		state text NOT NULL,
+		created_at timestamptz NOT NULL,
+		expires_at timestamptz NOT NULL,
+		confirmed_at timestamptz
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &Uploads{db: db}, nil
+}
+
+func (u *Uploads) Create(ctx context.Context, up *Upload) error {
+	_, err := u.db.Exec(ctx, "INSERT INTO "+uploadsTable+" (id, key, owner, content_type, max_size, state, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		up.ID, up.Key, up.Owner, up.ContentType, up.MaxSize, up.State, up.CreatedAt, up.ExpiresAt)
+	return err
+}
+
+func (u *Uploads) Get(ctx context.Context, id string) (*Upload, error) {
+	var up Upload
+	err := u.db.QueryRow(ctx, "SELECT id, key, owner, content_type, max_size, size, state, created_at, expires_at, confirmed_at FROM "+uploadsTable+" WHERE id = $1", id).
+		Scan(&up.ID, &up.Key, &up.Owner, &up.ContentType, &up.MaxSize, &up.Size, &up.State, &up.CreatedAt, &up.ExpiresAt, &up.ConfirmedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.NotFound("upload not found")
+	}
+	return &up, err
+}
+
+// Confirm marks a pending upload as confirmed with the size of the stored object.
+func (u *Uploads) Confirm(ctx context.Context, id string, size int64, at time.Time) error {
+	tag, err := u.db.Exec(ctx, "UPDATE "+uploadsTable+" SET state = $2, size = $3, confirmed_at = $4 WHERE id = $1 AND state = $5",
+		id, UploadConfirmed, size, at, UploadPending)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.Conflict("upload is not pending")
+	}
+	return nil
+}
+
+// DeleteExpired removes pending uploads which expired before t, their objects are not deleted.
+func (u *Uploads) DeleteExpired(ctx context.Context, t time.Time) (int64, error) {
+	tag, err := u.db.Exec(ctx, "DELETE FROM "+uploadsTable+" WHERE state = $1 AND expires_at < $2", UploadPending, t)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// UploadStore is where the upload handler records uploads, *Uploads for postgres.
+type UploadStore interface {
+	Create(ctx context.Context, up *Upload) error
+	Get(ctx context.Context, id string) (*Upload, error)
+	Confirm(ctx context.Context, id string, size int64, at time.Time) error
+}
+
+type uploadConfig struct {
+	contentTypes []string
+	maxSize      int64
+	expiry       time.Duration
+	prefix       string
+	post         bool
+	owner        func(r *http.Request) string
+	onConfirm    func(ctx context.Context, up *Upload) error
+}
+
+type UploadOption func(*uploadConfig) error
+
+// WithContentTypes sets the content types clients may upload, like image/png or image/*. anything
+// is accepted by default.
+func WithContentTypes(types ...string) UploadOption {
+	return func(c *uploadConfig) error {
+		c.contentTypes = types
+		return nil
+	}
+}
+
+// WithMaxSize sets the largest upload in bytes, DefaultMaxSize by default.
+func WithMaxSize(n int64) UploadOption {
+	return func(c *uploadConfig) error {
+		if n <= 0 {
+			return errors.New("blob: max size must be positive")
+		}
+		c.maxSize = n
+		return nil
+	}
+}
+
+// WithUploadExpiry sets how long presigned urls are valid, DefaultUploadExpiry by default.
+func WithUploadExpiry(d time.Duration) UploadOption {
+	return func(c *uploadConfig) error {
+		c.expiry = d
+		return nil
+	}
+}
+
+// WithKeyPrefix stores uploads under prefix, like "avatars/".
+func WithKeyPrefix(prefix string) UploadOption {
+	return func(c *uploadConfig) error {
+		c.prefix = prefix
+		return nil
+	}
+}
+
+// WithPostPolicy issues form POST uploads, for which the storage enforces the max size itself.
+func WithPostPolicy() UploadOption {
+	return func(c *uploadConfig) error {
+		c.post = true
+		return nil
+	}
+}
+
+// WithOwner sets who an upload belongs to, only they can confirm it. by default it is the user id of
+// the rest.RequestMeta of the request.
+func WithOwner(owner func(r *http.Request) string) UploadOption {
+	return func(c *uploadConfig) error {
+		c.owner = owner
+		return nil
+	}
+}
+
+// WithOnConfirm is called with confirmed uploads, like to attach them to the entity they were made for.
+// it runs before the upload is stored as confirmed, an error fails the confirmation and leaves the upload
+// pending, so the client can confirm again.
+func WithOnConfirm(fn func(ctx context.Context, up *Upload) error) UploadOption {
+	return func(c *uploadConfig) error {
+		c.onConfirm = fn
+		return nil
+	}
+}
+
+type createUploadRequest struct {
+	Filename    string `json:"filename" validate:"required,max=255"`
+	ContentType string `json:"content_type" validate:"required"`
+	Size        int64  `json:"size" validate:"gte=0"`
+}
+
+type createUploadResponse struct {
+	Upload *Upload          `json:"upload"`
+	Target *PresignedUpload `json:"target"`
+}
+
+// UploadHandler serves direct to storage uploads. POST / takes the filename, content type and size of
+// a file and returns a presigned request to upload it with, recorded as a pending upload. once the
+// client uploaded it, POST /{id}/confirm checks the object exists within the constraints and confirms it.
+// example:
+//
+//	uploads, err := blob.NewUploads(ctx, pool)
+//	handler, err := blob.UploadHandler(s3, uploads,
+//		blob.WithKeyPrefix("avatars/"),
+//		blob.WithContentTypes("image/png", "image/jpeg"),
+//		blob.WithMaxSize(5<<20))
+//	router.Mount("/uploads", handler)
+func UploadHandler(p Presigner, uploads UploadStore, options ...UploadOption) (http.Handler, error) {
+	cfg := &uploadConfig{
+		maxSize: DefaultMaxSize,
+		expiry:  DefaultUploadExpiry,
+		owner: func(r *http.Request) string {
+			if meta, ok := rest.RequestMetaFrom(r.Context()); ok {
+				return meta.UserID
+			}
+			return ""
+		},
+	}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	h := &uploadHandler{cfg: cfg, presigner: p, uploads: uploads}
+	router := chi.NewRouter()
+	router.Post("/", h.create)
+	router.Post("/{id}/confirm", h.confirm)
+	return router, nil
+}
+
+type uploadHandler struct {
+	cfg       *uploadConfig
+	presigner Presigner
+	uploads   UploadStore
+}
+
+func (h *uploadHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req createUploadRequest
+	if code, err := rest.BindJSON(r, &req); err != nil {
+		rest.WriteError(w, code, err.Error())
+		return
+	}
+	if !h.allowedType(req.ContentType) {
+		rest.WriteErr(w, errs.Invalid("content type %s is not allowed", req.ContentType))
+		return
+	}
+	if req.Size > h.cfg.maxSize {
+		rest.WriteErr(w, errs.Invalid("file is larger than %d bytes", h.cfg.maxSize))
+		return
+	}
+
+	now := clock.FromContext(r.Context()).Now().UTC()
+	id := newID()
+	up := &Upload{
+		ID:          id,
+		Key:         h.cfg.prefix + id + strings.ToLower(path.Ext(req.Filename)),
+		Owner:       h.cfg.owner(r),
+		ContentType: req.ContentType,
+		MaxSize:     h.cfg.maxSize,
+		State:       UploadPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(h.cfg.expiry),
+	}
+
+	target, err := h.presigner.PresignUpload(r.Context(), up.Key, UploadConstraints{
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		MaxSize:     h.cfg.maxSize,
+		Expires:     h.cfg.expiry,
+		Post:        h.cfg.post,
+	})
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	if err := h.uploads.Create(r.Context(), up); err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusCreated, createUploadResponse{Upload: up, Target: target})
+}
+
+func (h *uploadHandler) confirm(w http.ResponseWriter, r *http.Request) {
+	up, err := h.uploads.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	// uploads of others are reported as missing, so their ids can not be probed
+	if up.Owner != h.cfg.owner(r) {
+		rest.WriteErr(w, errs.NotFound("upload not found"))
+		return
+	}
+	if up.State != UploadPending {
+		rest.WriteErr(w, errs.Conflict("upload is already confirmed"))
+		return
+	}
+
+	size, contentType, err := h.presigner.Stat(r.Context(), up.Key)
+	if err != nil {
+		if errs.CodeOf(err) == errs.CodeNotFound {
+			err = errs.Wrap(err, errs.CodeFailedPrecondition, "file has not been uploaded")
+		}
+		rest.WriteErr(w, err)
+		return
+	}
+	if size > up.MaxSize || (contentType != "" && contentType != up.ContentType) {
+		rest.WriteErr(w, errs.Invalid("uploaded file does not match the upload"))
+		return
+	}
+
+	now := clock.FromContext(r.Context()).Now().UTC()
+	up.State, up.Size, up.ConfirmedAt = UploadConfirmed, size, &now
+	if h.cfg.onConfirm != nil {
+		if err := h.cfg.onConfirm(r.Context(), up); err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+	}
+	if err := h.uploads.Confirm(r.Context(), up.ID, size, now); err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, up)
+}
+
+func (h *uploadHandler) allowedType(contentType string) bool {
+	if len(h.cfg.contentTypes) == 0 {
+		return true
+	}
+	for _, t := range h.cfg.contentTypes {
+		if t == contentType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
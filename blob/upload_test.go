@@ -0,0 +1,116 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePresigner struct {
+	objects map[string]int64
+}
+
+func (p *fakePresigner) PresignUpload(_ context.Context, key string, c UploadConstraints) (*PresignedUpload, error) {
+	return &PresignedUpload{Method: http.MethodPut, URL: "https://storage.test/" + key, ExpiresAt: time.Now().Add(c.Expires)}, nil
+}
+
+func (p *fakePresigner) Stat(_ context.Context, key string) (int64, string, error) {
+	size, ok := p.objects[key]
+	if !ok {
+		return 0, "", errs.NotFound("object %s does not exist", key)
+	}
+	return size, "image/png", nil
+}
+
+type memoryUploads map[string]*Upload
+
+func (m memoryUploads) Create(_ context.Context, up *Upload) error {
+	cp := *up
+	m[up.ID] = &cp
+	return nil
+}
+
+func (m memoryUploads) Get(_ context.Context, id string) (*Upload, error) {
+	up, ok := m[id]
+	if !ok {
+		return nil, errs.NotFound("upload not found")
+	}
+	cp := *up
+	return &cp, nil
+}
+
+func (m memoryUploads) Confirm(_ context.Context, id string, size int64, at time.Time) error {
+	m[id].State, m[id].Size, m[id].ConfirmedAt = UploadConfirmed, size, &at
+	return nil
+}
+
+func TestUploadHandler(t *testing.T) {
+	presigner := &fakePresigner{objects: map[string]int64{}}
+	uploads := memoryUploads{}
+	attachErr := errors.New("user is gone")
+	handler, err := UploadHandler(presigner, uploads, WithKeyPrefix("avatars/"), WithContentTypes("image/*"), WithMaxSize(1000),
+		WithOnConfirm(func(ctx context.Context, up *Upload) error { return attachErr }))
+	require.NoError(t, err)
+
+	do := func(path string, body interface{}, user string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+		r = r.WithContext(rest.WithRequestMetaContext(r.Context(), &rest.RequestMeta{UserID: user}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	{ // constraints
+		w := do("/", createUploadRequest{Filename: "a.pdf", ContentType: "application/pdf", Size: 10}, "alice")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		w = do("/", createUploadRequest{Filename: "a.png", ContentType: "image/png", Size: 5000}, "alice")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	w := do("/", createUploadRequest{Filename: "Me.PNG", ContentType: "image/png", Size: 500}, "alice")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created createUploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Equal(t, UploadPending, created.Upload.State)
+	require.Regexp(t, `^avatars/[0-9a-f]{32}\.png$`, created.Upload.Key)
+	require.Equal(t, "https://storage.test/"+created.Upload.Key, created.Target.URL)
+
+	confirm := "/" + created.Upload.ID + "/confirm"
+
+	{ // not uploaded yet
+		w := do(confirm, nil, "alice")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	presigner.objects[created.Upload.Key] = 500
+
+	{ // others can not confirm it
+		w := do(confirm, nil, "bob")
+		require.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	{ // failing to attach the upload leaves it pending
+		w := do(confirm, nil, "alice")
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.Equal(t, UploadPending, uploads[created.Upload.ID].State)
+	}
+
+	attachErr = nil
+	w = do(confirm, nil, "alice")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, UploadConfirmed, uploads[created.Upload.ID].State)
+	require.EqualValues(t, 500, uploads[created.Upload.ID].Size)
+
+	w = do(confirm, nil, "alice")
+	require.Equal(t, http.StatusConflict, w.Code)
+}
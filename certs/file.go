@@ -0,0 +1,176 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/probe"
+	"go.uber.org/zap"
+)
+
+const DefaultWatchInterval = time.Minute
+
+var ErrExpiresSoon = errors.New("certificate expires soon")
+
+type config struct {
+	logger *zap.Logger
+}
+
+type Option func(*config) error
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(c *config) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// FileProvider serves a certificate loaded from pem files and reloads it when the files change,
+// so renewed certificates are picked up without a restart.
+// example:
+//
+//	provider, err := certs.NewFileProvider("/etc/tls/tls.crt", "/etc/tls/tls.key")
+//	go provider.Watch(ctx, certs.DefaultWatchInterval)
+//	srv.TLSConfig = provider.TLSConfig()
+type FileProvider struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	notAfter time.Time
+	modTime  time.Time
+}
+
+// NewFileProvider loads the certificate and returns an error if it is invalid.
+func NewFileProvider(certFile, keyFile string, options ...Option) (*FileProvider, error) {
+	cfg := &config{logger: zap.NewNop()}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &FileProvider{certFile: certFile, keyFile: keyFile, logger: cfg.logger}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload loads the certificate files again. the current certificate is kept if they are invalid.
+func (p *FileProvider) Reload() error {
+	modTime, err := p.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate failed: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parse certificate failed: %w", err)
+	}
+	cert.Leaf = leaf
+
+	p.mu.Lock()
+	p.cert = &cert
+	p.notAfter = leaf.NotAfter
+	p.modTime = modTime
+	p.mu.Unlock()
+
+	p.logger.Info("certificate loaded", zap.String("subject", leaf.Subject.String()), zap.Time("notAfter", leaf.NotAfter))
+	return nil
+}
+
+// Watch checks the files every interval and reloads the certificate when they change, until ctx is done.
+func (p *FileProvider) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := p.lastModified()
+			if err != nil {
+				p.logger.Error("check certificate files failed", zap.Error(err))
+				continue
+			}
+
+			p.mu.RLock()
+			changed := modTime.After(p.modTime)
+			p.mu.RUnlock()
+
+			if !changed {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				p.logger.Error("reload certificate failed, keep serving the current one", zap.Error(err))
+			}
+		}
+	}
+}
+
+// GetCertificate can be used as tls.Config GetCertificate.
+func (p *FileProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cert, nil
+}
+
+// TLSConfig returns a tls config serving the certificate of the provider.
+func (p *FileProvider) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: p.GetCertificate,
+	}
+}
+
+// NotAfter returns the expiry time of the current certificate.
+func (p *FileProvider) NotAfter() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.notAfter
+}
+
+// Probe returns a readiness probe failing when the certificate expires within minValidity, so an
+// instance with a stale certificate is taken out of rotation before clients start failing.
+func (p *FileProvider) Probe(minValidity time.Duration) probe.Probe {
+	return ExpiryProbe(p.NotAfter, minValidity)
+}
+
+// ExpiryProbe returns a readiness probe failing when notAfter returns a time within minValidity.
+func ExpiryProbe(notAfter func() time.Time, minValidity time.Duration) probe.Probe {
+	return probe.WithProbe(probe.Readiness, func() error {
+		if left := time.Until(notAfter()); left < minValidity {
+			return fmt.Errorf("%w: %s left", ErrExpiresSoon, left.Round(time.Second))
+		}
+		return nil
+	})
+}
+
+func (p *FileProvider) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{p.certFile, p.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
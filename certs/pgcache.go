@@ -0,0 +1,49 @@
+package certs
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const pgCacheTable = "autocert_cache"
+
+// PgCache stores autocert certificates and account keys in postgres, so all instances of a
+// service share them instead of each requesting its own.
+type PgCache struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgCache creates the cache table if missing.
+func NewPgCache(ctx context.Context, pool *pgxpool.Pool) (*PgCache, error) {
+	_, err := pool.Exec(ctx, "create table if not exists "+pgCacheTable+
+		" (key text primary key, data bytea not null, updated_at timestamptz not null default now())")
+	if err != nil {
+		return nil, err
+	}
+	return &PgCache{pool: pool}, nil
+}
+
+var _ autocert.Cache = (*PgCache)(nil)
+
+func (c *PgCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := c.pool.QueryRow(ctx, "select data from "+pgCacheTable+" where key = $1", key).Scan(&data)
+	if err == pgx.ErrNoRows {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, err
+}
+
+func (c *PgCache) Put(ctx context.Context, key string, data []byte) error {
+	_, err := c.pool.Exec(ctx, "insert into "+pgCacheTable+" (key, data) values ($1, $2) "+
+		"on conflict (key) do update set data = excluded.data, updated_at = now()", key, data)
+	return err
+}
+
+func (c *PgCache) Delete(ctx context.Context, key string) error {
+	_, err := c.pool.Exec(ctx, "delete from "+pgCacheTable+" where key = $1", key)
+	return err
+}
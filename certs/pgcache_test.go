@@ -0,0 +1,40 @@
+package certs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestPgCache(t *testing.T) {
+	pool := goxtest.NewTestDB(t)
+	ctx := context.Background()
+
+	c, err := NewPgCache(ctx, pool)
+	require.NoError(t, err)
+	_, err = NewPgCache(ctx, pool)
+	require.NoError(t, err, "creating the table again")
+
+	{ // missing keys are cache misses
+		_, err := c.Get(ctx, "example.com")
+		require.ErrorIs(t, err, autocert.ErrCacheMiss)
+	}
+
+	{ // put replaces the data of a key
+		require.NoError(t, c.Put(ctx, "example.com", []byte("first")))
+		require.NoError(t, c.Put(ctx, "example.com", []byte("second")))
+		data, err := c.Get(ctx, "example.com")
+		require.NoError(t, err)
+		require.Equal(t, []byte("second"), data)
+	}
+
+	{ // delete removes the key, deleting a missing one is fine
+		require.NoError(t, c.Delete(ctx, "example.com"))
+		_, err := c.Get(ctx, "example.com")
+		require.ErrorIs(t, err, autocert.ErrCacheMiss)
+		require.NoError(t, c.Delete(ctx, "example.com"))
+	}
+}
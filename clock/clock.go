@@ -0,0 +1,45 @@
+package clock
+
+import (
+	"context"
+	"time"
+
+	"github.com/mirzakhany/gox/ctxutil"
+)
+
+// Clock tells the time. code measuring durations, expiring entries or waiting between retries takes
+// it from the context, so tests can control time with goxtest.FakeClock instead of sleeping.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	// After is like time.After, fake clocks send on it when they are advanced past d
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the Clock of the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+var clockKey = ctxutil.NewKey[Clock]("clock")
+
+// WithContext returns a copy of ctx holding c.
+// example:
+//
+//	fake := goxtest.NewFakeClock(time.Now())
+//	r = r.WithContext(clock.WithContext(r.Context(), fake))
+func WithContext(ctx context.Context, c Clock) context.Context {
+	return clockKey.Set(ctx, c)
+}
+
+// FromContext returns the clock of ctx, Real if it has none.
+func FromContext(ctx context.Context) Clock {
+	if c, ok := clockKey.Get(ctx); ok && c != nil {
+		return c
+	}
+	return Real
+}
@@ -0,0 +1,239 @@
+// Command gox holds tools for services built with gox.
+//
+//	gox probe --url http://127.0.0.1:8080 [--checks ready,alive] [--timeout 3s]
+//
+// probe requests the probes of a service and exits with status 1 if one fails, for docker
+// HEALTHCHECK or kubernetes exec probes when http probes are not possible.
+//
+//	gox doctor [--env-file .env.example] [--db postgres://...] [--jwks url] [--port 8080] [--time-url url]
+//
+// doctor inspects the environment of a service and prints what to fix, it exits with status 1 if a
+// check fails. services can run the same checks against their config struct with the doctor package.
+//
+//	gox dlq list [--queue emails] [--limit 50]
+//	gox dlq show <id>
+//	gox dlq edit <id> --payload '{"to":"a@example.com"}'
+//	gox dlq replay <id>
+//
+// dlq inspects, fixes and replays the taskq tasks which ran out of attempts, in the database of
+// --db or $DATABASE_URL. edits and replays are logged with the --actor, $USER by default.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/doctor"
+	"github.com/mirzakhany/gox/probe"
+	"github.com/mirzakhany/gox/taskq"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "probe":
+		os.Exit(runProbe(os.Args[2:]))
+	case "doctor":
+		os.Exit(runDoctor(os.Args[2:]))
+	case "dlq":
+		os.Exit(runDLQ(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gox probe --url http://127.0.0.1:8080 [--checks ready,alive] [--timeout 3s]")
+	fmt.Fprintln(os.Stderr, "       gox doctor [--env-file .env.example] [--db postgres://...] [--jwks url] [--port 8080] [--time-url url]")
+	fmt.Fprintln(os.Stderr, "       gox dlq list|show|edit|replay [--db postgres://...] [--queue name] [id]")
+}
+
+func runProbe(args []string) int {
+	fs := flag.NewFlagSet("probe", flag.ContinueOnError)
+	url := fs.String("url", "http://127.0.0.1:8080", "base url of the probe server")
+	checks := fs.String("checks", "ready,alive", "comma separated probes to check")
+	timeout := fs.Duration("timeout", 3*time.Second, "timeout of all checks")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	failed := false
+	for _, check := range strings.Split(*checks, ",") {
+		check = strings.TrimSpace(check)
+		if check == "" {
+			continue
+		}
+		if err := probe.Check(ctx, strings.TrimSuffix(*url, "/")+"/"+check); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", check, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	envFile := fs.String("env-file", "", "env file listing the variables the service needs, like .env.example")
+	db := fs.String("db", os.Getenv("DATABASE_URL"), "dsn of the database to connect to")
+	jwks := fs.String("jwks", "", "url of the json web key set tokens are verified with")
+	port := fs.String("port", "", "port the service listens on")
+	timeURL := fs.String("time-url", "", "url whose Date header the local clock is compared with")
+	maxSkew := fs.Duration("max-skew", doctor.DefaultMaxSkew, "clock skew to tolerate")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var checks []doctor.Check
+	if *envFile != "" {
+		checks = append(checks, doctor.EnvFile(*envFile))
+	}
+	if *db != "" {
+		checks = append(checks, doctor.Database(*db))
+	}
+	if *jwks != "" {
+		checks = append(checks, doctor.JWKS(*jwks))
+	}
+	if *port != "" {
+		checks = append(checks, doctor.Port(*port))
+	}
+	if *timeURL != "" {
+		checks = append(checks, doctor.ClockSkew(*timeURL, *maxSkew))
+	}
+	if len(checks) == 0 {
+		fmt.Fprintln(os.Stderr, "nothing to check, see gox doctor --help")
+		return 2
+	}
+
+	if !doctor.Run(context.Background(), os.Stdout, checks...) {
+		return 1
+	}
+	return 0
+}
+
+type dlqOptions struct {
+	id      string
+	db      string
+	queue   string
+	limit   int
+	payload string
+	actor   string
+}
+
+// parseDLQ parses the flags of a dlq command, before or after the task id.
+func parseDLQ(command string, args []string) (dlqOptions, error) {
+	var o dlqOptions
+	fs := flag.NewFlagSet("dlq "+command, flag.ContinueOnError)
+	fs.StringVar(&o.db, "db", os.Getenv("DATABASE_URL"), "dsn of the database holding the tasks")
+	fs.StringVar(&o.queue, "queue", "", "queue to list, all queues by default")
+	fs.IntVar(&o.limit, "limit", taskq.DefaultDeadLetterPageSize, "number of tasks to list")
+	fs.StringVar(&o.payload, "payload", "", "new json payload of the task")
+	fs.StringVar(&o.actor, "actor", os.Getenv("USER"), "who is changing the task, for the audit log")
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	// flag stops at the first positional argument, the flags following the id are parsed again
+	if fs.NArg() > 0 {
+		o.id = fs.Arg(0)
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return o, err
+		}
+	}
+	if fs.NArg() > 0 {
+		err := fmt.Errorf("unexpected arguments %v", fs.Args())
+		fmt.Fprintln(fs.Output(), err)
+		return o, err
+	}
+	return o, nil
+}
+
+func runDLQ(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	command := args[0]
+	opts, err := parseDLQ(command, args[1:])
+	if err != nil {
+		return 2
+	}
+	if command != "list" && opts.id == "" {
+		fmt.Fprintf(os.Stderr, "gox dlq %s needs a task id\n", command)
+		return 2
+	}
+	if opts.db == "" {
+		fmt.Fprintln(os.Stderr, "no database, set --db or DATABASE_URL")
+		return 2
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.Connect(ctx, opts.db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect to database: %v\n", err)
+		return 1
+	}
+	defer pool.Close()
+
+	tasks := taskq.OpenPgStore(pool)
+	// the audit log goes to stderr, stdout holds the tasks
+	logger, err := zap.NewProduction()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer func() { _ = logger.Sync() }()
+	dl, err := taskq.NewDeadLetters(tasks, taskq.WithDeadLetterLogger(logger))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var out interface{}
+	switch command {
+	case "list":
+		out, err = dl.List(ctx, opts.queue, opts.limit, 0)
+	case "show":
+		out, err = dl.Get(ctx, opts.id)
+	case "edit":
+		if opts.payload == "" {
+			fmt.Fprintln(os.Stderr, "gox dlq edit needs --payload")
+			return 2
+		}
+		out, err = dl.Edit(ctx, opts.actor, opts.id, json.RawMessage(opts.payload))
+	case "replay":
+		out, err = dl.Replay(ctx, opts.actor, opts.id)
+	default:
+		usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
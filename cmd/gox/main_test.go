@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDLQ(t *testing.T) {
+	{ // flags after the id, as documented
+		o, err := parseDLQ("edit", []string{"42", "--payload", `{"to":"a@example.com"}`, "--actor", "bob"})
+		require.NoError(t, err)
+		require.Equal(t, "42", o.id)
+		require.Equal(t, `{"to":"a@example.com"}`, o.payload)
+		require.Equal(t, "bob", o.actor)
+	}
+	{ // flags before the id
+		o, err := parseDLQ("replay", []string{"--actor", "bob", "42"})
+		require.NoError(t, err)
+		require.Equal(t, "42", o.id)
+		require.Equal(t, "bob", o.actor)
+	}
+	{ // list takes no id
+		o, err := parseDLQ("list", []string{"--queue", "emails", "--limit", "5"})
+		require.NoError(t, err)
+		require.Empty(t, o.id)
+		require.Equal(t, "emails", o.queue)
+		require.Equal(t, 5, o.limit)
+	}
+	{ // a second id is rejected
+		_, err := parseDLQ("show", []string{"42", "43"})
+		require.Error(t, err)
+	}
+}
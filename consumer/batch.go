@@ -0,0 +1,265 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultMaxMessages = 100
+	DefaultMaxWait     = time.Second
+)
+
+// BatchHandler handles a batch of messages. returning nil acknowledges all of them, a *BatchError only
+// the ones which did not fail and any other error none of them.
+type BatchHandler func(ctx context.Context, msgs []Message) error
+
+type BatchOption func(*BatchConsumer) error
+
+// WithMaxMessages sets how many messages a batch holds at most, DefaultMaxMessages by default.
+func WithMaxMessages(n int) BatchOption {
+	return func(c *BatchConsumer) error {
+		if n <= 0 {
+			return errors.New("consumer: max messages must be positive")
+		}
+		c.maxMessages = n
+		return nil
+	}
+}
+
+// WithMaxBytes sets the size of the data of a batch at most, a message larger than it is handled in a
+// batch of its own. batches are not limited by size by default.
+func WithMaxBytes(n int) BatchOption {
+	return func(c *BatchConsumer) error {
+		if n <= 0 {
+			return errors.New("consumer: max bytes must be positive")
+		}
+		c.maxBytes = n
+		return nil
+	}
+}
+
+// WithMaxWait sets how long a batch waits to fill up after its first message, DefaultMaxWait by default.
+func WithMaxWait(d time.Duration) BatchOption {
+	return func(c *BatchConsumer) error {
+		if d <= 0 {
+			return errors.New("consumer: max wait must be positive")
+		}
+		c.maxWait = d
+		return nil
+	}
+}
+
+// WithMetrics registers the metrics.Async metrics of the "consumer" subsystem with reg, labeled by the
+// name of the consumer. messages are counted one by one, nacked ones as failed and retried, while the
+// duration is of whole batches. the lag is not known to the consumer and left unset.
+func WithMetrics(reg prometheus.Registerer) BatchOption {
+	return func(c *BatchConsumer) error {
+		m, err := metrics.NewAsync(reg, "consumer")
+		if err != nil {
+			return err
+		}
+		c.metrics = m
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) BatchOption {
+	return func(c *BatchConsumer) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// BatchConsumer receives messages of a Source into batches, closed by count, size or time, and passes
+// them to a handler. no message is received while a batch is handled, so a slow handler slows down
+// receiving instead of buffering messages in memory.
+type BatchConsumer struct {
+	name    string
+	source  Source
+	handler BatchHandler
+
+	maxMessages int
+	maxBytes    int
+	maxWait     time.Duration
+	logger      *zap.Logger
+	metrics     *metrics.Async
+}
+
+// NewBatchConsumer returns a consumer called name, it is a gox.Component to add to the Runner.
+// example:
+//
+//	c, err := consumer.NewBatchConsumer("search-indexer", source, indexDocuments,
+//		consumer.WithMaxMessages(500), consumer.WithMaxBytes(5<<20), consumer.WithMaxWait(2*time.Second))
+//	...
+//	runner, err := gox.NewRunner(gox.WithComponents(c, ...))
+func NewBatchConsumer(name string, source Source, handler BatchHandler, options ...BatchOption) (*BatchConsumer, error) {
+	c := &BatchConsumer{
+		name:        name,
+		source:      source,
+		handler:     handler,
+		maxMessages: DefaultMaxMessages,
+		maxWait:     DefaultMaxWait,
+		logger:      zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *BatchConsumer) Name() string {
+	return c.name
+}
+
+func (c *BatchConsumer) Describe() map[string]interface{} {
+	return map[string]interface{}{
+		"max_messages": c.maxMessages,
+		"max_bytes":    c.maxBytes,
+		"max_wait":     c.maxWait.String(),
+	}
+}
+
+type received struct {
+	msg Message
+	err error
+}
+
+// Run handles batches until ctx is done or the source fails. messages of the batch being filled when
+// ctx is done are neither acknowledged nor handled, the broker delivers them again.
+func (c *BatchConsumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the receiver hands over one message at a time, it waits while a batch is handled
+	in := make(chan received)
+	go func() {
+		for {
+			msg, err := c.source.Receive(ctx)
+			select {
+			case in <- received{msg: msg, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	clk := clock.FromContext(ctx)
+	var (
+		batch   []Message
+		size    int
+		timeout <-chan time.Time
+	)
+	flush := func() error {
+		b := batch
+		batch, size, timeout = nil, 0, nil
+		if len(b) == 0 {
+			return nil
+		}
+		return c.handle(ctx, b)
+	}
+
+	for {
+		select {
+		case r := <-in:
+			if r.err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return r.err
+			}
+			if c.maxBytes > 0 && len(batch) > 0 && size+len(r.msg.Data) > c.maxBytes {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if len(batch) == 0 {
+				timeout = clk.After(c.maxWait)
+			}
+			batch = append(batch, r.msg)
+			size += len(r.msg.Data)
+			if len(batch) >= c.maxMessages || (c.maxBytes > 0 && size >= c.maxBytes) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timeout:
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// handle passes msgs to the handler and acknowledges the handled ones, only failing acks and nacks stop
+// the consumer.
+func (c *BatchConsumer) handle(ctx context.Context, msgs []Message) error {
+	clk := clock.FromContext(ctx)
+	start := clk.Now()
+	err := c.handler(ctx, msgs)
+	if c.metrics != nil {
+		c.observe(msgs, clk.Since(start), err)
+	}
+	if err == nil {
+		return c.source.Ack(ctx, msgs)
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		c.logger.Error("batch handler failed", zap.String("consumer", c.name), zap.Int("messages", len(msgs)), zap.Error(err))
+		return c.source.Nack(ctx, msgs)
+	}
+
+	var acked, failed []Message
+	for i, m := range msgs {
+		if ferr, ok := batchErr.Errors[i]; ok {
+			c.logger.Error("batch message failed", zap.String("consumer", c.name), zap.String("id", m.ID), zap.Error(ferr))
+			failed = append(failed, m)
+			continue
+		}
+		acked = append(acked, m)
+	}
+	if len(acked) > 0 {
+		if err := c.source.Ack(ctx, acked); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return c.source.Nack(ctx, failed)
+	}
+	return nil
+}
+
+func (c *BatchConsumer) observe(msgs []Message, d time.Duration, err error) {
+	failed := 0
+	var batchErr *BatchError
+	switch {
+	case err == nil:
+	case errors.As(err, &batchErr):
+		for i := range msgs {
+			if _, ok := batchErr.Errors[i]; ok {
+				failed++
+			}
+		}
+	default:
+		failed = len(msgs)
+	}
+
+	c.metrics.Processed.WithLabelValues(c.name).Add(float64(len(msgs)))
+	c.metrics.Failed.WithLabelValues(c.name).Add(float64(failed))
+	c.metrics.Retries.WithLabelValues(c.name).Add(float64(failed))
+	c.metrics.Duration.WithLabelValues(c.name).Observe(d.Seconds())
+}
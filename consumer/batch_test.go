@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type chanSource struct {
+	msgs chan Message
+
+	mu     sync.Mutex
+	acked  []string
+	nacked []string
+}
+
+func (s *chanSource) Receive(ctx context.Context) (Message, error) {
+	select {
+	case m := <-s.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+func (s *chanSource) Ack(_ context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		s.acked = append(s.acked, m.ID)
+	}
+	return nil
+}
+
+func (s *chanSource) Nack(_ context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		s.nacked = append(s.nacked, m.ID)
+	}
+	return nil
+}
+
+func (s *chanSource) result() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.acked...), append([]string(nil), s.nacked...)
+}
+
+func TestBatchConsumer(t *testing.T) {
+	c := goxtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(clock.WithContext(context.Background(), c))
+	defer cancel()
+
+	reg := prometheus.NewRegistry()
+	source := &chanSource{msgs: make(chan Message)}
+	batches := make(chan []string)
+	consumer, err := NewBatchConsumer("indexer", source, func(ctx context.Context, msgs []Message) error {
+		var ids []string
+		var batchErr BatchError
+		for i, m := range msgs {
+			ids = append(ids, m.ID)
+			if strings.HasPrefix(m.ID, "bad") {
+				batchErr.Fail(i, errors.New("invalid document"))
+			}
+			if m.ID == "broken" {
+				return errors.New("index is down")
+			}
+		}
+		batches <- ids
+		return batchErr.Err()
+	}, WithMaxMessages(3), WithMaxBytes(10), WithMaxWait(time.Second), WithMetrics(reg))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- consumer.Run(ctx) }()
+
+	send := func(id, data string) { source.msgs <- Message{ID: id, Data: []byte(data)} }
+
+	{ // full batches by count
+		send("a", "1")
+		send("b", "1")
+		send("c", "1")
+		require.Equal(t, []string{"a", "b", "c"}, <-batches)
+	}
+
+	{ // by size, the message which does not fit starts the next batch
+		send("d", "123456")
+		send("e", "123456")
+		require.Equal(t, []string{"d"}, <-batches)
+		send("f", "1234")
+		require.Equal(t, []string{"e", "f"}, <-batches)
+	}
+
+	{ // by time
+		waiters := c.Waiters()
+		send("g", "1")
+		for c.Waiters() == waiters {
+			time.Sleep(time.Millisecond)
+		}
+		c.Advance(time.Second)
+		require.Equal(t, []string{"g"}, <-batches)
+	}
+
+	{ // failed messages are nacked, the others acked
+		send("h", "1")
+		send("bad-1", "1")
+		send("i", "1")
+		require.Equal(t, []string{"h", "bad-1", "i"}, <-batches)
+
+		waiters := c.Waiters()
+		send("broken", "1")
+		for c.Waiters() == waiters {
+			time.Sleep(time.Millisecond)
+		}
+		c.Advance(time.Second)
+		require.Eventually(t, func() bool {
+			_, nacked := source.result()
+			return len(nacked) == 2
+		}, time.Second, time.Millisecond)
+
+		acked, nacked := source.result()
+		require.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"}, acked)
+		require.Equal(t, []string{"bad-1", "broken"}, nacked)
+
+		require.Equal(t, float64(11), testutil.ToFloat64(consumer.metrics.Processed.WithLabelValues("indexer")))
+		require.Equal(t, float64(2), testutil.ToFloat64(consumer.metrics.Failed.WithLabelValues("indexer")))
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	{ // partial failures describe each message
+		var batchErr BatchError
+		require.NoError(t, batchErr.Err())
+		batchErr.Fail(2, errors.New("b"))
+		batchErr.Fail(0, errors.New("a"))
+		require.EqualError(t, batchErr.Err(), "2 messages of the batch failed: message 0: a; message 2: b")
+	}
+}
@@ -0,0 +1,76 @@
+// Package consumer feeds messages of a broker to handlers in batches, acknowledging them once handled.
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Message is a message received from a broker. Ack and Nack of the Source get it back, so Meta can
+// hold what they need, like the partition and offset of kafka or the delivery tag of amqp.
+type Message struct {
+	ID   string
+	Data []byte
+	Meta interface{}
+}
+
+// Source receives messages from a broker. it is implemented over the client of the broker, like kafka
+// committing the offset after the highest acknowledged message of each partition or amqp acking and
+// nacking the delivery tags.
+type Source interface {
+	// Receive blocks until a message is available or ctx is done
+	Receive(ctx context.Context) (Message, error)
+	// Ack acknowledges handled messages, they are not delivered again
+	Ack(ctx context.Context, msgs []Message) error
+	// Nack returns failed messages to the broker to be delivered again
+	Nack(ctx context.Context, msgs []Message) error
+}
+
+// BatchError reports which messages of a batch failed, by their index in the batch. the other messages
+// are acknowledged.
+// example:
+//
+//	func(ctx context.Context, msgs []consumer.Message) error {
+//		var batchErr consumer.BatchError
+//		for i, m := range msgs {
+//			if err := index(ctx, m); err != nil {
+//				batchErr.Fail(i, err)
+//			}
+//		}
+//		return batchErr.Err()
+//	}
+type BatchError struct {
+	Errors map[int]error
+}
+
+// Fail records err for the i-th message of the batch.
+func (e *BatchError) Fail(i int, err error) {
+	if e.Errors == nil {
+		e.Errors = map[int]error{}
+	}
+	e.Errors[i] = err
+}
+
+// Err returns e if a message failed and nil otherwise.
+func (e *BatchError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	parts := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		parts = append(parts, fmt.Sprintf("message %d: %v", i, e.Errors[i]))
+	}
+	return fmt.Sprintf("%d messages of the batch failed: %s", len(e.Errors), strings.Join(parts, "; "))
+}
@@ -0,0 +1,93 @@
+package ctxutil
+
+import (
+	"context"
+	"time"
+)
+
+type typeKey[T any] struct{}
+
+// Set returns a copy of ctx holding v, keyed by its type. use Key when more than one value of the same type is needed.
+func Set[T any](ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, typeKey[T]{}, v)
+}
+
+// Get returns the value of type T stored by Set.
+func Get[T any](ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(typeKey[T]{}).(T)
+	return v, ok
+}
+
+// Key is a typed context key.
+// example:
+//
+//	var tenantKey = ctxutil.NewKey[string]("tenant")
+//
+//	ctx = tenantKey.Set(ctx, "acme")
+//	tenant, ok := tenantKey.Get(ctx)
+type Key[T any] struct {
+	name string
+}
+
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return "ctxutil key " + k.name
+}
+
+// Set returns a copy of ctx holding v.
+func (k *Key[T]) Set(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k, v)
+}
+
+// Get returns the value stored under k.
+func (k *Key[T]) Get(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+// MustGet returns the value stored under k and panics if it is missing.
+func (k *Key[T]) MustGet(ctx context.Context) T {
+	v, ok := k.Get(ctx)
+	if !ok {
+		panic(k.String() + " is not set")
+	}
+	return v
+}
+
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// Detach returns a context holding the values of ctx, like request id and logger, which is never
+// canceled and has no deadline. it is meant for background work started by a request which must
+// not stop when the request ends.
+func Detach(ctx context.Context) context.Context {
+	return detached{parent: ctx}
+}
+
+// WithMinTimeout guarantees the returned context has at least d to run. it is detached from ctx, so
+// canceling ctx does not stop it, and times out at the deadline of ctx or after d, whichever is later.
+// it is useful for cleanups which must complete even when the caller is out of time.
+func WithMinTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > d {
+		return context.WithDeadline(Detach(ctx), deadline)
+	}
+	return context.WithTimeout(Detach(ctx), d)
+}
+
+// WithDeadlineCap limits ctx to at most max. unlike context.WithTimeout, no timer is started when
+// ctx already ends sooner.
+func WithDeadlineCap(ctx context.Context, max time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= max {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, max)
+}
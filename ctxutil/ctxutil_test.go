@@ -0,0 +1,87 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValues(t *testing.T) {
+	type user struct{ ID int }
+
+	ctx := Set(context.Background(), user{ID: 1})
+	u, ok := Get[user](ctx)
+	require.True(t, ok)
+	require.Equal(t, 1, u.ID)
+
+	_, ok = Get[string](ctx)
+	require.False(t, ok)
+
+	first, second := NewKey[string]("first"), NewKey[string]("second")
+	ctx = second.Set(first.Set(ctx, "foo"), "bar")
+	require.Equal(t, "foo", first.MustGet(ctx))
+	require.Equal(t, "bar", second.MustGet(ctx))
+	require.Panics(t, func() { NewKey[string]("missing").MustGet(ctx) })
+}
+
+func TestDetach(t *testing.T) {
+	key := NewKey[string]("id")
+	parent, cancel := context.WithTimeout(key.Set(context.Background(), "foo"), time.Millisecond)
+	cancel()
+
+	ctx := Detach(parent)
+	require.NoError(t, ctx.Err())
+	require.Equal(t, "foo", key.MustGet(ctx))
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+}
+
+func TestTimeouts(t *testing.T) {
+	{ // parent has enough time, keep its deadline but not its cancellation
+		parent, cancelParent := context.WithTimeout(context.Background(), time.Hour)
+		defer cancelParent()
+
+		ctx, cancel := WithMinTimeout(parent, time.Minute)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+		require.True(t, time.Until(deadline) > time.Minute)
+		cancelParent()
+		require.NoError(t, ctx.Err())
+	}
+
+	{ // parent without deadline gets the minimum
+		ctx, cancel := WithMinTimeout(context.Background(), time.Minute)
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		require.True(t, time.Until(deadline) <= time.Minute)
+	}
+
+	{ // parent is already canceled, get a fresh minimum
+		parent, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		ctx, cancel := WithMinTimeout(parent, time.Minute)
+		defer cancel()
+		require.NoError(t, ctx.Err())
+		deadline, _ := ctx.Deadline()
+		require.True(t, time.Until(deadline) <= time.Minute)
+	}
+
+	{ // cap only applies when it is sooner
+		parent, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		ctx, cancel := WithDeadlineCap(parent, time.Hour)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+		require.True(t, time.Until(deadline) <= time.Second)
+
+		ctx, cancel = WithDeadlineCap(context.Background(), time.Second)
+		defer cancel()
+		deadline, _ = ctx.Deadline()
+		require.True(t, time.Until(deadline) <= time.Second)
+	}
+}
@@ -0,0 +1,135 @@
+// Package dedup skips messages which were already handled, making handlers which are not idempotent
+// safe to use with brokers delivering at least once.
+package dedup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTTL is how long handled ids are kept, it must be longer than the broker redelivers messages
+	DefaultTTL = 24 * time.Hour
+	// DefaultLease is how long an id is held while its message is handled, a delivery of the same
+	// message after it is handled again as the first one is assumed to have crashed
+	DefaultLease = 5 * time.Minute
+)
+
+type Option func(*Deduper) error
+
+// WithTTL sets how long handled ids are kept, DefaultTTL by default.
+func WithTTL(ttl time.Duration) Option {
+	return func(d *Deduper) error {
+		if ttl <= 0 {
+			return errors.New("dedup: ttl must be positive")
+		}
+		d.ttl = ttl
+		return nil
+	}
+}
+
+// WithLease sets how long an id is held while its message is handled, DefaultLease by default.
+func WithLease(lease time.Duration) Option {
+	return func(d *Deduper) error {
+		if lease <= 0 {
+			return errors.New("dedup: lease must be positive")
+		}
+		d.lease = lease
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(d *Deduper) error {
+		d.logger = logger
+		return nil
+	}
+}
+
+// Deduper handles each message id of a consumer once within the ttl. the id is claimed before the
+// message is handled, so concurrent deliveries of it are skipped, and released when handling fails so
+// the broker can redeliver it.
+// example:
+//
+//	d, err := dedup.New(store, "billing")
+//	...
+//	handle := dedup.Wrap(d, func(m *nats.Msg) string { return m.Header.Get("Nats-Msg-Id") }, chargeCustomer)
+//	sub, err := js.Subscribe("orders.created", func(m *nats.Msg) {
+//		if err := handle(ctx, m); err != nil {
+//			m.Nak()
+//			return
+//		}
+//		m.Ack()
+//	})
+type Deduper struct {
+	store    Store
+	consumer string
+	ttl      time.Duration
+	lease    time.Duration
+	logger   *zap.Logger
+}
+
+// New returns a Deduper recording the ids handled by consumer in store, consumers sharing a store
+// must have different names.
+func New(store Store, consumer string, options ...Option) (*Deduper, error) {
+	if consumer == "" {
+		return nil, errors.New("dedup: consumer name must not be empty")
+	}
+	d := &Deduper{
+		store:    store,
+		consumer: consumer,
+		ttl:      DefaultTTL,
+		lease:    DefaultLease,
+		logger:   zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Do calls fn unless id was handled or is being handled, handled tells whether fn was called.
+// the error of fn is returned as is and the id is released so a redelivery calls fn again.
+func (d *Deduper) Do(ctx context.Context, id string, fn func(ctx context.Context) error) (handled bool, err error) {
+	if id == "" {
+		return false, errors.New("dedup: message id must not be empty")
+	}
+
+	now := clock.FromContext(ctx).Now()
+	claimed, err := d.store.Claim(ctx, d.consumer, id, now.Add(d.lease))
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		d.logger.Debug("skip duplicate message", zap.String("consumer", d.consumer), zap.String("id", id))
+		return false, nil
+	}
+
+	if err := fn(ctx); err != nil {
+		if rerr := d.store.Release(ctx, d.consumer, id); rerr != nil {
+			// the lease expires on its own
+			d.logger.Warn("release message id failed", zap.String("consumer", d.consumer), zap.String("id", id), zap.Error(rerr))
+		}
+		return true, err
+	}
+
+	if err := d.store.Complete(ctx, d.consumer, id, clock.FromContext(ctx).Now().Add(d.ttl)); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Wrap returns handler skipping the messages whose id was handled, duplicates return nil so they are
+// acknowledged to the broker.
+func Wrap[T any](d *Deduper, id func(msg T) string, handler func(ctx context.Context, msg T) error) func(ctx context.Context, msg T) error {
+	return func(ctx context.Context, msg T) error {
+		_, err := d.Do(ctx, id(msg), func(ctx context.Context) error { return handler(ctx, msg) })
+		return err
+	}
+}
@@ -0,0 +1,145 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduper(t *testing.T) {
+	testDeduper(t, NewMemoryStore())
+}
+
+func TestPgStore(t *testing.T) {
+	db := goxtest.NewTestDB(t)
+	s, err := NewPgStore(context.Background(), db)
+	require.NoError(t, err)
+	testDeduper(t, s)
+
+	// the deduper test runs in 2024, all its ids are expired now
+	var count int64
+	require.NoError(t, db.QueryRow(context.Background(), "SELECT count(*) FROM "+table).Scan(&count))
+	deleted, err := s.DeleteExpired(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, count, deleted)
+	require.Positive(t, deleted)
+}
+
+func TestRedisStore(t *testing.T) {
+	do, prefix := goxtest.NewTestRedis(t)
+	s := NewRedisStore(RedisDo(do), WithRedisPrefix(prefix))
+	ctx := context.Background()
+
+	claimed, err := s.Claim(ctx, "billing", "order-1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, claimed)
+	claimed, err = s.Claim(ctx, "billing", "order-1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	require.NoError(t, s.Complete(ctx, "billing", "order-1", time.Now().Add(time.Hour)))
+	ttl, err := do(ctx, "PTTL", s.key("billing", "order-1"))
+	require.NoError(t, err)
+	require.Greater(t, ttl, int64(time.Minute/time.Millisecond))
+
+	require.NoError(t, s.Release(ctx, "billing", "order-1"))
+	claimed, err = s.Claim(ctx, "billing", "order-1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	claimed, err = s.Claim(ctx, "billing", "order-2", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.True(t, claimed)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	c := goxtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), c)
+	s := NewMemoryStore()
+
+	for _, id := range []string{"a", "b", "c"} {
+		claimed, err := s.Claim(ctx, "billing", id, c.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.True(t, claimed)
+	}
+
+	// expired ids can be claimed again before they are swept
+	c.Advance(2 * time.Second)
+	claimed, err := s.Claim(ctx, "billing", "a", c.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Len(t, s.ids, 3)
+
+	c.Advance(memorySweepInterval)
+	_, err = s.Claim(ctx, "billing", "d", c.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, s.ids, 2)
+}
+
+func testDeduper(t *testing.T, s Store) {
+	c := goxtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), c)
+
+	d, err := New(s, "billing", WithTTL(time.Hour), WithLease(time.Minute))
+	require.NoError(t, err)
+
+	var charged []string
+	handle := Wrap(d, func(msg string) string { return msg }, func(ctx context.Context, msg string) error {
+		if msg == "bad" {
+			return errors.New("charge failed")
+		}
+		charged = append(charged, msg)
+		return nil
+	})
+
+	{ // duplicates are skipped
+		require.NoError(t, handle(ctx, "order-1"))
+		require.NoError(t, handle(ctx, "order-1"))
+		require.NoError(t, handle(ctx, "order-2"))
+		require.Equal(t, []string{"order-1", "order-2"}, charged)
+	}
+
+	{ // failed messages are handled again on redelivery
+		require.Error(t, handle(ctx, "bad"))
+		handled, err := d.Do(ctx, "bad", func(ctx context.Context) error { return nil })
+		require.NoError(t, err)
+		require.True(t, handled)
+	}
+
+	{ // a message being handled is skipped by concurrent deliveries until its lease expires
+		_, err := d.Do(ctx, "order-3", func(ctx context.Context) error {
+			handled, err := d.Do(ctx, "order-3", func(ctx context.Context) error { return nil })
+			require.NoError(t, err)
+			require.False(t, handled)
+
+			c.Advance(2 * time.Minute)
+			handled, err = d.Do(ctx, "order-3", func(ctx context.Context) error { return nil })
+			require.NoError(t, err)
+			require.True(t, handled)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	{ // ids expire after the ttl
+		c.Advance(2 * time.Hour)
+		require.NoError(t, handle(ctx, "order-1"))
+		require.Equal(t, []string{"order-1", "order-2", "order-1"}, charged)
+	}
+
+	{ // consumers are independent
+		other, err := New(d.store, "shipping")
+		require.NoError(t, err)
+		handled, err := other.Do(ctx, "order-2", func(ctx context.Context) error { return nil })
+		require.NoError(t, err)
+		require.True(t, handled)
+
+		_, err = New(d.store, "")
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+)
+
+// DefaultRedisPrefix is the prefix of the keys of RedisStore.
+const DefaultRedisPrefix = "gox:dedup:"
+
+// redisClaim sets the key for ARGV[1] milliseconds unless it exists, SET NX replies nil otherwise
+const redisClaim = `if redis.call('SET', KEYS[1], '1', 'NX', 'PX', ARGV[1]) then return 1 end
+return 0`
+
+// RedisDo sends a command to redis and returns its reply, see NewRedisStore.
+type RedisDo func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+type RedisOption func(*RedisStore)
+
+// WithRedisPrefix sets the prefix of keys, DefaultRedisPrefix by default.
+func WithRedisPrefix(prefix string) RedisOption {
+	return func(s *RedisStore) {
+		s.prefix = prefix
+	}
+}
+
+// RedisStore records ids in redis as keys expiring with them, so it needs no cleanup.
+type RedisStore struct {
+	do     RedisDo
+	prefix string
+}
+
+// NewRedisStore returns a store sending its commands with do, which adapts any redis client. replies
+// are expected as returned by go-redis, the commands used never reply nil.
+// example:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	s := dedup.NewRedisStore(func(ctx context.Context, args ...interface{}) (interface{}, error) {
+//		return rdb.Do(ctx, args...).Result()
+//	})
+func NewRedisStore(do RedisDo, options ...RedisOption) *RedisStore {
+	s := &RedisStore{do: do, prefix: DefaultRedisPrefix}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+func (s *RedisStore) key(consumer, id string) string {
+	return s.prefix + consumer + ":" + id
+}
+
+// ttl returns the milliseconds until expiresAt, redis expires keys by its own clock.
+func ttl(ctx context.Context, expiresAt time.Time) string {
+	ms := expiresAt.Sub(clock.FromContext(ctx).Now()).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+func (s *RedisStore) Claim(ctx context.Context, consumer, id string, expiresAt time.Time) (bool, error) {
+	reply, err := s.do(ctx, "EVAL", redisClaim, 1, s.key(consumer, id), ttl(ctx, expiresAt))
+	if err != nil {
+		return false, err
+	}
+	claimed, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("dedup: unexpected redis reply %T", reply)
+	}
+	return claimed == 1, nil
+}
+
+func (s *RedisStore) Complete(ctx context.Context, consumer, id string, expiresAt time.Time) error {
+	_, err := s.do(ctx, "SET", s.key(consumer, id), "1", "PX", ttl(ctx, expiresAt))
+	return err
+}
+
+func (s *RedisStore) Release(ctx context.Context, consumer, id string) error {
+	_, err := s.do(ctx, "DEL", s.key(consumer, id))
+	return err
+}
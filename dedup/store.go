@@ -0,0 +1,126 @@
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/store"
+)
+
+const table = "gox_dedup"
+
+// memorySweepInterval is how often MemoryStore removes expired ids.
+const memorySweepInterval = time.Minute
+
+// Store records the ids of messages consumers handled, until they expire. MemoryStore keeps them in
+// memory, PgStore in postgres and RedisStore in redis.
+type Store interface {
+	// Claim records id for consumer until expiresAt unless it is already recorded and not expired,
+	// it returns whether id was recorded
+	Claim(ctx context.Context, consumer, id string, expiresAt time.Time) (bool, error)
+	// Complete marks id handled, keeping it until expiresAt
+	Complete(ctx context.Context, consumer, id string, expiresAt time.Time) error
+	// Release forgets id, so the next delivery of the message is handled again
+	Release(ctx context.Context, consumer, id string) error
+}
+
+type memoryKey struct {
+	consumer, id string
+}
+
+// MemoryStore is a Store for a single instance and tests.
+type MemoryStore struct {
+	mu        sync.Mutex
+	ids       map[memoryKey]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ids: map[memoryKey]time.Time{}}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, consumer, id string, expiresAt time.Time) (bool, error) {
+	now := clock.FromContext(ctx).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !now.Before(s.nextSweep) {
+		for k, exp := range s.ids {
+			if !exp.After(now) {
+				delete(s.ids, k)
+			}
+		}
+		s.nextSweep = now.Add(memorySweepInterval)
+	}
+	k := memoryKey{consumer, id}
+	if exp, ok := s.ids[k]; ok && exp.After(now) {
+		return false, nil
+	}
+	s.ids[k] = expiresAt
+	return true, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, consumer, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[memoryKey{consumer, id}] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, consumer, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, memoryKey{consumer, id})
+	return nil
+}
+
+// PgStore records ids in postgres. when a handler writes to the same database, passing the transaction
+// it uses to a PgStore records the id together with its writes, which makes handling exactly once.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the store of db, creating its table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		consumer text NOT NULL,
+		id text NOT NULL,
+		expires_at timestamptz NOT NULL,
+		PRIMARY KEY (consumer, id)
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+func (s *PgStore) Claim(ctx context.Context, consumer, id string, expiresAt time.Time) (bool, error) {
+	tag, err := s.db.Exec(ctx, "INSERT INTO "+table+" (consumer, id, expires_at) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (consumer, id) DO UPDATE SET expires_at = excluded.expires_at WHERE "+table+".expires_at <= $4",
+		consumer, id, expiresAt, clock.FromContext(ctx).Now())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *PgStore) Complete(ctx context.Context, consumer, id string, expiresAt time.Time) error {
+	_, err := s.db.Exec(ctx, "UPDATE "+table+" SET expires_at = $3 WHERE consumer = $1 AND id = $2", consumer, id, expiresAt)
+	return err
+}
+
+func (s *PgStore) Release(ctx context.Context, consumer, id string) error {
+	_, err := s.db.Exec(ctx, "DELETE FROM "+table+" WHERE consumer = $1 AND id = $2", consumer, id)
+	return err
+}
+
+// DeleteExpired removes the expired ids and returns how many were removed, run it periodically
+// like with a retention policy.
+func (s *PgStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM "+table+" WHERE expires_at <= $1", clock.FromContext(ctx).Now())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
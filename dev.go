@@ -0,0 +1,91 @@
+package gox
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/mirzakhany/gox/httpcache"
+	goxlog "github.com/mirzakhany/gox/log"
+	"github.com/mirzakhany/gox/notify"
+	"github.com/mirzakhany/gox/os"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/mirzakhany/gox/taskq"
+	"go.uber.org/zap"
+)
+
+type devConfig struct {
+	dotEnv   string
+	logLevel string
+}
+
+type DevOption func(*devConfig) error
+
+// WithDotEnv sets the env file DevMode loads, ".env" by default. a missing file is not an error.
+func WithDotEnv(path string) DevOption {
+	return func(c *devConfig) error {
+		c.dotEnv = path
+		return nil
+	}
+}
+
+// WithDevLogLevel sets the level of the console logger, "debug" by default.
+func WithDevLogLevel(level string) DevOption {
+	return func(c *devConfig) error {
+		c.logLevel = level
+		return nil
+	}
+}
+
+// Dev holds the defaults of local development: a console logger, an outbox keeping notifications and
+// emails instead of sending them, an in-memory response cache and an in-memory task queue store.
+type Dev struct {
+	Logger *zap.Logger
+	Mail   *notify.Outbox
+	Cache  *httpcache.Cache
+	Tasks  *taskq.MemoryStore
+}
+
+// DevMode loads the .env file into the environment, without overriding variables which are set, and
+// returns the development defaults.
+// example:
+//
+//	if os.Getenv("ENV") == "local" {
+//		dev, err := gox.DevMode()
+//		...
+//		logger, mailer, tasks = dev.Logger, dev.Mail, dev.Tasks
+//		httpOptions = append(httpOptions, dev.HTTPOptions()...)
+//	}
+func DevMode(options ...DevOption) (*Dev, error) {
+	c := &devConfig{dotEnv: ".env", logLevel: "debug"}
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.LoadDotEnv(c.dotEnv); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	logger := goxlog.NewConsoleLogger(c.logLevel)
+	cache, err := httpcache.New(httpcache.WithZapLogger(logger))
+	if err != nil {
+		return nil, err
+	}
+	return &Dev{Logger: logger, Mail: notify.NewOutbox(logger.Named("mail")), Cache: cache, Tasks: taskq.NewMemoryStore()}, nil
+}
+
+// HTTPOptions returns the options of RunHttpServer for development: the console logger, cors allowing
+// localhost origins and logging the routes at startup.
+func (d *Dev) HTTPOptions() []rest.Option {
+	return []rest.Option{
+		rest.WithZapLogger(d.Logger),
+		rest.WithCoreOptions(rest.DevCorsOption()),
+		rest.WithRouteLogging(),
+	}
+}
+
+// RunnerOptions returns the options of NewRunner for development.
+func (d *Dev) RunnerOptions() []RunnerOption {
+	return []RunnerOption{WithZapLogger(d.Logger)}
+}
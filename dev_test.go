@@ -0,0 +1,66 @@
+package gox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	stdos "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/cors"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/mirzakhany/gox/taskq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, stdos.WriteFile(path, []byte("# local\nGOX_DEV_A=from-file\nexport GOX_DEV_B=\"quoted value\"\nGOX_DEV_C='single'\n"), 0o600))
+	t.Setenv("GOX_DEV_A", "from-env")
+	t.Cleanup(func() {
+		stdos.Unsetenv("GOX_DEV_B")
+		stdos.Unsetenv("GOX_DEV_C")
+	})
+
+	dev, err := DevMode(WithDotEnv(path), WithDevLogLevel("info"))
+	require.NoError(t, err)
+	require.NotNil(t, dev.Logger)
+	require.Len(t, dev.HTTPOptions(), 3)
+
+	{ // set variables are not overridden
+		require.Equal(t, "from-env", stdos.Getenv("GOX_DEV_A"))
+		require.Equal(t, "quoted value", stdos.Getenv("GOX_DEV_B"))
+		require.Equal(t, "single", stdos.Getenv("GOX_DEV_C"))
+	}
+
+	{ // tasks are queued in memory
+		_, err := taskq.NewQueue(dev.Tasks, "emails").Enqueue(context.Background(), "welcome", nil)
+		require.NoError(t, err)
+		require.Len(t, dev.Tasks.Tasks("emails"), 1)
+	}
+
+	{ // a missing env file is fine, an invalid one is not
+		_, err := DevMode(WithDotEnv(filepath.Join(t.TempDir(), ".env")))
+		require.NoError(t, err)
+
+		require.NoError(t, stdos.WriteFile(path, []byte("not a variable\n"), 0o600))
+		_, err = DevMode(WithDotEnv(path))
+		require.Error(t, err)
+	}
+}
+
+func TestDevCors(t *testing.T) {
+	h := cors.New(rest.DevCorsOption()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for origin, allowed := range map[string]bool{
+		"http://localhost:3000": true,
+		"http://127.0.0.1:5173": true,
+		"https://example.com":   false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, allowed, rec.Header().Get("Access-Control-Allow-Origin") == origin, origin)
+	}
+}
@@ -0,0 +1,59 @@
+package diag
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	type db struct {
+		Host     string
+		Password string
+		Replicas []string
+		Extra    map[string]string
+		Cert     string `diag:"redact"`
+	}
+
+	out := Redact(&db{
+		Host:     "localhost",
+		Password: "s3cr3t",
+		Replicas: []string{"r1", "postgres://app:s3cr3t@r2:5432/users?sslmode=disable", "mailto:ops@example.com"},
+		Extra:    map[string]string{"api_token": "t", "region": "eu", "upstream": "https://deploy@git.example.com/repo"},
+		Cert:     "pem",
+	})
+	require.Equal(t, map[string]interface{}{
+		"Host":     "localhost",
+		"Password": Redacted,
+		"Replicas": []interface{}{"r1", "postgres://[redacted]@r2:5432/users?sslmode=disable", "mailto:ops@example.com"},
+		"Extra":    map[string]interface{}{"api_token": Redacted, "region": "eu", "upstream": "https://[redacted]@git.example.com/repo"},
+		"Cert":     Redacted,
+	}, out)
+}
+
+func TestHandler(t *testing.T) {
+	RecordPanic("GET /boom", "boom", []byte("stack"))
+
+	handler, err := Handler(
+		WithConfig("app", struct{ Name, SecretKey string }{"orders", "k"}),
+		WithProbe("db", func() error { return errors.New("connection refused") }),
+		WithPool("db", func() PoolStats { return PoolStats{TotalConns: 4, MaxConns: 10} }),
+	)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/diagnostics", nil))
+
+	var doc Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	require.NotEmpty(t, doc.Build.GoVersion)
+	require.Positive(t, doc.Goroutines)
+	require.Equal(t, map[string]interface{}{"Name": "orders", "SecretKey": Redacted}, doc.Config["app"])
+	require.Equal(t, "connection refused", doc.Probes["db"])
+	require.Equal(t, PoolStats{TotalConns: 4, MaxConns: 10}, doc.Pools["db"])
+	require.Equal(t, "boom", doc.Panics[len(doc.Panics)-1].Value)
+}
@@ -0,0 +1,42 @@
+package diag
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxPanics is the number of recent panics kept by RecordPanic.
+const MaxPanics = 20
+
+// Panic is a recovered panic.
+type Panic struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Value  string    `json:"value"`
+	Stack  string    `json:"stack"`
+}
+
+var (
+	panicsMu sync.Mutex
+	panics   []Panic
+)
+
+// RecordPanic keeps a recovered panic for the diagnostics document, source tells where it was
+// recovered, like the request or task. the oldest panics are dropped after MaxPanics.
+func RecordPanic(source string, value interface{}, stack []byte) {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+
+	panics = append(panics, Panic{Time: time.Now(), Source: source, Value: fmt.Sprint(value), Stack: string(stack)})
+	if len(panics) > MaxPanics {
+		panics = panics[len(panics)-MaxPanics:]
+	}
+}
+
+// RecentPanics returns the recorded panics, the newest last.
+func RecentPanics() []Panic {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	return append([]Panic{}, panics...)
+}
@@ -0,0 +1,66 @@
+// Package doctor inspects the environment of a service and reports actionable findings, like missing
+// env variables, an unreachable database or a skewed clock.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity of a finding.
+type Severity int
+
+const (
+	OK Severity = iota
+	Warn
+	Fail
+)
+
+func (s Severity) String() string {
+	switch s {
+	case OK:
+		return "ok"
+	case Warn:
+		return "warn"
+	default:
+		return "fail"
+	}
+}
+
+// Finding is the result of a check, Hint tells how to fix it.
+type Finding struct {
+	Check    string
+	Severity Severity
+	Message  string
+	Hint     string
+}
+
+// Check inspects one part of the environment.
+type Check func(ctx context.Context) []Finding
+
+// Run runs checks in order, prints their findings to w and returns false if any failed.
+// example:
+//
+//	func main() {
+//		if len(os.Args) > 1 && os.Args[1] == "doctor" {
+//			ok := doctor.Run(ctx, os.Stdout, doctor.Env(&Config{}), doctor.Port("8080"), doctor.Database(dsn))
+//			...
+//		}
+//	}
+func Run(ctx context.Context, w io.Writer, checks ...Check) bool {
+	ok := true
+	for _, check := range checks {
+		for _, f := range check(ctx) {
+			if f.Severity == Fail {
+				ok = false
+			}
+			fmt.Fprintf(w, "[%s] %s: %s\n", f.Severity, f.Check, f.Message)
+			if f.Hint != "" && f.Severity != OK {
+				fmt.Fprintf(w, "       %s\n", strings.ReplaceAll(f.Hint, "\n", "\n       "))
+			}
+		}
+	}
+	return ok
+}
@@ -0,0 +1,231 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys() map[uint32][]byte {
+	return map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32), 2: bytes.Repeat([]byte{2}, 32)}
+}
+
+func TestKeyring(t *testing.T) {
+	old, err := NewKeyring(1, map[uint32][]byte{1: testKeys()[1]})
+	require.NoError(t, err)
+	keyring, err := NewKeyring(2, testKeys())
+	require.NoError(t, err)
+
+	sealed, err := old.Encrypt([]byte("DE123456789"))
+	require.NoError(t, err)
+	version, err := KeyVersion(sealed)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), version)
+
+	{ // values sealed with older keys are readable
+		plain, err := keyring.Decrypt(sealed)
+		require.NoError(t, err)
+		require.Equal(t, "DE123456789", string(plain))
+	}
+
+	{ // re-encryption seals with the primary key
+		rotated, changed, err := keyring.Reencrypt(sealed)
+		require.NoError(t, err)
+		require.True(t, changed)
+		version, _ := KeyVersion(rotated)
+		require.Equal(t, uint32(2), version)
+
+		again, changed, err := keyring.Reencrypt(rotated)
+		require.NoError(t, err)
+		require.False(t, changed)
+		require.Equal(t, rotated, again)
+
+		_, err = old.Decrypt(rotated)
+		require.ErrorIs(t, err, ErrUnknownKey)
+	}
+
+	{ // tampered payloads and headers are rejected
+		tampered := append([]byte(nil), sealed...)
+		tampered[len(tampered)-1] ^= 1
+		_, err := keyring.Decrypt(tampered)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+
+		relabeled, _ := keyring.Encrypt([]byte("x"))
+		copy(relabeled, header(1))
+		_, err = keyring.Decrypt(relabeled)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+
+		_, err = keyring.Decrypt([]byte("plain"))
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	}
+
+	{ // invalid keyrings
+		_, err := NewKeyring(3, testKeys())
+		require.Error(t, err)
+		_, err = NewKeyring(1, map[uint32][]byte{1: []byte("short")})
+		require.Error(t, err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	k := base64.StdEncoding.EncodeToString(testKeys()[1])
+	keys, err := ParseKeys("1:" + k + ", 7:" + k)
+	require.NoError(t, err)
+	require.Equal(t, map[uint32][]byte{1: testKeys()[1], 7: testKeys()[1]}, keys)
+
+	_, err = ParseKeys("1" + k)
+	require.Error(t, err)
+	_, err = ParseKeys("x:" + k)
+	require.Error(t, err)
+	_, err = ParseKeys("1:not base64")
+	require.Error(t, err)
+}
+
+// fakeDB is a table of sealed values by key with the checkpoint of one rotation.
+type fakeDB struct {
+	values     map[string][]byte
+	checkpoint []interface{}
+	queries    int
+	failAfter  int
+}
+
+type fakeRows struct {
+	pgx.Rows
+	rows [][2]interface{}
+	i    int
+}
+
+func (r *fakeRows) Next() bool {
+	r.i++
+	return r.i <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	*dest[0].(*string) = r.rows[r.i-1][0].(string)
+	*dest[1].(*[]byte) = r.rows[r.i-1][1].([]byte)
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+func (r *fakeRows) Close()     {}
+
+type fakeRow struct{ values []interface{} }
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.values == nil {
+		return pgx.ErrNoRows
+	}
+	last := r.values[3].(*string)
+	*dest[0].(**string) = last
+	*dest[1].(*int64) = r.values[4].(int64)
+	*dest[2].(*bool) = r.values[5].(bool)
+	return nil
+}
+
+func (db *fakeDB) Query(_ context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	db.queries++
+	if db.failAfter > 0 && db.queries > db.failAfter {
+		return nil, fmt.Errorf("connection lost")
+	}
+	limit, _ := strconv.Atoi(sql[strings.LastIndex(sql, "LIMIT ")+6:])
+	keys := make([]string, 0, len(db.values))
+	for k := range db.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rows := &fakeRows{}
+	for _, k := range keys {
+		v := db.values[k]
+		if bytes.HasPrefix(v, args[0].([]byte)) || (len(args) > 1 && k <= args[1].(string)) {
+			continue
+		}
+		if len(rows.rows) < limit {
+			rows.rows = append(rows.rows, [2]interface{}{k, v})
+		}
+	}
+	return rows, nil
+}
+
+func (db *fakeDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return fakeRow{db.checkpoint}
+}
+
+func (db *fakeDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	switch {
+	case strings.HasPrefix(sql, "UPDATE"):
+		key := args[1].(string)
+		if !bytes.Equal(db.values[key], args[2].([]byte)) {
+			return pgconn.CommandTag("UPDATE 0"), nil
+		}
+		db.values[key] = args[0].([]byte)
+		return pgconn.CommandTag("UPDATE 1"), nil
+	case strings.HasPrefix(sql, "INSERT"):
+		db.checkpoint = args
+	}
+	return pgconn.CommandTag(""), nil
+}
+
+func TestRotator(t *testing.T) {
+	ctx := context.Background()
+	old, _ := NewKeyring(1, testKeys())
+	keyring, _ := NewKeyring(2, testKeys())
+
+	db := &fakeDB{values: map[string][]byte{}}
+	for i := 0; i < 7; i++ {
+		db.values[fmt.Sprintf("user-%d", i)], _ = old.Encrypt([]byte(strconv.Itoa(i)))
+	}
+	db.values["user-5"], _ = keyring.Encrypt([]byte("5"))
+	users := WithColumns(Column{Table: "users", Key: "id", Column: "tax_id"})
+
+	{ // failed rotations resume from the checkpoint
+		db.failAfter = 1
+		r, err := NewRotator(ctx, db, keyring, users, WithBatchSize(2), WithBatchPause(0))
+		require.NoError(t, err)
+		progress, err := r.Rotate(ctx)
+		require.ErrorContains(t, err, "connection lost")
+		require.Equal(t, []Progress{{Table: "users", Column: "tax_id", KeyVersion: 2, Rotated: 2}}, progress)
+		require.Equal(t, "user-1", *db.checkpoint[3].(*string))
+	}
+
+	db.failAfter = 0
+	reg := prometheus.NewRegistry()
+	r, err := NewRotator(ctx, db, keyring, users, WithBatchSize(2), WithBatchPause(0), WithMetrics(reg))
+	require.NoError(t, err)
+	progress, err := r.Rotate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Progress{{Table: "users", Column: "tax_id", KeyVersion: 2, Rotated: 6, Done: true}}, progress)
+	require.Equal(t, 4.0, testutil.ToFloat64(r.rotated.WithLabelValues("users", "tax_id")))
+	require.Equal(t, 1.0, testutil.ToFloat64(r.done.WithLabelValues("users", "tax_id")))
+
+	for k, v := range db.values {
+		version, err := KeyVersion(v)
+		require.NoError(t, err)
+		require.Equal(t, uint32(2), version, k)
+		plain, err := keyring.Decrypt(v)
+		require.NoError(t, err)
+		require.Equal(t, strings.TrimPrefix(k, "user-"), string(plain))
+	}
+
+	{ // done rotations are not walked again
+		queries := db.queries
+		progress, err := r.Rotate(ctx)
+		require.NoError(t, err)
+		require.True(t, progress[0].Done)
+		require.Equal(t, queries, db.queries)
+	}
+
+	_, err = NewRotator(ctx, db, keyring)
+	require.Error(t, err)
+}
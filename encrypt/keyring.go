@@ -0,0 +1,152 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// formatV1 is the first byte of payloads, followed by the key version as a big endian uint32, the
+// nonce and the AES-GCM sealed data.
+const formatV1 byte = 1
+
+const headerSize = 1 + 4
+
+var (
+	ErrUnknownKey     = errors.New("encrypt: payload is sealed with an unknown key version")
+	ErrInvalidPayload = errors.New("encrypt: invalid payload")
+)
+
+// Keyring seals column values with its primary data key and opens values sealed with any of its keys,
+// so data keys can be rotated while old values are still readable.
+type Keyring struct {
+	primary uint32
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewKeyring returns a keyring of 32 byte AES-256 keys by version, values are sealed with primary.
+// example:
+//
+//	keys, err := encrypt.ParseKeys(os.Getenv("DATA_KEYS")) // "1:base64key,2:base64key"
+//	keyring, err := encrypt.NewKeyring(2, keys)
+//	sealed, err := keyring.Encrypt([]byte(user.TaxID))
+func NewKeyring(primary uint32, keys map[uint32][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("encrypt: primary key version %d is missing", primary)
+	}
+	k := &Keyring{primary: primary, aeads: make(map[uint32]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encrypt: key version %d must have 32 bytes", version)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[version] = aead
+	}
+	return k, nil
+}
+
+// ParseKeys parses comma separated version:key pairs with base64 encoded keys.
+func ParseKeys(s string) (map[uint32][]byte, error) {
+	keys := map[uint32][]byte{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		v, k, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, errors.New("encrypt: keys must be given as version:key")
+		}
+		version, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt: invalid key version %q", v)
+		}
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt: key version %d is not base64: %w", version, err)
+		}
+		keys[uint32(version)] = key
+	}
+	return keys, nil
+}
+
+// Primary returns the version of the key new values are sealed with.
+func (k *Keyring) Primary() uint32 {
+	return k.primary
+}
+
+// Encrypt seals plaintext with the primary key, the payload records the key version.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	aead := k.aeads[k.primary]
+	out := make([]byte, headerSize+aead.NonceSize(), headerSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = formatV1
+	binary.BigEndian.PutUint32(out[1:headerSize], k.primary)
+	nonce := out[headerSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, out[:headerSize]), nil
+}
+
+// Decrypt opens a payload of Encrypt with the key it was sealed with.
+func (k *Keyring) Decrypt(payload []byte) ([]byte, error) {
+	version, err := KeyVersion(payload)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := k.aeads[version]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if len(payload) < headerSize+aead.NonceSize() {
+		return nil, ErrInvalidPayload
+	}
+	nonce := payload[headerSize : headerSize+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, payload[headerSize+aead.NonceSize():], payload[:headerSize])
+	if err != nil {
+		return nil, ErrInvalidPayload
+	}
+	return plaintext, nil
+}
+
+// Reencrypt seals payload with the primary key, payloads already sealed with it are returned as is.
+func (k *Keyring) Reencrypt(payload []byte) ([]byte, bool, error) {
+	if version, err := KeyVersion(payload); err == nil && version == k.primary {
+		return payload, false, nil
+	}
+	plaintext, err := k.Decrypt(payload)
+	if err != nil {
+		return nil, false, err
+	}
+	sealed, err := k.Encrypt(plaintext)
+	return sealed, err == nil, err
+}
+
+// KeyVersion returns the version of the key payload was sealed with.
+func KeyVersion(payload []byte) (uint32, error) {
+	if len(payload) < headerSize || payload[0] != formatV1 {
+		return 0, ErrInvalidPayload
+	}
+	return binary.BigEndian.Uint32(payload[1:headerSize]), nil
+}
+
+// header returns the first bytes of payloads sealed with version.
+func header(version uint32) []byte {
+	h := make([]byte, headerSize)
+	h[0] = formatV1
+	binary.BigEndian.PutUint32(h[1:], version)
+	return h
+}
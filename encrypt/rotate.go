@@ -0,0 +1,337 @@
+package encrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/mirzakhany/gox/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultBatchSize  = 500
+	DefaultBatchPause = 100 * time.Millisecond
+	DefaultRetryDelay = time.Minute
+)
+
+const rotationsTable = "gox_encrypt_rotations"
+
+// Column is a bytea column holding payloads of Encrypt, rows are walked in the order of Key, which
+// must be unique like the primary key.
+type Column struct {
+	Table  string
+	Key    string
+	Column string
+}
+
+func (c Column) String() string {
+	return c.Table + "." + c.Column
+}
+
+// Progress is the state of the rotation of a column to a key version.
+type Progress struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	KeyVersion uint32 `json:"key_version"`
+	Rotated    int64  `json:"rotated"`
+	Done       bool   `json:"done"`
+}
+
+type RotatorOption func(*Rotator) error
+
+// WithColumns sets the columns to rotate.
+func WithColumns(columns ...Column) RotatorOption {
+	return func(r *Rotator) error {
+		for _, c := range columns {
+			if c.Table == "" || c.Key == "" || c.Column == "" {
+				return errors.New("encrypt: columns need a table, a key and a column")
+			}
+		}
+		r.columns = columns
+		return nil
+	}
+}
+
+// WithBatchSize sets how many rows are re-encrypted per batch, DefaultBatchSize by default.
+func WithBatchSize(n int) RotatorOption {
+	return func(r *Rotator) error {
+		if n <= 0 {
+			return errors.New("encrypt: batch size must be positive")
+		}
+		r.batchSize = n
+		return nil
+	}
+}
+
+// WithBatchPause sets the pause between batches, which leaves the database room for other queries.
+func WithBatchPause(d time.Duration) RotatorOption {
+	return func(r *Rotator) error {
+		r.batchPause = d
+		return nil
+	}
+}
+
+// WithRetryDelay sets how long Run waits before resuming a failed rotation, DefaultRetryDelay by default.
+func WithRetryDelay(d time.Duration) RotatorOption {
+	return func(r *Rotator) error {
+		r.retryDelay = d
+		return nil
+	}
+}
+
+// WithMetrics registers the gox_encrypt_rotated_rows_total counter and the gox_encrypt_rotation_done
+// gauge, labeled by table and column, with reg.
+func WithMetrics(reg prometheus.Registerer) RotatorOption {
+	return func(r *Rotator) error {
+		rotated, err := metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "encrypt", Name: "rotated_rows_total",
+			Help: "Number of values re-encrypted with the primary data key.",
+		}, []string{"table", "column"}))
+		if err != nil {
+			return err
+		}
+		done, err := metrics.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "encrypt", Name: "rotation_done",
+			Help: "1 once no value of the column is sealed with an older data key.",
+		}, []string{"table", "column"}))
+		if err != nil {
+			return err
+		}
+		r.rotated, r.done = rotated, done
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) RotatorOption {
+	return func(r *Rotator) error {
+		r.logger = logger
+		return nil
+	}
+}
+
+// Rotator re-encrypts columns with the primary key of a keyring in batches. progress is checkpointed
+// in the gox_encrypt_rotations table after each batch, so rotations resume where they stopped.
+type Rotator struct {
+	db         store.Querier
+	keyring    *Keyring
+	columns    []Column
+	batchSize  int
+	batchPause time.Duration
+	retryDelay time.Duration
+	logger     *zap.Logger
+
+	rotated *prometheus.CounterVec
+	done    *prometheus.GaugeVec
+}
+
+// NewRotator returns a rotator of columns sealed by keyring, creating its checkpoint table if needed.
+// it is a gox.Component rotating once the service starts, run it after the primary key of all
+// instances was changed, since values written with an older key are not rotated again.
+// example:
+//
+//	rotator, err := encrypt.NewRotator(ctx, pool, keyring,
+//		encrypt.WithColumns(encrypt.Column{Table: "users", Key: "id", Column: "tax_id"}),
+//		encrypt.WithMetrics(prometheus.DefaultRegisterer))
+//	runner, err := gox.NewRunner(gox.WithComponents(rotator, ...))
+func NewRotator(ctx context.Context, db store.Querier, keyring *Keyring, options ...RotatorOption) (*Rotator, error) {
+	r := &Rotator{
+		db:         db,
+		keyring:    keyring,
+		batchSize:  DefaultBatchSize,
+		batchPause: DefaultBatchPause,
+		retryDelay: DefaultRetryDelay,
+		logger:     zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(r); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.columns) == 0 {
+		return nil, errors.New("encrypt: no columns to rotate")
+	}
+
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+rotationsTable+` (
+		table_name text NOT NULL,
+		column_name text NOT NULL,
+		key_version bigint NOT NULL,
+		last_key text,
+		rotated bigint NOT NULL DEFAULT 0,
+		done boolean NOT NULL DEFAULT false,
+		updated_at timestamptz NOT NULL,
+		PRIMARY KEY (table_name, column_name, key_version)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: create rotations table: %w", err)
+	}
+	return r, nil
+}
+
+func (r *Rotator) Name() string {
+	return "encrypt-rotator"
+}
+
+func (r *Rotator) Describe() map[string]interface{} {
+	columns := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		columns[i] = c.String()
+	}
+	return map[string]interface{}{"columns": columns, "key_version": r.keyring.Primary()}
+}
+
+// Run rotates the columns, retrying failures after the retry delay, then waits for ctx to be done.
+func (r *Rotator) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for {
+		_, err := r.Rotate(ctx)
+		if err == nil {
+			<-ctx.Done()
+			return nil
+		}
+		if ctx.Err() == nil {
+			r.logger.Error("key rotation failed", zap.Error(err))
+		}
+
+		select {
+		case <-clk.After(r.retryDelay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Rotate re-encrypts the values of the columns sealed with older keys, resuming from the checkpoints.
+// a failing column does not stop the others, the first error is returned.
+func (r *Rotator) Rotate(ctx context.Context) ([]Progress, error) {
+	var progress []Progress
+	var firstErr error
+	for _, c := range r.columns {
+		p, err := r.rotate(ctx, c)
+		progress = append(progress, p)
+		if err != nil {
+			r.logger.Error("column key rotation failed", zap.Stringer("column", c), zap.Int64("rotated", p.Rotated), zap.Error(err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("rotation of %s: %w", c, err)
+			}
+		}
+	}
+	return progress, firstErr
+}
+
+func (r *Rotator) rotate(ctx context.Context, c Column) (Progress, error) {
+	clk := clock.FromContext(ctx)
+	version := r.keyring.Primary()
+	p := Progress{Table: c.Table, Column: c.Column, KeyVersion: version}
+
+	var lastKey *string
+	err := r.db.QueryRow(ctx, `SELECT last_key, rotated, done FROM `+rotationsTable+`
+		WHERE table_name = $1 AND column_name = $2 AND key_version = $3`, c.Table, c.Column, int64(version)).
+		Scan(&lastKey, &p.Rotated, &p.Done)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return p, err
+	}
+	if p.Done {
+		r.setDone(c)
+		return p, nil
+	}
+
+	table := store.QuoteIdentifier(c.Table)
+	key, col := pgx.Identifier{c.Key}.Sanitize(), pgx.Identifier{c.Column}.Sanitize()
+	// payloads sealed with the primary key start with its header, they are skipped by the query
+	sel := "SELECT " + key + "::text, " + col + " FROM " + table + " WHERE " + col + " IS NOT NULL AND substring(" +
+		col + " FROM 1 FOR " + strconv.Itoa(headerSize) + ") <> $1"
+	update := "UPDATE " + table + " SET " + col + " = $1 WHERE " + key + " = $2 AND " + col + " = $3"
+
+	for {
+		query, args := sel+" ORDER BY "+key+" LIMIT "+strconv.Itoa(r.batchSize), []interface{}{header(version)}
+		if lastKey != nil {
+			query = sel + " AND " + key + " > $2 ORDER BY " + key + " LIMIT " + strconv.Itoa(r.batchSize)
+			args = append(args, *lastKey)
+		}
+		batch, err := r.batch(ctx, query, args)
+		if err != nil {
+			return p, err
+		}
+
+		for _, row := range batch {
+			sealed, _, err := r.keyring.Reencrypt(row.value)
+			if err != nil {
+				return p, fmt.Errorf("row %s: %w", row.key, err)
+			}
+			// rows written since the batch was read keep their new value
+			tag, err := r.db.Exec(ctx, update, sealed, row.key, row.value)
+			if err != nil {
+				return p, err
+			}
+			p.Rotated += tag.RowsAffected()
+			if r.rotated != nil {
+				r.rotated.WithLabelValues(c.Table, c.Column).Add(float64(tag.RowsAffected()))
+			}
+		}
+		if len(batch) > 0 {
+			lastKey = &batch[len(batch)-1].key
+		}
+		p.Done = len(batch) < r.batchSize
+		if err := r.checkpoint(ctx, c, version, lastKey, p); err != nil {
+			return p, err
+		}
+		if p.Done {
+			break
+		}
+
+		select {
+		case <-clk.After(r.batchPause):
+		case <-ctx.Done():
+			return p, ctx.Err()
+		}
+	}
+
+	r.setDone(c)
+	r.logger.Info("column key rotated", zap.Stringer("column", c), zap.Uint32("key_version", version), zap.Int64("rotated", p.Rotated))
+	return p, nil
+}
+
+type sealedRow struct {
+	key   string
+	value []byte
+}
+
+func (r *Rotator) batch(ctx context.Context, query string, args []interface{}) ([]sealedRow, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []sealedRow
+	for rows.Next() {
+		var row sealedRow
+		if err := rows.Scan(&row.key, &row.value); err != nil {
+			return nil, err
+		}
+		batch = append(batch, row)
+	}
+	return batch, rows.Err()
+}
+
+func (r *Rotator) checkpoint(ctx context.Context, c Column, version uint32, lastKey *string, p Progress) error {
+	_, err := r.db.Exec(ctx, `INSERT INTO `+rotationsTable+` (table_name, column_name, key_version, last_key, rotated, done, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (table_name, column_name, key_version)
+		DO UPDATE SET last_key = excluded.last_key, rotated = excluded.rotated, done = excluded.done, updated_at = excluded.updated_at`,
+		c.Table, c.Column, int64(version), lastKey, p.Rotated, p.Done, clock.FromContext(ctx).Now())
+	return err
+}
+
+func (r *Rotator) setDone(c Column) {
+	if r.done != nil {
+		r.done.WithLabelValues(c.Table, c.Column).Set(1)
+	}
+}
@@ -0,0 +1,140 @@
+package errs
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Code classifies errors. values match the gRPC status codes, so they convert directly
+// with codes.Code(c) and back with errs.Code(status.Code(err)).
+type Code uint32
+
+const (
+	CodeOK Code = iota
+	CodeCanceled
+	CodeUnknown
+	CodeInvalidArgument
+	CodeDeadlineExceeded
+	CodeNotFound
+	CodeAlreadyExists
+	CodePermissionDenied
+	CodeResourceExhausted
+	CodeFailedPrecondition
+	CodeAborted
+	CodeOutOfRange
+	CodeUnimplemented
+	CodeInternal
+	CodeUnavailable
+	CodeDataLoss
+	CodeUnauthenticated
+)
+
+// StatusClientClosedRequest is the non standard status used when the client canceled the request.
+const StatusClientClosedRequest = 499
+
+type codeInfo struct {
+	name        string
+	status      int
+	messageCode string
+}
+
+// codes holds the http status and rest Message code of each code, following the grpc-gateway mapping.
+var codes = map[Code]codeInfo{
+	CodeOK:                 {name: "OK", status: http.StatusOK, messageCode: "OK"},
+	CodeCanceled:           {name: "Canceled", status: StatusClientClosedRequest, messageCode: "ErrCanceled"},
+	CodeUnknown:            {name: "Unknown", status: http.StatusInternalServerError, messageCode: "ErrInternalServer"},
+	CodeInvalidArgument:    {name: "InvalidArgument", status: http.StatusBadRequest, messageCode: "ErrBadRequest"},
+	CodeDeadlineExceeded:   {name: "DeadlineExceeded", status: http.StatusGatewayTimeout, messageCode: "ErrTimeout"},
+	CodeNotFound:           {name: "NotFound", status: http.StatusNotFound, messageCode: "ErrNotFound"},
+	CodeAlreadyExists:      {name: "AlreadyExists", status: http.StatusConflict, messageCode: "ErrAlreadyExist"},
+	CodePermissionDenied:   {name: "PermissionDenied", status: http.StatusForbidden, messageCode: "ErrForbidden"},
+	CodeResourceExhausted:  {name: "ResourceExhausted", status: http.StatusTooManyRequests, messageCode: "ErrTooManyRequests"},
+	CodeFailedPrecondition: {name: "FailedPrecondition", status: http.StatusBadRequest, messageCode: "ErrFailedPrecondition"},
+	CodeAborted:            {name: "Aborted", status: http.StatusConflict, messageCode: "ErrAborted"},
+	CodeOutOfRange:         {name: "OutOfRange", status: http.StatusBadRequest, messageCode: "ErrOutOfRange"},
+	CodeUnimplemented:      {name: "Unimplemented", status: http.StatusNotImplemented, messageCode: "ErrNotImplemented"},
+	CodeInternal:           {name: "Internal", status: http.StatusInternalServerError, messageCode: "ErrInternalServer"},
+	CodeUnavailable:        {name: "Unavailable", status: http.StatusServiceUnavailable, messageCode: "ErrUnavailable"},
+	CodeDataLoss:           {name: "DataLoss", status: http.StatusInternalServerError, messageCode: "ErrDataLoss"},
+	CodeUnauthenticated:    {name: "Unauthenticated", status: http.StatusUnauthorized, messageCode: "ErrUnauthorized"},
+}
+
+// statusCodes maps http statuses back to codes. statuses shared by several codes map to the most general one.
+var statusCodes = map[int]Code{
+	http.StatusOK:                  CodeOK,
+	StatusClientClosedRequest:      CodeCanceled,
+	http.StatusBadRequest:          CodeInvalidArgument,
+	http.StatusUnauthorized:        CodeUnauthenticated,
+	http.StatusForbidden:           CodePermissionDenied,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeAlreadyExists,
+	http.StatusPreconditionFailed:  CodeFailedPrecondition,
+	http.StatusRequestTimeout:      CodeDeadlineExceeded,
+	http.StatusTooManyRequests:     CodeResourceExhausted,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusNotImplemented:      CodeUnimplemented,
+	http.StatusBadGateway:          CodeUnavailable,
+	http.StatusServiceUnavailable:  CodeUnavailable,
+	http.StatusGatewayTimeout:      CodeDeadlineExceeded,
+}
+
+func (c Code) String() string {
+	if i, ok := codes[c]; ok {
+		return i.name
+	}
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// HTTPStatus returns the http status of c.
+func (c Code) HTTPStatus() int {
+	if i, ok := codes[c]; ok {
+		return i.status
+	}
+	return http.StatusInternalServerError
+}
+
+// MessageCode returns the code used in rest.Message for c, like ErrNotFound.
+func (c Code) MessageCode() string {
+	if i, ok := codes[c]; ok {
+		return i.messageCode
+	}
+	return "ErrInternalServer"
+}
+
+// FromHTTPStatus returns the code of an http status. unknown 4xx statuses map to CodeInvalidArgument
+// and others to CodeUnknown.
+func FromHTTPStatus(status int) Code {
+	if c, ok := statusCodes[status]; ok {
+		return c
+	}
+	switch {
+	case status >= 200 && status < 300:
+		return CodeOK
+	case status >= 400 && status < 500:
+		return CodeInvalidArgument
+	default:
+		return CodeUnknown
+	}
+}
+
+// FromMessageCode returns the code of a rest.Message code.
+func FromMessageCode(messageCode string) Code {
+	for c, i := range codes {
+		// CodeUnknown and CodeInternal share a message code, prefer CodeInternal
+		if i.messageCode == messageCode && c != CodeUnknown {
+			return c
+		}
+	}
+	return CodeUnknown
+}
+
+// Retryable reports if an operation failing with c may succeed when retried as is. client errors,
+// like CodeInvalidArgument or CodeNotFound, fail the same way every time, unknown errors are retried.
+func (c Code) Retryable() bool {
+	switch c {
+	case CodeCanceled, CodeUnknown, CodeDeadlineExceeded, CodeResourceExhausted, CodeAborted,
+		CodeInternal, CodeUnavailable:
+		return true
+	}
+	return false
+}
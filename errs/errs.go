@@ -0,0 +1,211 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Error is a domain error with a code, a message safe to show to users and metadata for logs.
+// the stack of the caller is recorded by the constructors, see StackTrace.
+// errors.Is matches errors with the same code, and the same message if the target has one, so the
+// sentinels like ErrNotFound can be used to check the kind of any error.
+// example:
+//
+//	func (r *Repo) GetUser(ctx context.Context, id string) (*User, error) {
+//		...
+//		if errors.Is(err, pgx.ErrNoRows) {
+//			return nil, errs.NotFound("user %s not found", id).WithMeta("user_id", id)
+//		}
+//		if err != nil {
+//			return nil, errs.Internal("get user failed").Wrap(err)
+//		}
+//	}
+type Error struct {
+	Code    Code
+	Message string
+	Meta    map[string]interface{}
+	Err     error
+
+	stack []uintptr
+}
+
+var (
+	ErrNotFound     = &Error{Code: CodeNotFound}
+	ErrInvalid      = &Error{Code: CodeInvalidArgument}
+	ErrConflict     = &Error{Code: CodeAlreadyExists}
+	ErrUnauthorized = &Error{Code: CodeUnauthenticated}
+	ErrForbidden    = &Error{Code: CodePermissionDenied}
+	ErrInternal     = &Error{Code: CodeInternal}
+)
+
+// New returns an error with code and a message formatted like fmt.Sprintf.
+func New(code Code, format string, args ...interface{}) *Error {
+	return newError(code, fmt.Sprintf(format, args...), nil)
+}
+
+// Wrap returns an error with code and message, caused by err.
+func Wrap(err error, code Code, format string, args ...interface{}) *Error {
+	return newError(code, fmt.Sprintf(format, args...), err)
+}
+
+func NotFound(format string, args ...interface{}) *Error {
+	return newError(CodeNotFound, fmt.Sprintf(format, args...), nil)
+}
+
+func Invalid(format string, args ...interface{}) *Error {
+	return newError(CodeInvalidArgument, fmt.Sprintf(format, args...), nil)
+}
+
+func Conflict(format string, args ...interface{}) *Error {
+	return newError(CodeAlreadyExists, fmt.Sprintf(format, args...), nil)
+}
+
+func Unauthorized(format string, args ...interface{}) *Error {
+	return newError(CodeUnauthenticated, fmt.Sprintf(format, args...), nil)
+}
+
+func Forbidden(format string, args ...interface{}) *Error {
+	return newError(CodePermissionDenied, fmt.Sprintf(format, args...), nil)
+}
+
+func Internal(format string, args ...interface{}) *Error {
+	return newError(CodeInternal, fmt.Sprintf(format, args...), nil)
+}
+
+// newError must be called by the constructors directly, so the recorded stack starts at their caller.
+func newError(code Code, message string, err error) *Error {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	return &Error{Code: code, Message: message, Err: err, stack: pcs[:n]}
+}
+
+// Error returns the message followed by the cause, the cause is not meant to be shown to users.
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Code.String()
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) ErrorCode() Code {
+	return e.Code
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && (t.Message == "" || t.Message == e.Message)
+}
+
+// StackTrace returns the stack where e was created, one function and file:line pair per frame.
+func (e *Error) StackTrace() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Wrap sets the cause of e.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// WithMeta adds a key value pair to the metadata of e, for logs.
+func (e *Error) WithMeta(key string, value interface{}) *Error {
+	if e.Meta == nil {
+		e.Meta = make(map[string]interface{})
+	}
+	e.Meta[key] = value
+	return e
+}
+
+// UserMessage returns the message of the first Error in the chain of err, which is safe to show to
+// users, and false if there is none.
+func UserMessage(err error) (string, bool) {
+	var e *Error
+	if errors.As(err, &e) && e.Message != "" {
+		return e.Message, true
+	}
+	return "", false
+}
+
+// Meta returns the metadata of all Errors in the chain of err, outer values win.
+func Meta(err error) map[string]interface{} {
+	var out map[string]interface{}
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			for k, v := range e.Meta {
+				if out == nil {
+					out = make(map[string]interface{})
+				}
+				if _, exists := out[k]; !exists {
+					out[k] = v
+				}
+			}
+		}
+		err = errors.Unwrap(err)
+	}
+	return out
+}
+
+// StackTracer is implemented by errors recording where they were created, or where a panic happened.
+type StackTracer interface {
+	StackTrace() string
+}
+
+// StackTrace returns the stack of the innermost error in the chain of err implementing StackTracer,
+// which is the closest to where the failure happened, and "" if there is none.
+func StackTrace(err error) string {
+	var stack string
+	for err != nil {
+		if st, ok := err.(StackTracer); ok {
+			if s := st.StackTrace(); s != "" {
+				stack = s
+			}
+		}
+		err = errors.Unwrap(err)
+	}
+	return stack
+}
+
+// Chain returns the messages of the errors in the chain of err from the outermost, without the parts
+// repeated from their causes, so logs show each step the error went through.
+// example:
+//
+//	errs.Chain(fmt.Errorf("load profile: %w", errs.NotFound("user not found").Wrap(sql.ErrNoRows)))
+//	// ["load profile", "user not found", "sql: no rows in result set"]
+func Chain(err error) []string {
+	var chain []string
+	for err != nil {
+		msg := err.Error()
+		next := errors.Unwrap(err)
+		if next != nil {
+			msg = strings.TrimSuffix(strings.TrimSuffix(msg, next.Error()), ": ")
+		}
+		if msg != "" {
+			chain = append(chain, msg)
+		}
+		err = next
+	}
+	return chain
+}
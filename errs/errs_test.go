@@ -0,0 +1,106 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodes(t *testing.T) {
+	for c := CodeOK; c <= CodeUnauthenticated; c++ {
+		// every code must survive a round trip through its rest message code
+		require.Equal(t, c == CodeUnknown, FromMessageCode(c.MessageCode()) != c, c.String())
+	}
+
+	require.Equal(t, CodeNotFound, FromHTTPStatus(http.StatusNotFound))
+	require.Equal(t, CodeInvalidArgument, FromHTTPStatus(http.StatusUnprocessableEntity))
+	require.Equal(t, CodeUnknown, FromHTTPStatus(http.StatusHTTPVersionNotSupported))
+	require.Equal(t, http.StatusConflict, CodeAlreadyExists.HTTPStatus())
+	require.Equal(t, "Code(100)", Code(100).String())
+
+	require.True(t, CodeUnknown.Retryable())
+	require.True(t, CodeUnavailable.Retryable())
+	require.False(t, CodeNotFound.Retryable())
+	require.False(t, CodeInvalidArgument.Retryable())
+}
+
+func TestCodeOf(t *testing.T) {
+	require.Equal(t, CodeOK, CodeOf(nil))
+	require.Equal(t, CodeUnknown, CodeOf(errors.New("foo")))
+	require.Equal(t, CodeDeadlineExceeded, CodeOf(fmt.Errorf("query: %w", context.DeadlineExceeded)))
+	require.Equal(t, CodeNotFound, CodeOf(fmt.Errorf("wrapped: %w", WithCode(errors.New("foo"), CodeNotFound))))
+
+	mappersMu.Lock()
+	saved := mappers
+	mappersMu.Unlock()
+	defer func() {
+		mappersMu.Lock()
+		mappers = saved
+		mappersMu.Unlock()
+	}()
+
+	errPayment := errors.New("insufficient funds")
+	RegisterMapper(func(err error) (Code, bool) {
+		return CodeFailedPrecondition, errors.Is(err, errPayment)
+	})
+	require.Equal(t, CodeFailedPrecondition, CodeOf(fmt.Errorf("charge: %w", errPayment)))
+}
+
+func TestError(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := fmt.Errorf("load profile: %w", NotFound("user %d not found", 1).WithMeta("user_id", 1).Wrap(cause))
+
+	require.EqualError(t, err, "load profile: user 1 not found: connection reset")
+	require.Equal(t, CodeNotFound, CodeOf(err))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, err, cause)
+	require.NotErrorIs(t, err, ErrConflict)
+	require.NotErrorIs(t, err, NotFound("user 2 not found"))
+
+	msg, ok := UserMessage(err)
+	require.True(t, ok)
+	require.Equal(t, "user 1 not found", msg)
+
+	outer := Internal("sync failed").WithMeta("user_id", 2).Wrap(err)
+	require.Equal(t, map[string]interface{}{"user_id": 2}, Meta(outer))
+	require.Equal(t, CodeInternal, CodeOf(outer))
+
+	_, ok = UserMessage(cause)
+	require.False(t, ok)
+}
+
+func TestChainAndStackTrace(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := fmt.Errorf("load profile: %w", Internal("query user").Wrap(cause))
+
+	require.Equal(t, []string{"load profile", "query user", "connection reset"}, Chain(err))
+	require.Nil(t, Chain(nil))
+
+	stack := StackTrace(err)
+	require.Contains(t, stack, "errs.TestChainAndStackTrace")
+	require.NotContains(t, stack, "errs.newError")
+	require.Empty(t, StackTrace(cause))
+}
+
+func TestGRPCStatus(t *testing.T) {
+	code, msg := GRPCStatus(fmt.Errorf("get: %w", NotFound("user 1 not found").Wrap(errors.New("no rows"))))
+	require.Equal(t, CodeNotFound, code)
+	require.Equal(t, "user 1 not found", msg)
+
+	// details of server errors never reach clients
+	code, msg = GRPCStatus(errors.New("dial tcp 10.0.0.1:5432: connection refused"))
+	require.Equal(t, CodeUnknown, code)
+	require.Equal(t, "Unknown", msg)
+
+	code, msg = GRPCStatus(context.DeadlineExceeded)
+	require.Equal(t, CodeDeadlineExceeded, code)
+	require.Equal(t, "DeadlineExceeded", msg)
+
+	code, msg = GRPCStatus(nil)
+	require.Equal(t, CodeOK, code)
+	require.Empty(t, msg)
+}
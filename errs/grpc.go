@@ -0,0 +1,32 @@
+package errs
+
+// GRPCStatus returns the code and message of the gRPC status err should be returned as, for server
+// interceptors. like rest.WriteErr the message of an Error is used without its cause and messages of
+// server errors are replaced by the name of the code. the code converts with codes.Code(c).
+// example:
+//
+//	func ErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+//		resp, err := handler(ctx, req)
+//		if _, ok := status.FromError(err); !ok {
+//			c, msg := errs.GRPCStatus(err)
+//			return resp, status.Error(codes.Code(c), msg)
+//		}
+//		return resp, err
+//	}
+//
+//	server := grpc.NewServer(grpc.ChainUnaryInterceptor(ErrorInterceptor))
+func GRPCStatus(err error) (Code, string) {
+	code := CodeOf(err)
+	if code == CodeOK {
+		return code, ""
+	}
+
+	message, ok := UserMessage(err)
+	if !ok {
+		message = err.Error()
+	}
+	if code.HTTPStatus() >= 500 {
+		message = code.String()
+	}
+	return code, message
+}
@@ -0,0 +1,85 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Mapper returns the code of err, ok must be false if it does not know err.
+type Mapper func(err error) (code Code, ok bool)
+
+var (
+	mappersMu sync.RWMutex
+	mappers   = []Mapper{contextMapper}
+)
+
+// RegisterMapper adds m to the mappers used by CodeOf. mappers registered later are tried first, so
+// services can override the mapping of the toolkit. it should be called at startup.
+// example:
+//
+//	errs.RegisterMapper(func(err error) (errs.Code, bool) {
+//		if errors.Is(err, payment.ErrInsufficientFunds) {
+//			return errs.CodeFailedPrecondition, true
+//		}
+//		return 0, false
+//	})
+func RegisterMapper(m Mapper) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+	mappers = append([]Mapper{m}, mappers...)
+}
+
+// Coder is implemented by errors carrying their own code.
+type Coder interface {
+	ErrorCode() Code
+}
+
+// CodeOf returns the code of err. an error in the chain implementing Coder wins, then registered
+// mappers are tried in order. nil is CodeOK and unknown errors are CodeUnknown.
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.ErrorCode()
+	}
+
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+	for _, m := range mappers {
+		if c, ok := m(err); ok {
+			return c
+		}
+	}
+	return CodeUnknown
+}
+
+type codedError struct {
+	err  error
+	code Code
+}
+
+func (e *codedError) Error() string   { return e.err.Error() }
+func (e *codedError) Unwrap() error   { return e.err }
+func (e *codedError) ErrorCode() Code { return e.code }
+
+// WithCode attaches code to err, so CodeOf returns it.
+func WithCode(err error, code Code) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{err: err, code: code}
+}
+
+func contextMapper(err error) (Code, bool) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled, true
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded, true
+	}
+	return 0, false
+}
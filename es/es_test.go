@@ -0,0 +1,469 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *memoryStore) Append(_ context.Context, stream string, expected int64, events ...EventData) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current int64
+	for _, e := range s.events {
+		if e.StreamID == stream {
+			current = e.Version
+		}
+	}
+	if expected != AnyVersion && expected != current {
+		return 0, ErrVersionConflict
+	}
+	for _, e := range events {
+		current++
+		s.events = append(s.events, Event{Position: int64(len(s.events) + 1), StreamID: stream, Version: current, Type: e.Type, Data: e.Data})
+	}
+	return current, nil
+}
+
+func (s *memoryStore) Load(_ context.Context, stream string, from int64) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for _, e := range s.events {
+		if e.StreamID == stream && e.Version > from {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) ReadAll(_ context.Context, from int64, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for _, e := range s.events {
+		if e.Position > from && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) Head(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.events)), nil
+}
+
+type memoryCheckpoints struct {
+	sync.Map
+}
+
+func (c *memoryCheckpoints) Load(_ context.Context, name string) (int64, error) {
+	v, _ := c.Map.Load(name)
+	p, _ := v.(int64)
+	return p, nil
+}
+
+func (c *memoryCheckpoints) Save(_ context.Context, name string, position int64) error {
+	c.Map.Store(name, position)
+	return nil
+}
+
+type orderPlaced struct {
+	OrderID string `json:"order_id"`
+}
+
+type orderShipped struct {
+	OrderID string `json:"order_id"`
+	Carrier string `json:"carrier"`
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	Register[orderPlaced](r, "order.placed")
+	Register[orderShipped](r, "order.shipped")
+
+	{ // events are stored with their registered names
+		data, err := r.Marshal(&orderShipped{OrderID: "1", Carrier: "dhl"})
+		require.NoError(t, err)
+		require.Equal(t, "order.shipped", data.Type)
+		require.JSONEq(t, `{"order_id":"1","carrier":"dhl"}`, string(data.Data))
+
+		v, err := r.Unmarshal(Event{Type: data.Type, Data: data.Data})
+		require.NoError(t, err)
+		require.Equal(t, orderShipped{OrderID: "1", Carrier: "dhl"}, v)
+
+		placed, err := Decode[orderPlaced](Event{Type: "order.placed", Data: []byte(`{"order_id":"2"}`)})
+		require.NoError(t, err)
+		require.Equal(t, "2", placed.OrderID)
+	}
+
+	{ // unregistered types and names fail
+		_, err := r.Marshal(struct{}{})
+		require.Error(t, err)
+		_, err = r.Unmarshal(Event{Type: "order.lost"})
+		require.Error(t, err)
+		require.Panics(t, func() { Register[orderShipped](r, "order.placed") })
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	ctx := context.Background()
+	events := &memoryStore{}
+	checkpoints := &memoryCheckpoints{}
+
+	{ // appends check the expected version
+		_, err := events.Append(ctx, "order-1", NoStream, EventData{Type: "order.placed", Data: []byte(`{}`)})
+		require.NoError(t, err)
+		_, err = events.Append(ctx, "order-1", NoStream, EventData{Type: "order.placed", Data: []byte(`{}`)})
+		require.True(t, errors.Is(err, ErrVersionConflict))
+		require.Equal(t, errs.CodeAlreadyExists, errs.CodeOf(err))
+
+		v, err := events.Append(ctx, "order-2", AnyVersion, EventData{Type: "order.placed"}, EventData{Type: "order.shipped"})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), v)
+	}
+
+	var mu sync.Mutex
+	var handled []int64
+	fail := true
+	sub, err := NewSubscription("test", events, checkpoints, func(ctx context.Context, e Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Position == 3 && fail {
+			fail = false
+			return errors.New("boom")
+		}
+		handled = append(handled, e.Position)
+		return nil
+	}, WithBatchSize(2), WithPollInterval(time.Second))
+	require.NoError(t, err)
+
+	{ // a failing handler stops the subscription after saving the checkpoint of the handled events
+		err := sub.Run(ctx)
+		require.EqualError(t, err, "boom")
+		p, _ := checkpoints.Load(ctx, "test")
+		require.Equal(t, int64(2), p)
+	}
+
+	fake := goxtest.NewFakeClock(time.Now())
+	runCtx, cancel := context.WithCancel(clock.WithContext(ctx, fake))
+	done := make(chan error)
+	go func() { done <- sub.Run(runCtx) }()
+
+	{ // the next run resumes after the checkpoint and picks up new events
+		require.Eventually(t, func() bool { return fake.Waiters() == 1 }, time.Second, time.Millisecond)
+		_, err := events.Append(ctx, "order-3", NoStream, EventData{Type: "order.placed"})
+		require.NoError(t, err)
+		fake.Advance(time.Second)
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(handled) == 4
+		}, time.Second, time.Millisecond)
+		require.Equal(t, []int64{1, 2, 3, 4}, handled)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+	p, _ := checkpoints.Load(ctx, "test")
+	require.Equal(t, int64(4), p)
+}
+
+type countProjection struct {
+	name   string
+	mu     sync.Mutex
+	count  int
+	fail   bool
+	resets int
+}
+
+func (p *countProjection) Name() string { return p.name }
+
+func (p *countProjection) Apply(_ context.Context, e Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail {
+		return errors.New("read table is locked")
+	}
+	p.count++
+	return nil
+}
+
+func (p *countProjection) Reset(_ context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count = 0
+	p.resets++
+	return nil
+}
+
+func (p *countProjection) get() (count, resets int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.count, p.resets
+}
+
+func TestProjector(t *testing.T) {
+	ctx := context.Background()
+	events := &memoryStore{}
+	checkpoints := &memoryCheckpoints{}
+	_, err := events.Append(ctx, "order-1", NoStream, EventData{Type: "order.placed"}, EventData{Type: "order.shipped"})
+	require.NoError(t, err)
+
+	a := &countProjection{name: "a", fail: true}
+	var bCount int
+	var mu sync.Mutex
+	b := ProjectionFunc("b", func(ctx context.Context, e Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		bCount++
+		return nil
+	})
+
+	p, err := NewProjector(events, checkpoints, []Projection{a, b}, WithRetryDelay(time.Minute))
+	require.NoError(t, err)
+	_, err = NewProjector(events, checkpoints, []Projection{a, a})
+	require.Error(t, err)
+
+	fake := goxtest.NewFakeClock(time.Now())
+	runCtx, cancel := context.WithCancel(clock.WithContext(ctx, fake))
+	done := make(chan error)
+	go func() { done <- p.Run(runCtx) }()
+
+	status := func(name string) ProjectionStatus {
+		for _, s := range p.Status() {
+			if s.Name == name {
+				return s
+			}
+		}
+		return ProjectionStatus{}
+	}
+
+	{ // a failing projection does not stop the others, and fails the probe
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return bCount == 2 && status("a").Error != ""
+		}, time.Second, time.Millisecond)
+		// the lag loop, projection b and the retry of a wait
+		require.Eventually(t, func() bool { return fake.Waiters() == 3 }, time.Second, time.Millisecond)
+		require.NoError(t, p.refresh(runCtx))
+
+		require.Equal(t, ProjectionStatus{Name: "a", Head: 2, Lag: 2, Rebuildable: true, Error: "read table is locked"}, status("a"))
+		require.Equal(t, ProjectionStatus{Name: "b", Position: 2, Head: 2}, status("b"))
+		require.EqualError(t, p.Probe(0)(), "projection a failed: read table is locked")
+	}
+
+	{ // the failed projection is retried after the delay and recovers
+		a.mu.Lock()
+		a.fail = false
+		a.mu.Unlock()
+		fake.Advance(time.Minute)
+		require.Eventually(t, func() bool { return status("a").Position == 2 }, time.Second, time.Millisecond)
+		require.Empty(t, status("a").Error)
+		require.NoError(t, p.Probe(0)())
+	}
+
+	{ // the handler reports status and rebuilds projections which can be reset
+		srv := httptest.NewServer(p.Handler())
+		defer srv.Close()
+
+		res, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		var got []ProjectionStatus
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+		res.Body.Close()
+		require.Len(t, got, 2)
+
+		res, err = http.Post(srv.URL+"/b/rebuild", "", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res, err = http.Post(srv.URL+"/c/rebuild", "", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+		res, err = http.Post(srv.URL+"/a/rebuild", "", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+
+		require.Eventually(t, func() bool {
+			count, resets := a.get()
+			return resets == 1 && count == 2
+		}, time.Second, time.Millisecond)
+	}
+
+	{ // lag counts events the projections did not apply yet
+		require.Eventually(t, func() bool { return status("a").Position == 2 }, time.Second, time.Millisecond)
+		_, err := events.Append(ctx, "order-2", NoStream, EventData{Type: "order.placed"}, EventData{Type: "order.shipped"})
+		require.NoError(t, err)
+		require.NoError(t, p.refresh(runCtx))
+		require.Equal(t, int64(2), status("a").Lag)
+		require.NoError(t, p.Probe(0)())
+		require.NoError(t, p.Probe(2)())
+		require.EqualError(t, p.Probe(1)(), "projection a is 2 events behind")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	for _, name := range []string{"projection:a", "projection:b"} {
+		p, _ := checkpoints.Load(ctx, name)
+		require.Equal(t, int64(2), p)
+	}
+}
+
+func TestPgStore(t *testing.T) {
+	ctx := context.Background()
+	events, err := NewPgStore(ctx, goxtest.NewTestDB(t))
+	require.NoError(t, err)
+	placed := EventData{Type: "order.placed", Data: []byte(`{"order_id":"1"}`), Metadata: []byte(`{"user":"alice"}`)}
+	shipped := EventData{Type: "order.shipped", Data: []byte(`{"order_id":"1"}`)}
+
+	{ // appends check the expected version
+		v, err := events.Append(ctx, "order-1", NoStream, placed)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), v)
+		_, err = events.Append(ctx, "order-1", NoStream, placed)
+		require.ErrorIs(t, err, ErrVersionConflict)
+		v, err = events.Append(ctx, "order-1", 1, shipped)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), v)
+		v, err = events.Append(ctx, "order-1", AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), v)
+	}
+
+	{ // streams load from a version, all events by position
+		loaded, err := events.Load(ctx, "order-1", 1)
+		require.NoError(t, err)
+		require.Len(t, loaded, 1)
+		require.Equal(t, "order.shipped", loaded[0].Type)
+		require.Equal(t, int64(2), loaded[0].Version)
+
+		all, err := events.ReadAll(ctx, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+		require.JSONEq(t, `{"user":"alice"}`, string(all[0].Metadata))
+		require.Nil(t, all[1].Metadata)
+		head, err := events.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, all[1].Position, head)
+	}
+
+	{ // concurrent appends with any version all succeed, in order
+		var wg sync.WaitGroup
+		results := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := events.Append(ctx, "order-2", AnyVersion, placed)
+				results <- err
+			}()
+		}
+		wg.Wait()
+		close(results)
+		for err := range results {
+			require.NoError(t, err)
+		}
+		loaded, err := events.Load(ctx, "order-2", 0)
+		require.NoError(t, err)
+		require.Len(t, loaded, 8)
+		for i, e := range loaded {
+			require.Equal(t, int64(i+1), e.Version)
+		}
+	}
+}
+
+func TestPgTransactionalProjection(t *testing.T) {
+	ctx := context.Background()
+	pool := goxtest.NewTestDB(t)
+	checkpoints, err := NewPgCheckpoints(ctx, pool)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, "CREATE TABLE orders_view (id text PRIMARY KEY)")
+	require.NoError(t, err)
+
+	orders := Transactional("orders", pool, func(ctx context.Context, tx pgx.Tx, e Event) error {
+		placed, err := Decode[orderPlaced](e)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO orders_view (id) VALUES ($1)", placed.OrderID); err != nil {
+			return err
+		}
+		if placed.OrderID == "broken" {
+			return errors.New("broken order")
+		}
+		return nil
+	}, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "TRUNCATE orders_view")
+		return err
+	})
+	event := func(position int64, id string) Event {
+		return Event{Position: position, Type: "order.placed", Data: []byte(`{"order_id":"` + id + `"}`)}
+	}
+	count := func() int {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM orders_view").Scan(&n))
+		return n
+	}
+	position := func() int64 {
+		p, err := checkpoints.Load(ctx, projectionKey("orders"))
+		require.NoError(t, err)
+		return p
+	}
+
+	{ // events move the checkpoint with the read table, redelivered ones are skipped
+		require.Equal(t, int64(0), position())
+		require.NoError(t, orders.Apply(ctx, event(1, "1")))
+		require.NoError(t, orders.Apply(ctx, event(1, "1")))
+		require.NoError(t, orders.Apply(ctx, event(2, "2")))
+		require.Equal(t, 2, count())
+		require.Equal(t, int64(2), position())
+	}
+
+	{ // failed events roll back their writes and keep the checkpoint
+		require.EqualError(t, orders.Apply(ctx, event(3, "broken")), "broken order")
+		require.Equal(t, 2, count())
+		require.Equal(t, int64(2), position())
+	}
+
+	{ // resets clear the read table and the checkpoint
+		require.NoError(t, orders.(Resetter).Reset(ctx))
+		require.Equal(t, 0, count())
+		require.Equal(t, int64(0), position())
+		require.NoError(t, orders.Apply(ctx, event(1, "1")))
+		require.Equal(t, 1, count())
+	}
+
+	{ // checkpoints of subscriptions are stored too
+		require.NoError(t, checkpoints.Save(ctx, "mailer", 7))
+		require.NoError(t, checkpoints.Save(ctx, "mailer", 9))
+		p, err := checkpoints.Load(ctx, "mailer")
+		require.NoError(t, err)
+		require.Equal(t, int64(9), p)
+	}
+}
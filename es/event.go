@@ -0,0 +1,115 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Event is an event as stored, Position orders the events of all streams and Version the events of
+// one stream, both start at 1.
+type Event struct {
+	Position   int64           `json:"position"`
+	StreamID   string          `json:"stream_id"`
+	Version    int64           `json:"version"`
+	Type       string          `json:"type"`
+	Data       json.RawMessage `json:"data"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// EventData is an event to append.
+type EventData struct {
+	Type     string
+	Data     json.RawMessage
+	Metadata json.RawMessage
+}
+
+// Registry maps the go types of events to the names they are stored with, so streams can be decoded
+// into typed events. names must never change once events were stored with them.
+type Registry struct {
+	mu     sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]reflect.Type{}, byType: map[reflect.Type]string{}}
+}
+
+// Register stores events of type T with name.
+// example:
+//
+//	type OrderPlaced struct {
+//		OrderID string `json:"order_id"`
+//	}
+//
+//	events := es.NewRegistry()
+//	es.Register[OrderPlaced](events, "order.placed")
+func Register[T any](r *Registry, name string) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if other, ok := r.byName[name]; ok && other != t {
+		panic(fmt.Sprintf("es: event %s is already registered for %s", name, other))
+	}
+	r.byName[name] = t
+	r.byType[t] = name
+}
+
+// Marshal returns the event data of v, whose type must be registered.
+func (r *Registry) Marshal(v interface{}) (EventData, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	r.mu.RLock()
+	name, ok := r.byType[t]
+	r.mu.RUnlock()
+	if !ok {
+		return EventData{}, fmt.Errorf("es: event type %v is not registered", t)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return EventData{}, fmt.Errorf("es: marshal %s: %w", name, err)
+	}
+	return EventData{Type: name, Data: data}, nil
+}
+
+// Unmarshal decodes the data of e into a value of the type registered for its name. the value is
+// not a pointer, so handlers can switch on the event types.
+// example:
+//
+//	v, err := events.Unmarshal(e)
+//	switch ev := v.(type) {
+//	case OrderPlaced:
+//		...
+//	}
+func (r *Registry) Unmarshal(e Event) (interface{}, error) {
+	r.mu.RLock()
+	t, ok := r.byName[e.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("es: event %s is not registered", e.Type)
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(e.Data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("es: unmarshal %s: %w", e.Type, err)
+	}
+	return v.Elem().Interface(), nil
+}
+
+// Decode decodes the data of e into a T, for handlers which know the type of an event by its name.
+func Decode[T any](e Event) (T, error) {
+	var v T
+	if err := json.Unmarshal(e.Data, &v); err != nil {
+		return v, fmt.Errorf("es: unmarshal %s: %w", e.Type, err)
+	}
+	return v, nil
+}
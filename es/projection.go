@@ -0,0 +1,407 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/group"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// DefaultRetryDelay is how long a failed projection waits before it runs again.
+const DefaultRetryDelay = 5 * time.Second
+
+// Projection builds a read model from events, like a table of orders by customer.
+type Projection interface {
+	Name() string
+	Apply(ctx context.Context, e Event) error
+}
+
+// Resetter is implemented by projections which can be rebuilt, Reset clears their read model before
+// all events are applied again.
+type Resetter interface {
+	Reset(ctx context.Context) error
+}
+
+type projectionFunc struct {
+	name  string
+	apply Handler
+}
+
+func (p *projectionFunc) Name() string                             { return p.name }
+func (p *projectionFunc) Apply(ctx context.Context, e Event) error { return p.apply(ctx, e) }
+
+// ProjectionFunc returns a projection called name applying events with apply.
+func ProjectionFunc(name string, apply Handler) Projection {
+	return &projectionFunc{name: name, apply: apply}
+}
+
+// TxBeginner is implemented by *pgxpool.Pool and *pgx.Conn.
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type txProjection struct {
+	name  string
+	db    TxBeginner
+	apply func(ctx context.Context, tx pgx.Tx, e Event) error
+	reset func(ctx context.Context, tx pgx.Tx) error
+}
+
+// Transactional returns a projection whose read tables are in db, the database of the checkpoints.
+// each event is applied in a transaction which also moves the checkpoint of the projection, and events
+// at or before it are skipped, so every event changes the read tables exactly once even though
+// subscriptions deliver them at least once. reset clears the read tables for rebuilds, it may be nil
+// for projections which can not be rebuilt.
+// example:
+//
+//	orders := es.Transactional("orders", pool, func(ctx context.Context, tx pgx.Tx, e es.Event) error {
+//		placed, err := es.Decode[OrderPlaced](e)
+//		...
+//		_, err = tx.Exec(ctx, "INSERT INTO orders_view (id, customer_id) VALUES ($1, $2)", placed.OrderID, placed.CustomerID)
+//		return err
+//	}, func(ctx context.Context, tx pgx.Tx) error {
+//		_, err := tx.Exec(ctx, "TRUNCATE orders_view")
+//		return err
+//	})
+func Transactional(name string, db TxBeginner, apply func(ctx context.Context, tx pgx.Tx, e Event) error, reset func(ctx context.Context, tx pgx.Tx) error) Projection {
+	p := &txProjection{name: name, db: db, apply: apply, reset: reset}
+	if reset == nil {
+		return p
+	}
+	return &resettableTxProjection{p}
+}
+
+func (p *txProjection) Name() string {
+	return p.name
+}
+
+func (p *txProjection) Apply(ctx context.Context, e Event) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		var position int64
+		err := tx.QueryRow(ctx, "SELECT position FROM "+checkpointsTable+" WHERE name = $1 FOR UPDATE", projectionKey(p.name)).Scan(&position)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if e.Position <= position {
+			return nil
+		}
+		if err := p.apply(ctx, tx, e); err != nil {
+			return err
+		}
+		return (&PgCheckpoints{db: tx}).Save(ctx, projectionKey(p.name), e.Position)
+	})
+}
+
+func (p *txProjection) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type resettableTxProjection struct {
+	*txProjection
+}
+
+func (p *resettableTxProjection) Reset(ctx context.Context) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		if err := p.reset(ctx, tx); err != nil {
+			return err
+		}
+		return (&PgCheckpoints{db: tx}).Save(ctx, projectionKey(p.name), 0)
+	})
+}
+
+// projectionKey is the checkpoint name of a projection.
+func projectionKey(name string) string {
+	return "projection:" + name
+}
+
+// ProjectionStatus is the progress of a projection, Lag is the number of events it is behind.
+type ProjectionStatus struct {
+	Name        string `json:"name"`
+	Position    int64  `json:"position"`
+	Head        int64  `json:"head"`
+	Lag         int64  `json:"lag"`
+	Rebuildable bool   `json:"rebuildable"`
+	Error       string `json:"error,omitempty"`
+}
+
+type projectorEntry struct {
+	projection Projection
+	sub        *Subscription
+	err        error
+	// failedAt is the position the projection failed after, it recovered once it moved past it
+	failedAt int64
+}
+
+type ProjectorOption func(*Projector) error
+
+// WithSubscriptionOptions applies options to the subscriptions of all projections.
+func WithSubscriptionOptions(options ...SubscriptionOption) ProjectorOption {
+	return func(p *Projector) error {
+		p.subOptions = append(p.subOptions, options...)
+		return nil
+	}
+}
+
+// WithRetryDelay sets how long a failed projection waits before it runs again, DefaultRetryDelay by default.
+func WithRetryDelay(d time.Duration) ProjectorOption {
+	return func(p *Projector) error {
+		p.retryDelay = d
+		return nil
+	}
+}
+
+// WithProjectorLogger sets the logger of the projector and its subscriptions.
+func WithProjectorLogger(logger *zap.Logger) ProjectorOption {
+	return func(p *Projector) error {
+		p.logger = logger
+		p.subOptions = append(p.subOptions, WithZapLogger(logger))
+		return nil
+	}
+}
+
+// WithProjectionMetrics registers the gox_es_projection_position and gox_es_projection_lag_events
+// gauges, labeled by projection, with reg.
+func WithProjectionMetrics(reg prometheus.Registerer) ProjectorOption {
+	return func(p *Projector) error {
+		position, err := metrics.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "es", Name: "projection_position",
+			Help: "Position of the last event applied by the projection.",
+		}, []string{"projection"}))
+		if err != nil {
+			return err
+		}
+		lag, err := metrics.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "es", Name: "projection_lag_events",
+			Help: "Number of events the projection is behind the event store.",
+		}, []string{"projection"}))
+		if err != nil {
+			return err
+		}
+		p.positionGauge, p.lagGauge = position, lag
+		return nil
+	}
+}
+
+// Projector runs projections, each as a subscription with its own checkpoint. a failing projection is
+// retried after a delay without stopping the others, its error is shown in its status and fails Probe.
+type Projector struct {
+	events      Store
+	checkpoints Checkpoints
+	entries     []*projectorEntry
+	byName      map[string]*projectorEntry
+
+	subOptions []SubscriptionOption
+	retryDelay time.Duration
+	logger     *zap.Logger
+
+	positionGauge *prometheus.GaugeVec
+	lagGauge      *prometheus.GaugeVec
+
+	// refreshInterval is how often the lag is refreshed, the poll interval of the subscriptions
+	refreshInterval time.Duration
+
+	mu   sync.Mutex
+	head int64
+}
+
+// NewProjector returns a projector of projections, which is a gox.Component to add to the Runner.
+// example:
+//
+//	projector, err := es.NewProjector(events, checkpoints, []es.Projection{orders},
+//		es.WithProjectorLogger(logger), es.WithProjectionMetrics(prometheus.DefaultRegisterer))
+//	probe.WithProbe(probe.Readiness, projector.Probe(1000))
+//	adminRouter.Mount("/projections", projector.Handler())
+func NewProjector(events Store, checkpoints Checkpoints, projections []Projection, options ...ProjectorOption) (*Projector, error) {
+	if len(projections) == 0 {
+		return nil, errors.New("no projections")
+	}
+
+	p := &Projector{
+		events:      events,
+		checkpoints: checkpoints,
+		byName:      make(map[string]*projectorEntry, len(projections)),
+		retryDelay:  DefaultRetryDelay,
+		logger:      zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(p); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pr := range projections {
+		if _, ok := p.byName[pr.Name()]; ok {
+			return nil, fmt.Errorf("duplicate projection %s", pr.Name())
+		}
+		s, err := NewSubscription(projectionKey(pr.Name()), events, checkpoints, pr.Apply, p.subOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := pr.(Resetter); ok {
+			s.reset = r.Reset
+		}
+		e := &projectorEntry{projection: pr, sub: s}
+		p.entries = append(p.entries, e)
+		p.byName[pr.Name()] = e
+		p.refreshInterval = s.pollInterval
+	}
+	return p, nil
+}
+
+func (p *Projector) Name() string {
+	return "projector"
+}
+
+// Run runs the projections until ctx is done, and refreshes their lag every poll interval.
+func (p *Projector) Run(ctx context.Context) error {
+	g, ctx := group.New(ctx, group.WithZapLogger(p.logger))
+	for _, e := range p.entries {
+		e := e
+		g.Go(e.sub.Name(), func(ctx context.Context) error {
+			p.run(ctx, e)
+			return nil
+		})
+	}
+	g.Go("projection lag", func(ctx context.Context) error {
+		clk := clock.FromContext(ctx)
+		for {
+			if err := p.refresh(ctx); err != nil && ctx.Err() == nil {
+				p.logger.Warn("projection lag refresh failed", zap.Error(err))
+			}
+			select {
+			case <-clk.After(p.refreshInterval):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+	return g.Wait()
+}
+
+// run runs the subscription of e until ctx is done, retrying it after failures.
+func (p *Projector) run(ctx context.Context, e *projectorEntry) {
+	clk := clock.FromContext(ctx)
+	for {
+		err := e.sub.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		p.mu.Lock()
+		e.err, e.failedAt = err, e.sub.Position()
+		p.mu.Unlock()
+		p.logger.Error("projection failed", zap.String("projection", e.projection.Name()), zap.Error(err))
+
+		select {
+		case <-clk.After(p.retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh reads the head of the event store and updates the lag metrics.
+func (p *Projector) refresh(ctx context.Context) error {
+	head, err := p.events.Head(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.head = head
+	p.mu.Unlock()
+
+	if p.lagGauge != nil {
+		for _, s := range p.Status() {
+			p.positionGauge.WithLabelValues(s.Name).Set(float64(s.Position))
+			p.lagGauge.WithLabelValues(s.Name).Set(float64(s.Lag))
+		}
+	}
+	return nil
+}
+
+// Status returns the progress of the projections, as of the last lag refresh.
+func (p *Projector) Status() []ProjectionStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]ProjectionStatus, len(p.entries))
+	for i, e := range p.entries {
+		s := ProjectionStatus{Name: e.projection.Name(), Position: e.sub.Position(), Head: p.head}
+		if s.Head > s.Position {
+			s.Lag = s.Head - s.Position
+		}
+		_, s.Rebuildable = e.projection.(Resetter)
+		if e.err != nil && s.Position <= e.failedAt {
+			s.Error = e.err.Error()
+		}
+		status[i] = s
+	}
+	return status
+}
+
+// Rebuild resets the read model of projection name and applies all events again. the projection keeps
+// serving its old state until it is reset, which happens once it applied its current batch.
+func (p *Projector) Rebuild(name string) error {
+	e, ok := p.byName[name]
+	if !ok {
+		return errs.NotFound("projection %s not found", name)
+	}
+	if _, ok := e.projection.(Resetter); !ok {
+		return errs.New(errs.CodeFailedPrecondition, "projection %s can not be rebuilt", name)
+	}
+	p.logger.Info("projection rebuild requested", zap.String("projection", name))
+	e.sub.Rewind()
+	return nil
+}
+
+// Probe returns a readiness probe which fails while a projection is failing or more than maxLag
+// events behind, so instances serving stale read models get no traffic. zero maxLag ignores lag.
+func (p *Projector) Probe(maxLag int64) func() error {
+	return func() error {
+		for _, s := range p.Status() {
+			if s.Error != "" {
+				return fmt.Errorf("projection %s failed: %s", s.Name, s.Error)
+			}
+			if maxLag > 0 && s.Lag > maxLag {
+				return fmt.Errorf("projection %s is %d events behind", s.Name, s.Lag)
+			}
+		}
+		return nil
+	}
+}
+
+// Handler serves the status of the projections on GET / and starts rebuilds on POST /{name}/rebuild.
+// it must only be reachable by operators, like on the admin router.
+func (p *Projector) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rest.WriteJSON(w, http.StatusOK, p.Status())
+	})
+	router.Post("/{name}/rebuild", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.Rebuild(chi.URLParam(r, "name")); err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return router
+}
@@ -0,0 +1,152 @@
+package es
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+)
+
+const (
+	eventsTable = "gox_events"
+
+	// AnyVersion appends regardless of the version of the stream
+	AnyVersion int64 = -1
+	// NoStream appends only if the stream has no events yet
+	NoStream int64 = 0
+
+	// appendLockKey serializes appends, so events are committed in the order of their positions
+	appendLockKey = 0x676f785f6576 // "gox_ev"
+	// anyVersionRetries bounds the retries of AnyVersion appends losing races for the next version
+	anyVersionRetries = 10
+)
+
+// ErrVersionConflict is returned when the version of a stream is not the expected one, because an
+// other writer appended first. callers reload the stream and retry the command.
+var ErrVersionConflict = errs.Conflict("stream was changed concurrently")
+
+// Store is an append-only store of event streams, PgStore for postgres.
+type Store interface {
+	// Append appends events to stream if its version is expected, or AnyVersion, and returns the new version
+	Append(ctx context.Context, stream string, expected int64, events ...EventData) (int64, error)
+	// Load returns the events of stream after version from, in order
+	Load(ctx context.Context, stream string, from int64) ([]Event, error)
+	// ReadAll returns up to limit events of all streams after position from, in order
+	ReadAll(ctx context.Context, from int64, limit int) ([]Event, error)
+	// Head returns the position of the last event, 0 if there is none
+	Head(ctx context.Context) (int64, error)
+}
+
+// PgStore stores events in postgres.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the event store of db, creating its table if needed.
+// example:
+//
+//	events, err := es.NewPgStore(ctx, pool)
+//	data, err := registry.Marshal(OrderPlaced{OrderID: id})
+//	version, err := events.Append(ctx, "order-"+id, es.NoStream, data)
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+eventsTable+` (
+		position bigserial PRIMARY KEY,
+		stream_id text NOT NULL,
+		version bigint NOT NULL,
+		type text NOT NULL,
+		data jsonb NOT NULL,
+		metadata jsonb,
+		recorded_at timestamptz NOT NULL,
+		CONSTRAINT `+eventsTable+`_stream_version UNIQUE (stream_id, version)
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+// Append inserts the events in one statement, so they are appended all or none. it holds a
+// transaction level lock while inserting, which orders appends, so subscriptions reading by position
+// never skip events committed late. with db being a transaction the lock is held until it ends.
+// appends with AnyVersion racing another append of the stream are retried with its new version.
+func (s *PgStore) Append(ctx context.Context, stream string, expected int64, events ...EventData) (int64, error) {
+	types := make([]string, len(events))
+	data := make([]string, len(events))
+	metadata := make([]*string, len(events))
+	for i, e := range events {
+		types[i], data[i] = e.Type, string(e.Data)
+		if len(e.Metadata) > 0 {
+			m := string(e.Metadata)
+			metadata[i] = &m
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var current int64
+		err := s.db.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM "+eventsTable+" WHERE stream_id = $1", stream).Scan(&current)
+		if err != nil {
+			return 0, err
+		}
+		if expected != AnyVersion && expected != current {
+			return 0, ErrVersionConflict
+		}
+		if len(events) == 0 {
+			return current, nil
+		}
+
+		_, err = s.db.Exec(ctx, `WITH lock AS (SELECT pg_advisory_xact_lock($1))
+			INSERT INTO `+eventsTable+` (stream_id, version, type, data, metadata, recorded_at)
+			SELECT $2, $3 + e.ord, e.type, e.data::jsonb, e.metadata::jsonb, $7
+			FROM lock, unnest($4::text[], $5::text[], $6::text[]) WITH ORDINALITY AS e(type, data, metadata, ord)`,
+			appendLockKey, stream, current, types, data, metadata, clock.FromContext(ctx).Now())
+		if err == nil {
+			return current + int64(len(events)), nil
+		}
+		var perr *pgconn.PgError
+		if !errors.As(err, &perr) || perr.Code != "23505" || perr.ConstraintName != eventsTable+"_stream_version" {
+			return 0, err
+		}
+		if expected != AnyVersion || attempt >= anyVersionRetries {
+			return 0, ErrVersionConflict
+		}
+	}
+}
+
+func (s *PgStore) Load(ctx context.Context, stream string, from int64) ([]Event, error) {
+	return s.query(ctx, "SELECT position, stream_id, version, type, data, metadata, recorded_at FROM "+eventsTable+
+		" WHERE stream_id = $1 AND version > $2 ORDER BY version", stream, from)
+}
+
+func (s *PgStore) ReadAll(ctx context.Context, from int64, limit int) ([]Event, error) {
+	return s.query(ctx, "SELECT position, stream_id, version, type, data, metadata, recorded_at FROM "+eventsTable+
+		" WHERE position > $1 ORDER BY position LIMIT $2", from, limit)
+}
+
+func (s *PgStore) Head(ctx context.Context) (int64, error) {
+	var head int64
+	err := s.db.QueryRow(ctx, "SELECT coalesce(max(position), 0) FROM "+eventsTable).Scan(&head)
+	return head, err
+}
+
+func (s *PgStore) query(ctx context.Context, sql string, args ...interface{}) ([]Event, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var data, metadata []byte
+		if err := rows.Scan(&e.Position, &e.StreamID, &e.Version, &e.Type, &data, &metadata, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		e.Data, e.Metadata = data, metadata
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
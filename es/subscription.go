@@ -0,0 +1,251 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/store"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultBatchSize    = 100
+	DefaultPollInterval = time.Second
+
+	checkpointsTable = "gox_es_checkpoints"
+)
+
+// Checkpoints keeps the position subscriptions reached, PgCheckpoints for postgres.
+type Checkpoints interface {
+	// Load returns the position of subscription name, 0 if it has none
+	Load(ctx context.Context, name string) (int64, error)
+	Save(ctx context.Context, name string, position int64) error
+}
+
+// PgCheckpoints stores checkpoints in postgres. when a handler writes to the same database, passing
+// the transaction it uses to a PgCheckpoints saves the checkpoint together with its writes.
+type PgCheckpoints struct {
+	db store.Querier
+}
+
+// NewPgCheckpoints returns the checkpoints of db, creating their table if needed.
+func NewPgCheckpoints(ctx context.Context, db store.Querier) (*PgCheckpoints, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+checkpointsTable+` (
+		name text PRIMARY KEY,
+		position bigint NOT NULL,
+		updated_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgCheckpoints{db: db}, nil
+}
+
+func (c *PgCheckpoints) Load(ctx context.Context, name string) (int64, error) {
+	var position int64
+	err := c.db.QueryRow(ctx, "SELECT position FROM "+checkpointsTable+" WHERE name = $1", name).Scan(&position)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func (c *PgCheckpoints) Save(ctx context.Context, name string, position int64) error {
+	_, err := c.db.Exec(ctx, "INSERT INTO "+checkpointsTable+" (name, position, updated_at) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (name) DO UPDATE SET position = excluded.position, updated_at = excluded.updated_at",
+		name, position, clock.FromContext(ctx).Now())
+	return err
+}
+
+// Handler handles an event of a subscription, events are handled one at a time in position order.
+type Handler func(ctx context.Context, e Event) error
+
+type SubscriptionOption func(*Subscription) error
+
+// WithBatchSize sets how many events are read at once, the checkpoint is saved after each batch.
+func WithBatchSize(n int) SubscriptionOption {
+	return func(s *Subscription) error {
+		if n <= 0 {
+			return errors.New("batch size must be positive")
+		}
+		s.batchSize = n
+		return nil
+	}
+}
+
+// WithPollInterval sets how long the subscription waits for new events once it caught up.
+func WithPollInterval(d time.Duration) SubscriptionOption {
+	return func(s *Subscription) error {
+		s.pollInterval = d
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) SubscriptionOption {
+	return func(s *Subscription) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// Subscription feeds the events of all streams to a handler, starting after its checkpoint. delivery
+// is at least once: events handled after the last saved checkpoint are handled again after a restart,
+// so handlers must be idempotent.
+type Subscription struct {
+	name        string
+	events      Store
+	checkpoints Checkpoints
+	handler     Handler
+
+	batchSize    int
+	pollInterval time.Duration
+	logger       *zap.Logger
+
+	position int64
+	rewind   chan struct{}
+	// reset clears what the handler built before the subscription is rewound
+	reset func(ctx context.Context) error
+}
+
+// NewSubscription returns a subscription called name, which is the key of its checkpoint. it is a
+// gox.Component to add to the Runner.
+// example:
+//
+//	sub, err := es.NewSubscription("emails", events, checkpoints, func(ctx context.Context, e es.Event) error {
+//		if e.Type != "order.placed" {
+//			return nil
+//		}
+//		placed, err := es.Decode[OrderPlaced](e)
+//		...
+//	})
+func NewSubscription(name string, events Store, checkpoints Checkpoints, handler Handler, options ...SubscriptionOption) (*Subscription, error) {
+	s := &Subscription{
+		name:         name,
+		events:       events,
+		checkpoints:  checkpoints,
+		handler:      handler,
+		batchSize:    DefaultBatchSize,
+		pollInterval: DefaultPollInterval,
+		logger:       zap.NewNop(),
+		rewind:       make(chan struct{}, 1),
+	}
+	for _, o := range options {
+		if err := o(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Position returns the position of the last handled event.
+func (s *Subscription) Position() int64 {
+	return atomic.LoadInt64(&s.position)
+}
+
+// Rewind makes the subscription handle all events again from the first one, once it handled the
+// current batch or when it runs next.
+func (s *Subscription) Rewind() {
+	select {
+	case s.rewind <- struct{}{}:
+	default:
+	}
+}
+
+// Run handles events until ctx is done. it returns the error of a failing handler, the event is
+// handled again when the subscription runs next.
+func (s *Subscription) Run(ctx context.Context) error {
+	position, err := s.checkpoints.Load(ctx, s.name)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&s.position, position)
+	s.logger.Info("subscription started", zap.String("subscription", s.name), zap.Int64("position", position))
+
+	clk := clock.FromContext(ctx)
+	for {
+		select {
+		case <-s.rewind:
+			if err := s.rewindTo(ctx, &position); err != nil {
+				return err
+			}
+		default:
+		}
+
+		n, err := s.poll(ctx, &position)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if n == s.batchSize {
+			continue
+		}
+
+		select {
+		case <-clk.After(s.pollInterval):
+		case <-s.rewind:
+			if err := s.rewindTo(ctx, &position); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// rewindTo resets the handler and the checkpoint to the first event.
+func (s *Subscription) rewindTo(ctx context.Context, position *int64) error {
+	if s.reset != nil {
+		if err := s.reset(ctx); err != nil {
+			// keep the request, so the next run tries again
+			s.Rewind()
+			return err
+		}
+	}
+	if err := s.checkpoints.Save(ctx, s.name, 0); err != nil {
+		s.Rewind()
+		return err
+	}
+	s.logger.Info("subscription rewound", zap.String("subscription", s.name), zap.Int64("from", *position))
+	*position = 0
+	atomic.StoreInt64(&s.position, 0)
+	return nil
+}
+
+// poll handles the next batch of events after position and saves the checkpoint of the handled ones.
+func (s *Subscription) poll(ctx context.Context, position *int64) (int, error) {
+	events, err := s.events.ReadAll(ctx, *position, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	start := *position
+	for _, e := range events {
+		if err := s.handler(ctx, e); err != nil {
+			s.logger.Error("subscription handler failed", zap.String("subscription", s.name),
+				zap.Int64("position", e.Position), zap.String("type", e.Type), zap.Error(err))
+			if *position > start {
+				_ = s.checkpoints.Save(ctx, s.name, *position)
+			}
+			return 0, err
+		}
+		*position = e.Position
+		atomic.StoreInt64(&s.position, e.Position)
+	}
+
+	if *position > start {
+		if err := s.checkpoints.Save(ctx, s.name, *position); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
@@ -0,0 +1,56 @@
+package flags
+
+import (
+	"context"
+
+	"github.com/mirzakhany/gox/ctxutil"
+)
+
+// Provider tells whether a feature is enabled, ctx carries what the decision may depend on, like the
+// user or tenant of the request.
+type Provider interface {
+	Enabled(ctx context.Context, name string) bool
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context, name string) bool
+
+func (f ProviderFunc) Enabled(ctx context.Context, name string) bool {
+	return f(ctx, name)
+}
+
+// Static is a Provider with fixed flags, features not in the map are disabled.
+type Static map[string]bool
+
+func (s Static) Enabled(_ context.Context, name string) bool {
+	return s[name]
+}
+
+var overridesKey = ctxutil.NewKey[map[string]bool]("feature overrides")
+
+// WithOverrides returns a copy of ctx holding overrides, which win over the provider wrapped by Overlay.
+func WithOverrides(ctx context.Context, overrides map[string]bool) context.Context {
+	return overridesKey.Set(ctx, overrides)
+}
+
+// OverridesFrom returns the overrides stored in ctx.
+func OverridesFrom(ctx context.Context) map[string]bool {
+	overrides, _ := overridesKey.Get(ctx)
+	return overrides
+}
+
+// Overlay returns a provider answering from the overrides of ctx first, then from p.
+// example:
+//
+//	features := flags.Overlay(flags.Static{"new-checkout": false})
+//	router.Use(flags.Middleware(secret, logger))
+//	...
+//	if features.Enabled(r.Context(), "new-checkout") {
+func Overlay(p Provider) Provider {
+	return ProviderFunc(func(ctx context.Context, name string) bool {
+		if v, ok := OverridesFrom(ctx)[name]; ok {
+			return v
+		}
+		return p.Enabled(ctx, name)
+	})
+}
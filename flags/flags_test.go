@@ -0,0 +1,53 @@
+package flags
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverrides(t *testing.T) {
+	secret := []byte("secret")
+	features := Overlay(Static{"new-checkout": false, "search": true})
+
+	var checkout, search bool
+	handler := Middleware(secret, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkout = features.Enabled(r.Context(), "new-checkout")
+		search = features.Enabled(r.Context(), "search")
+	}))
+	serve := func(value string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if value != "" {
+			r.Header.Set(OverridesHeader, value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	{ // without header the provider decides
+		serve("")
+		require.False(t, checkout)
+		require.True(t, search)
+	}
+
+	{ // signed overrides win
+		serve(SignOverrides(secret, map[string]bool{"new-checkout": true, "search": false}, time.Now().Add(time.Minute)))
+		require.True(t, checkout)
+		require.False(t, search)
+	}
+
+	{ // tampered overrides are ignored
+		value := SignOverrides(secret, map[string]bool{"new-checkout": false}, time.Now().Add(time.Minute))
+		serve("new-checkout=true" + value[len("new-checkout=false"):])
+		require.False(t, checkout)
+	}
+
+	{ // expired and foreign overrides are rejected
+		_, err := ParseOverrides(secret, SignOverrides(secret, map[string]bool{"a": true}, time.Now().Add(-time.Minute)))
+		require.ErrorIs(t, err, ErrOverridesExpired)
+		_, err = ParseOverrides(secret, SignOverrides([]byte("other"), map[string]bool{"a": true}, time.Now().Add(time.Minute)))
+		require.ErrorIs(t, err, ErrOverridesInvalid)
+	}
+}
@@ -0,0 +1,110 @@
+package flags
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// OverridesHeader carries signed overrides, like "new-checkout=true,beta-search=false;expires=1700000000;sig=...".
+const OverridesHeader = "X-Feature-Overrides"
+
+var (
+	ErrOverridesInvalid = errors.New("feature overrides are malformed or their signature is invalid")
+	ErrOverridesExpired = errors.New("feature overrides have expired")
+)
+
+// SignOverrides returns the value of OverridesHeader for overrides, signed with an HMAC-SHA256 of secret
+// so only callers holding it, like canary test runners, can change features of production requests.
+func SignOverrides(secret []byte, overrides map[string]bool, expiresAt time.Time) string {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.FormatBool(overrides[name])
+	}
+
+	payload := strings.Join(pairs, ",") + ";expires=" + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + ";sig=" + signOverrides(secret, payload)
+}
+
+// ParseOverrides verifies a value created by SignOverrides and returns its overrides.
+func ParseOverrides(secret []byte, value string) (map[string]bool, error) {
+	i := strings.LastIndex(value, ";sig=")
+	if i < 0 {
+		return nil, ErrOverridesInvalid
+	}
+	payload, signature := value[:i], value[i+len(";sig="):]
+	if !hmac.Equal([]byte(signature), []byte(signOverrides(secret, payload))) {
+		return nil, ErrOverridesInvalid
+	}
+
+	j := strings.LastIndex(payload, ";expires=")
+	if j < 0 {
+		return nil, ErrOverridesInvalid
+	}
+	expiresAt, err := strconv.ParseInt(payload[j+len(";expires="):], 10, 64)
+	if err != nil {
+		return nil, ErrOverridesInvalid
+	}
+	if time.Now().Unix() > expiresAt {
+		return nil, ErrOverridesExpired
+	}
+
+	overrides := make(map[string]bool)
+	if payload[:j] == "" {
+		return overrides, nil
+	}
+	for _, pair := range strings.Split(payload[:j], ",") {
+		name, v, ok := strings.Cut(pair, "=")
+		enabled, err := strconv.ParseBool(v)
+		if !ok || err != nil {
+			return nil, ErrOverridesInvalid
+		}
+		overrides[name] = enabled
+	}
+	return overrides, nil
+}
+
+// Middleware applies the overrides of OverridesHeader to the request context, see Overlay. requests
+// without a valid signature are served without overrides, and the header is logged as a warning.
+func Middleware(secret []byte, logger *zap.Logger) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(OverridesHeader)
+			if value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			overrides, err := ParseOverrides(secret, value)
+			if err != nil {
+				logger.Warn("feature overrides ignored", zap.Error(err), zap.String("remote_addr", r.RemoteAddr))
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithOverrides(r.Context(), overrides)))
+		})
+	}
+}
+
+func signOverrides(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
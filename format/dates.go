@@ -0,0 +1,60 @@
+package format
+
+import "golang.org/x/text/language"
+
+// dateLayouts are go time layouts for short numeric dates. go can only print english month names,
+// so only numeric layouts are used.
+type dateLayouts struct {
+	date string
+	time string
+}
+
+var (
+	isoLayouts = dateLayouts{date: "2006-01-02", time: "15:04"}
+
+	// english formats differ a lot between regions, so they take precedence over the language one
+	englishLayouts = map[string]dateLayouts{
+		"US": {date: "1/2/2006", time: "3:04 PM"},
+		"GB": {date: "02/01/2006", time: "15:04"},
+		"IE": {date: "2/1/2006", time: "15:04"},
+		"CA": {date: "2006-01-02", time: "3:04 PM"},
+		"AU": {date: "2/01/2006", time: "3:04 PM"},
+		"NZ": {date: "2/01/2006", time: "3:04 PM"},
+		"IN": {date: "2/1/2006", time: "3:04 PM"},
+	}
+
+	languageLayouts = map[string]dateLayouts{
+		"en": {date: "1/2/2006", time: "3:04 PM"},
+		"de": {date: "02.01.2006", time: "15:04"},
+		"fr": {date: "02/01/2006", time: "15:04"},
+		"es": {date: "2/1/2006", time: "15:04"},
+		"it": {date: "02/01/2006", time: "15:04"},
+		"pt": {date: "02/01/2006", time: "15:04"},
+		"nl": {date: "2-1-2006", time: "15:04"},
+		"ru": {date: "02.01.2006", time: "15:04"},
+		"pl": {date: "2.01.2006", time: "15:04"},
+		"tr": {date: "2.01.2006", time: "15:04"},
+		"sv": {date: "2006-01-02", time: "15:04"},
+		"ja": {date: "2006/01/02", time: "15:04"},
+		"zh": {date: "2006/1/2", time: "15:04"},
+		"ko": {date: "2006. 1. 2.", time: "PM 3:04"},
+		"fa": {date: "2006/1/2", time: "15:04"},
+		"ar": {date: "2/1/2006", time: "3:04 PM"},
+	}
+)
+
+func layoutsFor(tag language.Tag) dateLayouts {
+	base, _ := tag.Base()
+	if base.String() == "en" {
+		if region, confidence := tag.Region(); confidence == language.Exact {
+			if l, ok := englishLayouts[region.String()]; ok {
+				return l
+			}
+		}
+	}
+
+	if l, ok := languageLayouts[base.String()]; ok {
+		return l
+	}
+	return isoLayouts
+}
@@ -0,0 +1,114 @@
+package format
+
+import (
+	"html/template"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Formatter formats numbers, currencies and dates for a locale. number and currency formats come
+// from the CLDR data of golang.org/x/text.
+type Formatter struct {
+	tag     language.Tag
+	printer *message.Printer
+	dates   dateLayouts
+}
+
+// New returns a Formatter for locale, like "en-US" or "de". unknown locales fall back to English.
+func New(locale string) Formatter {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.English
+	}
+	return newFormatter(tag)
+}
+
+// FromAcceptLanguage returns a Formatter for the best match of an Accept-Language header among supported
+// locales, the first supported locale is used when nothing matches.
+// example:
+//
+//	f := format.FromAcceptLanguage(r.Header.Get("Accept-Language"), "en-US", "de-DE", "fa-IR")
+func FromAcceptLanguage(header string, supported ...string) Formatter {
+	if len(supported) == 0 {
+		supported = []string{"en"}
+	}
+
+	tags := make([]language.Tag, 0, len(supported))
+	for _, s := range supported {
+		tags = append(tags, language.Make(s))
+	}
+
+	desired, _, _ := language.ParseAcceptLanguage(header)
+	_, i, _ := language.NewMatcher(tags).Match(desired...)
+	return newFormatter(tags[i])
+}
+
+func newFormatter(tag language.Tag) Formatter {
+	return Formatter{tag: tag, printer: message.NewPrinter(tag), dates: layoutsFor(tag)}
+}
+
+// Locale returns the BCP 47 tag of the formatter.
+func (f Formatter) Locale() string {
+	return f.tag.String()
+}
+
+// Number formats v, which can be any integer or float, with locale grouping and decimal separators.
+func (f Formatter) Number(v interface{}) string {
+	return f.printer.Sprint(number.Decimal(v))
+}
+
+// Decimal formats v with exactly scale fraction digits.
+func (f Formatter) Decimal(v interface{}, scale int) string {
+	return f.printer.Sprint(number.Decimal(v, number.Scale(scale)))
+}
+
+// Percent formats v as a percentage, 0.25 is formatted as 25%.
+func (f Formatter) Percent(v interface{}) string {
+	return f.printer.Sprint(number.Percent(v))
+}
+
+// Currency formats amount in the currency with ISO 4217 code, like "USD". the code itself is used
+// instead of the symbol if it is unknown.
+func (f Formatter) Currency(amount interface{}, code string) string {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return code + " " + f.Number(amount)
+	}
+	return f.printer.Sprint(currency.Symbol(unit.Amount(amount)))
+}
+
+// Date formats t as a short date in the locale order, like 1/2/2006 for en-US and 02.01.2006 for de.
+func (f Formatter) Date(t time.Time) string {
+	return t.Format(f.dates.date)
+}
+
+// DateTime formats t as a short date and time.
+func (f Formatter) DateTime(t time.Time) string {
+	return t.Format(f.dates.date + " " + f.dates.time)
+}
+
+// Time formats the time of day of t.
+func (f Formatter) Time(t time.Time) string {
+	return t.Format(f.dates.time)
+}
+
+// FuncMap returns the formatting functions to be used in templates.
+// example:
+//
+//	tmpl := template.New("invoice").Funcs(format.New("de").FuncMap())
+//	// {{ currency .Total "EUR" }} {{ date .IssuedAt }}
+func (f Formatter) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"number":   f.Number,
+		"decimal":  f.Decimal,
+		"percent":  f.Percent,
+		"currency": f.Currency,
+		"date":     f.Date,
+		"datetime": f.DateTime,
+		"time":     f.Time,
+	}
+}
@@ -0,0 +1,53 @@
+package format
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatter(t *testing.T) {
+	date := time.Date(2022, 3, 4, 15, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		locale   string
+		number   string
+		currency string
+		date     string
+		datetime string
+	}{
+		{locale: "en-US", number: "1,234,567.891", currency: "€ 1,234.50", date: "3/4/2022", datetime: "3/4/2022 3:30 PM"},
+		{locale: "en-GB", number: "1,234,567.891", currency: "€ 1,234.50", date: "04/03/2022", datetime: "04/03/2022 15:30"},
+		{locale: "de-DE", number: "1.234.567,891", currency: "€ 1.234,50", date: "04.03.2022", datetime: "04.03.2022 15:30"},
+		{locale: "invalid locale", number: "1,234,567.891", currency: "€ 1,234.50", date: "3/4/2022", datetime: "3/4/2022 3:30 PM"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.locale, func(t *testing.T) {
+			f := New(c.locale)
+			require.Equal(t, c.number, f.Number(1234567.891))
+			require.Equal(t, c.currency, f.Currency(1234.5, "EUR"))
+			require.Equal(t, c.date, f.Date(date))
+			require.Equal(t, c.datetime, f.DateTime(date))
+		})
+	}
+
+	require.Equal(t, "XYZ 10", New("en").Currency(10, "XYZ"))
+	require.Equal(t, "26%", New("en").Percent(0.256))
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	require.Equal(t, "de-DE", FromAcceptLanguage("de-CH;q=0.9, fr;q=0.8", "en-US", "de-DE").Locale())
+	require.Equal(t, "en-US", FromAcceptLanguage("ja", "en-US", "de-DE").Locale())
+}
+
+func TestFuncMap(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(New("de").FuncMap()).Parse(`{{ currency .Total "EUR" }} {{ decimal .Rate 2 }}`))
+
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.Execute(&buf, map[string]interface{}{"Total": 1500, "Rate": 0.5}))
+	require.Equal(t, "€ 1.500,00 0,50", buf.String())
+}
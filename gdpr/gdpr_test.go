@@ -0,0 +1,206 @@
+package gdpr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu   sync.Mutex
+	reqs map[string]Request
+}
+
+func (s *memoryStore) Create(_ context.Context, req *Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs[req.ID] = *req
+	return nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, req *Request) error {
+	return s.Create(ctx, req)
+}
+
+func (s *memoryStore) Get(_ context.Context, id string) (*Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.reqs[id]
+	if !ok {
+		return nil, errs.NotFound("request not found")
+	}
+	return &req, nil
+}
+
+func (s *memoryStore) List(_ context.Context, subject string) ([]*Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reqs []*Request
+	for _, req := range s.reqs {
+		if req.Subject == subject {
+			req := req
+			reqs = append(reqs, &req)
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].CreatedAt.After(reqs[j].CreatedAt) })
+	return reqs, nil
+}
+
+type memoryBucket struct {
+	objects map[string]string
+}
+
+func (b *memoryBucket) List(context.Context, string) ([]string, error) { return nil, nil }
+
+func (b *memoryBucket) Get(_ context.Context, key string) (io.ReadCloser, string, error) {
+	return io.NopCloser(strings.NewReader(b.objects[key])), "application/json", nil
+}
+
+func (b *memoryBucket) Put(_ context.Context, key string, body io.Reader, _ int64, _ string) error {
+	v, err := io.ReadAll(body)
+	b.objects[key] = string(v)
+	return err
+}
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{}
+	noop := func(context.Context, string) error { return nil }
+
+	require.Error(t, r.Register(Owner{Name: "orders"}))
+	require.Error(t, r.Register(Owner{Name: "orders", Erase: noop}), "erasures must be verifiable")
+	require.NoError(t, r.Register(Owner{Name: "orders", Erase: noop, Count: func(context.Context, string) (int64, error) { return 0, nil }}))
+	require.Error(t, r.Register(Owner{Name: "orders", Erase: noop, Count: func(context.Context, string) (int64, error) { return 0, nil }}))
+	require.Len(t, r.Owners(), 1)
+}
+
+func TestProcessor(t *testing.T) {
+	users := map[string]string{"u1": "ann@example.com"}
+	comments := map[string]int{"u1": 2}
+	var mu sync.Mutex
+
+	r := &Registry{}
+	require.NoError(t, r.Register(Owner{
+		Name: "users",
+		Export: func(_ context.Context, subject string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return map[string]string{"email": users[subject]}, nil
+		},
+		Erase: func(_ context.Context, subject string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(users, subject)
+			return nil
+		},
+		Count: func(_ context.Context, subject string) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := users[subject]; ok {
+				return 1, nil
+			}
+			return 0, nil
+		},
+	}))
+	require.NoError(t, r.Register(Owner{
+		Name: "comments",
+		// erasing comments silently misses some
+		Erase: func(context.Context, string) error { return nil },
+		Count: func(_ context.Context, subject string) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return int64(comments[subject]), nil
+		},
+	}))
+
+	requests := &memoryStore{reqs: map[string]Request{}}
+	bucket := &memoryBucket{objects: map[string]string{}}
+	p, err := NewProcessor(requests, bucket, WithRegistry(r), WithAuthorizer(func(r *http.Request) error {
+		meta, _ := rest.RequestMetaFrom(r.Context())
+		if meta == nil || meta.UserID != "dpo" {
+			return errors.New("data protection officers only")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+
+	handler := p.Handler()
+	do := func(method, path string, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(rest.WithRequestMetaContext(req.Context(), &rest.RequestMeta{UserID: user}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	{ // only authorized users can run requests
+		w := do(http.MethodPost, "/subjects/u1/export", "u1")
+		require.Equal(t, http.StatusForbidden, w.Code)
+	}
+
+	{ // processors without an authorizer deny every request
+		open, err := NewProcessor(requests, bucket, WithRegistry(r))
+		require.NoError(t, err)
+		for _, path := range []string{"/subjects/u1/export", "/subjects/u1/erasure"} {
+			w := httptest.NewRecorder()
+			open.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+			require.Equal(t, http.StatusForbidden, w.Code)
+		}
+		require.Empty(t, bucket.objects)
+	}
+
+	{ // exports are stored in the bucket
+		w := do(http.MethodPost, "/subjects/u1/export", "dpo")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var req Request
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&req))
+		require.Equal(t, StateCompleted, req.State)
+		require.Equal(t, "dpo", req.RequestedBy)
+		require.Equal(t, DefaultKeyPrefix+req.ID+".json", req.Key)
+
+		var doc struct {
+			Subject string                       `json:"subject"`
+			Data    map[string]map[string]string `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(bucket.objects[req.Key]), &doc))
+		require.Equal(t, "u1", doc.Subject)
+		require.Equal(t, "ann@example.com", doc.Data["users"]["email"])
+		require.NotContains(t, doc.Data, "comments")
+	}
+
+	{ // erasures are verified, remaining records fail the request
+		w := do(http.MethodPost, "/subjects/u1/erasure", "dpo")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var req Request
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&req))
+		require.Equal(t, StateFailed, req.State)
+		require.Equal(t, []OwnerResult{
+			{Owner: "users"},
+			{Owner: "comments", Remaining: 2, Error: ErrErasureUnverified.Error()},
+		}, req.Results)
+		require.NotContains(t, users, "u1")
+	}
+
+	{ // the requests of a subject are its audit trail
+		w := do(http.MethodGet, "/subjects/u1/requests", "dpo")
+		require.Equal(t, http.StatusOK, w.Code)
+		var reqs []Request
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&reqs))
+		require.Len(t, reqs, 2)
+
+		w = do(http.MethodGet, "/requests/"+reqs[0].ID, "dpo")
+		require.Equal(t, http.StatusOK, w.Code)
+		w = do(http.MethodGet, "/requests/missing", "dpo")
+		require.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
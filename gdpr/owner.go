@@ -0,0 +1,99 @@
+package gdpr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/store"
+)
+
+// Owner describes the data an entity keeps about subjects, like the orders of a user, and how to
+// export and erase it.
+type Owner struct {
+	Name string
+	// Export returns the data of subject, it is marshaled to json
+	Export func(ctx context.Context, subject string) (interface{}, error)
+	// Erase deletes or anonymizes the data of subject
+	Erase func(ctx context.Context, subject string) error
+	// Count returns the number of records of subject, erasures are verified with it
+	Count func(ctx context.Context, subject string) (int64, error)
+}
+
+// Registry holds the owners of subject data, DefaultRegistry unless set otherwise.
+type Registry struct {
+	mu     sync.RWMutex
+	owners []Owner
+}
+
+// DefaultRegistry is where Register adds owners.
+var DefaultRegistry = &Registry{}
+
+// Register adds an owner to the DefaultRegistry, like in the init function of the package of an entity.
+// example:
+//
+//	func init() {
+//		gdpr.Register(gdpr.TableOwner(pool, "orders", "user_id"))
+//	}
+func Register(o Owner) {
+	if err := DefaultRegistry.Register(o); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds an owner. erasable owners must be countable, so erasures can be verified.
+func (r *Registry) Register(o Owner) error {
+	switch {
+	case o.Name == "":
+		return errors.New("gdpr: owner name is required")
+	case o.Export == nil && o.Erase == nil:
+		return fmt.Errorf("gdpr: owner %s can neither export nor erase", o.Name)
+	case o.Erase != nil && o.Count == nil:
+		return fmt.Errorf("gdpr: owner %s must count records to verify erasures", o.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.owners {
+		if other.Name == o.Name {
+			return fmt.Errorf("gdpr: owner %s is already registered", o.Name)
+		}
+	}
+	r.owners = append(r.owners, o)
+	return nil
+}
+
+// Owners returns the owners in registration order.
+func (r *Registry) Owners() []Owner {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Owner(nil), r.owners...)
+}
+
+// TableOwner returns an owner of the rows of table whose column is the subject id. rows are exported
+// as json objects and erased by deleting them.
+func TableOwner(db store.Querier, table, column string) Owner {
+	t := pgx.Identifier(strings.Split(table, ".")).Sanitize()
+	c := pgx.Identifier{column}.Sanitize()
+	return Owner{
+		Name: table,
+		Export: func(ctx context.Context, subject string) (interface{}, error) {
+			var rows []byte
+			err := db.QueryRow(ctx, "SELECT coalesce(json_agg(t), '[]') FROM "+t+" t WHERE "+c+" = $1", subject).Scan(&rows)
+			return json.RawMessage(rows), err
+		},
+		Erase: func(ctx context.Context, subject string) error {
+			_, err := db.Exec(ctx, "DELETE FROM "+t+" WHERE "+c+" = $1", subject)
+			return err
+		},
+		Count: func(ctx context.Context, subject string) (int64, error) {
+			var n int64
+			err := db.QueryRow(ctx, "SELECT count(*) FROM "+t+" WHERE "+c+" = $1", subject).Scan(&n)
+			return n, err
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package gdpr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/blob"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"go.uber.org/zap"
+)
+
+// DefaultKeyPrefix is where exports are stored in the bucket.
+const DefaultKeyPrefix = "gdpr/exports/"
+
+// ErrErasureUnverified is the error of an owner which still has records of the subject after erasing them.
+var ErrErasureUnverified = errors.New("records remain after erasure")
+
+// Authorizer decides whether the request may use the endpoints of the processor, a returned error is
+// written with status 403 unless it carries its own code, see errs.CodeOf.
+type Authorizer func(r *http.Request) error
+
+type Option func(*Processor) error
+
+// WithRegistry sets the owners of subject data, DefaultRegistry by default.
+func WithRegistry(r *Registry) Option {
+	return func(p *Processor) error {
+		p.registry = r
+		return nil
+	}
+}
+
+// WithKeyPrefix sets where exports are stored in the bucket, DefaultKeyPrefix by default.
+func WithKeyPrefix(prefix string) Option {
+	return func(p *Processor) error {
+		p.keyPrefix = prefix
+		return nil
+	}
+}
+
+// WithAuthorizer is called for every request of the handler before it is handled. without it the
+// handler denies every request.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(p *Processor) error {
+		p.authorize = authorize
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(p *Processor) error {
+		p.logger = logger
+		return nil
+	}
+}
+
+// Processor runs data subject requests over the registered owners and records them in a Store.
+type Processor struct {
+	requests  Store
+	bucket    blob.Bucket
+	registry  *Registry
+	keyPrefix string
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewProcessor returns a processor recording requests in requests and storing exports in bucket.
+// example:
+//
+//	requests, err := gdpr.NewPgStore(ctx, pool)
+//	processor, err := gdpr.NewProcessor(requests, s3, gdpr.WithAuthorizer(requireRole("dpo")),
+//		gdpr.WithZapLogger(logger))
+//	adminRouter.Mount("/gdpr", processor.Handler())
+func NewProcessor(requests Store, bucket blob.Bucket, options ...Option) (*Processor, error) {
+	p := &Processor{
+		requests:  requests,
+		bucket:    bucket,
+		registry:  DefaultRegistry,
+		keyPrefix: DefaultKeyPrefix,
+		logger:    zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Export collects the data of subject from all owners into one json document, stores it in the bucket
+// and returns the completed request. the request is recorded as failed if an owner fails.
+func (p *Processor) Export(ctx context.Context, subject string) (*Request, error) {
+	req, err := p.start(ctx, KindExport, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{}
+	for _, o := range p.registry.Owners() {
+		if o.Export == nil {
+			continue
+		}
+		res := OwnerResult{Owner: o.Name}
+		v, err := o.Export(ctx, subject)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		data[o.Name] = v
+		req.Results = append(req.Results, res)
+	}
+
+	if !failed(req) {
+		doc, err := json.MarshalIndent(map[string]interface{}{
+			"subject":     subject,
+			"exported_at": clock.FromContext(ctx).Now().UTC(),
+			"data":        data,
+		}, "", "  ")
+		if err == nil {
+			req.Key = p.keyPrefix + req.ID + ".json"
+			err = p.bucket.Put(ctx, req.Key, bytes.NewReader(doc), int64(len(doc)), "application/json")
+		}
+		if err != nil {
+			req.Key = ""
+			req.Results = append(req.Results, OwnerResult{Owner: "export", Error: err.Error()})
+		}
+	}
+	return req, p.finish(ctx, req)
+}
+
+// Erase erases the data of subject with all owners and verifies no records remain. owners are erased
+// in registration order and one failing does not stop the others, the request is recorded as failed
+// if any owner failed or still has records.
+func (p *Processor) Erase(ctx context.Context, subject string) (*Request, error) {
+	req, err := p.start(ctx, KindErasure, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range p.registry.Owners() {
+		if o.Erase == nil {
+			continue
+		}
+		res := OwnerResult{Owner: o.Name}
+		err := o.Erase(ctx, subject)
+		if err == nil {
+			res.Remaining, err = o.Count(ctx, subject)
+		}
+		if err == nil && res.Remaining > 0 {
+			err = ErrErasureUnverified
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		req.Results = append(req.Results, res)
+	}
+	return req, p.finish(ctx, req)
+}
+
+func (p *Processor) start(ctx context.Context, kind Kind, subject string) (*Request, error) {
+	if subject == "" {
+		return nil, errs.Invalid("subject is required")
+	}
+	req := &Request{
+		ID:        newID(),
+		Kind:      kind,
+		Subject:   subject,
+		State:     StateRunning,
+		Results:   []OwnerResult{},
+		CreatedAt: clock.FromContext(ctx).Now(),
+	}
+	if meta, ok := rest.RequestMetaFrom(ctx); ok {
+		req.RequestedBy = meta.UserID
+	}
+	if err := p.requests.Create(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// finish records the outcome of req, which is the audit entry of the request.
+func (p *Processor) finish(ctx context.Context, req *Request) error {
+	now := clock.FromContext(ctx).Now()
+	req.CompletedAt = &now
+	req.State = StateCompleted
+	if failed(req) {
+		req.State = StateFailed
+	}
+
+	fields := []zap.Field{zap.String("id", req.ID), zap.String("kind", string(req.Kind)), zap.String("subject", req.Subject),
+		zap.String("requested_by", req.RequestedBy), zap.String("state", string(req.State)), zap.Any("results", req.Results)}
+	if req.State == StateFailed {
+		p.logger.Error("data subject request failed", fields...)
+	} else {
+		p.logger.Info("data subject request completed", fields...)
+	}
+	return p.requests.Update(ctx, req)
+}
+
+func failed(req *Request) bool {
+	for _, r := range req.Results {
+		if r.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler serves the admin endpoints of data subject requests:
+//
+//	POST /subjects/{subject}/export   exports the data of subject
+//	POST /subjects/{subject}/erasure  erases the data of subject
+//	GET  /subjects/{subject}/requests lists the requests of subject
+//	GET  /requests/{id}               returns a request
+//
+// export and erasure answer with the recorded request, whose state tells whether it failed. every
+// request is denied unless the processor has an authorizer, see WithAuthorizer.
+func (p *Processor) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Use(p.authorized)
+	router.Post("/subjects/{subject}/export", p.run(p.Export))
+	router.Post("/subjects/{subject}/erasure", p.run(p.Erase))
+	router.Get("/subjects/{subject}/requests", func(w http.ResponseWriter, r *http.Request) {
+		reqs, err := p.requests.List(r.Context(), chi.URLParam(r, "subject"))
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		if reqs == nil {
+			reqs = []*Request{}
+		}
+		rest.WriteJSON(w, http.StatusOK, reqs)
+	})
+	router.Get("/requests/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, err := p.requests.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		rest.WriteJSON(w, http.StatusOK, req)
+	})
+	return router
+}
+
+func (p *Processor) run(fn func(ctx context.Context, subject string) (*Request, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := fn(r.Context(), chi.URLParam(r, "subject"))
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		rest.WriteJSON(w, http.StatusCreated, req)
+	}
+}
+
+func (p *Processor) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.authorize == nil {
+			rest.WriteErr(w, errs.Forbidden("gdpr processor has no authorizer"))
+			return
+		}
+		if err := p.authorize(r); err != nil {
+			if errs.CodeOf(err) == errs.CodeUnknown {
+				err = errs.WithCode(err, errs.CodePermissionDenied)
+			}
+			rest.WriteErr(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
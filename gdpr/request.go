@@ -0,0 +1,142 @@
+package gdpr
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+)
+
+const requestsTable = "gox_gdpr_requests"
+
+type Kind string
+
+const (
+	KindExport  Kind = "export"
+	KindErasure Kind = "erasure"
+)
+
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+)
+
+// OwnerResult is the outcome of a request for one owner.
+type OwnerResult struct {
+	Owner string `json:"owner"`
+	// Remaining is the number of records left after an erasure, which must be zero
+	Remaining int64  `json:"remaining"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Request is a data subject request, the requests of a subject are the audit trail of how its data
+// was exported and erased.
+type Request struct {
+	ID          string `json:"id"`
+	Kind        Kind   `json:"kind"`
+	Subject     string `json:"subject"`
+	State       State  `json:"state"`
+	RequestedBy string `json:"requested_by"`
+	// Key is the blob key of the export
+	Key         string        `json:"key,omitempty"`
+	Results     []OwnerResult `json:"results"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+}
+
+// Store keeps requests, PgStore for postgres.
+type Store interface {
+	Create(ctx context.Context, req *Request) error
+	Update(ctx context.Context, req *Request) error
+	Get(ctx context.Context, id string) (*Request, error)
+	// List returns the requests of subject, newest first
+	List(ctx context.Context, subject string) ([]*Request, error)
+}
+
+// PgStore stores requests in postgres.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the requests of db, creating their table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+requestsTable+` (
+		id text PRIMARY KEY,
+		kind text NOT NULL,
+		subject text NOT NULL,
+		state text NOT NULL,
+		requested_by text NOT NULL,
+		key text NOT NULL DEFAULT '',
+		results jsonb NOT NULL,
+		created_at timestamptz NOT NULL,
+		completed_at timestamptz
+	);
+	CREATE INDEX IF NOT EXISTS `+requestsTable+`_subject ON `+requestsTable+` (subject, created_at)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+func (s *PgStore) Create(ctx context.Context, req *Request) error {
+	results, err := json.Marshal(req.Results)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, "INSERT INTO "+requestsTable+" (id, kind, subject, state, requested_by, key, results, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		req.ID, req.Kind, req.Subject, req.State, req.RequestedBy, req.Key, string(results), req.CreatedAt)
+	return err
+}
+
+// Update stores the state, key, results and completion time of req.
+func (s *PgStore) Update(ctx context.Context, req *Request) error {
+	results, err := json.Marshal(req.Results)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, "UPDATE "+requestsTable+" SET state = $2, key = $3, results = $4, completed_at = $5 WHERE id = $1",
+		req.ID, req.State, req.Key, string(results), req.CompletedAt)
+	return err
+}
+
+func (s *PgStore) Get(ctx context.Context, id string) (*Request, error) {
+	reqs, err := s.query(ctx, "WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(reqs) == 0 {
+		return nil, errs.NotFound("request not found")
+	}
+	return reqs[0], nil
+}
+
+func (s *PgStore) List(ctx context.Context, subject string) ([]*Request, error) {
+	return s.query(ctx, "WHERE subject = $1 ORDER BY created_at DESC", subject)
+}
+
+func (s *PgStore) query(ctx context.Context, where string, args ...interface{}) ([]*Request, error) {
+	rows, err := s.db.Query(ctx, "SELECT id, kind, subject, state, requested_by, key, results, created_at, completed_at FROM "+requestsTable+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []*Request
+	for rows.Next() {
+		var req Request
+		var results []byte
+		if err := rows.Scan(&req.ID, &req.Kind, &req.Subject, &req.State, &req.RequestedBy, &req.Key, &results, &req.CreatedAt, &req.CompletedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(results, &req.Results); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, &req)
+	}
+	return reqs, rows.Err()
+}
@@ -0,0 +1,88 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SRID of WGS 84, the coordinate system used by gps and web maps.
+const SRID = 4326
+
+const earthRadiusMeters = 6371008.8
+
+var ErrInvalidPoint = errors.New("invalid point")
+
+// Point is a WGS 84 location. it is stored as a postgis geometry or geography and
+// marshaled to json as {"lat": 0, "lng": 0}.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Valid checks latitude and longitude ranges.
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("POINT(%g %g)", p.Lng, p.Lat)
+}
+
+func (p *Point) UnmarshalJSON(b []byte) error {
+	type point Point
+	var v point
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if !Point(v).Valid() {
+		return fmt.Errorf("%w: lat %g lng %g out of range", ErrInvalidPoint, v.Lat, v.Lng)
+	}
+	*p = Point(v)
+	return nil
+}
+
+// Distance returns the great circle distance between two points in meters.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLng := radians(b.Lng - a.Lng)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+// BoundingBox is an area between two corners. it is marshaled to json as a geojson bbox,
+// [minLng, minLat, maxLng, maxLat].
+type BoundingBox struct {
+	Min Point
+	Max Point
+}
+
+// Contains reports if p is inside the box.
+func (b BoundingBox) Contains(p Point) bool {
+	return p.Lat >= b.Min.Lat && p.Lat <= b.Max.Lat && p.Lng >= b.Min.Lng && p.Lng <= b.Max.Lng
+}
+
+func (b BoundingBox) MarshalJSON() ([]byte, error) {
+	return json.Marshal([4]float64{b.Min.Lng, b.Min.Lat, b.Max.Lng, b.Max.Lat})
+}
+
+func (b *BoundingBox) UnmarshalJSON(data []byte) error {
+	var v [4]float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	box := BoundingBox{Min: Point{Lng: v[0], Lat: v[1]}, Max: Point{Lng: v[2], Lat: v[3]}}
+	if !box.Min.Valid() || !box.Max.Valid() || box.Min.Lat > box.Max.Lat || box.Min.Lng > box.Max.Lng {
+		return fmt.Errorf("%w: invalid bounding box %v", ErrInvalidPoint, v)
+	}
+	*b = box
+	return nil
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
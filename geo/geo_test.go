@@ -0,0 +1,63 @@
+package geo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointJSON(t *testing.T) {
+	var p Point
+	require.NoError(t, json.Unmarshal([]byte(`{"lat": 35.7, "lng": 51.4}`), &p))
+	require.Equal(t, Point{Lat: 35.7, Lng: 51.4}, p)
+
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"lat": 135.7, "lng": 51.4}`), &p), ErrInvalidPoint)
+
+	var box BoundingBox
+	require.NoError(t, json.Unmarshal([]byte(`[51, 35, 52, 36]`), &box))
+	require.True(t, box.Contains(p))
+
+	b, err := json.Marshal(box)
+	require.NoError(t, err)
+	require.JSONEq(t, `[51, 35, 52, 36]`, string(b))
+
+	require.Error(t, json.Unmarshal([]byte(`[52, 35, 51, 36]`), &box))
+}
+
+func TestPointSQL(t *testing.T) {
+	{ // hex ewkb of SRID=4326;POINT(51.4 35.7) as returned by postgis
+		var p Point
+		require.NoError(t, p.Scan("0101000020E61000003333333333B349409A99999999D94140"))
+		require.Equal(t, Point{Lng: 51.4, Lat: 35.7}, p)
+
+		v, err := p.Value()
+		require.NoError(t, err)
+		require.Equal(t, "SRID=4326;POINT(51.4 35.7)", v)
+	}
+
+	{ // not a point
+		var p Point
+		require.ErrorIs(t, p.Scan("0102000020E61000003333333333B349409A99999999D94140"), ErrInvalidPoint)
+	}
+
+	{
+		var box BoundingBox
+		require.NoError(t, box.Scan("BOX(51 35,52.5 36)"))
+		require.Equal(t, BoundingBox{Min: Point{Lng: 51, Lat: 35}, Max: Point{Lng: 52.5, Lat: 36}}, box)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Tehran to Isfahan is roughly 340km
+	d := Distance(Point{Lat: 35.6892, Lng: 51.3890}, Point{Lat: 32.6539, Lng: 51.6660})
+	require.InDelta(t, 338000, d, 2000)
+
+	cond, args := WithinDistance("location", Point{Lat: 35.7, Lng: 51.4}, 500, 2)
+	require.Equal(t, `ST_DWithin("location"::geography, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, $4)`, cond)
+	require.Equal(t, []interface{}{51.4, 35.7, 500.0}, args)
+
+	cond, args = InBoundingBox("location", BoundingBox{Min: Point{Lng: 51, Lat: 35}, Max: Point{Lng: 52, Lat: 36}}, 1)
+	require.Equal(t, `"location"::geometry && ST_MakeEnvelope($1, $2, $3, $4, 4326)`, cond)
+	require.Equal(t, []interface{}{51.0, 35.0, 52.0, 36.0}, args)
+}
@@ -0,0 +1,130 @@
+package geo
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	wkbPoint   = 1
+	ewkbZFlag  = 0x80000000
+	ewkbMFlag  = 0x40000000
+	ewkbSRFlag = 0x20000000
+)
+
+// Value encodes p as EWKT, which postgis accepts for both geometry and geography columns.
+func (p Point) Value() (driver.Value, error) {
+	return fmt.Sprintf("SRID=%d;%s", SRID, p), nil
+}
+
+// Scan decodes a postgis point from its hex EWKB text form or binary WKB.
+func (p *Point) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		return fmt.Errorf("%w: can not scan null into point", ErrInvalidPoint)
+	case string:
+		var err error
+		if b, err = hex.DecodeString(v); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPoint, err)
+		}
+	case []byte:
+		// text protocol still sends hex
+		if decoded, err := hex.DecodeString(string(v)); err == nil {
+			b = decoded
+		} else {
+			b = v
+		}
+	default:
+		return fmt.Errorf("%w: can not scan %T into point", ErrInvalidPoint, src)
+	}
+	return p.decodeEWKB(b)
+}
+
+func (p *Point) decodeEWKB(b []byte) error {
+	if len(b) < 21 {
+		return fmt.Errorf("%w: wkb too short", ErrInvalidPoint)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if b[0] == 0 {
+		order = binary.BigEndian
+	}
+
+	typ := order.Uint32(b[1:5])
+	b = b[5:]
+	if typ&ewkbSRFlag != 0 {
+		b = b[4:]
+	}
+	if typ&^(ewkbZFlag|ewkbMFlag|ewkbSRFlag) != wkbPoint {
+		return fmt.Errorf("%w: geometry type %d is not a point", ErrInvalidPoint, typ)
+	}
+	if len(b) < 16 {
+		return fmt.Errorf("%w: wkb too short", ErrInvalidPoint)
+	}
+
+	p.Lng = math.Float64frombits(order.Uint64(b[0:8]))
+	p.Lat = math.Float64frombits(order.Uint64(b[8:16]))
+	return nil
+}
+
+// Value encodes b as an EWKT polygon.
+func (b BoundingBox) Value() (driver.Value, error) {
+	return fmt.Sprintf("SRID=%d;POLYGON((%g %g,%g %g,%g %g,%g %g,%g %g))", SRID,
+		b.Min.Lng, b.Min.Lat, b.Max.Lng, b.Min.Lat, b.Max.Lng, b.Max.Lat, b.Min.Lng, b.Max.Lat, b.Min.Lng, b.Min.Lat), nil
+}
+
+// Scan decodes a postgis box2d, as returned by ST_Extent, like BOX(1 2,3 4).
+func (b *BoundingBox) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("%w: can not scan %T into bounding box", ErrInvalidPoint, src)
+	}
+
+	var box BoundingBox
+	if _, err := fmt.Sscanf(strings.ToUpper(s), "BOX(%g %g,%g %g)", &box.Min.Lng, &box.Min.Lat, &box.Max.Lng, &box.Max.Lat); err != nil {
+		return fmt.Errorf("%w: invalid box %q", ErrInvalidPoint, s)
+	}
+	*b = box
+	return nil
+}
+
+// WithinDistance returns a condition matching rows whose column is within meters of p, and its args.
+// placeholders start from $argStart, so it can be appended to other conditions.
+// example:
+//
+//	cond, args := geo.WithinDistance("location", p, 500, 2)
+//	rows, err := pool.Query(ctx, "select id from drivers where active = $1 and "+cond, append([]interface{}{true}, args...)...)
+func WithinDistance(column string, p Point, meters float64, argStart int) (string, []interface{}) {
+	return fmt.Sprintf("ST_DWithin(%s::geography, %s, $%d)", pgx.Identifier{column}.Sanitize(), makePoint(argStart), argStart+2),
+		[]interface{}{p.Lng, p.Lat, meters}
+}
+
+// DistanceTo returns an expression of the distance in meters between column and p, to be selected or ordered by.
+func DistanceTo(column string, p Point, argStart int) (string, []interface{}) {
+	return fmt.Sprintf("ST_Distance(%s::geography, %s)", pgx.Identifier{column}.Sanitize(), makePoint(argStart)),
+		[]interface{}{p.Lng, p.Lat}
+}
+
+// InBoundingBox returns a condition matching rows whose column is inside box. it uses the && operator
+// so a gist index on column is used.
+func InBoundingBox(column string, box BoundingBox, argStart int) (string, []interface{}) {
+	return fmt.Sprintf("%s::geometry && ST_MakeEnvelope($%d, $%d, $%d, $%d, %d)", pgx.Identifier{column}.Sanitize(),
+			argStart, argStart+1, argStart+2, argStart+3, SRID),
+		[]interface{}{box.Min.Lng, box.Min.Lat, box.Max.Lng, box.Max.Lat}
+}
+
+func makePoint(argStart int) string {
+	return fmt.Sprintf("ST_SetSRID(ST_MakePoint($%d, $%d), %d)::geography", argStart, argStart+1, SRID)
+}
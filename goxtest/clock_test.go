@@ -0,0 +1,24 @@
+package goxtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+
+	after := c.After(time.Minute)
+	require.Equal(t, 1, c.Waiters())
+
+	c.Advance(30 * time.Second)
+	require.Len(t, after, 0)
+	require.Equal(t, 30*time.Second, c.Since(start))
+
+	c.Advance(30 * time.Second)
+	require.Equal(t, start.Add(time.Minute), <-after)
+	require.Zero(t, c.Waiters())
+}
@@ -0,0 +1,74 @@
+package goxtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/migrate"
+)
+
+// keptTables are not truncated by Reset, they describe the schema and not the data.
+var keptTables = map[string]bool{"gox_migrations": true}
+
+// Reset truncates every table of the public schema except the migrations one, so each suite starts
+// from an empty, migrated database.
+func Reset(t testing.TB, pool *pgxpool.Pool) {
+	t.Helper()
+	ctx := context.Background()
+
+	rows, err := pool.Query(ctx, "SELECT tablename FROM pg_tables WHERE schemaname = current_schema()")
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	tables, err := scanStrings(rows)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+
+	var quoted []string
+	for _, table := range tables {
+		if !keptTables[table] {
+			quoted = append(quoted, pgx.Identifier{table}.Sanitize())
+		}
+	}
+	if len(quoted) == 0 {
+		return
+	}
+
+	if _, err := pool.Exec(ctx, "TRUNCATE "+strings.Join(quoted, ", ")+" RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatalf("truncate tables: %v", err)
+	}
+}
+
+// ResetAndSeed resets the database and runs seeders for the "test" environment.
+// example:
+//
+//	func TestMain(m *testing.M) { ... }
+//
+//	func TestOrders(t *testing.T) {
+//		goxtest.ResetAndSeed(t, pool, seeds.Users, seeds.Products)
+//		...
+//	}
+func ResetAndSeed(t testing.TB, pool *pgxpool.Pool, seeders ...migrate.Seeder) {
+	t.Helper()
+	Reset(t, pool)
+	if err := migrate.SeedEnv(context.Background(), pool, "test", seeders...); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+func scanStrings(rows pgx.Rows) ([]string, error) {
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,64 @@
+package goxtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/migrate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetAndSeed(t *testing.T) {
+	pool := NewTestDB(t)
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `CREATE TABLE gox_migrations (version bigint PRIMARY KEY);
+		CREATE TABLE users (id bigserial PRIMARY KEY, email text NOT NULL UNIQUE);
+		INSERT INTO gox_migrations VALUES (1);
+		INSERT INTO users (email) VALUES ('old@example.com'), ('older@example.com');`)
+	require.NoError(t, err)
+
+	runs := 0
+	demo := migrate.Seeder{Name: "demo users", Run: func(ctx context.Context, tx pgx.Tx) error {
+		runs++
+		_, err := tx.Exec(ctx, "INSERT INTO users (email) VALUES ('demo@example.com')")
+		return err
+	}}
+	devOnly := migrate.Seeder{Name: "dev users", Envs: []string{"dev"}, Run: func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO users (email) VALUES ('dev@example.com')")
+		return err
+	}}
+	emails := func() []string {
+		rows, err := pool.Query(ctx, "SELECT email FROM users ORDER BY id")
+		require.NoError(t, err)
+		out, err := scanStrings(rows)
+		require.NoError(t, err)
+		return out
+	}
+
+	{ // data is replaced by the seeds of the test environment, migrations are kept
+		ResetAndSeed(t, pool, demo, devOnly)
+		require.Equal(t, []string{"demo@example.com"}, emails())
+
+		var id, version int64
+		require.NoError(t, pool.QueryRow(ctx, "SELECT id FROM users").Scan(&id))
+		require.Equal(t, int64(1), id)
+		require.NoError(t, pool.QueryRow(ctx, "SELECT version FROM gox_migrations").Scan(&version))
+		require.Equal(t, int64(1), version)
+	}
+
+	{ // seeders run once per reset
+		require.NoError(t, migrate.SeedEnv(ctx, pool, "test", demo))
+		require.Equal(t, 1, runs)
+
+		ResetAndSeed(t, pool, demo)
+		require.Equal(t, 2, runs)
+		require.Equal(t, []string{"demo@example.com"}, emails())
+	}
+
+	{ // reset alone leaves the tables empty
+		Reset(t, pool)
+		require.Empty(t, emails())
+	}
+}
@@ -0,0 +1,356 @@
+// Package fake generates realistic fake values for fixtures, examples and load tests. a Faker seeded with
+// the same seed generates the same values, so tests using them are reproducible.
+package fake
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of values, used as the fake struct tag.
+const (
+	KindEmail     = "email"
+	KindUUID      = "uuid"
+	KindName      = "name"
+	KindFirstName = "first_name"
+	KindLastName  = "last_name"
+	KindUsername  = "username"
+	KindPhone     = "phone"
+	KindCompany   = "company"
+	KindCity      = "city"
+	KindCountry   = "country"
+	KindURL       = "url"
+	KindIP        = "ip"
+	KindWord      = "word"
+	KindSentence  = "sentence"
+	KindInt       = "int"
+	KindTime      = "time"
+)
+
+// Epoch is the time generated times are relative to, fixed so times are reproducible too.
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	firstNames = []string{"Ann", "Ben", "Clara", "David", "Elif", "Farid", "Grace", "Hana", "Ivan", "Julia", "Kenji", "Lena", "Mateo", "Nora", "Omar", "Priya", "Quinn", "Reza", "Sara", "Tom"}
+	lastNames  = []string{"Anderson", "Becker", "Costa", "Dubois", "Evans", "Fischer", "Garcia", "Hansen", "Ito", "Jensen", "Kowalski", "Lopez", "Moreau", "Novak", "Okafor", "Petrov", "Rossi", "Smith", "Tanaka", "Weber"}
+	companies  = []string{"Acme", "Globex", "Initech", "Umbrella", "Hooli", "Stark Industries", "Wayne Enterprises", "Soylent", "Vandelay", "Cyberdyne"}
+	cities     = []string{"Berlin", "Lisbon", "Tokyo", "Toronto", "Nairobi", "Istanbul", "Seoul", "Madrid", "Oslo", "Austin"}
+	countries  = []string{"DE", "PT", "JP", "CA", "KE", "TR", "KR", "ES", "NO", "US"}
+	words      = []string{"alpha", "bright", "cloud", "delta", "ember", "forest", "granite", "harbor", "island", "jungle", "kernel", "lunar", "meadow", "nova", "orbit", "prism", "quartz", "river", "summit", "tide"}
+	domains    = []string{"example.com", "example.org", "example.net"}
+)
+
+// Faker generates fake values, it is not safe for concurrent use.
+type Faker struct {
+	rnd *rand.Rand
+}
+
+// New returns a faker generating the same values for the same seed.
+func New(seed int64) *Faker {
+	return &Faker{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (f *Faker) pick(list []string) string {
+	return list[f.rnd.Intn(len(list))]
+}
+
+func (f *Faker) FirstName() string { return f.pick(firstNames) }
+func (f *Faker) LastName() string  { return f.pick(lastNames) }
+func (f *Faker) Name() string      { return f.FirstName() + " " + f.LastName() }
+func (f *Faker) Company() string   { return f.pick(companies) }
+func (f *Faker) City() string      { return f.pick(cities) }
+
+// Country returns an ISO 3166 country code.
+func (f *Faker) Country() string { return f.pick(countries) }
+func (f *Faker) Word() string    { return f.pick(words) }
+
+// Username returns a lower case name with a number, like "ann.becker42".
+func (f *Faker) Username() string {
+	return strings.ToLower(f.FirstName()+"."+f.LastName()) + strconv.Itoa(f.rnd.Intn(100))
+}
+
+// Email returns an address on a reserved example domain, so mails to it never reach anyone.
+func (f *Faker) Email() string {
+	return f.Username() + "@" + f.pick(domains)
+}
+
+// Phone returns a number in E.164 format.
+func (f *Faker) Phone() string {
+	return fmt.Sprintf("+1555%07d", f.rnd.Intn(10000000))
+}
+
+// UUID returns a version 4 uuid.
+func (f *Faker) UUID() string {
+	var b [16]byte
+	f.rnd.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// URL returns an url on a reserved example domain.
+func (f *Faker) URL() string {
+	return "https://" + f.pick(domains) + "/" + f.Word()
+}
+
+// IP returns an address of the documentation range 203.0.113.0/24.
+func (f *Faker) IP() string {
+	return net.IPv4(203, 0, 113, byte(1+f.rnd.Intn(254))).String()
+}
+
+// Sentence returns a capitalized sentence of 4 to 10 words.
+func (f *Faker) Sentence() string {
+	n := 4 + f.rnd.Intn(7)
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = f.Word()
+	}
+	s := strings.Join(parts, " ")
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
+
+// Int returns a number in [min, max].
+func (f *Faker) Int(min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + f.rnd.Intn(max-min+1)
+}
+
+// Time returns a time within the year before Epoch, truncated to seconds.
+func (f *Faker) Time() time.Time {
+	return Epoch.Add(-time.Duration(f.rnd.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Second)
+}
+
+// Fill sets the fields of the struct v points to. the fake tag selects the kind of a field, like
+// `fake:"email"`, with min and max for ints, like `fake:"int,min=18,max=99"`, and `fake:"-"` skips it.
+// untagged fields are guessed from their name, like Email or ID, and otherwise get a value of their
+// type. nested structs, pointers, slices of 1 to 3 elements and maps are filled too.
+// example:
+//
+//	type User struct {
+//		ID    string `fake:"uuid"`
+//		Email string `fake:"email"`
+//		Name  string
+//		Age   int `fake:"int,min=18,max=99"`
+//	}
+//
+//	var u User
+//	err := fake.New(42).Fill(&u)
+func (f *Faker) Fill(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("fake: fill needs a non nil pointer, got %T", v)
+	}
+	return f.fill(rv.Elem(), "", "", 0)
+}
+
+// Make returns a filled value of type T.
+func Make[T any](f *Faker) (T, error) {
+	var v T
+	err := f.Fill(&v)
+	return v, err
+}
+
+// Slice returns n filled values of type T.
+func Slice[T any](f *Faker, n int) ([]T, error) {
+	s := make([]T, n)
+	for i := range s {
+		if err := f.Fill(&s[i]); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// maxDepth stops recursive types.
+const maxDepth = 8
+
+func (f *Faker) fill(v reflect.Value, name, tag string, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+	kind, opts := parseTag(tag)
+	if kind == "" {
+		kind = guess(name, v.Type())
+	}
+
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(f.Time()))
+		return nil
+	case v.Kind() == reflect.String:
+		s, err := f.value(kind)
+		if err != nil {
+			return fmt.Errorf("fake: field %s: %w", name, err)
+		}
+		v.SetString(s)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(f.Int(opts.min(0), opts.max(1000))))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(f.Int(opts.min(0), opts.max(1000))))
+	case reflect.Float32, reflect.Float64:
+		min, max := float64(opts.min(0)), float64(opts.max(1000))
+		v.SetFloat(min + f.rnd.Float64()*(max-min))
+	case reflect.Bool:
+		v.SetBool(f.rnd.Intn(2) == 1)
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := f.fill(p.Elem(), name, tag, depth+1); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, 16)
+			f.rnd.Read(b)
+			v.SetBytes(b)
+			return nil
+		}
+		n := 1 + f.rnd.Intn(3)
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < s.Len(); i++ {
+			if err := f.fill(s.Index(i), name, tag, depth+1); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for i := 0; i < 1+f.rnd.Intn(3); i++ {
+			k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			if err := f.fill(k, "", KindWord, depth+1); err != nil {
+				return err
+			}
+			if err := f.fill(e, name, "", depth+1); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("fake")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			if err := f.fill(v.Field(i), field.Name, tag, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Faker) value(kind string) (string, error) {
+	switch kind {
+	case KindEmail:
+		return f.Email(), nil
+	case KindUUID:
+		return f.UUID(), nil
+	case KindName:
+		return f.Name(), nil
+	case KindFirstName:
+		return f.FirstName(), nil
+	case KindLastName:
+		return f.LastName(), nil
+	case KindUsername:
+		return f.Username(), nil
+	case KindPhone:
+		return f.Phone(), nil
+	case KindCompany:
+		return f.Company(), nil
+	case KindCity:
+		return f.City(), nil
+	case KindCountry:
+		return f.Country(), nil
+	case KindURL:
+		return f.URL(), nil
+	case KindIP:
+		return f.IP(), nil
+	case KindWord, "":
+		return f.Word(), nil
+	case KindSentence:
+		return f.Sentence(), nil
+	case KindInt:
+		return strconv.Itoa(f.Int(0, 1000)), nil
+	case KindTime:
+		return f.Time().Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("unknown kind %q", kind)
+}
+
+// guess returns the kind of untagged string fields by their name.
+func guess(name string, t reflect.Type) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.String {
+		return ""
+	}
+	n := strings.ToLower(name)
+	switch {
+	case n == "id" || strings.HasSuffix(n, "id") && len(n) > 2 && name[len(name)-2] == 'I':
+		return KindUUID
+	case strings.Contains(n, "email"):
+		return KindEmail
+	case n == "firstname":
+		return KindFirstName
+	case n == "lastname" || n == "surname":
+		return KindLastName
+	case n == "username" || n == "login":
+		return KindUsername
+	case strings.HasSuffix(n, "name"):
+		return KindName
+	case strings.Contains(n, "phone"):
+		return KindPhone
+	case n == "company" || n == "organization":
+		return KindCompany
+	case n == "city":
+		return KindCity
+	case n == "country":
+		return KindCountry
+	case strings.HasSuffix(n, "url") || n == "website":
+		return KindURL
+	case strings.HasSuffix(name, "IP"):
+		return KindIP
+	case n == "description" || n == "bio" || n == "body" || n == "comment":
+		return KindSentence
+	}
+	return KindWord
+}
+
+type tagOptions map[string]string
+
+func parseTag(tag string) (string, tagOptions) {
+	parts := strings.Split(tag, ",")
+	opts := tagOptions{}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		opts[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(parts[0]), opts
+}
+
+func (o tagOptions) min(def int) int { return o.int("min", def) }
+func (o tagOptions) max(def int) int { return o.int("max", def) }
+
+func (o tagOptions) int(key string, def int) int {
+	if n, err := strconv.Atoi(o[key]); err == nil {
+		return n
+	}
+	return def
+}
@@ -0,0 +1,78 @@
+package fake
+
+import (
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City    string
+	Country string
+}
+
+type user struct {
+	ID        string
+	Email     string `fake:"email"`
+	Name      string
+	Phone     string
+	Age       int `fake:"int,min=18,max=20"`
+	Score     float64
+	Active    bool
+	Tags      []string `fake:"word"`
+	Address   *address
+	ClientIP  string
+	CreatedAt time.Time
+	Internal  string `fake:"-"`
+	Meta      map[string]int
+	parent    *user
+}
+
+func TestFill(t *testing.T) {
+	var u user
+	require.NoError(t, New(1).Fill(&u))
+
+	require.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), u.ID)
+	require.Regexp(t, `^[a-z]+\.[a-z]+\d+@example\.(com|org|net)$`, u.Email)
+	require.Regexp(t, `^[A-Z][a-z]+ [A-Z][a-z]+$`, u.Name)
+	require.Regexp(t, `^\+1555\d{7}$`, u.Phone)
+	require.GreaterOrEqual(t, u.Age, 18)
+	require.LessOrEqual(t, u.Age, 20)
+	require.NotEmpty(t, u.Tags)
+	require.Contains(t, words, u.Tags[0])
+	require.NotNil(t, u.Address)
+	require.Contains(t, cities, u.Address.City)
+	require.True(t, net.ParseIP(u.ClientIP) != nil)
+	require.True(t, u.CreatedAt.Before(Epoch))
+	require.Empty(t, u.Internal)
+	require.NotEmpty(t, u.Meta)
+	require.Nil(t, u.parent)
+
+	{ // the same seed generates the same values
+		var again user
+		require.NoError(t, New(1).Fill(&again))
+		require.Equal(t, u, again)
+
+		other, err := Make[user](New(2))
+		require.NoError(t, err)
+		require.NotEqual(t, u.ID, other.ID)
+	}
+
+	{ // errors
+		require.Error(t, New(1).Fill(u))
+		_, err := Make[struct {
+			X string `fake:"unknown"`
+		}](New(1))
+		require.Error(t, err)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	users, err := Slice[user](New(3), 5)
+	require.NoError(t, err)
+	require.Len(t, users, 5)
+	require.NotEqual(t, users[0].ID, users[1].ID)
+}
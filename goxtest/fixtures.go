@@ -0,0 +1,266 @@
+package goxtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/store"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFixtures empties the tables of the fixture files in fsys and inserts their rows. each file,
+// like users.yml or orders.json, holds a list of rows of the table it is named after. tables are
+// filled in foreign key order and files are go templates with these functions:
+//
+//	{{ now }}            the current time
+//	{{ ago "24h" }}      the time a duration ago, {{ fromNow "1h" }} one ahead
+//	{{ uuid }}           a random uuid, {{ uuid "alice" }} the same one for every use of "alice"
+//
+// pass a transaction from Tx as db to undo the fixtures when the test ends, so tests do not see each
+// other's data. tables are emptied with DELETE rather than TRUNCATE, whose exclusive locks would hold
+// back every other test using them until the transaction ends, so identities are not restarted and
+// rows of other tables must not reference the deleted ones, unless by ON DELETE CASCADE.
+// example:
+//
+//	//go:embed testdata/fixtures
+//	var fixtures embed.FS
+//
+//	tx := goxtest.Tx(t, pool)
+//	goxtest.LoadFixtures(t, tx, fixtures)
+func LoadFixtures(t testing.TB, db store.Querier, fsys fs.FS) {
+	t.Helper()
+	ctx := context.Background()
+
+	fixtures, err := readFixtures(fsys)
+	if err != nil {
+		t.Fatalf("read fixtures: %v", err)
+	}
+	if len(fixtures) == 0 {
+		return
+	}
+
+	tables := make([]string, 0, len(fixtures))
+	for table := range fixtures {
+		tables = append(tables, table)
+	}
+
+	deps, err := foreignKeys(ctx, db)
+	if err != nil {
+		t.Fatalf("read foreign keys: %v", err)
+	}
+	ordered, err := sortTables(tables, deps)
+	if err != nil {
+		t.Fatalf("order fixtures: %v", err)
+	}
+
+	// referencing tables are emptied first
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if _, err := db.Exec(ctx, "DELETE FROM "+store.QuoteIdentifier(ordered[i])); err != nil {
+			t.Fatalf("empty fixture table %s: %v", ordered[i], err)
+		}
+	}
+
+	for _, table := range ordered {
+		for i, row := range fixtures[table] {
+			sql, args := insertRow(table, row)
+			if _, err := db.Exec(ctx, sql, args...); err != nil {
+				t.Fatalf("insert fixture %d of %s: %v", i, table, err)
+			}
+		}
+	}
+}
+
+// Tx begins a transaction on pool which is rolled back when the test ends.
+func Tx(t testing.TB, pool *pgxpool.Pool) pgx.Tx {
+	t.Helper()
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("begin transaction: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = tx.Rollback(context.Background())
+	})
+	return tx
+}
+
+func readFixtures(fsys fs.FS) (map[string][]map[string]interface{}, error) {
+	funcs := fixtureFuncs()
+	fixtures := make(map[string][]map[string]interface{})
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		ext := path.Ext(p)
+		if ext != ".yml" && ext != ".yaml" && ext != ".json" {
+			return nil
+		}
+
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(p).Funcs(funcs).Parse(string(content))
+		if err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, nil); err != nil {
+			return err
+		}
+
+		var rows []map[string]interface{}
+		if ext == ".json" {
+			err = json.Unmarshal(b.Bytes(), &rows)
+		} else {
+			err = yaml.Unmarshal(b.Bytes(), &rows)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+
+		table := strings.TrimSuffix(path.Base(p), ext)
+		fixtures[table] = append(fixtures[table], rows...)
+		return nil
+	})
+	return fixtures, err
+}
+
+func fixtureFuncs() template.FuncMap {
+	named := make(map[string]string)
+	return template.FuncMap{
+		"now": func() string {
+			return time.Now().UTC().Format(time.RFC3339Nano)
+		},
+		"ago": func(d string) (string, error) {
+			dur, err := time.ParseDuration(d)
+			return time.Now().UTC().Add(-dur).Format(time.RFC3339Nano), err
+		},
+		"fromNow": func(d string) (string, error) {
+			dur, err := time.ParseDuration(d)
+			return time.Now().UTC().Add(dur).Format(time.RFC3339Nano), err
+		},
+		"uuid": func(name ...string) string {
+			if len(name) == 0 {
+				return newUUID()
+			}
+			if _, ok := named[name[0]]; !ok {
+				named[name[0]] = newUUID()
+			}
+			return named[name[0]]
+		},
+	}
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// foreignKeys returns the tables each table references.
+func foreignKeys(ctx context.Context, db store.Querier) (map[string][]string, error) {
+	rows, err := db.Query(ctx, "SELECT conrelid::regclass::text, confrelid::regclass::text FROM pg_constraint WHERE contype = 'f'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := make(map[string][]string)
+	for rows.Next() {
+		var table, referenced string
+		if err := rows.Scan(&table, &referenced); err != nil {
+			return nil, err
+		}
+		deps[table] = append(deps[table], referenced)
+	}
+	return deps, rows.Err()
+}
+
+// sortTables orders tables so referenced ones come first, self references are ignored.
+func sortTables(tables []string, deps map[string][]string) ([]string, error) {
+	sort.Strings(tables)
+	wanted := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		wanted[table] = true
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	ordered := make([]string, 0, len(tables))
+
+	var visit func(table string) error
+	visit = func(table string) error {
+		switch state[table] {
+		case visiting:
+			return fmt.Errorf("foreign keys of %s form a cycle", table)
+		case visited:
+			return nil
+		}
+		state[table] = visiting
+		for _, dep := range deps[table] {
+			if dep != table && wanted[dep] {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		state[table] = visited
+		ordered = append(ordered, table)
+		return nil
+	}
+
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+func insertRow(table string, row map[string]interface{}) (string, []interface{}) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, len(columns))
+	params := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgx.Identifier{column}.Sanitize()
+		params[i] = "$" + strconv.Itoa(i+1)
+		args[i] = fixtureValue(row[column])
+	}
+	return "INSERT INTO " + store.QuoteIdentifier(table) + " (" + strings.Join(quoted, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")", args
+}
+
+// fixtureValue encodes nested values as json, for json and jsonb columns.
+func fixtureValue(v interface{}) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return v
+}
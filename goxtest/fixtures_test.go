@@ -0,0 +1,45 @@
+package goxtest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFixtures(t *testing.T) {
+	fsys := fstest.MapFS{
+		"users.yml": {Data: []byte(`
+- id: '{{ uuid "alice" }}'
+  email: alice@example.com
+  created_at: '{{ ago "24h" }}'
+`)},
+		"orders.json": {Data: []byte(`[{"user_id": "{{ uuid "alice" }}", "items": {"pen": 2}}]`)},
+		"README.md":   {Data: []byte("not a fixture")},
+	}
+
+	fixtures, err := readFixtures(fsys)
+	require.NoError(t, err)
+	require.Len(t, fixtures, 2)
+	require.Equal(t, fixtures["users"][0]["id"], fixtures["orders"][0]["user_id"])
+	require.Len(t, fixtures["users"][0]["id"], 36)
+
+	sql, args := insertRow("orders", fixtures["orders"][0])
+	require.Equal(t, `INSERT INTO "orders" ("items", "user_id") VALUES ($1, $2)`, sql)
+	require.Equal(t, `{"pen":2}`, args[0])
+}
+
+func TestSortTables(t *testing.T) {
+	deps := map[string][]string{
+		"orders":      {"users", "products"},
+		"order_items": {"orders", "products"},
+		"users":       {"users", "organizations"},
+	}
+
+	ordered, err := sortTables([]string{"order_items", "orders", "users", "products"}, deps)
+	require.NoError(t, err)
+	require.Equal(t, []string{"users", "products", "orders", "order_items"}, ordered)
+
+	_, err = sortTables([]string{"a", "b"}, map[string][]string{"a": {"b"}, "b": {"a"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,159 @@
+package goxtest
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	stdos "os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// UpdateGoldenEnv rewrites golden files with the actual responses when set to true, run tests with
+// GOX_UPDATE_GOLDEN=1 after an intended change.
+const UpdateGoldenEnv = "GOX_UPDATE_GOLDEN"
+
+// updateGolden reports whether golden files are rewritten, by UpdateGoldenEnv or an update flag
+// defined by the test package. the flag is looked up rather than defined here, so packages defining
+// their own do not panic.
+func updateGolden() bool {
+	if ok, _ := strconv.ParseBool(stdos.Getenv(UpdateGoldenEnv)); ok {
+		return true
+	}
+	if f := flag.Lookup("update"); f != nil {
+		ok, _ := strconv.ParseBool(f.Value.String())
+		return ok
+	}
+	return false
+}
+
+// Normalizer replaces values which change between runs, like ids and timestamps, before comparing.
+// path is the dotted path of v in the document, like "items.0.id".
+type Normalizer func(path string, v interface{}) interface{}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IgnoreFields replaces the values of fields with one of names, at any depth, with "<ignored>".
+func IgnoreFields(names ...string) Normalizer {
+	return func(path string, v interface{}) interface{} {
+		field := path[strings.LastIndex(path, ".")+1:]
+		for _, name := range names {
+			if field == name {
+				return "<ignored>"
+			}
+		}
+		return v
+	}
+}
+
+// NormalizeTimestamps replaces RFC 3339 strings with "<timestamp>".
+func NormalizeTimestamps() Normalizer {
+	return func(_ string, v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return "<timestamp>"
+			}
+		}
+		return v
+	}
+}
+
+// NormalizeUUIDs replaces uuid strings with "<uuid>".
+func NormalizeUUIDs() Normalizer {
+	return func(_ string, v interface{}) interface{} {
+		if s, ok := v.(string); ok && uuidPattern.MatchString(s) {
+			return "<uuid>"
+		}
+		return v
+	}
+}
+
+// AssertJSONGolden compares the json body of res with the golden file after applying normalizers to
+// both, and shows a diff of the indented documents when they differ. with UpdateGoldenEnv set the
+// golden file is written instead.
+// example:
+//
+//	res := httptest.NewRecorder()
+//	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+//	goxtest.AssertJSONGolden(t, res.Result(), "testdata/get_user.json", goxtest.NormalizeTimestamps())
+func AssertJSONGolden(t testing.TB, res *http.Response, golden string, normalizers ...Normalizer) {
+	t.Helper()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read response body: %v", err)
+	}
+	_ = res.Body.Close()
+
+	got, err := normalizeJSON(body, normalizers)
+	if err != nil {
+		t.Fatalf("response body is not json: %v\n%s", err, body)
+	}
+
+	if updateGolden() {
+		if err := stdos.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatalf("create golden directory: %v", err)
+		}
+		if err := stdos.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	content, err := stdos.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file, run the test with %s=1 to create it: %v", UpdateGoldenEnv, err)
+	}
+	want, err := normalizeJSON(content, normalizers)
+	if err != nil {
+		t.Fatalf("golden file %s is not json: %v", golden, err)
+	}
+
+	require.Equal(t, string(want), string(got), "response does not match %s, run the test with %s=1 if the change is intended", golden, UpdateGoldenEnv)
+}
+
+// normalizeJSON returns data indented with sorted keys and normalized values.
+func normalizeJSON(data []byte, normalizers []Normalizer) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(normalizeValue("", v, normalizers), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func normalizeValue(path string, v interface{}, normalizers []Normalizer) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = normalizeValue(joinPath(path, k), child, normalizers)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeValue(joinPath(path, strconv.Itoa(i)), child, normalizers)
+		}
+	}
+
+	for _, n := range normalizers {
+		v = n(path, v)
+	}
+	return v
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
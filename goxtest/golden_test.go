@@ -0,0 +1,49 @@
+package goxtest
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertJSONGolden(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.WriteString(`{"tags": ["admin"], "email": "alice@example.com", "token": "s3cr3t",
+		"id": "5f0c6a2e-9b1d-4c3a-8e2f-1a2b3c4d5e6f", "created_at": "2024-03-01T10:00:00Z"}`)
+
+	AssertJSONGolden(t, w.Result(), "testdata/golden_user.json", NormalizeTimestamps(), NormalizeUUIDs(), IgnoreFields("token"))
+
+	{ // the env var writes the golden file
+		t.Setenv(UpdateGoldenEnv, "1")
+		golden := filepath.Join(t.TempDir(), "new.json")
+		w := httptest.NewRecorder()
+		_, _ = w.WriteString(`{"b": 1, "a": 2}`)
+		AssertJSONGolden(t, w.Result(), golden)
+		content, err := os.ReadFile(golden)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"a": 2, "b": 1}`, string(content))
+	}
+
+	{ // packages can define their own update flag
+		require.NotPanics(t, func() {
+			flag.Bool("update", false, "update golden files")
+		})
+		t.Setenv(UpdateGoldenEnv, "")
+		require.False(t, updateGolden())
+		require.NoError(t, flag.Set("update", "true"))
+		require.True(t, updateGolden())
+		require.NoError(t, flag.Set("update", "false"))
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	out, err := normalizeJSON([]byte(`{"items": [{"id": 1, "name": "pen"}]}`), []Normalizer{IgnoreFields("id")})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"items": [{"id": "<ignored>", "name": "pen"}]}`, string(out))
+}
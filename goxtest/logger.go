@@ -0,0 +1,85 @@
+package goxtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// ObservedLogs holds the entries logged by a logger of NewObservedLogger.
+type ObservedLogs struct {
+	*observer.ObservedLogs
+}
+
+// NewObservedLogger returns a logger keeping every entry, of all levels, in memory for assertions.
+// example:
+//
+//	logger, logs := goxtest.NewObservedLogger()
+//	handler := rest.RequestLogger(logger)(router)
+//	...
+//	logs.RequireEntry(t, zap.ErrorLevel, "request handled", zap.Int("code", 500))
+func NewObservedLogger() (*zap.Logger, *ObservedLogs) {
+	core, logs := observer.New(zap.DebugLevel)
+	return zap.New(core), &ObservedLogs{logs}
+}
+
+// ContainsEntry tells whether an entry of level was logged with a message containing msg and holding
+// all fields with equal values. other fields of the entry are ignored.
+func (o *ObservedLogs) ContainsEntry(level zapcore.Level, msg string, fields ...zap.Field) bool {
+	return len(o.FindEntries(level, msg, fields...)) > 0
+}
+
+// FindEntries returns the entries matched like ContainsEntry.
+func (o *ObservedLogs) FindEntries(level zapcore.Level, msg string, fields ...zap.Field) []observer.LoggedEntry {
+	want := fieldsMap(fields)
+
+	var found []observer.LoggedEntry
+	for _, e := range o.All() {
+		if e.Level != level || !strings.Contains(e.Message, msg) {
+			continue
+		}
+
+		got := e.ContextMap()
+		matched := true
+		for k, v := range want {
+			if !reflect.DeepEqual(got[k], v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// RequireEntry fails t, listing the logged entries, when ContainsEntry is false.
+func (o *ObservedLogs) RequireEntry(t testing.TB, level zapcore.Level, msg string, fields ...zap.Field) {
+	t.Helper()
+	if o.ContainsEntry(level, msg, fields...) {
+		return
+	}
+
+	var b strings.Builder
+	for _, e := range o.All() {
+		b.WriteString("\n\t" + e.Level.String() + " " + e.Message)
+		for k, v := range e.ContextMap() {
+			b.WriteString(fmt.Sprintf(" %s=%v", k, v))
+		}
+	}
+	t.Fatalf("no %s entry containing %q with fields %v was logged, entries:%s", level, msg, fieldsMap(fields), b.String())
+}
+
+func fieldsMap(fields []zap.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields
+}
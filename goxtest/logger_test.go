@@ -0,0 +1,20 @@
+package goxtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestObservedLogger(t *testing.T) {
+	logger, logs := NewObservedLogger()
+	logger.Debug("cache warmed")
+	logger.Error("request handled: GET /users", zap.Int("code", 500), zap.String("query", ""))
+
+	require.True(t, logs.ContainsEntry(zap.DebugLevel, "cache"))
+	require.True(t, logs.ContainsEntry(zap.ErrorLevel, "request handled", zap.Int("code", 500)))
+	require.False(t, logs.ContainsEntry(zap.ErrorLevel, "request handled", zap.Int("code", 404)))
+	require.False(t, logs.ContainsEntry(zap.InfoLevel, "request handled"))
+	logs.RequireEntry(t, zap.ErrorLevel, "GET /users", zap.String("query", ""))
+}
@@ -0,0 +1,134 @@
+package goxtest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	stdos "os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRedisAddrEnv sets the address of the redis server used by NewTestRedis, localhost:6379 by default.
+const TestRedisAddrEnv = "GOX_TEST_REDIS_ADDR"
+
+// RedisDo sends a command to redis and returns its reply, integers as int64, strings as string, arrays
+// as []interface{} and nil as a nil value. it has the shape of Do of redis clients, like
+// func(ctx context.Context, args ...interface{}) (interface{}, error) { return rdb.Do(ctx, args...).Result() }
+// for go-redis, except that nil replies are not an error.
+type RedisDo func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+// NewTestRedis connects to the redis server of TestRedisAddrEnv and returns a prefix only used by t,
+// keys under it are deleted when the test ends. it is skipped like NewTestDB when the server can not
+// be reached, RequireTestDBEnv makes it fail instead.
+// example:
+//
+//	do, prefix := goxtest.NewTestRedis(t)
+//	s := quota.NewRedisStore(quota.RedisDo(do), quota.WithRedisPrefix(prefix))
+func NewTestRedis(t testing.TB) (RedisDo, string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("redis tests are skipped in short mode")
+	}
+
+	addr := stdos.Getenv(TestRedisAddrEnv)
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		if required, _ := strconv.ParseBool(stdos.Getenv(RequireTestDBEnv)); !required {
+			t.Skipf("redis server is not reachable, set %s=1 to fail instead: %v", RequireTestDBEnv, err)
+		}
+		t.Fatalf("connect to redis server: %v", err)
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	prefix := "gox_test:" + randomHex(8) + ":"
+	t.Cleanup(func() {
+		_, err := c.do(context.Background(), "EVAL",
+			"for _, k in ipairs(redis.call('KEYS', ARGV[1])) do redis.call('DEL', k) end", 0, prefix+"*")
+		if err != nil {
+			t.Errorf("delete test redis keys: %v", err)
+		}
+		_ = conn.Close()
+	})
+	return c.do, prefix
+}
+
+// redisConn is a minimal client of the redis protocol, enough for tests.
+type redisConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *redisConn) do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	} else {
+		_ = c.conn.SetDeadline(time.Time{})
+	}
+
+	w := bufio.NewWriter(c.conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		s := fmt.Sprint(a)
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("invalid redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, errors.New(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.reply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("invalid redis reply %q", line)
+}
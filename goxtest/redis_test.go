@@ -0,0 +1,85 @@
+package goxtest
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTestRedis(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// answers each command with the next reply, recording the commands
+	replies := []string{"+OK\r\n", ":-2\r\n", "$-1\r\n", "*3\r\n$3\r\nfoo\r\n:7\r\n*1\r\n$0\r\n\r\n", "-ERR wrong\r\n", ":0\r\n"}
+	commands := make(chan string, len(replies))
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for _, reply := range replies {
+			var parts []string
+			var n int
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			for _, c := range line[1 : len(line)-2] {
+				n = n*10 + int(c-'0')
+			}
+			for i := 0; i < 2*n; i++ {
+				part, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if i%2 == 1 {
+					parts = append(parts, strings.TrimSuffix(part, "\r\n"))
+				}
+			}
+			commands <- strings.Join(parts, " ")
+			_, _ = conn.Write([]byte(reply))
+		}
+	}()
+
+	t.Setenv(TestRedisAddrEnv, l.Addr().String())
+	var prefix string
+	t.Run("redis", func(t *testing.T) {
+		var do RedisDo
+		do, prefix = NewTestRedis(t)
+		ctx := context.Background()
+
+		reply, err := do(ctx, "SET", prefix+"a", 1)
+		require.NoError(t, err)
+		require.Equal(t, "OK", reply)
+		require.Equal(t, "SET "+prefix+"a 1", <-commands)
+
+		reply, err = do(ctx, "PTTL", "a")
+		require.NoError(t, err)
+		require.Equal(t, int64(-2), reply)
+
+		reply, err = do(ctx, "GET", "a")
+		require.NoError(t, err)
+		require.Nil(t, reply)
+
+		reply, err = do(ctx, "HGETALL", "a")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"foo", int64(7), []interface{}{""}}, reply)
+
+		_, err = do(ctx, "NOPE")
+		require.EqualError(t, err, "ERR wrong")
+	})
+
+	<-commands
+	<-commands
+	<-commands
+	<-commands
+	require.Equal(t, "EVAL for _, k in ipairs(redis.call('KEYS', ARGV[1])) do redis.call('DEL', k) end 0 "+prefix+"*", <-commands)
+}
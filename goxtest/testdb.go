@@ -0,0 +1,208 @@
+package goxtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	stdos "os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/os"
+	"github.com/mirzakhany/gox/store"
+)
+
+// maintenanceDB is where databases are created and dropped from, a database can not be cloned while
+// connections to it are open.
+const maintenanceDB = "postgres"
+
+type dbConfig struct {
+	conn         *store.ConnConfig
+	templateName string
+	setup        func(ctx context.Context, pool *pgxpool.Pool) error
+}
+
+type DBOption func(*dbConfig) error
+
+// RequireTestDBEnv makes NewTestDB fail instead of skipping the test when the server can not be reached.
+const RequireTestDBEnv = "GOX_REQUIRE_TEST_DB"
+
+// WithConnConfig sets the server to create test databases on, by default it is loaded from env like
+// for store.NewPgPool.
+func WithConnConfig(c *store.ConnConfig) DBOption {
+	return func(cfg *dbConfig) error {
+		cfg.conn = c
+		return nil
+	}
+}
+
+// WithTemplate prepares a template database called name once using setup, each test database is a
+// clone of it. the template is kept between runs, so name must change when setup does.
+func WithTemplate(name string, setup func(ctx context.Context, pool *pgxpool.Pool) error) DBOption {
+	return func(cfg *dbConfig) error {
+		cfg.templateName = name
+		cfg.setup = setup
+		return nil
+	}
+}
+
+// WithMigrations uses a template with the migrations of dir in fsys applied, named after their checksums.
+func WithMigrations(fsys fs.FS, dir string) DBOption {
+	return func(cfg *dbConfig) error {
+		migrations, err := store.LoadMigrations(fsys, dir)
+		if err != nil {
+			return err
+		}
+
+		h := sha256.New()
+		for _, m := range migrations {
+			h.Write([]byte(m.Checksum))
+		}
+		name := "gox_template_" + hex.EncodeToString(h.Sum(nil))[:16]
+		return WithTemplate(name, func(ctx context.Context, pool *pgxpool.Pool) error {
+			return store.Migrate(ctx, pool, fsys, dir)
+		})(cfg)
+	}
+}
+
+// NewTestDB creates a database only used by t and returns a pool connected to it, the database is
+// dropped when the test ends. databases are cloned from a template, which is fast, so tests using
+// it can run with t.Parallel. it is skipped in short mode and when the server can not be reached,
+// unless RequireTestDBEnv is true, like in ci where a missing server must fail the tests.
+// example:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	func TestCreateOrder(t *testing.T) {
+//		t.Parallel()
+//		pool := goxtest.NewTestDB(t, goxtest.WithMigrations(migrations, "migrations"))
+//		...
+//	}
+func NewTestDB(t testing.TB, options ...DBOption) *pgxpool.Pool {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("database tests are skipped in short mode")
+	}
+
+	cfg := &dbConfig{}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			t.Fatalf("test database options: %v", err)
+		}
+	}
+	if cfg.conn == nil {
+		cfg.conn = &store.ConnConfig{}
+		if err := os.LoadFromEnv(cfg.conn); err != nil {
+			t.Fatalf("load database config: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	maintenance, err := store.NewPgPool(ctx, withDatabase(cfg.conn, maintenanceDB))
+	if err != nil {
+		if required, _ := strconv.ParseBool(stdos.Getenv(RequireTestDBEnv)); !required {
+			t.Skipf("database server is not reachable, set %s=1 to fail instead: %v", RequireTestDBEnv, err)
+		}
+		t.Fatalf("connect to database server: %v", err)
+	}
+
+	template := "template1"
+	if cfg.setup != nil {
+		if err := ensureTemplate(ctx, maintenance, cfg); err != nil {
+			maintenance.Close()
+			t.Fatalf("prepare template database: %v", err)
+		}
+		template = cfg.templateName
+	}
+
+	name := "gox_test_" + randomHex(8)
+	if _, err := maintenance.Exec(ctx, "CREATE DATABASE "+store.QuoteIdentifier(name)+" TEMPLATE "+store.QuoteIdentifier(template)); err != nil {
+		maintenance.Close()
+		t.Fatalf("create test database: %v", err)
+	}
+
+	pool, err := store.NewPgPool(ctx, withDatabase(cfg.conn, name))
+	if err != nil {
+		maintenance.Close()
+		t.Fatalf("connect to test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		pool.Close()
+		if _, err := maintenance.Exec(context.Background(), "DROP DATABASE IF EXISTS "+store.QuoteIdentifier(name)); err != nil {
+			t.Errorf("drop test database %s: %v", name, err)
+		}
+		maintenance.Close()
+	})
+	return pool
+}
+
+// templatesMu serializes template creation in this process, the advisory lock in ensureTemplate does
+// it between the processes of go test running packages in parallel.
+var templatesMu sync.Mutex
+
+func ensureTemplate(ctx context.Context, maintenance *pgxpool.Pool, cfg *dbConfig) error {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	conn, err := maintenance.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext($1))", cfg.templateName); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", cfg.templateName)
+	}()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", cfg.templateName).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	// the template gets its name only once it is complete, so a failed setup is never cloned
+	building := cfg.templateName + "_building"
+	if _, err := conn.Exec(ctx, "DROP DATABASE IF EXISTS "+store.QuoteIdentifier(building)); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+store.QuoteIdentifier(building)); err != nil {
+		return err
+	}
+
+	pool, err := store.NewPgPool(ctx, withDatabase(cfg.conn, building))
+	if err != nil {
+		return err
+	}
+	err = cfg.setup(ctx, pool)
+	pool.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, "ALTER DATABASE "+store.QuoteIdentifier(building)+" RENAME TO "+store.QuoteIdentifier(cfg.templateName))
+	return err
+}
+
+func withDatabase(c *store.ConnConfig, database string) *store.ConnConfig {
+	cc := *c
+	cc.Database = database
+	return &cc
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
@@ -0,0 +1,24 @@
+package goxtest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMigrations(t *testing.T) {
+	fsys := fstest.MapFS{"migrations/0001_users.sql": {Data: []byte("CREATE TABLE users (id bigserial);")}}
+
+	a, b := &dbConfig{}, &dbConfig{}
+	require.NoError(t, WithMigrations(fsys, "migrations")(a))
+	require.NoError(t, WithMigrations(fsys, "migrations")(b))
+	require.Equal(t, a.templateName, b.templateName)
+
+	{ // changed migrations get a new template
+		fsys["migrations/0002_orders.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE orders (id bigserial);")}
+		c := &dbConfig{}
+		require.NoError(t, WithMigrations(fsys, "migrations")(c))
+		require.NotEqual(t, a.templateName, c.templateName)
+	}
+}
@@ -0,0 +1,167 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/diag"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/log"
+	"github.com/mirzakhany/gox/metrics"
+	"go.uber.org/zap"
+)
+
+// TaskError wraps the error returned by a task with its name, errs.CodeOf returns the code of Err.
+type TaskError struct {
+	Name string
+	Err  error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task %s: %s", e.Name, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error of a task which panicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+func (e *PanicError) StackTrace() string {
+	return string(e.Stack)
+}
+
+func (e *PanicError) ErrorCode() errs.Code {
+	return errs.CodeInternal
+}
+
+// Group runs tasks in goroutines like errgroup. panics of tasks are recovered and returned as
+// PanicError, the first failed task cancels the context of the others and its error is returned by Wait.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+	logger *zap.Logger
+
+	metrics     *metrics.Async
+	metricsName string
+
+	errOnce sync.Once
+	err     error
+}
+
+type Option func(*Group)
+
+// WithLimit bounds the number of tasks running at once. Go blocks until a slot is free.
+func WithLimit(n int) Option {
+	return func(g *Group) {
+		if n > 0 {
+			g.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithZapLogger logs start, end and failure of each task.
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(g *Group) {
+		g.logger = logger
+	}
+}
+
+// WithMetrics records the tasks of the group in m, labeled with name. task names are not used as
+// labels since they often hold ids.
+func WithMetrics(m *metrics.Async, name string) Option {
+	return func(g *Group) {
+		g.metrics = m
+		g.metricsName = name
+	}
+}
+
+// New returns a group and a context derived from ctx, which is canceled when a task fails or Wait returns.
+// example:
+//
+//	g, ctx := group.New(ctx, group.WithLimit(4), group.WithZapLogger(logger))
+//	for _, f := range files {
+//		f := f
+//		g.Go("upload "+f, func(ctx context.Context) error {
+//			return upload(ctx, f)
+//		})
+//	}
+//	err := g.Wait()
+func New(ctx context.Context, options ...Option) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &Group{ctx: ctx, cancel: cancel, logger: zap.NewNop()}
+	for _, o := range options {
+		o(g)
+	}
+	return g, ctx
+}
+
+// Go runs fn in a new goroutine. errors of fn are wrapped in TaskError with name.
+func (g *Group) Go(name string, fn func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			if g.sem != nil {
+				<-g.sem
+			}
+			g.wg.Done()
+		}()
+
+		logger := g.logger.With(zap.String("task", name))
+		logger.Debug("task started")
+
+		t0 := time.Now()
+		err := run(g.ctx, fn)
+		if g.metrics != nil {
+			g.metrics.Observe(g.metricsName, t0, err)
+		}
+		if err == nil {
+			logger.Debug("task finished", zap.Duration("duration", time.Since(t0)))
+			return
+		}
+
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			diag.RecordPanic("task "+name, panicErr.Value, panicErr.Stack)
+		}
+		logger.Error("task failed", zap.Duration("duration", time.Since(t0)), log.Err(err))
+		g.errOnce.Do(func() {
+			g.err = &TaskError{Name: name, Err: err}
+			g.cancel()
+		})
+	}()
+}
+
+// Wait blocks until all tasks are done and returns the error of the first failed task.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+func run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,103 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	{ // all tasks succeed
+		var done int32
+		g, _ := New(context.Background())
+		for i := 0; i < 5; i++ {
+			g.Go("task", func(ctx context.Context) error {
+				atomic.AddInt32(&done, 1)
+				return nil
+			})
+		}
+		require.NoError(t, g.Wait())
+		require.Equal(t, int32(5), done)
+	}
+
+	{ // first error cancels others and is named
+		failed := errors.New("failed")
+		g, ctx := New(context.Background())
+		g.Go("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		g.Go("broken", func(ctx context.Context) error {
+			return failed
+		})
+
+		err := g.Wait()
+		require.ErrorIs(t, err, failed)
+		require.EqualError(t, err, "task broken: failed")
+		require.Error(t, ctx.Err())
+	}
+
+	{ // panics are recovered
+		g, _ := New(context.Background())
+		g.Go("panicky", func(ctx context.Context) error {
+			panic("boom")
+		})
+
+		err := g.Wait()
+		var perr *PanicError
+		require.ErrorAs(t, err, &perr)
+		require.Equal(t, "boom", perr.Value)
+		require.NotEmpty(t, perr.Stack)
+		require.Equal(t, errs.CodeInternal, errs.CodeOf(err))
+	}
+
+	{ // codes of task errors are kept
+		g, _ := New(context.Background())
+		g.Go("lookup", func(ctx context.Context) error {
+			return errs.NotFound("user not found")
+		})
+		require.Equal(t, errs.CodeNotFound, errs.CodeOf(g.Wait()))
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	var running, max int32
+	g, _ := New(context.Background(), WithLimit(2))
+	for i := 0; i < 10; i++ {
+		g.Go("task", func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	require.NoError(t, g.Wait())
+	require.LessOrEqual(t, max, int32(2))
+}
+
+func TestGroupMetrics(t *testing.T) {
+	m, err := metrics.NewAsync(prometheus.NewRegistry(), "group")
+	require.NoError(t, err)
+
+	g, _ := New(context.Background(), WithMetrics(m, "uploads"))
+	g.Go("upload 1", func(ctx context.Context) error { return nil })
+	g.Go("upload 2", func(ctx context.Context) error { return errors.New("failed") })
+	require.Error(t, g.Wait())
+
+	require.Equal(t, 2.0, testutil.ToFloat64(m.Processed.WithLabelValues("uploads")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.Failed.WithLabelValues("uploads")))
+}
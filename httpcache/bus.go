@@ -0,0 +1,140 @@
+package httpcache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/hub"
+	"github.com/mirzakhany/gox/store"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultChannel is the postgres notification channel of invalidations.
+	DefaultChannel = "gox_httpcache_invalidate"
+	// DefaultReconnectDelay is the wait before listening again after losing the connection.
+	DefaultReconnectDelay = 5 * time.Second
+)
+
+// Notify sends an invalidation of tags to the PgInvalidator of every instance. within a transaction
+// the notification is only sent on commit, so instances do not cache the old data again.
+func Notify(ctx context.Context, db store.Querier, channel string, tags ...string) error {
+	_, err := db.Exec(ctx, "select pg_notify($1, $2)", channel, strings.Join(tags, ","))
+	return err
+}
+
+// parseTags splits the comma separated tags of a notification.
+func parseTags(payload string) []string {
+	var tags []string
+	for _, tag := range strings.Split(payload, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// PgInvalidator invalidates the tags of notifications sent with Notify on a postgres channel.
+type PgInvalidator struct {
+	cache   *Cache
+	pool    *pgxpool.Pool
+	channel string
+}
+
+func NewPgInvalidator(cache *Cache, pool *pgxpool.Pool, channel string) *PgInvalidator {
+	return &PgInvalidator{cache: cache, pool: pool, channel: channel}
+}
+
+func (i *PgInvalidator) Name() string {
+	return "httpcache-pg-invalidator"
+}
+
+// Run listens until ctx is done. notifications sent while the connection is lost are missed, so the
+// cache is purged whenever listening starts again.
+func (i *PgInvalidator) Run(ctx context.Context) error {
+	for {
+		err := i.listen(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		i.cache.logger.Error("httpcache invalidator lost database connection", zap.String("channel", i.channel), zap.Error(err))
+		i.cache.Purge()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(DefaultReconnectDelay):
+		}
+	}
+}
+
+func (i *PgInvalidator) listen(ctx context.Context) error {
+	conn, err := i.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "listen "+pgx.Identifier{i.channel}.Sanitize()); err != nil {
+		return err
+	}
+	// responses cached before listening may miss invalidations sent in between
+	i.cache.Purge()
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		i.cache.Invalidate(parseTags(n.Payload)...)
+	}
+}
+
+// HubInvalidator invalidates the tags of messages published on a hub topic, whose data is the comma
+// separated tags, for services which already fan out their events with a hub.
+type HubInvalidator struct {
+	cache *Cache
+	hub   *hub.Hub
+	topic string
+}
+
+func NewHubInvalidator(cache *Cache, h *hub.Hub, topic string) *HubInvalidator {
+	return &HubInvalidator{cache: cache, hub: h, topic: topic}
+}
+
+func (i *HubInvalidator) Name() string {
+	return "httpcache-hub-invalidator"
+}
+
+// Run subscribes to the topic until ctx is done. when the hub evicts the subscription for falling
+// behind, the cache is purged and it subscribes again.
+func (i *HubInvalidator) Run(ctx context.Context) error {
+	for {
+		sub, err := i.hub.Subscribe(ctx, i.topic)
+		if err != nil {
+			return err
+		}
+
+	receive:
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return nil
+			case msg := <-sub.C:
+				i.cache.Invalidate(parseTags(string(msg.Data))...)
+			case <-sub.Done():
+				break receive
+			}
+		}
+
+		if err := sub.Err(); err != hub.ErrSlowConsumer {
+			return err
+		}
+		i.cache.logger.Warn("httpcache invalidator fell behind, purging the cache", zap.String("topic", i.topic))
+		i.cache.Purge()
+	}
+}
@@ -0,0 +1,422 @@
+package httpcache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTTL bounds how long responses are cached when an invalidation is lost.
+	DefaultTTL        = 5 * time.Minute
+	DefaultMaxEntries = 10000
+)
+
+type Option func(*Cache) error
+
+// WithTTL sets how long responses are cached at most.
+func WithTTL(d time.Duration) Option {
+	return func(c *Cache) error {
+		if d <= 0 {
+			return errors.New("httpcache: ttl must be positive")
+		}
+		c.ttl = d
+		return nil
+	}
+}
+
+// WithMaxEntries sets how many responses are cached, the least recently used are evicted first.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) error {
+		if n <= 0 {
+			return errors.New("httpcache: max entries must be positive")
+		}
+		c.maxEntries = n
+		return nil
+	}
+}
+
+// WithKey sets the cache key of requests, the request uri by default. with the default key requests
+// with an Authorization or Cookie header are not cached, since their responses may differ by user.
+// a key including the user, like the subject of rest.ClaimsFromContext, lets them be cached too.
+func WithKey(fn func(r *http.Request) string) Option {
+	return func(c *Cache) error {
+		c.key = fn
+		c.customKey = true
+		return nil
+	}
+}
+
+// WithMetrics registers the gox_httpcache_requests_total counter, labeled by result "hit" or "miss",
+// and the gox_httpcache_invalidated_total counter with reg.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(c *Cache) error {
+		requests, err := metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "httpcache", Name: "requests_total",
+			Help: "Number of cacheable requests by result.",
+		}, []string{"result"}))
+		if err != nil {
+			return err
+		}
+		invalidated, err := metrics.Register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "httpcache", Name: "invalidated_total",
+			Help: "Number of cached responses removed by invalidations.",
+		}))
+		if err != nil {
+			return err
+		}
+		c.requests, c.invalidated = requests, invalidated
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(c *Cache) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+type entry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	tags    []string
+	expires time.Time
+	// vary holds the values of the request headers named by the Vary header of the response.
+	vary map[string]string
+}
+
+// pending is a response being recorded, invalidations of its tags while it is made keep it out of the cache.
+type pending struct {
+	tags        []string
+	invalidated map[string]bool
+	purged      bool
+}
+
+// Cache caches successful GET responses tagged with the entities they show, like "user:42", until the
+// ttl passes or one of their tags is invalidated. only responses tagged by their handler are cached.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	key        func(r *http.Request) string
+	customKey  bool
+	logger     *zap.Logger
+
+	requests    *prometheus.CounterVec
+	invalidated prometheus.Counter
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	tags    map[string]map[string]struct{}
+	pending map[*pending]struct{}
+}
+
+// New returns a response cache.
+// example:
+//
+//	cache, err := httpcache.New(httpcache.WithMetrics(prometheus.DefaultRegisterer))
+//	router.With(cache.Middleware).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+//		httpcache.Tag(r.Context(), "user:"+chi.URLParam(r, "id"))
+//		...
+//	})
+//	...
+//	// on every instance
+//	runner, err := gox.NewRunner(gox.WithComponents(httpcache.NewPgInvalidator(cache, pool, httpcache.DefaultChannel)))
+//	err = runner.Run(ctx)
+//	...
+//	// after updating the user
+//	err = httpcache.Notify(ctx, tx, httpcache.DefaultChannel, "user:42")
+func New(options ...Option) (*Cache, error) {
+	c := &Cache{
+		ttl:        DefaultTTL,
+		maxEntries: DefaultMaxEntries,
+		key:        func(r *http.Request) string { return r.URL.RequestURI() },
+		logger:     zap.NewNop(),
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		tags:       make(map[string]map[string]struct{}),
+		pending:    make(map[*pending]struct{}),
+	}
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+var pendingKey = ctxutil.NewKey[*pending]("httpcache pending response")
+
+// Tag tags the response of the request of ctx with tags, responses without tags are not cached.
+func Tag(ctx context.Context, tags ...string) {
+	if p, ok := pendingKey.Get(ctx); ok {
+		p.tags = append(p.tags, tags...)
+	}
+}
+
+// Middleware serves GET requests from the cache and caches the 200 responses handlers tagged, unless
+// they set cookies or a Cache-Control of no-store or private. cached responses are only served to
+// requests with the same values of the headers named by their Vary header, and responses with
+// Vary: * are not cached. requests with credentials are not cached unless WithKey is used.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !c.customKey && (r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := c.key(r)
+		now := clock.FromContext(r.Context()).Now()
+		if e, ok := c.get(key, r, now); ok {
+			c.observe("hit")
+			h := w.Header()
+			for k, v := range e.header {
+				h[k] = append([]string(nil), v...)
+			}
+			h.Set("X-Cache", "HIT")
+			w.WriteHeader(e.status)
+			_, _ = w.Write(e.body)
+			return
+		}
+		c.observe("miss")
+
+		p := &pending{}
+		c.mu.Lock()
+		c.pending[p] = struct{}{}
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			delete(c.pending, p)
+			c.mu.Unlock()
+		}()
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		rec.Header().Set("X-Cache", "MISS")
+		next.ServeHTTP(rec, r.WithContext(pendingKey.Set(r.Context(), p)))
+
+		if len(p.tags) == 0 || rec.status != http.StatusOK || rec.flushed || !cacheable(rec.Header()) {
+			return
+		}
+		header := rec.Header().Clone()
+		header.Del("X-Cache")
+		c.put(p, &entry{
+			key: key, status: rec.status, header: header, body: rec.body.Bytes(), tags: p.tags,
+			expires: now.Add(c.ttl), vary: varyValues(header, r),
+		})
+	})
+}
+
+// varyHeaders returns the request headers named by the Vary header of a response.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func varyValues(h http.Header, r *http.Request) map[string]string {
+	names := varyHeaders(h)
+	if len(names) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		values[name] = strings.Join(r.Header.Values(name), ",")
+	}
+	return values
+}
+
+func cacheable(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, name := range varyHeaders(h) {
+		if name == "*" {
+			return false
+		}
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+func (c *Cache) get(key string, r *http.Request, now time.Time) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !now.Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	for name, value := range e.vary {
+		if strings.Join(r.Header.Values(name), ",") != value {
+			return nil, false
+		}
+	}
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+func (c *Cache) put(p *pending, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p.purged {
+		return
+	}
+	for _, tag := range e.tags {
+		if p.invalidated[tag] {
+			return
+		}
+	}
+
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for _, tag := range e.tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the entry of el, c.mu must be held.
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	for _, tag := range e.tags {
+		if keys, ok := c.tags[tag]; ok {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+}
+
+// Invalidate removes the responses tagged with any of tags and returns how many were removed.
+// responses being made while it runs are not cached if they have one of the tags.
+func (c *Cache) Invalidate(tags ...string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for p := range c.pending {
+		if p.invalidated == nil {
+			p.invalidated = make(map[string]bool)
+		}
+		for _, tag := range tags {
+			p.invalidated[tag] = true
+		}
+	}
+
+	n := 0
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+				n++
+			}
+		}
+	}
+	if c.invalidated != nil {
+		c.invalidated.Add(float64(n))
+	}
+	return n
+}
+
+// Purge removes all responses, like when invalidations may have been lost.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.pending {
+		p.purged = true
+	}
+	c.entries = make(map[string]*list.Element)
+	c.tags = make(map[string]map[string]struct{})
+	c.lru.Init()
+}
+
+// Len returns the number of cached responses.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) observe(result string) {
+	if c.requests != nil {
+		c.requests.WithLabelValues(result).Inc()
+	}
+}
+
+// recorder copies the response into body while writing it.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	flushed     bool
+	body        bytes.Buffer
+}
+
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush passes the response through, streamed responses are not cached.
+func (w *recorder) Flush() {
+	w.flushed = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status == http.StatusOK && !w.flushed {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
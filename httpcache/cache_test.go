@@ -0,0 +1,202 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/mirzakhany/gox/hub"
+	"github.com/stretchr/testify/require"
+)
+
+func get(h http.Handler, ctx context.Context, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx))
+	return rec
+}
+
+func TestCache(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	c, err := New(WithTTL(time.Minute), WithMaxEntries(2))
+	require.NoError(t, err)
+
+	calls := 0
+	var before func()
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if before != nil {
+			before()
+		}
+		switch r.URL.Path {
+		case "/untagged":
+		case "/private":
+			Tag(r.Context(), "user:1")
+			w.Header().Set("Cache-Control", "private")
+		case "/missing":
+			Tag(r.Context(), "user:9")
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			Tag(r.Context(), "user:"+path.Base(r.URL.Path), "users")
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+
+	{ // tagged responses are served from the cache
+		rec := get(h, ctx, "/users/1")
+		require.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+		rec = get(h, ctx, "/users/1")
+		require.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		require.Equal(t, `{"path":"/users/1"}`, rec.Body.String())
+		require.Equal(t, 1, calls)
+	}
+
+	{ // untagged, private and failed responses are not cached
+		for _, p := range []string{"/untagged", "/private", "/missing"} {
+			get(h, ctx, p)
+			require.Equal(t, "MISS", get(h, ctx, p).Header().Get("X-Cache"), p)
+		}
+		require.Equal(t, 1, c.Len())
+	}
+
+	{ // invalidation by tag
+		get(h, ctx, "/users/2")
+		require.Equal(t, 1, c.Invalidate("user:1"))
+		require.Equal(t, "MISS", get(h, ctx, "/users/1").Header().Get("X-Cache"))
+		require.Equal(t, "HIT", get(h, ctx, "/users/2").Header().Get("X-Cache"))
+		require.Equal(t, 2, c.Invalidate("users"))
+		require.Zero(t, c.Len())
+	}
+
+	{ // responses made while their tags are invalidated are not cached
+		before = func() { c.Invalidate("user:3") }
+		get(h, ctx, "/users/3")
+		before = nil
+		require.Zero(t, c.Len())
+	}
+
+	{ // the least recently used response is evicted
+		get(h, ctx, "/users/1")
+		get(h, ctx, "/users/2")
+		get(h, ctx, "/users/1")
+		get(h, ctx, "/users/3")
+		require.Equal(t, 2, c.Len())
+		require.Equal(t, "HIT", get(h, ctx, "/users/1").Header().Get("X-Cache"))
+		require.Equal(t, "MISS", get(h, ctx, "/users/2").Header().Get("X-Cache"))
+	}
+
+	{ // expired responses
+		fake.Advance(time.Minute)
+		require.Equal(t, "MISS", get(h, ctx, "/users/1").Header().Get("X-Cache"))
+	}
+
+	{ // other methods pass through
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/1", nil).WithContext(ctx))
+		require.Empty(t, rec.Header().Get("X-Cache"))
+	}
+
+	{ // requests with credentials are not cached with the default key
+		for _, header := range []string{"Authorization", "Cookie"} {
+			req := httptest.NewRequest(http.MethodGet, "/users/5", nil).WithContext(ctx)
+			req.Header.Set(header, "secret")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Empty(t, rec.Header().Get("X-Cache"), header)
+		}
+		require.Equal(t, "MISS", get(h, ctx, "/users/5").Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	c, err := New()
+	require.NoError(t, err)
+
+	calls := 0
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		Tag(r.Context(), "page")
+		if r.URL.Path == "/any" {
+			w.Header().Set("Vary", "*")
+		} else {
+			w.Header().Add("Vary", "Accept")
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Accept")))
+	}))
+	do := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	{ // responses are only served to requests with the same varying headers
+		do("/page", "text/html")
+		rec := do("/page", "text/html")
+		require.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+		require.Equal(t, []string{"Accept"}, rec.Header().Values("Vary"))
+
+		rec = do("/page", "application/json")
+		require.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+		require.Equal(t, "application/json", rec.Body.String())
+		require.Equal(t, 2, calls)
+	}
+
+	{ // vary * is not cached
+		do("/any", "text/html")
+		require.Equal(t, "MISS", do("/any", "text/html").Header().Get("X-Cache"))
+	}
+
+	{ // custom keys may cache requests with credentials
+		c, err := New(WithKey(func(r *http.Request) string { return r.Header.Get("Authorization") + r.URL.Path }))
+		require.NoError(t, err)
+		h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Tag(r.Context(), "me")
+		}))
+		for _, want := range []string{"MISS", "HIT"} {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer a")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, want, rec.Header().Get("X-Cache"))
+		}
+	}
+}
+
+func TestHubInvalidator(t *testing.T) {
+	c, err := New()
+	require.NoError(t, err)
+	h, err := hub.New()
+	require.NoError(t, err)
+
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Tag(r.Context(), "order:42")
+	}))
+	get(handler, context.Background(), "/orders/42")
+	require.Equal(t, 1, c.Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- NewHubInvalidator(c, h, "invalidations").Run(ctx) }()
+
+	require.Eventually(t, func() bool { return h.Subscribers("invalidations") == 1 }, time.Second, time.Millisecond)
+	h.Publish(hub.Message{Topic: "invalidations", Data: []byte("order:41, order:42")})
+	require.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestParseTags(t *testing.T) {
+	require.Equal(t, []string{"a", "b"}, parseTags(" a,,b "))
+	require.Nil(t, parseTags(""))
+}
@@ -0,0 +1,220 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/rest"
+)
+
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned for requests to an upstream whose breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// Closed lets requests through
+	Closed State = iota
+	// Open fails requests at once, until the open timeout is over
+	Open
+	// HalfOpen lets a single trial request through, its result closes or opens the breaker again
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+type BreakerOption func(*Breaker) error
+
+// WithFailureThreshold sets the number of consecutive failures which open the breaker.
+func WithFailureThreshold(n int) BreakerOption {
+	return func(b *Breaker) error {
+		if n <= 0 {
+			return errors.New("failure threshold must be positive")
+		}
+		b.threshold = n
+		return nil
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before a trial request is let through.
+func WithOpenTimeout(d time.Duration) BreakerOption {
+	return func(b *Breaker) error {
+		b.openTimeout = d
+		return nil
+	}
+}
+
+func WithBreakerClock(c clock.Clock) BreakerOption {
+	return func(b *Breaker) error {
+		b.clock = c
+		return nil
+	}
+}
+
+// Breaker is a circuit breaker for an upstream. after the failure threshold of consecutive failures it
+// opens and fails requests at once, so a broken upstream is not waited on by every caller.
+type Breaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+	clock       clock.Clock
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func NewBreaker(name string, options ...BreakerOption) (*Breaker, error) {
+	b := &Breaker{
+		name:        name,
+		threshold:   DefaultFailureThreshold,
+		openTimeout: DefaultOpenTimeout,
+		clock:       clock.Real,
+	}
+	for _, o := range options {
+		if err := o(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the state of the breaker, an open breaker whose timeout is over is HalfOpen.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+func (b *Breaker) currentState() State {
+	if b.state == Open && b.clock.Since(b.openedAt) >= b.openTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Allow returns ErrCircuitOpen when a request must not be sent. callers which are allowed must report
+// the result with Record, or Skip.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case Open:
+		return ErrCircuitOpen
+	case HalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.state = HalfOpen
+		b.trial = true
+	}
+	return nil
+}
+
+// Record reports the result of an allowed request.
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.state = Closed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// Skip reports an allowed request whose result tells nothing about the upstream, like one canceled by
+// its caller. a trial request which is skipped lets the next one through.
+func (b *Breaker) Skip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// RetryAfter returns how long until the breaker lets a trial request through, zero unless it is open.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.currentState() != Open {
+		return 0
+	}
+	return b.openTimeout - b.clock.Since(b.openedAt)
+}
+
+// breakerTransport fails requests with ErrCircuitOpen while the breaker is open, errors and 5xx
+// responses count as failures. requests canceled by their caller do not count, while deadlines do since
+// they are how a slow upstream shows.
+type breakerTransport struct {
+	breaker *Breaker
+	next    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(req.Context().Err(), context.Canceled)) {
+		t.breaker.Skip()
+		return res, err
+	}
+	t.breaker.Record(err == nil && res.StatusCode < http.StatusInternalServerError)
+	return res, err
+}
+
+// RequireUpstream is a middleware for routes which can not be served without the upstream of b. while
+// b is open requests are answered at once with 503 and a Retry-After header, instead of holding a
+// worker until the upstream call fails.
+// example:
+//
+//	router.With(httpclient.RequireUpstream(paymentsBreaker)).Post("/checkout", checkout)
+func RequireUpstream(b *Breaker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if b.State() == Open {
+				seconds := int(b.RetryAfter().Seconds() + 0.999)
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				rest.WriteError(w, http.StatusServiceUnavailable, b.Name()+" is unavailable")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Now())
+	b, err := NewBreaker("payments", WithFailureThreshold(2), WithOpenTimeout(10*time.Second), WithBreakerClock(fake))
+	require.NoError(t, err)
+
+	require.NoError(t, b.Allow())
+	b.Record(false)
+	require.Equal(t, Closed, b.State())
+	require.NoError(t, b.Allow())
+	b.Record(false)
+	require.Equal(t, Open, b.State())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+	require.Equal(t, 10*time.Second, b.RetryAfter())
+
+	{ // a single trial after the timeout
+		fake.Advance(10 * time.Second)
+		require.Equal(t, HalfOpen, b.State())
+		require.NoError(t, b.Allow())
+		require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+		b.Record(false)
+		require.Equal(t, Open, b.State())
+	}
+
+	{ // a skipped trial lets the next one through
+		fake.Advance(10 * time.Second)
+		require.NoError(t, b.Allow())
+		b.Skip()
+		require.Equal(t, HalfOpen, b.State())
+	}
+
+	{ // a successful trial closes it
+		require.NoError(t, b.Allow())
+		b.Record(true)
+		require.Equal(t, Closed, b.State())
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	b, err := NewBreaker("payments", WithFailureThreshold(1))
+	require.NoError(t, err)
+	transport := &breakerTransport{breaker: b, next: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})}
+
+	{ // requests canceled by their caller do not count
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodGet, "http://payments/charge", nil).WithContext(ctx)
+		_, err := transport.RoundTrip(req)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, Closed, b.State())
+	}
+
+	{ // deadlines do
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "http://payments/charge", nil).WithContext(ctx)
+		_, err := transport.RoundTrip(req)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, Open, b.State())
+	}
+}
+
+func TestRequireUpstream(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Now())
+	b, err := NewBreaker("payments", WithFailureThreshold(1), WithBreakerClock(fake))
+	require.NoError(t, err)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	client, err := New(WithBreaker(b))
+	require.NoError(t, err)
+	res, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	_, err = client.Get(upstream.URL)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+
+	handler := RequireUpstream(b)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/checkout", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+}
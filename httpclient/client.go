@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const DefaultTimeout = 30 * time.Second
+
+type config struct {
+	timeout   time.Duration
+	transport http.RoundTripper
+	breaker   *Breaker
+	dns       *DNSCache
+	conf      *Config
+	trace     *TraceMetrics
+
+	middlewares []Middleware
+}
+
+type Option func(*config) error
+
+// WithTimeout sets the timeout of whole requests, DefaultTimeout by default.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) error {
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithTransport sets the transport the client is built on, a clone of http.DefaultTransport by default.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *config) error {
+		c.transport = rt
+		return nil
+	}
+}
+
+// WithBreaker fails requests at once while b is open, see Breaker.
+func WithBreaker(b *Breaker) Option {
+	return func(c *config) error {
+		c.breaker = b
+		return nil
+	}
+}
+
+// WithDNSCache resolves hosts with the cache c, see DNSCache. the transport must be a *http.Transport,
+// the client uses a clone of it so the one passed, which may be http.DefaultTransport, is not changed.
+// connections are dialed with the DialTimeout of WithConfig when it is set.
+func WithDNSCache(c *DNSCache) Option {
+	return func(cfg *config) error {
+		cfg.dns = c
+		return nil
+	}
+}
+
+// New returns a http client for calling an upstream.
+// example:
+//
+//	payments, err := httpclient.NewBreaker("payments")
+//	client, err := httpclient.New(httpclient.WithBreaker(payments), httpclient.WithTimeout(5*time.Second))
+func New(options ...Option) (*http.Client, error) {
+	cfg := &config{timeout: DefaultTimeout}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	rt := cfg.transport
+	if rt == nil {
+		rt = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if cfg.conf != nil || cfg.dns != nil {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return nil, errors.New("config and dns cache need a *http.Transport")
+		}
+		if cfg.transport != nil {
+			t = t.Clone()
+			rt = t
+		}
+		if cfg.conf != nil {
+			cfg.conf.apply(t)
+		}
+		if cfg.dns != nil {
+			// the cache dials with the dial timeout of the config when there is one
+			dialer := cfg.dns.dialer
+			if cfg.conf != nil {
+				if d := cfg.conf.dialer(); d != nil {
+					dialer = d
+				}
+			}
+			t.DialContext = cfg.dns.dialContext(dialer)
+		}
+	}
+	if cfg.trace != nil {
+		rt = &traceTransport{metrics: cfg.trace, next: rt}
+	}
+	if cfg.breaker != nil {
+		rt = &breakerTransport{breaker: cfg.breaker, next: rt}
+	}
+	for i := len(cfg.middlewares) - 1; i >= 0; i-- {
+		rt = cfg.middlewares[i](rt)
+	}
+
+	return &http.Client{Transport: rt, Timeout: cfg.timeout}, nil
+}
@@ -0,0 +1,80 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mirzakhany/gox/os"
+)
+
+// Config tunes the connection pool and timeouts of a client, zero values keep the defaults of
+// http.DefaultTransport. MaxIdleConnsPerHost is raised from the default of 2, which makes clients
+// sending many concurrent requests to one upstream open and close connections all the time.
+type Config struct {
+	Timeout               time.Duration `env:"HTTPCLIENT_TIMEOUT" envDefault:"30s"`
+	DialTimeout           time.Duration `env:"HTTPCLIENT_DIAL_TIMEOUT" envDefault:"30s"`
+	TLSHandshakeTimeout   time.Duration `env:"HTTPCLIENT_TLS_HANDSHAKE_TIMEOUT" envDefault:"10s"`
+	ResponseHeaderTimeout time.Duration `env:"HTTPCLIENT_RESPONSE_HEADER_TIMEOUT"`
+	IdleConnTimeout       time.Duration `env:"HTTPCLIENT_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	MaxIdleConns          int           `env:"HTTPCLIENT_MAX_IDLE_CONNS" envDefault:"100" validate:"gte=0"`
+	MaxIdleConnsPerHost   int           `env:"HTTPCLIENT_MAX_IDLE_CONNS_PER_HOST" envDefault:"32" validate:"gte=0"`
+	MaxConnsPerHost       int           `env:"HTTPCLIENT_MAX_CONNS_PER_HOST" validate:"gte=0"`
+}
+
+// LoadConfig loads the client config from env.
+func LoadConfig() (*Config, error) {
+	c := &Config{}
+	if err := os.LoadFromEnv(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WithConfig applies c to the transport and the timeout of the client, the transport must be a
+// *http.Transport. c is applied to a clone of it, the transport passed is not changed.
+// example:
+//
+//	cfg, err := httpclient.LoadConfig()
+//	client, err := httpclient.New(httpclient.WithConfig(cfg))
+func WithConfig(c *Config) Option {
+	return func(cfg *config) error {
+		cfg.conf = c
+		if c.Timeout > 0 {
+			cfg.timeout = c.Timeout
+		}
+		return nil
+	}
+}
+
+// dialer returns the dialer of DialTimeout, nil when it is not set.
+func (c *Config) dialer() *net.Dialer {
+	if c.DialTimeout <= 0 {
+		return nil
+	}
+	return &net.Dialer{Timeout: c.DialTimeout, KeepAlive: 30 * time.Second}
+}
+
+func (c *Config) apply(t *http.Transport) {
+	if d := c.dialer(); d != nil {
+		t.DialContext = d.DialContext
+	}
+	if c.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	if c.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	}
+	if c.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+}
@@ -0,0 +1,266 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultDNSTTL         = 30 * time.Second
+	DefaultDNSNegativeTTL = 5 * time.Second
+)
+
+// LookupFunc resolves host, ttl is how long the addresses may be cached. zero uses the ttl of the cache.
+type LookupFunc func(ctx context.Context, host string) (ips []net.IP, ttl time.Duration, err error)
+
+type DNSOption func(*DNSCache) error
+
+// WithDNSTTL sets how long addresses are cached when the lookup does not tell their ttl, which the
+// lookup of net.DefaultResolver never does. it also caps the ttl lookups return.
+func WithDNSTTL(d time.Duration) DNSOption {
+	return func(c *DNSCache) error {
+		c.ttl = d
+		return nil
+	}
+}
+
+// WithDNSNegativeTTL sets how long failed lookups are cached, zero disables negative caching.
+func WithDNSNegativeTTL(d time.Duration) DNSOption {
+	return func(c *DNSCache) error {
+		c.negativeTTL = d
+		return nil
+	}
+}
+
+// WithLookup replaces the lookup of net.DefaultResolver, like with one reading the record ttl.
+func WithLookup(fn LookupFunc) DNSOption {
+	return func(c *DNSCache) error {
+		c.lookup = fn
+		return nil
+	}
+}
+
+// WithDNSMetrics registers the gox_httpclient_dns_lookups_total counter, labeled by result "hit",
+// "miss" or "error", and the gox_httpclient_dns_lookup_duration_seconds histogram of misses with reg.
+func WithDNSMetrics(reg prometheus.Registerer) DNSOption {
+	return func(c *DNSCache) error {
+		lookups, err := metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "httpclient", Name: "dns_lookups_total",
+			Help: "Number of dns lookups by result, hit for ones answered from the cache.",
+		}, []string{"result"}))
+		if err != nil {
+			return err
+		}
+		duration, err := metrics.Register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metrics.Namespace, Subsystem: "httpclient", Name: "dns_lookup_duration_seconds",
+			Help:    "Time spent on dns lookups which missed the cache.",
+			Buckets: prometheus.DefBuckets,
+		}))
+		if err != nil {
+			return err
+		}
+		c.lookups, c.duration = lookups, duration
+		return nil
+	}
+}
+
+func WithDNSClock(cl clock.Clock) DNSOption {
+	return func(c *DNSCache) error {
+		c.clock = cl
+		return nil
+	}
+}
+
+type dnsEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+type dnsCall struct {
+	done chan struct{}
+	ips  []net.IP
+	err  error
+}
+
+// DNSCache resolves hosts for the client once per ttl, concurrent lookups of a host share one query
+// and failed lookups are cached for the negative ttl, so high request rates do not flood the resolver.
+type DNSCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	lookup      LookupFunc
+	clock       clock.Clock
+	dialer      *net.Dialer
+
+	lookups  *prometheus.CounterVec
+	duration prometheus.Histogram
+
+	mu        sync.Mutex
+	entries   map[string]dnsEntry
+	inflight  map[string]*dnsCall
+	lastSweep time.Time
+}
+
+// NewDNSCache returns a dns cache, pass it to the client with WithDNSCache.
+// example:
+//
+//	dns, err := httpclient.NewDNSCache(httpclient.WithDNSMetrics(prometheus.DefaultRegisterer))
+//	client, err := httpclient.New(httpclient.WithDNSCache(dns))
+func NewDNSCache(options ...DNSOption) (*DNSCache, error) {
+	c := &DNSCache{
+		ttl:         DefaultDNSTTL,
+		negativeTTL: DefaultDNSNegativeTTL,
+		lookup:      defaultLookup,
+		clock:       clock.Real,
+		dialer:      &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries:     make(map[string]dnsEntry),
+		inflight:    make(map[string]*dnsCall),
+	}
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func defaultLookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, 0, nil
+}
+
+// LookupIP returns the addresses of host, from the cache while they are fresh.
+func (c *DNSCache) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[host]; ok && c.clock.Now().Before(e.expires) {
+		c.mu.Unlock()
+		c.observe("hit")
+		return e.ips, e.err
+	}
+	if call, ok := c.inflight[host]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			c.observe("hit")
+			return call.ips, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &dnsCall{done: make(chan struct{})}
+	c.inflight[host] = call
+	c.mu.Unlock()
+
+	start := c.clock.Now()
+	// the query is shared by the waiting callers, so it must not end with the context of this one
+	ips, ttl, err := c.lookup(context.Background(), host)
+	if c.duration != nil {
+		c.duration.Observe(c.clock.Since(start).Seconds())
+	}
+	if err == nil && len(ips) == 0 {
+		err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	if err != nil {
+		ttl = c.negativeTTL
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, host)
+	now := c.clock.Now()
+	if ttl > 0 {
+		c.entries[host] = dnsEntry{ips: ips, err: err, expires: now.Add(ttl)}
+	}
+	c.sweep(now)
+	c.mu.Unlock()
+
+	call.ips, call.err = ips, err
+	close(call.done)
+
+	if err != nil {
+		c.observe("error")
+	} else {
+		c.observe("miss")
+	}
+	return ips, err
+}
+
+// DialContext dials addr on one of the cached addresses of its host, trying them in order.
+func (c *DNSCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return c.dial(ctx, c.dialer, network, addr)
+}
+
+// dialContext is DialContext with dialer, for clients configured with their own dial timeout.
+func (c *DNSCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return c.dial(ctx, dialer, network, addr)
+	}
+}
+
+func (c *DNSCache) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := c.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no addresses to dial")
+	}
+	return nil, errs[0]
+}
+
+// sweep removes expired entries at most once per ttl, so hosts which are not called anymore do not
+// stay in the cache. it must be called with mu held.
+func (c *DNSCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for host, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, host)
+		}
+	}
+}
+
+func (c *DNSCache) observe(result string) {
+	if c.lookups != nil {
+		c.lookups.WithLabelValues(result).Inc()
+	}
+}
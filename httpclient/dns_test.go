@@ -0,0 +1,108 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSCache(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Now())
+	lookups := 0
+	lookup := func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		lookups++
+		if host == "missing.test" {
+			return nil, 0, errors.New("no such host")
+		}
+		return []net.IP{net.ParseIP("127.0.0.1")}, 10 * time.Second, nil
+	}
+
+	reg := prometheus.NewRegistry()
+	c, err := NewDNSCache(WithLookup(lookup), WithDNSClock(fake), WithDNSMetrics(reg))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	{ // cached until the record ttl is over
+		_, err := c.LookupIP(ctx, "api.test")
+		require.NoError(t, err)
+		_, err = c.LookupIP(ctx, "api.test")
+		require.NoError(t, err)
+		require.Equal(t, 1, lookups)
+
+		fake.Advance(10 * time.Second)
+		_, err = c.LookupIP(ctx, "api.test")
+		require.NoError(t, err)
+		require.Equal(t, 2, lookups)
+	}
+
+	{ // failures are cached for the negative ttl
+		_, err := c.LookupIP(ctx, "missing.test")
+		require.Error(t, err)
+		_, err = c.LookupIP(ctx, "missing.test")
+		require.Error(t, err)
+		require.Equal(t, 3, lookups)
+
+		fake.Advance(DefaultDNSNegativeTTL)
+		_, err = c.LookupIP(ctx, "missing.test")
+		require.Error(t, err)
+		require.Equal(t, 4, lookups)
+	}
+
+	{ // expired entries are evicted
+		fake.Advance(time.Hour)
+		_, err := c.LookupIP(ctx, "api.test")
+		require.NoError(t, err)
+		require.Len(t, c.entries, 1)
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+	require.Equal(t, 2.0, testutil.ToFloat64(c.lookups.WithLabelValues("hit")))
+	require.Equal(t, 3.0, testutil.ToFloat64(c.lookups.WithLabelValues("miss")))
+	require.Equal(t, 2.0, testutil.ToFloat64(c.lookups.WithLabelValues("error")))
+}
+
+func TestClientWithDNSCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	c, err := NewDNSCache(WithLookup(func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		require.Equal(t, "upstream.test", host)
+		return []net.IP{net.ParseIP("127.0.0.1")}, 0, nil
+	}))
+	require.NoError(t, err)
+
+	client, err := New(WithDNSCache(c))
+	require.NoError(t, err)
+
+	// the default transport is not changed
+	other, err := New(WithTransport(http.DefaultTransport), WithDNSCache(c))
+	require.NoError(t, err)
+	require.NotSame(t, http.DefaultTransport, other.Transport)
+	res, err := client.Get("http://upstream.test:" + u.Port())
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	{ // the dial timeout of the config is kept
+		client, err := New(WithConfig(&Config{DialTimeout: time.Nanosecond}), WithDNSCache(c))
+		require.NoError(t, err)
+		_, err = client.Get("http://upstream.test:" + u.Port())
+		var nerr net.Error
+		require.ErrorAs(t, err, &nerr)
+		require.True(t, nerr.Timeout())
+	}
+}
@@ -0,0 +1,132 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mirzakhany/gox/clock"
+	"go.uber.org/zap"
+)
+
+// DefaultRedactedHeaders are the headers whose values are never logged.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+type logConfig struct {
+	redacted   map[string]bool
+	sampleRate float64
+	maxBody    int
+}
+
+type LogOption func(*logConfig)
+
+// WithRedactedHeaders redacts the values of headers in addition to DefaultRedactedHeaders.
+func WithRedactedHeaders(headers ...string) LogOption {
+	return func(c *logConfig) {
+		for _, h := range headers {
+			c.redacted[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// WithBodySampling logs the headers and the first maxBytes of the bodies of a rate share of requests,
+// from 0 to 1, for debugging integrations. bodies can hold personal data, keep the rate low in production.
+func WithBodySampling(rate float64, maxBytes int) LogOption {
+	return func(c *logConfig) {
+		c.sampleRate = rate
+		c.maxBody = maxBytes
+	}
+}
+
+// Logger logs outgoing requests with their method, url, status, duration and request id. failed
+// requests are logged as errors and 5xx responses as warnings.
+func Logger(logger *zap.Logger, options ...LogOption) Middleware {
+	cfg := &logConfig{redacted: make(map[string]bool)}
+	WithRedactedHeaders(DefaultRedactedHeaders...)(cfg)
+	for _, o := range options {
+		o(cfg)
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			clk := clock.FromContext(req.Context())
+			sampled := cfg.sampleRate > 0 && rand.Float64() < cfg.sampleRate
+
+			fields := []zap.Field{
+				zap.String("method", req.Method),
+				zap.String("url", req.URL.Redacted()),
+			}
+			if id := req.Header.Get(middleware.RequestIDHeader); id != "" {
+				fields = append(fields, zap.String("request_id", id))
+			} else if id := middleware.GetReqID(req.Context()); id != "" {
+				fields = append(fields, zap.String("request_id", id))
+			}
+
+			if sampled {
+				fields = append(fields, zap.Any("request_headers", cfg.redact(req.Header)))
+				if req.Body != nil && req.Body != http.NoBody {
+					var body []byte
+					req = req.Clone(req.Context())
+					body, req.Body = peekBody(req.Body, cfg.maxBody)
+					fields = append(fields, zap.ByteString("request_body", body))
+				}
+			}
+
+			t0 := clk.Now()
+			res, err := next.RoundTrip(req)
+			fields = append(fields, zap.Duration("latency", clk.Since(t0)))
+
+			if err != nil {
+				logger.Error("outgoing request failed", append(fields, zap.Error(err))...)
+				return res, err
+			}
+
+			fields = append(fields, zap.Int("code", res.StatusCode))
+			if sampled {
+				var body []byte
+				body, res.Body = peekBody(res.Body, cfg.maxBody)
+				fields = append(fields, zap.Any("response_headers", cfg.redact(res.Header)), zap.ByteString("response_body", body))
+			}
+
+			logFunc := logger.Info
+			if res.StatusCode >= http.StatusInternalServerError {
+				logFunc = logger.Warn
+			}
+			logFunc("outgoing request", fields...)
+			return res, nil
+		})
+	}
+}
+
+func (c *logConfig) redact(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if c.redacted[http.CanonicalHeaderKey(k)] {
+			out[k] = "<redacted>"
+			continue
+		}
+		if len(v) > 0 {
+			out[k] = v[0]
+		}
+	}
+	return out
+}
+
+// peekBody reads up to max bytes of body and returns them with a body still yielding all of it.
+func peekBody(body io.ReadCloser, max int) ([]byte, io.ReadCloser) {
+	buf, err := io.ReadAll(io.LimitReader(body, int64(max)))
+	rest := io.MultiReader(bytes.NewReader(buf), body)
+	if err != nil {
+		rest = io.MultiReader(bytes.NewReader(buf), errReader{err})
+	}
+	return buf, struct {
+		io.Reader
+		io.Closer
+	}{rest, body}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
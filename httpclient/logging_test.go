@@ -0,0 +1,55 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoggerMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "req-1", r.Header.Get(middleware.RequestIDHeader))
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write(append([]byte("echo "), body...))
+	}))
+	defer server.Close()
+
+	logger, logs := goxtest.NewObservedLogger()
+	client, err := New(WithMiddlewares(PropagateRequestID(), Logger(logger, WithBodySampling(1, 1024), WithRedactedHeaders("x-signature"))))
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/orders", strings.NewReader("hello"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Signature", "abc")
+
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, "echo hello", string(body))
+
+	entries := logs.FindEntries(zapcore.InfoLevel, "outgoing request")
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, "req-1", fields["request_id"])
+	require.EqualValues(t, http.StatusOK, fields["code"])
+	require.Equal(t, "hello", fields["request_body"])
+	require.Equal(t, "echo hello", fields["response_body"])
+
+	headers := fields["request_headers"].(map[string]string)
+	require.Equal(t, "<redacted>", headers["Authorization"])
+	require.Equal(t, "<redacted>", headers["X-Signature"])
+	require.Equal(t, "<redacted>", fields["response_headers"].(map[string]string)["Set-Cookie"])
+}
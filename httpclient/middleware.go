@@ -0,0 +1,48 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Middleware wraps the transport of a client, like the middlewares of http handlers.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to use a function as a http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddlewares wraps the transport of the client with middlewares, the first one sees requests first.
+// example:
+//
+//	client, err := httpclient.New(httpclient.WithMiddlewares(
+//		httpclient.PropagateRequestID(),
+//		httpclient.Logger(logger, httpclient.WithBodySampling(0.01, 4096)),
+//	))
+func WithMiddlewares(middlewares ...Middleware) Option {
+	return func(c *config) error {
+		c.middlewares = append(c.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// PropagateRequestID sets the X-Request-Id header of outgoing requests to the id of the incoming request
+// in their context, set by the RequestID middleware of the server, so calls can be correlated across services.
+func PropagateRequestID() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			id := middleware.GetReqID(req.Context())
+			if id == "" || req.Header.Get(middleware.RequestIDHeader) != "" {
+				return next.RoundTrip(req)
+			}
+			// round trippers must not modify the request they are given
+			req = req.Clone(req.Context())
+			req.Header.Set(middleware.RequestIDHeader, id)
+			return next.RoundTrip(req)
+		})
+	}
+}
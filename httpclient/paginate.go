@@ -0,0 +1,286 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+)
+
+const (
+	// DefaultMaxThrottleRetries is how often a page is retried after being throttled.
+	DefaultMaxThrottleRetries = 5
+	// DefaultMaxThrottleWait is the longest an api can make the iterator wait, it fails on longer waits.
+	DefaultMaxThrottleWait = 5 * time.Minute
+)
+
+// Style reads the items of the page in res, the response to req, and returns the request for the next
+// page, nil on the last page.
+type Style[T any] func(req *http.Request, res *http.Response) (items []T, next *http.Request, err error)
+
+// DecodeFunc reads the items of a page from its response.
+type DecodeFunc[T any] func(res *http.Response) ([]T, error)
+
+// DecodeJSON reads pages whose body is a json array of items.
+func DecodeJSON[T any](res *http.Response) ([]T, error) {
+	var items []T
+	err := json.NewDecoder(res.Body).Decode(&items)
+	return items, err
+}
+
+// DecodeJSONField reads pages whose body is a json object holding the items in field.
+func DecodeJSONField[T any](field string) DecodeFunc[T] {
+	return func(res *http.Response) ([]T, error) {
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		var items []T
+		if raw, ok := body[field]; ok {
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+}
+
+// LinkHeader follows the rel="next" url of the Link header, like the GitHub api. links to another
+// scheme or host are rejected, the next request would send them the credentials of req.
+func LinkHeader[T any](decode DecodeFunc[T]) Style[T] {
+	return func(req *http.Request, res *http.Response) ([]T, *http.Request, error) {
+		items, err := decode(res)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		link := nextLink(res.Header.Values("Link"))
+		if link == "" {
+			return items, nil, nil
+		}
+		u, err := req.URL.Parse(link)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid next link %q: %w", link, err)
+		}
+		if u.Scheme != req.URL.Scheme || !strings.EqualFold(u.Host, req.URL.Host) {
+			return nil, nil, fmt.Errorf("next link %s leaves %s://%s", u.Redacted(), req.URL.Scheme, req.URL.Host)
+		}
+		next := req.Clone(req.Context())
+		next.URL = u
+		next.Host = ""
+		return items, next, nil
+	}
+}
+
+// Cursor sets the param query parameter to the cursor decode returns with the items, until it is empty.
+func Cursor[T any](param string, decode func(res *http.Response) (items []T, cursor string, err error)) Style[T] {
+	return func(req *http.Request, res *http.Response) ([]T, *http.Request, error) {
+		items, cursor, err := decode(res)
+		if err != nil || cursor == "" {
+			return items, nil, err
+		}
+		return items, withQuery(req, param, cursor), nil
+	}
+}
+
+// PageLimit requests pages 1, 2 and so on of limit items with the pageParam and limitParam query
+// parameters, until a page has less than limit items.
+func PageLimit[T any](pageParam, limitParam string, limit int, decode DecodeFunc[T]) Style[T] {
+	return func(req *http.Request, res *http.Response) ([]T, *http.Request, error) {
+		items, err := decode(res)
+		if err != nil || len(items) < limit {
+			return items, nil, err
+		}
+
+		page := 1
+		if p, err := strconv.Atoi(req.URL.Query().Get(pageParam)); err == nil {
+			page = p
+		}
+		next := withQuery(req, pageParam, strconv.Itoa(page+1))
+		return items, withQuery(next, limitParam, strconv.Itoa(limit)), nil
+	}
+}
+
+// Iterator walks the items of a paginated api page by page. it waits when the api asks to with a
+// Retry-After header on 429 and 503 responses, or with X-RateLimit-Remaining of 0 until X-RateLimit-Reset,
+// up to DefaultMaxThrottleWait.
+type Iterator[T any] struct {
+	client *http.Client
+	req    *http.Request
+	style  Style[T]
+
+	items   []T
+	current T
+	err     error
+	wait    time.Duration
+}
+
+// Paginate returns an iterator over the items of the pages starting with req, which must have no body.
+// example:
+//
+//	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/orgs/go/repos", nil)
+//	it := httpclient.Paginate(client, req, httpclient.LinkHeader(httpclient.DecodeJSON[Repo]))
+//	for it.Next() {
+//		repo := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func Paginate[T any](client *http.Client, req *http.Request, style Style[T]) *Iterator[T] {
+	return &Iterator[T]{client: client, req: req, style: style}
+}
+
+// Next moves to the next item, fetching the next page when needed. it returns false after the last
+// item or on errors.
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.req == nil || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.current, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err returns the error which stopped the iteration.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All returns the remaining items.
+func (it *Iterator[T]) All() ([]T, error) {
+	var all []T
+	for it.Next() {
+		all = append(all, it.Value())
+	}
+	return all, it.Err()
+}
+
+func (it *Iterator[T]) fetch() {
+	ctx := it.req.Context()
+	clk := clock.FromContext(ctx)
+
+	for attempt := 0; ; attempt++ {
+		if it.wait > 0 {
+			select {
+			case <-clk.After(it.wait):
+			case <-ctx.Done():
+				it.err = ctx.Err()
+				return
+			}
+			it.wait = 0
+		}
+
+		res, err := it.client.Do(it.req)
+		if err != nil {
+			it.err = err
+			return
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+			wait, ok := retryAfter(res.Header, clk.Now())
+			if !ok || wait > DefaultMaxThrottleWait || attempt >= DefaultMaxThrottleRetries {
+				it.err = fmt.Errorf("%s %s: throttled with status %d", it.req.Method, it.req.URL.Redacted(), res.StatusCode)
+				return
+			}
+			it.wait = wait
+			continue
+		}
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			res.Body.Close()
+			it.err = fmt.Errorf("%s %s: unexpected status %d", it.req.Method, it.req.URL.Redacted(), res.StatusCode)
+			return
+		}
+
+		items, next, err := it.style(it.req, res)
+		res.Body.Close()
+		if err != nil {
+			it.err = err
+			return
+		}
+		if res.Header.Get("X-RateLimit-Remaining") == "0" && next != nil {
+			it.wait = rateLimitReset(res.Header.Get("X-RateLimit-Reset"), clk.Now())
+			if it.wait > DefaultMaxThrottleWait {
+				// the items of this page are kept, the iteration stops after them
+				it.items = items
+				it.err = fmt.Errorf("%s %s: rate limit resets in %s", it.req.Method, it.req.URL.Redacted(), it.wait)
+				return
+			}
+		}
+		it.items, it.req = items, next
+		return
+	}
+}
+
+// retryAfter reads the Retry-After header, given in seconds or as a http date.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// rateLimitReset reads the X-RateLimit-Reset header, which apis give as a unix time or in seconds from now.
+func rateLimitReset(v string, now time.Time) time.Duration {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	// no api waits for decades, larger values are unix times
+	if n > 1e9 {
+		return time.Unix(n, 0).Sub(now)
+	}
+	return time.Duration(n) * time.Second
+}
+
+// nextLink returns the rel="next" url of Link header values.
+func nextLink(values []string) string {
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, p := range parts[1:] {
+				p = strings.TrimSpace(p)
+				if p == `rel="next"` || p == "rel=next" {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func withQuery(req *http.Request, key, value string) *http.Request {
+	next := req.Clone(req.Context())
+	u := *req.URL
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	next.URL = &u
+	return next
+}
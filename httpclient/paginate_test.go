@@ -0,0 +1,162 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	page := func(r *http.Request, size int) ([]int, int) {
+		p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if p == 0 {
+			p = 1
+		}
+		start := (p - 1) * size
+		end := start + size
+		if end > len(items) {
+			end = len(items)
+		}
+		return items[start:end], p
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		got, p := page(r, 2)
+		if p*2 < len(items) {
+			w.Header().Set("Link", `</link?page=`+strconv.Itoa(p+1)+`>; rel="next", </link?page=1>; rel="first"`)
+		}
+		_ = json.NewEncoder(w).Encode(got)
+	})
+	mux.HandleFunc("/leak", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<https://evil.example.com/link?page=2>; rel="next"`)
+		_ = json.NewEncoder(w).Encode(items[:1])
+	})
+	mux.HandleFunc("/cursor", func(w http.ResponseWriter, r *http.Request) {
+		p, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		body := map[string]interface{}{"items": items[p : p+1]}
+		if p+1 < len(items) {
+			body["next"] = strconv.Itoa(p + 1)
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	})
+	mux.HandleFunc("/pages", func(w http.ResponseWriter, r *http.Request) {
+		got, _ := page(r, 2)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": got})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		return req
+	}
+
+	{ // link header
+		got, err := Paginate(server.Client(), get("/link"), LinkHeader(DecodeJSON[int])).All()
+		require.NoError(t, err)
+		require.Equal(t, items, got)
+	}
+
+	{ // links to other hosts are not followed
+		got, err := Paginate(server.Client(), get("/leak"), LinkHeader(DecodeJSON[int])).All()
+		require.ErrorContains(t, err, "leaves")
+		require.Empty(t, got)
+	}
+
+	{ // cursor
+		decode := func(res *http.Response) ([]int, string, error) {
+			var body struct {
+				Items []int  `json:"items"`
+				Next  string `json:"next"`
+			}
+			err := json.NewDecoder(res.Body).Decode(&body)
+			return body.Items, body.Next, err
+		}
+		got, err := Paginate(server.Client(), get("/cursor"), Cursor("cursor", decode)).All()
+		require.NoError(t, err)
+		require.Equal(t, items, got)
+	}
+
+	{ // page and limit
+		got, err := Paginate(server.Client(), get("/pages"), PageLimit("page", "limit", 2, DecodeJSONField[int]("data"))).All()
+		require.NoError(t, err)
+		require.Equal(t, items, got)
+	}
+}
+
+func TestPaginateThrottled(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]int{calls})
+	}))
+	defer server.Close()
+
+	fake := goxtest.NewFakeClock(time.Now())
+	req, err := http.NewRequestWithContext(clock.WithContext(context.Background(), fake), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	it := Paginate(server.Client(), req, LinkHeader(DecodeJSON[int]))
+
+	done := make(chan bool)
+	go func() { done <- it.Next() }()
+
+	require.Eventually(t, func() bool { return fake.Waiters() == 1 }, time.Second, time.Millisecond)
+	fake.Advance(3 * time.Second)
+	require.True(t, <-done)
+	require.Equal(t, 2, it.Value())
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+}
+
+func TestPaginateThrottledTooLong(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Link", `</?page=2>; rel="next"`)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "3600")
+		_ = json.NewEncoder(w).Encode([]int{1})
+	}))
+	defer server.Close()
+
+	{ // long retry afters fail right away
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		_, err = Paginate(server.Client(), req, LinkHeader(DecodeJSON[int])).All()
+		require.ErrorContains(t, err, "throttled")
+	}
+
+	{ // so do long rate limit resets, after the items of the page
+		req, err := http.NewRequest(http.MethodGet, server.URL+"?page=1", nil)
+		require.NoError(t, err)
+		got, err := Paginate(server.Client(), req, LinkHeader(DecodeJSON[int])).All()
+		require.ErrorContains(t, err, "rate limit resets in 1h0m0s")
+		require.Equal(t, []int{1}, got)
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	require.Equal(t, 30*time.Second, rateLimitReset("30", now))
+	require.Equal(t, time.Minute, rateLimitReset("1700000060", now))
+	require.Equal(t, time.Duration(0), rateLimitReset("", now))
+}
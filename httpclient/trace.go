@@ -0,0 +1,118 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TraceMetrics are the metrics of the phases of outgoing requests, labeled by the host they went to.
+type TraceMetrics struct {
+	// Phase is labeled by phase "dns", "connect", "tls" and "ttfb", the time from sending the request
+	// to the first byte of the response
+	Phase *prometheus.HistogramVec
+	// Connections is labeled by reused "true" or "false", the reuse ratio tells if the pool is too small
+	Connections *prometheus.CounterVec
+}
+
+// NewTraceMetrics registers the gox_httpclient_phase_duration_seconds histogram and the
+// gox_httpclient_connections_total counter with reg.
+func NewTraceMetrics(reg prometheus.Registerer) (*TraceMetrics, error) {
+	phase, err := metrics.Register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace, Subsystem: "httpclient", Name: "phase_duration_seconds",
+		Help:    "Time spent in the dns, connect, tls and time to first byte phases of outgoing requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"host", "phase"}))
+	if err != nil {
+		return nil, err
+	}
+	conns, err := metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace, Subsystem: "httpclient", Name: "connections_total",
+		Help: "Number of connections used by outgoing requests, by whether they were reused from the pool.",
+	}, []string{"host", "reused"}))
+	if err != nil {
+		return nil, err
+	}
+	return &TraceMetrics{Phase: phase, Connections: conns}, nil
+}
+
+// WithTraceMetrics records the phases of each request in m.
+// example:
+//
+//	m, err := httpclient.NewTraceMetrics(prometheus.DefaultRegisterer)
+//	client, err := httpclient.New(httpclient.WithTraceMetrics(m))
+func WithTraceMetrics(m *TraceMetrics) Option {
+	return func(c *config) error {
+		c.trace = m
+		return nil
+	}
+}
+
+type traceTransport struct {
+	metrics *TraceMetrics
+	next    http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clk := clock.FromContext(req.Context())
+	host := req.URL.Host
+	observe := func(phase string, start time.Time) {
+		if !start.IsZero() {
+			t.metrics.Phase.WithLabelValues(host, phase).Observe(clk.Since(start).Seconds())
+		}
+	}
+
+	// the hooks run on the goroutines of the transport, the dial of a request may even outlive it and
+	// addresses are dialed in parallel, so the timings of the request are guarded and kept per address
+	var (
+		mu                          sync.Mutex
+		dnsStart, tlsStart, wroteAt time.Time
+		connectStart                = map[string]time.Time{}
+	)
+	set := func(t *time.Time) {
+		mu.Lock()
+		*t = clk.Now()
+		mu.Unlock()
+	}
+	done := func(phase string, t *time.Time) {
+		mu.Lock()
+		start := *t
+		mu.Unlock()
+		observe(phase, start)
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(&dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { done("dns", &dnsStart) },
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[network+" "+addr] = clk.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, _ error) {
+			mu.Lock()
+			start := connectStart[network+" "+addr]
+			delete(connectStart, network+" "+addr)
+			mu.Unlock()
+			observe("connect", start)
+		},
+		TLSHandshakeStart: func() { set(&tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { done("tls", &tlsStart) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused := "false"
+			if info.Reused {
+				reused = "true"
+			}
+			t.metrics.Connections.WithLabelValues(host, reused).Inc()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&wroteAt) },
+		GotFirstResponseByte: func() { done("ttfb", &wroteAt) },
+	}
+
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
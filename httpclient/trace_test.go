@@ -0,0 +1,73 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	m, err := NewTraceMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+	client, err := New(WithTraceMetrics(m))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(server.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	require.Equal(t, 1.0, testutil.ToFloat64(m.Connections.WithLabelValues(u.Host, "false")))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.Connections.WithLabelValues(u.Host, "true")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.Phase), "connect and ttfb phases")
+
+	{ // concurrent requests keep their own timings
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := client.Get(server.URL)
+				if err == nil {
+					res.Body.Close()
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, 11.0, testutil.ToFloat64(m.Connections.WithLabelValues(u.Host, "false"))+
+			testutil.ToFloat64(m.Connections.WithLabelValues(u.Host, "true")))
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("HTTPCLIENT_MAX_IDLE_CONNS_PER_HOST", "64")
+	t.Setenv("HTTPCLIENT_RESPONSE_HEADER_TIMEOUT", "2s")
+
+	c, err := LoadConfig()
+	require.NoError(t, err)
+	require.Equal(t, 64, c.MaxIdleConnsPerHost)
+	require.Equal(t, 30*time.Second, c.Timeout)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	client, err := New(WithTransport(transport), WithConfig(c))
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, client.Timeout)
+	applied := client.Transport.(*http.Transport)
+	require.Equal(t, 64, applied.MaxIdleConnsPerHost)
+	require.Equal(t, 2*time.Second, applied.ResponseHeaderTimeout)
+	// the transport passed is not changed
+	require.Zero(t, transport.ResponseHeaderTimeout)
+}
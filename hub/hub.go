@@ -0,0 +1,224 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const DefaultBufferSize = 64
+
+var (
+	// ErrSlowConsumer is the reason of subscriptions evicted because their buffer was full.
+	ErrSlowConsumer = errors.New("subscriber is too slow, messages were dropped")
+	ErrHubClosed    = errors.New("hub is closed")
+)
+
+// Message is published to a topic and delivered to its subscribers.
+type Message struct {
+	Topic string
+	// Event is an optional name of the message, it is the event field of server sent events
+	Event string
+	Data  []byte
+}
+
+// Authorizer decides whether the subscriber of ctx may receive messages of topic.
+type Authorizer func(ctx context.Context, topic string) error
+
+type Option func(*Hub) error
+
+// WithAuthorizer checks every topic of Subscribe.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(h *Hub) error {
+		h.authorize = authorize
+		return nil
+	}
+}
+
+// WithBufferSize sets how many messages a subscriber can fall behind before it is evicted.
+func WithBufferSize(n int) Option {
+	return func(h *Hub) error {
+		if n <= 0 {
+			return errors.New("hub: buffer size must be positive")
+		}
+		h.bufferSize = n
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(h *Hub) error {
+		h.logger = logger
+		return nil
+	}
+}
+
+// Hub fans out published messages to the subscribers of their topic. Publish never blocks: a subscriber
+// whose buffer is full is evicted, so one slow client can not hold back the others.
+// example:
+//
+//	h, err := hub.New(hub.WithAuthorizer(canReadOrder))
+//	router.Get("/orders/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+//		h.ServeSSE(w, r, "order:"+chi.URLParam(r, "id"))
+//	})
+//	...
+//	h.Publish(hub.Message{Topic: "order:42", Event: "shipped", Data: payload})
+type Hub struct {
+	authorize  Authorizer
+	bufferSize int
+	logger     *zap.Logger
+
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+func New(options ...Option) (*Hub, error) {
+	h := &Hub{
+		bufferSize: DefaultBufferSize,
+		logger:     zap.NewNop(),
+		topics:     make(map[string]map[*Subscription]struct{}),
+	}
+	for _, o := range options {
+		if err := o(h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Subscription receives the messages of its topics from C until it is closed or evicted.
+type Subscription struct {
+	C <-chan Message
+
+	hub    *Hub
+	topics []string
+	ch     chan Message
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Subscribe returns a subscription to topics, after the authorizer allowed each of them.
+// the subscription is closed when ctx is done.
+func (h *Hub) Subscribe(ctx context.Context, topics ...string) (*Subscription, error) {
+	if h.authorize != nil {
+		for _, topic := range topics {
+			if err := h.authorize(ctx, topic); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ch := make(chan Message, h.bufferSize)
+	s := &Subscription{C: ch, hub: h, topics: topics, ch: ch, done: make(chan struct{})}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, ErrHubClosed
+	}
+	for _, topic := range topics {
+		subs, ok := h.topics[topic]
+		if !ok {
+			subs = make(map[*Subscription]struct{})
+			h.topics[topic] = subs
+		}
+		subs[s] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.close(nil)
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// Publish delivers msg to the subscribers of its topic and returns how many received it.
+func (h *Hub) Publish(msg Message) int {
+	h.mu.RLock()
+	var slow []*Subscription
+	delivered := 0
+	for s := range h.topics[msg.Topic] {
+		select {
+		case s.ch <- msg:
+			delivered++
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, s := range slow {
+		h.logger.Warn("evicting slow subscriber", zap.String("topic", msg.Topic), zap.Strings("topics", s.topics))
+		s.close(ErrSlowConsumer)
+	}
+	return delivered
+}
+
+// Subscribers returns the number of subscribers of topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+// Close closes all subscriptions, later calls to Subscribe fail with ErrHubClosed.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	var subs []*Subscription
+	for _, topicSubs := range h.topics {
+		for s := range topicSubs {
+			subs = append(subs, s)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, s := range subs {
+		s.close(ErrHubClosed)
+	}
+}
+
+// Done is closed when the subscription is closed or evicted, Err tells why.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns ErrSlowConsumer or ErrHubClosed when the subscription was ended by the hub, and nil otherwise.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close unsubscribes s.
+func (s *Subscription) Close() {
+	s.close(nil)
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		h := s.hub
+		h.mu.Lock()
+		for _, topic := range s.topics {
+			delete(h.topics[topic], s)
+			if len(h.topics[topic]) == 0 {
+				delete(h.topics, topic)
+			}
+		}
+		h.mu.Unlock()
+
+		s.err = err
+		close(s.done)
+	})
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	h, err := New(WithBufferSize(1), WithAuthorizer(func(ctx context.Context, topic string) error {
+		if strings.HasPrefix(topic, "private:") {
+			return errors.New("forbidden")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+
+	{ // topics are authorized
+		_, err := h.Subscribe(context.Background(), "orders", "private:1")
+		require.EqualError(t, err, "forbidden")
+		require.Zero(t, h.Subscribers("orders"))
+	}
+
+	{ // messages fan out to subscribers of the topic
+		a, err := h.Subscribe(context.Background(), "orders")
+		require.NoError(t, err)
+		b, err := h.Subscribe(context.Background(), "orders", "users")
+		require.NoError(t, err)
+
+		require.Equal(t, 2, h.Publish(Message{Topic: "orders", Data: []byte("1")}))
+		require.Equal(t, "1", string((<-a.C).Data))
+		require.Equal(t, "1", string((<-b.C).Data))
+
+		a.Close()
+		b.Close()
+		require.Zero(t, h.Subscribers("orders"))
+		require.Zero(t, h.Subscribers("users"))
+	}
+
+	{ // slow subscribers are evicted
+		slow, err := h.Subscribe(context.Background(), "orders")
+		require.NoError(t, err)
+		require.Equal(t, 1, h.Publish(Message{Topic: "orders"}))
+		require.Equal(t, 0, h.Publish(Message{Topic: "orders"}))
+
+		<-slow.Done()
+		require.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+		require.Zero(t, h.Subscribers("orders"))
+	}
+
+	{ // canceled contexts unsubscribe
+		ctx, cancel := context.WithCancel(context.Background())
+		sub, err := h.Subscribe(ctx, "orders")
+		require.NoError(t, err)
+		cancel()
+		<-sub.Done()
+		require.NoError(t, sub.Err())
+	}
+}
+
+func TestServeSSE(t *testing.T) {
+	h, err := New()
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeSSE(w, r, "orders")
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	require.Eventually(t, func() bool { return h.Subscribers("orders") == 1 }, time.Second, 10*time.Millisecond)
+	h.Publish(Message{Topic: "orders", Event: "shipped", Data: []byte("a\nb")})
+
+	reader := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	require.Equal(t, []string{"event: shipped", "data: a", "data: b"}, lines)
+}
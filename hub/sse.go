@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+)
+
+// DefaultKeepAlive is the interval of comments sent to keep idle server sent event streams open
+// through proxies.
+const DefaultKeepAlive = 30 * time.Second
+
+// ServeSSE streams the messages of topics to the client as server sent events until the request ends
+// or the subscriber is evicted, then the client is expected to reconnect. authorization errors are
+// written with WriteErr, with status 403 unless they carry their own code.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request, topics ...string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rest.WriteError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	sub, err := h.Subscribe(r.Context(), topics...)
+	if err != nil {
+		if errs.CodeOf(err) == errs.CodeUnknown {
+			err = errs.WithCode(err, errs.CodePermissionDenied)
+		}
+		rest.WriteErr(w, err)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(DefaultKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg := <-sub.C:
+			if _, err := w.Write(encodeEvent(msg)); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+func encodeEvent(msg Message) []byte {
+	var b bytes.Buffer
+	if msg.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", msg.Event)
+	}
+	for _, line := range bytes.Split(msg.Data, []byte("\n")) {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
@@ -0,0 +1,218 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	GIF  Format = "gif"
+	WebP Format = "webp"
+	AVIF Format = "avif"
+)
+
+// DefaultJPEGQuality is used by Encode when quality is not set.
+const DefaultJPEGQuality = 85
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions exceed the limit")
+	ErrTooSmall          = errors.New("image dimensions are below the limit")
+)
+
+// Limits restricts images accepted by Decode. zero values mean no limit.
+type Limits struct {
+	MinWidth, MinHeight int
+	MaxWidth, MaxHeight int
+	// Formats allowed to be decoded, all supported formats are allowed if empty
+	Formats []Format
+}
+
+// ContentType returns the mime type of format.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Decode reads an image from r after checking its type and dimensions against limits. dimensions are
+// checked using only the image header, so oversized images are rejected before being decoded.
+// decoding drops all metadata, EXIF included, so re-encoding a decoded image strips it.
+func Decode(r io.Reader, limits Limits) (image.Image, Format, error) {
+	var header bytes.Buffer
+	br := bufio.NewReader(io.TeeReader(r, &header))
+
+	cfg, name, err := image.DecodeConfig(br)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, "", ErrUnsupportedFormat
+		}
+		return nil, "", err
+	}
+
+	format := Format(name)
+	if len(limits.Formats) > 0 && !containFormat(limits.Formats, format) {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	if (limits.MaxWidth > 0 && cfg.Width > limits.MaxWidth) || (limits.MaxHeight > 0 && cfg.Height > limits.MaxHeight) {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	if cfg.Width < limits.MinWidth || cfg.Height < limits.MinHeight {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrTooSmall, cfg.Width, cfg.Height)
+	}
+
+	// header holds everything read while decoding the config, replay it before the rest of r
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, "", err
+	}
+	return img, format, nil
+}
+
+// Encoder writes img to w, quality is the one passed to Encode.
+type Encoder func(w io.Writer, img image.Image, quality int) error
+
+var encoders = map[Format]Encoder{}
+
+// RegisterEncoder makes Encode use encode for format, replacing the built in one if any. it is meant
+// to be called from init, like image.RegisterFormat. avif has no pure go codec, register an encoder
+// for it and its decoder with image.RegisterFormat to support it.
+// example:
+//
+//	func init() {
+//		image.RegisterFormat("avif", "????ftypavif", avif.Decode, avif.DecodeConfig)
+//		imaging.RegisterEncoder(imaging.AVIF, func(w io.Writer, img image.Image, quality int) error {
+//			return avif.Encode(w, img, avif.Options{Quality: quality})
+//		})
+//	}
+func RegisterEncoder(format Format, encode Encoder) {
+	encoders[format] = encode
+}
+
+// Encode writes img to w in given format. quality is only used for jpeg, DefaultJPEGQuality is used when 0,
+// and by registered encoders. webp is written lossless, avif needs an encoder set by RegisterEncoder.
+func Encode(w io.Writer, img image.Image, format Format, quality int) error {
+	if encode, ok := encoders[format]; ok {
+		return encode(w, img, quality)
+	}
+
+	switch format {
+	case JPEG:
+		if quality <= 0 {
+			quality = DefaultJPEGQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case PNG:
+		return png.Encode(w, img)
+	case GIF:
+		return gif.Encode(w, img, nil)
+	case WebP:
+		return encodeWebP(w, img)
+	default:
+		return fmt.Errorf("%w: can not encode %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// Resize scales img to width x height. if one of width or height is 0 it is calculated to keep the aspect ratio.
+// empty images and negative sizes are returned as is.
+func Resize(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	if (width <= 0 && height <= 0) || width < 0 || height < 0 || b.Empty() {
+		return img
+	}
+	if width == 0 {
+		width = atLeastOne(b.Dx() * height / b.Dy())
+	}
+	if height == 0 {
+		height = atLeastOne(b.Dy() * width / b.Dx())
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// Fit scales img down to fit in maxWidth x maxHeight keeping the aspect ratio. smaller images are returned as is.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxWidth && b.Dy() <= maxHeight {
+		return img
+	}
+
+	// compare width/height ratios without floats
+	if b.Dx()*maxHeight > b.Dy()*maxWidth {
+		return Resize(img, maxWidth, 0)
+	}
+	return Resize(img, 0, maxHeight)
+}
+
+// Crop returns the part of img inside rect.
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Add(img.Bounds().Min).Intersect(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// Fill scales and center crops img to exactly width x height, useful for thumbnails.
+func Fill(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	if b.Dx()*height > b.Dy()*width {
+		img = Resize(img, 0, height)
+	} else {
+		img = Resize(img, width, 0)
+	}
+
+	b = img.Bounds()
+	x := (b.Dx() - width) / 2
+	y := (b.Dy() - height) / 2
+	return Crop(img, image.Rect(x, y, x+width, y+height))
+}
+
+// DetectFormat sniffs the format of an image from its first bytes.
+func DetectFormat(head []byte) (Format, error) {
+	switch http.DetectContentType(head) {
+	case "image/jpeg":
+		return JPEG, nil
+	case "image/png":
+		return PNG, nil
+	case "image/gif":
+		return GIF, nil
+	case "image/webp":
+		return WebP, nil
+	}
+	if len(head) >= 12 && string(head[4:12]) == "ftypavif" {
+		return AVIF, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func containFormat(formats []Format, f Format) bool {
+	for _, v := range formats {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	data := testPNG(t, 200, 100)
+
+	img, format, err := Decode(bytes.NewReader(data), Limits{MaxWidth: 200, MaxHeight: 200})
+	require.NoError(t, err)
+	require.Equal(t, PNG, format)
+	require.Equal(t, 200, img.Bounds().Dx())
+
+	_, _, err = Decode(bytes.NewReader(data), Limits{MaxWidth: 100})
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	_, _, err = Decode(bytes.NewReader(data), Limits{MinHeight: 101})
+	require.ErrorIs(t, err, ErrTooSmall)
+
+	_, _, err = Decode(bytes.NewReader(data), Limits{Formats: []Format{JPEG}})
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	_, _, err = Decode(bytes.NewReader([]byte("not an image")), Limits{})
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestProcess(t *testing.T) {
+	data := testPNG(t, 200, 100)
+
+	{ // fit keeps aspect ratio
+		var out bytes.Buffer
+		format, err := Process(&out, bytes.NewReader(data), Options{Width: 50, Height: 50, Format: JPEG})
+		require.NoError(t, err)
+		require.Equal(t, JPEG, format)
+
+		cfg, name, err := image.DecodeConfig(&out)
+		require.NoError(t, err)
+		require.Equal(t, "jpeg", name)
+		require.Equal(t, 50, cfg.Width)
+		require.Equal(t, 25, cfg.Height)
+	}
+
+	{ // fill crops to exact size
+		var out bytes.Buffer
+		_, err := Process(&out, bytes.NewReader(data), Options{Width: 40, Height: 40, Fill: true})
+		require.NoError(t, err)
+
+		cfg, name, err := image.DecodeConfig(&out)
+		require.NoError(t, err)
+		require.Equal(t, "png", name)
+		require.Equal(t, 40, cfg.Width)
+		require.Equal(t, 40, cfg.Height)
+	}
+
+	{ // webp is encoded lossless
+		var out bytes.Buffer
+		format, err := Process(&out, bytes.NewReader(data), Options{Format: WebP})
+		require.NoError(t, err)
+		require.Equal(t, WebP, format)
+
+		img, format, err := Decode(&out, Limits{Formats: []Format{WebP}})
+		require.NoError(t, err)
+		require.Equal(t, WebP, format)
+		original, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		requireSamePixels(t, original, img)
+	}
+
+	{ // avif needs a registered encoder
+		var out bytes.Buffer
+		_, err := Process(&out, bytes.NewReader(data), Options{Format: AVIF})
+		require.ErrorIs(t, err, ErrUnsupportedFormat)
+
+		RegisterEncoder(AVIF, func(w io.Writer, img image.Image, quality int) error {
+			_, err := fmt.Fprintf(w, "avif %dx%d q%d", img.Bounds().Dx(), img.Bounds().Dy(), quality)
+			return err
+		})
+		defer delete(encoders, AVIF)
+		_, err = Process(&out, bytes.NewReader(data), Options{Format: AVIF, Width: 20, Quality: 60})
+		require.NoError(t, err)
+		require.Equal(t, "avif 20x10 q60", out.String())
+	}
+}
+
+func TestEncodeWebP(t *testing.T) {
+	images := map[string]image.Image{
+		"single color": image.NewUniform(color.NRGBA{R: 10, G: 20, B: 30, A: 255}),
+		"transparent":  image.NewNRGBA(image.Rect(0, 0, 3, 5)),
+	}
+	two := image.NewNRGBA(image.Rect(10, 10, 17, 12))
+	two.Set(12, 11, color.NRGBA{R: 255, A: 128})
+	images["two colors with an offset"] = two
+	noise := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for i := range noise.Pix {
+		noise.Pix[i] = uint8(i*i*7 + i/3)
+	}
+	images["noise"] = noise
+
+	for name, img := range images {
+		if u, ok := img.(*image.Uniform); ok {
+			img = Crop(u, image.Rect(0, 0, 4, 4))
+		}
+		var out bytes.Buffer
+		require.NoError(t, Encode(&out, img, WebP, 0), name)
+		decoded, err := webp.Decode(&out)
+		require.NoError(t, err, name)
+		requireSamePixels(t, img, decoded)
+	}
+
+	require.ErrorIs(t, Encode(io.Discard, image.NewNRGBA(image.Rect(0, 0, 0, 0)), WebP, 0), ErrUnsupportedFormat)
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	// fibonacci frequencies build the deepest trees
+	freq := []int{1, 1}
+	for len(freq) < 30 {
+		freq = append(freq, freq[len(freq)-1]+freq[len(freq)-2])
+	}
+	lengths := huffmanLengths(freq, 15)
+
+	kraft := 0
+	for _, l := range lengths {
+		require.LessOrEqual(t, l, 15)
+		require.Greater(t, l, 0)
+		kraft += 1 << (15 - l)
+	}
+	require.Equal(t, 1<<15, kraft)
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 2))
+	require.Equal(t, image.Rect(0, 0, 100, 1), Resize(img, 100, 0).Bounds())
+	require.Equal(t, image.Rect(0, 0, 1, 1), Fit(image.NewRGBA(image.Rect(0, 0, 2, 300)), 1, 1).Bounds())
+
+	empty := image.NewRGBA(image.Rect(0, 0, 0, 10))
+	require.Equal(t, empty, Resize(empty, 0, 5))
+	require.Equal(t, img, Resize(img, -1, 5))
+}
+
+func requireSamePixels(t *testing.T, want, got image.Image) {
+	wb, gb := want.Bounds(), got.Bounds()
+	require.Equal(t, wb.Size(), gb.Size())
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.NRGBA)
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+			if w.A == 0 {
+				require.Zero(t, g.A, "%d,%d", x, y)
+				continue
+			}
+			require.Equal(t, w, g, "%d,%d", x, y)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	f, err := DetectFormat(testPNG(t, 1, 1))
+	require.NoError(t, err)
+	require.Equal(t, PNG, f)
+
+	_, err = DetectFormat([]byte("plain text"))
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+}
@@ -0,0 +1,59 @@
+package imaging
+
+import (
+	"image"
+	"io"
+)
+
+// Options describes how Process transforms an image.
+type Options struct {
+	Limits Limits
+	// Width and Height of the output, image is scaled to fit in them keeping its aspect ratio unless Fill is set
+	Width, Height int
+	// Fill crops the image to exactly Width x Height after scaling
+	Fill bool
+	// Format of the output, same as input if empty
+	Format Format
+	// Quality of jpeg output
+	Quality int
+}
+
+// Process decodes an image from r, transforms it according to opts and encodes it to w. as the image
+// is re-encoded, the output never contains the metadata of the input.
+// w can be a blob storage writer or an io.Pipe so the result is streamed while being encoded.
+// example:
+//
+//	format, err := imaging.Process(dst, r.Body, imaging.Options{
+//		Limits: imaging.Limits{MaxWidth: 8000, MaxHeight: 8000, Formats: []imaging.Format{imaging.JPEG, imaging.PNG}},
+//		Width:  512, Height: 512, Fill: true,
+//		Format: imaging.JPEG,
+//	})
+func Process(w io.Writer, r io.Reader, opts Options) (Format, error) {
+	img, format, err := Decode(r, opts.Limits)
+	if err != nil {
+		return "", err
+	}
+
+	img = transform(img, opts)
+
+	if opts.Format != "" {
+		format = opts.Format
+	}
+	if err := Encode(w, img, format, opts.Quality); err != nil {
+		return "", err
+	}
+	return format, nil
+}
+
+func transform(img image.Image, opts Options) image.Image {
+	switch {
+	case opts.Width == 0 && opts.Height == 0:
+		return img
+	case opts.Fill && opts.Width > 0 && opts.Height > 0:
+		return Fill(img, opts.Width, opts.Height)
+	case opts.Width > 0 && opts.Height > 0:
+		return Fit(img, opts.Width, opts.Height)
+	default:
+		return Resize(img, opts.Width, opts.Height)
+	}
+}
@@ -0,0 +1,288 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// maxWebPSize is the largest width or height a lossless webp image can have.
+const maxWebPSize = 1 << 14
+
+// encodeWebP writes img as a lossless webp. it only uses the subtract green transform and huffman
+// coded literals, which keeps it simple while still compressing flat images well.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > maxWebPSize || b.Dy() > maxWebPSize {
+		return fmt.Errorf("%w: can not encode %dx%d as webp", ErrUnsupportedFormat, b.Dx(), b.Dy())
+	}
+
+	src, ok := img.(*image.NRGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+
+	// pixels as green, red, blue and alpha symbols, with green subtracted from red and blue
+	pix := make([][4]uint8, 0, width*height)
+	alpha := false
+	for y := 0; y < height; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+4*width]
+		for x := 0; x < len(row); x += 4 {
+			r, g, b, a := row[x], row[x+1], row[x+2], row[x+3]
+			pix = append(pix, [4]uint8{g, r - g, b - g, a})
+			alpha = alpha || a != 0xff
+		}
+	}
+
+	var bw bitWriter
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	bw.write(1, 1) // a transform follows
+	bw.write(2, 2) // subtract green
+	bw.write(0, 1) // no more transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // a single huffman group
+
+	// green has 24 backward reference length codes after the literals, the distance code is unused
+	codes := make([][]huffmanCode, 4)
+	for i := range codes {
+		var freq [256]int
+		for _, p := range pix {
+			freq[p[i]]++
+		}
+		size := 256
+		if i == 0 {
+			size += 24
+		}
+		codes[i] = bw.writeHuffman(freq[:], size)
+	}
+	bw.writeHuffman(nil, 40)
+
+	for _, p := range pix {
+		for i, c := range codes {
+			bw.writeCode(c[p[i]])
+		}
+	}
+	data := bw.bytes()
+
+	var buf bytes.Buffer
+	chunkSize := len(data) + len(data)%2
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(4+8+chunkSize))
+	buf.WriteString("WEBPVP8L")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// bitWriter packs bits least significant first, as webp lossless streams are read.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+type huffmanCode struct {
+	// bits holds the code reversed, so it can be written least significant bit first
+	bits uint32
+	len  uint
+}
+
+func (w *bitWriter) writeCode(c huffmanCode) {
+	w.write(c.bits, c.len)
+}
+
+// writeHuffman writes a prefix code for symbols with freq in an alphabet of size and returns it.
+func (w *bitWriter) writeHuffman(freq []int, size int) []huffmanCode {
+	var used []int
+	for s, f := range freq {
+		if f > 0 {
+			used = append(used, s)
+		}
+	}
+
+	// up to two 8 bit symbols fit the simple code, a single symbol takes no bits at all
+	if len(used) <= 2 {
+		codes := make([]huffmanCode, len(freq))
+		w.write(1, 1)
+		switch len(used) {
+		case 0:
+			w.write(0, 1)
+			w.write(0, 1)
+			w.write(0, 1)
+		case 1:
+			w.write(0, 1)
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		case 2:
+			w.write(1, 1)
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+			w.write(uint32(used[1]), 8)
+			codes[used[1]] = huffmanCode{bits: 1, len: 1}
+		}
+		for _, s := range used {
+			codes[s].len = uint(len(used) - 1)
+		}
+		return codes
+	}
+
+	lengths := huffmanLengths(freq, 15)
+
+	// code lengths are written with a code of their own, every length 0 to 15 gets 4 bits
+	w.write(0, 1)
+	w.write(19-4, 4)
+	for _, s := range []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15} {
+		if s < 16 {
+			w.write(4, 3)
+		} else {
+			w.write(0, 3)
+		}
+	}
+	w.write(0, 1) // lengths of all symbols follow
+	for s := 0; s < size; s++ {
+		l := 0
+		if s < len(lengths) {
+			l = lengths[s]
+		}
+		w.write(reverseBits(uint32(l), 4), 4)
+	}
+	return canonicalCodes(lengths)
+}
+
+// huffmanLengths returns code lengths for freq no longer than limit. frequencies are flattened until
+// the tree is shallow enough.
+func huffmanLengths(freq []int, limit int) []int {
+	freq = append([]int(nil), freq...)
+	for {
+		lengths := treeLengths(freq)
+		longest := 0
+		for _, l := range lengths {
+			if l > longest {
+				longest = l
+			}
+		}
+		if longest <= limit {
+			return lengths
+		}
+		for i, f := range freq {
+			if f > 0 {
+				freq[i] = f/2 + 1
+			}
+		}
+	}
+}
+
+func treeLengths(freq []int) []int {
+	type node struct {
+		freq        int
+		symbol      int
+		left, right *node
+	}
+	var leaves []*node
+	for s, f := range freq {
+		if f > 0 {
+			leaves = append(leaves, &node{freq: f, symbol: s})
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].freq < leaves[j].freq })
+
+	// merge the two lightest nodes until one is left, leaves and merged nodes are both kept sorted
+	var merged []*node
+	pop := func() *node {
+		if len(merged) == 0 || (len(leaves) > 0 && leaves[0].freq <= merged[0].freq) {
+			n := leaves[0]
+			leaves = leaves[1:]
+			return n
+		}
+		n := merged[0]
+		merged = merged[1:]
+		return n
+	}
+	for len(leaves)+len(merged) > 1 {
+		a, b := pop(), pop()
+		merged = append(merged, &node{freq: a.freq + b.freq, symbol: -1, left: a, right: b})
+	}
+
+	lengths := make([]int, len(freq))
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		if n.symbol >= 0 {
+			lengths[n.symbol] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(pop(), 0)
+	return lengths
+}
+
+// canonicalCodes assigns codes to lengths the way the decoder rebuilds them.
+func canonicalCodes(lengths []int) []huffmanCode {
+	var count [16]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < len(next); l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+
+	codes := make([]huffmanCode, len(lengths))
+	for s, l := range lengths {
+		if l > 0 {
+			codes[s] = huffmanCode{bits: reverseBits(next[l], uint(l)), len: uint(l)}
+			next[l]++
+		}
+	}
+	return codes
+}
+
+func reverseBits(v uint32, n uint) uint32 {
+	r := uint32(0)
+	for i := uint(0); i < n; i++ {
+		r = r<<1 | v>>i&1
+	}
+	return r
+}
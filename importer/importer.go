@@ -0,0 +1,366 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mirzakhany/gox/validation"
+)
+
+const DefaultBatchSize = 500
+
+type Format int
+
+const (
+	CSV Format = iota
+	NDJSON
+)
+
+// RowError describes why a row of the input was rejected. Row is 1-based and does not count the csv header.
+type RowError struct {
+	Row     int
+	Field   string
+	Message string
+}
+
+func (e RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.Message)
+}
+
+// Result is the summary of an import.
+type Result struct {
+	Total    int
+	Imported int
+	Errors   []RowError
+}
+
+// ErrorReport returns the rejected rows as an iterator, ready to be sent to the user with rest.WriteCSV
+// using ErrorReportHeaders.
+func (r *Result) ErrorReport() func() ([]string, error) {
+	i := 0
+	return func() ([]string, error) {
+		if i == len(r.Errors) {
+			return nil, io.EOF
+		}
+		e := r.Errors[i]
+		i++
+		return []string{strconv.Itoa(e.Row), e.Field, e.Message}, nil
+	}
+}
+
+var ErrorReportHeaders = []string{"row", "field", "error"}
+
+type config struct {
+	batchSize int
+	maxErrors int
+	validate  *validator.Validate
+}
+
+type Option func(*config) error
+
+// WithBatchSize sets the number of valid rows passed to each insert call.
+func WithBatchSize(size int) Option {
+	return func(c *config) error {
+		if size <= 0 {
+			return fmt.Errorf("invalid batch size %d", size)
+		}
+		c.batchSize = size
+		return nil
+	}
+}
+
+// WithMaxErrors stops the import with ErrTooManyErrors once more than max rows are rejected.
+func WithMaxErrors(max int) Option {
+	return func(c *config) error {
+		c.maxErrors = max
+		return nil
+	}
+}
+
+// WithValidator sets the validator used to validate rows, validation.Default is used if not set.
+func WithValidator(v *validator.Validate) Option {
+	return func(c *config) error {
+		c.validate = v
+		return nil
+	}
+}
+
+var ErrTooManyErrors = errors.New("too many invalid rows")
+
+// Import streams rows of r into values of T, validates them using `validate` tags and passes the valid
+// ones to insert in batches. invalid rows do not stop the import, they are collected in the result.
+// csv columns are matched to struct fields by `csv` tag, then `json` tag, then field name.
+// example:
+//
+//	type user struct {
+//		Email string `csv:"email" validate:"required,email"`
+//		Age   int    `csv:"age" validate:"gte=0"`
+//	}
+//
+//	res, err := importer.Import(ctx, r.Body, importer.CSV, func(ctx context.Context, users []user) error {
+//		return insertUsers(ctx, pool, users)
+//	})
+func Import[T any](ctx context.Context, r io.Reader, format Format, insert func(ctx context.Context, rows []T) error, options ...Option) (*Result, error) {
+	cfg := &config{batchSize: DefaultBatchSize}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.validate == nil {
+		cfg.validate = validation.Default()
+	}
+
+	var next func(*T) error
+	switch format {
+	case CSV:
+		d, err := newCSVDecoder[T](r)
+		if err != nil {
+			return nil, err
+		}
+		next = d.decode
+	case NDJSON:
+		next = newJSONDecoder[T](r)
+	default:
+		return nil, fmt.Errorf("unknown import format %d", format)
+	}
+
+	res := &Result{}
+	batch := make([]T, 0, cfg.batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := insert(ctx, batch); err != nil {
+			return err
+		}
+		res.Imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		var v T
+		err := next(&v)
+		if err == io.EOF {
+			break
+		}
+		res.Total++
+
+		var rowErr RowError
+		if errors.As(err, &rowErr) {
+			rowErr.Row = res.Total
+			res.Errors = append(res.Errors, rowErr)
+		} else if err != nil {
+			return res, err
+		} else if verrs := validationErrors(res.Total, cfg.validate.StructCtx(ctx, v)); len(verrs) > 0 {
+			res.Errors = append(res.Errors, verrs...)
+		} else {
+			batch = append(batch, v)
+		}
+
+		if cfg.maxErrors > 0 && len(res.Errors) > cfg.maxErrors {
+			return res, ErrTooManyErrors
+		}
+
+		if len(batch) == cfg.batchSize {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	return res, flush()
+}
+
+func validationErrors(row int, err error) []RowError {
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []RowError{{Row: row, Message: err.Error()}}
+	}
+
+	out := make([]RowError, 0, len(verrs))
+	for _, e := range verrs {
+		out = append(out, RowError{Row: row, Field: e.Field(), Message: fmt.Sprintf("failed on the '%s' rule", e.Tag())})
+	}
+	return out
+}
+
+func newJSONDecoder[T any](r io.Reader) func(*T) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	return func(v *T) error {
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if line == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(line), v); err != nil {
+				return RowError{Message: err.Error()}
+			}
+			return nil
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+}
+
+type csvDecoder[T any] struct {
+	r      *csv.Reader
+	fields []int
+	names  []string
+}
+
+func newCSVDecoder[T any](r io.Reader) (*csvDecoder[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("csv import target must be a struct, got %s", t)
+	}
+
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv input is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		byName[strings.ToLower(columnName(f))] = i
+	}
+
+	d := &csvDecoder[T]{r: cr, fields: make([]int, len(header)), names: make([]string, len(header))}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		d.names[i] = h
+		idx, ok := byName[strings.ToLower(h)]
+		if !ok {
+			idx = -1
+		}
+		d.fields[i] = idx
+	}
+	return d, nil
+}
+
+func (d *csvDecoder[T]) decode(v *T) error {
+	record, err := d.r.Read()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return RowError{Message: perr.Err.Error()}
+		}
+		return err
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	for i, value := range record {
+		if i >= len(d.fields) || d.fields[i] < 0 {
+			continue
+		}
+		if err := setField(rv.Field(d.fields[i]), value); err != nil {
+			return RowError{Field: d.names[i], Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+func columnName(f reflect.StructField) string {
+	for _, tag := range []string{"csv", "json"} {
+		if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func setField(f reflect.Value, value string) error {
+	if f.Kind() == reflect.Pointer {
+		if value == "" {
+			return nil
+		}
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+
+	if f.CanAddr() && f.Addr().Type().Implements(textUnmarshalerType) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", value)
+			}
+			f.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
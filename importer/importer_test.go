@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Email string `csv:"email" json:"email" validate:"required,email"`
+	Age   int    `json:"age" validate:"gte=0"`
+	Admin *bool  `json:"admin"`
+}
+
+func TestImportCSV(t *testing.T) {
+	input := "email,age,admin\n" +
+		"foo@example.com,20,true\n" +
+		"not-an-email,30,\n" +
+		"bar@example.com,abc,false\n" +
+		"zar@example.com,40,\n"
+
+	var batches [][]user
+	res, err := Import(context.Background(), strings.NewReader(input), CSV, func(_ context.Context, rows []user) error {
+		batches = append(batches, append([]user(nil), rows...))
+		return nil
+	}, WithBatchSize(1))
+	require.NoError(t, err)
+
+	require.Equal(t, 4, res.Total)
+	require.Equal(t, 2, res.Imported)
+	require.Len(t, batches, 2)
+	require.Equal(t, "foo@example.com", batches[0][0].Email)
+	require.True(t, *batches[0][0].Admin)
+	require.Nil(t, batches[1][0].Admin)
+
+	require.Len(t, res.Errors, 2)
+	require.Equal(t, RowError{Row: 2, Field: "Email", Message: "failed on the 'email' rule"}, res.Errors[0])
+	require.Equal(t, 3, res.Errors[1].Row)
+	require.Equal(t, "age", res.Errors[1].Field)
+
+	report := res.ErrorReport()
+	row, err := report()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "Email", "failed on the 'email' rule"}, row)
+}
+
+func TestImportNDJSON(t *testing.T) {
+	input := `{"email": "foo@example.com", "age": 1}` + "\n\n" +
+		`{"email": "bar@example.com", "age": -1}` + "\n" +
+		`{"email": ` + "\n"
+
+	var imported []user
+	res, err := Import(context.Background(), strings.NewReader(input), NDJSON, func(_ context.Context, rows []user) error {
+		imported = append(imported, rows...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, res.Total)
+	require.Len(t, imported, 1)
+	require.Len(t, res.Errors, 2)
+
+	{ // import should stop after max errors
+		_, err := Import(context.Background(), strings.NewReader(input), NDJSON, func(_ context.Context, rows []user) error {
+			return nil
+		}, WithMaxErrors(1))
+		require.ErrorIs(t, err, ErrTooManyErrors)
+	}
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"github.com/mirzakhany/gox/errs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Err returns a field logging err as an object instead of a flat message. besides the message it has
+// the code, the chain of causes, the metadata of errs.Error values and the stack trace if recorded.
+// example:
+//
+//	logger.Error("sync users failed", log.Err(err))
+//	// "error": {"message": "...", "code": "Internal", "chain": ["sync users", "connection reset"], "stack": "..."}
+func Err(err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+	return zap.Object("error", errorObject{err})
+}
+
+type errorObject struct {
+	err error
+}
+
+func (e errorObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("message", e.err.Error())
+	enc.AddString("code", errs.CodeOf(e.err).String())
+
+	if chain := errs.Chain(e.err); len(chain) > 1 {
+		if err := enc.AddArray("chain", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, msg := range chain {
+				arr.AppendString(msg)
+			}
+			return nil
+		})); err != nil {
+			return err
+		}
+	}
+
+	if meta := errs.Meta(e.err); len(meta) > 0 {
+		if err := enc.AddReflected("meta", meta); err != nil {
+			return err
+		}
+	}
+
+	if stack := errs.StackTrace(e.err); stack != "" {
+		enc.AddString("stack", stack)
+	}
+	return nil
+}
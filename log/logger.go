@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/mirzakhany/gox/pii"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -25,13 +26,30 @@ func NewLogger(level string, opts ...zap.Option) *zap.Logger {
 	ops := []zap.Option{zap.ErrorOutput(zapcore.Lock(os.Stderr)), zap.AddCaller()}
 	ops = append(ops, opts...)
 
-	logger := zap.New(zapcore.NewSamplerWithOptions(zapcore.NewCore(
+	// fields tagged with pii are masked in every entry
+	logger := zap.New(zapcore.NewSamplerWithOptions(pii.NewCore(zapcore.NewCore(
 		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
 		zapcore.Lock(os.Stdout),
 		atom,
-	), time.Second, 100, 10),
+	)), time.Second, 100, 10),
 		ops...,
 	)
 
 	return logger
 }
+
+// NewConsoleLogger returns a colored, human readable logger without sampling, for local development.
+func NewConsoleLogger(level string, opts ...zap.Option) *zap.Logger {
+	var logLevel zapcore.Level
+	if err := logLevel.Set(level); err != nil {
+		log.Fatal(err)
+	}
+
+	conf := zap.NewDevelopmentEncoderConfig()
+	conf.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	conf.EncodeTime = zapcore.TimeEncoderOfLayout("15:04:05.000")
+
+	ops := []zap.Option{zap.ErrorOutput(zapcore.Lock(os.Stderr)), zap.AddCaller()}
+	ops = append(ops, opts...)
+	return zap.New(pii.NewCore(zapcore.NewCore(zapcore.NewConsoleEncoder(conf), zapcore.Lock(os.Stdout), logLevel)), ops...)
+}
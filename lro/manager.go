@@ -0,0 +1,239 @@
+package lro
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/diag"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/group"
+	goxlog "github.com/mirzakhany/gox/log"
+	"github.com/mirzakhany/gox/rest"
+	"go.uber.org/zap"
+)
+
+// DefaultPollInterval is the Retry-After sent with operations which are not done.
+const DefaultPollInterval = 2 * time.Second
+
+// Func runs an operation, its result is stored as json.
+type Func func(ctx context.Context) (interface{}, error)
+
+type config struct {
+	path         string
+	pollInterval time.Duration
+	logger       *zap.Logger
+	owner        func(r *http.Request) string
+}
+
+type Option func(*config) error
+
+// WithPath sets where the operations endpoint is mounted, for the Location header of accepted
+// requests. "/operations" by default.
+func WithPath(path string) Option {
+	return func(c *config) error {
+		c.path = path
+		return nil
+	}
+}
+
+// WithPollInterval sets how long clients are asked to wait between polls, DefaultPollInterval by default.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *config) error {
+		c.pollInterval = d
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(c *config) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithOwner sets who an operation belongs to, only they can poll it. by default it is the user id of
+// the rest.RequestMeta of the request.
+func WithOwner(owner func(r *http.Request) string) Option {
+	return func(c *config) error {
+		c.owner = owner
+		return nil
+	}
+}
+
+// Manager runs operations in the background and serves their state.
+type Manager struct {
+	cfg   *config
+	store Store
+	wg    sync.WaitGroup
+}
+
+// NewManager returns a manager keeping operations in store.
+// example:
+//
+//	ops, err := lro.NewPgStore(ctx, pool)
+//	manager, err := lro.NewManager(ops)
+//	router.Mount("/operations", manager.Handler())
+//
+//	router.Post("/reports", func(w http.ResponseWriter, r *http.Request) {
+//		manager.Accept(w, r, "report", func(ctx context.Context) (interface{}, error) {
+//			return buildReport(ctx)
+//		})
+//	})
+func NewManager(store Store, options ...Option) (*Manager, error) {
+	cfg := &config{
+		path:         "/operations",
+		pollInterval: DefaultPollInterval,
+		logger:       zap.NewNop(),
+		owner: func(r *http.Request) string {
+			if meta, ok := rest.RequestMetaFrom(r.Context()); ok {
+				return meta.UserID
+			}
+			return ""
+		},
+	}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &Manager{cfg: cfg, store: store}, nil
+}
+
+// Accept starts an operation of kind running fn and writes it with status 202 and its url in the
+// Location header. fn runs with the values but not the cancellation of the request context, as it
+// outlives the request.
+func (m *Manager) Accept(w http.ResponseWriter, r *http.Request, kind string, fn Func) {
+	op, err := m.Start(ctxutil.Detach(r.Context()), m.cfg.owner(r), kind, fn)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	w.Header().Set("Location", m.cfg.path+"/"+op.ID)
+	w.Header().Set("Retry-After", strconv.Itoa(int(m.cfg.pollInterval.Seconds())))
+	rest.WriteJSON(w, http.StatusAccepted, op)
+}
+
+// Start records an operation of kind for owner and runs fn in the background. operations are not
+// resumed after a restart, ones interrupted by it stay running until DeleteFinished or a cleanup job.
+func (m *Manager) Start(ctx context.Context, owner, kind string, fn Func) (*Operation, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	op := &Operation{
+		ID:        newID(),
+		Kind:      kind,
+		Owner:     owner,
+		State:     StatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.store.Create(ctx, op); err != nil {
+		return nil, err
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(ctx, *op, fn)
+	}()
+	return op, nil
+}
+
+func (m *Manager) run(ctx context.Context, op Operation, fn Func) {
+	clk := clock.FromContext(ctx)
+	logger := m.cfg.logger.With(zap.String("operation", op.ID), zap.String("kind", op.Kind))
+
+	op.State, op.UpdatedAt = StateRunning, clk.Now().UTC()
+	if err := m.store.Update(ctx, &op); err != nil {
+		logger.Error("operation state update failed", goxlog.Err(err))
+	}
+
+	result, err := safeRun(ctx, op.Kind, fn)
+	if err == nil {
+		op.Result, err = json.Marshal(result)
+	}
+
+	op.State, op.UpdatedAt = StateSucceeded, clk.Now().UTC()
+	if err != nil {
+		logger.Error("operation failed", goxlog.Err(err))
+		op.State, op.Result, op.Error = StateFailed, nil, operationError(err)
+	}
+	if err := m.store.Update(ctx, &op); err != nil {
+		logger.Error("operation state update failed", goxlog.Err(err))
+	}
+}
+
+// Wait blocks until the running operations are done or ctx is, for graceful shutdowns.
+func (m *Manager) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handler serves GET /{id} with the operation, with a Retry-After header until it is done.
+func (m *Manager) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		op, err := m.store.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		// operations of others are reported as missing, so their ids can not be probed
+		if op.Owner != m.cfg.owner(r) {
+			rest.WriteErr(w, errs.NotFound("operation not found"))
+			return
+		}
+		if !op.State.Done() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(m.cfg.pollInterval.Seconds())))
+		}
+		rest.WriteJSON(w, http.StatusOK, op)
+	})
+	return router
+}
+
+func safeRun(ctx context.Context, kind string, fn Func) (result interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			stack := debug.Stack()
+			diag.RecordPanic("operation "+kind, rec, stack)
+			err = &group.PanicError{Value: rec, Stack: stack}
+		}
+	}()
+	return fn(ctx)
+}
+
+// operationError converts err like rest.WriteErr does, messages of server errors are not shown.
+func operationError(err error) *OperationError {
+	code := errs.CodeOf(err)
+	message, ok := errs.UserMessage(err)
+	if !ok {
+		message = err.Error()
+	}
+	if status := code.HTTPStatus(); status >= http.StatusInternalServerError {
+		message = http.StatusText(status)
+	}
+	return &OperationError{Code: code.MessageCode(), Message: message}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
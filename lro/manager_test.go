@@ -0,0 +1,104 @@
+package lro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu  sync.Mutex
+	ops map[string]Operation
+}
+
+func (s *memoryStore) Create(_ context.Context, op *Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops[op.ID] = *op
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, id string) (*Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return nil, errs.NotFound("operation not found")
+	}
+	return &op, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, op *Operation) error {
+	return s.Create(ctx, op)
+}
+
+func TestManager(t *testing.T) {
+	m, err := NewManager(&memoryStore{ops: map[string]Operation{}}, WithPollInterval(time.Second))
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/operations/", http.StripPrefix("/operations", m.Handler()))
+	mux.HandleFunc("/reports", func(w http.ResponseWriter, r *http.Request) {
+		m.Accept(w, r, "report", func(ctx context.Context) (interface{}, error) {
+			<-release
+			if r.URL.Query().Get("fail") != "" {
+				return nil, errors.New("database password is wrong")
+			}
+			return map[string]int{"rows": 3}, nil
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/reports", "application/json", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	location := res.Header.Get("Location")
+	require.Regexp(t, "^/operations/[0-9a-f]{32}$", location)
+
+	{ // not done yet
+		op, wait, err := getOperation(context.Background(), server.Client(), server.URL+location)
+		require.NoError(t, err)
+		require.False(t, op.State.Done())
+		require.Equal(t, time.Second, wait)
+	}
+
+	close(release)
+	op, err := Poll(context.Background(), server.Client(), server.URL+location, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, StateSucceeded, op.State)
+	var result map[string]int
+	require.NoError(t, op.Decode(&result))
+	require.Equal(t, 3, result["rows"])
+
+	{ // failures hide internal messages
+		res, err := http.Post(server.URL+"/reports?fail=1", "application/json", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		op, err := Poll(context.Background(), server.Client(), server.URL+res.Header.Get("Location"), 10*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, StateFailed, op.State)
+		require.EqualError(t, op.Decode(nil), http.StatusText(http.StatusInternalServerError))
+	}
+
+	{ // others can not see it
+		req := httptest.NewRequest(http.MethodGet, "/"+op.ID, nil)
+		req = req.WithContext(rest.WithRequestMetaContext(req.Context(), &rest.RequestMeta{UserID: "bob"}))
+		w := httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, req)
+		require.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	require.NoError(t, m.Wait(context.Background()))
+}
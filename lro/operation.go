@@ -0,0 +1,149 @@
+package lro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+)
+
+const operationsTable = "gox_operations"
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// Done reports whether the operation finished, successfully or not.
+func (s State) Done() bool {
+	return s == StateSucceeded || s == StateFailed
+}
+
+// OperationError is the error of a failed operation, as shown to clients.
+type OperationError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *OperationError) Error() string {
+	return e.Message
+}
+
+// Operation is the resource clients poll for the result of an async request.
+type Operation struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Owner     string          `json:"-"`
+	State     State           `json:"state"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *OperationError `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Decode reads the result of a succeeded operation into v, or returns its error.
+func (o *Operation) Decode(v interface{}) error {
+	switch o.State {
+	case StateFailed:
+		return o.Error
+	case StateSucceeded:
+		if len(o.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(o.Result, v)
+	}
+	return errors.New("operation " + o.ID + " is " + string(o.State))
+}
+
+// Store keeps the state of operations, PgStore for postgres.
+type Store interface {
+	Create(ctx context.Context, op *Operation) error
+	Get(ctx context.Context, id string) (*Operation, error)
+	Update(ctx context.Context, op *Operation) error
+}
+
+// PgStore stores operations in postgres.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the operations of db, creating their table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+operationsTable+` (
+		id text PRIMARY KEY,
+		kind text NOT NULL,
+		owner text NOT NULL,
+		state text NOT NULL,
+		result jsonb,
+		error jsonb,
+		created_at timestamptz NOT NULL,
+		updated_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+func (s *PgStore) Create(ctx context.Context, op *Operation) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO "+operationsTable+" (id, kind, owner, state, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		op.ID, op.Kind, op.Owner, op.State, op.CreatedAt, op.UpdatedAt)
+	return err
+}
+
+func (s *PgStore) Get(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	var result, opErr []byte
+	err := s.db.QueryRow(ctx, "SELECT id, kind, owner, state, result, error, created_at, updated_at FROM "+operationsTable+" WHERE id = $1", id).
+		Scan(&op.ID, &op.Kind, &op.Owner, &op.State, &result, &opErr, &op.CreatedAt, &op.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.NotFound("operation not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	op.Result = result
+	if len(opErr) > 0 {
+		op.Error = &OperationError{}
+		if err := json.Unmarshal(opErr, op.Error); err != nil {
+			return nil, err
+		}
+	}
+	return &op, nil
+}
+
+// Update stores the state, result and error of op.
+func (s *PgStore) Update(ctx context.Context, op *Operation) error {
+	var result, opErr interface{}
+	if len(op.Result) > 0 {
+		result = string(op.Result)
+	}
+	if op.Error != nil {
+		b, err := json.Marshal(op.Error)
+		if err != nil {
+			return err
+		}
+		opErr = string(b)
+	}
+	_, err := s.db.Exec(ctx, "UPDATE "+operationsTable+" SET state = $2, result = $3, error = $4, updated_at = $5 WHERE id = $1",
+		op.ID, op.State, result, opErr, op.UpdatedAt)
+	return err
+}
+
+// DeleteFinished removes operations which finished before t, clients can no longer poll them.
+func (s *PgStore) DeleteFinished(ctx context.Context, t time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM "+operationsTable+" WHERE state IN ($1, $2) AND updated_at < $3", StateSucceeded, StateFailed, t)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
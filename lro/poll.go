@@ -0,0 +1,66 @@
+package lro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/rest"
+)
+
+// Poll gets the operation at url until it is done or ctx is, waiting as long as the Retry-After header
+// of the server asks and interval otherwise. the returned operation may have failed, see Operation.Decode.
+// example:
+//
+//	res, err := client.Post(baseURL+"/reports", "application/json", body)
+//	...
+//	op, err := lro.Poll(ctx, client, baseURL+res.Header.Get("Location"), time.Second)
+//	var report Report
+//	err = op.Decode(&report)
+func Poll(ctx context.Context, client *http.Client, url string, interval time.Duration) (*Operation, error) {
+	clk := clock.FromContext(ctx)
+	for {
+		op, wait, err := getOperation(ctx, client, url)
+		if err != nil {
+			return nil, err
+		}
+		if op.State.Done() {
+			return op, nil
+		}
+
+		if wait <= 0 {
+			wait = interval
+		}
+		select {
+		case <-clk.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func getOperation(ctx context.Context, client *http.Client, url string) (*Operation, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	if err := rest.ErrorFromResponse(res); err != nil {
+		return nil, 0, err
+	}
+
+	var op Operation
+	if err := json.NewDecoder(res.Body).Decode(&op); err != nil {
+		return nil, 0, err
+	}
+	seconds, _ := strconv.Atoi(res.Header.Get("Retry-After"))
+	return &op, time.Duration(seconds) * time.Second, nil
+}
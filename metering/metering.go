@@ -0,0 +1,270 @@
+package metering
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultFlushInterval = 5 * time.Second
+	DefaultBatchSize     = 500
+	DefaultBufferSize    = 100000
+	// shutdownFlushTimeout bounds the last flush once the meter is stopped
+	shutdownFlushTimeout = 10 * time.Second
+)
+
+// ErrBufferFull is returned by Record when the sink fell behind and the buffer holds DefaultBufferSize
+// events, or the size set WithBufferSize.
+var ErrBufferFull = errors.New("metering: buffer is full")
+
+// Event is a usage of Quantity of Metric, Key identifies it so sinks drop duplicates.
+type Event struct {
+	Key        string            `json:"key"`
+	Metric     string            `json:"metric"`
+	Quantity   float64           `json:"quantity"`
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+	Time       time.Time         `json:"time"`
+}
+
+var keyKey = ctxutil.NewKey[string]("metering key")
+
+// WithKey returns a copy of ctx whose usage events are keyed by key and their metric, so recording
+// them again, like when a request or a job is retried, is dropped by the sink. key should identify
+// the operation, like its idempotency key or the id of a message.
+func WithKey(ctx context.Context, key string) context.Context {
+	return keyKey.Set(ctx, key)
+}
+
+type Option func(*Meter) error
+
+// WithFlushInterval sets how often buffered events are flushed, DefaultFlushInterval by default.
+func WithFlushInterval(d time.Duration) Option {
+	return func(m *Meter) error {
+		m.interval = d
+		return nil
+	}
+}
+
+// WithBatchSize sets how many events are written to the sink at once, DefaultBatchSize by default.
+func WithBatchSize(n int) Option {
+	return func(m *Meter) error {
+		if n <= 0 {
+			return errors.New("metering: batch size must be positive")
+		}
+		m.batchSize = n
+		return nil
+	}
+}
+
+// WithBufferSize sets how many events are buffered before Record fails with ErrBufferFull.
+func WithBufferSize(n int) Option {
+	return func(m *Meter) error {
+		if n <= 0 {
+			return errors.New("metering: buffer size must be positive")
+		}
+		m.bufferSize = n
+		return nil
+	}
+}
+
+// WithMetrics registers the gox_metering_flushed_events_total and gox_metering_flush_failures_total
+// counters and the gox_metering_buffered_events gauge with reg.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(m *Meter) error {
+		flushed, err := metrics.Register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "metering", Name: "flushed_events_total",
+			Help: "Number of usage events written to the sink.",
+		}))
+		if err != nil {
+			return err
+		}
+		failures, err := metrics.Register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "metering", Name: "flush_failures_total",
+			Help: "Number of failed writes to the sink, their events are retried.",
+		}))
+		if err != nil {
+			return err
+		}
+		buffered, err := metrics.Register(reg, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "metering", Name: "buffered_events",
+			Help: "Number of usage events waiting to be flushed.",
+		}))
+		if err != nil {
+			return err
+		}
+		m.flushed, m.failures, m.buffered = flushed, failures, buffered
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(m *Meter) error {
+		m.logger = logger
+		return nil
+	}
+}
+
+// Meter buffers usage events and flushes them to a sink in batches, for usage based billing.
+type Meter struct {
+	sink       Sink
+	interval   time.Duration
+	batchSize  int
+	bufferSize int
+	logger     *zap.Logger
+
+	flushed  prometheus.Counter
+	failures prometheus.Counter
+	buffered prometheus.Gauge
+
+	mu      sync.Mutex
+	events  []Event
+	flushMu sync.Mutex
+}
+
+// NewMeter returns a meter writing to sink, it is a gox.Component flushing the events until it is
+// stopped, then once more.
+// example:
+//
+//	sink, err := metering.NewPgSink(ctx, pool)
+//	meter, err := metering.NewMeter(sink, metering.WithMetrics(prometheus.DefaultRegisterer))
+//	runner, err := gox.NewRunner(gox.WithComponents(meter, ...))
+//	...
+//	ctx = metering.WithKey(ctx, r.Header.Get("Idempotency-Key"))
+//	err := meter.Record(ctx, "api.calls", 1, map[string]string{"tenant": tenant, "endpoint": "search"})
+func NewMeter(sink Sink, options ...Option) (*Meter, error) {
+	m := &Meter{
+		sink:       sink,
+		interval:   DefaultFlushInterval,
+		batchSize:  DefaultBatchSize,
+		bufferSize: DefaultBufferSize,
+		logger:     zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Meter) Name() string {
+	return "metering"
+}
+
+func (m *Meter) Describe() map[string]interface{} {
+	return map[string]interface{}{"flush_interval": m.interval.String(), "batch_size": m.batchSize}
+}
+
+// Record buffers a usage event, keyed by the key of ctx set WithKey or else by a random key.
+func (m *Meter) Record(ctx context.Context, metric string, quantity float64, dims map[string]string) error {
+	key := newKey()
+	if k, ok := keyKey.Get(ctx); ok && k != "" {
+		key = k + ":" + metric
+	}
+	return m.RecordEvent(ctx, Event{Key: key, Metric: metric, Quantity: quantity, Dimensions: dims})
+}
+
+// RecordEvent buffers e, the time of the clock of ctx is used when it has none.
+func (m *Meter) RecordEvent(ctx context.Context, e Event) error {
+	if e.Key == "" || e.Metric == "" {
+		return errors.New("metering: events need a key and a metric")
+	}
+	if e.Time.IsZero() {
+		e.Time = clock.FromContext(ctx).Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) >= m.bufferSize {
+		return ErrBufferFull
+	}
+	m.events = append(m.events, e)
+	m.observe()
+	return nil
+}
+
+// Run flushes the buffered events every flush interval until ctx is done, then flushes the rest.
+func (m *Meter) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for {
+		select {
+		case <-clk.After(m.interval):
+			if err := m.Flush(ctx); err != nil && ctx.Err() == nil {
+				m.logger.Error("flush usage events failed", zap.Error(err))
+			}
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(clock.WithContext(context.Background(), clk), shutdownFlushTimeout)
+			defer cancel()
+			if err := m.Flush(flushCtx); err != nil {
+				m.logger.Error("flush usage events on shutdown failed", zap.Int("pending", m.Pending()), zap.Error(err))
+			}
+			return nil
+		}
+	}
+}
+
+// Flush writes the buffered events to the sink in batches. events of a failed batch and the ones
+// after it stay buffered for the next flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.flushMu.Lock()
+	defer m.flushMu.Unlock()
+
+	for {
+		m.mu.Lock()
+		n := len(m.events)
+		if n > m.batchSize {
+			n = m.batchSize
+		}
+		batch := append([]Event(nil), m.events[:n]...)
+		m.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := m.sink.Write(ctx, batch); err != nil {
+			if m.failures != nil {
+				m.failures.Inc()
+			}
+			return err
+		}
+
+		// only Flush removes events and it is serialized, so the batch is still at the front
+		m.mu.Lock()
+		m.events = append(m.events[:0:0], m.events[len(batch):]...)
+		m.observe()
+		m.mu.Unlock()
+		if m.flushed != nil {
+			m.flushed.Add(float64(len(batch)))
+		}
+	}
+}
+
+// Pending returns the number of buffered events.
+func (m *Meter) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.events)
+}
+
+// observe sets the buffered gauge, m.mu must be held.
+func (m *Meter) observe() {
+	if m.buffered != nil {
+		m.buffered.Set(float64(len(m.events)))
+	}
+}
+
+func newKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink keeps events by key like the sinks dropping duplicates, failing while fail is set.
+type memorySink struct {
+	events  map[string]Event
+	batches [][]Event
+	fail    bool
+}
+
+func (s *memorySink) Write(_ context.Context, events []Event) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, events)
+	for _, e := range events {
+		if _, ok := s.events[e.Key]; !ok {
+			s.events[e.Key] = e
+		}
+	}
+	return nil
+}
+
+func TestMeter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ctx := clock.WithContext(context.Background(), goxtest.NewFakeClock(now))
+	sink := &memorySink{events: map[string]Event{}}
+	reg := prometheus.NewRegistry()
+	m, err := NewMeter(sink, WithBatchSize(2), WithBufferSize(4), WithMetrics(reg))
+	require.NoError(t, err)
+
+	keyed := WithKey(ctx, "req-1")
+	require.NoError(t, m.Record(keyed, "api.calls", 1, map[string]string{"tenant": "acme"}))
+	require.NoError(t, m.Record(keyed, "api.calls", 1, map[string]string{"tenant": "acme"}))
+	require.NoError(t, m.Record(keyed, "storage.bytes", 512, nil))
+	require.NoError(t, m.Record(ctx, "api.calls", 1, nil))
+
+	{ // full buffers refuse events instead of growing without bounds
+		require.ErrorIs(t, m.Record(ctx, "api.calls", 1, nil), ErrBufferFull)
+		require.Equal(t, 4.0, testutil.ToFloat64(m.buffered))
+	}
+
+	{ // failed flushes keep the events
+		sink.fail = true
+		require.Error(t, m.Flush(ctx))
+		require.Equal(t, 4, m.Pending())
+		require.Equal(t, 1.0, testutil.ToFloat64(m.failures))
+	}
+
+	sink.fail = false
+	require.NoError(t, m.Flush(ctx))
+	require.Equal(t, 0, m.Pending())
+	require.Len(t, sink.batches, 2)
+	require.Equal(t, 4.0, testutil.ToFloat64(m.flushed))
+
+	{ // events of the same key and metric are duplicates
+		require.Len(t, sink.events, 3)
+		require.Equal(t, Event{Key: "req-1:api.calls", Metric: "api.calls", Quantity: 1, Dimensions: map[string]string{"tenant": "acme"}, Time: now}, sink.events["req-1:api.calls"])
+		require.Equal(t, 512.0, sink.events["req-1:storage.bytes"].Quantity)
+	}
+
+	require.Error(t, m.RecordEvent(ctx, Event{Metric: "api.calls"}))
+}
+
+func TestMeterRun(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(clock.WithContext(context.Background(), fake))
+	sink := &memorySink{events: map[string]Event{}}
+	m, err := NewMeter(sink, WithFlushInterval(time.Second))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	require.NoError(t, m.Record(ctx, "api.calls", 1, nil))
+	require.Eventually(t, func() bool { return fake.Waiters() == 1 }, time.Second, time.Millisecond)
+	fake.Advance(time.Second)
+	require.Eventually(t, func() bool { return m.Pending() == 0 }, time.Second, time.Millisecond)
+
+	{ // stopping flushes the rest
+		require.Eventually(t, func() bool { return fake.Waiters() == 1 }, time.Second, time.Millisecond)
+		require.NoError(t, m.Record(ctx, "api.calls", 2, nil))
+		cancel()
+		require.NoError(t, <-done)
+		require.Equal(t, 0, m.Pending())
+		require.Len(t, sink.events, 2)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	events := []Event{{Key: "k1", Metric: "api.calls", Quantity: 1, Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}}
+	require.NoError(t, NewHTTPSink(srv.URL+"/usage", srv.Client()).Write(context.Background(), events))
+	require.Equal(t, events, received)
+	require.Error(t, NewHTTPSink(srv.URL+"/down", srv.Client()).Write(context.Background(), events))
+}
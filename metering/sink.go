@@ -0,0 +1,109 @@
+package metering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mirzakhany/gox/store"
+)
+
+const eventsTable = "gox_usage_events"
+
+// Sink receives flushed usage events. writes are retried with the same events after failures, so
+// sinks must ignore events whose key they already received.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+}
+
+// SinkFunc adapts a function to Sink, like one producing to kafka with the key of events as message
+// key, which lets consumers or a compacted topic drop duplicates.
+type SinkFunc func(ctx context.Context, events []Event) error
+
+func (f SinkFunc) Write(ctx context.Context, events []Event) error {
+	return f(ctx, events)
+}
+
+// PgSink stores events in postgres, events with a key already stored are skipped.
+type PgSink struct {
+	db store.Querier
+}
+
+// NewPgSink returns a sink writing to db, creating the events table if needed.
+func NewPgSink(ctx context.Context, db store.Querier) (*PgSink, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+eventsTable+` (
+		key text PRIMARY KEY,
+		metric text NOT NULL,
+		quantity double precision NOT NULL,
+		dimensions jsonb NOT NULL,
+		recorded_at timestamptz NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS `+eventsTable+`_metric ON `+eventsTable+` (metric, recorded_at)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgSink{db: db}, nil
+}
+
+func (s *PgSink) Write(ctx context.Context, events []Event) error {
+	keys := make([]string, len(events))
+	metrics := make([]string, len(events))
+	quantities := make([]float64, len(events))
+	dims := make([]string, len(events))
+	times := make([]time.Time, len(events))
+	for i, e := range events {
+		d, err := json.Marshal(e.Dimensions)
+		if err != nil {
+			return err
+		}
+		keys[i], metrics[i], quantities[i], dims[i] = e.Key, e.Metric, e.Quantity, string(d)
+		times[i] = e.Time
+	}
+	_, err := s.db.Exec(ctx, `INSERT INTO `+eventsTable+` (key, metric, quantity, dimensions, recorded_at)
+		SELECT e.key, e.metric, e.quantity, e.dimensions::jsonb, e.recorded_at
+		FROM unnest($1::text[], $2::text[], $3::float8[], $4::text[], $5::timestamptz[]) AS e(key, metric, quantity, dimensions, recorded_at)
+		ON CONFLICT (key) DO NOTHING`,
+		keys, metrics, quantities, dims, times)
+	return err
+}
+
+// HTTPSink posts events as a json array to url, the receiver must drop events by key.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink returns a sink posting to url, client may be nil for http.DefaultClient.
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSink{url: url, client: client}
+}
+
+func (s *HTTPSink) Write(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("metering: sink responded with status %d", res.StatusCode)
+	}
+	return nil
+}
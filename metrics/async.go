@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace prefixes the metrics of the toolkit, so they are named like gox_<subsystem>_processed_total.
+const Namespace = "gox"
+
+// Async holds the metrics every async subsystem exports, labeled by the name of the pool, queue or job:
+// processed and failed items, retries, lag behind the oldest pending item and processing duration.
+// example:
+//
+//	m, err := metrics.NewAsync(prometheus.DefaultRegisterer, "worker")
+//	...
+//	start := time.Now()
+//	err := handle(ctx, job)
+//	m.Observe("emails", start, err)
+type Async struct {
+	Processed *prometheus.CounterVec
+	Failed    *prometheus.CounterVec
+	Retries   *prometheus.CounterVec
+	Lag       *prometheus.GaugeVec
+	Duration  *prometheus.HistogramVec
+}
+
+// NewAsync registers the metrics of subsystem with reg. registering the same subsystem again returns
+// metrics sharing the registered collectors, so each instance of a subsystem can call it.
+func NewAsync(reg prometheus.Registerer, subsystem string) (*Async, error) {
+	a := &Async{
+		Processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: subsystem, Name: "processed_total",
+			Help: "Number of items processed, successfully or not.",
+		}, []string{"name"}),
+		Failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: subsystem, Name: "failed_total",
+			Help: "Number of items which failed.",
+		}, []string{"name"}),
+		Retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: subsystem, Name: "retries_total",
+			Help: "Number of retried items.",
+		}, []string{"name"}),
+		Lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Subsystem: subsystem, Name: "lag_seconds",
+			Help: "Age of the oldest item waiting to be processed.",
+		}, []string{"name"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: subsystem, Name: "duration_seconds",
+			Help:    "Time spent processing an item.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"name"}),
+	}
+
+	var err error
+	if a.Processed, err = Register(reg, a.Processed); err != nil {
+		return nil, err
+	}
+	if a.Failed, err = Register(reg, a.Failed); err != nil {
+		return nil, err
+	}
+	if a.Retries, err = Register(reg, a.Retries); err != nil {
+		return nil, err
+	}
+	if a.Lag, err = Register(reg, a.Lag); err != nil {
+		return nil, err
+	}
+	if a.Duration, err = Register(reg, a.Duration); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Observe records an item of name processed since start, which failed if err is not nil.
+func (a *Async) Observe(name string, start time.Time, err error) {
+	a.ObserveDuration(name, time.Since(start), err)
+}
+
+// ObserveDuration is Observe with the duration, for callers measuring it with a clock.Clock.
+func (a *Async) ObserveDuration(name string, d time.Duration, err error) {
+	a.Processed.WithLabelValues(name).Inc()
+	if err != nil {
+		a.Failed.WithLabelValues(name).Inc()
+	}
+	a.Duration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// Retry records a retried item of name.
+func (a *Async) Retry(name string) {
+	a.Retries.WithLabelValues(name).Inc()
+}
+
+// SetLag records the age of the oldest pending item of name, zero when nothing is pending.
+func (a *Async) SetLag(name string, lag time.Duration) {
+	a.Lag.WithLabelValues(name).Set(lag.Seconds())
+}
+
+// Register registers c with reg, or returns the collector registered before under the same name.
+func Register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, err
+	}
+	return c, nil
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsync(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	a, err := NewAsync(reg, "worker")
+	require.NoError(t, err)
+
+	a.Observe("emails", time.Now(), nil)
+	a.Observe("emails", time.Now(), errors.New("smtp down"))
+	a.Retry("emails")
+	a.SetLag("emails", 3*time.Second)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(a.Processed.WithLabelValues("emails")))
+	require.Equal(t, 1.0, testutil.ToFloat64(a.Failed.WithLabelValues("emails")))
+	require.Equal(t, 1.0, testutil.ToFloat64(a.Retries.WithLabelValues("emails")))
+	require.Equal(t, 3.0, testutil.ToFloat64(a.Lag.WithLabelValues("emails")))
+
+	{ // registering again shares the collectors
+		b, err := NewAsync(reg, "worker")
+		require.NoError(t, err)
+		b.Observe("emails", time.Now(), nil)
+		require.Equal(t, 3.0, testutil.ToFloat64(a.Processed.WithLabelValues("emails")))
+	}
+
+	n, err := testutil.GatherAndCount(reg, "gox_worker_processed_total", "gox_worker_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
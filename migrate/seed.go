@@ -0,0 +1,85 @@
+// Package migrate seeds databases for development and tests, once their schema is migrated with
+// store.Migrate.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	stdos "os"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// EnvVar names the environment variable holding the environment seeders are gated by, like "dev".
+const EnvVar = "GOX_ENV"
+
+const seedsTable = "gox_seeds"
+
+// DefaultSeedEnvs are the environments of seeders which do not list their own, seed data never
+// reaches production by accident.
+var DefaultSeedEnvs = []string{"dev", "test"}
+
+// Seeder inserts data for development or tests. Run is called once per database, inside a
+// transaction, and recorded by Name so later calls of Seed skip it.
+type Seeder struct {
+	Name string
+	// Envs lists the environments the seeder runs in, DefaultSeedEnvs when empty
+	Envs []string
+	Run  func(ctx context.Context, tx pgx.Tx) error
+}
+
+// Seed runs the seeders which are enabled in the environment of EnvVar and did not run yet, in order.
+// example:
+//
+//	err := migrate.Seed(ctx, pool, migrate.Seeder{
+//		Name: "demo users",
+//		Run: func(ctx context.Context, tx pgx.Tx) error {
+//			_, err := tx.Exec(ctx, "INSERT INTO users (email) VALUES ('demo@example.com') ON CONFLICT DO NOTHING")
+//			return err
+//		},
+//	})
+func Seed(ctx context.Context, pool *pgxpool.Pool, seeders ...Seeder) error {
+	return SeedEnv(ctx, pool, stdos.Getenv(EnvVar), seeders...)
+}
+
+// SeedEnv is Seed for the environment env.
+func SeedEnv(ctx context.Context, pool *pgxpool.Pool, env string, seeders ...Seeder) error {
+	if _, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+seedsTable+` (
+		name text PRIMARY KEY,
+		seeded_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	for _, s := range seeders {
+		if !s.enabled(env) {
+			continue
+		}
+
+		err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+			tag, err := tx.Exec(ctx, "INSERT INTO "+seedsTable+" (name) VALUES ($1) ON CONFLICT DO NOTHING", s.Name)
+			if err != nil || tag.RowsAffected() == 0 {
+				return err
+			}
+			return s.Run(ctx, tx)
+		})
+		if err != nil {
+			return fmt.Errorf("seeder %s failed: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s Seeder) enabled(env string) bool {
+	envs := s.Envs
+	if len(envs) == 0 {
+		envs = DefaultSeedEnvs
+	}
+	for _, e := range envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
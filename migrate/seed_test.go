@@ -0,0 +1,16 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeederEnabled(t *testing.T) {
+	require.True(t, Seeder{}.enabled("dev"))
+	require.True(t, Seeder{}.enabled("test"))
+	require.False(t, Seeder{}.enabled("production"))
+	require.False(t, Seeder{}.enabled(""))
+	require.True(t, Seeder{Envs: []string{"staging"}}.enabled("staging"))
+	require.False(t, Seeder{Envs: []string{"staging"}}.enabled("dev"))
+}
@@ -0,0 +1,147 @@
+package misc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+)
+
+// PartialError is returned by the context-aware helpers when they stop before handling every item,
+// because fn failed or ctx was done. the results returned with it hold the longest prefix of the input
+// which was handled, so the caller can keep them and resume from in[Done:].
+type PartialError struct {
+	Done  int
+	Total int
+	Err   error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("partial result, %d of %d done: %v", e.Done, e.Total, e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// MapCtx is like Extract for fn which may fail or take long. ctx is checked between items.
+// example:
+//
+//	users, err := misc.MapCtx(ctx, ids, loadUser)
+//	var partial *misc.PartialError
+//	if errors.As(err, &partial) {
+//		retryLater(ids[partial.Done:])
+//	}
+func MapCtx[T, R any](ctx context.Context, in []T, fn func(ctx context.Context, v T) (R, error)) ([]R, error) {
+	out := make([]R, 0, len(in))
+	for _, v := range in {
+		if err := ctx.Err(); err != nil {
+			return out, &PartialError{Done: len(out), Total: len(in), Err: err}
+		}
+		r, err := fn(ctx, v)
+		if err != nil {
+			return out, &PartialError{Done: len(out), Total: len(in), Err: err}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ParallelMap is like MapCtx, calling fn from up to workers goroutines. results keep the order of in.
+// the first error of fn cancels the other calls, and no new item is started once ctx is done.
+// example:
+//
+//	thumbs, err := misc.ParallelMap(ctx, images, 8, resize)
+func ParallelMap[T, R any](ctx context.Context, in []T, workers int, fn func(ctx context.Context, v T) (R, error)) ([]R, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		out      = make([]R, len(in))
+		done     = make([]bool, len(in))
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				r, err := fn(ctx, in[i])
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					out[i], done[i] = r, true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := range in {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	n := 0
+	for n < len(done) && done[n] {
+		n++
+	}
+	if n == len(in) {
+		return out, nil
+	}
+
+	err := firstErr
+	if err == nil {
+		err = ctx.Err()
+	}
+	return out[:n], &PartialError{Done: n, Total: len(in), Err: err}
+}
+
+// Retry calls fn up to attempts times until it succeeds, waiting backoff(attempt) between the calls.
+// the wait is cut short when ctx is done, returning ctx's error wrapped with the last error of fn.
+// example:
+//
+//	err := misc.Retry(ctx, 5, taskq.DefaultBackoff, func(ctx context.Context) error {
+//		return client.Ping(ctx)
+//	})
+func Retry(ctx context.Context, attempts int, backoff func(attempt int) time.Duration, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+
+		select {
+		case <-clock.FromContext(ctx).After(backoff(attempt)):
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		}
+	}
+}
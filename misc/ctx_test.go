@@ -0,0 +1,119 @@
+package misc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapCtx(t *testing.T) {
+	double := func(_ context.Context, v int) (int, error) { return v * 2, nil }
+
+	out, err := MapCtx(context.Background(), []int{1, 2, 3}, double)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 4, 6}, out)
+
+	{ // stops on cancel between items
+		ctx, cancel := context.WithCancel(context.Background())
+		out, err := MapCtx(ctx, []int{1, 2, 3}, func(ctx context.Context, v int) (int, error) {
+			if v == 2 {
+				cancel()
+			}
+			return v * 2, nil
+		})
+		require.Equal(t, []int{2, 4}, out)
+
+		var partial *PartialError
+		require.ErrorAs(t, err, &partial)
+		require.Equal(t, 2, partial.Done)
+		require.Equal(t, 3, partial.Total)
+		require.ErrorIs(t, err, context.Canceled)
+	}
+
+	{ // stops on the first error
+		boom := errors.New("boom")
+		out, err := MapCtx(context.Background(), []int{1, 2, 3}, func(_ context.Context, v int) (int, error) {
+			if v == 3 {
+				return 0, boom
+			}
+			return v, nil
+		})
+		require.Equal(t, []int{1, 2}, out)
+		require.ErrorIs(t, err, boom)
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	in := make([]int, 50)
+	for i := range in {
+		in[i] = i
+	}
+
+	out, err := ParallelMap(context.Background(), in, 8, func(_ context.Context, v int) (int, error) {
+		return v * v, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, out, 50)
+	require.Equal(t, 49*49, out[49])
+
+	{ // returns the handled prefix on error
+		boom := errors.New("boom")
+		out, err := ParallelMap(context.Background(), in, 1, func(_ context.Context, v int) (int, error) {
+			if v == 10 {
+				return 0, boom
+			}
+			return v, nil
+		})
+		require.Equal(t, in[:10], out)
+		require.ErrorIs(t, err, boom)
+
+		var partial *PartialError
+		require.ErrorAs(t, err, &partial)
+		require.Equal(t, 10, partial.Done)
+	}
+
+	{ // blocked calls are released on cancel
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		out, err := ParallelMap(ctx, in, 4, func(ctx context.Context, v int) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		require.Empty(t, out)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), 3, func(int) time.Duration { return time.Millisecond }, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	{ // returns the last error after all attempts
+		boom := errors.New("boom")
+		err := Retry(context.Background(), 2, func(int) time.Duration { return time.Millisecond }, func(context.Context) error {
+			return boom
+		})
+		require.ErrorIs(t, err, boom)
+	}
+
+	{ // backoff is cut short on cancel
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := Retry(ctx, 5, func(int) time.Duration { return time.Hour }, func(context.Context) error {
+			return errors.New("down")
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), "down")
+	}
+}
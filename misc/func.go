@@ -0,0 +1,118 @@
+package misc
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/group"
+)
+
+// Debounce returns a function which delays calling fn until d has passed without it being called again,
+// useful for handlers of bursty events like config file changes. a pending call is dropped when ctx is done.
+func Debounce(ctx context.Context, d time.Duration, fn func()) func() {
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+	)
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if timer == nil {
+			timer = time.AfterFunc(d, func() {
+				if ctx.Err() == nil {
+					fn()
+				}
+			})
+			return
+		}
+		timer.Reset(d)
+	}
+}
+
+// Throttle returns a function which calls fn at most once every d, calls in between are dropped.
+// it reports whether fn was called.
+func Throttle(d time.Duration, fn func()) func() bool {
+	var (
+		mu   sync.Mutex
+		last time.Time
+	)
+
+	return func() bool {
+		mu.Lock()
+		now := time.Now()
+		if !last.IsZero() && now.Sub(last) < d {
+			mu.Unlock()
+			return false
+		}
+		last = now
+		mu.Unlock()
+
+		fn()
+		return true
+	}
+}
+
+type coalesceCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// Coalescer merges concurrent calls with the same key into one, like singleflight.
+// the zero value is ready to use.
+type Coalescer[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*coalesceCall[V]
+}
+
+// Do calls fn once for all concurrent callers with the same key and returns its result to all of them.
+// fn runs with a context detached from the caller, so one caller giving up does not fail the others,
+// while each caller stops waiting when its own ctx is done. shared reports if the result was shared. a
+// panic of fn is returned to all callers as a group.PanicError.
+// example:
+//
+//	var tokens misc.Coalescer[string, *Token]
+//	token, err, _ := tokens.Do(ctx, clientID, func(ctx context.Context) (*Token, error) {
+//		return refreshToken(ctx, clientID)
+//	})
+func (c *Coalescer[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[K]*coalesceCall[V])
+	}
+
+	call, ok := c.calls[key]
+	if !ok {
+		call = &coalesceCall[V]{done: make(chan struct{})}
+		c.calls[key] = call
+
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					call.err = &group.PanicError{Value: r, Stack: debug.Stack()}
+				}
+				c.mu.Lock()
+				delete(c.calls, key)
+				c.mu.Unlock()
+				close(call.done)
+			}()
+			call.val, call.err = fn(ctxutil.Detach(ctx))
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err, ok
+	case <-ctx.Done():
+		return v, ctx.Err(), ok
+	}
+}
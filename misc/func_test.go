@@ -0,0 +1,109 @@
+package misc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/group"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebounce(t *testing.T) {
+	var calls int32
+	debounced := Debounce(context.Background(), 20*time.Millisecond, func() {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	for i := 0; i < 5; i++ {
+		debounced()
+	}
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	{ // pending call is dropped when context is done
+		ctx, cancel := context.WithCancel(context.Background())
+		debounced := Debounce(ctx, 20*time.Millisecond, func() {
+			atomic.AddInt32(&calls, 1)
+		})
+		debounced()
+		cancel()
+		time.Sleep(60 * time.Millisecond)
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	}
+
+	{ // calls after the delay fire again, reusing the timer
+		debounced()
+		time.Sleep(60 * time.Millisecond)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	calls := 0
+	throttled := Throttle(time.Hour, func() { calls++ })
+
+	require.True(t, throttled())
+	require.False(t, throttled())
+	require.Equal(t, 1, calls)
+}
+
+func TestCoalescer(t *testing.T) {
+	var (
+		c     Coalescer[string, int]
+		calls int32
+		wg    sync.WaitGroup
+	)
+	release := make(chan struct{})
+
+	results := make([]int, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err, _ := c.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+			require.NoError(t, err)
+			results[i] = v
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls)
+	require.Equal(t, []int{42, 42, 42, 42, 42}, results)
+
+	{ // caller stops waiting on its own context
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err, _ := c.Do(ctx, "key", func(ctx context.Context) (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return 0, errors.New("unused")
+		})
+		require.ErrorIs(t, err, context.Canceled)
+	}
+
+	{ // panics are returned to every caller
+		_, err, _ := c.Do(context.Background(), "panic", func(ctx context.Context) (int, error) {
+			panic("boom")
+		})
+		var perr *group.PanicError
+		require.ErrorAs(t, err, &perr)
+		require.Equal(t, "boom", perr.Value)
+
+		// the key is released for later calls
+		v, err, _ := c.Do(context.Background(), "panic", func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+	}
+}
@@ -0,0 +1,125 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrOverflow is returned when a number does not fit the type it is converted to.
+	ErrOverflow = errors.New("number overflows type")
+	// ErrOutOfRange is returned when a parsed number is outside the given bounds.
+	ErrOutOfRange = errors.New("number out of range")
+)
+
+// Integer is any integer type.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Convert converts v to To, failing with ErrOverflow instead of silently truncating it.
+// example:
+//
+//	port, err := misc.Convert[uint16](cfg.Port)
+func Convert[To, From Integer](v From) (To, error) {
+	to := To(v)
+	if From(to) != v || (to < 0) != (v < 0) {
+		return 0, fmt.Errorf("%w: %d", ErrOverflow, v)
+	}
+	return to, nil
+}
+
+// IntToInt32 converts v, failing with ErrOverflow when it does not fit.
+func IntToInt32(v int) (int32, error) {
+	return Convert[int32](v)
+}
+
+// Int64ToInt32 converts v, failing with ErrOverflow when it does not fit.
+func Int64ToInt32(v int64) (int32, error) {
+	return Convert[int32](v)
+}
+
+// Int64ToInt converts v, failing with ErrOverflow when it does not fit, like on 32 bit platforms.
+func Int64ToInt(v int64) (int, error) {
+	return Convert[int](v)
+}
+
+// IntToUint16 converts v, failing with ErrOverflow when it does not fit or is negative.
+func IntToUint16(v int) (uint16, error) {
+	return Convert[uint16](v)
+}
+
+// ParseInt parses s as a base 10 T between min and max inclusive, returning def when s is empty.
+// example:
+//
+//	limit, err := misc.ParseInt(r.URL.Query().Get("limit"), 50, 1, 500)
+//	if err != nil {
+//		rest.WriteErr(w, errs.Invalid("limit must be between 1 and 500"))
+//		return
+//	}
+func ParseInt[T Integer](s string, def, min, max T) (T, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+
+	var (
+		v   T
+		err error
+	)
+	if min < 0 {
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, 64); err == nil {
+			v, err = Convert[T](n)
+		}
+	} else {
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, 64); err == nil {
+			v, err = Convert[T](n)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) || errors.Is(err, ErrOverflow) || strings.HasPrefix(s, "-") {
+			return 0, fmt.Errorf("%w: %s not in [%d, %d]", ErrOutOfRange, s, min, max)
+		}
+		return 0, fmt.Errorf("%q is not an integer", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%w: %s not in [%d, %d]", ErrOutOfRange, s, min, max)
+	}
+	return v, nil
+}
+
+// ParseFloat parses s as a finite float64 between min and max inclusive, returning def when s is empty.
+func ParseFloat(s string, def, min, max float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%w: %s not in [%g, %g]", ErrOutOfRange, s, min, max)
+	}
+	return v, nil
+}
+
+// ParseBool parses s like strconv.ParseBool, returning def when s is empty.
+func ParseBool(s string, def bool) (bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%q is not a boolean", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,83 @@
+package misc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	port, err := IntToUint16(5432)
+	require.NoError(t, err)
+	require.Equal(t, uint16(5432), port)
+
+	_, err = IntToUint16(70000)
+	require.ErrorIs(t, err, ErrOverflow)
+
+	_, err = IntToUint16(-1)
+	require.ErrorIs(t, err, ErrOverflow)
+
+	_, err = Int64ToInt32(math.MaxInt32 + 1)
+	require.ErrorIs(t, err, ErrOverflow)
+
+	n, err := Int64ToInt32(math.MinInt32)
+	require.NoError(t, err)
+	require.Equal(t, int32(math.MinInt32), n)
+
+	{ // sign changes are overflows even when the bits fit
+		_, err := Convert[uint64](int64(-1))
+		require.ErrorIs(t, err, ErrOverflow)
+		_, err = Convert[int64](uint64(math.MaxUint64))
+		require.ErrorIs(t, err, ErrOverflow)
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	n, err := ParseInt("", 50, 1, 500)
+	require.NoError(t, err)
+	require.Equal(t, 50, n)
+
+	n, err = ParseInt(" 20 ", 50, 1, 500)
+	require.NoError(t, err)
+	require.Equal(t, 20, n)
+
+	_, err = ParseInt("501", 50, 1, 500)
+	require.ErrorIs(t, err, ErrOutOfRange)
+
+	_, err = ParseInt("abc", 50, 1, 500)
+	require.EqualError(t, err, `"abc" is not an integer`)
+
+	{ // values not fitting T are out of range
+		_, err := ParseInt[uint8]("300", 0, 0, math.MaxUint8)
+		require.ErrorIs(t, err, ErrOutOfRange)
+		_, err = ParseInt[uint8]("-1", 0, 0, math.MaxUint8)
+		require.ErrorIs(t, err, ErrOutOfRange)
+		v, err := ParseInt[int8]("-128", 0, math.MinInt8, math.MaxInt8)
+		require.NoError(t, err)
+		require.Equal(t, int8(-128), v)
+	}
+}
+
+func TestParseFloatBool(t *testing.T) {
+	f, err := ParseFloat("", 0.5, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, 0.5, f)
+
+	_, err = ParseFloat("1.5", 0.5, 0, 1)
+	require.ErrorIs(t, err, ErrOutOfRange)
+
+	_, err = ParseFloat("NaN", 0.5, 0, 1)
+	require.Error(t, err)
+
+	b, err := ParseBool("", true)
+	require.NoError(t, err)
+	require.True(t, b)
+
+	b, err = ParseBool("false", true)
+	require.NoError(t, err)
+	require.False(t, b)
+
+	_, err = ParseBool("maybe", true)
+	require.Error(t, err)
+}
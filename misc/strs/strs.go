@@ -0,0 +1,159 @@
+// Package strs holds string helpers needed by most services.
+package strs
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// alphabets for RandomString.
+const (
+	AlphaNumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	Alpha        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	Digits       = "0123456789"
+	Hex          = "0123456789abcdef"
+	// Unambiguous leaves out characters which are easily confused when read, like 0 and O or 1 and l.
+	Unambiguous = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"
+)
+
+// Slugify returns s in lower case with accents removed and runs of other characters than letters and
+// digits replaced by a dash, for use in urls.
+// example:
+//
+//	strs.Slugify("Crème Brûlée, 2 ways!") // creme-brulee-2-ways
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// Truncate shortens s to at most n runes, ending it with ellipsis when it was cut. ellipsis counts
+// toward n, and s is never cut in the middle of a rune.
+// example:
+//
+//	strs.Truncate("hello world", 8, "…") // hello w…
+func Truncate(s string, n int, ellipsis string) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	keep := n - utf8.RuneCountInString(ellipsis)
+	if keep <= 0 {
+		return string([]rune(ellipsis)[:n])
+	}
+	return string([]rune(s)[:keep]) + ellipsis
+}
+
+// words splits s into words at separators, case changes and between letters and digits,
+// keeping runs of upper case letters like HTTP in HTTPServer together.
+func words(s string) []string {
+	var (
+		out  []string
+		word []rune
+	)
+	runes := []rune(s)
+	flush := func() {
+		if len(word) > 0 {
+			out = append(out, string(word))
+			word = word[:0]
+		}
+	}
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if len(word) > 0 {
+			prev := word[len(word)-1]
+			switch {
+			case unicode.IsUpper(r) && !unicode.IsUpper(prev):
+				flush()
+			case unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				flush()
+			case unicode.IsDigit(r) != unicode.IsDigit(prev):
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return out
+}
+
+// SnakeCase converts s, like "HTTPServer ID" or "userName", to snake case, like "http_server_id".
+func SnakeCase(s string) string {
+	ws := words(s)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return strings.Join(ws, "_")
+}
+
+// CamelCase converts s, like "user_name" or "User Name", to lower camel case, like "userName".
+func CamelCase(s string) string {
+	var b strings.Builder
+	for i, w := range words(s) {
+		w = strings.ToLower(w)
+		if i > 0 {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// RandomString returns n characters picked uniformly from alphabet with crypto/rand, for tokens,
+// codes and passwords. AlphaNumeric is used when alphabet is empty.
+// example:
+//
+//	code, err := strs.RandomString(6, strs.Digits)
+func RandomString(n int, alphabet string) (string, error) {
+	if alphabet == "" {
+		alphabet = AlphaNumeric
+	}
+	chars := []rune(alphabet)
+	if len(chars) < 2 {
+		return "", errors.New("alphabet must have at least two characters")
+	}
+
+	max := big.NewInt(int64(len(chars)))
+	out := make([]rune, n)
+	for i := range out {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = chars[j.Int64()]
+	}
+	return string(out), nil
+}
+
+// SecureCompare reports if a and b are equal in time independent of their content, for comparing
+// secrets like api keys or signatures without leaking them through timing.
+func SecureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
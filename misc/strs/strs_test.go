@@ -0,0 +1,51 @@
+package strs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlugify(t *testing.T) {
+	require.Equal(t, "creme-brulee-2-ways", Slugify("Crème Brûlée, 2 ways!"))
+	require.Equal(t, "hello-world", Slugify("  --Hello   World--  "))
+	require.Equal(t, "", Slugify("!!!"))
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "hello", Truncate("hello", 5, "…"))
+	require.Equal(t, "hello w…", Truncate("hello world", 8, "…"))
+	require.Equal(t, "héllo...", Truncate("héllo wörld", 8, "..."))
+	require.Equal(t, "..", Truncate("hello", 2, "..."))
+	require.Equal(t, "", Truncate("hello", 0, "…"))
+}
+
+func TestCase(t *testing.T) {
+	require.Equal(t, "http_server_id", SnakeCase("HTTPServer ID"))
+	require.Equal(t, "user_name", SnakeCase("userName"))
+	require.Equal(t, "order_2_items", SnakeCase("order2Items"))
+	require.Equal(t, "userName", CamelCase("user_name"))
+	require.Equal(t, "userName", CamelCase("User Name"))
+	require.Equal(t, "httpServerId", CamelCase("HTTP-server-id"))
+}
+
+func TestRandomString(t *testing.T) {
+	s, err := RandomString(32, "")
+	require.NoError(t, err)
+	require.Len(t, s, 32)
+
+	code, err := RandomString(6, Digits)
+	require.NoError(t, err)
+	require.Len(t, code, 6)
+	require.Empty(t, strings.Trim(code, Digits))
+
+	_, err = RandomString(6, "a")
+	require.Error(t, err)
+}
+
+func TestSecureCompare(t *testing.T) {
+	require.True(t, SecureCompare("secret", "secret"))
+	require.False(t, SecureCompare("secret", "secreT"))
+	require.False(t, SecureCompare("secret", "secret2"))
+}
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+)
+
+// Slack sends messages to a slack incoming webhook.
+type Slack struct {
+	cfg        *config
+	webhookURL string
+}
+
+func NewSlack(webhookURL string, options ...Option) (*Slack, error) {
+	cfg, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Slack{cfg: cfg, webhookURL: webhookURL}, nil
+}
+
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	return s.cfg.postJSON(ctx, s.webhookURL, map[string]interface{}{
+		"text": fmt.Sprintf("%s*%s*\n%s%s", levelEmoji(msg.Level), msg.Title, msg.Body, formatFields(msg.Fields)),
+	})
+}
+
+// DefaultTelegramAPI is the base url of the telegram bot api.
+const DefaultTelegramAPI = "https://api.telegram.org"
+
+// Telegram sends messages to a chat using a telegram bot.
+type Telegram struct {
+	cfg    *config
+	token  string
+	chatID string
+}
+
+func NewTelegram(token, chatID string, options ...Option) (*Telegram, error) {
+	cfg, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Telegram{cfg: cfg, token: token, chatID: chatID}, nil
+}
+
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	return t.cfg.postJSON(ctx, fmt.Sprintf("%s/bot%s/sendMessage", t.cfg.telegramAPI, t.token), map[string]interface{}{
+		"chat_id": t.chatID,
+		"text":    fmt.Sprintf("%s%s\n%s%s", levelEmoji(msg.Level), msg.Title, msg.Body, formatFields(msg.Fields)),
+	})
+}
+
+// Webhook posts messages as json to an url.
+type Webhook struct {
+	cfg *config
+	url string
+}
+
+func NewWebhook(url string, options ...Option) (*Webhook, error) {
+	cfg, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Webhook{cfg: cfg, url: url}, nil
+}
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	return w.cfg.postJSON(ctx, w.url, msg)
+}
+
+// SMTPConfig holds the smtp server settings, it can be loaded using os.LoadFromEnv.
+type SMTPConfig struct {
+	Host     string `env:"SMTP_HOST,required"`
+	Port     string `env:"SMTP_PORT" envDefault:"587"`
+	User     string `env:"SMTP_USER"`
+	Password string `env:"SMTP_PASSWORD"`
+}
+
+// Email sends messages as plain text emails.
+type Email struct {
+	cfg  SMTPConfig
+	from string
+	to   []string
+}
+
+func NewEmail(cfg SMTPConfig, from string, to ...string) *Email {
+	return &Email{cfg: cfg, from: from, to: to}
+}
+
+func (e *Email) Notify(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if e.cfg.User != "" {
+		auth = smtp.PlainAuth("", e.cfg.User, e.cfg.Password, e.cfg.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.NewReplacer("\r", "", "\n", " ").Replace(msg.Title))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	b.WriteString(formatFields(msg.Fields))
+
+	// net/smtp does not support contexts, run it aside to respect cancellation
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(e.cfg.Host, e.cfg.Port), auth, e.from, e.to, []byte(b.String()))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func levelEmoji(l Level) string {
+	switch l {
+	case Warning:
+		return "⚠️ "
+	case Error:
+		return "🔴 "
+	default:
+		return ""
+	}
+}
+
+func formatFields(fields map[string]string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s: %s", k, fields[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"go.uber.org/multierr"
+)
+
+type Level string
+
+const (
+	Info    Level = "info"
+	Warning Level = "warning"
+	Error   Level = "error"
+)
+
+// Message is a notification sent by a Notifier.
+type Message struct {
+	Title  string            `json:"title"`
+	Body   string            `json:"body"`
+	Level  Level             `json:"level,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Notifier delivers messages to a channel like slack or email.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// NotifierFunc is an adapter to use ordinary functions as Notifier.
+type NotifierFunc func(ctx context.Context, msg Message) error
+
+func (f NotifierFunc) Notify(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+var ErrRateLimited = errors.New("notification dropped by rate limit")
+
+const DefaultTimeout = 10 * time.Second
+
+type config struct {
+	client      *http.Client
+	headers     http.Header
+	telegramAPI string
+}
+
+type Option func(*config) error
+
+// WithHTTPClient sets the http client used by http based notifiers.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) error {
+		c.client = client
+		return nil
+	}
+}
+
+// WithHeader adds a header to requests sent by http based notifiers, like an auth token for webhooks.
+func WithHeader(key, value string) Option {
+	return func(c *config) error {
+		c.headers.Add(key, value)
+		return nil
+	}
+}
+
+// WithTelegramAPI sets the base url of the telegram bot api, DefaultTelegramAPI by default, like for a
+// local bot api server.
+func WithTelegramAPI(url string) Option {
+	return func(c *config) error {
+		c.telegramAPI = strings.TrimRight(url, "/")
+		return nil
+	}
+}
+
+func newConfig(options []Option) (*config, error) {
+	cfg := &config{client: &http.Client{Timeout: DefaultTimeout}, headers: http.Header{}, telegramAPI: DefaultTelegramAPI}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func (c *config) postJSON(ctx context.Context, url string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header = c.headers.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("notification rejected with status %d: %s", res.StatusCode, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+// Multi sends each message to all notifiers and returns the combined errors of the failed ones.
+func Multi(notifiers ...Notifier) Notifier {
+	return NotifierFunc(func(ctx context.Context, msg Message) error {
+		var (
+			mu   sync.Mutex
+			errs error
+			wg   sync.WaitGroup
+		)
+		for _, n := range notifiers {
+			wg.Add(1)
+			go func(n Notifier) {
+				defer wg.Done()
+				if err := n.Notify(ctx, msg); err != nil {
+					mu.Lock()
+					errs = multierr.Append(errs, err)
+					mu.Unlock()
+				}
+			}(n)
+		}
+		wg.Wait()
+		return errs
+	})
+}
+
+// RateLimited lets at most burst messages through at once, refilling one every interval.
+// messages over the limit are dropped with ErrRateLimited, so a flapping alert can not flood a channel.
+// time is read from the clock of ctx.
+func RateLimited(n Notifier, interval time.Duration, burst int) Notifier {
+	var (
+		mu     sync.Mutex
+		tokens = float64(burst)
+		last   time.Time
+	)
+
+	return NotifierFunc(func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		now := clock.FromContext(ctx).Now()
+		if last.IsZero() {
+			last = now
+		}
+		tokens += float64(now.Sub(last)) / float64(interval)
+		if tokens > float64(burst) {
+			tokens = float64(burst)
+		}
+		last = now
+
+		if tokens < 1 {
+			mu.Unlock()
+			return ErrRateLimited
+		}
+		tokens--
+		mu.Unlock()
+
+		return n.Notify(ctx, msg)
+	})
+}
+
+// Template renders messages from text templates.
+type Template struct {
+	title *template.Template
+	body  *template.Template
+	level Level
+}
+
+// NewTemplate parses title and body as text/template templates.
+// example:
+//
+//	tmpl := notify.MustTemplate(notify.Error, "{{.Service}} is down", "health check failed: {{.Err}}")
+//	msg, err := tmpl.Message(data)
+func NewTemplate(level Level, title, body string) (*Template, error) {
+	t, err := template.New("title").Parse(title)
+	if err != nil {
+		return nil, err
+	}
+	b, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{title: t, body: b, level: level}, nil
+}
+
+// MustTemplate is like NewTemplate but panics if templates can not be parsed.
+func MustTemplate(level Level, title, body string) *Template {
+	t, err := NewTemplate(level, title, body)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Message executes the templates with data.
+func (t *Template) Message(data interface{}) (Message, error) {
+	var title, body bytes.Buffer
+	if err := t.title.Execute(&title, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Title: title.String(), Body: body.String(), Level: t.level}, nil
+}
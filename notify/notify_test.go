@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "secret", r.Header.Get("X-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n, err := NewWebhook(srv.URL, WithHeader("X-Token", "secret"))
+	require.NoError(t, err)
+
+	tmpl := MustTemplate(Error, "{{.Service}} is down", "reason: {{.Reason}}")
+	msg, err := tmpl.Message(map[string]string{"Service": "users", "Reason": "db"})
+	require.NoError(t, err)
+
+	require.NoError(t, n.Notify(context.Background(), msg))
+	require.Equal(t, Message{Title: "users is down", Body: "reason: db", Level: Error}, got)
+}
+
+func TestSlackError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("invalid_token"))
+	}))
+	defer srv.Close()
+
+	n, err := NewSlack(srv.URL)
+	require.NoError(t, err)
+	require.EqualError(t, n.Notify(context.Background(), Message{Title: "foo"}), "notification rejected with status 403: invalid_token")
+}
+
+func TestTelegram(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/bot123:abc/sendMessage", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n, err := NewTelegram("123:abc", "-100", WithTelegramAPI(srv.URL+"/"))
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(context.Background(), Message{Title: "deployed", Body: "v1.2", Level: Warning, Fields: map[string]string{"env": "prod"}}))
+	require.Equal(t, map[string]string{"chat_id": "-100", "text": "⚠️ deployed\nv1.2\n\nenv: prod"}, got)
+}
+
+func TestRateLimited(t *testing.T) {
+	sent := 0
+	n := RateLimited(NotifierFunc(func(ctx context.Context, msg Message) error {
+		sent++
+		return nil
+	}), time.Hour, 2)
+
+	require.NoError(t, n.Notify(context.Background(), Message{}))
+	require.NoError(t, n.Notify(context.Background(), Message{}))
+	require.ErrorIs(t, n.Notify(context.Background(), Message{}), ErrRateLimited)
+	require.Equal(t, 2, sent)
+
+	{ // tokens are refilled as time passes
+		fake := goxtest.NewFakeClock(time.Now())
+		ctx := clock.WithContext(context.Background(), fake)
+		n := RateLimited(NotifierFunc(func(ctx context.Context, msg Message) error { return nil }), time.Minute, 1)
+
+		require.NoError(t, n.Notify(ctx, Message{}))
+		require.ErrorIs(t, n.Notify(ctx, Message{}), ErrRateLimited)
+		fake.Advance(time.Minute)
+		require.NoError(t, n.Notify(ctx, Message{}))
+	}
+}
+
+func TestMulti(t *testing.T) {
+	failed := errors.New("failed")
+	sent := make(chan struct{}, 1)
+	n := Multi(
+		NotifierFunc(func(ctx context.Context, msg Message) error { sent <- struct{}{}; return nil }),
+		NotifierFunc(func(ctx context.Context, msg Message) error { return failed }),
+	)
+
+	require.ErrorIs(t, n.Notify(context.Background(), Message{}), failed)
+	require.Len(t, sent, 1)
+}
+
+func TestOutbox(t *testing.T) {
+	o := NewOutbox(nil)
+	require.NoError(t, o.Notify(context.Background(), Message{Title: "welcome"}))
+	require.Equal(t, []Message{{Title: "welcome"}}, o.Messages())
+	o.Reset()
+	require.Empty(t, o.Messages())
+}
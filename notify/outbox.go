@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Outbox keeps the messages sent to it instead of delivering them, and logs them if it has a logger.
+// it stands in for email and chat channels in local development and tests.
+type Outbox struct {
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewOutbox returns an empty outbox, logger may be nil.
+func NewOutbox(logger *zap.Logger) *Outbox {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Outbox{logger: logger}
+}
+
+func (o *Outbox) Notify(_ context.Context, msg Message) error {
+	o.mu.Lock()
+	o.messages = append(o.messages, msg)
+	o.mu.Unlock()
+
+	o.logger.Info("notification kept in outbox", zap.String("title", msg.Title), zap.String("level", string(msg.Level)),
+		zap.String("body", msg.Body), zap.Any("fields", msg.Fields))
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
+
+// Reset drops the messages.
+func (o *Outbox) Reset() {
+	o.mu.Lock()
+	o.messages = nil
+	o.mu.Unlock()
+}
@@ -1,13 +1,17 @@
 package os
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/caarlos0/env/v6"
-	"github.com/go-playground/validator/v10"
+	"github.com/mirzakhany/gox/validation"
 )
 
 // LoadFromEnv load and validate env variables into given target.
+// it is validated by validation.Default, so custom tags registered there can be used in config structs.
 // example:
 //
 //		type config struct {
@@ -25,7 +29,7 @@ func LoadFromEnv(config interface{}) error {
 	if err := env.Parse(config); err != nil {
 		return err
 	}
-	if err := validator.New().Struct(config); err != nil {
+	if err := validation.Default().Struct(config); err != nil {
 		return err
 	}
 	return nil
@@ -39,3 +43,44 @@ func MustGetEnv(key string, def string) string {
 	}
 	return def
 }
+
+// LoadDotEnv sets the variables of the env file at path, like .env, which are not set yet. lines are
+// KEY=VALUE, optionally prefixed with export, values may be quoted and lines starting with # are comments.
+func LoadDotEnv(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: invalid line, expected KEY=VALUE", path, i+1)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
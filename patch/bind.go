@@ -0,0 +1,276 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/validation"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+
+	// DefaultMaxBodySize limits the size of patch documents.
+	DefaultMaxBodySize = 1 << 20
+)
+
+// FieldAuthorizer decides whether the request may change the field at path, a JSON Pointer like
+// /address/city. a returned error is written with status 403 unless it carries its own code.
+type FieldAuthorizer func(r *http.Request, path string) error
+
+type config struct {
+	authorize   FieldAuthorizer
+	allowed     []string
+	maxBodySize int64
+}
+
+type Option func(*config) error
+
+// WithFieldAuthorizer is called with every path the patch changes before it is applied.
+func WithFieldAuthorizer(authorize FieldAuthorizer) Option {
+	return func(c *config) error {
+		c.authorize = authorize
+		return nil
+	}
+}
+
+// WithAllowedFields only allows changes to paths, and the fields below them, like /name or /address.
+func WithAllowedFields(paths ...string) Option {
+	return func(c *config) error {
+		c.allowed = paths
+		return nil
+	}
+}
+
+func WithMaxBodySize(n int64) Option {
+	return func(c *config) error {
+		c.maxBodySize = n
+		return nil
+	}
+}
+
+// Bind applies the patch in the body of r to target and validates the result with
+// validation.Default. target is only changed when the patch is allowed and valid, so it can be
+// persisted right after. bodies of type application/json-patch+json are JSON Patches (RFC 6902),
+// others are JSON Merge Patches (RFC 7386). it returns the changed paths as JSON Pointers, which must
+// name fields of T by their exact json names.
+// example:
+//
+//	user, err := repo.GetUser(ctx, id)
+//	...
+//	changed, err := patch.Bind(r, user,
+//		patch.WithAllowedFields("/name", "/address"),
+//		patch.WithFieldAuthorizer(func(r *http.Request, path string) error {
+//			if path == "/role" && !isAdmin(r) {
+//				return errs.Forbidden("only admins can change roles")
+//			}
+//			return nil
+//		}))
+//	if err != nil {
+//		rest.WriteErr(w, err)
+//		return
+//	}
+//	err = repo.UpdateUser(ctx, user, changed)
+func Bind[T any](r *http.Request, target *T, options ...Option) ([]string, error) {
+	cfg := &config{maxBodySize: DefaultMaxBodySize}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, cfg.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > cfg.maxBodySize {
+		return nil, errs.Invalid("patch is larger than %d bytes", cfg.maxBodySize)
+	}
+
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var paths []string
+	var patched []byte
+	if mediaType == JSONPatchType {
+		ops, err := decodeOperations(body)
+		if err != nil {
+			return nil, err
+		}
+		paths = operationPaths(ops)
+		if err := cfg.check(r, reflect.TypeOf(target).Elem(), paths); err != nil {
+			return nil, err
+		}
+		if patched, err = JSONPatch(doc, body); err != nil {
+			return nil, err
+		}
+	} else {
+		var p interface{}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, errs.Wrap(err, errs.CodeInvalidArgument, "invalid merge patch")
+		}
+		if _, ok := p.(map[string]interface{}); !ok {
+			return nil, errs.Invalid("merge patch must be an object")
+		}
+		paths = mergePaths("", p)
+		if err := cfg.check(r, reflect.TypeOf(target).Elem(), paths); err != nil {
+			return nil, err
+		}
+		if patched, err = MergePatch(doc, body); err != nil {
+			return nil, err
+		}
+	}
+
+	var result T
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return nil, errs.Invalid("patched document is invalid: %v", err)
+	}
+	if err := validation.Default().StructCtx(r.Context(), &result); err != nil {
+		return nil, errs.Invalid("%s", validation.Message(err))
+	}
+
+	*target = result
+	return paths, nil
+}
+
+// check rejects paths which are not fields of t by their exact json name, since decoding would match
+// them regardless of case and so around the authorization of the field, then authorizes them.
+func (c *config) check(r *http.Request, t reflect.Type, paths []string) error {
+	for _, p := range paths {
+		tokens, err := parsePointer(p)
+		if err != nil {
+			return errs.Invalid("%v", err)
+		}
+		if !knownPath(t, tokens) {
+			return errs.Invalid("%s is not a field", p)
+		}
+	}
+	for _, p := range paths {
+		if len(c.allowed) > 0 && !allowedPath(c.allowed, p) {
+			return errs.Forbidden("%s can not be changed", p)
+		}
+		if c.authorize != nil {
+			if err := c.authorize(r, p); err != nil {
+				if errs.CodeOf(err) == errs.CodeUnknown {
+					err = errs.WithCode(err, errs.CodePermissionDenied)
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// knownPath reports if tokens lead through the fields of t by their exact json names. free form values,
+// like maps and interfaces, take any key.
+func knownPath(t reflect.Type, tokens []string) bool {
+	for _, tok := range tokens {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := jsonField(t, tok)
+			if !ok {
+				return false
+			}
+			t = f
+		case reflect.Map, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		default:
+			return t.Kind() == reflect.Interface
+		}
+	}
+	return true
+}
+
+// jsonField returns the type of the field of struct t encoded as name, including promoted fields.
+func jsonField(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if typ, ok := jsonField(ft, name); ok {
+					return typ, true
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+func allowedPath(allowed []string, path string) bool {
+	for _, a := range allowed {
+		if path == a || strings.HasPrefix(path, a+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mergePaths returns the pointers of the leaves of a merge patch, which are the changed fields.
+func mergePaths(prefix string, p interface{}) []string {
+	obj, ok := p.(map[string]interface{})
+	if !ok || (len(obj) == 0 && prefix != "") {
+		return []string{prefix}
+	}
+	var paths []string
+	for k, v := range obj {
+		paths = append(paths, mergePaths(prefix+"/"+escapeToken(k), v)...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// operationPaths returns the paths changed by ops, move also changes its source.
+func operationPaths(ops []Operation) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	addPath := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	for _, op := range ops {
+		switch op.Op {
+		case "test":
+			continue
+		case "move":
+			addPath(op.From)
+		}
+		addPath(op.Path)
+	}
+	return paths
+}
@@ -0,0 +1,143 @@
+package patch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples of appendix A of RFC 7386
+	cases := []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	}
+	for _, c := range cases {
+		got, err := MergePatch([]byte(c.doc), []byte(c.patch))
+		require.NoError(t, err)
+		require.JSONEq(t, c.want, string(got), c.patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	doc := `{"foo":["bar","baz"],"a":{"b":1}}`
+	cases := []struct{ patch, want string }{
+		{`[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"],"a":{"b":1}}`},
+		{`[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","baz","qux"],"a":{"b":1}}`},
+		{`[{"op":"remove","path":"/foo/0"}]`, `{"foo":["baz"],"a":{"b":1}}`},
+		{`[{"op":"replace","path":"/a/b","value":2}]`, `{"foo":["bar","baz"],"a":{"b":2}}`},
+		{`[{"op":"move","from":"/a/b","path":"/c"}]`, `{"foo":["bar","baz"],"a":{},"c":1}`},
+		{`[{"op":"copy","from":"/foo","path":"/a/foo"}]`, `{"foo":["bar","baz"],"a":{"b":1,"foo":["bar","baz"]}}`},
+		{`[{"op":"test","path":"/a/b","value":1},{"op":"remove","path":"/a"}]`, `{"foo":["bar","baz"]}`},
+	}
+	for _, c := range cases {
+		got, err := JSONPatch([]byte(doc), []byte(c.patch))
+		require.NoError(t, err, c.patch)
+		require.JSONEq(t, c.want, string(got), c.patch)
+	}
+
+	{ // failures
+		_, err := JSONPatch([]byte(doc), []byte(`[{"op":"test","path":"/a/b","value":2}]`))
+		require.ErrorIs(t, err, ErrTestFailed)
+		_, err = JSONPatch([]byte(doc), []byte(`[{"op":"remove","path":"/missing"}]`))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		_, err = JSONPatch([]byte(doc), []byte(`[{"op":"add","path":"/x/y","value":1}]`))
+		require.Error(t, err)
+	}
+}
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type user struct {
+	Name    string  `json:"name" validate:"required"`
+	Role    string  `json:"role"`
+	Address address `json:"address"`
+	IsAdmin bool    `json:"isAdmin"`
+	Tags    map[string]string
+}
+
+func TestBind(t *testing.T) {
+	request := func(contentType, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return r
+	}
+	noRole := WithFieldAuthorizer(func(r *http.Request, path string) error {
+		if path == "/role" {
+			return errs.Forbidden("only admins can change roles")
+		}
+		return nil
+	})
+
+	{ // merge patch
+		u := user{Name: "alice", Role: "member", Address: address{City: "Berlin"}}
+		changed, err := Bind(request(MergePatchType, `{"address":{"city":"Paris"}}`), &u, noRole)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/address/city"}, changed)
+		require.Equal(t, "Paris", u.Address.City)
+	}
+
+	{ // json patch
+		u := user{Name: "alice", Role: "member", Address: address{City: "Berlin"}}
+		changed, err := Bind(request(JSONPatchType, `[{"op":"replace","path":"/name","value":"bob"}]`), &u, noRole)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/name"}, changed)
+		require.Equal(t, "bob", u.Name)
+	}
+
+	{ // unauthorized fields leave target unchanged
+		u := user{Name: "alice", Role: "member", Address: address{City: "Berlin"}}
+		_, err := Bind(request(MergePatchType, `{"name":"bob","role":"admin"}`), &u, noRole)
+		require.Equal(t, errs.CodePermissionDenied, errs.CodeOf(err))
+		require.Equal(t, "alice", u.Name)
+
+		_, err = Bind(request(MergePatchType, `{"role":"admin"}`), &u, WithAllowedFields("/name", "/address"))
+		require.Equal(t, errs.CodePermissionDenied, errs.CodeOf(err))
+	}
+
+	{ // fields are matched by their exact names, so authorization can not be bypassed by case
+		noAdmin := WithFieldAuthorizer(func(r *http.Request, path string) error {
+			if path == "/isAdmin" || path == "/role" {
+				return errs.Forbidden("only admins can change this")
+			}
+			return nil
+		})
+		u := user{Name: "alice", Role: "member", Address: address{City: "Berlin"}}
+		_, err := Bind(request(JSONPatchType, `[{"op":"add","path":"/isadmin","value":true}]`), &u, noAdmin)
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		_, err = Bind(request(MergePatchType, `{"Role":"admin"}`), &u, noAdmin)
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		_, err = Bind(request(MergePatchType, `{"address":{"City":"Paris"}}`), &u, noAdmin)
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		require.False(t, u.IsAdmin)
+		require.Equal(t, "member", u.Role)
+
+		// untagged fields go by their go name, maps take any key
+		changed, err := Bind(request(MergePatchType, `{"Tags":{"Team":"core"}}`), &u, noAdmin)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/Tags/Team"}, changed)
+		require.Equal(t, "core", u.Tags["Team"])
+	}
+
+	{ // invalid results
+		u := user{Name: "alice", Address: address{City: "Berlin"}}
+		_, err := Bind(request(MergePatchType, `{"name":null}`), &u)
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		_, err = Bind(request(MergePatchType, `{"unknown":1}`), &u)
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		require.Equal(t, "alice", u.Name)
+	}
+}
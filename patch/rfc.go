@@ -0,0 +1,277 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mirzakhany/gox/errs"
+)
+
+// ErrTestFailed is returned when a test operation of a JSON Patch does not match the document.
+var ErrTestFailed = errs.Conflict("patch test operation failed")
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to doc.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var d, p interface{}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &d); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, errs.Wrap(err, errs.CodeInvalidArgument, "invalid merge patch")
+	}
+	return json.Marshal(mergeValue(d, p))
+}
+
+func mergeValue(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+			continue
+		}
+		d[k] = mergeValue(d[k], v)
+	}
+	return d
+}
+
+// Operation is an operation of a JSON Patch (RFC 6902).
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch applies a JSON Patch (RFC 6902) to doc, the operations are applied in order and none of
+// them when one fails.
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	ops, err := decodeOperations(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var d interface{}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if d, err = applyOperation(d, op); err != nil {
+			if err == ErrTestFailed {
+				return nil, err
+			}
+			return nil, errs.Invalid("patch operation %d (%s %s) failed: %v", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(d)
+}
+
+func decodeOperations(patch []byte) ([]Operation, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, errs.Wrap(err, errs.CodeInvalidArgument, "invalid json patch")
+	}
+	return ops, nil
+}
+
+func applyOperation(doc interface{}, op Operation) (interface{}, error) {
+	var value interface{}
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("value is required")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return add(doc, op.Path, value)
+	case "remove":
+		doc, _, err := remove(doc, op.Path)
+		return doc, err
+	case "replace":
+		doc, _, err := remove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("can not move %s into itself", op.From)
+		}
+		doc, v, err := remove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, v)
+	case "copy":
+		v, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, deepCopy(v))
+	case "test":
+		v, err := get(doc, op.Path)
+		if err != nil || !reflect.DeepEqual(v, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[t]
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist", pointer)
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(d) {
+				return nil, fmt.Errorf("%s does not exist", pointer)
+			}
+			doc = d[i]
+		default:
+			return nil, fmt.Errorf("%s does not exist", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at pointer, inserting into arrays, and returns the changed document.
+func add(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return update(doc, tokens, pointer, func(parent interface{}, last string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[last] = value
+			return p, nil
+		case []interface{}:
+			if last == "-" {
+				return append(p, value), nil
+			}
+			i, err := strconv.Atoi(last)
+			if err != nil || i < 0 || i > len(p) {
+				return nil, fmt.Errorf("%s is out of range", pointer)
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		}
+		return nil, fmt.Errorf("parent of %s is not a container", pointer)
+	}, value)
+}
+
+// remove deletes the value at pointer and returns the changed document and the removed value.
+func remove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed interface{}
+	doc, err = update(doc, tokens, pointer, func(parent interface{}, last string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			v, ok := p[last]
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist", pointer)
+			}
+			removed = v
+			delete(p, last)
+			return p, nil
+		case []interface{}:
+			i, err := strconv.Atoi(last)
+			if err != nil || i < 0 || i >= len(p) {
+				return nil, fmt.Errorf("%s does not exist", pointer)
+			}
+			removed = p[i]
+			return append(p[:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%s does not exist", pointer)
+	}, nil)
+	return doc, removed, err
+}
+
+// update calls change with the parent of the value at tokens and stores the parent it returns, as
+// changing arrays may reallocate them. an empty pointer replaces the whole document with root.
+func update(doc interface{}, tokens []string, pointer string, change func(parent interface{}, last string) (interface{}, error), root interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return root, nil
+	}
+	if len(tokens) == 1 {
+		return change(doc, tokens[0])
+	}
+
+	child, err := get(doc, "/"+escapeToken(tokens[0]))
+	if err != nil {
+		return nil, fmt.Errorf("parent of %s does not exist", pointer)
+	}
+	child, err = update(child, tokens[1:], pointer, change, root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		d[tokens[0]] = child
+	case []interface{}:
+		i, _ := strconv.Atoi(tokens[0])
+		d[i] = child
+	}
+	return doc, nil
+}
+
+func escapeToken(t string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1")
+}
+
+func deepCopy(v interface{}) interface{} {
+	b, _ := json.Marshal(v)
+	var out interface{}
+	_ = json.Unmarshal(b, &out)
+	return out
+}
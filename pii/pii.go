@@ -0,0 +1,293 @@
+package pii
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Tag is the struct tag declaring a field as personal data, its value is the kind of data, like
+// `pii:"email"`, which picks how it is masked.
+const Tag = "pii"
+
+const (
+	KindEmail = "email"
+	KindPhone = "phone"
+	KindName  = "name"
+	KindIP    = "ip"
+)
+
+// Masked replaces values of kinds without a masker.
+const Masked = "***"
+
+var (
+	maskersMu sync.RWMutex
+	maskers   = map[string]func(string) string{
+		KindEmail: maskEmail,
+		KindPhone: maskPhone,
+		KindName:  maskName,
+		KindIP:    maskIP,
+	}
+)
+
+// RegisterMasker sets how values of kind are masked, like to keep the last digits of card numbers.
+func RegisterMasker(kind string, mask func(string) string) {
+	maskersMu.Lock()
+	defer maskersMu.Unlock()
+	maskers[kind] = mask
+}
+
+// Mask masks s as a value of kind, empty values stay empty.
+// example:
+//
+//	pii.Mask(pii.KindEmail, "ann@example.com") // "a***@example.com"
+func Mask(kind, s string) string {
+	if s == "" {
+		return ""
+	}
+	maskersMu.RLock()
+	mask, ok := maskers[kind]
+	maskersMu.RUnlock()
+	if !ok {
+		return Masked
+	}
+	return mask(s)
+}
+
+func maskEmail(s string) string {
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" {
+		return Masked
+	}
+	return local[:1] + Masked + "@" + domain
+}
+
+func maskPhone(s string) string {
+	var digits []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits = append(digits, s[i])
+		}
+	}
+	if len(digits) <= 4 {
+		return Masked
+	}
+	return Masked + string(digits[len(digits)-4:])
+}
+
+func maskName(s string) string {
+	for _, r := range s {
+		return string(r) + Masked
+	}
+	return Masked
+}
+
+// maskIP keeps the network of addresses, /24 for IPv4 and /48 for IPv6.
+func maskIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return Masked
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// Scrub returns a copy of v with the fields tagged with pii masked, nested structs, pointers, slices
+// and maps included. v is returned as is when its type has no personal data. tagged fields which are
+// not strings, string pointers or string slices are set to their zero value. pointers and maps seen
+// before are copied once, so cyclic values keep their shape, and values nested deeper than
+// maxScrubDepth are dropped.
+// example:
+//
+//	type User struct {
+//		ID    string `json:"id"`
+//		Email string `json:"email" pii:"email"`
+//	}
+//
+//	pii.Scrub(User{ID: "1", Email: "ann@example.com"}) // User{ID: "1", Email: "a***@example.com"}
+func Scrub(v interface{}) interface{} {
+	if v == nil || !hasPII(reflect.TypeOf(v)) {
+		return v
+	}
+	s := &scrubber{seen: map[visit]reflect.Value{}}
+	return s.scrub(reflect.ValueOf(v)).Interface()
+}
+
+// maxScrubDepth bounds the nesting Scrub follows, deeper values are set to their zero value.
+const maxScrubDepth = 64
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// scrubber keeps the copies of the pointers and maps of a value, so each is scrubbed once.
+type scrubber struct {
+	seen  map[visit]reflect.Value
+	depth int
+}
+
+func (s *scrubber) scrub(v reflect.Value) reflect.Value {
+	t := v.Type()
+	s.depth++
+	defer func() { s.depth-- }()
+	if s.depth > maxScrubDepth {
+		return reflect.Zero(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !hasPII(t.Elem()) {
+			return v
+		}
+		key := visit{ptr: v.Pointer(), typ: t}
+		if out, ok := s.seen[key]; ok {
+			return out
+		}
+		out := reflect.New(t.Elem())
+		s.seen[key] = out
+		out.Elem().Set(s.scrub(v.Elem()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() || !hasPII(v.Elem().Type()) {
+			return v
+		}
+		out := reflect.New(t).Elem()
+		out.Set(s.scrub(v.Elem()))
+		return out
+	case reflect.Struct:
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if kind := f.Tag.Get(Tag); kind != "" {
+				mask(out.Field(i), kind)
+				continue
+			}
+			if hasPII(f.Type) {
+				out.Field(i).Set(s.scrub(v.Field(i)))
+			}
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(s.scrub(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(s.scrub(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		key := visit{ptr: v.Pointer(), typ: t}
+		if out, ok := s.seen[key]; ok {
+			return out
+		}
+		out := reflect.MakeMapWithSize(t, v.Len())
+		s.seen[key] = out
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), s.scrub(iter.Value()))
+		}
+		return out
+	}
+	return v
+}
+
+// mask masks the settable field v of kind.
+func mask(v reflect.Value, kind string) {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(Mask(kind, v.String()))
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.String && !v.IsNil():
+		p := reflect.New(v.Type().Elem())
+		p.Elem().SetString(Mask(kind, v.Elem().String()))
+		v.Set(p)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String && !v.IsNil():
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).SetString(Mask(kind, v.Index(i).String()))
+		}
+		v.Set(out)
+	default:
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
+
+var piiTypes sync.Map // reflect.Type -> bool
+
+// hasPII reports whether values of t may hold tagged fields. interfaces may, their dynamic type is
+// checked while scrubbing.
+func hasPII(t reflect.Type) bool {
+	if v, ok := piiTypes.Load(t); ok {
+		return v.(bool)
+	}
+	found := findPII(t, map[reflect.Type]bool{})
+	piiTypes.Store(t, found)
+	return found
+}
+
+func findPII(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return findPII(t.Elem(), seen)
+	case reflect.Interface:
+		return true
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.IsExported() && (f.Tag.Get(Tag) != "" || findPII(f.Type, seen)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Columns returns the kinds of the tagged fields of the struct v by column name, which is the name of
+// the json tag and the db tag of the field, so rows exported from either can be masked.
+func Columns(v interface{}) map[string]string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	columns := map[string]string{}
+	if t == nil || t.Kind() != reflect.Struct {
+		return columns
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		kind := f.Tag.Get(Tag)
+		if kind == "" || !f.IsExported() {
+			continue
+		}
+		columns[f.Name] = kind
+		for _, tag := range []string{"json", "db"} {
+			if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" && name != "-" {
+				columns[name] = kind
+			}
+		}
+	}
+	return columns
+}
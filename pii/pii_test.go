@@ -0,0 +1,143 @@
+package pii
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type address struct {
+	City string `json:"city"`
+	IP   string `json:"ip" pii:"ip"`
+}
+
+type user struct {
+	ID      string            `json:"id"`
+	Email   string            `json:"email" db:"email_address" pii:"email"`
+	Phone   *string           `json:"phone,omitempty" pii:"phone"`
+	Names   []string          `json:"names" pii:"name"`
+	Age     int               `json:"age" pii:"age"`
+	Address *address          `json:"address"`
+	Friends []user            `json:"friends"`
+	Labels  map[string]string `json:"labels"`
+	Extra   interface{}       `json:"extra"`
+}
+
+func TestMask(t *testing.T) {
+	require.Equal(t, "a***@example.com", Mask(KindEmail, "ann@example.com"))
+	require.Equal(t, Masked, Mask(KindEmail, "not an email"))
+	require.Equal(t, "***4567", Mask(KindPhone, "+49 (30) 123-4567"))
+	require.Equal(t, "Ä***", Mask(KindName, "Änne"))
+	require.Equal(t, "192.168.1.0", Mask(KindIP, "192.168.1.77"))
+	require.Equal(t, "2001:db8:1::", Mask(KindIP, "2001:db8:1:2::1"))
+	require.Equal(t, Masked, Mask("unknown", "secret"))
+	require.Equal(t, "", Mask(KindEmail, ""))
+
+	RegisterMasker("iban", func(s string) string { return s[:2] + Masked })
+	require.Equal(t, "DE***", Mask("iban", "DE89370400440532013000"))
+}
+
+func TestScrub(t *testing.T) {
+	phone := "+49301234567"
+	u := user{
+		ID:      "1",
+		Email:   "ann@example.com",
+		Phone:   &phone,
+		Names:   []string{"Ann", "Annie"},
+		Age:     42,
+		Address: &address{City: "Berlin", IP: "10.0.0.7"},
+		Friends: []user{{ID: "2", Email: "bob@example.com"}},
+		Labels:  map[string]string{"plan": "pro"},
+		Extra:   address{IP: "10.1.2.3"},
+	}
+
+	scrubbed := Scrub(u).(user)
+	require.Equal(t, "1", scrubbed.ID)
+	require.Equal(t, "a***@example.com", scrubbed.Email)
+	require.Equal(t, "***4567", *scrubbed.Phone)
+	require.Equal(t, []string{"A***", "A***"}, scrubbed.Names)
+	require.Zero(t, scrubbed.Age)
+	require.Equal(t, &address{City: "Berlin", IP: "10.0.0.0"}, scrubbed.Address)
+	require.Equal(t, "b***@example.com", scrubbed.Friends[0].Email)
+	require.Equal(t, map[string]string{"plan": "pro"}, scrubbed.Labels)
+	require.Equal(t, address{IP: "10.1.2.0"}, scrubbed.Extra)
+
+	{ // the original is not changed
+		require.Equal(t, "ann@example.com", u.Email)
+		require.Equal(t, "+49301234567", phone)
+		require.Equal(t, []string{"Ann", "Annie"}, u.Names)
+		require.Equal(t, "10.0.0.7", u.Address.IP)
+		require.Equal(t, "bob@example.com", u.Friends[0].Email)
+	}
+
+	{ // pointers, slices and maps of tagged structs
+		require.Equal(t, "a***@example.com", Scrub(&u).(*user).Email)
+		require.Equal(t, "a***@example.com", Scrub([]user{u}).([]user)[0].Email)
+		require.Equal(t, "a***@example.com", Scrub(map[string]interface{}{"user": u}).(map[string]interface{})["user"].(user).Email)
+	}
+
+	{ // values without personal data are returned as is
+		labels := map[string]string{"a": "b"}
+		require.Equal(t, labels, Scrub(labels))
+		require.Nil(t, Scrub(nil))
+	}
+
+	{ // cyclic values keep their shape
+		type node struct {
+			Email string `pii:"email"`
+			Next  *node
+		}
+		n := &node{Email: "ann@example.com"}
+		n.Next = n
+		scrubbed := Scrub(n).(*node)
+		require.Equal(t, "a***@example.com", scrubbed.Email)
+		require.Same(t, scrubbed, scrubbed.Next)
+
+		m := map[string]interface{}{"user": u}
+		m["self"] = m
+		require.NotPanics(t, func() { Scrub(m) })
+	}
+
+	{ // values nested too deep are dropped
+		var v interface{} = u
+		for i := 0; i < 2*maxScrubDepth; i++ {
+			v = []interface{}{v}
+		}
+		v = Scrub(v)
+		for {
+			s, ok := v.([]interface{})
+			require.True(t, ok, "%T", v)
+			if s == nil {
+				break
+			}
+			v = s[0]
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"Email": KindEmail, "email": KindEmail, "email_address": KindEmail,
+		"Phone": KindPhone, "phone": KindPhone,
+		"Names": KindName, "names": KindName,
+		"Age": "age", "age": "age",
+	}, Columns(&user{}))
+	require.Empty(t, Columns("not a struct"))
+}
+
+func TestNewCore(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(NewCore(core)).With(zap.Any("actor", user{ID: "1", Email: "ann@example.com"}))
+
+	logger.Info("updated", zap.Any("user", &user{ID: "2", Email: "bob@example.com"}), zap.String("email", "kept@example.com"))
+	logger.Debug("dropped", zap.Any("user", user{}))
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "a***@example.com", fields["actor"].(user).Email)
+	require.Equal(t, "b***@example.com", fields["user"].(*user).Email)
+	require.Equal(t, "kept@example.com", fields["email"])
+}
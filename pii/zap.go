@@ -0,0 +1,51 @@
+package pii
+
+import (
+	"reflect"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type scrubCore struct {
+	zapcore.Core
+}
+
+// NewCore returns a core scrubbing the values of fields like zap.Any, so tagged fields of logged
+// structs are masked. it must wrap the core writing the entries, like inside a sampler, since it
+// does not call the Check of core. log.NewLogger uses it.
+// example:
+//
+//	logger := zap.New(pii.NewCore(zapcore.NewCore(encoder, out, level)))
+func NewCore(core zapcore.Core) zapcore.Core {
+	return &scrubCore{Core: core}
+}
+
+func (c *scrubCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scrubCore{Core: c.Core.With(scrubFields(fields))}
+}
+
+func (c *scrubCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *scrubCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(e, scrubFields(fields))
+}
+
+// scrubFields returns fields with the reflected values scrubbed, copying fields only if needed.
+func scrubFields(fields []zapcore.Field) []zapcore.Field {
+	out, copied := fields, false
+	for i, f := range fields {
+		if f.Type != zapcore.ReflectType || f.Interface == nil || !hasPII(reflect.TypeOf(f.Interface)) {
+			continue
+		}
+		if !copied {
+			out, copied = append([]zapcore.Field(nil), fields...), true
+		}
+		out[i].Interface = Scrub(f.Interface)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Check requests the probe at url and returns an error unless it answers with a 2xx status.
+// example:
+//
+//	err := probe.Check(ctx, "http://127.0.0.1:8080/ready")
+func Check(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s returned %d: %s", url, res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrStandby is returned by the probe of a gate on standby.
+var ErrStandby = errors.New("deployment is on standby")
+
+type GateState string
+
+const (
+	// Active deployments get traffic
+	Active GateState = "active"
+	// Standby deployments are alive but not ready, so load balancers send traffic to the other color
+	Standby GateState = "standby"
+)
+
+// GateStatus is the state of a gate, as served by its handler.
+type GateStatus struct {
+	State  GateState `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// Gate marks a deployment as active or on standby for blue-green cutovers. its Probe is added as a
+// readiness probe, so flipping a gate takes the deployment out of or back into the load balancer
+// while liveness keeps passing and nothing is restarted.
+// example:
+//
+//	gate := probe.NewGate(probe.Standby)
+//	handler := probe.New(nil, probe.WithProbe(probe.Readiness, gate.Probe))
+//	adminRouter.Handle("/gate", gate.Handler())
+//
+//	// cut over with: curl -X PUT -d '{"state":"active"}' http://green-admin/gate
+type Gate struct {
+	mu       sync.RWMutex
+	status   GateStatus
+	onChange []func(GateStatus)
+}
+
+// NewGate returns a gate in state, deployments started next to the active one start on Standby.
+func NewGate(state GateState) *Gate {
+	return &Gate{status: GateStatus{State: state, Since: time.Now()}}
+}
+
+// Set changes the state of the gate, reason is shown in its status.
+func (g *Gate) Set(state GateState, reason string) error {
+	if state != Active && state != Standby {
+		return errors.New("gate state must be active or standby")
+	}
+
+	g.mu.Lock()
+	changed := g.status.State != state
+	g.status = GateStatus{State: state, Reason: reason, Since: g.status.Since}
+	if changed {
+		g.status.Since = time.Now()
+	}
+	status, listeners := g.status, g.onChange
+	g.mu.Unlock()
+
+	if changed {
+		for _, fn := range listeners {
+			fn(status)
+		}
+	}
+	return nil
+}
+
+// OnChange calls fn when the state of the gate changes, like to log cutovers or drain workers.
+func (g *Gate) OnChange(fn func(GateStatus)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onChange = append(g.onChange, fn)
+}
+
+func (g *Gate) Status() GateStatus {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.status
+}
+
+// Probe fails with ErrStandby while the gate is on standby.
+func (g *Gate) Probe() error {
+	if g.Status().State == Standby {
+		return ErrStandby
+	}
+	return nil
+}
+
+// Handler serves the status of the gate on GET and changes it on PUT or POST with a GateStatus body,
+// of which state and reason are used. it must only be reachable by operators, like on an admin port.
+func (g *Gate) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req GateStatus
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				writeGateJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body: " + err.Error()})
+				return
+			}
+			if err := g.Set(req.State, req.Reason); err != nil {
+				writeGateJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeGateJSON(w, http.StatusOK, g.Status())
+	})
+}
+
+func writeGateJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
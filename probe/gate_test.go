@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGate(t *testing.T) {
+	gate := NewGate(Standby)
+	probeHandler := New(nil, WithProbe(Readiness, gate.Probe))
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		probeHandler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result().StatusCode
+	}
+
+	{ // standby deployments are alive but not ready
+		require.ErrorIs(t, gate.Probe(), ErrStandby)
+		require.Equal(t, http.StatusInternalServerError, status("/ready"))
+		require.Equal(t, http.StatusOK, status("/alive"))
+	}
+
+	var changes []GateStatus
+	gate.OnChange(func(s GateStatus) { changes = append(changes, s) })
+
+	{ // the admin api activates the gate
+		w := httptest.NewRecorder()
+		gate.Handler().ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader(`{"state":"active","reason":"cutover"}`)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got GateStatus
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		require.Equal(t, Active, got.State)
+		require.Equal(t, "cutover", got.Reason)
+
+		require.NoError(t, gate.Probe())
+		require.Equal(t, http.StatusOK, status("/ready"))
+		require.Len(t, changes, 1)
+	}
+
+	{ // setting the same state again does not notify
+		require.NoError(t, gate.Set(Active, "again"))
+		require.Len(t, changes, 1)
+		require.Equal(t, "again", gate.Status().Reason)
+	}
+
+	{ // unknown states are rejected
+		w := httptest.NewRecorder()
+		gate.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"state":"purple"}`)))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, Active, gate.Status().State)
+
+		w = httptest.NewRecorder()
+		gate.Handler().ServeHTTP(w, httptest.NewRequest("DELETE", "/", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultHeartbeatInterval = time.Minute
+	DefaultHeartbeatJitter   = 0.1
+	DefaultHeartbeatTimeout  = 10 * time.Second
+)
+
+type HeartbeatOption func(*Heartbeat) error
+
+// WithHeartbeatInterval sets how often the heartbeat url is pinged, it must be shorter than the
+// period the uptime system expects pings in.
+func WithHeartbeatInterval(d time.Duration) HeartbeatOption {
+	return func(h *Heartbeat) error {
+		if d <= 0 {
+			return errors.New("heartbeat interval must be positive")
+		}
+		h.interval = d
+		return nil
+	}
+}
+
+// WithHeartbeatJitter randomizes each interval by up to the fraction f of it, so replicas do not ping
+// at the same time.
+func WithHeartbeatJitter(f float64) HeartbeatOption {
+	return func(h *Heartbeat) error {
+		if f < 0 || f >= 1 {
+			return errors.New("heartbeat jitter must be in [0, 1)")
+		}
+		h.jitter = f
+		return nil
+	}
+}
+
+// WithHeartbeatProbes only pings while the readiness and aliveness probes pass, like the ones given
+// to New.
+func WithHeartbeatProbes(probes ...Probe) HeartbeatOption {
+	return func(h *Heartbeat) error {
+		h.probes = append(h.probes, probes...)
+		return nil
+	}
+}
+
+// WithFailURL pings url with the failing probe error as body instead of skipping the ping, like the
+// /fail url of healthchecks.io, so the uptime system alerts at once.
+func WithFailURL(url string) HeartbeatOption {
+	return func(h *Heartbeat) error {
+		h.failURL = url
+		return nil
+	}
+}
+
+func WithHeartbeatClient(client *http.Client) HeartbeatOption {
+	return func(h *Heartbeat) error {
+		h.client = client
+		return nil
+	}
+}
+
+func WithHeartbeatLogger(logger *zap.Logger) HeartbeatOption {
+	return func(h *Heartbeat) error {
+		h.logger = logger
+		return nil
+	}
+}
+
+// Heartbeat pings an external heartbeat url, like the ones of healthchecks.io or Cronitor, while the
+// service is healthy. the uptime system alerts when the pings stop, which also catches services that
+// are down as a whole or can not reach out.
+type Heartbeat struct {
+	url      string
+	failURL  string
+	interval time.Duration
+	jitter   float64
+	probes   []Probe
+	client   *http.Client
+	logger   *zap.Logger
+}
+
+// NewHeartbeat returns a heartbeat pinging url, it is a gox.Component to add to the Runner. cron style
+// workers which run once call Ping after each successful run instead.
+// example:
+//
+//	hb, err := probe.NewHeartbeat("https://hc-ping.com/<uuid>",
+//		probe.WithHeartbeatProbes(probe.WithProbe(probe.Readiness, pool.Ping)),
+//		probe.WithFailURL("https://hc-ping.com/<uuid>/fail"))
+//	runner, err := gox.NewRunner(gox.WithComponents(hb, ...))
+func NewHeartbeat(url string, options ...HeartbeatOption) (*Heartbeat, error) {
+	if url == "" {
+		return nil, errors.New("heartbeat url is required")
+	}
+	h := &Heartbeat{
+		url:      url,
+		interval: DefaultHeartbeatInterval,
+		jitter:   DefaultHeartbeatJitter,
+		client:   &http.Client{Timeout: DefaultHeartbeatTimeout},
+		logger:   zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *Heartbeat) Name() string {
+	return "heartbeat"
+}
+
+func (h *Heartbeat) Describe() map[string]interface{} {
+	return map[string]interface{}{"interval": h.interval.String(), "probes": len(h.probes)}
+}
+
+// Run pings at once and then every interval until ctx is done. failed pings are logged and retried
+// with the next one, they never stop the service.
+func (h *Heartbeat) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for {
+		if err := h.beat(ctx); err != nil && ctx.Err() == nil {
+			h.logger.Warn("heartbeat failed", zap.String("url", h.url), zap.Error(err))
+		}
+
+		select {
+		case <-clk.After(h.next()):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// beat pings the url if the probes pass, or the fail url if they do not.
+func (h *Heartbeat) beat(ctx context.Context) error {
+	for _, t := range []Type{Readiness, Aliveness} {
+		if err := checkProbes(h.probes, t); err != nil {
+			h.logger.Warn("heartbeat skipped, service is unhealthy", zap.Error(err))
+			if h.failURL == "" {
+				return nil
+			}
+			return h.ping(ctx, h.failURL, err.Error())
+		}
+	}
+	return h.Ping(ctx)
+}
+
+// Ping pings the heartbeat url once.
+func (h *Heartbeat) Ping(ctx context.Context) error {
+	return h.ping(ctx, h.url, "")
+}
+
+func (h *Heartbeat) ping(ctx context.Context, url, body string) error {
+	method := http.MethodGet
+	var r io.Reader
+	if body != "" {
+		method, r = http.MethodPost, strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1024))
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("heartbeat returned %d", res.StatusCode)
+	}
+	return nil
+}
+
+// next returns the interval randomized by the jitter.
+func (h *Heartbeat) next() time.Duration {
+	if h.jitter == 0 {
+		return h.interval
+	}
+	delta := (rand.Float64()*2 - 1) * h.jitter * float64(h.interval)
+	return h.interval + time.Duration(delta)
+}
@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	var paths, bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		paths, bodies = append(paths, r.URL.Path), append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	pings := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+
+	var healthy sync.Map
+	healthy.Store("db", true)
+	dbProbe := func() error {
+		if ok, _ := healthy.Load("db"); !ok.(bool) {
+			return errors.New("db down")
+		}
+		return nil
+	}
+
+	hb, err := NewHeartbeat(srv.URL+"/ping",
+		WithHeartbeatInterval(time.Minute),
+		WithHeartbeatJitter(0),
+		WithHeartbeatProbes(WithProbe(Readiness, dbProbe)),
+		WithFailURL(srv.URL+"/ping/fail"))
+	require.NoError(t, err)
+
+	fake := goxtest.NewFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(clock.WithContext(context.Background(), fake))
+	done := make(chan error)
+	go func() { done <- hb.Run(ctx) }()
+
+	{ // pings at once and on each interval
+		require.Eventually(t, func() bool { return fake.Waiters() == 1 }, time.Second, time.Millisecond)
+		require.Equal(t, []string{"/ping"}, pings())
+
+		fake.Advance(time.Minute)
+		require.Eventually(t, func() bool { return len(pings()) == 2 && fake.Waiters() == 1 }, time.Second, time.Millisecond)
+	}
+
+	{ // failing probes ping the fail url with the error
+		healthy.Store("db", false)
+		fake.Advance(time.Minute)
+		require.Eventually(t, func() bool { return len(pings()) == 3 && fake.Waiters() == 1 }, time.Second, time.Millisecond)
+		require.Equal(t, "/ping/fail", pings()[2])
+		mu.Lock()
+		require.Equal(t, "db down", bodies[2])
+		mu.Unlock()
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	{ // invalid options are rejected
+		_, err := NewHeartbeat("")
+		require.Error(t, err)
+		_, err = NewHeartbeat(srv.URL, WithHeartbeatJitter(1))
+		require.Error(t, err)
+	}
+}
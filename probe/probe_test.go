@@ -1,6 +1,7 @@
 package probe
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -50,3 +51,11 @@ func TestNew(t *testing.T) {
 		require.Equal(t, http.StatusOK, aliveRes.StatusCode)
 	}
 }
+
+func TestCheck(t *testing.T) {
+	srv := httptest.NewServer(New(nil, WithProbe(Readiness, func() error { return errors.New("db down") })))
+	defer srv.Close()
+
+	require.NoError(t, Check(context.Background(), srv.URL+"/alive"))
+	require.Error(t, Check(context.Background(), srv.URL+"/ready"))
+}
@@ -0,0 +1,119 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"go.uber.org/zap"
+)
+
+// TenantFunc returns the tenant of r, an empty tenant skips the quota.
+type TenantFunc func(r *http.Request) (string, error)
+
+// Authorizer decides whether the request may use the admin endpoints, a returned error is written with
+// status 403 unless it carries its own code, see errs.CodeOf.
+type Authorizer func(r *http.Request) error
+
+// Middleware consumes one of resource for each request of a tenant. requests over a limit are
+// answered with rest.WriteErr, see ExceededError, with Retry-After for limits with a period.
+func (m *Manager) Middleware(resource string, tenant TenantFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, err := tenant(r)
+			if err != nil {
+				rest.WriteErr(w, err)
+				return
+			}
+			if t != "" {
+				if err := m.Consume(r.Context(), t, resource, 1); err != nil && m.writeErr(w, r, err) {
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeErr writes quota errors with their status and reports whether it did. failures of the store
+// are logged and let the request pass, quotas are not worth an outage.
+func (m *Manager) writeErr(w http.ResponseWriter, r *http.Request, err error) bool {
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) {
+		m.logger.Error("quota check failed", zap.Error(err))
+		return false
+	}
+	if exceeded.Limit.Period != PeriodNone {
+		wait := exceeded.ResetsAt.Sub(clock.FromContext(r.Context()).Now())
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	rest.WriteErr(w, exceeded)
+	return true
+}
+
+// Handler returns the admin endpoints of quotas, mount it on an internal router:
+//
+//	GET /tenants/{tenant}                        usage and limits of the tenant
+//	PUT /tenants/{tenant}/limits/{resource}      sets a limit, {"max": 100, "period": "day"}
+//	PUT /tenants/{tenant}/usage/{resource}       sets the usage of the current window, {"used": 0}
+func (m *Manager) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Use(m.authorized)
+	router.Get("/tenants/{tenant}", func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := m.Status(r.Context(), chi.URLParam(r, "tenant"))
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		rest.WriteJSON(w, http.StatusOK, statuses)
+	})
+	router.Put("/tenants/{tenant}/limits/{resource}", func(w http.ResponseWriter, r *http.Request) {
+		var l Limit
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			rest.WriteErr(w, errs.Invalid("invalid limit: %s", err))
+			return
+		}
+		l.Resource = chi.URLParam(r, "resource")
+		if err := m.SetLimit(r.Context(), chi.URLParam(r, "tenant"), l); err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		rest.WriteJSON(w, http.StatusOK, l)
+	})
+	router.Put("/tenants/{tenant}/usage/{resource}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Used int64 `json:"used"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			rest.WriteErr(w, errs.Invalid("invalid usage: %s", err))
+			return
+		}
+		if err := m.SetUsage(r.Context(), chi.URLParam(r, "tenant"), chi.URLParam(r, "resource"), body.Used); err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return router
+}
+
+func (m *Manager) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.authorize != nil {
+			if err := m.authorize(r); err != nil {
+				if errs.CodeOf(err) == errs.CodeUnknown {
+					err = errs.WithCode(err, errs.CodePermissionDenied)
+				}
+				rest.WriteErr(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,274 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"go.uber.org/zap"
+)
+
+// well known resources, any name can be used
+const (
+	Requests     = "requests"
+	StorageBytes = "storage_bytes"
+	Seats        = "seats"
+)
+
+// Period is the window usage of a limit is counted in, usage starts at zero with each window.
+type Period string
+
+const (
+	// PeriodNone counts usage forever, like of storage or seats, which is released again
+	PeriodNone  Period = ""
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+// Limit caps the usage of Resource to Max per Period, windows are in UTC.
+type Limit struct {
+	Resource string `json:"resource"`
+	Max      int64  `json:"max"`
+	Period   Period `json:"period,omitempty"`
+}
+
+func (l Limit) validate() error {
+	switch {
+	case l.Resource == "":
+		return errors.New("quota: limit needs a resource")
+	case l.Max < 0:
+		return fmt.Errorf("quota: limit of %s must not be negative", l.Resource)
+	case l.Period != PeriodNone && l.Period != PeriodDay && l.Period != PeriodMonth:
+		return fmt.Errorf("quota: invalid period %q", l.Period)
+	}
+	return nil
+}
+
+// window returns the key of the window of now and when it ends, zero for limits without a period.
+func (l Limit) window(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	switch l.Period {
+	case PeriodDay:
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+	case PeriodMonth:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01"), start.AddDate(0, 1, 0)
+	}
+	return "", time.Time{}
+}
+
+// windowEnd returns when the window of a key returned by window ends, false for limits without a period.
+func windowEnd(window string) (time.Time, bool) {
+	if start, err := time.Parse("2006-01-02", window); err == nil {
+		return start.AddDate(0, 0, 1), true
+	}
+	if start, err := time.Parse("2006-01", window); err == nil {
+		return start.AddDate(0, 1, 0), true
+	}
+	return time.Time{}, false
+}
+
+// ExceededError is returned when usage would exceed a limit. limits with a period have the code
+// errs.CodeResourceExhausted, answered with 429 and a Retry-After header, the others
+// errs.CodeFailedPrecondition since retrying never helps, only a larger plan does.
+type ExceededError struct {
+	Tenant   string
+	Limit    Limit
+	Used     int64
+	ResetsAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	if e.Limit.Period == PeriodNone {
+		return fmt.Sprintf("quota of %d %s exceeded", e.Limit.Max, e.Limit.Resource)
+	}
+	return fmt.Sprintf("quota of %d %s per %s exceeded", e.Limit.Max, e.Limit.Resource, e.Limit.Period)
+}
+
+func (e *ExceededError) ErrorCode() errs.Code {
+	if e.Limit.Period == PeriodNone {
+		return errs.CodeFailedPrecondition
+	}
+	return errs.CodeResourceExhausted
+}
+
+// Status is the usage of a limit in its current window.
+type Status struct {
+	Limit
+	Used     int64      `json:"used"`
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+type Option func(*Manager) error
+
+// WithDefaultLimits sets the limits of tenants without own limits for a resource. resources without
+// any limit are not counted.
+func WithDefaultLimits(limits ...Limit) Option {
+	return func(m *Manager) error {
+		for _, l := range limits {
+			if err := l.validate(); err != nil {
+				return err
+			}
+			m.defaults[l.Resource] = l
+		}
+		return nil
+	}
+}
+
+// WithAuthorizer is called for every request of the admin Handler before it is handled.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(m *Manager) error {
+		m.authorize = authorize
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(m *Manager) error {
+		m.logger = logger
+		return nil
+	}
+}
+
+// Manager enforces the quotas of tenants.
+type Manager struct {
+	store     Store
+	defaults  map[string]Limit
+	authorize Authorizer
+	logger    *zap.Logger
+}
+
+// NewManager returns a manager of the quotas kept in store.
+// example:
+//
+//	quotas, err := quota.NewManager(pgStore, quota.WithDefaultLimits(
+//		quota.Limit{Resource: quota.Requests, Max: 10000, Period: quota.PeriodDay},
+//		quota.Limit{Resource: quota.Seats, Max: 5},
+//	))
+//	router.Use(quotas.Middleware(quota.Requests, tenantOf))
+//	...
+//	if err := quotas.Consume(ctx, tenant, quota.StorageBytes, upload.Size); err != nil {
+//		rest.WriteErr(w, err)
+//		return
+//	}
+func NewManager(store Store, options ...Option) (*Manager, error) {
+	m := &Manager{store: store, defaults: map[string]Limit{}, logger: zap.NewNop()}
+	for _, o := range options {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Limit returns the limit of resource for tenant, false if there is none.
+func (m *Manager) Limit(ctx context.Context, tenant, resource string) (Limit, bool, error) {
+	limits, err := m.store.Limits(ctx, tenant)
+	if err != nil {
+		return Limit{}, false, err
+	}
+	for _, l := range limits {
+		if l.Resource == resource {
+			return l, true, nil
+		}
+	}
+	l, ok := m.defaults[resource]
+	return l, ok, nil
+}
+
+// SetLimit sets the limit of tenant for the resource of l.
+func (m *Manager) SetLimit(ctx context.Context, tenant string, l Limit) error {
+	if err := l.validate(); err != nil {
+		return errs.Invalid("%s", err)
+	}
+	return m.store.SetLimit(ctx, tenant, l)
+}
+
+// Consume counts n of resource for tenant, or returns an *ExceededError when it would exceed the limit.
+func (m *Manager) Consume(ctx context.Context, tenant, resource string, n int64) error {
+	if n < 0 {
+		return errs.Invalid("can not consume %d %s", n, resource)
+	}
+	l, ok, err := m.Limit(ctx, tenant, resource)
+	if err != nil || !ok {
+		return err
+	}
+	window, resetsAt := l.window(clock.FromContext(ctx).Now())
+	used, added, err := m.store.Add(ctx, tenant, resource, window, n, l.Max)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return &ExceededError{Tenant: tenant, Limit: l, Used: used, ResetsAt: resetsAt}
+	}
+	return nil
+}
+
+// Release gives back n of resource, like when files are deleted or seats are freed. usage does not go
+// below zero, so releasing what was counted before a limit was set is harmless.
+func (m *Manager) Release(ctx context.Context, tenant, resource string, n int64) error {
+	if n < 0 {
+		return errs.Invalid("can not release %d %s", n, resource)
+	}
+	l, ok, err := m.Limit(ctx, tenant, resource)
+	if err != nil || !ok {
+		return err
+	}
+	window, _ := l.window(clock.FromContext(ctx).Now())
+	_, _, err = m.store.Add(ctx, tenant, resource, window, -n, math.MaxInt64)
+	return err
+}
+
+// Status returns the usage of each limit of tenant, sorted by resource.
+func (m *Manager) Status(ctx context.Context, tenant string) ([]Status, error) {
+	limits := make(map[string]Limit, len(m.defaults))
+	for r, l := range m.defaults {
+		limits[r] = l
+	}
+	own, err := m.store.Limits(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range own {
+		limits[l.Resource] = l
+	}
+
+	now := clock.FromContext(ctx).Now()
+	statuses := make([]Status, 0, len(limits))
+	for _, l := range limits {
+		window, resetsAt := l.window(now)
+		used, err := m.store.Usage(ctx, tenant, l.Resource, window)
+		if err != nil {
+			return nil, err
+		}
+		s := Status{Limit: l, Used: used}
+		if !resetsAt.IsZero() {
+			s.ResetsAt = &resetsAt
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Resource < statuses[j].Resource })
+	return statuses, nil
+}
+
+// SetUsage overrides the usage of resource for tenant in the current window, like to reset it.
+func (m *Manager) SetUsage(ctx context.Context, tenant, resource string, used int64) error {
+	if used < 0 {
+		return errs.Invalid("usage of %s must not be negative", resource)
+	}
+	l, ok, err := m.Limit(ctx, tenant, resource)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errs.NotFound("%s has no limit", resource)
+	}
+	window, _ := l.window(clock.FromContext(ctx).Now())
+	return m.store.SetUsage(ctx, tenant, resource, window, used)
+}
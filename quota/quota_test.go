@@ -0,0 +1,166 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	testManager(t, NewMemoryStore())
+}
+
+func TestPgStore(t *testing.T) {
+	s, err := NewPgStore(context.Background(), goxtest.NewTestDB(t))
+	require.NoError(t, err)
+	testManager(t, s)
+}
+
+func TestRedisStore(t *testing.T) {
+	do, prefix := goxtest.NewTestRedis(t)
+	s := NewRedisStore(RedisDo(do), WithRedisPrefix(prefix))
+	testManager(t, s)
+
+	ttl, err := do(context.Background(), "PTTL", s.usageKey("acme", Requests, "2024-04-01"))
+	require.NoError(t, err)
+	require.Greater(t, ttl, int64(0))
+	ttl, err = do(context.Background(), "PTTL", s.usageKey("acme", Seats, ""))
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), ttl)
+}
+
+func testManager(t *testing.T, s Store) {
+	now := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	fake := goxtest.NewFakeClock(now)
+	ctx := clock.WithContext(context.Background(), fake)
+
+	m, err := NewManager(s, WithDefaultLimits(
+		Limit{Resource: Requests, Max: 2, Period: PeriodDay},
+		Limit{Resource: StorageBytes, Max: 100},
+	))
+	require.NoError(t, err)
+
+	{ // daily limits start over with each day
+		require.NoError(t, m.Consume(ctx, "acme", Requests, 1))
+		require.NoError(t, m.Consume(ctx, "acme", Requests, 1))
+		err := m.Consume(ctx, "acme", Requests, 1)
+		var exceeded *ExceededError
+		require.True(t, errors.As(err, &exceeded))
+		require.Equal(t, &ExceededError{Tenant: "acme", Limit: Limit{Resource: Requests, Max: 2, Period: PeriodDay}, Used: 2, ResetsAt: now.Add(time.Hour)}, exceeded)
+		require.Equal(t, errs.CodeResourceExhausted, errs.CodeOf(err))
+
+		require.NoError(t, m.Consume(ctx, "other", Requests, 1))
+		fake.Advance(time.Hour)
+		require.NoError(t, m.Consume(ctx, "acme", Requests, 1))
+	}
+
+	{ // released usage can be consumed again
+		require.NoError(t, m.Consume(ctx, "acme", StorageBytes, 80))
+		require.Error(t, m.Consume(ctx, "acme", StorageBytes, 30))
+		require.NoError(t, m.Release(ctx, "acme", StorageBytes, 50))
+		require.NoError(t, m.Consume(ctx, "acme", StorageBytes, 30))
+	}
+
+	{ // usage does not go below zero and negative amounts are invalid
+		require.NoError(t, m.Release(ctx, "other", StorageBytes, 50))
+		require.NoError(t, m.Consume(ctx, "other", StorageBytes, 100))
+		require.Error(t, m.Consume(ctx, "other", StorageBytes, 1))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(m.Release(ctx, "acme", StorageBytes, -1)))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(m.Consume(ctx, "acme", StorageBytes, -1)))
+	}
+
+	{ // tenant limits override the defaults, resources without limits are not counted
+		require.NoError(t, m.SetLimit(ctx, "acme", Limit{Resource: Seats, Max: 1}))
+		require.NoError(t, m.Consume(ctx, "acme", Seats, 1))
+		require.Error(t, m.Consume(ctx, "acme", Seats, 1))
+		require.NoError(t, m.Consume(ctx, "other", Seats, 10))
+		require.Error(t, m.SetLimit(ctx, "acme", Limit{Resource: Seats, Max: 1, Period: "week"}))
+	}
+
+	statuses, err := m.Status(ctx, "acme")
+	require.NoError(t, err)
+	resets := time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, []Status{
+		{Limit: Limit{Resource: Requests, Max: 2, Period: PeriodDay}, Used: 1, ResetsAt: &resets},
+		{Limit: Limit{Resource: Seats, Max: 1}, Used: 1},
+		{Limit: Limit{Resource: StorageBytes, Max: 100}, Used: 60},
+	}, statuses)
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 59, 30, 0, time.UTC)
+	ctx := clock.WithContext(context.Background(), goxtest.NewFakeClock(now))
+	m, err := NewManager(NewMemoryStore(), WithDefaultLimits(Limit{Resource: Requests, Max: 1, Period: PeriodDay}, Limit{Resource: "exports", Max: 0}))
+	require.NoError(t, err)
+
+	handler := func(resource string) http.Handler {
+		return m.Middleware(resource, func(r *http.Request) (string, error) {
+			return r.Header.Get("X-Tenant"), nil
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+	serve := func(h http.Handler, tenant string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		r.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusNoContent, serve(handler(Requests), "acme").Code)
+	w := serve(handler(Requests), "acme")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusNoContent, serve(handler(Requests), "").Code)
+
+	w = serve(handler("exports"), "acme")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Empty(t, w.Header().Get("Retry-After"))
+	require.JSONEq(t, `{"code":"ErrFailedPrecondition","message":"quota of 0 exports exceeded"}`, w.Body.String())
+}
+
+func TestHandler(t *testing.T) {
+	m, err := NewManager(NewMemoryStore(), WithDefaultLimits(Limit{Resource: Seats, Max: 5}), WithAuthorizer(func(r *http.Request) error {
+		if r.Header.Get("X-Admin") == "" {
+			return errors.New("admins only")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, m.Consume(context.Background(), "acme", Seats, 3))
+	h := m.Handler()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("X-Admin", "1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodPut, "/tenants/acme/limits/seats", `{"max": 10}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, http.StatusNoContent, serve(http.MethodPut, "/tenants/acme/usage/seats", `{"used": 1}`).Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/tenants/acme/usage/unknown", `{"used": 1}`).Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/tenants/acme/limits/seats", `{"max": -1}`).Code)
+
+	w = serve(http.MethodGet, "/tenants/acme", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `[{"resource":"seats","max":10,"used":1}]`, w.Body.String())
+
+	{ // unauthorized requests
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tenants/acme", nil))
+		require.Equal(t, http.StatusForbidden, w.Code)
+	}
+}
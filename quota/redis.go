@@ -0,0 +1,161 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultRedisPrefix is the prefix of the keys of RedisStore.
+const DefaultRedisPrefix = "gox:quota:"
+
+// redisWindowGrace keeps counters of past windows around for a while, like for reporting.
+const redisWindowGrace = 24 * time.Hour
+
+const (
+	// redisAdd adds ARGV[1] unless it would exceed ARGV[2], never going below zero, and expires the
+	// counter at ARGV[3] if it is not 0
+	redisAdd = `local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+local after = used + tonumber(ARGV[1])
+if after > tonumber(ARGV[2]) then return {used, 0} end
+if after < 0 then after = 0 end
+redis.call('SET', KEYS[1], string.format('%d', after))
+if ARGV[3] ~= '0' then redis.call('PEXPIREAT', KEYS[1], ARGV[3]) end
+return {after, 1}`
+	redisUsage    = `return tonumber(redis.call('GET', KEYS[1]) or '0')`
+	redisSetUsage = `redis.call('SET', KEYS[1], ARGV[1])
+if ARGV[2] ~= '0' then redis.call('PEXPIREAT', KEYS[1], ARGV[2]) end
+return 1`
+	redisLimits = `return redis.call('HGETALL', KEYS[1])`
+)
+
+// RedisDo sends a command to redis and returns its reply, see NewRedisStore.
+type RedisDo func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+type RedisOption func(*RedisStore)
+
+// WithRedisPrefix sets the prefix of keys, DefaultRedisPrefix by default.
+func WithRedisPrefix(prefix string) RedisOption {
+	return func(s *RedisStore) {
+		s.prefix = prefix
+	}
+}
+
+// RedisStore keeps limits and usage in redis, counters are checked and updated by a script so
+// replicas never exceed a limit together. counters of windows expire a day after the window ends.
+type RedisStore struct {
+	do     RedisDo
+	prefix string
+}
+
+// NewRedisStore returns a store sending its commands with do, which adapts any redis client. replies
+// are expected as returned by go-redis, integers as int64 and arrays as []interface{}, the commands
+// used never reply nil.
+// example:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	s := quota.NewRedisStore(func(ctx context.Context, args ...interface{}) (interface{}, error) {
+//		return rdb.Do(ctx, args...).Result()
+//	})
+func NewRedisStore(do RedisDo, options ...RedisOption) *RedisStore {
+	s := &RedisStore{do: do, prefix: DefaultRedisPrefix}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+func (s *RedisStore) limitsKey(tenant string) string {
+	return s.prefix + "limits:" + tenant
+}
+
+func (s *RedisStore) usageKey(tenant, resource, window string) string {
+	return s.prefix + "usage:" + tenant + ":" + resource + ":" + window
+}
+
+// expiresAt returns the unix milliseconds the counter of window expires at, 0 if it never does.
+func expiresAt(window string) int64 {
+	end, ok := windowEnd(window)
+	if !ok {
+		return 0
+	}
+	return end.Add(redisWindowGrace).UnixMilli()
+}
+
+func (s *RedisStore) Limits(ctx context.Context, tenant string) ([]Limit, error) {
+	reply, err := s.do(ctx, "EVAL", redisLimits, 1, s.limitsKey(tenant))
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("quota: unexpected redis reply %T", reply)
+	}
+
+	var limits []Limit
+	for i := 1; i < len(fields); i += 2 {
+		value, ok := fields[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("quota: unexpected redis reply %T", fields[i])
+		}
+		var l Limit
+		if err := json.Unmarshal([]byte(value), &l); err != nil {
+			return nil, fmt.Errorf("quota: invalid limit of %s: %w", tenant, err)
+		}
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+func (s *RedisStore) SetLimit(ctx context.Context, tenant string, l Limit) error {
+	value, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(ctx, "HSET", s.limitsKey(tenant), l.Resource, string(value))
+	return err
+}
+
+func (s *RedisStore) Add(ctx context.Context, tenant, resource, window string, n, max int64) (int64, bool, error) {
+	reply, err := s.do(ctx, "EVAL", redisAdd, 1, s.usageKey(tenant, resource, window),
+		strconv.FormatInt(n, 10), strconv.FormatInt(max, 10), strconv.FormatInt(expiresAt(window), 10))
+	if err != nil {
+		return 0, false, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, false, fmt.Errorf("quota: unexpected redis reply %v", reply)
+	}
+	used, err := redisInt(values[0])
+	if err != nil {
+		return 0, false, err
+	}
+	added, err := redisInt(values[1])
+	return used, added == 1, err
+}
+
+func (s *RedisStore) Usage(ctx context.Context, tenant, resource, window string) (int64, error) {
+	reply, err := s.do(ctx, "EVAL", redisUsage, 1, s.usageKey(tenant, resource, window))
+	if err != nil {
+		return 0, err
+	}
+	return redisInt(reply)
+}
+
+func (s *RedisStore) SetUsage(ctx context.Context, tenant, resource, window string, used int64) error {
+	_, err := s.do(ctx, "EVAL", redisSetUsage, 1, s.usageKey(tenant, resource, window),
+		strconv.FormatInt(used, 10), strconv.FormatInt(expiresAt(window), 10))
+	return err
+}
+
+func redisInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("quota: unexpected redis reply %T", v)
+}
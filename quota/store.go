@@ -0,0 +1,189 @@
+package quota
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/store"
+)
+
+const (
+	limitsTable = "gox_quota_limits"
+	usageTable  = "gox_quota_usage"
+)
+
+// Store keeps the limits of tenants and their usage counters, by resource and window. windows are
+// like "2024-03-01" for daily limits and empty for limits without a period. MemoryStore keeps them in
+// memory, PgStore in postgres and RedisStore in redis.
+type Store interface {
+	// Limits returns the limits set for tenant, which override the default ones
+	Limits(ctx context.Context, tenant string) ([]Limit, error)
+	SetLimit(ctx context.Context, tenant string, l Limit) error
+	// Add adds n, which may be negative, to the usage unless it would exceed max, it returns the usage
+	// after it and whether n was added. usage never goes below zero
+	Add(ctx context.Context, tenant, resource, window string, n, max int64) (int64, bool, error)
+	Usage(ctx context.Context, tenant, resource, window string) (int64, error)
+	// SetUsage overrides the usage, like to correct counters or to reset a window
+	SetUsage(ctx context.Context, tenant, resource, window string, used int64) error
+}
+
+type usageKey struct {
+	tenant, resource, window string
+}
+
+// MemoryStore is a Store for a single instance and tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	limits map[string]map[string]Limit
+	usage  map[usageKey]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{limits: map[string]map[string]Limit{}, usage: map[usageKey]int64{}}
+}
+
+func (s *MemoryStore) Limits(_ context.Context, tenant string) ([]Limit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var limits []Limit
+	for _, l := range s.limits[tenant] {
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+func (s *MemoryStore) SetLimit(_ context.Context, tenant string, l Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limits[tenant] == nil {
+		s.limits[tenant] = map[string]Limit{}
+	}
+	s.limits[tenant][l.Resource] = l
+	return nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, tenant, resource, window string, n, max int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := usageKey{tenant, resource, window}
+	used := s.usage[k]
+	if used+n > max {
+		return used, false, nil
+	}
+	if used+n < 0 {
+		n = -used
+	}
+	s.usage[k] = used + n
+	return used + n, true, nil
+}
+
+func (s *MemoryStore) Usage(_ context.Context, tenant, resource, window string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[usageKey{tenant, resource, window}], nil
+}
+
+func (s *MemoryStore) SetUsage(_ context.Context, tenant, resource, window string, used int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage[usageKey{tenant, resource, window}] = used
+	return nil
+}
+
+// PgStore keeps limits and usage in postgres, counters are updated atomically with a single statement.
+// rows of past windows stay for reporting, a retention policy on updated_at removes them.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the quotas of db, creating their tables if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+limitsTable+` (
+		tenant text NOT NULL,
+		resource text NOT NULL,
+		max bigint NOT NULL,
+		period text NOT NULL,
+		updated_at timestamptz NOT NULL,
+		PRIMARY KEY (tenant, resource)
+	);
+	CREATE TABLE IF NOT EXISTS `+usageTable+` (
+		tenant text NOT NULL,
+		resource text NOT NULL,
+		window_key text NOT NULL,
+		used bigint NOT NULL,
+		updated_at timestamptz NOT NULL,
+		PRIMARY KEY (tenant, resource, window_key)
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+func (s *PgStore) Limits(ctx context.Context, tenant string) ([]Limit, error) {
+	rows, err := s.db.Query(ctx, "SELECT resource, max, period FROM "+limitsTable+" WHERE tenant = $1 ORDER BY resource", tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []Limit
+	for rows.Next() {
+		var l Limit
+		if err := rows.Scan(&l.Resource, &l.Max, &l.Period); err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+	return limits, rows.Err()
+}
+
+func (s *PgStore) SetLimit(ctx context.Context, tenant string, l Limit) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO "+limitsTable+" (tenant, resource, max, period, updated_at) VALUES ($1, $2, $3, $4, $5) "+
+		"ON CONFLICT (tenant, resource) DO UPDATE SET max = excluded.max, period = excluded.period, updated_at = excluded.updated_at",
+		tenant, l.Resource, l.Max, l.Period, clock.FromContext(ctx).Now())
+	return err
+}
+
+func (s *PgStore) Add(ctx context.Context, tenant, resource, window string, n, max int64) (int64, bool, error) {
+	// no row is returned when the usage would exceed max
+	rows, err := s.db.Query(ctx, "INSERT INTO "+usageTable+" AS u (tenant, resource, window_key, used, updated_at) "+
+		"SELECT $1, $2, $3, greatest($4::bigint, 0), $6 WHERE $4::bigint <= $5::bigint "+
+		"ON CONFLICT (tenant, resource, window_key) DO UPDATE SET used = greatest(u.used + $4::bigint, 0), updated_at = excluded.updated_at "+
+		"WHERE u.used + $4::bigint <= $5::bigint RETURNING used",
+		tenant, resource, window, n, max, clock.FromContext(ctx).Now())
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	var used int64
+	added := rows.Next()
+	if added {
+		if err := rows.Scan(&used); err != nil {
+			return 0, false, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+	if !added {
+		used, err = s.Usage(ctx, tenant, resource, window)
+	}
+	return used, added, err
+}
+
+func (s *PgStore) Usage(ctx context.Context, tenant, resource, window string) (int64, error) {
+	var used int64
+	err := s.db.QueryRow(ctx, "SELECT coalesce(sum(used), 0) FROM "+usageTable+" WHERE tenant = $1 AND resource = $2 AND window_key = $3",
+		tenant, resource, window).Scan(&used)
+	return used, err
+}
+
+func (s *PgStore) SetUsage(ctx context.Context, tenant, resource, window string, used int64) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO "+usageTable+" (tenant, resource, window_key, used, updated_at) VALUES ($1, $2, $3, $4, $5) "+
+		"ON CONFLICT (tenant, resource, window_key) DO UPDATE SET used = excluded.used, updated_at = excluded.updated_at",
+		tenant, resource, window, used, clock.FromContext(ctx).Now())
+	return err
+}
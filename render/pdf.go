@@ -0,0 +1,101 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// WKHTMLToPDF converts html to pdf using the wkhtmltopdf binary.
+type WKHTMLToPDF struct {
+	// Path of wkhtmltopdf binary, looked up in PATH if empty
+	Path string
+	// Args are extra arguments passed before input and output, like "--page-size", "A4"
+	Args []string
+}
+
+func NewWKHTMLToPDF(args ...string) *WKHTMLToPDF {
+	return &WKHTMLToPDF{Path: "wkhtmltopdf", Args: args}
+}
+
+func (c *WKHTMLToPDF) Convert(ctx context.Context, w io.Writer, html io.Reader) error {
+	path := c.Path
+	if path == "" {
+		path = "wkhtmltopdf"
+	}
+
+	args := append(append([]string{"--quiet"}, c.Args...), "-", "-")
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = html
+	cmd.Stdout = w
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wkhtmltopdf failed: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// ChromePDF converts html to pdf using a headless chrome or chromium binary.
+type ChromePDF struct {
+	// Path of chrome binary, looked up in PATH if empty
+	Path string
+	// Args are extra arguments passed to chrome
+	Args []string
+}
+
+func NewChromePDF(args ...string) *ChromePDF {
+	return &ChromePDF{Path: "chromium", Args: args}
+}
+
+func (c *ChromePDF) Convert(ctx context.Context, w io.Writer, html io.Reader) error {
+	path := c.Path
+	if path == "" {
+		path = "chromium"
+	}
+
+	// chrome can only print files, so input and output go through a temp directory
+	dir, err := os.MkdirTemp("", "gox-render-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "report.html")
+	out := filepath.Join(dir, "report.pdf")
+
+	f, err := os.Create(in)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, html); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	args := append([]string{"--headless", "--disable-gpu", "--no-sandbox", "--no-pdf-header-footer", "--print-to-pdf=" + out}, c.Args...)
+	cmd := exec.CommandContext(ctx, path, append(args, "file://"+in)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("chrome print to pdf failed: %w: %s", err, stderr.String())
+	}
+
+	pdf, err := os.Open(out)
+	if err != nil {
+		return err
+	}
+	defer pdf.Close()
+
+	_, err = io.Copy(w, pdf)
+	return err
+}
@@ -0,0 +1,71 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// Converter turns a html document into another format, like pdf.
+type Converter interface {
+	Convert(ctx context.Context, w io.Writer, html io.Reader) error
+}
+
+// Reporter renders a named report with given data into w.
+type Reporter interface {
+	Report(ctx context.Context, w io.Writer, name string, data interface{}) error
+}
+
+type htmlReporter struct {
+	templates *template.Template
+	converter Converter
+}
+
+// NewReporter returns a Reporter which executes the named html template and passes the result to converter.
+// example:
+//
+//	tmpl := template.Must(template.ParseFS(templatesFS, "templates/*.html"))
+//	reporter := render.NewReporter(tmpl, render.NewWKHTMLToPDF())
+//	err := reporter.Report(ctx, w, "invoice.html", invoice)
+func NewReporter(templates *template.Template, converter Converter) Reporter {
+	return &htmlReporter{templates: templates, converter: converter}
+}
+
+func (r *htmlReporter) Report(ctx context.Context, w io.Writer, name string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := r.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("render template %s failed: %w", name, err)
+	}
+	return r.converter.Convert(ctx, w, &buf)
+}
+
+// Job describes a report to be generated. it is plain json so it can be sent through any queue and
+// rendered later by a worker using Run.
+type Job struct {
+	Template string          `json:"template"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// NewJob creates a job for the named template, data must be json serializable.
+func NewJob(template string, data interface{}) (Job, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Job{}, err
+	}
+	return Job{Template: template, Data: b}, nil
+}
+
+// Run renders the job using reporter. job data is decoded as generic json values, so templates
+// must refer to fields by their json names.
+func (j Job) Run(ctx context.Context, reporter Reporter, w io.Writer) error {
+	var data interface{}
+	if len(j.Data) > 0 {
+		if err := json.Unmarshal(j.Data, &data); err != nil {
+			return fmt.Errorf("decode job data failed: %w", err)
+		}
+	}
+	return reporter.Report(ctx, w, j.Template, data)
+}
@@ -0,0 +1,39 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type copyConverter struct{}
+
+func (copyConverter) Convert(_ context.Context, w io.Writer, html io.Reader) error {
+	_, err := io.Copy(w, html)
+	return err
+}
+
+func TestReporter(t *testing.T) {
+	tmpl := template.Must(template.New("invoice").Parse(`<h1>{{.number}}</h1><p>{{.customer}}</p>`))
+	reporter := NewReporter(tmpl, copyConverter{})
+
+	job, err := NewJob("invoice", map[string]interface{}{"number": 42, "customer": "<foo>"})
+	require.NoError(t, err)
+
+	// job should survive a round trip through a queue
+	b, err := json.Marshal(job)
+	require.NoError(t, err)
+	var queued Job
+	require.NoError(t, json.Unmarshal(b, &queued))
+
+	var out bytes.Buffer
+	require.NoError(t, queued.Run(context.Background(), reporter, &out))
+	require.Equal(t, "<h1>42</h1><p>&lt;foo&gt;</p>", out.String())
+
+	require.Error(t, reporter.Report(context.Background(), &out, "missing", nil))
+}
@@ -0,0 +1,166 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mirzakhany/gox/group"
+	"github.com/mirzakhany/gox/misc"
+)
+
+// CoalesceKey is the default key of Coalesce: the request uri, the Accept and Origin headers and the
+// principal making the request, which is the subject of the JWTAuth claims or the user of the
+// RequestMeta when known and a hash of the Authorization and Cookie headers otherwise, so users never
+// share responses and cors headers are never given to another origin.
+func CoalesceKey(r *http.Request) string {
+	principal := ""
+	if claims, ok := ClaimsFromContext(r.Context()); ok && claims.Subject() != "" {
+		principal = "sub:" + claims.Subject()
+	} else if meta, ok := RequestMetaFrom(r.Context()); ok && meta.UserID != "" {
+		principal = "user:" + meta.UserID
+	} else if auth, cookie := r.Header.Get("Authorization"), r.Header.Get("Cookie"); auth != "" || cookie != "" {
+		sum := sha256.Sum256([]byte(auth + "\n" + cookie))
+		principal = "credentials:" + hex.EncodeToString(sum[:])
+	}
+	return strings.Join([]string{r.Method, r.URL.RequestURI(), r.Header.Get("Accept"), r.Header.Get("Origin"), principal}, "\n")
+}
+
+// coalescePerRequestHeaders are response headers which belong to the request which ran the handler,
+// they are not copied to the requests sharing its response.
+var coalescePerRequestHeaders = map[string]bool{
+	"Set-Cookie":               true,
+	middleware.RequestIDHeader: true,
+	"Traceparent":              true,
+	"Tracestate":               true,
+	"Server-Timing":            true,
+}
+
+// errCoalesceCanceled is the result of a shared execution whose request was canceled.
+var errCoalesceCanceled = errors.New("coalesced request canceled")
+
+type coalescedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Coalesce lets concurrent GET requests with the same key share one execution of the handler, so a
+// burst of identical requests to an expensive endpoint runs it once. the first request runs the
+// handler, the ones arriving while it runs get a copy of its response, without its cookies and
+// per-request headers like the request id and without replacing the headers they already have. when the first request panics or is canceled the others
+// run the handler themselves. key is CoalesceKey when nil. responses are kept in memory until they
+// are copied, so it is meant for endpoints with bounded responses.
+// example:
+//
+//	router.With(rest.Coalesce(nil)).Get("/reports/{id}", reportHandler)
+func Coalesce(key func(r *http.Request) string) func(http.Handler) http.Handler {
+	if key == nil {
+		key = CoalesceKey
+	}
+	var calls misc.Coalescer[string, *coalescedResponse]
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the handler of the first request writes its response while it is recorded, that request
+			// waits for the handler even when it is canceled so w is not used after it returned
+			finished := make(chan struct{})
+			res, err, shared := calls.Do(r.Context(), key(r), func(context.Context) (*coalescedResponse, error) {
+				defer close(finished)
+				rec := &coalesceRecorder{wrappedWriter: wrappedWriter{w}}
+				next.ServeHTTP(rec, r)
+				if r.Context().Err() != nil {
+					return nil, errCoalesceCanceled
+				}
+				rec.snapshot()
+				return &coalescedResponse{status: rec.status, header: rec.header, body: rec.body.Bytes()}, nil
+			})
+			if !shared {
+				<-finished
+				var perr *group.PanicError
+				if errors.As(err, &perr) {
+					panic(perr.Value)
+				}
+				return
+			}
+			if r.Context().Err() != nil {
+				return
+			}
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// headers the middlewares before Coalesce already set for this request, like cors
+			// headers, are kept, Vary gets the values of both
+			h := w.Header()
+			for name, values := range res.header {
+				switch {
+				case coalescePerRequestHeaders[name]:
+				case name == "Vary":
+					for _, v := range values {
+						if !headerHasValue(h, name, v) {
+							h.Add(name, v)
+						}
+					}
+				case len(h[name]) == 0:
+					h[name] = append([]string(nil), values...)
+				}
+			}
+			w.WriteHeader(res.status)
+			_, _ = w.Write(res.body)
+		})
+	}
+}
+
+// headerHasValue reports whether the comma separated values of header name in h hold v.
+func headerHasValue(h http.Header, name, v string) bool {
+	for _, line := range h.Values(name) {
+		for _, value := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// coalesceRecorder writes the response through while copying it for the waiting requests.
+type coalesceRecorder struct {
+	wrappedWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+// snapshot keeps the status and header once they are written.
+func (w *coalesceRecorder) snapshot() {
+	if w.header == nil {
+		w.status = http.StatusOK
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+}
+
+func (w *coalesceRecorder) WriteHeader(code int) {
+	if w.header == nil {
+		w.status = code
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *coalesceRecorder) Write(b []byte) (int, error) {
+	w.snapshot()
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
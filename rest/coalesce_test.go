@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	handler := Coalesce(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("X-Report", "1")
+		w.Header().Set("Set-Cookie", "session=leader")
+		w.Header().Set("X-Request-Id", "leader")
+		WriteJSON(w, http.StatusOK, r.URL.Path)
+	}))
+	do := func(path, authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	{ // identical requests share one execution
+		var wg sync.WaitGroup
+		results := make([]*httptest.ResponseRecorder, 5)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = do("/reports/1", "Bearer a")
+			}(i)
+		}
+		time.Sleep(20 * time.Millisecond)
+		release <- struct{}{}
+		wg.Wait()
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		cookies := 0
+		for _, w := range results {
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, "1", w.Header().Get("X-Report"))
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			require.JSONEq(t, `"/reports/1"`, w.Body.String())
+			if w.Header().Get("Set-Cookie") != "" {
+				cookies++
+				require.Equal(t, "leader", w.Header().Get("X-Request-Id"))
+			}
+		}
+		// cookies and per-request headers stay with the request which ran the handler
+		require.Equal(t, 1, cookies)
+
+		// the headers of the responses do not share their values
+		results[0].Header()["X-Report"][0] = "changed"
+		require.Equal(t, "1", results[1].Header().Get("X-Report"))
+	}
+
+	{ // other paths and principals are not shared
+		atomic.StoreInt32(&calls, 0)
+		var wg sync.WaitGroup
+		for _, req := range [][2]string{{"/reports/1", "Bearer a"}, {"/reports/2", "Bearer a"}, {"/reports/1", "Bearer b"}} {
+			wg.Add(1)
+			go func(path, authorization string) {
+				defer wg.Done()
+				do(path, authorization)
+			}(req[0], req[1])
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	}
+
+	{ // headers set before Coalesce are kept and other origins are not shared
+		var calls, served int32
+		release := make(chan struct{})
+		inner := Coalesce(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			w.Header().Add("Vary", "Accept")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			w.Header().Set("X-Served-By", strconv.Itoa(int(atomic.AddInt32(&served, 1))))
+			w.Header().Add("Vary", "Origin")
+			inner.ServeHTTP(w, r)
+		})
+
+		var wg sync.WaitGroup
+		origins := []string{"https://a.example.com", "https://a.example.com", "https://a.example.com", "https://b.example.com"}
+		results := make([]*httptest.ResponseRecorder, len(origins))
+		for i := range origins {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodGet, "/cors", nil)
+				r.Header.Set("Origin", origins[i])
+				results[i] = httptest.NewRecorder()
+				handler.ServeHTTP(results[i], r)
+			}(i)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		servedBy := map[string]bool{}
+		for i, w := range results {
+			require.Equal(t, http.StatusNoContent, w.Code)
+			require.Equal(t, origins[i], w.Header().Get("Access-Control-Allow-Origin"))
+			require.Equal(t, []string{"Origin", "Accept"}, w.Header().Values("Vary"))
+			servedBy[w.Header().Get("X-Served-By")] = true
+		}
+		require.Len(t, servedBy, len(origins))
+	}
+
+	{ // waiting requests run the handler when the first one is canceled
+		var calls int32
+		handler := Coalesce(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-r.Context().Done()
+				WriteError(w, http.StatusServiceUnavailable, "canceled")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+		time.Sleep(10 * time.Millisecond)
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+			done <- w
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		require.Equal(t, http.StatusNoContent, (<-done).Code)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	}
+
+	{ // the first request panics, the waiting ones run the handler
+		var calls int32
+		release := make(chan struct{})
+		handler := Coalesce(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-release
+				panic("boom")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		panicked := make(chan interface{})
+		go func() {
+			defer func() { panicked <- recover() }()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+			done <- w
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		require.Equal(t, "boom", <-panicked)
+		require.Equal(t, http.StatusNoContent, (<-done).Code)
+	}
+}
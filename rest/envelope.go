@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mirzakhany/gox/clock"
+)
+
+// Envelope wraps json responses when the Envelope middleware is used, successful responses carry
+// Data and errors carry Error.
+type Envelope struct {
+	Data  interface{}  `json:"data,omitempty"`
+	Error *Message     `json:"error,omitempty"`
+	Meta  EnvelopeMeta `json:"meta"`
+}
+
+type EnvelopeMeta struct {
+	RequestID string `json:"request_id,omitempty"`
+	// DurationMS is the time from the request reaching the Envelope middleware to the response being written
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// EnvelopeResponses wraps the responses written with WriteJSON, WriteError and WriteErr in an Envelope holding
+// the request id and the handling time, see WithEnvelope to use it for a whole service. responses
+// written otherwise, like files and streams, are not changed.
+func EnvelopeResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clk := clock.FromContext(r.Context())
+		next.ServeHTTP(&envelopeWriter{wrappedWriter: wrappedWriter{w}, r: r, clk: clk, start: clk.Now()}, r)
+	})
+}
+
+type envelopeWriter struct {
+	wrappedWriter
+	r     *http.Request
+	clk   clock.Clock
+	start time.Time
+}
+
+func (w *envelopeWriter) wrap(code int, v interface{}) *Envelope {
+	e := &Envelope{Meta: EnvelopeMeta{
+		RequestID:  middleware.GetReqID(w.r.Context()),
+		DurationMS: w.clk.Since(w.start).Milliseconds(),
+	}}
+	if msg, ok := v.(Message); ok && code >= http.StatusBadRequest {
+		e.Error = &msg
+	} else {
+		e.Data = v
+	}
+	return e
+}
@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeResponses(t *testing.T) {
+	handler := middleware.RequestID(EnvelopeResponses(FieldMasking(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			WriteErr(w, errs.NotFound("user not found"))
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"id": 1, "name": "alice"})
+	}))))
+
+	{ // data
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/users/1?fields=name", nil)
+		r.Header.Set(middleware.RequestIDHeader, "req-1")
+		handler.ServeHTTP(w, r)
+		require.JSONEq(t, `{"data":{"name":"alice"},"meta":{"request_id":"req-1","duration_ms":0}}`, w.Body.String())
+	}
+
+	{ // errors, which other services read back with ErrorFromResponse
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		r.Header.Set(middleware.RequestIDHeader, "req-2")
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.JSONEq(t, `{"error":{"code":"ErrNotFound","message":"user not found"},"meta":{"request_id":"req-2","duration_ms":0}}`, w.Body.String())
+
+		err := ErrorFromResponse(w.Result())
+		require.Equal(t, errs.CodeNotFound, errs.CodeOf(err))
+		require.Equal(t, "user not found", err.Error())
+	}
+
+	{ // responses are unchanged without the middleware
+		w := httptest.NewRecorder()
+		WriteJSON(w, http.StatusOK, map[string]int{"id": 1})
+		require.JSONEq(t, `{"id":1}`, w.Body.String())
+	}
+}
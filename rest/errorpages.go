@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"bytes"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// ErrorPage is the data error page templates of HTMLErrors are executed with.
+type ErrorPage struct {
+	Status     int
+	StatusText string
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+// HTMLErrors renders the errors written with WriteError and WriteErr as html pages for requests
+// preferring html by their Accept header, like page loads of browsers, while other clients keep
+// getting the json Message. the page is the template named by the status, like "404.html", or
+// "error.html" when there is none. errors without a template stay json. responses vary by Accept so
+// caches keep both forms apart. WithHTMLErrors adds it for RunHttpServer.
+// example:
+//
+//	//go:embed errors/*.html
+//	var errorPages embed.FS
+//
+//	router.Use(rest.HTMLErrors(template.Must(template.ParseFS(errorPages, "errors/*.html"))))
+func HTMLErrors(templates *template.Template) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept")
+			if prefersHTML(r.Header.Get("Accept")) {
+				w = &htmlErrorWriter{wrappedWriter: wrappedWriter{w}, r: r, templates: templates}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type htmlErrorWriter struct {
+	wrappedWriter
+	r         *http.Request
+	templates *template.Template
+}
+
+// render writes the error page of msg to dst, reporting false when there is no page for code.
+func (w *htmlErrorWriter) render(dst http.ResponseWriter, code int, msg Message) bool {
+	t := w.templates.Lookup(strconv.Itoa(code) + ".html")
+	if t == nil {
+		t = w.templates.Lookup("error.html")
+	}
+	if t == nil {
+		return false
+	}
+
+	var buf bytes.Buffer
+	err := t.Execute(&buf, ErrorPage{
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Code:       msg.Code,
+		Message:    msg.Message,
+		RequestID:  middleware.GetReqID(w.r.Context()),
+	})
+	if err != nil {
+		return false
+	}
+
+	dst.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dst.WriteHeader(code)
+	_, _ = buf.WriteTo(dst)
+	return true
+}
+
+// prefersHTML reports if text/html has a higher quality than application/json in accept. ties go
+// to json, so clients accepting anything, like fetch, keep getting json.
+func prefersHTML(accept string) bool {
+	quality := func(mediaType string) float64 {
+		best, bestSpecificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			typ, _, _ := strings.Cut(mediaType, "/")
+			specificity := -1
+			switch mt {
+			case mediaType:
+				specificity = 2
+			case typ + "/*":
+				specificity = 1
+			case "*/*":
+				specificity = 0
+			}
+			if specificity <= bestSpecificity {
+				continue
+			}
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+			best, bestSpecificity = q, specificity
+		}
+		return best
+	}
+	return quality("text/html") > quality("application/json")
+}
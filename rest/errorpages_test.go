@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestHTMLErrors(t *testing.T) {
+	templates := template.Must(template.New("404.html").Parse(`<h1>{{.Status}} {{.Message}}</h1>`))
+	template.Must(templates.New("error.html").Parse(`<h1>{{.StatusText}}</h1>`))
+
+	handler := HTMLErrors(templates)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			WriteErr(w, errs.NotFound("<user> not found"))
+		case "/broken":
+			WriteErr(w, errs.Internal("query user"))
+		default:
+			WriteJSON(w, http.StatusOK, Message{Code: "ok", Message: "fine"})
+		}
+	}))
+	do := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	{ // browsers get html pages, escaped
+		w := do("/missing", browserAccept)
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		require.Equal(t, "<h1>404 &lt;user&gt; not found</h1>", w.Body.String())
+		require.Equal(t, "Accept", w.Header().Get("Vary"))
+
+		w = do("/broken", browserAccept)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.Equal(t, "<h1>Internal Server Error</h1>", w.Body.String())
+	}
+
+	{ // api clients and successful responses keep json
+		for _, accept := range []string{"", "*/*", "application/json", "application/json, text/html;q=0.5"} {
+			w := do("/missing", accept)
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"), accept)
+			require.Equal(t, "Accept", w.Header().Get("Vary"), accept)
+			require.JSONEq(t, `{"code":"ErrNotFound","message":"<user> not found"}`, w.Body.String())
+		}
+
+		w := do("/ok", browserAccept)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	}
+
+	{ // the server renders unmatched routes with the 404 page
+		srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithHTMLErrors(templates),
+			WithHandler(func(router chi.Router) http.Handler {
+				router.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+				return router
+			}))
+		require.NoError(t, err)
+		require.NoError(t, srv.Start(context.Background()))
+		defer srv.Shutdown(context.Background())
+
+		req, err := http.NewRequest(http.MethodGet, "http://"+srv.Addr()+"/nowhere", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", browserAccept)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+		require.Equal(t, "<h1>404 Not Found</h1>", string(body))
+	}
+}
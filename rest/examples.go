@@ -0,0 +1,307 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/pii"
+)
+
+const (
+	// DefaultExamplesPerResponse is how many examples are kept of each response status of a route.
+	DefaultExamplesPerResponse = 1
+	// DefaultMaxExampleSize is the largest body recorded as an example.
+	DefaultMaxExampleSize = 64 << 10
+)
+
+// DefaultRedactedFields are json fields whose values are replaced in examples, matched case insensitively.
+var DefaultRedactedFields = []string{
+	"password", "secret", "token", "access_token", "refresh_token", "id_token", "api_key", "apikey",
+	"authorization", "card_number", "cvv", "ssn",
+}
+
+// Example is a recorded exchange of a route.
+type Example struct {
+	Method   string          `json:"method"`
+	Route    string          `json:"route"`
+	Status   int             `json:"status"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+type ExamplesOption func(*Examples) error
+
+// WithExamplesPerResponse sets how many examples are kept of each response status of a route.
+func WithExamplesPerResponse(n int) ExamplesOption {
+	return func(e *Examples) error {
+		if n <= 0 {
+			return errors.New("examples per response must be positive")
+		}
+		e.perResponse = n
+		return nil
+	}
+}
+
+// WithRedactedFields adds json fields whose values are replaced in examples.
+func WithRedactedFields(fields ...string) ExamplesOption {
+	return func(e *Examples) error {
+		for _, f := range fields {
+			e.redacted[strings.ToLower(f)] = true
+		}
+		return nil
+	}
+}
+
+// Examples records real json requests and responses of routes, sanitized, to show them as examples in
+// the api docs. recording holds bodies in memory and is meant for development and staging only.
+type Examples struct {
+	perResponse int
+	redacted    map[string]bool
+
+	mu       sync.Mutex
+	examples map[string][]Example
+}
+
+// NewExamples returns an example recorder.
+// example:
+//
+//	examples, err := rest.NewExamples()
+//	router.Use(examples.Middleware)
+//	router.Get("/debug/examples", examples.ServeHTTP)
+//	...
+//	// after exercising the service, like with the integration tests
+//	doc, err = examples.MergeOpenAPI(doc)
+func NewExamples(options ...ExamplesOption) (*Examples, error) {
+	e := &Examples{
+		perResponse: DefaultExamplesPerResponse,
+		redacted:    make(map[string]bool),
+		examples:    make(map[string][]Example),
+	}
+	for _, f := range DefaultRedactedFields {
+		e.redacted[f] = true
+	}
+	for _, o := range options {
+		if err := o(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Middleware records the exchanges of routes until enough examples of each response status are kept.
+// only json bodies are recorded, headers never are.
+func (e *Examples) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody []byte
+		if r.Body != nil && isJSON(r.Header.Get("Content-Type")) {
+			b, err := io.ReadAll(io.LimitReader(r.Body, DefaultMaxExampleSize+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+			if err == nil && len(b) <= DefaultMaxExampleSize {
+				reqBody = b
+			}
+		}
+
+		ew := &exampleWriter{wrappedWriter: wrappedWriter{w}}
+		next.ServeHTTP(ew, r)
+
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || rctx.RoutePattern() == "" {
+			return
+		}
+		status := ew.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ex := Example{Method: r.Method, Route: openAPIPath(rctx.RoutePattern()), Status: status}
+		if reqBody != nil {
+			ex.Request = e.sanitize(reqBody)
+		}
+		if !ew.tooLarge && isJSON(ew.Header().Get("Content-Type")) {
+			ex.Response = e.sanitize(ew.body.Bytes())
+		}
+		e.add(ex)
+	})
+}
+
+func (e *Examples) add(ex Example) {
+	key := ex.Method + " " + ex.Route + " " + strconv.Itoa(ex.Status)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.examples[key]) < e.perResponse {
+		e.examples[key] = append(e.examples[key], ex)
+	}
+}
+
+// List returns the recorded examples sorted by route, method and status.
+func (e *Examples) List() []Example {
+	e.mu.Lock()
+	keys := make([]string, 0, len(e.examples))
+	for k := range e.examples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var list []Example
+	for _, k := range keys {
+		list = append(list, e.examples[k]...)
+	}
+	e.mu.Unlock()
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Route != list[j].Route {
+			return list[i].Route < list[j].Route
+		}
+		if list[i].Method != list[j].Method {
+			return list[i].Method < list[j].Method
+		}
+		return list[i].Status < list[j].Status
+	})
+	return list
+}
+
+// ServeHTTP writes the recorded examples as json.
+func (e *Examples) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	WriteJSON(w, http.StatusOK, e.List())
+}
+
+// MergeOpenAPI sets the recorded examples on the operations of the json openapi 3 document doc. only
+// operations of the document get examples, responses missing a recorded status are added to them.
+func (e *Examples) MergeOpenAPI(doc []byte) ([]byte, error) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(doc, &spec); err != nil {
+		return nil, err
+	}
+	paths, _ := spec["paths"].(map[string]interface{})
+
+	for _, ex := range e.List() {
+		path, _ := paths[ex.Route].(map[string]interface{})
+		op, _ := path[strings.ToLower(ex.Method)].(map[string]interface{})
+		if op == nil {
+			continue
+		}
+
+		if ex.Request != nil {
+			setExample(child(op, "requestBody"), ex.Request)
+		}
+		if ex.Response != nil {
+			responses := child(op, "responses")
+			code := strconv.Itoa(ex.Status)
+			res, ok := responses[code].(map[string]interface{})
+			if !ok {
+				res = map[string]interface{}{"description": http.StatusText(ex.Status)}
+				responses[code] = res
+			}
+			setExample(res, ex.Response)
+		}
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// setExample sets the json example of the request body or response obj, unless it has one.
+func setExample(obj map[string]interface{}, example json.RawMessage) {
+	media := child(child(obj, "content"), "application/json")
+	if _, ok := media["example"]; !ok {
+		media["example"] = example
+	}
+}
+
+func child(obj map[string]interface{}, key string) map[string]interface{} {
+	c, ok := obj[key].(map[string]interface{})
+	if !ok {
+		c = map[string]interface{}{}
+		obj[key] = c
+	}
+	return c
+}
+
+var routeParamRegexp = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// openAPIPath turns chi patterns like /users/{id:[0-9]+}/* into openapi paths like /users/{id}/*.
+func openAPIPath(pattern string) string {
+	return routeParamRegexp.ReplaceAllString(pattern, "{$1}")
+}
+
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+// sanitize replaces the values of redacted fields and masks email addresses, bodies which are not
+// valid json are dropped.
+func (e *Examples) sanitize(body []byte) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil
+	}
+	b, err := json.Marshal(e.redact(v))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+var emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+func (e *Examples) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if e.redacted[strings.ToLower(k)] {
+				v[k] = pii.Masked
+				continue
+			}
+			v[k] = e.redact(val)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = e.redact(v[i])
+		}
+	case string:
+		if emailRegexp.MatchString(v) {
+			return pii.Mask(pii.KindEmail, v)
+		}
+	}
+	return v
+}
+
+// exampleWriter copies the response body while writing it.
+type exampleWriter struct {
+	wrappedWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (w *exampleWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *exampleWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.tooLarge {
+		if w.body.Len()+len(b) > DefaultMaxExampleSize {
+			w.tooLarge = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExamples(t *testing.T) {
+	examples, err := NewExamples(WithRedactedFields("pin"))
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Use(examples.Middleware)
+	router.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		req["id"] = "42"
+		WriteJSON(w, http.StatusCreated, req)
+	})
+	router.Get("/users/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "0" {
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"id": chi.URLParam(r, "id"), "token": "abc", "pin": "1234"})
+	})
+	router.Get("/text", func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "plain") })
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	{ // handlers still read the request body
+		rec := do(http.MethodPost, "/users", `{"email":"ann@example.com","password":"s3cr3t"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Contains(t, rec.Body.String(), "ann@example.com")
+	}
+	do(http.MethodGet, "/users/7", "")
+	do(http.MethodGet, "/users/8", "")
+	do(http.MethodGet, "/users/0", "")
+	do(http.MethodGet, "/text", "")
+
+	list := examples.List()
+	require.Len(t, list, 4)
+
+	{ // bodies are sanitized and only one example is kept per status
+		require.Equal(t, "/text", list[0].Route)
+		require.Nil(t, list[0].Response)
+		require.Equal(t, Example{Method: "POST", Route: "/users", Status: 201,
+			Request:  json.RawMessage(`{"email":"a***@example.com","password":"***"}`),
+			Response: json.RawMessage(`{"email":"a***@example.com","id":"42","password":"***"}`),
+		}, list[1])
+		require.Equal(t, "/users/{id}", list[2].Route)
+		require.JSONEq(t, `{"id":"7","token":"***","pin":"***"}`, string(list[2].Response))
+		require.Equal(t, http.StatusNotFound, list[3].Status)
+	}
+
+	{ // examples are merged into the operations of the document
+		doc := `{"openapi":"3.0.3","paths":{
+			"/users":{"post":{"requestBody":{"content":{"application/json":{"schema":{"type":"object"}}}},"responses":{"201":{"description":"created"}}}},
+			"/users/{id}":{"get":{"responses":{"200":{"description":"user","content":{"application/json":{"example":{"id":"1"}}}}}}}}}`
+		merged, err := examples.MergeOpenAPI([]byte(doc))
+		require.NoError(t, err)
+
+		var spec struct {
+			Paths map[string]map[string]struct {
+				RequestBody struct {
+					Content map[string]map[string]interface{} `json:"content"`
+				} `json:"requestBody"`
+				Responses map[string]struct {
+					Description string                            `json:"description"`
+					Content     map[string]map[string]interface{} `json:"content"`
+				} `json:"responses"`
+			} `json:"paths"`
+		}
+		require.NoError(t, json.Unmarshal(merged, &spec))
+
+		post := spec.Paths["/users"]["post"]
+		require.Equal(t, map[string]interface{}{"type": "object"}, post.RequestBody.Content["application/json"]["schema"])
+		require.Equal(t, "a***@example.com", post.RequestBody.Content["application/json"]["example"].(map[string]interface{})["email"])
+		require.Equal(t, "42", post.Responses["201"].Content["application/json"]["example"].(map[string]interface{})["id"])
+
+		get := spec.Paths["/users/{id}"]["get"]
+		// existing examples are kept
+		require.Equal(t, "1", get.Responses["200"].Content["application/json"]["example"].(map[string]interface{})["id"])
+		require.Equal(t, "Not Found", get.Responses["404"].Description)
+		require.NotContains(t, spec.Paths, "/text")
+	}
+}
@@ -0,0 +1,213 @@
+package rest
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// exportFlushRows is the number of rows written between flushes of the response while exporting.
+const exportFlushRows = 100
+
+// RowIterator returns the next row on each call and io.EOF when there is no rows left.
+// see store.RowIterator to export the result of a query.
+// example:
+//
+//	rows, err := pool.Query(ctx, "SELECT id, email FROM users")
+//	...
+//	defer rows.Close()
+//	err = rest.WriteCSV(w, "users.csv", []string{"id", "email"}, store.RowIterator(rows))
+type RowIterator func() ([]string, error)
+
+// WriteCSV streams rows as a csv attachment named filename. rows are flushed to the client while
+// they are read, so large exports never have to be kept in memory.
+// as the headers are already sent when rows fails, the returned error can only be logged.
+func WriteCSV(w http.ResponseWriter, filename string, headers []string, rows RowIterator) error {
+	setAttachment(w, "text/csv; charset=utf-8", filename)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	return writeRows(w, headers, rows, cw.Write, func() error {
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+// WriteXLSX streams rows as a single sheet xlsx attachment named filename.
+func WriteXLSX(w http.ResponseWriter, filename string, headers []string, rows RowIterator) error {
+	setAttachment(w, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", filename)
+	w.WriteHeader(http.StatusOK)
+
+	xw, err := NewXLSXWriter(w, "Sheet1")
+	if err != nil {
+		return err
+	}
+
+	err = writeRows(w, headers, rows, xw.WriteRow, xw.Flush)
+	if cerr := xw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// XLSXWriter writes a single sheet xlsx document row by row. all cells are written as strings.
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	// deflate compresses the part being written, the sheet once the writer is created
+	deflate *flate.Writer
+}
+
+// NewXLSXWriter starts a new xlsx document on w. Close must be called to finish the document.
+func NewXLSXWriter(w io.Writer, sheetName string) (*XLSXWriter, error) {
+	x := &XLSXWriter{zw: zip.NewWriter(w)}
+	zw := x.zw
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		fw, err := flate.NewWriter(out, flate.DefaultCompression)
+		x.deflate = fw
+		return fw, err
+	})
+
+	var name strings.Builder
+	if err := xml.EscapeText(&name, []byte(sheetName)); err != nil {
+		return nil, err
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, xml.Header+p.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// sheet must be the last part as it is streamed until Close
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	x.sheet = bufio.NewWriter(f)
+	if _, err := x.sheet.WriteString(xml.Header + xlsxSheetStart); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// WriteRow appends a row to the sheet.
+func (x *XLSXWriter) WriteRow(row []string) error {
+	if _, err := x.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+	for _, cell := range row {
+		if _, err := x.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(x.sheet, []byte(cell)); err != nil {
+			return err
+		}
+		if _, err := x.sheet.WriteString("</t></is></c>"); err != nil {
+			return err
+		}
+	}
+	_, err := x.sheet.WriteString("</row>")
+	return err
+}
+
+// Flush writes buffered rows to the underlying writer, including the ones held by the compressor.
+func (x *XLSXWriter) Flush() error {
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	if err := x.deflate.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Flush()
+}
+
+// Close finishes the sheet and the document. it does not close the underlying writer.
+func (x *XLSXWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+func writeRows(w http.ResponseWriter, headers []string, rows RowIterator, write func([]string) error, flush func() error) error {
+	flusher, _ := w.(http.Flusher)
+	if len(headers) > 0 {
+		if err := write(headers); err != nil {
+			return err
+		}
+	}
+
+	for n := 1; ; n++ {
+		row, err := rows()
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := write(row); err != nil {
+			return err
+		}
+
+		if n%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func setAttachment(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+const (
+	xlsxContentTypes = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+
+	xlsxRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	xlsxWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+
+	xlsxWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+
+	xlsxSheetStart = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd   = `</sheetData></worksheet>`
+)
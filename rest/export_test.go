@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sliceRows(rows [][]string) RowIterator {
+	i := 0
+	return func() ([]string, error) {
+		if i == len(rows) {
+			return nil, io.EOF
+		}
+		i++
+		return rows[i-1], nil
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := WriteCSV(w, "report.csv", []string{"id", "name"}, sliceRows([][]string{{"1", "foo"}, {"2", "bar, baz"}}))
+	require.NoError(t, err)
+
+	res := w.Result()
+	require.Equal(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+	require.Equal(t, "attachment; filename=report.csv", res.Header.Get("Content-Disposition"))
+	require.Equal(t, "id,name\n1,foo\n2,\"bar, baz\"\n", w.Body.String())
+}
+
+func TestWriteXLSX(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := WriteXLSX(w, "report.xlsx", []string{"id", "name"}, sliceRows([][]string{{"1", "<foo>"}}))
+	require.NoError(t, err)
+
+	body := w.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		sheet = string(b)
+	}
+
+	require.Len(t, zr.File, 5)
+	require.Equal(t, 2, strings.Count(sheet, "<row>"))
+	require.Contains(t, sheet, "&lt;foo&gt;")
+}
+
+func TestXLSXWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	xw, err := NewXLSXWriter(&buf, "Sheet1")
+	require.NoError(t, err)
+	require.NoError(t, xw.Flush())
+
+	// rows reach the writer on flush, not only once the document is closed
+	written := buf.Len()
+	require.NoError(t, xw.WriteRow([]string{"1", "foo"}))
+	require.NoError(t, xw.Flush())
+	require.Greater(t, buf.Len(), written)
+
+	require.NoError(t, xw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 5)
+}
@@ -0,0 +1,260 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// FieldsParam is the query parameter selecting the fields of responses.
+const FieldsParam = "fields"
+
+// FieldMask selects fields of json documents by name, a nil mask of a field selects all of its value.
+type FieldMask map[string]FieldMask
+
+// ParseFieldMask parses a comma separated list of fields, nested fields are selected with dots like
+// "id,name,address.city".
+func ParseFieldMask(s string) (FieldMask, error) {
+	mask := FieldMask{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		m := mask
+		parts := strings.Split(field, ".")
+		for i, p := range parts {
+			if p == "" {
+				return nil, errors.New("invalid field " + field)
+			}
+			sub, ok := m[p]
+			if ok && sub == nil {
+				// the whole value is already selected
+				break
+			}
+			if i == len(parts)-1 {
+				m[p] = nil
+				break
+			}
+			if !ok {
+				sub = FieldMask{}
+				m[p] = sub
+			}
+			m = sub
+		}
+	}
+	if len(mask) == 0 {
+		return nil, errors.New("no fields selected")
+	}
+	return mask, nil
+}
+
+func (m FieldMask) String() string {
+	fields := make([]string, 0, len(m))
+	for k, sub := range m {
+		if sub == nil {
+			fields = append(fields, k)
+			continue
+		}
+		for _, f := range strings.Split(sub.String(), ",") {
+			fields = append(fields, k+"."+f)
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
+
+// FieldMasking lets clients select the fields of successful json responses with the fields query
+// parameter, like ?fields=id,name,address.city. masks apply to each element of arrays, so lists are
+// pruned like single items. responses written with WriteJSON are pruned while being copied, without
+// decoding them into maps.
+// example:
+//
+//	router.With(rest.FieldMasking).Get("/users/{id}", getUser)
+func FieldMasking(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get(FieldsParam)
+		if q == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mask, err := ParseFieldMask(q)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		next.ServeHTTP(&maskWriter{wrappedWriter: wrappedWriter{w}, mask: mask}, r)
+	})
+}
+
+type maskWriter struct {
+	wrappedWriter
+	mask FieldMask
+}
+
+// PruneJSON copies the json document src to dst keeping the fields selected by mask.
+func PruneJSON(dst *bytes.Buffer, src []byte, mask FieldMask) error {
+	i := skipSpace(src, 0)
+	end, err := pruneValue(dst, src, i, mask)
+	if err != nil {
+		return err
+	}
+	dst.Write(src[end:])
+	return nil
+}
+
+// pruneValue writes the value at src[i:] and returns where it ends.
+func pruneValue(dst *bytes.Buffer, src []byte, i int, mask FieldMask) (int, error) {
+	if mask == nil || i >= len(src) {
+		end, err := valueEnd(src, i)
+		if err != nil {
+			return 0, err
+		}
+		dst.Write(src[i:end])
+		return end, nil
+	}
+
+	switch src[i] {
+	case '{':
+		dst.WriteByte('{')
+		first := true
+		i = skipSpace(src, i+1)
+		for i < len(src) && src[i] != '}' {
+			keyEnd, err := valueEnd(src, i)
+			if err != nil {
+				return 0, err
+			}
+			key, err := unquoteKey(src[i:keyEnd])
+			if err != nil {
+				return 0, err
+			}
+			colon := skipSpace(src, keyEnd)
+			if colon >= len(src) || src[colon] != ':' {
+				return 0, errors.New("invalid json object")
+			}
+			start := skipSpace(src, colon+1)
+
+			var end int
+			if sub, ok := mask[key]; ok {
+				if !first {
+					dst.WriteByte(',')
+				}
+				first = false
+				dst.Write(src[i:keyEnd])
+				dst.WriteByte(':')
+				end, err = pruneValue(dst, src, start, sub)
+			} else {
+				end, err = valueEnd(src, start)
+			}
+			if err != nil {
+				return 0, err
+			}
+
+			i = skipSpace(src, end)
+			if i < len(src) && src[i] == ',' {
+				i = skipSpace(src, i+1)
+			}
+		}
+		if i >= len(src) {
+			return 0, errors.New("unterminated json object")
+		}
+		dst.WriteByte('}')
+		return i + 1, nil
+	case '[':
+		dst.WriteByte('[')
+		i = skipSpace(src, i+1)
+		for n := 0; i < len(src) && src[i] != ']'; n++ {
+			if n > 0 {
+				dst.WriteByte(',')
+			}
+			end, err := pruneValue(dst, src, i, mask)
+			if err != nil {
+				return 0, err
+			}
+			i = skipSpace(src, end)
+			if i < len(src) && src[i] == ',' {
+				i = skipSpace(src, i+1)
+			}
+		}
+		if i >= len(src) {
+			return 0, errors.New("unterminated json array")
+		}
+		dst.WriteByte(']')
+		return i + 1, nil
+	}
+
+	// masks do not apply to scalars
+	return pruneValue(dst, src, i, nil)
+}
+
+// valueEnd returns where the json value starting at src[i] ends.
+func valueEnd(src []byte, i int) (int, error) {
+	if i >= len(src) {
+		return 0, errors.New("unexpected end of json")
+	}
+	switch src[i] {
+	case '"':
+		for j := i + 1; j < len(src); j++ {
+			switch src[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1, nil
+			}
+		}
+		return 0, errors.New("unterminated json string")
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(src); j++ {
+			switch src[j] {
+			case '"':
+				end, err := valueEnd(src, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, errors.New("unterminated json value")
+	}
+
+	j := i
+	for j < len(src) && !strings.ContainsRune(",}] \t\r\n", rune(src[j])) {
+		j++
+	}
+	if j == i {
+		return 0, errors.New("invalid json value")
+	}
+	return j, nil
+}
+
+func unquoteKey(raw []byte) (string, error) {
+	if len(raw) < 2 || raw[0] != '"' {
+		return "", errors.New("invalid json object key")
+	}
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1 : len(raw)-1]), nil
+	}
+	var key string
+	err := json.Unmarshal(raw, &key)
+	return key, err
+}
+
+func skipSpace(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\n' || src[i] == '\r') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFieldMask(t *testing.T) {
+	mask, err := ParseFieldMask("id, address.city,address.zip,tags,tags.name")
+	require.NoError(t, err)
+	require.Equal(t, FieldMask{"id": nil, "tags": nil, "address": FieldMask{"city": nil, "zip": nil}}, mask)
+	require.Equal(t, "address.city,address.zip,id,tags", mask.String())
+
+	_, err = ParseFieldMask("a..b")
+	require.Error(t, err)
+	_, err = ParseFieldMask(" , ")
+	require.Error(t, err)
+}
+
+func TestPruneJSON(t *testing.T) {
+	mask, err := ParseFieldMask("id,address.city,items.name")
+	require.NoError(t, err)
+
+	src := `{"id":1,"name":"a \"quoted\" }","address":{"city":"Berlin","zip":"10115"},"items":[{"name":"x","price":1},{"price":2}],"extra":[1,{"a":"]"}]}`
+	var dst bytes.Buffer
+	require.NoError(t, PruneJSON(&dst, []byte(src), mask))
+	require.JSONEq(t, `{"id":1,"address":{"city":"Berlin"},"items":[{"name":"x"},{}]}`, dst.String())
+
+	{ // truncated and invalid documents are errors
+		for _, src := range []string{`{"id":1`, `{"id":1,`, `{"items":[{"name":"x"}`, `[{"id":1}`, `{"id":}`, `{"id"`, `{"id":"1`} {
+			dst.Reset()
+			require.Error(t, PruneJSON(&dst, []byte(src), mask), src)
+		}
+	}
+}
+
+func TestFieldMasking(t *testing.T) {
+	handler := FieldMasking(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			WriteErr(w, errs.NotFound("not found"))
+			return
+		}
+		WriteJSON(w, http.StatusOK, []map[string]interface{}{{"id": 1, "name": "alice", "email": "a@example.com"}})
+	}))
+
+	{ // lists are pruned per item
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?fields=id,name", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `[{"id":1,"name":"alice"}]`, w.Body.String())
+	}
+
+	{ // errors are not pruned
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing?fields=id", nil))
+		require.JSONEq(t, `{"code":"ErrNotFound","message":"not found"}`, w.Body.String())
+	}
+
+	{ // invalid masks
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?fields=.", nil))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
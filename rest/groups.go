@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Group names a set of routes sharing a policy, like the routes only admins may call.
+type Group string
+
+const (
+	GroupPublic        Group = "public"
+	GroupAuthenticated Group = "authenticated"
+	GroupAdmin         Group = "admin"
+)
+
+type groupPolicy struct {
+	parent      Group
+	middlewares []func(next http.Handler) http.Handler
+}
+
+// Groups holds the middleware bundles of route groups, so services declare the policy of a route by
+// the group it is in instead of repeating middleware lists. GroupPublic has no middlewares and
+// GroupAuthenticated requires a user, see RequireUser, unless they are redefined. GroupAdmin has to be
+// defined, as only the service knows who its admins are.
+type Groups struct {
+	policies map[Group]groupPolicy
+}
+
+type GroupOption func(*Groups) error
+
+// WithGroup defines group with middlewares, applied after the ones of parent if it is not empty. like
+// admin routes extending the authenticated ones with a role check and audit logging.
+func WithGroup(group, parent Group, middlewares ...func(next http.Handler) http.Handler) GroupOption {
+	return func(g *Groups) error {
+		if parent != "" {
+			if _, ok := g.policies[parent]; !ok {
+				return fmt.Errorf("parent group %s of %s is not defined", parent, group)
+			}
+		}
+		g.policies[group] = groupPolicy{parent: parent, middlewares: middlewares}
+		return nil
+	}
+}
+
+// NewGroups returns the route groups.
+// example:
+//
+//	groups, err := rest.NewGroups(
+//		rest.WithGroup(rest.GroupAdmin, rest.GroupAuthenticated, requireRole("admin"), rest.AuditRequests(logger)))
+//	...
+//	groups.Route(router, rest.GroupPublic, func(r chi.Router) {
+//		r.Get("/products", listProducts)
+//	})
+//	groups.Route(router, rest.GroupAdmin, func(r chi.Router) {
+//		r.Delete("/products/{id}", deleteProduct)
+//	})
+func NewGroups(options ...GroupOption) (*Groups, error) {
+	g := &Groups{policies: map[Group]groupPolicy{
+		GroupPublic:        {},
+		GroupAuthenticated: {middlewares: []func(next http.Handler) http.Handler{RequireUser}},
+	}}
+	for _, o := range options {
+		if err := o(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Middlewares returns the middlewares of group, the ones of its parents first.
+func (g *Groups) Middlewares(group Group) ([]func(next http.Handler) http.Handler, error) {
+	var chain [][]func(next http.Handler) http.Handler
+	seen := make(map[Group]bool)
+	for group != "" {
+		p, ok := g.policies[group]
+		if !ok {
+			return nil, fmt.Errorf("group %s is not defined", group)
+		}
+		if seen[group] {
+			return nil, fmt.Errorf("group %s extends itself", group)
+		}
+		seen[group] = true
+		chain = append(chain, p.middlewares)
+		group = p.parent
+	}
+
+	var middlewares []func(next http.Handler) http.Handler
+	for i := len(chain) - 1; i >= 0; i-- {
+		middlewares = append(middlewares, chain[i]...)
+	}
+	return middlewares, nil
+}
+
+// Route adds the routes fn defines to router with the middlewares of group. it panics if group is not
+// defined, like chi does for invalid routes, as it is a mistake found on startup.
+func (g *Groups) Route(router chi.Router, group Group, fn func(r chi.Router)) {
+	middlewares, err := g.Middlewares(group)
+	if err != nil {
+		panic(err)
+	}
+	router.Group(func(r chi.Router) {
+		r.Use(middlewares...)
+		fn(r)
+	})
+}
+
+// RequireUser rejects requests without the user id of a RequestMeta with status 401, it is meant for
+// services behind a gateway authenticating users, see GatewayMeta.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if meta, ok := RequestMetaFrom(r.Context()); !ok || meta.UserID == "" {
+			WriteError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuditRequests logs requests changing state, which are not GET, HEAD or OPTIONS, with the user who
+// made them and the response status.
+func AuditRequests(logger *zap.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sw := &statusWriter{wrappedWriter: wrappedWriter{w}, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			fields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("code", sw.status),
+			}
+			if meta, ok := RequestMetaFrom(r.Context()); ok {
+				fields = append(fields, zap.String("user_id", meta.UserID), zap.String("org_id", meta.OrgID))
+			}
+			logger.Info("audit", fields...)
+		})
+	}
+}
+
+type statusWriter struct {
+	wrappedWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestGroups(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	requireAdmin := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if meta, _ := RequestMetaFrom(r.Context()); meta.UserID != "admin" {
+				WriteError(w, http.StatusForbidden, "admins only")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	groups, err := NewGroups(WithGroup(GroupAdmin, GroupAuthenticated, requireAdmin, AuditRequests(zap.New(core))))
+	require.NoError(t, err)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	router := chi.NewRouter()
+	router.Use(GatewayMeta)
+	groups.Route(router, GroupPublic, func(r chi.Router) { r.Get("/products", ok) })
+	groups.Route(router, GroupAuthenticated, func(r chi.Router) { r.Get("/me", ok) })
+	groups.Route(router, GroupAdmin, func(r chi.Router) { r.Delete("/products/{id}", ok) })
+
+	do := func(method, path, user string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			r.Header.Set("X-User-ID", user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, do(http.MethodGet, "/products", ""))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", ""))
+	require.Equal(t, http.StatusNoContent, do(http.MethodGet, "/me", "alice"))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/products/1", ""))
+	require.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/products/1", "alice"))
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/products/1", "admin"))
+
+	entries := logs.FilterMessage("audit").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "admin", entries[0].ContextMap()["user_id"])
+	require.EqualValues(t, http.StatusNoContent, entries[0].ContextMap()["code"])
+
+	{ // undefined groups
+		_, err := NewGroups(WithGroup("support", GroupAdmin))
+		require.Error(t, err)
+		require.Panics(t, func() { groups.Route(router, "support", func(r chi.Router) {}) })
+	}
+}
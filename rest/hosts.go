@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AllowedHosts rejects requests whose Host header is not one of hosts with 421 Misdirected Request,
+// protecting against dns rebinding and requests for other domains routed to the server. hosts are
+// matched without their port and case, "*.example.com" allows any subdomain of example.com but not
+// example.com itself. ip hosts, like "10.0.3.7:8080" or "[::1]", are always allowed since dns rebinding
+// needs a name, which keeps kubernetes probes and metrics scrapes addressing pods by ip working.
+// WithAllowedHosts adds it for RunHttpServer.
+// example:
+//
+//	router.Use(rest.AllowedHosts([]string{"api.example.com", "*.api.example.com", "localhost"}))
+func AllowedHosts(hosts []string) func(next http.Handler) http.Handler {
+	exact := make(map[string]bool, len(hosts))
+	var suffixes []string
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(h, "["), "]"))
+		if strings.HasPrefix(h, "*.") {
+			suffixes = append(suffixes, h[1:])
+			continue
+		}
+		exact[h] = true
+	}
+
+	allowed := func(host string) bool {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		if exact[host] || net.ParseIP(host) != nil {
+			return true
+		}
+		for _, s := range suffixes {
+			if len(host) > len(s) && strings.HasSuffix(host, s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed(r.Host) {
+				WriteError(w, http.StatusMisdirectedRequest, "host is not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
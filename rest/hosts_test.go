@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAllowedHosts(t *testing.T) {
+	handler := AllowedHosts([]string{"api.example.com", "*.Apps.example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	status := func(host string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	{ // exact hosts, with ports and in any case
+		require.Equal(t, http.StatusNoContent, status("api.example.com"))
+		require.Equal(t, http.StatusNoContent, status("API.example.com:8443"))
+		require.Equal(t, http.StatusNoContent, status("api.example.com."))
+		require.Equal(t, http.StatusMisdirectedRequest, status("example.com"))
+		require.Equal(t, http.StatusMisdirectedRequest, status("evil.com"))
+		require.Equal(t, http.StatusMisdirectedRequest, status(""))
+	}
+
+	{ // wildcards match subdomains only
+		require.Equal(t, http.StatusNoContent, status("billing.apps.example.com"))
+		require.Equal(t, http.StatusNoContent, status("eu.billing.apps.example.com:80"))
+		require.Equal(t, http.StatusMisdirectedRequest, status("apps.example.com"))
+		require.Equal(t, http.StatusMisdirectedRequest, status("evilapps.example.com"))
+	}
+
+	{ // ip hosts are allowed, with or without brackets and ports
+		require.Equal(t, http.StatusNoContent, status("10.0.3.7"))
+		require.Equal(t, http.StatusNoContent, status("10.0.3.7:8080"))
+		require.Equal(t, http.StatusNoContent, status("[::1]"))
+		require.Equal(t, http.StatusNoContent, status("[fe80::1]:8080"))
+		require.Equal(t, http.StatusMisdirectedRequest, status("[evil.com]"))
+	}
+
+	{ // the server enforces WithAllowedHosts
+		srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithAllowedHosts([]string{"api.example.com"}),
+			WithHandler(func(router chi.Router) http.Handler {
+				router.Get("/", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+				return router
+			}))
+		require.NoError(t, err)
+		ctx := context.Background()
+		require.NoError(t, srv.Start(ctx))
+		defer srv.Shutdown(ctx)
+
+		for host, want := range map[string]int{
+			"evil.com":        http.StatusMisdirectedRequest,
+			"api.example.com": http.StatusNoContent,
+			"":                http.StatusNoContent,
+		} {
+			req, err := http.NewRequest(http.MethodGet, "http://"+srv.Addr()+"/", nil)
+			require.NoError(t, err)
+			req.Host = host
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, want, res.StatusCode, host)
+		}
+	}
+}
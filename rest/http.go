@@ -1,88 +1,95 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/diag"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/group"
+	goxlog "github.com/mirzakhany/gox/log"
+	"github.com/mirzakhany/gox/pii"
+	"github.com/mirzakhany/gox/validation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
 // RunHttpServer starts a http server on given port. handler will be created when making the http.Server object.
 // it will be a blocking call and will do gracefully shutdown the server when given context canceled.
+// with WithGracefulRestart, receiving SIGUSR2 starts a new instance of the binary handing over the listener,
+// then this one shuts down gracefully. WithTLS, WithTLSConfig or WithAutoTLS serve https instead of http.
+// it returns the error of invalid options, failing to listen or serve, or a shutdown which did not
+// finish in time, and nil after a graceful shutdown. see Server to start and stop the server yourself.
 // example:
 //
-//	gox.RunHttpServer(ctx, func(router chi.Router) http.Handler {
+//	err := gox.RunHttpServer(ctx, func(router chi.Router) http.Handler {
 //		return SetupRouter(router).Handler
 //	}, WithPort("9090"))
-func RunHttpServer(ctx context.Context, createHandler func(router chi.Router) http.Handler, options ...Option) {
-	nopLogger := zap.NewNop()
-	cfg := &config{
-		port:   DefaultPort,
-		logger: nopLogger,
-	}
-
-	for _, o := range options {
-		if err := o(cfg); err != nil {
-			log.Fatalf("Run HTTP server failed %e", err)
-		}
-	}
-
-	apiRouter := chi.NewRouter()
-	if len(cfg.middlewares) == 0 {
-		// set default middlewares
-		apiRouter.Use(DefaultMiddlewares()...)
-	}
-
-	if !cfg.setCors {
-		apiRouter.Use(cors.New(DefaultCorsOption()).Handler)
+func RunHttpServer(ctx context.Context, createHandler func(router chi.Router) http.Handler, options ...Option) error {
+	srv, err := New(append([]Option{WithHandler(createHandler)}, options...)...)
+	if err != nil {
+		return fmt.Errorf("run http server: %w", err)
 	}
-
-	if cfg.logger == nopLogger {
-		// TODO fixme: there are use cases when there not need for a logger, like metrics and liveliness endpoints
-		log.Println("WARN: no logger is set")
-	} else {
-		apiRouter.Use(RequestLogger(cfg.logger))
+	if err := srv.Start(ctx); err != nil {
+		return err
 	}
 
-	srv := &http.Server{
-		Addr:    net.JoinHostPort("", cfg.port),
-		Handler: createHandler(apiRouter),
+	select {
+	case <-ctx.Done():
+	case <-srv.Done():
 	}
-
-	go func() {
-		cfg.logger.Info("Start http server", zap.String("port", cfg.port))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			cfg.logger.Fatal("Start HTTP server failed", zap.Error(err))
-		}
-	}()
-
-	<-ctx.Done()
-	cfg.logger.Info("Http Server received a shutdown signal", zap.Int("gracefulShutdownSec", DefaultGracefulShutdownSec))
+	srv.logger.Info("Http Server received a shutdown signal", zap.Int("gracefulShutdownSec", DefaultGracefulShutdownSec))
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), DefaultGracefulShutdownSec*time.Second)
-	defer func() {
-		cancel()
-	}()
+	defer cancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		cfg.logger.Fatal("http server shutdown failed", zap.Error(err))
+		return multierr.Append(srv.Err(), err)
 	}
-	cfg.logger.Info("Http Server exited properly")
+	if err := srv.Err(); err != nil {
+		return err
+	}
+	srv.logger.Info("Http Server exited properly")
+	return nil
 }
 
+// WriteJSON writes v as json with status code, pruned by the FieldMasking and wrapped by the
+// EnvelopeResponses middlewares if the request went through them. error Messages are rendered
+// as html pages instead for browsers when HTMLErrors was used.
 func WriteJSON(w http.ResponseWriter, code int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	if _, ok := findWriter[*piiWriter](w); ok {
+		v = pii.Scrub(v)
+	}
+	if mw, ok := findWriter[*maskWriter](w); ok && mw.mask != nil && code >= 200 && code < 300 {
+		var raw, pruned bytes.Buffer
+		if err := json.NewEncoder(&raw).Encode(v); err == nil && PruneJSON(&pruned, raw.Bytes(), mw.mask) == nil {
+			v = json.RawMessage(bytes.TrimSpace(pruned.Bytes()))
+		}
+	}
+	if page, ok := findWriter[*htmlErrorWriter](w); ok && code >= http.StatusBadRequest {
+		if msg, ok := v.(Message); ok && page.render(w, code, msg) {
+			return
+		}
+	}
+	if env, ok := findWriter[*envelopeWriter](w); ok {
+		v = env.wrap(code, v)
+	}
 	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		_, _ = fmt.Fprintln(w, err)
@@ -109,6 +116,142 @@ func WriteError(w http.ResponseWriter, code int, message string) {
 	})
 }
 
+// WriteErr writes err as a Message, with the http status and code of errs.CodeOf(err). the message of
+// an errs.Error is used without its cause, and messages of server errors are replaced by the status
+// text so internal details never reach clients. RequestLogger logs the full error of server errors.
+// example:
+//
+//	user, err := repo.GetUser(ctx, id)
+//	if err != nil {
+//		rest.WriteErr(w, err) // 404 ErrNotFound for pgx.ErrNoRows
+//		return
+//	}
+func WriteErr(w http.ResponseWriter, err error) {
+	code := errs.CodeOf(err)
+	status := code.HTTPStatus()
+
+	message, ok := errs.UserMessage(err)
+	if !ok {
+		message = err.Error()
+	}
+	if status >= http.StatusInternalServerError {
+		message = http.StatusText(status)
+	}
+
+	recordError(w, err)
+	WriteJSON(w, status, Message{
+		Code:    code.MessageCode(),
+		Message: message,
+	})
+}
+
+// errorWriter keeps the error written by WriteErr so RequestLogger can log it.
+type errorWriter struct {
+	middleware.WrapResponseWriter
+	err error
+}
+
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.WrapResponseWriter
+}
+
+func (w *errorWriter) Flush() {
+	if f, ok := w.WrapResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *errorWriter) setErr(err error) {
+	w.err = err
+}
+
+// withOptional returns w implementing http.Hijacker, http.Pusher and io.ReaderFrom only when original
+// does, the writer of chi claims some of them either way.
+func (w *errorWriter) withOptional(original http.ResponseWriter) http.ResponseWriter {
+	h, hj := w.WrapResponseWriter.(http.Hijacker)
+	p, ps := w.WrapResponseWriter.(http.Pusher)
+	rf, rd := w.WrapResponseWriter.(io.ReaderFrom)
+	_, ohj := original.(http.Hijacker)
+	_, ops := original.(http.Pusher)
+	_, ord := original.(io.ReaderFrom)
+	hj, ps, rd = hj && ohj, ps && ops, rd && ord
+
+	switch {
+	case hj && ps && rd:
+		return struct {
+			*errorWriter
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, h, p, rf}
+	case hj && ps:
+		return struct {
+			*errorWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case hj && rd:
+		return struct {
+			*errorWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{w, h, rf}
+	case ps && rd:
+		return struct {
+			*errorWriter
+			http.Pusher
+			io.ReaderFrom
+		}{w, p, rf}
+	case hj:
+		return struct {
+			*errorWriter
+			http.Hijacker
+		}{w, h}
+	case ps:
+		return struct {
+			*errorWriter
+			http.Pusher
+		}{w, p}
+	case rd:
+		return struct {
+			*errorWriter
+			io.ReaderFrom
+		}{w, rf}
+	}
+	return w
+}
+
+// recordError keeps err in the errorWriter of RequestLogger below middlewares wrapping w, if any.
+func recordError(w http.ResponseWriter, err error) {
+	if ew, ok := findWriter[interface{ setErr(error) }](w); ok {
+		ew.setErr(err)
+	}
+}
+
+// ErrorFromResponse turns an error response holding a Message back into an error carrying its code,
+// so errors of other services keep their meaning, like NotFound, when passed on.
+// it returns nil for 2xx responses. the body is read but not closed.
+func ErrorFromResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	var body struct {
+		Message
+		Error *Message `json:"error"`
+	}
+	err := json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&body)
+	msg := body.Message
+	if body.Error != nil {
+		// the error of a service using EnvelopeResponses
+		msg = *body.Error
+	}
+	if err != nil || msg.Code == "" {
+		return errs.WithCode(fmt.Errorf("request failed with status %d", res.StatusCode), errs.FromHTTPStatus(res.StatusCode))
+	}
+	return errs.WithCode(errors.New(msg.Message), errs.FromMessageCode(msg.Code))
+}
+
 func ReadJSON(r *http.Request, target interface{}) (int, error) {
 	dec := json.NewDecoder(r.Body)
 
@@ -116,6 +259,7 @@ func ReadJSON(r *http.Request, target interface{}) (int, error) {
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
 
 		switch {
 
@@ -150,11 +294,10 @@ func ReadJSON(r *http.Request, target interface{}) (int, error) {
 		case errors.Is(err, io.EOF):
 			return http.StatusBadRequest, fmt.Errorf("request body must not be empty")
 
-		// Catch the error caused by the request body being too large. Again
-		// there is an open issue regarding turning this into a sentinel
-		// error at https://github.com/golang/go/issues/30715.
-		case err.Error() == "http: request body too large":
-			return http.StatusBadRequest, fmt.Errorf(err.Error())
+		// Catch the error caused by the request body being larger than the
+		// limit of http.MaxBytesReader, like the one set by MaxBodySize.
+		case errors.As(err, &maxBytesError):
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("request body must not be larger than %d bytes", maxBytesError.Limit)
 
 		default:
 			return http.StatusBadRequest, fmt.Errorf(http.StatusText(http.StatusInternalServerError))
@@ -173,10 +316,32 @@ func ReadJSON(r *http.Request, target interface{}) (int, error) {
 	return http.StatusOK, nil
 }
 
+// BindJSON reads the request body into target like ReadJSON and validates it using validation.Default,
+// so `validate` tags and custom validations registered there are applied to requests too.
+// example:
+//
+//	var req createUserRequest
+//	if code, err := rest.BindJSON(r, &req); err != nil {
+//		rest.WriteError(w, code, err.Error())
+//		return
+//	}
+func BindJSON(r *http.Request, target interface{}) (int, error) {
+	if code, err := ReadJSON(r, target); err != nil {
+		return code, err
+	}
+
+	if err := validation.Default().StructCtx(r.Context(), target); err != nil {
+		return http.StatusBadRequest, errors.New(validation.Message(err))
+	}
+	return http.StatusOK, nil
+}
+
 func DefaultBadRequestHandler(w http.ResponseWriter, _ *http.Request, err error) {
 	WriteError(w, http.StatusBadRequest, err.Error())
 }
 
+// errCodeFromHttp returns the Message code of WriteError. the mapping is kept as is for existing
+// clients, use WriteErr with an errs code for other codes.
 func errCodeFromHttp(code int) string {
 	codeMap := map[int]string{
 		http.StatusBadRequest:          "ErrBadRequest",
@@ -189,35 +354,83 @@ func errCodeFromHttp(code int) string {
 	if c, ok := codeMap[code]; ok {
 		return c
 	}
-
 	return "ErrInternalServer"
 }
 
+// RequestLogger logs every request with its status and latency. for server errors the error passed to
+// WriteErr is logged with its chain of causes and stack trace, and panics of handlers are recovered,
+// logged with their stack and answered with 500. latency is measured with the clock of the request
+// context. the RequestMeta of GatewayMeta used before it is logged too, as are the trace and span ids
+// of the span started by Tracing.
 func RequestLogger(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			path := r.URL.Path
 			method := r.Method
 			query := r.URL.RawQuery
-			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-			t0 := time.Now()
-			next.ServeHTTP(ww, r)
-			latency := time.Since(t0)
-
-			logFunc := logger.Info
-			if ww.Status() >= http.StatusInternalServerError {
-				logFunc = logger.Error
-			}
-
-			logFunc(fmt.Sprintf("request handled: %s %s", method, path),
-				zap.Int("code", ww.Status()),
-				zap.String("query", query),
-				zap.Duration("latency", latency))
+			ww := &errorWriter{WrapResponseWriter: middleware.NewWrapResponseWriter(w, r.ProtoMajor)}
+
+			clk := clock.FromContext(r.Context())
+			t0 := clk.Now()
+			defer func() {
+				panicked := false
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					panicked = true
+					stack := debug.Stack()
+					ww.err = &group.PanicError{Value: rec, Stack: stack}
+					diag.RecordPanic(method+" "+path, rec, stack)
+					if ww.Status() == 0 {
+						WriteError(ww, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+					}
+				}
+				latency := clk.Since(t0)
+
+				logFunc := logger.Info
+				fields := []zap.Field{
+					zap.Int("code", ww.Status()),
+					zap.String("query", query),
+					zap.Duration("latency", latency),
+				}
+				if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+					fields = append(fields, zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
+				}
+				if meta, ok := RequestMetaFrom(r.Context()); ok {
+					fields = append(fields, zap.Object("meta", meta))
+				}
+				if ww.Status() >= http.StatusInternalServerError || panicked {
+					logFunc = logger.Error
+					fields = append(fields, goxlog.Err(ww.err))
+				}
+
+				logFunc(fmt.Sprintf("request handled: %s %s", method, path), fields...)
+			}()
+			next.ServeHTTP(ww.withOptional(w), r)
 		})
 	}
 }
 
+// logRoutes logs the routes of router sorted by pattern.
+func logRoutes(router chi.Routes, logger *zap.Logger) {
+	type route struct{ method, pattern string }
+	var routes []route
+	_ = chi.Walk(router, func(method, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, route{method, pattern})
+		return nil
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].pattern != routes[j].pattern {
+			return routes[i].pattern < routes[j].pattern
+		}
+		return routes[i].method < routes[j].method
+	})
+	for _, r := range routes {
+		logger.Info("route", zap.String("method", r.method), zap.String("pattern", r.pattern))
+	}
+}
+
 func DefaultCorsOption() cors.Options {
 	return cors.Options{
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -228,6 +441,21 @@ func DefaultCorsOption() cors.Options {
 	}
 }
 
+// DevCorsOption allows any origin on localhost, like the dev servers of web frontends.
+func DevCorsOption() cors.Options {
+	opts := DefaultCorsOption()
+	opts.AllowOriginFunc = func(_ *http.Request, origin string) bool {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	opts.AllowedHeaders = []string{"*"}
+	return opts
+}
+
 func DefaultMiddlewares() []func(next http.Handler) http.Handler {
 	return []func(next http.Handler) http.Handler{
 		middleware.Timeout(60 * time.Second),
@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBindJSON(t *testing.T) {
+	type request struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	{ // valid request
+		var req request
+		code, err := BindJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "foo@example.com"}`)), &req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "foo@example.com", req.Email)
+	}
+
+	{ // invalid field
+		var req request
+		code, err := BindJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "foo"}`)), &req)
+		require.EqualError(t, err, "Email failed on the 'email' rule")
+		require.Equal(t, http.StatusBadRequest, code)
+	}
+
+	{ // malformed body
+		var req request
+		code, err := BindJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": `)), &req)
+		require.Error(t, err)
+		require.Equal(t, http.StatusBadRequest, code)
+	}
+
+	{ // bodies over the limit of MaxBodySize
+		var code int
+		var err error
+		bind := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req request
+			code, err = BindJSON(r, &req)
+		})
+		handler := MaxBodySize(16)(bind)
+		body := `{"email": "` + strings.Repeat("a", 32) + `@example.com"}`
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		require.EqualError(t, err, "request body must not be larger than 16 bytes")
+		require.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+		// routes can raise the limit of the server
+		handler = MaxBodySize(16)(MaxBodySize(64)(bind))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		require.NoError(t, err)
+	}
+}
+
+func TestWriteErr(t *testing.T) {
+	{ // client errors keep their message
+		w := httptest.NewRecorder()
+		WriteErr(w, errs.WithCode(errors.New("user not found"), errs.CodeNotFound))
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		require.JSONEq(t, `{"code": "ErrNotFound", "message": "user not found"}`, w.Body.String())
+
+		err := ErrorFromResponse(w.Result())
+		require.EqualError(t, err, "user not found")
+		require.Equal(t, errs.CodeNotFound, errs.CodeOf(err))
+	}
+
+	{ // server errors hide their details
+		w := httptest.NewRecorder()
+		WriteErr(w, errors.New("connection refused"))
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+		require.JSONEq(t, `{"code": "ErrInternalServer", "message": "Internal Server Error"}`, w.Body.String())
+	}
+
+	{ // causes of domain errors are not written
+		w := httptest.NewRecorder()
+		WriteErr(w, errs.Invalid("email is taken").Wrap(errors.New("duplicate key")))
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		require.JSONEq(t, `{"code": "ErrBadRequest", "message": "email is taken"}`, w.Body.String())
+	}
+
+	{ // existing codes of WriteError are kept
+		w := httptest.NewRecorder()
+		WriteError(w, http.StatusConflict, "exists")
+		require.JSONEq(t, `{"code": "ErrAlreadyExist", "message": "exists"}`, w.Body.String())
+
+		for _, status := range []int{http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusTooManyRequests} {
+			w := httptest.NewRecorder()
+			WriteError(w, status, "failed")
+			require.JSONEq(t, `{"code": "ErrInternalServer", "message": "failed"}`, w.Body.String())
+		}
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	handler := middleware.NoCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			WriteErr(w, errs.NotFound("user not found"))
+		case "/broken":
+			WriteErr(w, errs.Internal("query user").Wrap(errors.New("connection refused")))
+		case "/panic":
+			panic("boom")
+		}
+	}))
+	handler = RequestLogger(zap.New(core))(handler)
+
+	{ // client errors are logged without the error
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		entry := logs.TakeAll()[0]
+		require.Equal(t, zap.InfoLevel, entry.Level)
+		require.NotContains(t, entry.ContextMap(), "error")
+	}
+
+	{ // server errors are logged with their chain and stack
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/broken", nil))
+		entry := logs.TakeAll()[0]
+		require.Equal(t, zap.ErrorLevel, entry.Level)
+		logged := entry.ContextMap()["error"].(map[string]interface{})
+		require.Equal(t, "Internal", logged["code"])
+		require.Equal(t, []interface{}{"query user", "connection refused"}, logged["chain"])
+		require.Contains(t, logged["stack"], "rest.TestRequestLogger")
+	}
+
+	{ // panics are recovered and logged with their stack
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+		entry := logs.TakeAll()[0]
+		logged := entry.ContextMap()["error"].(map[string]interface{})
+		require.Equal(t, "panic: boom", logged["message"])
+		require.Contains(t, logged["stack"], "runtime/debug.Stack")
+	}
+}
+
+type steppingClock struct {
+	now time.Time
+}
+
+func (c *steppingClock) Now() time.Time { return c.now }
+func (c *steppingClock) Since(t time.Time) time.Duration {
+	c.now = c.now.Add(250 * time.Millisecond)
+	return c.now.Sub(t)
+}
+func (c *steppingClock) After(d time.Duration) <-chan time.Time { return nil }
+
+func TestRequestLoggerInterfaces(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	var hijacker, pusher, readerFrom bool
+	handler := RequestLogger(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hijacker = w.(http.Hijacker)
+		_, pusher = w.(http.Pusher)
+		_, readerFrom = w.(io.ReaderFrom)
+		WriteErr(w, errs.Internal("query user"))
+	}))
+
+	{ // the recorder implements none of them
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		require.False(t, hijacker || pusher || readerFrom)
+		require.Equal(t, "query user", logs.TakeAll()[0].ContextMap()["error"].(map[string]interface{})["message"])
+	}
+
+	{ // http/1 connections can be hijacked and read from, errors are still logged
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		res, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.True(t, hijacker)
+		require.True(t, readerFrom)
+		require.False(t, pusher)
+		require.Equal(t, "query user", logs.TakeAll()[0].ContextMap()["error"].(map[string]interface{})["message"])
+	}
+}
+
+func TestRequestLoggerClock(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	handler := RequestLogger(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(clock.WithContext(r.Context(), &steppingClock{now: time.Now()})))
+	require.Equal(t, 250*time.Millisecond, logs.All()[0].ContextMap()["latency"])
+}
@@ -0,0 +1,216 @@
+package rest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/misc"
+)
+
+const (
+	// DefaultJWKSCacheTTL is how long PublicKeyProvider keeps a fetched key set.
+	DefaultJWKSCacheTTL = time.Hour
+	// DefaultJWKSMinRefresh is how often at most PublicKeyProvider fetches the key set for unknown key ids.
+	DefaultJWKSMinRefresh = time.Minute
+	// DefaultJWKSTimeout is the timeout of the default client fetching the key set.
+	DefaultJWKSTimeout = 10 * time.Second
+)
+
+// ErrUnknownKey is returned by PublicKeyProvider for key ids not in the key set.
+var ErrUnknownKey = errors.New("unknown key id")
+
+// PublicKeyProviderOption configures a PublicKeyProvider.
+type PublicKeyProviderOption func(*PublicKeyProvider)
+
+// WithJWKSCacheTTL sets how long the key set is cached, DefaultJWKSCacheTTL by default.
+func WithJWKSCacheTTL(ttl time.Duration) PublicKeyProviderOption {
+	return func(p *PublicKeyProvider) {
+		p.ttl = ttl
+	}
+}
+
+// WithJWKSClient sets the client fetching the key set, a client with DefaultJWKSTimeout by default.
+func WithJWKSClient(client *http.Client) PublicKeyProviderOption {
+	return func(p *PublicKeyProvider) {
+		p.client = client
+	}
+}
+
+// PublicKeyProvider returns the public keys of the json web key set served at a url, like
+// /.well-known/jwks.json of an identity provider. the set is cached, and fetched again early when a
+// token is signed with an unknown key so rotated keys are picked up, at most every DefaultJWKSMinRefresh
+// so tokens with made up key ids can not flood the issuer. concurrent requests share one fetch, which
+// runs without holding the cache, so cached keys are served while it is in flight.
+type PublicKeyProvider struct {
+	url     string
+	client  *http.Client
+	ttl     time.Duration
+	fetches misc.Coalescer[struct{}, map[string]crypto.PublicKey]
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewPublicKeyProvider returns a provider of the keys at url, fetched on first use.
+// example:
+//
+//	keys := rest.NewPublicKeyProvider("https://auth.example.com/.well-known/jwks.json")
+//	router.Use(rest.JWTAuth(keys, rest.JWTIssuer("https://auth.example.com/")))
+func NewPublicKeyProvider(url string, opts ...PublicKeyProviderOption) *PublicKeyProvider {
+	p := &PublicKeyProvider{url: url, client: &http.Client{Timeout: DefaultJWKSTimeout}, ttl: DefaultJWKSCacheTTL}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// PublicKey returns the key with id kid.
+func (p *PublicKeyProvider) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	now := clock.FromContext(ctx).Now()
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := p.keys == nil || now.Sub(p.fetchedAt) >= p.ttl
+	recent := now.Sub(p.fetchedAt) < DefaultJWKSMinRefresh
+	p.mu.Unlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && recent {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+
+	keys, err, _ := p.fetches.Do(ctx, struct{}{}, func(ctx context.Context) (map[string]crypto.PublicKey, error) {
+		keys, err := p.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.keys, p.fetchedAt = keys, clock.FromContext(ctx).Now()
+		p.mu.Unlock()
+		return keys, nil
+	})
+	if err != nil {
+		if ok {
+			// the cached key is still the best guess while the issuer is unreachable.
+			return key, nil
+		}
+		return nil, err
+	}
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *PublicKeyProvider) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: %s returned status %d", p.url, res.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// keys of unsupported types do not make the others unusable.
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+)
+
+// Claims are the claims of a token verified by JWTAuth.
+type Claims map[string]interface{}
+
+// Subject returns the sub claim, the id of the user the token was issued to.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// String returns the claim name if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+var claimsKey = ctxutil.NewKey[Claims]("jwt claims")
+
+// ClaimsFromContext returns the claims stored by JWTAuth.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	return claimsKey.Get(ctx)
+}
+
+// WithClaimsContext returns a copy of ctx holding c, useful in tests.
+func WithClaimsContext(ctx context.Context, c Claims) context.Context {
+	return claimsKey.Set(ctx, c)
+}
+
+type jwtConfig struct {
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	algorithms []string
+	optional   bool
+}
+
+// JWTOption configures JWTAuth.
+type JWTOption func(*jwtConfig)
+
+// JWTIssuer requires the iss claim of tokens to be iss.
+func JWTIssuer(iss string) JWTOption {
+	return func(c *jwtConfig) {
+		c.issuer = iss
+	}
+}
+
+// JWTAudience requires the aud claim of tokens to contain aud.
+func JWTAudience(aud string) JWTOption {
+	return func(c *jwtConfig) {
+		c.audience = aud
+	}
+}
+
+// JWTLeeway allows for clock skew with the issuer when checking exp and nbf, no leeway by default.
+func JWTLeeway(d time.Duration) JWTOption {
+	return func(c *jwtConfig) {
+		c.leeway = d
+	}
+}
+
+// JWTAlgorithms sets the accepted signing algorithms, RS256 and ES256 by default.
+func JWTAlgorithms(algs ...string) JWTOption {
+	return func(c *jwtConfig) {
+		c.algorithms = algs
+	}
+}
+
+// JWTOptional lets requests without a token through without claims, for routes serving both
+// anonymous and signed in users. invalid tokens are still rejected.
+func JWTOptional() JWTOption {
+	return func(c *jwtConfig) {
+		c.optional = true
+	}
+}
+
+// JWTAuth verifies the bearer token of requests with the keys of provider and stores its claims in
+// the request context, see ClaimsFromContext. requests with a missing, invalid or expired token are
+// answered with 401. tokens must have an exp claim.
+// example:
+//
+//	keys := rest.NewPublicKeyProvider("https://auth.example.com/.well-known/jwks.json")
+//	router.Use(rest.JWTAuth(keys, rest.JWTIssuer("https://auth.example.com/"), rest.JWTAudience("orders")))
+//	router.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+//		claims, _ := rest.ClaimsFromContext(r.Context())
+//		profile, err := users.Get(r.Context(), claims.Subject())
+//		...
+//	})
+func JWTAuth(provider *PublicKeyProvider, opts ...JWTOption) func(http.Handler) http.Handler {
+	cfg := &jwtConfig{algorithms: []string{"RS256", "ES256"}}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			unauthorized := func(msg string) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				WriteError(w, http.StatusUnauthorized, msg)
+			}
+
+			header := r.Header.Get("Authorization")
+			if header == "" && cfg.optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			scheme, raw, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				WriteError(w, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+
+			ctx := r.Context()
+			parserOpts := []jwt.ParserOption{
+				jwt.WithValidMethods(cfg.algorithms),
+				jwt.WithLeeway(cfg.leeway),
+				jwt.WithExpirationRequired(),
+				jwt.WithTimeFunc(clock.FromContext(ctx).Now),
+			}
+			if cfg.issuer != "" {
+				parserOpts = append(parserOpts, jwt.WithIssuer(cfg.issuer))
+			}
+			if cfg.audience != "" {
+				parserOpts = append(parserOpts, jwt.WithAudience(cfg.audience))
+			}
+
+			claims := jwt.MapClaims{}
+			_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+				kid, _ := t.Header["kid"].(string)
+				return provider.PublicKey(ctx, kid)
+			}, parserOpts...)
+			if err != nil {
+				unauthorized("invalid token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClaimsContext(ctx, Claims(claims))))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var fetches int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+			{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer jwks.Close()
+
+	provider := NewPublicKeyProvider(jwks.URL)
+	handler := JWTAuth(provider, JWTIssuer("https://auth.example.com/"), JWTAudience("orders"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			require.True(t, ok)
+			WriteJSON(w, http.StatusOK, claims.Subject())
+		}))
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		require.NoError(t, err)
+		return s
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "user-1",
+			"iss": "https://auth.example.com/",
+			"aud": "orders",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	do := func(authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	{ // tokens signed with keys of the set are accepted
+		w := do("Bearer " + sign(jwt.SigningMethodRS256, "rsa-1", rsaKey, valid()))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "user-1")
+
+		w = do("bearer " + sign(jwt.SigningMethodES256, "ec-1", ecKey, valid()))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	}
+
+	{ // missing and invalid tokens are rejected
+		w := do("")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+		expired := valid()
+		expired["exp"] = time.Now().Add(-time.Minute).Unix()
+		require.Equal(t, http.StatusUnauthorized, do("Bearer "+sign(jwt.SigningMethodRS256, "rsa-1", rsaKey, expired)).Code)
+
+		noExp := valid()
+		delete(noExp, "exp")
+		require.Equal(t, http.StatusUnauthorized, do("Bearer "+sign(jwt.SigningMethodRS256, "rsa-1", rsaKey, noExp)).Code)
+
+		otherAudience := valid()
+		otherAudience["aud"] = "billing"
+		require.Equal(t, http.StatusUnauthorized, do("Bearer "+sign(jwt.SigningMethodRS256, "rsa-1", rsaKey, otherAudience)).Code)
+
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, do("Bearer "+sign(jwt.SigningMethodRS256, "rsa-1", otherKey, valid())).Code)
+
+		w = do("Bearer " + sign(jwt.SigningMethodHS256, "secret", []byte("secret"), valid()))
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+	}
+
+	{ // unknown key ids do not refetch the set right away
+		before := atomic.LoadInt32(&fetches)
+		for i := 0; i < 3; i++ {
+			require.Equal(t, http.StatusUnauthorized, do("Bearer "+sign(jwt.SigningMethodRS256, "rotated", rsaKey, valid())).Code)
+		}
+		require.Equal(t, before, atomic.LoadInt32(&fetches))
+	}
+
+	{ // optional auth lets anonymous requests through
+		handler := JWTAuth(provider, JWTOptional())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := ClaimsFromContext(r.Context())
+			require.False(t, ok)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusNoContent, w.Code)
+	}
+}
+
+func TestPublicKeyProviderFetch(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	var fetches int32
+	release := make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(key.X.Bytes()), "y": b64(key.Y.Bytes())},
+		}})
+	}))
+	defer jwks.Close()
+
+	c := goxtest.NewFakeClock(time.Now())
+	ctx := clock.WithContext(context.Background(), c)
+	provider := NewPublicKeyProvider(jwks.URL)
+	_, err = provider.PublicKey(ctx, "ec-1")
+	require.NoError(t, err)
+
+	// unknown keys share one fetch, cached keys are served while it runs
+	c.Advance(2 * DefaultJWKSMinRefresh)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.PublicKey(ctx, "rotated")
+			require.ErrorIs(t, err, ErrUnknownKey)
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&fetches) == 2 }, time.Second, time.Millisecond)
+
+	got, err := provider.PublicKey(ctx, "ec-1")
+	require.NoError(t, err)
+	require.Equal(t, &key.PublicKey, got)
+
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
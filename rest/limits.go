@@ -0,0 +1,32 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+)
+
+// MaxBodySize limits request bodies to n bytes, reading past it fails and ReadJSON and BindJSON return
+// 413 Payload Too Large for it. WithMaxBodySize adds it for RunHttpServer, routes taking uploads can
+// set a larger limit of their own, which replaces the one of the server.
+// example:
+//
+//	router.With(rest.MaxBodySize(50 << 20)).Post("/uploads", upload)
+func MaxBodySize(n int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := r.Body
+			if l, ok := body.(*limitedBody); ok {
+				body = l.body
+			}
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, body, n), body: body}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody keeps the body a limit was set on, so a later MaxBodySize replaces the limit instead of
+// only lowering it.
+type limitedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mirzakhany/gox/ctxutil"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestMeta holds what gateways in front of the service tell about a request: the trace it belongs
+// to, the authenticated user and organization and, behind Cloudflare, where the client is.
+type RequestMeta struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+
+	UserID string
+	OrgID  string
+
+	ClientIP  string
+	Country   string
+	Region    string
+	City      string
+	Latitude  float64
+	Longitude float64
+	RayID     string
+}
+
+var requestMetaKey = ctxutil.NewKey[*RequestMeta]("request meta")
+
+// RequestMetaFrom returns the RequestMeta stored by GatewayMeta.
+func RequestMetaFrom(ctx context.Context) (*RequestMeta, bool) {
+	return requestMetaKey.Get(ctx)
+}
+
+// WithRequestMetaContext returns a copy of ctx holding m, useful in tests and background jobs.
+func WithRequestMetaContext(ctx context.Context, m *RequestMeta) context.Context {
+	return requestMetaKey.Set(ctx, m)
+}
+
+// GatewayMeta parses gateway headers into a RequestMeta stored in the request context. RequestLogger
+// logs it when it is used before the logger, which WithRequestMeta does for RunHttpServer.
+// the headers are trusted as they are, so it must only be used behind a gateway which sets or strips them.
+// example:
+//
+//	router.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+//		meta, _ := rest.RequestMetaFrom(r.Context())
+//		profile, err := users.Get(r.Context(), meta.UserID)
+//		...
+//	})
+func GatewayMeta(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequestMetaContext(r.Context(), ParseRequestMeta(r))))
+	})
+}
+
+// ParseRequestMeta reads RequestMeta from the headers of r. the trace is taken from traceparent,
+// then the b3 single header, then the X-B3-* headers, whichever holds valid ids first.
+func ParseRequestMeta(r *http.Request) *RequestMeta {
+	h := r.Header
+	m := &RequestMeta{
+		UserID:   h.Get("X-User-ID"),
+		OrgID:    h.Get("X-Org-ID"),
+		ClientIP: h.Get("CF-Connecting-IP"),
+		Country:  h.Get("CF-IPCountry"),
+		Region:   h.Get("CF-Region"),
+		City:     h.Get("CF-IPCity"),
+		RayID:    h.Get("CF-Ray"),
+	}
+	m.Latitude, _ = strconv.ParseFloat(h.Get("CF-IPLatitude"), 64)
+	m.Longitude, _ = strconv.ParseFloat(h.Get("CF-IPLongitude"), 64)
+
+	switch {
+	case parseTraceparent(m, h.Get("traceparent")):
+	case parseB3(m, h.Get("b3")):
+	case isHexID(h.Get("X-B3-TraceId"), 16, 32) && isHexID(h.Get("X-B3-SpanId"), 16):
+		m.TraceID = h.Get("X-B3-TraceId")
+		m.SpanID = h.Get("X-B3-SpanId")
+		m.Sampled = h.Get("X-B3-Sampled") == "1" || h.Get("X-B3-Flags") == "1"
+	}
+	return m
+}
+
+// parseTraceparent parses a w3c trace context header like 00-{trace id}-{span id}-{flags}.
+func parseTraceparent(m *RequestMeta, v string) bool {
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" || !isHexID(parts[1], 32) || !isHexID(parts[2], 16) {
+		return false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || !isHex(parts[3], 2) {
+		return false
+	}
+	m.TraceID, m.SpanID, m.Sampled = parts[1], parts[2], flags&1 == 1
+	return true
+}
+
+// parseB3 parses the b3 single header like {trace id}-{span id}-{sampled}-{parent span id}.
+func parseB3(m *RequestMeta, v string) bool {
+	parts := strings.Split(v, "-")
+	if len(parts) < 2 || !isHexID(parts[0], 16, 32) || !isHexID(parts[1], 16) {
+		return false
+	}
+	m.TraceID, m.SpanID = parts[0], parts[1]
+	m.Sampled = len(parts) > 2 && (parts[2] == "1" || parts[2] == "d")
+	return true
+}
+
+// isHexID reports if id is lower case hex of one of lengths and not all zeros, like trace and span ids.
+func isHexID(id string, lengths ...int) bool {
+	for _, n := range lengths {
+		if isHex(id, n) {
+			return strings.Trim(id, "0") != ""
+		}
+	}
+	return false
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalLogObject adds the fields which are set to enc, so RequestMeta can be logged with zap.Object.
+func (m *RequestMeta) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range []struct{ key, value string }{
+		{"trace_id", m.TraceID},
+		{"span_id", m.SpanID},
+		{"user_id", m.UserID},
+		{"org_id", m.OrgID},
+		{"client_ip", m.ClientIP},
+		{"country", m.Country},
+		{"region", m.Region},
+		{"city", m.City},
+		{"ray_id", m.RayID},
+	} {
+		if f.value != "" {
+			enc.AddString(f.key, f.value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseRequestMeta(t *testing.T) {
+	{ // traceparent and cloudflare headers
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		r.Header.Set("X-User-ID", "u1")
+		r.Header.Set("X-Org-ID", "o1")
+		r.Header.Set("CF-IPCountry", "NL")
+		r.Header.Set("CF-IPLatitude", "52.37")
+
+		m := ParseRequestMeta(r)
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", m.TraceID)
+		require.Equal(t, "00f067aa0ba902b7", m.SpanID)
+		require.True(t, m.Sampled)
+		require.Equal(t, "u1", m.UserID)
+		require.Equal(t, "o1", m.OrgID)
+		require.Equal(t, "NL", m.Country)
+		require.Equal(t, 52.37, m.Latitude)
+	}
+
+	{ // b3 single header
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0")
+		m := ParseRequestMeta(r)
+		require.Equal(t, "80f198ee56343ba864fe8b2a57d3eff7", m.TraceID)
+		require.Equal(t, "e457b5a2e4d86bd1", m.SpanID)
+		require.False(t, m.Sampled)
+	}
+
+	{ // b3 multi headers, malformed traceparent is ignored
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("traceparent", "garbage")
+		r.Header.Set("X-B3-TraceId", "463ac35c9f6413ad")
+		r.Header.Set("X-B3-SpanId", "a2fb4a1d1a96d312")
+		r.Header.Set("X-B3-Sampled", "1")
+		m := ParseRequestMeta(r)
+		require.Equal(t, "463ac35c9f6413ad", m.TraceID)
+		require.Equal(t, "a2fb4a1d1a96d312", m.SpanID)
+		require.True(t, m.Sampled)
+	}
+
+	{ // ids which are not hex of the right length are dropped
+		for _, h := range []map[string]string{
+			{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01"},
+			{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+			{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01"},
+			{"b3": "<script>-e457b5a2e4d86bd1-1"},
+			{"b3": "80f198ee56343ba8-E457B5A2E4D86BD1"},
+			{"X-B3-TraceId": "463ac35c9f6413ad463", "X-B3-SpanId": "a2fb4a1d1a96d312"},
+		} {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range h {
+				r.Header.Set(k, v)
+			}
+			m := ParseRequestMeta(r)
+			require.Empty(t, m.TraceID, h)
+			require.Empty(t, m.SpanID, h)
+		}
+	}
+}
+
+func TestGatewayMeta(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	var userID string
+	handler := GatewayMeta(RequestLogger(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta, ok := RequestMetaFrom(r.Context())
+		require.True(t, ok)
+		userID = meta.UserID
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User-ID", "u1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Equal(t, "u1", userID)
+	require.Equal(t, map[string]interface{}{"user_id": "u1"}, logs.All()[0].ContextMap()["meta"])
+}
@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultMetricsPath is where WithMetricsHandler serves the metrics.
+const DefaultMetricsPath = "/metrics"
+
+// unmatchedRoute labels requests no route matched, so unknown paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+// HTTPMetrics records the gox_http_requests_total counter, the gox_http_request_duration_seconds and
+// gox_http_response_size_bytes histograms labeled by method, route pattern and status, and the
+// gox_http_requests_in_flight gauge.
+type HTTPMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// NewHTTPMetrics registers the metrics with reg, servers registering with the same reg share them.
+// WithMetrics adds its Middleware for RunHttpServer.
+// example:
+//
+//	m, err := rest.NewHTTPMetrics(prometheus.DefaultRegisterer)
+//	...
+//	router.Use(m.Middleware)
+func NewHTTPMetrics(reg prometheus.Registerer) (*HTTPMetrics, error) {
+	labels := []string{"method", "route", "status"}
+	m := &HTTPMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "http", Name: "requests_total",
+			Help: "Number of handled requests.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metrics.Namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Time spent handling requests.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metrics.Namespace, Subsystem: "http", Name: "response_size_bytes",
+			Help:    "Size of response bodies.",
+			Buckets: prometheus.ExponentialBuckets(128, 4, 8),
+		}, labels),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "http", Name: "requests_in_flight",
+			Help: "Number of requests being handled.",
+		}),
+	}
+
+	var err error
+	if m.requests, err = metrics.Register(reg, m.requests); err != nil {
+		return nil, err
+	}
+	if m.duration, err = metrics.Register(reg, m.duration); err != nil {
+		return nil, err
+	}
+	if m.size, err = metrics.Register(reg, m.size); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = metrics.Register(reg, m.inFlight); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Middleware records the requests, it must be used on the router so the route pattern is known once
+// the request is handled.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.duration.With(labels).Observe(time.Since(start).Seconds())
+		m.size.With(labels).Observe(float64(ww.BytesWritten()))
+	})
+}
+
+// MetricsHandler serves the metrics of g in the prometheus format.
+func MetricsHandler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
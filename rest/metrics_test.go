@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWithMetrics(t *testing.T) {
+	createHandler := func(router chi.Router) http.Handler {
+		// handlers may add middlewares before their routes
+		router.Use(func(next http.Handler) http.Handler { return next })
+		router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			WriteJSON(w, http.StatusOK, chi.URLParam(r, "id"))
+		})
+		return router
+	}
+	get := func(url string) (int, string) {
+		res, err := http.Get(url)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+	ctx := context.Background()
+
+	{ // requests are labeled by route pattern, metrics are served on the router
+		reg := prometheus.NewRegistry()
+		srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithHandler(createHandler),
+			WithMetrics(reg), WithMetricsHandler(reg, ""))
+		require.NoError(t, err)
+		require.NoError(t, srv.Start(ctx))
+		defer srv.Shutdown(ctx)
+
+		get("http://" + srv.Addr() + "/users/1")
+		get("http://" + srv.Addr() + "/users/2")
+		get("http://" + srv.Addr() + "/missing")
+
+		err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP gox_http_requests_total Number of handled requests.
+# TYPE gox_http_requests_total counter
+gox_http_requests_total{method="GET",route="/users/{id}",status="200"} 2
+gox_http_requests_total{method="GET",route="unmatched",status="404"} 1
+# HELP gox_http_requests_in_flight Number of requests being handled.
+# TYPE gox_http_requests_in_flight gauge
+gox_http_requests_in_flight 0
+`), "gox_http_requests_total", "gox_http_requests_in_flight")
+		require.NoError(t, err)
+
+		code, body := get("http://" + srv.Addr() + DefaultMetricsPath)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `gox_http_request_duration_seconds_count{method="GET",route="/users/{id}",status="200"} 2`)
+	}
+
+	{ // metrics on a separate port
+		reg := prometheus.NewRegistry()
+		port := freePort(t)
+		srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithHandler(createHandler),
+			WithMetrics(reg), WithMetricsHandler(reg, port))
+		require.NoError(t, err)
+		require.NoError(t, srv.Start(ctx))
+
+		get("http://" + srv.Addr() + "/users/1")
+		code, _ := get("http://" + srv.Addr() + DefaultMetricsPath)
+		require.Equal(t, http.StatusNotFound, code)
+		code, body := get("http://127.0.0.1:" + port + DefaultMetricsPath)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `gox_http_requests_total{method="GET",route="/users/{id}",status="200"} 1`)
+
+		require.NoError(t, srv.Shutdown(ctx))
+		_, err = http.Get("http://127.0.0.1:" + port + DefaultMetricsPath)
+		require.Error(t, err)
+	}
+}
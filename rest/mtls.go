@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+
+	"github.com/mirzakhany/gox/ctxutil"
+)
+
+// ClientIdentity describes the verified certificate a client presented over mutual tls.
+type ClientIdentity struct {
+	Subject  pkix.Name
+	DNSNames []string
+	// URIs holds the uri names of the certificate, like the spiffe id of a workload
+	URIs        []string
+	Certificate *x509.Certificate
+}
+
+var clientIdentityKey = ctxutil.NewKey[*ClientIdentity]("client identity")
+
+// ClientIdentityFrom returns the ClientIdentity stored by ClientCertificate.
+func ClientIdentityFrom(ctx context.Context) (*ClientIdentity, bool) {
+	return clientIdentityKey.Get(ctx)
+}
+
+// WithClientIdentityContext returns a copy of ctx holding id, useful in tests.
+func WithClientIdentityContext(ctx context.Context, id *ClientIdentity) context.Context {
+	return clientIdentityKey.Set(ctx, id)
+}
+
+// ClientCertificate stores the identity of the verified client certificate of the request in its
+// context, requests without one are passed on as they are. WithMTLS adds it for RunHttpServer.
+// certificates which were not verified against the client CAs are ignored.
+// example:
+//
+//	router.With(rest.ClientCertificate).Post("/internal/jobs", func(w http.ResponseWriter, r *http.Request) {
+//		id, ok := rest.ClientIdentityFrom(r.Context())
+//		if !ok || id.Subject.CommonName != "scheduler" {
+//			rest.WriteError(w, http.StatusForbidden, "unknown client")
+//			return
+//		}
+//		...
+//	})
+func ClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		id := &ClientIdentity{Subject: cert.Subject, DNSNames: cert.DNSNames, Certificate: cert}
+		for _, u := range cert.URIs {
+			id.URIs = append(id.URIs, u.String())
+		}
+		next.ServeHTTP(w, r.WithContext(WithClientIdentityContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newClientCert returns a client certificate for name signed by a new CA, and the pool of the CA.
+func newClientCert(t *testing.T, name string) (tls.Certificate, *x509.CertPool) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDer)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"gox"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestWithMTLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	clientCert, pool := newClientCert(t, "scheduler")
+	otherCert, _ := newClientCert(t, "intruder")
+
+	{ // invalid options
+		require.Error(t, WithMTLS(nil, tls.RequireAndVerifyClientCert)(&config{}))
+		_, err := New(WithMTLS(pool, tls.RequireAndVerifyClientCert))
+		require.Error(t, err)
+	}
+
+	srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithTLS(certFile, keyFile),
+		WithMTLS(pool, tls.VerifyClientCertIfGiven), WithHandler(func(router chi.Router) http.Handler {
+			router.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+				id, ok := ClientIdentityFrom(r.Context())
+				if !ok {
+					WriteError(w, http.StatusUnauthorized, "no client certificate")
+					return
+				}
+				WriteJSON(w, http.StatusOK, id.Subject.CommonName)
+			})
+			return router
+		}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, srv.Start(ctx))
+	defer srv.Shutdown(ctx)
+
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       certs,
+		}}}
+		res, err := client.Get("https://" + srv.Addr() + "/whoami")
+		if err == nil {
+			res.Body.Close()
+		}
+		return res, err
+	}
+
+	{ // verified clients are identified
+		res, err := get(clientCert)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	{ // clients without a certificate are allowed by the policy but not identified
+		res, err := get()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	{ // certificates of other CAs are rejected in the handshake
+		_, err := get(otherCert)
+		require.Error(t, err)
+	}
+}
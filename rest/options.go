@@ -1,32 +1,84 @@
 package rest
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 const (
 	DefaultGracefulShutdownSec = 5
 
 	DefaultPort = "8080"
+
+	DefaultAutoTLSChallengePort = "80"
 )
 
 type config struct {
-	port        string
-	middlewares []func(next http.Handler) http.Handler
+	port          string
+	listener      net.Listener
+	unixSocket    string
+	createHandler func(router chi.Router) http.Handler
+	middlewares   []func(next http.Handler) http.Handler
 
 	allowedHosts []string
+	maxBodySize  int64
+	rateLimit    *RateLimitOptions
 
 	setCors     bool
 	corsOptions cors.Options
 
 	logger *zap.Logger
+
+	gracefulRestart bool
+
+	requestMeta bool
+	envelope    bool
+	errorPages  *template.Template
+
+	autoTLS              *autocert.Manager
+	autoTLSChallengePort string
+
+	logRoutes bool
+	h2c       bool
+
+	tlsCertFile string
+	tlsKeyFile  string
+	tlsConfig   *tls.Config
+
+	metrics         prometheus.Registerer
+	metricsGatherer prometheus.Gatherer
+	metricsPort     string
+
+	tracerProvider trace.TracerProvider
+
+	clientCAs  *x509.CertPool
+	clientAuth tls.ClientAuthType
 }
 
 type Option func(*config) error
 
+// WithHandler sets the function creating the handler of the server from the router with the
+// middlewares of the options, the router itself by default.
+func WithHandler(createHandler func(router chi.Router) http.Handler) Option {
+	return func(c *config) error {
+		c.createHandler = createHandler
+		return nil
+	}
+}
+
+// WithPort sets the port to listen on, "0" picks a free one which Server.Addr tells.
 func WithPort(port string) Option {
 	return func(c *config) error {
 		c.port = port
@@ -34,6 +86,35 @@ func WithPort(port string) Option {
 	}
 }
 
+// WithListener serves on ln instead of listening on the port, for listeners created by the caller like
+// the ones passed by systemd socket activation. the server closes it on Shutdown.
+// example:
+//
+//	ln, err := net.FileListener(os.NewFile(3, "systemd"))
+//	...
+//	srv, err := rest.New(rest.WithHandler(setupRouter), rest.WithListener(ln))
+func WithListener(ln net.Listener) Option {
+	return func(c *config) error {
+		if ln == nil {
+			return errors.New("listener must not be nil")
+		}
+		c.listener = ln
+		return nil
+	}
+}
+
+// WithUnixSocket listens on the unix domain socket at path instead of the port. a socket left at path
+// by a previous run is removed, any other file there fails the start.
+func WithUnixSocket(path string) Option {
+	return func(c *config) error {
+		if path == "" {
+			return errors.New("unix socket path must not be empty")
+		}
+		c.unixSocket = path
+		return nil
+	}
+}
+
 func WithMiddlewares(middlewares []func(next http.Handler) http.Handler) Option {
 	return func(c *config) error {
 		c.middlewares = middlewares
@@ -41,6 +122,8 @@ func WithMiddlewares(middlewares []func(next http.Handler) http.Handler) Option
 	}
 }
 
+// WithAllowedHosts rejects requests for hosts which are not in allowedHosts, see AllowedHosts for the
+// matching and wildcards like "*.example.com". all hosts are allowed by default.
 func WithAllowedHosts(allowedHosts []string) Option {
 	return func(c *config) error {
 		c.allowedHosts = allowedHosts
@@ -48,6 +131,33 @@ func WithAllowedHosts(allowedHosts []string) Option {
 	}
 }
 
+// WithRateLimit limits the request rate of clients, see RateLimit. store errors are logged with the
+// logger of the server unless opts has its own. clients are told apart by ClientIPKey by default,
+// which needs a trusted proxy in front of the server.
+// example:
+//
+//	rest.RunHttpServer(ctx, createHandler, rest.WithRateLimit(rest.RateLimitOptions{Rate: 10, Burst: 20}))
+func WithRateLimit(opts RateLimitOptions) Option {
+	return func(c *config) error {
+		if opts.Rate <= 0 {
+			return errors.New("rate limit must be positive")
+		}
+		c.rateLimit = &opts
+		return nil
+	}
+}
+
+// WithMaxBodySize limits request bodies to n bytes, see MaxBodySize. bodies are not limited by default.
+func WithMaxBodySize(n int64) Option {
+	return func(c *config) error {
+		if n <= 0 {
+			return errors.New("max body size must be positive")
+		}
+		c.maxBodySize = n
+		return nil
+	}
+}
+
 func WithCoreOptions(corsOptions cors.Options) Option {
 	return func(c *config) error {
 		c.corsOptions = corsOptions
@@ -63,3 +173,180 @@ func WithZapLogger(logger *zap.Logger) Option {
 	}
 }
 
+// WithRouteLogging logs the method and pattern of every route at startup.
+func WithRouteLogging() Option {
+	return func(c *config) error {
+		c.logRoutes = true
+		return nil
+	}
+}
+
+// WithH2C serves HTTP/2 without tls, for grpc-web and internal HTTP/2 clients talking to the server
+// without a tls terminating proxy in front. HTTP/1 clients keep working, tls servers ignore it as they
+// negotiate HTTP/2 on their own.
+func WithH2C() Option {
+	return func(c *config) error {
+		c.h2c = true
+		return nil
+	}
+}
+
+// WithMetrics records the requests of the server with reg, see HTTPMetrics.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(c *config) error {
+		c.metrics = reg
+		return nil
+	}
+}
+
+// WithMetricsHandler serves the metrics of g at DefaultMetricsPath, on the router when port is empty and
+// on a separate server listening on port otherwise, which keeps them off the public port.
+// example:
+//
+//	rest.RunHttpServer(ctx, createHandler,
+//		rest.WithMetrics(prometheus.DefaultRegisterer),
+//		rest.WithMetricsHandler(prometheus.DefaultGatherer, "9090"))
+func WithMetricsHandler(g prometheus.Gatherer, port string) Option {
+	return func(c *config) error {
+		if g == nil {
+			return errors.New("metrics gatherer must not be nil")
+		}
+		c.metricsGatherer, c.metricsPort = g, port
+		return nil
+	}
+}
+
+// WithTracing starts a span with tp for each request, see Tracing. the request logger logs its ids.
+// example:
+//
+//	rest.RunHttpServer(ctx, createHandler, rest.WithTracing(otel.GetTracerProvider()))
+func WithTracing(tp trace.TracerProvider) Option {
+	return func(c *config) error {
+		if tp == nil {
+			return errors.New("tracer provider must not be nil")
+		}
+		c.tracerProvider = tp
+		return nil
+	}
+}
+
+// WithRequestMeta parses gateway headers into a RequestMeta for each request, see GatewayMeta.
+// it is logged by the request logger too.
+func WithRequestMeta() Option {
+	return func(c *config) error {
+		c.requestMeta = true
+		return nil
+	}
+}
+
+// WithEnvelope wraps the json responses of the service in an Envelope, see EnvelopeResponses.
+func WithEnvelope() Option {
+	return func(c *config) error {
+		c.envelope = true
+		return nil
+	}
+}
+
+// WithHTMLErrors renders errors as html pages from templates for browsers, see HTMLErrors. requests
+// no route matches are answered with the 404 page too.
+func WithHTMLErrors(templates *template.Template) Option {
+	return func(c *config) error {
+		if templates == nil {
+			return errors.New("error page templates must not be nil")
+		}
+		c.errorPages = templates
+		return nil
+	}
+}
+
+// WithGracefulRestart enables zero downtime restarts: on SIGUSR2 the server starts a new instance of
+// the binary, hands over its listener and shuts down gracefully once the new instance serves, see
+// Upgrade. not supported on windows.
+func WithGracefulRestart() Option {
+	return func(c *config) error {
+		c.gracefulRestart = true
+		return nil
+	}
+}
+
+// WithAutoTLS serves https using certificates issued by let's encrypt for domains, cached in cacheDir.
+// a second server is started on port 80 to answer http-01 challenges and redirect plain http to https,
+// so the server must be reachable from the internet on both ports.
+func WithAutoTLS(domains []string, cacheDir string) Option {
+	return WithAutoTLSManager(&autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+	})
+}
+
+// WithAutoTLSManager is like WithAutoTLS with a custom autocert manager, for example to store
+// certificates in postgres using certs.NewPgCache so all instances share them.
+func WithAutoTLSManager(m *autocert.Manager) Option {
+	return func(c *config) error {
+		if m.Cache == nil {
+			return errors.New("auto tls requires a certificate cache, otherwise certificates are issued on every start")
+		}
+		c.autoTLS = m
+		if c.autoTLSChallengePort == "" {
+			c.autoTLSChallengePort = DefaultAutoTLSChallengePort
+		}
+		return nil
+	}
+}
+
+// WithAutoTLSChallengePort changes the port answering http-01 challenges, when port 80 is forwarded to another one.
+func WithAutoTLSChallengePort(port string) Option {
+	return func(c *config) error {
+		c.autoTLSChallengePort = port
+		return nil
+	}
+}
+
+// WithTLS serves https with the certificate and key of the pem files, which are checked right away so
+// a bad path fails the start instead of the first handshake.
+func WithTLS(certFile, keyFile string) Option {
+	return func(c *config) error {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return fmt.Errorf("load tls certificate: %w", err)
+		}
+		c.tlsCertFile, c.tlsKeyFile = certFile, keyFile
+		return nil
+	}
+}
+
+// WithTLSConfig serves https with conf, which must hold the certificates unless WithTLS is given too.
+// example:
+//
+//	rest.RunHttpServer(ctx, createHandler, rest.WithTLSConfig(&tls.Config{
+//		MinVersion:     tls.VersionTLS13,
+//		GetCertificate: reloader.GetCertificate,
+//	}))
+func WithTLSConfig(conf *tls.Config) Option {
+	return func(c *config) error {
+		if conf == nil {
+			return errors.New("tls config must not be nil")
+		}
+		c.tlsConfig = conf
+		return nil
+	}
+}
+
+// WithMTLS verifies client certificates against clientCAs according to policy, like
+// tls.RequireAndVerifyClientCert, and stores the identity of verified ones in the request context, see
+// ClientCertificate. it needs WithTLS, WithTLSConfig or WithAutoTLS.
+// example:
+//
+//	pool := x509.NewCertPool()
+//	pool.AppendCertsFromPEM(caPEM)
+//	rest.RunHttpServer(ctx, createHandler, rest.WithTLS(certFile, keyFile),
+//		rest.WithMTLS(pool, tls.RequireAndVerifyClientCert))
+func WithMTLS(clientCAs *x509.CertPool, policy tls.ClientAuthType) Option {
+	return func(c *config) error {
+		if clientCAs == nil && (policy == tls.VerifyClientCertIfGiven || policy == tls.RequireAndVerifyClientCert) {
+			return errors.New("client CAs are required to verify client certificates")
+		}
+		c.clientCAs, c.clientAuth = clientCAs, policy
+		return nil
+	}
+}
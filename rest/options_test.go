@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func writeTestCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func freePort(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestWithTLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	{ // missing files fail right away
+		require.Error(t, WithTLS(certFile, "missing.key")(&config{}))
+		require.Error(t, WithTLSConfig(nil)(&config{}))
+	}
+
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- RunHttpServer(ctx, func(router chi.Router) http.Handler {
+			router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				WriteJSON(w, http.StatusOK, r.TLS != nil)
+			})
+			return router
+		}, WithPort(port), WithZapLogger(zap.NewNop()), WithTLS(certFile, keyFile), WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS13}))
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	var res *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		res, err = client.Get("https://127.0.0.1:" + port + "/")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, uint16(tls.VersionTLS13), res.TLS.Version)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestWithAutoTLS(t *testing.T) {
+	// a cached certificate is served without talking to let's encrypt
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	cache := autocert.DirCache(t.TempDir())
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	require.NoError(t, cache.Put(context.Background(), "example.com", data))
+
+	challengePort := freePort(t)
+	srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithAutoTLSChallengePort(challengePort),
+		WithAutoTLSManager(&autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist("example.com"),
+			Cache:      cache,
+		}))
+	require.NoError(t, err)
+	require.NoError(t, srv.Start(context.Background()))
+	defer srv.Shutdown(context.Background())
+
+	{ // https uses the cached certificate
+		conn, err := tls.Dial("tcp", srv.Addr(), &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+		certs := conn.ConnectionState().PeerCertificates
+		require.NotEmpty(t, certs)
+		require.Equal(t, "example.com", certs[0].Subject.CommonName)
+	}
+
+	{ // plain http on the challenge port redirects to https
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		var res *http.Response
+		require.Eventually(t, func() bool {
+			req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+challengePort+"/path", nil)
+			require.NoError(t, err)
+			req.Host = "example.com"
+			res, err = client.Do(req)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		require.Equal(t, "https://example.com/path", res.Header.Get("Location"))
+	}
+}
+
+func TestRunHttpServerErrors(t *testing.T) {
+	handler := func(router chi.Router) http.Handler { return router }
+	logger := WithZapLogger(zap.NewNop())
+
+	{ // invalid options
+		err := RunHttpServer(context.Background(), handler, logger, WithTLS("missing.crt", "missing.key"))
+		require.ErrorContains(t, err, "load tls certificate")
+
+		err = RunHttpServer(context.Background(), handler, logger, WithAutoTLS([]string{"example.com"}, t.TempDir()),
+			WithTLSConfig(&tls.Config{}))
+		require.Error(t, err)
+	}
+
+	{ // ports in use
+		ln, err := net.Listen("tcp", ":0")
+		require.NoError(t, err)
+		defer ln.Close()
+		port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+		err = RunHttpServer(context.Background(), handler, logger, WithPort(port))
+		require.ErrorContains(t, err, "start http server")
+	}
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/mirzakhany/gox/pii"
+)
+
+// MaskPII masks the fields tagged with pii in responses written with WriteJSON, unless privileged
+// returns true for the request, like for support staff. privileged may be nil to mask for everyone.
+// example:
+//
+//	router.Use(rest.MaskPII(func(r *http.Request) bool {
+//		return hasRole(r.Context(), "support")
+//	}))
+func MaskPII(privileged func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if privileged != nil && privileged(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(&piiWriter{wrappedWriter: wrappedWriter{w}}, r)
+		})
+	}
+}
+
+type piiWriter struct {
+	wrappedWriter
+}
+
+// MaskRows masks the cells of rows whose column, named by headers, has a kind in kinds, so exports
+// follow the pii tags of the model.
+// example:
+//
+//	rows := rest.MaskRows(headers, pii.Columns(User{}), store.RowIterator(pgRows))
+//	err := rest.WriteCSV(w, "users.csv", headers, rows)
+func MaskRows(headers []string, kinds map[string]string, rows RowIterator) RowIterator {
+	masked := make([]string, len(headers))
+	masking := false
+	for i, h := range headers {
+		masked[i] = kinds[h]
+		masking = masking || masked[i] != ""
+	}
+	if !masking {
+		return rows
+	}
+
+	return func() ([]string, error) {
+		row, err := rows()
+		if err != nil {
+			return row, err
+		}
+		out := make([]string, len(row))
+		for i, cell := range row {
+			out[i] = cell
+			if i < len(masked) && masked[i] != "" {
+				out[i] = pii.Mask(masked[i], cell)
+			}
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mirzakhany/gox/pii"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskPII(t *testing.T) {
+	type user struct {
+		ID    string `json:"id"`
+		Email string `json:"email" pii:"email"`
+	}
+	handler := MaskPII(func(r *http.Request) bool {
+		return r.Header.Get("X-Role") == "support"
+	})(FieldMasking(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, []user{{ID: "1", Email: "ann@example.com"}})
+	})))
+
+	{ // tagged fields are masked, also below other middlewares
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?fields=email", nil))
+		require.JSONEq(t, `[{"email":"a***@example.com"}]`, w.Body.String())
+	}
+
+	{ // privileged requests see them
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.Header.Set("X-Role", "support")
+		handler.ServeHTTP(w, r)
+		require.JSONEq(t, `[{"id":"1","email":"ann@example.com"}]`, w.Body.String())
+	}
+}
+
+func TestMaskRows(t *testing.T) {
+	type user struct {
+		ID    string `db:"id"`
+		Email string `db:"email" pii:"email"`
+	}
+	rows := [][]string{{"1", "ann@example.com"}, {"2", "bob@example.com"}}
+	next := MaskRows([]string{"id", "email"}, pii.Columns(user{}), func() ([]string, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	})
+
+	row, err := next()
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "a***@example.com"}, row)
+	row, err = next()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "b***@example.com"}, row)
+	_, err = next()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,216 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultProxyRetries = 2
+
+type proxyConfig struct {
+	upstreams      []*url.URL
+	retries        int
+	rewrite        func(path string) string
+	forwardHeaders []string
+	removeHeaders  []string
+	transport      http.RoundTripper
+	logger         *zap.Logger
+}
+
+type ProxyOption func(*proxyConfig) error
+
+// WithUpstreams adds more upstreams to the proxy. requests are balanced between all upstreams round-robin.
+func WithUpstreams(targets ...string) ProxyOption {
+	return func(c *proxyConfig) error {
+		for _, t := range targets {
+			u, err := url.Parse(t)
+			if err != nil {
+				return err
+			}
+			c.upstreams = append(c.upstreams, u)
+		}
+		return nil
+	}
+}
+
+// WithProxyRetries sets how many other upstreams are tried when one is not reachable or responds with
+// 502, 503 or 504. only requests without a body, like GET, are retried, default is DefaultProxyRetries.
+func WithProxyRetries(retries int) ProxyOption {
+	return func(c *proxyConfig) error {
+		c.retries = retries
+		return nil
+	}
+}
+
+// WithPathRewrite rewrites the request path after the prefix is removed.
+func WithPathRewrite(rewrite func(path string) string) ProxyOption {
+	return func(c *proxyConfig) error {
+		c.rewrite = rewrite
+		return nil
+	}
+}
+
+// WithForwardHeaders only forwards given request headers to the upstream, others are dropped.
+func WithForwardHeaders(headers ...string) ProxyOption {
+	return func(c *proxyConfig) error {
+		c.forwardHeaders = append(c.forwardHeaders, headers...)
+		return nil
+	}
+}
+
+// WithRemoveHeaders drops given request headers before forwarding, like Cookie for untrusted upstreams.
+func WithRemoveHeaders(headers ...string) ProxyOption {
+	return func(c *proxyConfig) error {
+		c.removeHeaders = append(c.removeHeaders, headers...)
+		return nil
+	}
+}
+
+// WithProxyTransport sets the transport used to reach upstreams.
+func WithProxyTransport(transport http.RoundTripper) ProxyOption {
+	return func(c *proxyConfig) error {
+		c.transport = transport
+		return nil
+	}
+}
+
+// WithProxyLogger logs failed upstream requests.
+func WithProxyLogger(logger *zap.Logger) ProxyOption {
+	return func(c *proxyConfig) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// Proxy returns a reverse proxy forwarding requests under prefix to target, with prefix removed from the path.
+// when all upstreams fail it responds with 502 using WriteError.
+// example:
+//
+//	users, err := rest.Proxy("/api/users", "http://users-1:8080", rest.WithUpstreams("http://users-2:8080"))
+//	router.Mount("/api/users", users)
+func Proxy(prefix string, target string, options ...ProxyOption) (http.Handler, error) {
+	cfg := &proxyConfig{retries: DefaultProxyRetries, transport: http.DefaultTransport, logger: zap.NewNop()}
+	if err := WithUpstreams(target)(cfg); err != nil {
+		return nil, err
+	}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	rp := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			path := strings.TrimPrefix(r.URL.Path, prefix)
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+			if cfg.rewrite != nil {
+				path = cfg.rewrite(path)
+			}
+			r.URL.Path, r.URL.RawPath = path, ""
+
+			filterHeaders(r.Header, cfg.forwardHeaders, cfg.removeHeaders)
+			r.Header.Set("X-Forwarded-Host", r.Host)
+			r.Header.Set("X-Forwarded-Prefix", prefix)
+			if r.TLS != nil {
+				r.Header.Set("X-Forwarded-Proto", "https")
+			} else {
+				r.Header.Set("X-Forwarded-Proto", "http")
+			}
+		},
+		Transport: &balancingTransport{upstreams: cfg.upstreams, retries: cfg.retries, next: cfg.transport, logger: cfg.logger},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			cfg.logger.Error("proxy request failed", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+			WriteError(w, http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+		},
+		FlushInterval: 100 * time.Millisecond,
+	}
+	return rp, nil
+}
+
+func filterHeaders(h http.Header, forward, remove []string) {
+	if len(forward) > 0 {
+		keep := make(map[string]bool, len(forward))
+		for _, k := range forward {
+			keep[http.CanonicalHeaderKey(k)] = true
+		}
+		for k := range h {
+			if !keep[k] {
+				h.Del(k)
+			}
+		}
+	}
+	for _, k := range remove {
+		h.Del(k)
+	}
+}
+
+type balancingTransport struct {
+	upstreams []*url.URL
+	retries   int
+	next      http.RoundTripper
+	logger    *zap.Logger
+	counter   uint32
+}
+
+func (t *balancingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := int(atomic.AddUint32(&t.counter, 1) - 1)
+
+	attempts := 1
+	if r.Body == nil || r.Body == http.NoBody {
+		attempts += t.retries
+	}
+	if attempts > len(t.upstreams) {
+		attempts = len(t.upstreams)
+	}
+
+	var (
+		res *http.Response
+		err error
+	)
+	for i := 0; i < attempts; i++ {
+		upstream := t.upstreams[(start+i)%len(t.upstreams)]
+
+		req := r.Clone(r.Context())
+		req.URL.Scheme = upstream.Scheme
+		req.URL.Host = upstream.Host
+		req.URL.Path = strings.TrimSuffix(upstream.Path, "/") + r.URL.Path
+		req.Host = upstream.Host
+
+		res, err = t.next.RoundTrip(req)
+		if err == nil && !retryableStatus(res.StatusCode) {
+			return res, nil
+		}
+
+		if i == attempts-1 {
+			break
+		}
+		if err != nil {
+			t.logger.Warn("proxy upstream failed, trying next", zap.String("upstream", upstream.Host), zap.Error(err))
+		} else {
+			t.logger.Warn("proxy upstream failed, trying next", zap.String("upstream", upstream.Host), zap.Int("code", res.StatusCode))
+			_ = res.Body.Close()
+		}
+		if r.Context().Err() != nil {
+			return nil, r.Context().Err()
+		}
+	}
+
+	if err == nil && res == nil {
+		err = errors.New("no upstream available")
+	}
+	return res, err
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
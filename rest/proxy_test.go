@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get("X-Keep")+" "+r.Header.Get("Cookie")+" "+r.Header.Get("X-Forwarded-Prefix"))
+	}))
+	defer upstream.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	proxy, err := Proxy("/api/users/", down.URL, WithUpstreams(upstream.URL+"/v1"),
+		WithForwardHeaders("X-Keep", "Cookie"), WithRemoveHeaders("Cookie"))
+	require.NoError(t, err)
+
+	// every request must end on the healthy upstream, whichever upstream is tried first
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/1", nil)
+		req.Header.Set("X-Keep", "yes")
+		req.Header.Set("Cookie", "secret")
+
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, "/v1/1 yes  /api/users", w.Body.String())
+	}
+
+	{ // requests with a body are not retried
+		proxy, err := Proxy("/api", down.URL, WithUpstreams(upstream.URL))
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader("{}")))
+		require.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+	}
+
+	{ // unreachable upstream
+		down.Close()
+		proxy, err := Proxy("/api", down.URL)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+		require.Equal(t, http.StatusBadGateway, w.Result().StatusCode)
+	}
+}
@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"go.uber.org/zap"
+)
+
+// RateLimitStore keeps the token buckets of RateLimit. MemoryRateLimitStore keeps them in the process,
+// a store shared by the replicas of a service, like redis, limits clients across all of them.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, refilled with rate tokens per second up to burst,
+	// or returns how long to wait for the next one.
+	Take(ctx context.Context, key string, rate float64, burst int) (ok bool, wait time.Duration, err error)
+}
+
+// RateLimitOptions configures RateLimit.
+type RateLimitOptions struct {
+	// Rate is the number of requests per second allowed for each key.
+	Rate float64
+	// Burst is the number of requests allowed at once, Rate rounded up by default.
+	Burst int
+	// Key returns the key requests are limited by, ClientIPKey by default, which trusts forwarding
+	// headers, see it. requests with an empty key are not limited.
+	Key func(r *http.Request) string
+	// Store keeps the buckets, a new MemoryRateLimitStore by default.
+	Store RateLimitStore
+	// Logger logs errors of the store, whose requests are let through.
+	Logger *zap.Logger
+}
+
+// RateLimit limits the request rate of each key with a token bucket, answering requests over it with
+// 429 and a Retry-After header. WithRateLimit adds it for RunHttpServer.
+// example:
+//
+//	router.Use(rest.RateLimit(rest.RateLimitOptions{
+//		Rate:  10,
+//		Burst: 20,
+//		Key:   rest.HeaderKey("X-API-Key"),
+//	}))
+func RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if opts.Burst <= 0 {
+		opts.Burst = int(math.Ceil(opts.Rate))
+	}
+	if opts.Key == nil {
+		opts.Key = ClientIPKey
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if key == "" || opts.Rate <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, wait, err := opts.Store.Take(r.Context(), key, opts.Rate, opts.Burst)
+			if err != nil {
+				opts.Logger.Error("rate limit store failed", zap.String("key", key), zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				seconds := int(math.Ceil(wait.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				WriteErr(w, errs.New(errs.CodeResourceExhausted, "rate limit exceeded"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIPKey returns the ip of the client, from the RequestMeta of GatewayMeta when it is known and
+// from the remote address, which middleware.RealIP of DefaultMiddlewares sets, otherwise. both take the
+// ip from headers like X-Forwarded-For as they are, so the server must only be reached through a proxy
+// which sets or strips them, or clients can pick a new key for every request. servers taking requests
+// directly must set their middlewares with WithMiddlewares, leaving RealIP out, so the remote address
+// is the one of the connection.
+func ClientIPKey(r *http.Request) string {
+	if meta, ok := RequestMetaFrom(r.Context()); ok && meta.ClientIP != "" {
+		return meta.ClientIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// HeaderKey returns a key function reading header, like the api key of the client.
+func HeaderKey(header string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// rateLimitSweepInterval is how often MemoryRateLimitStore drops buckets which refilled.
+const rateLimitSweepInterval = time.Minute
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in memory, dropping the ones which are full again so keys
+// seen once do not grow it forever.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*rateBucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	if rate <= 0 || burst <= 0 {
+		return false, 0, errors.New("rate and burst must be positive")
+	}
+	now := clock.FromContext(ctx).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+
+	ok = b.tokens >= 1
+	var wait time.Duration
+	if ok {
+		b.tokens--
+	} else {
+		wait = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	return ok, wait, nil
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/stretchr/testify/require"
+)
+
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time                         { return c.now }
+func (c *manualClock) Since(t time.Time) time.Duration        { return c.now.Sub(t) }
+func (c *manualClock) After(d time.Duration) <-chan time.Time { return nil }
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, float64, int) (bool, time.Duration, error) {
+	return false, 0, errors.New("store down")
+}
+
+func TestRateLimit(t *testing.T) {
+	clk := &manualClock{now: time.Unix(1700000000, 0)}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	do := func(handler http.Handler, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(clock.WithContext(r.Context(), clk))
+		r.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			r.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	{ // clients are limited by ip, each with their own bucket
+		handler := RateLimit(RateLimitOptions{Rate: 1, Burst: 2})(ok)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1234", "").Code)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1235", "").Code)
+
+		w := do(handler, "10.0.0.1:1236", "")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.2:1234", "").Code)
+
+		clk.now = clk.now.Add(time.Second)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1237", "").Code)
+	}
+
+	{ // custom keys, requests without a key pass
+		handler := RateLimit(RateLimitOptions{Rate: 0.1, Key: HeaderKey("X-API-Key")})(ok)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1", "key-a").Code)
+
+		w := do(handler, "10.0.0.2:1", "key-a")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.Equal(t, "10", w.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1", "key-b").Code)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1", "").Code)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1", "").Code)
+	}
+
+	{ // store errors let requests through
+		handler := RateLimit(RateLimitOptions{Rate: 1, Store: failingRateLimitStore{}})(ok)
+		require.Equal(t, http.StatusNoContent, do(handler, "10.0.0.1:1", "").Code)
+	}
+
+	{ // full buckets are dropped from memory
+		store := NewMemoryRateLimitStore()
+		ctx := clock.WithContext(context.Background(), clk)
+		_, _, err := store.Take(ctx, "a", 1, 1)
+		require.NoError(t, err)
+		clk.now = clk.now.Add(rateLimitSweepInterval)
+		_, _, err = store.Take(ctx, "b", 1, 1)
+		require.NoError(t, err)
+		require.Len(t, store.buckets, 1)
+	}
+}
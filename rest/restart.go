@@ -0,0 +1,181 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// listenFDsEnv is set by Upgrade for the new process, holding the number of inherited listeners.
+const listenFDsEnv = "GOX_LISTEN_FDS"
+
+// readyFDEnv is set by Upgrade for the new process, holding the file descriptor of the pipe Ready
+// writes to.
+const readyFDEnv = "GOX_READY_FD"
+
+// inheritedFD is the first file descriptor passed to a child, after stdin, stdout and stderr.
+const inheritedFD = 3
+
+// UpgradeReadyTimeout is how long Upgrade waits for the new process to call Ready.
+var UpgradeReadyTimeout = 30 * time.Second
+
+var readyOnce sync.Once
+
+// Ready tells the process which started this one with Upgrade that it serves the inherited listener,
+// so the old one can shut down. it does nothing in processes not started by Upgrade and after the
+// first call. Server calls it once it serves, processes using Listen call it themselves.
+func Ready() {
+	readyOnce.Do(func() {
+		v := os.Getenv(readyFDEnv)
+		if v == "" {
+			return
+		}
+		_ = os.Unsetenv(readyFDEnv)
+		fd, err := strconv.Atoi(v)
+		if err != nil {
+			return
+		}
+		f := os.NewFile(uintptr(fd), "ready")
+		_, _ = f.Write([]byte{1})
+		_ = f.Close()
+	})
+}
+
+// Listen returns the listener inherited from the parent process when started by Upgrade, or a new
+// tcp listener on addr otherwise.
+func Listen(addr string) (net.Listener, error) {
+	if ln, ok, err := inheritedListener(); ok {
+		return ln, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// inheritedListener returns the listener passed by Upgrade, ok is false if there is none.
+func inheritedListener() (ln net.Listener, ok bool, err error) {
+	v := os.Getenv(listenFDsEnv)
+	if v == "" {
+		return nil, false, nil
+	}
+	// unset it so processes started by this one do not try to inherit it
+	_ = os.Unsetenv(listenFDsEnv)
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return nil, true, fmt.Errorf("invalid %s value %q", listenFDsEnv, v)
+	}
+
+	f := os.NewFile(inheritedFD, "listener")
+	defer f.Close()
+	ln, err = net.FileListener(f)
+	return ln, true, err
+}
+
+// Upgrade starts a new instance of the running binary, with the same arguments and environment,
+// passing ln to it so it can accept connections on the same socket, and waits until it calls Ready.
+// the caller is expected to gracefully shutdown once Upgrade returns. a new process which exits or
+// is not ready within UpgradeReadyTimeout is killed and an error returned, the caller keeps serving.
+// the binary on disk can be replaced before calling Upgrade to deploy a new version without dropping
+// connections.
+func Upgrade(ln net.Listener) (*os.Process, error) {
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %T can not be passed to a new process", ln)
+	}
+
+	f, err := fl.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), listenFDsEnv+"=1", readyFDEnv+"="+strconv.Itoa(inheritedFD+1))
+	cmd.ExtraFiles = []*os.File{f, readyW}
+
+	// the socket file of a unix listener is kept for the new process when this one closes it
+	ul, unix := ln.(*net.UnixListener)
+	if unix {
+		ul.SetUnlinkOnClose(false)
+	}
+	err = cmd.Start()
+	// the pipe is closed for this process, so reading it ends when the new process exits
+	_ = readyW.Close()
+	if err == nil {
+		err = waitReady(readyR)
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}
+	}
+	if err != nil {
+		if unix {
+			ul.SetUnlinkOnClose(true)
+		}
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+// waitReady waits for the new process to write to the ready pipe r.
+func waitReady(r *os.File) error {
+	if err := r.SetReadDeadline(time.Now().Add(UpgradeReadyTimeout)); err != nil {
+		return err
+	}
+	b := make([]byte, 1)
+	if _, err := r.Read(b); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("new process is not ready after %s", UpgradeReadyTimeout)
+		}
+		return fmt.Errorf("new process exited before it was ready: %w", err)
+	}
+	return nil
+}
+
+// watchUpgrade calls Upgrade on each upgrade signal, until it succeeds and closes done.
+func watchUpgrade(ctx context.Context, ln net.Listener, logger *zap.Logger, done chan<- struct{}) {
+	if len(upgradeSignals) == 0 {
+		logger.Warn("graceful restart is not supported on this platform")
+		return
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, upgradeSignals...)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			p, err := Upgrade(ln)
+			if err != nil {
+				logger.Error("graceful restart failed", zap.Error(err))
+				continue
+			}
+			logger.Info("graceful restart handed over to a new process", zap.Int("pid", p.Pid))
+			close(done)
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+//go:build !windows
+
+package rest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// upgradeChildEnv tells the test binary started by Upgrade how to behave.
+const upgradeChildEnv = "GOX_TEST_UPGRADE_CHILD"
+
+func TestUpgrade(t *testing.T) {
+	if mode := os.Getenv(upgradeChildEnv); mode != "" {
+		runUpgradeChild(mode)
+		return
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgrade$"}
+	defer func() { os.Args = args }()
+
+	{ // the new process serves the listener once Upgrade returns
+		t.Setenv(upgradeChildEnv, "serve")
+		p, err := Upgrade(ln)
+		require.NoError(t, err)
+		defer p.Kill()
+		require.NoError(t, ln.Close())
+
+		res, err := http.Get("http://" + ln.Addr().String())
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, "child", string(body))
+
+		state, err := p.Wait()
+		require.NoError(t, err)
+		require.True(t, state.Success())
+	}
+
+	{ // a new process exiting before it is ready fails the upgrade
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		t.Setenv(upgradeChildEnv, "exit")
+		_, err = Upgrade(ln)
+		require.ErrorContains(t, err, "exited before it was ready")
+	}
+
+	{ // and so does one which is not ready in time
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		timeout := UpgradeReadyTimeout
+		UpgradeReadyTimeout = 200 * time.Millisecond
+		defer func() { UpgradeReadyTimeout = timeout }()
+
+		t.Setenv(upgradeChildEnv, "hang")
+		_, err = Upgrade(ln)
+		require.ErrorContains(t, err, "not ready")
+	}
+}
+
+// runUpgradeChild is the new process of TestUpgrade, it exits without running other tests.
+func runUpgradeChild(mode string) {
+	switch mode {
+	case "exit":
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(1)
+	}
+
+	ln, err := Listen("")
+	if err != nil {
+		os.Exit(2)
+	}
+	served := make(chan struct{})
+	go func() {
+		_ = http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "child")
+			close(served)
+		}))
+	}()
+	Ready()
+
+	select {
+	case <-served:
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(0)
+	case <-time.After(10 * time.Second):
+		os.Exit(3)
+	}
+}
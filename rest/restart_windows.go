@@ -0,0 +1,8 @@
+//go:build windows
+
+package rest
+
+import "os"
+
+// graceful restart is not supported on windows as listeners can not be inherited
+var upgradeSignals []os.Signal
@@ -0,0 +1,352 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/cors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Server is a http server with the middlewares and tls setup of the options which can be composed into
+// larger programs: Start returns once it listens and Shutdown stops it.
+type Server struct {
+	cfg    *config
+	logger *zap.Logger
+	srv    *http.Server
+
+	challengeSrv *http.Server
+	metricsSrv   *http.Server
+
+	mu       sync.Mutex
+	ln       net.Listener
+	started  bool
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
+}
+
+// New returns a server which is not started yet.
+// example:
+//
+//	srv, err := rest.New(rest.WithHandler(setupRouter), rest.WithPort("0"))
+//	...
+//	if err := srv.Start(ctx); err != nil {
+//		...
+//	}
+//	res, err := http.Get("http://" + srv.Addr() + "/users")
+//	...
+//	err = srv.Shutdown(ctx)
+func New(options ...Option) (*Server, error) {
+	nopLogger := zap.NewNop()
+	cfg := &config{
+		port:   DefaultPort,
+		logger: nopLogger,
+	}
+
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.autoTLS != nil && (cfg.tlsConfig != nil || cfg.tlsCertFile != "") {
+		return nil, errors.New("auto tls can not be combined with WithTLS or WithTLSConfig")
+	}
+	mtls := cfg.clientAuth != tls.NoClientCert
+	if mtls && cfg.tlsConfig == nil && cfg.tlsCertFile == "" && cfg.autoTLS == nil {
+		return nil, errors.New("mutual tls requires WithTLS, WithTLSConfig or WithAutoTLS")
+	}
+	if cfg.listener != nil && cfg.unixSocket != "" {
+		return nil, errors.New("WithListener can not be combined with WithUnixSocket")
+	}
+
+	apiRouter := chi.NewRouter()
+	if cfg.metrics != nil {
+		m, err := NewHTTPMetrics(cfg.metrics)
+		if err != nil {
+			return nil, err
+		}
+		apiRouter.Use(m.Middleware)
+	}
+	if cfg.tracerProvider != nil {
+		apiRouter.Use(Tracing(cfg.tracerProvider))
+	}
+	if len(cfg.allowedHosts) > 0 {
+		apiRouter.Use(AllowedHosts(cfg.allowedHosts))
+	}
+	if cfg.maxBodySize > 0 {
+		apiRouter.Use(MaxBodySize(cfg.maxBodySize))
+	}
+	if len(cfg.middlewares) == 0 {
+		// set default middlewares
+		apiRouter.Use(DefaultMiddlewares()...)
+	}
+
+	corsOptions := DefaultCorsOption()
+	if cfg.setCors {
+		corsOptions = cfg.corsOptions
+	}
+	apiRouter.Use(cors.New(corsOptions).Handler)
+
+	if mtls {
+		apiRouter.Use(ClientCertificate)
+	}
+
+	if cfg.requestMeta {
+		apiRouter.Use(GatewayMeta)
+	}
+
+	if cfg.envelope {
+		apiRouter.Use(EnvelopeResponses)
+	}
+
+	if cfg.errorPages != nil {
+		apiRouter.Use(HTMLErrors(cfg.errorPages))
+		apiRouter.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		})
+		apiRouter.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		})
+	}
+
+	// requests are not logged without a logger, like for servers of metrics and probes
+	if cfg.logger != nopLogger {
+		apiRouter.Use(RequestLogger(cfg.logger))
+	}
+
+	if cfg.rateLimit != nil {
+		opts := *cfg.rateLimit
+		if opts.Logger == nil {
+			opts.Logger = cfg.logger
+		}
+		apiRouter.Use(RateLimit(opts))
+	}
+
+	var handler http.Handler = apiRouter
+	if cfg.createHandler != nil {
+		handler = cfg.createHandler(apiRouter)
+	}
+	// added after the handler, which may still add middlewares to the router
+	if cfg.metricsGatherer != nil && cfg.metricsPort == "" {
+		apiRouter.Handle(DefaultMetricsPath, MetricsHandler(cfg.metricsGatherer))
+	}
+	tlsEnabled := cfg.tlsConfig != nil || cfg.tlsCertFile != "" || cfg.autoTLS != nil
+	if cfg.h2c && !tlsEnabled {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	srv := &http.Server{
+		Addr:    net.JoinHostPort("", cfg.port),
+		Handler: handler,
+	}
+
+	if cfg.logRoutes {
+		logRoutes(apiRouter, cfg.logger)
+	}
+
+	if cfg.tlsConfig != nil {
+		srv.TLSConfig = cfg.tlsConfig.Clone()
+	} else if cfg.tlsCertFile != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	s := &Server{cfg: cfg, logger: cfg.logger, srv: srv, done: make(chan struct{})}
+	if cfg.autoTLS != nil {
+		srv.TLSConfig = cfg.autoTLS.TLSConfig()
+		// http-01 challenges must be answered on port 80, other requests are redirected to https
+		s.challengeSrv = &http.Server{
+			Addr:              net.JoinHostPort("", cfg.autoTLSChallengePort),
+			Handler:           cfg.autoTLS.HTTPHandler(nil),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+	}
+	if cfg.metricsGatherer != nil && cfg.metricsPort != "" {
+		mux := http.NewServeMux()
+		mux.Handle(DefaultMetricsPath, MetricsHandler(cfg.metricsGatherer))
+		s.metricsSrv = &http.Server{
+			Addr:              net.JoinHostPort("", cfg.metricsPort),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+	}
+	if mtls {
+		srv.TLSConfig.ClientCAs, srv.TLSConfig.ClientAuth = cfg.clientCAs, cfg.clientAuth
+	}
+	return s, nil
+}
+
+// Start listens and serves in the background. ctx only bounds the graceful restart watcher of
+// WithGracefulRestart, the server runs until Shutdown.
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("http server is already started")
+	}
+
+	ln, err := s.listen()
+	if err != nil {
+		return fmt.Errorf("start http server: %w", err)
+	}
+	if s.metricsSrv != nil {
+		mln, err := net.Listen("tcp", s.metricsSrv.Addr)
+		if err != nil {
+			_ = ln.Close()
+			return fmt.Errorf("start metrics server: %w", err)
+		}
+		go func() {
+			s.logger.Info("Start metrics server", zap.String("addr", mln.Addr().String()))
+			if err := s.metricsSrv.Serve(mln); err != nil && err != http.ErrServerClosed {
+				s.stop(fmt.Errorf("metrics server: %w", err))
+			}
+		}()
+	}
+	s.ln, s.started = ln, true
+
+	if s.challengeSrv != nil {
+		go func() {
+			s.logger.Info("Start acme challenge server", zap.String("port", s.cfg.autoTLSChallengePort))
+			if err := s.challengeSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.stop(fmt.Errorf("acme challenge server: %w", err))
+			}
+		}()
+	}
+
+	go func() {
+		s.logger.Info("Start http server", zap.String("addr", ln.Addr().String()), zap.Bool("tls", s.srv.TLSConfig != nil))
+		serve := s.srv.Serve
+		if s.srv.TLSConfig != nil {
+			serve = func(ln net.Listener) error { return s.srv.ServeTLS(ln, s.cfg.tlsCertFile, s.cfg.tlsKeyFile) }
+		}
+		if err := serve(ln); err != nil && err != http.ErrServerClosed {
+			s.stop(fmt.Errorf("http server: %w", err))
+		}
+	}()
+	// the listener accepts connections, a process which started this one can shut down
+	Ready()
+
+	if s.cfg.gracefulRestart {
+		upgraded := make(chan struct{})
+		go watchUpgrade(ctx, ln, s.logger, upgraded)
+		go func() {
+			select {
+			case <-upgraded:
+				s.stop(nil)
+			case <-s.done:
+			}
+		}()
+	}
+	return nil
+}
+
+// listen returns the listener of the options, the inherited one on a graceful restart or a new one
+// on the unix socket or port.
+func (s *Server) listen() (net.Listener, error) {
+	if s.cfg.listener != nil {
+		return s.cfg.listener, nil
+	}
+
+	network, addr := "tcp", s.srv.Addr
+	if s.cfg.unixSocket != "" {
+		network, addr = "unix", s.cfg.unixSocket
+	}
+	if s.cfg.gracefulRestart {
+		if ln, ok, err := inheritedListener(); ok {
+			return ln, err
+		}
+	}
+	if network == "unix" {
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// removeStaleSocket removes the socket file left at path by a previous run which did not shut down.
+// a socket accepting connections belongs to a running server and is kept.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by a running server", path)
+	}
+	return os.Remove(path)
+}
+
+// stop ends the run with err, the first call wins.
+func (s *Server) stop(err error) {
+	s.doneOnce.Do(func() {
+		if err != nil {
+			s.logger.Error("Http Server failed", zap.Error(err))
+		}
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// Addr returns the address the server listens on, empty before Start. it is the port picked for
+// port "0" and the socket path for WithUnixSocket.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Done is closed when the server stops serving on its own, like when it fails or was handed over
+// to a new instance by a graceful restart, and by Shutdown. Err tells why.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error which stopped the server, nil if it is running or stopped cleanly.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Shutdown stops accepting connections and waits for active requests until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.challengeSrv != nil {
+		if cerr := s.challengeSrv.Shutdown(ctx); cerr != nil {
+			s.logger.Error("acme challenge server shutdown failed", zap.Error(cerr))
+		}
+	}
+	if s.metricsSrv != nil {
+		if merr := s.metricsSrv.Shutdown(ctx); merr != nil {
+			s.logger.Error("metrics server shutdown failed", zap.Error(merr))
+		}
+	}
+	if serr := s.srv.Shutdown(ctx); serr != nil {
+		err = multierr.Append(err, fmt.Errorf("http server shutdown: %w", serr))
+	}
+	s.stop(nil)
+	return err
+}
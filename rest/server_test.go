@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+)
+
+func TestServer(t *testing.T) {
+	srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithHandler(func(router chi.Router) http.Handler {
+		router.Get("/ping", func(w http.ResponseWriter, r *http.Request) { WriteJSON(w, http.StatusOK, "pong") })
+		return router
+	}))
+	require.NoError(t, err)
+	require.Empty(t, srv.Addr())
+
+	ctx := context.Background()
+	require.NoError(t, srv.Start(ctx))
+	require.Error(t, srv.Start(ctx))
+
+	{ // the server answers on the picked port
+		res, err := http.Get("http://" + srv.Addr() + "/ping")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	require.NoError(t, srv.Shutdown(ctx))
+	<-srv.Done()
+	require.NoError(t, srv.Err())
+
+	_, err = http.Get("http://" + srv.Addr() + "/ping")
+	require.Error(t, err)
+}
+
+func TestServerH2C(t *testing.T) {
+	srv, err := New(WithPort("0"), WithZapLogger(zap.NewNop()), WithH2C(), WithHandler(func(router chi.Router) http.Handler {
+		router.Get("/proto", func(w http.ResponseWriter, r *http.Request) { WriteJSON(w, http.StatusOK, r.Proto) })
+		return router
+	}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, srv.Start(ctx))
+	defer srv.Shutdown(ctx)
+
+	{ // prior knowledge http2 without tls
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		res, err := client.Get("http://" + srv.Addr() + "/proto")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, 2, res.ProtoMajor)
+	}
+
+	{ // http/1 clients still work
+		res, err := http.Get("http://" + srv.Addr() + "/proto")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, 1, res.ProtoMajor)
+	}
+}
+
+func TestServerListener(t *testing.T) {
+	createHandler := func(router chi.Router) http.Handler {
+		router.Get("/ping", func(w http.ResponseWriter, r *http.Request) { WriteJSON(w, http.StatusOK, "pong") })
+		return router
+	}
+	ctx := context.Background()
+
+	{ // a listener created by the caller
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv, err := New(WithZapLogger(zap.NewNop()), WithListener(ln), WithHandler(createHandler))
+		require.NoError(t, err)
+		require.NoError(t, srv.Start(ctx))
+		require.Equal(t, ln.Addr().String(), srv.Addr())
+
+		res, err := http.Get("http://" + srv.Addr() + "/ping")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, srv.Shutdown(ctx))
+	}
+
+	{ // unix socket, a stale socket is replaced
+		path := filepath.Join(t.TempDir(), "gox.sock")
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		srv, err := New(WithZapLogger(zap.NewNop()), WithUnixSocket(path), WithHandler(createHandler))
+		require.NoError(t, err)
+		require.NoError(t, srv.Start(ctx))
+		require.Equal(t, path, srv.Addr())
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+		res, err := client.Get("http://unix/ping")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, srv.Shutdown(ctx))
+	}
+
+	{ // the socket of a running server is not removed
+		path := filepath.Join(t.TempDir(), "gox.sock")
+		running, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		defer running.Close()
+
+		srv, err := New(WithZapLogger(zap.NewNop()), WithUnixSocket(path))
+		require.NoError(t, err)
+		require.ErrorContains(t, srv.Start(ctx), "in use")
+		_, err = os.Stat(path)
+		require.NoError(t, err)
+	}
+
+	{ // a regular file is not removed
+		path := filepath.Join(t.TempDir(), "gox.sock")
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		srv, err := New(WithZapLogger(zap.NewNop()), WithUnixSocket(path))
+		require.NoError(t, err)
+		require.Error(t, srv.Start(ctx))
+	}
+
+	{ // both options conflict
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		_, err = New(WithListener(ln), WithUnixSocket("gox.sock"))
+		require.Error(t, err)
+	}
+}
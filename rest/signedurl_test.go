@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedURL(t *testing.T) {
+	secret := []byte("secret")
+	handler := SignedURL(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method, target string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w.Result().StatusCode
+	}
+
+	{ // valid signature should pass
+		link, err := SignURL(secret, http.MethodGet, "http://example.com/files/1?b=2&a=1", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, serve(http.MethodGet, link))
+
+		// using the link with another method should fail
+		require.Equal(t, http.StatusForbidden, serve(http.MethodDelete, link))
+	}
+
+	{ // tampered path or query should fail
+		link, err := SignURL(secret, http.MethodGet, "http://example.com/files/1?a=1", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		req.URL.Path = "/files/2"
+		require.ErrorIs(t, VerifySignedURL(secret, req), ErrSignedURLInvalid)
+
+		req = httptest.NewRequest(http.MethodGet, link, nil)
+		q := req.URL.Query()
+		q.Set("a", "2")
+		req.URL.RawQuery = q.Encode()
+		require.ErrorIs(t, VerifySignedURL(secret, req), ErrSignedURLInvalid)
+	}
+
+	{ // expired and unsigned links should fail
+		link, err := SignURL(secret, http.MethodGet, "http://example.com/files/1", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		require.ErrorIs(t, VerifySignedURL(secret, httptest.NewRequest(http.MethodGet, link, nil)), ErrSignedURLExpired)
+		require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "http://example.com/files/1"))
+	}
+}
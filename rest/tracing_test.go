@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	core, logs := observer.New(zap.InfoLevel)
+
+	router := chi.NewRouter()
+	router.Use(Tracing(tp), RequestLogger(zap.New(core)))
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, trace.SpanContextFromContext(r.Context()).TraceID().String())
+	})
+	router.Get("/broken", func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, http.StatusInternalServerError, "broken")
+	})
+
+	{ // spans are named by route pattern and continue the trace of traceparent
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Contains(t, w.Body.String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+
+		ended := spans.Ended()
+		require.Len(t, ended, 1)
+		span := ended[0]
+		require.Equal(t, "GET /users/{id}", span.Name())
+		require.Equal(t, trace.SpanKindServer, span.SpanKind())
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+
+		fields := logs.TakeAll()[0].ContextMap()
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fields["trace_id"])
+		require.Equal(t, span.SpanContext().SpanID().String(), fields["span_id"])
+	}
+
+	{ // server errors set the span status
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/broken", nil))
+		span := spans.Ended()[1]
+		require.Equal(t, "GET /broken", span.Name())
+		require.Equal(t, codes.Error, span.Status().Code)
+		require.False(t, span.Parent().IsValid())
+	}
+
+	{ // unknown paths share one span name
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing/42", nil))
+		require.Equal(t, "GET unmatched", spans.Ended()[2].Name())
+	}
+}
@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Params are the url params of a route, params which are not in its pattern are added to the query.
+type Params map[string]string
+
+type namedHandler struct {
+	http.Handler
+	name string
+}
+
+// Named marks h as the handler of the route called name, so URLFor can build its url. it is registered
+// with Method or Handle of the router, which take a http.Handler.
+// example:
+//
+//	router.Method(http.MethodGet, "/users/{id}", rest.Named("getUser", getUser))
+func Named(name string, h http.HandlerFunc) http.Handler {
+	return &namedHandler{Handler: h, name: name}
+}
+
+// URLBuilder builds urls of named routes from their patterns.
+type URLBuilder struct {
+	patterns map[string]string
+}
+
+// NewURLBuilder collects the patterns of the routes of router marked with Named, including the ones of
+// mounted routers.
+func NewURLBuilder(router chi.Routes) (*URLBuilder, error) {
+	b := &URLBuilder{patterns: make(map[string]string)}
+	err := chi.Walk(router, func(_ string, route string, handler http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if c, ok := handler.(*chi.ChainHandler); ok {
+			handler = c.Endpoint
+		}
+		named, ok := handler.(*namedHandler)
+		if !ok {
+			return nil
+		}
+		route = strings.ReplaceAll(route, "/*/", "/")
+		if existing, ok := b.patterns[named.name]; ok && existing != route {
+			return fmt.Errorf("route name %s is used by %s and %s", named.name, existing, route)
+		}
+		b.patterns[named.name] = route
+		return nil
+	})
+	return b, err
+}
+
+// URLFor returns the path of the route called name with params filled in.
+func (b *URLBuilder) URLFor(name string, params Params) (string, error) {
+	pattern, ok := b.patterns[name]
+	if !ok {
+		return "", errors.New("unknown route " + name)
+	}
+
+	used := make(map[string]bool)
+	var path strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '{' {
+			path.WriteByte(pattern[i])
+			continue
+		}
+		end := strings.IndexByte(pattern[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("invalid pattern %s", pattern)
+		}
+		key, _, _ := strings.Cut(pattern[i+1:i+end], ":")
+		value, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("route %s needs param %s", name, key)
+		}
+		used[key] = true
+		path.WriteString(url.PathEscape(value))
+		i += end
+	}
+
+	q := url.Values{}
+	for k, v := range params {
+		if !used[k] {
+			q.Set(k, v)
+		}
+	}
+	if len(q) > 0 {
+		return path.String() + "?" + q.Encode(), nil
+	}
+	return path.String(), nil
+}
+
+var (
+	defaultURLsMu sync.RWMutex
+	defaultURLs   *URLBuilder
+)
+
+// RegisterRoutes makes the named routes of router available to URLFor, call it once the router is built.
+func RegisterRoutes(router chi.Routes) error {
+	b, err := NewURLBuilder(router)
+	if err != nil {
+		return err
+	}
+	defaultURLsMu.Lock()
+	defaultURLs = b
+	defaultURLsMu.Unlock()
+	return nil
+}
+
+// URLFor returns the path of the route called name of the router given to RegisterRoutes.
+// example:
+//
+//	link, err := rest.URLFor("getUser", rest.Params{"id": user.ID}) // /users/42
+func URLFor(name string, params Params) (string, error) {
+	defaultURLsMu.RLock()
+	b := defaultURLs
+	defaultURLsMu.RUnlock()
+	if b == nil {
+		return "", errors.New("no routes registered, see RegisterRoutes")
+	}
+	return b.URLFor(name, params)
+}
+
+// Link is a link to a related resource, for Link headers and _links sections.
+type Link struct {
+	Rel  string `json:"-"`
+	Href string `json:"href"`
+}
+
+// Links is the _links section of a resource, by relation.
+// example:
+//
+//	type userResponse struct {
+//		User
+//		Links rest.Links `json:"_links"`
+//	}
+//	res := userResponse{User: user, Links: rest.NewLinks(rest.Link{Rel: "self", Href: self})}
+type Links map[string]Link
+
+func NewLinks(links ...Link) Links {
+	l := make(Links, len(links))
+	for _, link := range links {
+		l[link.Rel] = link
+	}
+	return l
+}
+
+// SetLinkHeader sets the Link header (RFC 8288) of w to links, like for the next and prev pages of a list.
+func SetLinkHeader(w http.ResponseWriter, links ...Link) {
+	values := make([]string, 0, len(links))
+	for _, l := range links {
+		values = append(values, fmt.Sprintf("<%s>; rel=%q", l.Href, l.Rel))
+	}
+	w.Header().Set("Link", strings.Join(values, ", "))
+}
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLFor(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := chi.NewRouter()
+	router.Get("/health", noop)
+	router.Route("/users", func(r chi.Router) {
+		r.Method(http.MethodGet, "/{id}", Named("getUser", noop))
+		r.With(FieldMasking).Method(http.MethodGet, "/{id:[0-9]+}/orders/{orderID}", Named("getOrder", noop))
+	})
+	api := chi.NewRouter()
+	api.Handle("/items", Named("listItems", noop))
+	router.Mount("/api/v1", api)
+
+	require.NoError(t, RegisterRoutes(router))
+
+	link, err := URLFor("getUser", Params{"id": "a/b"})
+	require.NoError(t, err)
+	require.Equal(t, "/users/a%2Fb", link)
+
+	link, err = URLFor("getOrder", Params{"id": "1", "orderID": "2", "expand": "items"})
+	require.NoError(t, err)
+	require.Equal(t, "/users/1/orders/2?expand=items", link)
+
+	link, err = URLFor("listItems", nil)
+	require.NoError(t, err)
+	require.Equal(t, "/api/v1/items", link)
+
+	_, err = URLFor("getUser", nil)
+	require.Error(t, err)
+	_, err = URLFor("unknown", nil)
+	require.Error(t, err)
+}
+
+func TestLinks(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetLinkHeader(w, Link{Rel: "next", Href: "/items?page=3"}, Link{Rel: "prev", Href: "/items?page=1"})
+	require.Equal(t, `</items?page=3>; rel="next", </items?page=1>; rel="prev"`, w.Header().Get("Link"))
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"_links": NewLinks(Link{Rel: "self", Href: "/items/1"})})
+	require.JSONEq(t, `{"_links":{"self":{"href":"/items/1"}}}`, w.Body.String())
+}
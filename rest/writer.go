@@ -0,0 +1,34 @@
+package rest
+
+import "net/http"
+
+// wrappedWriter is embedded by the response writers of the middlewares, Unwrap lets findWriter reach
+// the writers below it and Flush keeps streaming responses working.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w wrappedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// findWriter finds the writer of type T below middlewares wrapping w, if any.
+func findWriter[T any](w http.ResponseWriter) (T, bool) {
+	for {
+		if t, ok := w.(T); ok {
+			return t, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		w = u.Unwrap()
+	}
+}
@@ -0,0 +1,308 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/mirzakhany/gox/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultInterval   = time.Hour
+	DefaultBatchSize  = 1000
+	DefaultBatchPause = 100 * time.Millisecond
+)
+
+// Policy expires the rows of Table once Column, a timestamp, is older than MaxAge.
+type Policy struct {
+	Table  string
+	Column string
+	MaxAge time.Duration
+	// Where limits the policy to some rows, like "status = 'done'". it is sql and must never come from requests
+	Where string
+	// ArchiveTable receives expired rows before they are deleted, it must have the columns of Table
+	ArchiveTable string
+}
+
+func (p Policy) validate() error {
+	switch {
+	case p.Table == "" || p.Column == "":
+		return errors.New("retention: policy needs a table and a column")
+	case p.MaxAge <= 0:
+		return fmt.Errorf("retention: policy of %s needs a positive max age", p.Table)
+	}
+	return nil
+}
+
+var (
+	registeredMu sync.Mutex
+	registered   []Policy
+)
+
+// Register adds a policy to the ones of jobs created without WithPolicies, like in the init function
+// of the package owning the table.
+// example:
+//
+//	func init() {
+//		retention.Register(retention.Policy{Table: "audit_logs", Column: "created_at", MaxAge: 90 * 24 * time.Hour})
+//	}
+func Register(p Policy) {
+	if err := p.validate(); err != nil {
+		panic(err)
+	}
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, p)
+}
+
+// Result is the outcome of a policy in one run, Expired is only counted in dry runs.
+type Result struct {
+	Table   string `json:"table"`
+	Expired int64  `json:"expired,omitempty"`
+	Deleted int64  `json:"deleted"`
+}
+
+type Option func(*Job) error
+
+// WithPolicies sets the policies of the job instead of the registered ones.
+func WithPolicies(policies ...Policy) Option {
+	return func(j *Job) error {
+		for _, p := range policies {
+			if err := p.validate(); err != nil {
+				return err
+			}
+		}
+		j.policies = policies
+		return nil
+	}
+}
+
+// WithInterval sets how often the job runs, DefaultInterval by default.
+func WithInterval(d time.Duration) Option {
+	return func(j *Job) error {
+		j.interval = d
+		return nil
+	}
+}
+
+// WithBatchSize sets how many rows are deleted per statement, so deletes do not hold locks for long.
+func WithBatchSize(n int) Option {
+	return func(j *Job) error {
+		if n <= 0 {
+			return errors.New("retention: batch size must be positive")
+		}
+		j.batchSize = n
+		return nil
+	}
+}
+
+// WithBatchPause sets the pause between batches, which leaves the database room for other queries.
+func WithBatchPause(d time.Duration) Option {
+	return func(j *Job) error {
+		j.batchPause = d
+		return nil
+	}
+}
+
+// WithDryRun only counts and logs the expired rows, nothing is deleted.
+func WithDryRun() Option {
+	return func(j *Job) error {
+		j.dryRun = true
+		return nil
+	}
+}
+
+// WithMetrics registers the gox_retention_deleted_rows_total counter, the gox_retention_expired_rows
+// gauge of dry runs and the gox_retention_last_run_timestamp_seconds gauge, labeled by table, with reg.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(j *Job) error {
+		deleted, err := metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "retention", Name: "deleted_rows_total",
+			Help: "Number of expired rows deleted, or moved to the archive table.",
+		}, []string{"table"}))
+		if err != nil {
+			return err
+		}
+		expired, err := metrics.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "retention", Name: "expired_rows",
+			Help: "Number of expired rows found by the last dry run.",
+		}, []string{"table"}))
+		if err != nil {
+			return err
+		}
+		lastRun, err := metrics.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace, Subsystem: "retention", Name: "last_run_timestamp_seconds",
+			Help: "Time the policy of the table last completed.",
+		}, []string{"table"}))
+		if err != nil {
+			return err
+		}
+		j.deleted, j.expired, j.lastRun = deleted, expired, lastRun
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(j *Job) error {
+		j.logger = logger
+		return nil
+	}
+}
+
+// Job deletes the rows expired by the retention policies, in batches.
+type Job struct {
+	db         store.Querier
+	policies   []Policy
+	interval   time.Duration
+	batchSize  int
+	batchPause time.Duration
+	dryRun     bool
+	logger     *zap.Logger
+
+	deleted *prometheus.CounterVec
+	expired *prometheus.GaugeVec
+	lastRun *prometheus.GaugeVec
+}
+
+// NewJob returns a retention job on db, which is a gox.Component to add to the Runner.
+// example:
+//
+//	job, err := retention.NewJob(pool, retention.WithMetrics(prometheus.DefaultRegisterer), retention.WithZapLogger(logger))
+//	runner, err := gox.NewRunner(gox.WithComponents(job, ...))
+func NewJob(db store.Querier, options ...Option) (*Job, error) {
+	registeredMu.Lock()
+	policies := append([]Policy(nil), registered...)
+	registeredMu.Unlock()
+
+	j := &Job{
+		db:         db,
+		policies:   policies,
+		interval:   DefaultInterval,
+		batchSize:  DefaultBatchSize,
+		batchPause: DefaultBatchPause,
+		logger:     zap.NewNop(),
+	}
+	for _, o := range options {
+		if err := o(j); err != nil {
+			return nil, err
+		}
+	}
+	if len(j.policies) == 0 {
+		return nil, errors.New("retention: no policies")
+	}
+	return j, nil
+}
+
+func (j *Job) Name() string {
+	return "retention"
+}
+
+func (j *Job) Describe() map[string]interface{} {
+	tables := make([]string, len(j.policies))
+	for i, p := range j.policies {
+		tables[i] = p.Table
+	}
+	return map[string]interface{}{"tables": tables, "interval": j.interval.String(), "dry_run": j.dryRun}
+}
+
+// Run runs the policies every interval until ctx is done. failures are logged and retried with the
+// next run.
+func (j *Job) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for {
+		if _, err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			j.logger.Error("retention run failed", zap.Error(err))
+		}
+
+		select {
+		case <-clk.After(j.interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// RunOnce applies each policy once. a failing policy does not stop the others, the first error is returned.
+func (j *Job) RunOnce(ctx context.Context) ([]Result, error) {
+	var results []Result
+	var firstErr error
+	for _, p := range j.policies {
+		res, err := j.apply(ctx, p)
+		results = append(results, res)
+		if err != nil {
+			j.logger.Error("retention policy failed", zap.String("table", p.Table), zap.Int64("deleted", res.Deleted), zap.Error(err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("retention of %s: %w", p.Table, err)
+			}
+			continue
+		}
+		if j.lastRun != nil {
+			j.lastRun.WithLabelValues(p.Table).Set(float64(clock.FromContext(ctx).Now().Unix()))
+		}
+	}
+	return results, firstErr
+}
+
+func (j *Job) apply(ctx context.Context, p Policy) (Result, error) {
+	clk := clock.FromContext(ctx)
+	res := Result{Table: p.Table}
+	cutoff := clk.Now().Add(-p.MaxAge)
+	table := store.QuoteIdentifier(p.Table)
+	where := pgx.Identifier{p.Column}.Sanitize() + " < $1"
+	if p.Where != "" {
+		where += " AND (" + p.Where + ")"
+	}
+
+	if j.dryRun {
+		err := j.db.QueryRow(ctx, "SELECT count(*) FROM "+table+" WHERE "+where, cutoff).Scan(&res.Expired)
+		if err != nil {
+			return res, err
+		}
+		if j.expired != nil {
+			j.expired.WithLabelValues(p.Table).Set(float64(res.Expired))
+		}
+		j.logger.Info("retention dry run", zap.String("table", p.Table), zap.Time("cutoff", cutoff), zap.Int64("expired", res.Expired))
+		return res, nil
+	}
+
+	// ctid picks the rows of a batch without knowing the primary key, skipping rows locked by others.
+	// ctid is only unique within a partition, tableoid tells them apart on partitioned tables
+	batch := "DELETE FROM " + table + " WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM " + table +
+		" WHERE " + where + " LIMIT " + strconv.Itoa(j.batchSize) + " FOR UPDATE SKIP LOCKED)"
+	if p.ArchiveTable != "" {
+		batch = "WITH moved AS (" + batch + " RETURNING *) INSERT INTO " + store.QuoteIdentifier(p.ArchiveTable) + " SELECT * FROM moved"
+	}
+
+	for {
+		tag, err := j.db.Exec(ctx, batch, cutoff)
+		if err != nil {
+			return res, err
+		}
+		n := tag.RowsAffected()
+		res.Deleted += n
+		if j.deleted != nil {
+			j.deleted.WithLabelValues(p.Table).Add(float64(n))
+		}
+		if n < int64(j.batchSize) {
+			break
+		}
+
+		select {
+		case <-clk.After(j.batchPause):
+		case <-ctx.Done():
+			return res, ctx.Err()
+		}
+	}
+
+	j.logger.Info("retention applied", zap.String("table", p.Table), zap.Time("cutoff", cutoff), zap.Int64("deleted", res.Deleted))
+	return res, nil
+}
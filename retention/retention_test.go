@@ -0,0 +1,120 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB deletes up to the batch size of its expired rows per statement.
+type fakeDB struct {
+	expired map[string]int64
+	batch   int64
+	sql     []string
+	args    []interface{}
+}
+
+type countRow struct{ n int64 }
+
+func (r countRow) Scan(dest ...interface{}) error {
+	*dest[0].(*int64) = r.n
+	return nil
+}
+
+func (db *fakeDB) table(sql string) string {
+	for t := range db.expired {
+		if strings.Contains(sql, `FROM "`+t+`"`) {
+			return t
+		}
+	}
+	return ""
+}
+
+func (db *fakeDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (db *fakeDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	db.sql, db.args = append(db.sql, sql), append(db.args, args[0])
+	return countRow{db.expired[db.table(sql)]}
+}
+
+func (db *fakeDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	db.sql, db.args = append(db.sql, sql), append(db.args, args[0])
+	t := db.table(sql)
+	n := db.expired[t]
+	if n > db.batch {
+		n = db.batch
+	}
+	db.expired[t] -= n
+	return pgconn.CommandTag(fmt.Sprintf("DELETE %d", n)), nil
+}
+
+func TestJob(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	fake := goxtest.NewFakeClock(now)
+	ctx := clock.WithContext(context.Background(), fake)
+	policies := WithPolicies(
+		Policy{Table: "sessions", Column: "expires_at", MaxAge: time.Hour},
+		Policy{Table: "events", Column: "created_at", MaxAge: 24 * time.Hour, Where: "kind = 'debug'", ArchiveTable: "events_archive"},
+	)
+
+	{ // dry runs only count expired rows
+		db := &fakeDB{expired: map[string]int64{"sessions": 5, "events": 2}, batch: 2}
+		reg := prometheus.NewRegistry()
+		job, err := NewJob(db, policies, WithDryRun(), WithMetrics(reg))
+		require.NoError(t, err)
+
+		results, err := job.RunOnce(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []Result{{Table: "sessions", Expired: 5}, {Table: "events", Expired: 2}}, results)
+		require.Equal(t, `SELECT count(*) FROM "sessions" WHERE "expires_at" < $1`, db.sql[0])
+		require.Equal(t, now.Add(-time.Hour), db.args[0])
+		require.Equal(t, `SELECT count(*) FROM "events" WHERE "created_at" < $1 AND (kind = 'debug')`, db.sql[1])
+		require.Equal(t, float64(5), testutil.ToFloat64(job.expired.WithLabelValues("sessions")))
+		require.Equal(t, int64(5), db.expired["sessions"])
+	}
+
+	{ // rows are deleted in batches with pauses, archived rows are moved
+		db := &fakeDB{expired: map[string]int64{"sessions": 5, "events": 1}, batch: 2}
+		reg := prometheus.NewRegistry()
+		job, err := NewJob(db, policies, WithBatchSize(2), WithBatchPause(time.Second), WithMetrics(reg))
+		require.NoError(t, err)
+
+		done := make(chan []Result)
+		go func() {
+			results, err := job.RunOnce(ctx)
+			require.NoError(t, err)
+			done <- results
+		}()
+		for i := 0; i < 2; i++ {
+			require.Eventually(t, func() bool { return fake.Waiters() == 1 }, time.Second, time.Millisecond)
+			fake.Advance(time.Second)
+		}
+
+		require.Equal(t, []Result{{Table: "sessions", Deleted: 5}, {Table: "events", Deleted: 1}}, <-done)
+		require.Len(t, db.sql, 4)
+		require.Equal(t, `DELETE FROM "sessions" WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM "sessions" WHERE "expires_at" < $1 LIMIT 2 FOR UPDATE SKIP LOCKED)`, db.sql[0])
+		require.Equal(t, `WITH moved AS (DELETE FROM "events" WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM "events" WHERE "created_at" < $1 AND (kind = 'debug') LIMIT 2 FOR UPDATE SKIP LOCKED) RETURNING *) INSERT INTO "events_archive" SELECT * FROM moved`, db.sql[3])
+		require.Equal(t, float64(5), testutil.ToFloat64(job.deleted.WithLabelValues("sessions")))
+		// the clock moved by the two pauses
+		require.Equal(t, float64(now.Add(2*time.Second).Unix()), testutil.ToFloat64(job.lastRun.WithLabelValues("events")))
+	}
+
+	{ // invalid policies are rejected
+		_, err := NewJob(&fakeDB{}, WithPolicies(Policy{Table: "sessions", Column: "expires_at"}))
+		require.Error(t, err)
+		_, err = NewJob(&fakeDB{}, WithPolicies())
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,155 @@
+package gox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mirzakhany/gox/group"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// DefaultCheckTimeout bounds each dependency check of the Runner.
+const DefaultCheckTimeout = 5 * time.Second
+
+// Component is a long running part of a service, like a http server or a queue consumer. Run must
+// block until ctx is done or the component fails.
+type Component interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// Describer is implemented by components which report highlights of their config, like the port they
+// listen on, for the startup entry of the Runner. secrets must not be included.
+type Describer interface {
+	Describe() map[string]interface{}
+}
+
+type funcComponent struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func (c *funcComponent) Name() string                  { return c.name }
+func (c *funcComponent) Run(ctx context.Context) error { return c.run(ctx) }
+
+// Func returns a component called name running run.
+func Func(name string, run func(ctx context.Context) error) Component {
+	return &funcComponent{name: name, run: run}
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type RunnerOption func(*Runner) error
+
+// WithComponents adds components to the runner.
+func WithComponents(components ...Component) RunnerOption {
+	return func(r *Runner) error {
+		r.components = append(r.components, components...)
+		return nil
+	}
+}
+
+// WithCheck adds a dependency check, like the database being reachable, which must pass before the
+// components start.
+func WithCheck(name string, fn func(ctx context.Context) error) RunnerOption {
+	return func(r *Runner) error {
+		r.checks = append(r.checks, check{name: name, fn: fn})
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) RunnerOption {
+	return func(r *Runner) error {
+		r.logger = logger
+		return nil
+	}
+}
+
+// Runner starts the components of a service after checking its dependencies, and stops all of them
+// when one fails or the context is done.
+type Runner struct {
+	components []Component
+	checks     []check
+	logger     *zap.Logger
+}
+
+// NewRunner returns a runner.
+// example:
+//
+//	runner, err := gox.NewRunner(
+//		gox.WithZapLogger(logger),
+//		gox.WithCheck("database", pool.Ping),
+//		gox.WithComponents(gox.Func("http", func(ctx context.Context) error {
+//			return rest.RunHttpServer(ctx, createHandler, rest.WithPort("8080"))
+//		})))
+//	...
+//	err = runner.Run(ctx)
+func NewRunner(options ...RunnerOption) (*Runner, error) {
+	r := &Runner{logger: zap.NewNop()}
+	for _, o := range options {
+		if err := o(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Run checks the dependencies, logs a single startup entry listing the components, their config
+// highlights and the check results, then runs the components until ctx is done or one fails.
+// the hooks registered with OnShutdown run once the components returned, or when the checks failed
+// since libraries register them as they start, before the checks.
+func (r *Runner) Run(ctx context.Context) error {
+	checks, err := r.runChecks(ctx)
+
+	components := make([]interface{}, len(r.components))
+	for i, c := range r.components {
+		entry := map[string]interface{}{"name": c.Name()}
+		if d, ok := c.(Describer); ok {
+			entry["config"] = d.Describe()
+		}
+		components[i] = entry
+	}
+
+	if err != nil {
+		r.logger.Error("service failed to start", zap.Any("components", components), zap.Any("checks", checks), zap.Error(err))
+		return multierr.Append(err, Shutdown(context.Background(), r.logger))
+	}
+	r.logger.Info("service starting", zap.Any("components", components), zap.Any("checks", checks))
+
+	g, _ := group.New(ctx, group.WithZapLogger(r.logger))
+	for _, c := range r.components {
+		c := c
+		g.Go(c.Name(), c.Run)
+	}
+	err = g.Wait()
+
+	r.logger.Info("service stopping")
+	return multierr.Append(err, Shutdown(context.Background(), r.logger))
+}
+
+// runChecks runs all checks and returns their results by name, "ok" or the error.
+func (r *Runner) runChecks(ctx context.Context) (map[string]string, error) {
+	results := make(map[string]string, len(r.checks))
+	var failed []string
+	for _, c := range r.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, DefaultCheckTimeout)
+		err := c.fn(checkCtx)
+		cancel()
+
+		results[c.name] = "ok"
+		if err != nil {
+			results[c.name] = err.Error()
+			failed = append(failed, c.name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("dependency checks failed: %v", failed)
+	}
+	return results, nil
+}
@@ -0,0 +1,54 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type describedComponent struct{}
+
+func (describedComponent) Name() string                  { return "http" }
+func (describedComponent) Run(ctx context.Context) error { <-ctx.Done(); return nil }
+func (describedComponent) Describe() map[string]interface{} {
+	return map[string]interface{}{"port": "8080"}
+}
+
+func TestRunner(t *testing.T) {
+	{ // startup entry lists components and checks
+		core, logs := observer.New(zap.InfoLevel)
+		ctx, cancel := context.WithCancel(context.Background())
+		r, err := NewRunner(
+			WithZapLogger(zap.New(core)),
+			WithCheck("database", func(ctx context.Context) error { return nil }),
+			WithComponents(describedComponent{}, Func("worker", func(ctx context.Context) error {
+				cancel()
+				return nil
+			})),
+		)
+		require.NoError(t, err)
+		require.NoError(t, r.Run(ctx))
+
+		entry := logs.FilterMessage("service starting").All()[0]
+		require.Equal(t, map[string]string{"database": "ok"}, entry.ContextMap()["checks"])
+		require.Equal(t, []interface{}{
+			map[string]interface{}{"name": "http", "config": map[string]interface{}{"port": "8080"}},
+			map[string]interface{}{"name": "worker"},
+		}, entry.ContextMap()["components"])
+	}
+
+	{ // failed checks keep components from starting
+		started := false
+		r, err := NewRunner(
+			WithCheck("database", func(ctx context.Context) error { return errors.New("connection refused") }),
+			WithComponents(Func("worker", func(ctx context.Context) error { started = true; return nil })),
+		)
+		require.NoError(t, err)
+		require.EqualError(t, r.Run(context.Background()), "dependency checks failed: [database]")
+		require.False(t, started)
+	}
+}
@@ -0,0 +1,269 @@
+// Package scaling reports the backlog of consumers, like taskq queues, in the shape autoscalers read:
+// json for the KEDA metrics-api scaler and prometheus gauges for HPA external metrics.
+package scaling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/mirzakhany/gox/taskq"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultCacheTTL is how long a backlog is reused, so autoscalers polling often do not load the store
+	DefaultCacheTTL = 5 * time.Second
+	// DefaultTimeout bounds reading the backlog of a consumer
+	DefaultTimeout = 3 * time.Second
+)
+
+// Backlog describes the work waiting for the replicas of a consumer.
+type Backlog struct {
+	// Depth is the number of items waiting to be processed
+	Depth int64
+	// InFlight is the number of items being processed
+	InFlight int64
+	// Lag is how long the oldest waiting item waits
+	Lag time.Duration
+	// Rate is the number of items processed per second
+	Rate float64
+}
+
+// Source reads the backlog of a consumer.
+type Source func(ctx context.Context) (Backlog, error)
+
+// TaskQueue reads the backlog of a taskq queue from its store.
+func TaskQueue(store taskq.StatsStore, queue string) Source {
+	return func(ctx context.Context) (Backlog, error) {
+		stats, err := store.Stats(ctx, queue)
+		if err != nil {
+			return Backlog{}, err
+		}
+		return Backlog{Depth: stats.Depth, InFlight: stats.Running, Lag: stats.Lag, Rate: stats.Rate}, nil
+	}
+}
+
+type Option func(*Reporter) error
+
+// WithCacheTTL sets how long a backlog is reused, DefaultCacheTTL by default.
+func WithCacheTTL(d time.Duration) Option {
+	return func(r *Reporter) error {
+		r.cacheTTL = d
+		return nil
+	}
+}
+
+// WithTimeout bounds reading the backlog of a consumer, DefaultTimeout by default.
+func WithTimeout(d time.Duration) Option {
+	return func(r *Reporter) error {
+		if d <= 0 {
+			return errors.New("scaling: timeout must be positive")
+		}
+		r.timeout = d
+		return nil
+	}
+}
+
+// WithMetrics registers gox_scaling_depth, gox_scaling_in_flight, gox_scaling_lag_seconds and
+// gox_scaling_rate gauges labeled by consumer with reg, read from the sources on each scrape. they are
+// the series to expose to an HPA through the prometheus adapter.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(r *Reporter) error {
+		_, err := metrics.Register(reg, &collector{r: r})
+		return err
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(r *Reporter) error {
+		r.logger = logger
+		return nil
+	}
+}
+
+type cached struct {
+	backlog Backlog
+	err     error
+	at      time.Time
+}
+
+// Reporter reads the backlog of named consumers and serves it to autoscalers.
+// example:
+//
+//	r, err := scaling.NewReporter(scaling.WithMetrics(prometheus.DefaultRegisterer))
+//	r.Add("emails", scaling.TaskQueue(tasks, "emails"))
+//	router.Route("/scaling", r.Mount)
+//
+// and the trigger of the KEDA ScaledObject of the email workers, adding a replica per 100 waiting tasks:
+//
+//	triggers:
+//	  - type: metrics-api
+//	    metadata:
+//	      url: "http://api.default.svc:8080/scaling/emails"
+//	      valueLocation: "depth"
+//	      targetValue: "100"
+type Reporter struct {
+	cacheTTL time.Duration
+	timeout  time.Duration
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	sources map[string]Source
+	cache   map[string]cached
+}
+
+func NewReporter(options ...Option) (*Reporter, error) {
+	r := &Reporter{
+		cacheTTL: DefaultCacheTTL,
+		timeout:  DefaultTimeout,
+		logger:   zap.NewNop(),
+		sources:  map[string]Source{},
+		cache:    map[string]cached{},
+	}
+	for _, o := range options {
+		if err := o(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add reports the backlog of consumer name read from source.
+func (r *Reporter) Add(name string, source Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[name] = source
+	delete(r.cache, name)
+}
+
+// Names returns the names of the consumers in order.
+func (r *Reporter) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.sources))
+	for name := range r.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Backlog returns the backlog of consumer name, read at most once per cache ttl.
+func (r *Reporter) Backlog(ctx context.Context, name string) (Backlog, error) {
+	now := clock.FromContext(ctx).Now()
+	r.mu.Lock()
+	source, ok := r.sources[name]
+	c, hit := r.cache[name]
+	r.mu.Unlock()
+	if !ok {
+		return Backlog{}, errs.NotFound("consumer %s not found", name)
+	}
+	if hit && now.Sub(c.at) < r.cacheTTL {
+		return c.backlog, c.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	b, err := source(ctx)
+	if err != nil {
+		r.logger.Warn("read backlog failed", zap.String("consumer", name), zap.Error(err))
+	}
+
+	r.mu.Lock()
+	r.cache[name] = cached{backlog: b, err: err, at: now}
+	r.mu.Unlock()
+	return b, err
+}
+
+// Report is the json of a backlog, the fields are valueLocation of the KEDA metrics-api scaler.
+type Report struct {
+	Name       string  `json:"name"`
+	Depth      int64   `json:"depth"`
+	InFlight   int64   `json:"in_flight"`
+	LagSeconds float64 `json:"lag_seconds"`
+	Rate       float64 `json:"rate"`
+	// Error is the code of the error reading the backlog failed with, only set in the list of all consumers
+	Error string `json:"error,omitempty"`
+}
+
+func newReport(name string, b Backlog) Report {
+	return Report{Name: name, Depth: b.Depth, InFlight: b.InFlight, LagSeconds: b.Lag.Seconds(), Rate: b.Rate}
+}
+
+// Mount adds the endpoints to router:
+//
+//	GET /        the reports of all consumers, as {"consumers": [...]}, with the error of those failing
+//	GET /{name}  the report of a consumer
+func (r *Reporter) Mount(router chi.Router) {
+	router.Get("/", r.list)
+	router.Get("/{name}", r.get)
+}
+
+func (r *Reporter) list(w http.ResponseWriter, req *http.Request) {
+	reports := []Report{}
+	for _, name := range r.Names() {
+		b, err := r.Backlog(req.Context(), name)
+		report := newReport(name, b)
+		if err != nil {
+			report = Report{Name: name, Error: errs.CodeOf(err).String()}
+		}
+		reports = append(reports, report)
+	}
+	rest.WriteJSON(w, http.StatusOK, map[string]interface{}{"consumers": reports})
+}
+
+func (r *Reporter) get(w http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, "name")
+	b, err := r.Backlog(req.Context(), name)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, newReport(name, b))
+}
+
+var (
+	depthDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "scaling", "depth"),
+		"Number of items waiting to be processed by the consumer.", []string{"consumer"}, nil)
+	inFlightDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "scaling", "in_flight"),
+		"Number of items being processed by the consumer.", []string{"consumer"}, nil)
+	lagDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "scaling", "lag_seconds"),
+		"Age of the oldest item waiting for the consumer.", []string{"consumer"}, nil)
+	rateDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "scaling", "rate"),
+		"Number of items processed by the consumer per second.", []string{"consumer"}, nil)
+)
+
+// collector reads the backlogs on each scrape, consumers whose backlog can not be read are left out.
+type collector struct {
+	r *Reporter
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- depthDesc
+	ch <- inFlightDesc
+	ch <- lagDesc
+	ch <- rateDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	for _, name := range c.r.Names() {
+		b, err := c.r.Backlog(context.Background(), name)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(depthDesc, prometheus.GaugeValue, float64(b.Depth), name)
+		ch <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(b.InFlight), name)
+		ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, b.Lag.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(rateDesc, prometheus.GaugeValue, b.Rate, name)
+	}
+}
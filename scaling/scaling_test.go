@@ -0,0 +1,94 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/mirzakhany/gox/taskq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	tasks := taskq.NewMemoryStore()
+	q := taskq.NewQueue(tasks, "emails")
+	for i := 0; i < 3; i++ {
+		_, err := q.Enqueue(ctx, "send", i)
+		require.NoError(t, err)
+	}
+	_, err := q.Enqueue(ctx, "send", "later", taskq.RunAfter(time.Hour))
+	require.NoError(t, err)
+	worker, err := taskq.NewWorker(tasks, "emails")
+	require.NoError(t, err)
+	worker.Handle("send", func(context.Context, *taskq.Task) error { return nil })
+	fake.Advance(30 * time.Second)
+	ok, err := worker.RunNext(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	r, err := NewReporter()
+	require.NoError(t, err)
+	r.Add("emails", TaskQueue(tasks, "emails"))
+	calls := 0
+	r.Add("broken", func(context.Context) (Backlog, error) { calls++; return Backlog{}, errors.New("db is down") })
+
+	router := chi.NewRouter()
+	router.Route("/scaling", r.Mount)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return w
+	}
+
+	{ // the backlog of a task queue
+		w := get("/scaling/emails")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"name": "emails", "depth": 2, "in_flight": 0, "lag_seconds": 30, "rate": 0.016666666666666666}`, w.Body.String())
+		require.Equal(t, http.StatusNotFound, get("/scaling/missing").Code)
+	}
+
+	{ // backlogs are cached, errors too
+		require.Equal(t, http.StatusInternalServerError, get("/scaling/broken").Code)
+		require.Equal(t, 1, calls)
+		fake.Advance(DefaultCacheTTL)
+		get("/scaling/broken")
+		require.Equal(t, 2, calls)
+	}
+
+	{ // the list reports the consumers which failed along with the others
+		w := get("/scaling")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"consumers": [
+			{"name": "broken", "depth": 0, "in_flight": 0, "lag_seconds": 0, "rate": 0, "error": "Unknown"},
+			{"name": "emails", "depth": 2, "in_flight": 0, "lag_seconds": 35, "rate": 0.016666666666666666}
+		]}`, w.Body.String())
+		require.Equal(t, 2, calls)
+	}
+
+	{ // gauges of the consumers whose backlog could be read
+		reg := prometheus.NewRegistry()
+		r, err := NewReporter(WithMetrics(reg))
+		require.NoError(t, err)
+		r.Add("emails", func(context.Context) (Backlog, error) { return Backlog{Depth: 2}, nil })
+		r.Add("broken", func(context.Context) (Backlog, error) { return Backlog{}, errors.New("db is down") })
+
+		err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP gox_scaling_depth Number of items waiting to be processed by the consumer.
+# TYPE gox_scaling_depth gauge
+gox_scaling_depth{consumer="emails"} 2
+`), "gox_scaling_depth")
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,220 @@
+// Package schema keeps the versions of the payloads of each topic, so publishers and consumers agree on
+// them and old payloads are migrated to the version a consumer expects.
+package schema
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// magic is the first byte of encoded payloads, it leaves room to change the format.
+const magic byte = 0
+
+var (
+	ErrUnknownTopic   = errors.New("schema: topic is not registered")
+	ErrUnknownVersion = errors.New("schema: version is not registered")
+	ErrUnknownType    = errors.New("schema: type is not registered for the topic")
+	ErrInvalidPayload = errors.New("schema: payload is not encoded by a registry")
+)
+
+type version struct {
+	number  int
+	typ     reflect.Type
+	codec   Codec
+	migrate func(v interface{}) (interface{}, error)
+}
+
+type topic struct {
+	versions map[int]*version
+	types    map[reflect.Type]*version
+}
+
+// Registry maps topics to the go types of their versions. payloads are encoded with their version, and
+// decoded to the version the consumer asks for by running the migrations between them.
+// example:
+//
+//	r := schema.NewRegistry()
+//	schema.Register[OrderPlacedV1](r, "orders.placed", 1, schema.JSON)
+//	schema.Register[OrderPlacedV2](r, "orders.placed", 2, schema.JSON)
+//	schema.Migrate(r, "orders.placed", 1, func(v OrderPlacedV1) (OrderPlacedV2, error) {
+//		return OrderPlacedV2{ID: v.ID, Total: money.FromCents(v.TotalCents)}, nil
+//	})
+//
+//	// publisher, still on v1
+//	data, err := r.Encode("orders.placed", OrderPlacedV1{ID: "42", TotalCents: 990})
+//	// consumer
+//	order, err := schema.Decode[OrderPlacedV2](r, "orders.placed", data)
+type Registry struct {
+	mu     sync.RWMutex
+	topics map[string]*topic
+}
+
+func NewRegistry() *Registry {
+	return &Registry{topics: map[string]*topic{}}
+}
+
+// Register adds type T as version n of topic, encoded with codec. a type can be only one version of a topic.
+func Register[T any](r *Registry, topicName string, n int, codec Codec) error {
+	if n <= 0 {
+		return fmt.Errorf("schema: version of %s must be positive", topicName)
+	}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.topics[topicName]
+	if t == nil {
+		t = &topic{versions: map[int]*version{}, types: map[reflect.Type]*version{}}
+		r.topics[topicName] = t
+	}
+	if _, ok := t.versions[n]; ok {
+		return fmt.Errorf("schema: version %d of %s is already registered", n, topicName)
+	}
+	if v, ok := t.types[typ]; ok {
+		return fmt.Errorf("schema: %s is already version %d of %s", typ, v.number, topicName)
+	}
+	v := &version{number: n, typ: typ, codec: codec}
+	t.versions[n], t.types[typ] = v, v
+	return nil
+}
+
+// Migrate sets the migration of payloads of topic from version n to version n+1, both must be
+// registered with the types of fn.
+func Migrate[From, To any](r *Registry, topicName string, n int, fn func(v From) (To, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.topics[topicName]
+	if t == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, topicName)
+	}
+	from, to := t.versions[n], t.versions[n+1]
+	if from == nil || to == nil {
+		return fmt.Errorf("%w: migration of %s from %d to %d", ErrUnknownVersion, topicName, n, n+1)
+	}
+	if from.typ != reflect.TypeOf((*From)(nil)).Elem() || to.typ != reflect.TypeOf((*To)(nil)).Elem() {
+		return fmt.Errorf("schema: migration of %s from %d does not convert %s to %s", topicName, n, from.typ, to.typ)
+	}
+	from.migrate = func(v interface{}) (interface{}, error) { return fn(v.(From)) }
+	return nil
+}
+
+// Versions returns the registered versions of topic in order.
+func (r *Registry) Versions(topicName string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t := r.topics[topicName]
+	if t == nil {
+		return nil
+	}
+	versions := make([]int, 0, len(t.versions))
+	for n := range t.versions {
+		versions = append(versions, n)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Encode encodes v with the version of topic its type is registered as, types which are not registered
+// fail instead of publishing payloads consumers do not know.
+func (r *Registry) Encode(topicName string, v interface{}) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t := r.topics[topicName]
+	if t == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTopic, topicName)
+	}
+	ver := t.types[reflect.TypeOf(v)]
+	if ver == nil {
+		return nil, fmt.Errorf("%w: %T of %s", ErrUnknownType, v, topicName)
+	}
+
+	data, err := ver.codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("schema: encode version %d of %s: %w", ver.number, topicName, err)
+	}
+	header := make([]byte, 1, 1+binary.MaxVarintLen64+len(data))
+	header[0] = magic
+	header = binary.AppendUvarint(header, uint64(ver.number))
+	return append(header, data...), nil
+}
+
+// Version returns the version data was encoded with.
+func Version(data []byte) (int, error) {
+	n, _, err := parseHeader(data)
+	return n, err
+}
+
+func parseHeader(data []byte) (int, []byte, error) {
+	if len(data) == 0 || data[0] != magic {
+		return 0, nil, ErrInvalidPayload
+	}
+	n, size := binary.Uvarint(data[1:])
+	if size <= 0 {
+		return 0, nil, ErrInvalidPayload
+	}
+	return int(n), data[1+size:], nil
+}
+
+// Decode decodes data into T, migrating it from the version it was encoded with to the version of T.
+// payloads of later versions than T fail, as they can not be migrated back.
+func Decode[T any](r *Registry, topicName string, data []byte) (T, error) {
+	var zero T
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t := r.topics[topicName]
+	if t == nil {
+		return zero, fmt.Errorf("%w: %s", ErrUnknownTopic, topicName)
+	}
+	target := t.types[reflect.TypeOf((*T)(nil)).Elem()]
+	if target == nil {
+		return zero, fmt.Errorf("%w: %T of %s", ErrUnknownType, zero, topicName)
+	}
+
+	n, payload, err := parseHeader(data)
+	if err != nil {
+		return zero, err
+	}
+	ver := t.versions[n]
+	if ver == nil {
+		return zero, fmt.Errorf("%w: %d of %s", ErrUnknownVersion, n, topicName)
+	}
+	if n > target.number {
+		return zero, fmt.Errorf("schema: can not decode version %d of %s as version %d", n, topicName, target.number)
+	}
+
+	v, err := ver.decode(payload)
+	if err != nil {
+		return zero, fmt.Errorf("schema: decode version %d of %s: %w", n, topicName, err)
+	}
+	for ver.number < target.number {
+		if ver.migrate == nil {
+			return zero, fmt.Errorf("schema: no migration of %s from version %d", topicName, ver.number)
+		}
+		if v, err = ver.migrate(v); err != nil {
+			return zero, fmt.Errorf("schema: migrate %s from version %d: %w", topicName, ver.number, err)
+		}
+		ver = t.versions[ver.number+1]
+	}
+	return v.(T), nil
+}
+
+// decode decodes payload into a value of the type of the version, pointer types like protobuf messages
+// are allocated.
+func (v *version) decode(payload []byte) (interface{}, error) {
+	if v.typ.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.typ.Elem())
+		if err := v.codec.Unmarshal(payload, ptr.Interface()); err != nil {
+			return nil, err
+		}
+		return ptr.Interface(), nil
+	}
+	ptr := reflect.New(v.typ)
+	if err := v.codec.Unmarshal(payload, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type orderV1 struct {
+	ID         string `json:"id"`
+	TotalCents int64  `json:"total_cents"`
+}
+
+type orderV2 struct {
+	ID    string  `json:"id"`
+	Total float64 `json:"total"`
+}
+
+type orderV3 struct {
+	ID       string  `json:"id"`
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency"`
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, Register[orderV1](r, "orders", 1, JSON))
+	require.NoError(t, Register[orderV2](r, "orders", 2, JSON))
+	require.NoError(t, Register[orderV3](r, "orders", 3, JSON))
+	require.NoError(t, Migrate(r, "orders", 1, func(v orderV1) (orderV2, error) {
+		return orderV2{ID: v.ID, Total: float64(v.TotalCents) / 100}, nil
+	}))
+	require.NoError(t, Migrate(r, "orders", 2, func(v orderV2) (orderV3, error) {
+		return orderV3{ID: v.ID, Total: v.Total, Currency: "EUR"}, nil
+	}))
+	require.Equal(t, []int{1, 2, 3}, r.Versions("orders"))
+
+	{ // registrations are checked
+		require.Error(t, Register[orderV1](r, "orders", 4, JSON))
+		require.Error(t, Register[string](r, "orders", 2, JSON))
+		require.Error(t, Migrate(r, "orders", 1, func(v orderV2) (orderV3, error) { return orderV3{}, nil }))
+		require.ErrorIs(t, Migrate(r, "orders", 3, func(v orderV3) (orderV3, error) { return v, nil }), ErrUnknownVersion)
+	}
+
+	{ // old payloads are migrated to the version of the consumer
+		data, err := r.Encode("orders", orderV1{ID: "42", TotalCents: 990})
+		require.NoError(t, err)
+		n, err := Version(data)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		v1, err := Decode[orderV1](r, "orders", data)
+		require.NoError(t, err)
+		require.Equal(t, orderV1{ID: "42", TotalCents: 990}, v1)
+
+		v3, err := Decode[orderV3](r, "orders", data)
+		require.NoError(t, err)
+		require.Equal(t, orderV3{ID: "42", Total: 9.9, Currency: "EUR"}, v3)
+	}
+
+	{ // newer payloads can not be decoded by old consumers
+		data, err := r.Encode("orders", orderV3{ID: "42"})
+		require.NoError(t, err)
+		_, err = Decode[orderV2](r, "orders", data)
+		require.Error(t, err)
+	}
+
+	{ // unregistered types and drifted payloads fail
+		_, err := r.Encode("orders", map[string]string{"id": "42"})
+		require.ErrorIs(t, err, ErrUnknownType)
+		_, err = r.Encode("payments", orderV1{})
+		require.ErrorIs(t, err, ErrUnknownTopic)
+
+		drifted := append([]byte{magic, 2}, `{"id":"42","total":1,"discount":2}`...)
+		_, err = Decode[orderV2](r, "orders", drifted)
+		require.Error(t, err)
+
+		_, err = Decode[orderV2](r, "orders", []byte(`{"id":"42"}`))
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	}
+
+	{ // failing migrations
+		r := NewRegistry()
+		require.NoError(t, Register[orderV1](r, "orders", 1, JSON))
+		require.NoError(t, Register[orderV2](r, "orders", 2, JSON))
+		data, err := r.Encode("orders", orderV1{ID: "42"})
+		require.NoError(t, err)
+		_, err = Decode[orderV2](r, "orders", data)
+		require.Error(t, err)
+
+		require.NoError(t, Migrate(r, "orders", 1, func(v orderV1) (orderV2, error) { return orderV2{}, errors.New("no total") }))
+		_, err = Decode[orderV2](r, "orders", data)
+		require.Error(t, err)
+	}
+}
+
+func TestRegistryProto(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, Register[*wrapperspb.StringValue](r, "names", 1, Proto))
+
+	data, err := r.Encode("names", wrapperspb.String("gox"))
+	require.NoError(t, err)
+	v, err := Decode[*wrapperspb.StringValue](r, "names", data)
+	require.NoError(t, err)
+	require.Equal(t, "gox", v.GetValue())
+}
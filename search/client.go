@@ -0,0 +1,179 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/os"
+	"github.com/mirzakhany/gox/probe"
+	"go.uber.org/zap"
+)
+
+const DefaultProbeTimeout = 3 * time.Second
+
+var ErrNotFound = errors.New("document not found")
+
+// Config holds the connection settings of an opensearch or elasticsearch cluster.
+type Config struct {
+	URLs       []string      `env:"SEARCH_URLS,required" envSeparator:"," envDefault:"http://localhost:9200"`
+	Username   string        `env:"SEARCH_USERNAME"`
+	Password   string        `env:"SEARCH_PASSWORD"`
+	MaxRetries int           `env:"SEARCH_MAX_RETRIES" envDefault:"3"`
+	Timeout    time.Duration `env:"SEARCH_TIMEOUT" envDefault:"10s"`
+}
+
+type config struct {
+	client *http.Client
+	logger *zap.Logger
+}
+
+type Option func(*config) error
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) error {
+		c.client = client
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(c *config) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// Client is a minimal client of the opensearch/elasticsearch rest api. requests are retried on
+// network errors and 5xx responses, rotating through the configured urls.
+type Client struct {
+	conf   Config
+	http   *http.Client
+	logger *zap.Logger
+	next   uint32
+}
+
+// ResponseError is returned when the cluster responds with a non 2xx status.
+type ResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("search request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// NewClient creates a client, c will be loaded from env if nil.
+func NewClient(c *Config, options ...Option) (*Client, error) {
+	if c == nil {
+		c = &Config{}
+		if err := os.LoadFromEnv(c); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.URLs) == 0 {
+		return nil, errors.New("at least one search url is required")
+	}
+
+	cfg := &config{logger: zap.NewNop()}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.client == nil {
+		cfg.client = &http.Client{Timeout: c.Timeout}
+	}
+
+	return &Client{conf: *c, http: cfg.client, logger: cfg.logger}, nil
+}
+
+// Ping checks if the cluster is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Do(ctx, http.MethodGet, "/", nil, nil)
+}
+
+// Probe returns a readiness probe which fails when the cluster is not reachable.
+func (c *Client) Probe() probe.Probe {
+	return probe.WithProbe(probe.Readiness, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultProbeTimeout)
+		defer cancel()
+		return c.Ping(ctx)
+	})
+}
+
+// Do sends a request with body encoded as json and decodes the response into out if not nil.
+// server errors are retried with backoff, waiting on the clock of ctx.
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt <= c.conf.MaxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
+			c.logger.Warn("retry search request", zap.String("method", method), zap.String("path", path),
+				zap.Int("attempt", attempt), zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-clock.FromContext(ctx).After(backoff):
+			}
+		}
+
+		var retry bool
+		if retry, err = c.do(ctx, method, path, payload, out); !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload []byte, out interface{}) (bool, error) {
+	base := c.conf.URLs[int(atomic.AddUint32(&c.next, 1)-1)%len(c.conf.URLs)]
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.conf.Username != "" {
+		req.SetBasicAuth(c.conf.Username, c.conf.Password)
+	}
+
+	clk := clock.FromContext(ctx)
+	t0 := clk.Now()
+	res, err := c.http.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	c.logger.Debug("search request handled", zap.String("method", method), zap.String("path", path),
+		zap.Int("code", res.StatusCode), zap.Duration("latency", clk.Since(t0)))
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return res.StatusCode >= http.StatusInternalServerError, &ResponseError{StatusCode: res.StatusCode, Body: string(b)}
+	}
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	return false, json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// Index gives typed access to documents of an index.
+type Index[T any] struct {
+	client *Client
+	name   string
+}
+
+func NewIndex[T any](client *Client, name string) *Index[T] {
+	return &Index[T]{client: client, name: name}
+}
+
+// Hit is a document matched by a search.
+type Hit[T any] struct {
+	ID     string  `json:"_id"`
+	Score  float64 `json:"_score"`
+	Source T       `json:"_source"`
+	// Highlight holds highlighted fragments per field when requested by the query
+	Highlight map[string][]string `json:"highlight,omitempty"`
+}
+
+type Result[T any] struct {
+	Total int64
+	Hits  []Hit[T]
+}
+
+// Create creates the index with given settings and mappings, body can be nil.
+func (i *Index[T]) Create(ctx context.Context, body interface{}) error {
+	return i.client.Do(ctx, http.MethodPut, "/"+url.PathEscape(i.name), body, nil)
+}
+
+// Put creates or replaces the document with given id.
+func (i *Index[T]) Put(ctx context.Context, id string, doc T) error {
+	return i.client.Do(ctx, http.MethodPut, i.docPath(id), doc, nil)
+}
+
+// Get returns the document with given id or ErrNotFound.
+func (i *Index[T]) Get(ctx context.Context, id string) (T, error) {
+	var out struct {
+		Source T `json:"_source"`
+	}
+	err := i.client.Do(ctx, http.MethodGet, i.docPath(id), nil, &out)
+	return out.Source, notFound(err)
+}
+
+// Delete removes the document with given id. deleting a missing document returns ErrNotFound.
+func (i *Index[T]) Delete(ctx context.Context, id string) error {
+	return notFound(i.client.Do(ctx, http.MethodDelete, i.docPath(id), nil, nil))
+}
+
+// Search runs query, which is the json body of a _search request.
+// example:
+//
+//	res, err := index.Search(ctx, map[string]interface{}{
+//		"query": map[string]interface{}{"match": map[string]interface{}{"name": "foo"}},
+//		"from":  0, "size": 20,
+//	})
+func (i *Index[T]) Search(ctx context.Context, query interface{}) (*Result[T], error) {
+	var out struct {
+		Hits struct {
+			Total json.RawMessage `json:"total"`
+			Hits  []Hit[T]        `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := i.client.Do(ctx, http.MethodPost, "/"+url.PathEscape(i.name)+"/_search", query, &out); err != nil {
+		return nil, err
+	}
+
+	// total is a number in older versions and an object in newer ones
+	var total struct {
+		Value int64 `json:"value"`
+	}
+	if err := json.Unmarshal(out.Hits.Total, &total); err != nil {
+		if err := json.Unmarshal(out.Hits.Total, &total.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result[T]{Total: total.Value, Hits: out.Hits.Hits}, nil
+}
+
+func (i *Index[T]) docPath(id string) string {
+	return "/" + url.PathEscape(i.name) + "/_doc/" + url.PathEscape(id)
+}
+
+func notFound(err error) error {
+	var rerr *ResponseError
+	if errors.As(err, &rerr) && rerr.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
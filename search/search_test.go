@@ -0,0 +1,71 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type product struct {
+	Name string `json:"name"`
+}
+
+func TestIndex(t *testing.T) {
+	calls, failNext := 0, true
+	docs := map[string]json.RawMessage{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// first call fails to check retries
+		if failNext {
+			failNext = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/products/_doc/1":
+			var doc json.RawMessage
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&doc))
+			docs["1"] = doc
+		case r.Method == http.MethodGet && r.URL.Path == "/products/_doc/2":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"found": false}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/products/_search":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"hits": map[string]interface{}{
+					"total": map[string]interface{}{"value": 1},
+					"hits":  []interface{}{map[string]interface{}{"_id": "1", "_score": 1.5, "_source": docs["1"]}},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(&Config{URLs: []string{srv.URL}, MaxRetries: 1})
+	require.NoError(t, err)
+
+	index := NewIndex[product](client, "products")
+	require.NoError(t, index.Put(context.Background(), "1", product{Name: "foo"}))
+	require.Equal(t, 2, calls)
+
+	_, err = index.Get(context.Background(), "2")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	res, err := index.Search(context.Background(), map[string]interface{}{"query": map[string]interface{}{"match_all": struct{}{}}})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res.Total)
+	require.Equal(t, "1", res.Hits[0].ID)
+	require.Equal(t, product{Name: "foo"}, res.Hits[0].Source)
+
+	// bad requests should not be retried
+	calls = 0
+	err = client.Do(context.Background(), http.MethodGet, "/unknown", nil, nil)
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/ctxutil"
+	"go.uber.org/zap"
+)
+
+// DefaultSyncReconnectDelay is the wait before listening again after losing the database connection.
+const DefaultSyncReconnectDelay = 5 * time.Second
+
+// Loader loads the document with given id from the database. found must be false if the row is deleted.
+type Loader[T any] func(ctx context.Context, id string) (doc T, found bool, err error)
+
+// Sync keeps index in sync with a postgres table. it listens to channel for notifications whose payload
+// is the id of a changed row, loads the row using load and puts it into the index, or deletes it from
+// the index if the row is gone. it blocks until ctx is canceled.
+// notifications are usually sent by a trigger:
+//
+//	create function notify_users() returns trigger as $$
+//	begin
+//		perform pg_notify('users_changed', coalesce(new.id, old.id)::text);
+//		return null;
+//	end $$ language plpgsql;
+//
+//	create trigger users_changed after insert or update or delete on users
+//		for each row execute function notify_users();
+func Sync[T any](ctx context.Context, pool *pgxpool.Pool, channel string, index *Index[T], load Loader[T], logger *zap.Logger) error {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	for {
+		err := listen(ctx, pool, channel, func(id string) {
+			if err := syncDoc(ctx, index, load, id); err != nil {
+				logger.Error("sync search document failed", zap.String("index", index.name), zap.String("id", id), zap.Error(err))
+			}
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		logger.Error("search sync lost database connection", zap.String("channel", channel), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(DefaultSyncReconnectDelay):
+		}
+	}
+}
+
+func syncDoc[T any](ctx context.Context, index *Index[T], load Loader[T], id string) error {
+	doc, found, err := load(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		if err := index.Delete(ctx, id); err != nil && err != ErrNotFound {
+			return err
+		}
+		return nil
+	}
+	return index.Put(ctx, id, doc)
+}
+
+// unlistenTimeout bounds the UNLISTEN run before a listening connection goes back to the pool.
+const unlistenTimeout = 5 * time.Second
+
+func listen(ctx context.Context, pool *pgxpool.Pool, channel string, handle func(payload string)) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// pooled connections must not keep listening, others would queue notifications nobody reads
+		cleanupCtx, cancel := ctxutil.WithMinTimeout(ctx, unlistenTimeout)
+		defer cancel()
+		if _, err := conn.Exec(cleanupCtx, "UNLISTEN *"); err != nil {
+			_ = conn.Conn().Close(cleanupCtx)
+		}
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "listen "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(n.Payload)
+	}
+}
@@ -0,0 +1,99 @@
+package gox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// DefaultShutdownHookTimeout bounds each shutdown hook.
+const DefaultShutdownHookTimeout = 10 * time.Second
+
+// priorities of shutdown hooks, lower ones run first: servers stop taking work, then workers finish
+// theirs, then the stores and exporters they used are closed.
+const (
+	ShutdownPriorityServers   = 0
+	ShutdownPriorityWorkers   = 100
+	ShutdownPriorityStores    = 200
+	ShutdownPriorityTelemetry = 300
+)
+
+type shutdownHook struct {
+	name     string
+	priority int
+	fn       func(ctx context.Context) error
+}
+
+var (
+	shutdownMu    sync.Mutex
+	shutdownHooks []shutdownHook
+)
+
+// OnShutdown registers fn to run when the Runner stops, after its components returned. hooks run one
+// by one in priority order, hooks with the same priority in the order they were registered.
+// example:
+//
+//	pool, err := store.NewPgPool(ctx, nil)
+//	...
+//	gox.OnShutdown("postgres", gox.ShutdownPriorityStores, func(ctx context.Context) error {
+//		pool.Close()
+//		return nil
+//	})
+func OnShutdown(name string, priority int, fn func(ctx context.Context) error) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownHooks = append(shutdownHooks, shutdownHook{name: name, priority: priority, fn: fn})
+}
+
+// Shutdown runs the registered hooks and forgets them, each is given DefaultShutdownHookTimeout.
+// failed hooks do not stop the others, their errors are combined. the Runner calls it, services
+// which do not use one must call it before exiting.
+func Shutdown(ctx context.Context, logger *zap.Logger) error {
+	shutdownMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownMu.Unlock()
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].priority < hooks[j].priority })
+
+	var errs error
+	for _, h := range hooks {
+		hookCtx, cancel := context.WithTimeout(ctx, DefaultShutdownHookTimeout)
+		t0 := time.Now()
+		err := runHook(hookCtx, h.fn)
+		cancel()
+
+		fields := []zap.Field{zap.String("hook", h.name), zap.Int("priority", h.priority), zap.Duration("duration", time.Since(t0))}
+		if err != nil {
+			logger.Error("shutdown hook failed", append(fields, zap.Error(err))...)
+			errs = multierr.Append(errs, fmt.Errorf("shutdown hook %s: %w", h.name, err))
+			continue
+		}
+		logger.Info("shutdown hook done", fields...)
+	}
+	return errs
+}
+
+// runHook returns when fn does or its timeout is over, a hook which ignores ctx can not block the others.
+func runHook(ctx context.Context, fn func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,46 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	var order []string
+	hook := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return err
+		}
+	}
+
+	OnShutdown("tracer", ShutdownPriorityTelemetry, hook("tracer", nil))
+	OnShutdown("pool", ShutdownPriorityStores, hook("pool", errors.New("close failed")))
+	OnShutdown("http", ShutdownPriorityServers, hook("http", nil))
+	OnShutdown("cache", ShutdownPriorityStores, hook("cache", nil))
+
+	r, err := NewRunner(WithComponents(Func("worker", func(ctx context.Context) error { return nil })))
+	require.NoError(t, err)
+
+	require.EqualError(t, r.Run(context.Background()), "shutdown hook pool: close failed")
+	require.Equal(t, []string{"http", "pool", "cache", "tracer"}, order)
+
+	{ // hooks run once
+		require.NoError(t, Shutdown(context.Background(), nil))
+		require.Len(t, order, 4)
+	}
+
+	{ // hooks run when the checks fail too
+		OnShutdown("pool", ShutdownPriorityStores, hook("pool", nil))
+		r, err := NewRunner(
+			WithCheck("database", func(ctx context.Context) error { return errors.New("connection refused") }),
+			WithComponents(Func("worker", func(ctx context.Context) error { return nil })),
+		)
+		require.NoError(t, err)
+		require.EqualError(t, r.Run(context.Background()), "dependency checks failed: [database]")
+		require.Equal(t, "pool", order[len(order)-1])
+	}
+}
@@ -0,0 +1,119 @@
+package snapshot
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxImportSize limits the size of archives posted to the import endpoint.
+const DefaultMaxImportSize = 1 << 30
+
+// Authorizer decides whether the request may export or import snapshots, a returned error is written
+// with status 403 unless it carries its own code, see errs.CodeOf.
+type Authorizer func(r *http.Request) error
+
+// WithAuthorizer is called for every request of the handler before it is handled.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(s *Snapshotter) error {
+		s.authorize = authorize
+		return nil
+	}
+}
+
+// WithMaxImportSize limits the size of archives posted to the import endpoint, DefaultMaxImportSize by default.
+func WithMaxImportSize(n int64) Option {
+	return func(s *Snapshotter) error {
+		s.maxImportSize = n
+		return nil
+	}
+}
+
+// Handler serves GET /export, which downloads a snapshot of the comma separated tables and prefixes
+// query parameters, and POST /import, which restores the posted snapshot. both are meant for internal
+// admin servers.
+// example:
+//
+//	curl -o acme.tar.gz "http://admin:9090/snapshots/export?tables=orgs,orders&prefixes=attachments/acme/"
+//	curl --data-binary @acme.tar.gz http://localhost:9090/snapshots/import
+func (s *Snapshotter) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Use(s.authorized)
+	router.Get("/export", s.export)
+	router.Post("/import", s.importArchive)
+	return router
+}
+
+func (s *Snapshotter) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authorize != nil {
+			if err := s.authorize(r); err != nil {
+				if errs.CodeOf(err) == errs.CodeUnknown {
+					err = errs.WithCode(err, errs.CodePermissionDenied)
+				}
+				rest.WriteErr(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Snapshotter) export(w http.ResponseWriter, r *http.Request) {
+	sel := Selection{Tables: splitList(r.URL.Query().Get("tables")), Prefixes: splitList(r.URL.Query().Get("prefixes"))}
+
+	name := fmt.Sprintf("snapshot-%s.tar.gz", clock.FromContext(r.Context()).Now().UTC().Format("20060102T150405Z"))
+	sw := &startWriter{ResponseWriter: w, start: func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	}}
+	if _, err := s.Export(r.Context(), sw, sel); err != nil {
+		if !sw.started {
+			rest.WriteErr(w, err)
+			return
+		}
+		// the status is sent, the truncated archive fails the gzip checksum on import
+		s.logger.Error("snapshot export failed", zap.Error(err))
+	}
+}
+
+func (s *Snapshotter) importArchive(w http.ResponseWriter, r *http.Request) {
+	m, err := s.Import(r.Context(), http.MaxBytesReader(w, r.Body, s.maxImportSize))
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, m)
+}
+
+// startWriter calls start before the first write, so errors before any content can still be written
+// with their own status.
+type startWriter struct {
+	http.ResponseWriter
+	start   func(w http.ResponseWriter)
+	started bool
+}
+
+func (w *startWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.start(w.ResponseWriter)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,457 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	stdos "os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/blob"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+	"go.uber.org/zap"
+)
+
+// FormatVersion is the version of the archive layout, archives of other versions are refused.
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	tablesDir    = "tables/"
+	blobsDir     = "blobs/"
+
+	contentTypeRecord = "GOX.content_type"
+)
+
+// Table is a table snapshots may include. Where limits the exported rows, like to the data of one
+// organization, it is sql and must never come from requests.
+type Table struct {
+	Name  string
+	Where string
+}
+
+// Manifest describes a snapshot, it is the first entry of the archive.
+type Manifest struct {
+	Format int `json:"format"`
+	// SchemaVersion is the last migration applied to the database, see store.SchemaVersion
+	SchemaVersion int64     `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Tables        []string  `json:"tables"`
+	Blobs         []string  `json:"blobs"`
+}
+
+// Selection picks what a snapshot includes, of the configured tables and prefixes. empty lists
+// select all of them.
+type Selection struct {
+	Tables   []string
+	Prefixes []string
+}
+
+type Option func(*Snapshotter) error
+
+// WithTables sets the tables snapshots may include. they are restored in this order, so tables must
+// come after the tables their foreign keys refer to.
+func WithTables(tables ...Table) Option {
+	return func(s *Snapshotter) error {
+		if s.db == nil {
+			return errors.New("snapshot: tables need a database")
+		}
+		s.tables = append(s.tables, tables...)
+		return nil
+	}
+}
+
+// WithBucket sets the bucket and the key prefixes of objects snapshots may include.
+func WithBucket(b blob.Bucket, prefixes ...string) Option {
+	return func(s *Snapshotter) error {
+		s.bucket = b
+		s.prefixes = append(s.prefixes, prefixes...)
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(s *Snapshotter) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// Snapshotter exports selected tables and blob prefixes as gzipped tar archives and restores them, so
+// support engineers can reproduce the state of a customer locally.
+type Snapshotter struct {
+	db       *pgxpool.Pool
+	tables   []Table
+	bucket   blob.Bucket
+	prefixes []string
+	logger   *zap.Logger
+
+	authorize     Authorizer
+	maxImportSize int64
+}
+
+// New returns a snapshotter of db, which may be nil for snapshots of blobs only.
+// example:
+//
+//	snapshots, err := snapshot.New(pool,
+//		snapshot.WithTables(snapshot.Table{Name: "orgs"}, snapshot.Table{Name: "orders", Where: "created_at > now() - interval '30 days'"}),
+//		snapshot.WithBucket(s3, "attachments/"))
+//	adminRouter.Mount("/snapshots", snapshots.Handler())
+func New(db *pgxpool.Pool, options ...Option) (*Snapshotter, error) {
+	s := &Snapshotter{db: db, logger: zap.NewNop(), maxImportSize: DefaultMaxImportSize}
+	for _, o := range options {
+		if err := o(s); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.tables) == 0 && len(s.prefixes) == 0 {
+		return nil, errors.New("snapshot: no tables or blob prefixes")
+	}
+	return s, nil
+}
+
+// Export writes a snapshot of sel to w. tables are read in one repeatable read transaction, so they
+// are consistent with each other.
+func (s *Snapshotter) Export(ctx context.Context, w io.Writer, sel Selection) (*Manifest, error) {
+	tables, err := s.selectTables(sel.Tables)
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := s.selectPrefixes(sel.Prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Format: FormatVersion, CreatedAt: clock.FromContext(ctx).Now().UTC(), Tables: []string{}, Blobs: []string{}}
+	for _, t := range tables {
+		m.Tables = append(m.Tables, t.Name)
+	}
+	for _, p := range prefixes {
+		keys, err := s.bucket.List(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		m.Blobs = append(m.Blobs, keys...)
+	}
+
+	var tx pgx.Tx
+	if len(tables) > 0 {
+		if m.SchemaVersion, err = store.SchemaVersion(ctx, s.db); err != nil {
+			return nil, err
+		}
+		tx, err = s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = tx.Rollback(context.Background()) }()
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, "", m.CreatedAt, strings.NewReader(string(manifest)), int64(len(manifest))); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tables {
+		sql := "COPY " + store.QuoteIdentifier(t.Name) + " TO STDOUT WITH (FORMAT csv, HEADER)"
+		if t.Where != "" {
+			sql = "COPY (SELECT * FROM " + store.QuoteIdentifier(t.Name) + " WHERE " + t.Where + ") TO STDOUT WITH (FORMAT csv, HEADER)"
+		}
+		err := spooled(func(w io.Writer) error {
+			_, err := tx.Conn().PgConn().CopyTo(ctx, w, sql)
+			return err
+		}, func(r io.Reader, size int64) error {
+			return writeEntry(tw, tablesDir+t.Name+".csv", "", m.CreatedAt, r, size)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: export table %s: %w", t.Name, err)
+		}
+	}
+
+	for _, key := range m.Blobs {
+		body, contentType, err := s.bucket.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		err = spooled(func(w io.Writer) error {
+			_, err := io.Copy(w, body)
+			return err
+		}, func(r io.Reader, size int64) error {
+			return writeEntry(tw, blobsDir+key, contentType, m.CreatedAt, r, size)
+		})
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: export blob %s: %w", key, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	s.logger.Info("snapshot exported", zap.Strings("tables", m.Tables), zap.Int("blobs", len(m.Blobs)),
+		zap.Int64("schema_version", m.SchemaVersion))
+	return m, nil
+}
+
+// Import restores the snapshot in r. it is refused unless the schema of the database has the version
+// of the snapshot. the tables of the snapshot are truncated and restored in one transaction, the blobs
+// are spooled to temporary files and only written once it committed, so a failed import changes nothing
+// but a failing blob write, after which importing again finishes the restore.
+func (s *Snapshotter) Import(ctx context.Context, r io.Reader) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errs.Invalid("snapshot is not gzipped: %s", err)
+	}
+	tr := tar.NewReader(gz)
+
+	m, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.selectTables(m.Tables); err != nil {
+		return nil, err
+	}
+	for _, key := range m.Blobs {
+		if !s.allowedKey(key) {
+			return nil, errs.Invalid("blob %s is not under a configured prefix", key)
+		}
+	}
+
+	var tx pgx.Tx
+	if len(m.Tables) > 0 {
+		version, err := store.SchemaVersion(ctx, s.db)
+		if err != nil {
+			return nil, err
+		}
+		if version != m.SchemaVersion {
+			return nil, errs.New(errs.CodeFailedPrecondition, "snapshot has schema version %d but the database has %d", m.SchemaVersion, version)
+		}
+
+		tx, err = s.db.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = tx.Rollback(context.Background()) }()
+
+		names := make([]string, len(m.Tables))
+		for i, t := range m.Tables {
+			names[i] = store.QuoteIdentifier(t)
+		}
+		if _, err := tx.Exec(ctx, "TRUNCATE "+strings.Join(names, ", ")); err != nil {
+			return nil, err
+		}
+	}
+
+	var blobs []spooledBlob
+	defer func() {
+		for _, b := range blobs {
+			removeSpooled(b.file)
+		}
+	}()
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errs.Invalid("invalid snapshot: %s", err)
+		}
+
+		switch {
+		case strings.HasPrefix(hdr.Name, tablesDir):
+			table := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, tablesDir), ".csv")
+			if !contains(m.Tables, table) {
+				return nil, errs.Invalid("table %s is not in the manifest", table)
+			}
+			if _, err := tx.Conn().PgConn().CopyFrom(ctx, tr, "COPY "+store.QuoteIdentifier(table)+" FROM STDIN WITH (FORMAT csv, HEADER)"); err != nil {
+				return nil, fmt.Errorf("snapshot: import table %s: %w", table, err)
+			}
+		case strings.HasPrefix(hdr.Name, blobsDir):
+			key := strings.TrimPrefix(hdr.Name, blobsDir)
+			if !contains(m.Blobs, key) {
+				return nil, errs.Invalid("blob %s is not in the manifest", key)
+			}
+			f, err := spool(tr)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot: import blob %s: %w", key, err)
+			}
+			blobs = append(blobs, spooledBlob{key: key, contentType: hdr.PAXRecords[contentTypeRecord], file: f})
+		default:
+			return nil, errs.Invalid("unexpected snapshot entry %s", hdr.Name)
+		}
+	}
+
+	if tx != nil {
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range blobs {
+		size, err := b.file.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = b.file.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			err = s.bucket.Put(ctx, b.key, b.file, size, b.contentType)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: import blob %s: %w", b.key, err)
+		}
+	}
+	s.logger.Info("snapshot imported", zap.Strings("tables", m.Tables), zap.Int("blobs", len(m.Blobs)),
+		zap.Int64("schema_version", m.SchemaVersion), zap.Time("created_at", m.CreatedAt))
+	return m, nil
+}
+
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, errs.Invalid("invalid snapshot: %s", err)
+	}
+	if hdr.Name != manifestName {
+		return nil, errs.Invalid("snapshot must start with %s", manifestName)
+	}
+
+	var m Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, 64<<20)).Decode(&m); err != nil {
+		return nil, errs.Invalid("invalid snapshot manifest: %s", err)
+	}
+	if m.Format != FormatVersion {
+		return nil, errs.New(errs.CodeFailedPrecondition, "snapshot format %d is not supported, expected %d", m.Format, FormatVersion)
+	}
+	return &m, nil
+}
+
+func (s *Snapshotter) selectTables(names []string) ([]Table, error) {
+	if len(names) == 0 {
+		return s.tables, nil
+	}
+	// keep the configured order, which is the restore order
+	var tables []Table
+	for _, t := range s.tables {
+		if contains(names, t.Name) {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) != len(names) {
+		return nil, errs.Invalid("snapshots can only include the tables %s", strings.Join(s.tableNames(), ", "))
+	}
+	return tables, nil
+}
+
+func (s *Snapshotter) selectPrefixes(prefixes []string) ([]string, error) {
+	if len(prefixes) == 0 {
+		return s.prefixes, nil
+	}
+	for _, p := range prefixes {
+		if !s.allowedKey(p) {
+			return nil, errs.Invalid("prefix %s is not under a configured prefix", p)
+		}
+	}
+	return prefixes, nil
+}
+
+func (s *Snapshotter) allowedKey(key string) bool {
+	if path.Clean("/"+key) != "/"+strings.TrimSuffix(key, "/") {
+		return false
+	}
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Snapshotter) tableNames() []string {
+	names := make([]string, len(s.tables))
+	for i, t := range s.tables {
+		names[i] = t.Name
+	}
+	return names
+}
+
+type spooledBlob struct {
+	key         string
+	contentType string
+	file        *stdos.File
+}
+
+// spool copies r to a temporary file, which removeSpooled removes.
+func spool(r io.Reader) (*stdos.File, error) {
+	f, err := stdos.CreateTemp("", "gox-snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		removeSpooled(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+func removeSpooled(f *stdos.File) {
+	f.Close()
+	_ = stdos.Remove(f.Name())
+}
+
+// spooled writes the output of produce to a temporary file and passes it to consume, tar entries need
+// their size before their content.
+func spooled(produce func(w io.Writer) error, consume func(r io.Reader, size int64) error) error {
+	f, err := stdos.CreateTemp("", "gox-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer removeSpooled(f)
+
+	if err := produce(f); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return consume(f, size)
+}
+
+func writeEntry(tw *tar.Writer, name, contentType string, modTime time.Time, r io.Reader, size int64) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: modTime, Format: tar.FormatPAX}
+	if contentType != "" {
+		hdr.PAXRecords = map[string]string{contentTypeRecord: contentType}
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
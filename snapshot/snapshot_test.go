@@ -0,0 +1,266 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryBucket struct {
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func newMemoryBucket() *memoryBucket {
+	return &memoryBucket{objects: map[string]string{}, types: map[string]string{}}
+}
+
+func (b *memoryBucket) List(_ context.Context, prefix string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var keys []string
+	for k := range b.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (b *memoryBucket) Get(_ context.Context, key string) (io.ReadCloser, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.objects[key]
+	if !ok {
+		return nil, "", errs.NotFound("object %s does not exist", key)
+	}
+	return io.NopCloser(strings.NewReader(v)), b.types[key], nil
+}
+
+func (b *memoryBucket) Put(_ context.Context, key string, body io.Reader, size int64, contentType string) error {
+	v, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(v)) != size {
+		return errors.New("size mismatch")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key], b.types[key] = string(v), contentType
+	return nil
+}
+
+func archive(t *testing.T, entries map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	// the manifest goes first
+	names := []string{manifestName}
+	for name := range entries {
+		if name != manifestName {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(entries[name]))}))
+		_, err := tw.Write([]byte(entries[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	src := newMemoryBucket()
+	require.NoError(t, src.Put(ctx, "attachments/acme/a.png", strings.NewReader("png"), 3, "image/png"))
+	require.NoError(t, src.Put(ctx, "attachments/other/b.txt", strings.NewReader("txt"), 3, "text/plain"))
+	require.NoError(t, src.Put(ctx, "secrets/key", strings.NewReader("key"), 3, ""))
+
+	exporter, err := New(nil, WithBucket(src, "attachments/"))
+	require.NoError(t, err)
+
+	dst := newMemoryBucket()
+	importer, err := New(nil, WithBucket(dst, "attachments/"))
+	require.NoError(t, err)
+
+	{ // selected prefixes are exported and restored with their content types
+		var buf bytes.Buffer
+		m, err := exporter.Export(ctx, &buf, Selection{Prefixes: []string{"attachments/acme/"}})
+		require.NoError(t, err)
+		require.Equal(t, []string{"attachments/acme/a.png"}, m.Blobs)
+
+		m, err = importer.Import(ctx, &buf)
+		require.NoError(t, err)
+		require.Equal(t, FormatVersion, m.Format)
+		require.Equal(t, map[string]string{"attachments/acme/a.png": "png"}, dst.objects)
+		require.Equal(t, "image/png", dst.types["attachments/acme/a.png"])
+	}
+
+	{ // selections outside of the configuration are refused
+		_, err := exporter.Export(ctx, io.Discard, Selection{Prefixes: []string{"secrets/"}})
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		_, err = exporter.Export(ctx, io.Discard, Selection{Tables: []string{"users"}})
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+	}
+
+	{ // archives of other formats or with unexpected entries are refused
+		_, err := importer.Import(ctx, archive(t, map[string]string{manifestName: `{"format":2}`}))
+		require.Equal(t, errs.CodeFailedPrecondition, errs.CodeOf(err))
+
+		_, err = importer.Import(ctx, archive(t, map[string]string{manifestName: `{"format":1,"blobs":["secrets/key"]}`}))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+
+		_, err = importer.Import(ctx, archive(t, map[string]string{manifestName: `{"format":1,"blobs":["attachments/../secrets/key"]}`}))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+
+		_, err = importer.Import(ctx, archive(t, map[string]string{manifestName: `{"format":1}`, "blobs/attachments/x": "x"}))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+
+		_, err = importer.Import(ctx, strings.NewReader("not gzip"))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+	}
+
+	{ // blobs of failed imports are not written
+		_, err := importer.Import(ctx, archive(t, map[string]string{
+			manifestName:                    `{"format":1,"blobs":["attachments/new.txt"]}`,
+			"blobs/attachments/new.txt":     "new",
+			"blobs/attachments/unknown.txt": "unknown",
+		}))
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		require.NotContains(t, dst.objects, "attachments/new.txt")
+	}
+
+	{ // tables need a database
+		_, err := New(nil, WithTables(Table{Name: "orders"}))
+		require.Error(t, err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	src := newMemoryBucket()
+	require.NoError(t, src.Put(context.Background(), "attachments/a", strings.NewReader("a"), 1, "text/plain"))
+
+	s, err := New(nil, WithBucket(src, "attachments/"), WithAuthorizer(func(r *http.Request) error {
+		if r.Header.Get("X-Role") != "support" {
+			return errors.New("support only")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	do := func(method, path string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, body)
+		require.NoError(t, err)
+		req.Header.Set("X-Role", "support")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	{ // requests are authorized
+		res, err := http.Get(srv.URL + "/export")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	}
+
+	{ // export downloads an archive which import restores
+		res := do(http.MethodGet, "/export", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "application/gzip", res.Header.Get("Content-Type"))
+		require.Contains(t, res.Header.Get("Content-Disposition"), "snapshot-")
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+
+		delete(src.objects, "attachments/a")
+		res = do(http.MethodPost, "/import", bytes.NewReader(data))
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "a", src.objects["attachments/a"])
+	}
+
+	{ // errors before the archive starts get their own status
+		res := do(http.MethodGet, "/export?tables=users", nil)
+		res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestPgSnapshot(t *testing.T) {
+	ctx := context.Background()
+	pool := goxtest.NewTestDB(t)
+	_, err := pool.Exec(ctx, `CREATE TABLE orgs (id int PRIMARY KEY, name text NOT NULL);
+		CREATE TABLE orders (id int PRIMARY KEY, org_id int NOT NULL REFERENCES orgs (id), note text);
+		INSERT INTO orgs VALUES (1, 'acme'), (2, 'globex');
+		INSERT INTO orders VALUES (1, 1, 'first, "quoted"'), (2, 1, NULL), (3, 2, 'other org')`)
+	require.NoError(t, err)
+	bucket := newMemoryBucket()
+	require.NoError(t, bucket.Put(ctx, "attachments/a.txt", strings.NewReader("a"), 1, "text/plain"))
+
+	s, err := New(pool, WithTables(Table{Name: "orgs", Where: "id = 1"}, Table{Name: "public.orders", Where: "org_id = 1"}),
+		WithBucket(bucket, "attachments/"))
+	require.NoError(t, err)
+	orders := func() []string {
+		rows, err := pool.Query(ctx, "SELECT o.id || ':' || g.name || ':' || coalesce(o.note, 'null') FROM orders o JOIN orgs g ON g.id = o.org_id ORDER BY o.id")
+		require.NoError(t, err)
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			var v string
+			require.NoError(t, rows.Scan(&v))
+			got = append(got, v)
+		}
+		require.NoError(t, rows.Err())
+		return got
+	}
+
+	var buf bytes.Buffer
+	m, err := s.Export(ctx, &buf, Selection{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"orgs", "public.orders"}, m.Tables)
+	data := buf.Bytes()
+
+	{ // imports replace the tables with the exported rows
+		_, err := pool.Exec(ctx, "UPDATE orders SET note = 'changed' WHERE id = 1")
+		require.NoError(t, err)
+		delete(bucket.objects, "attachments/a.txt")
+
+		_, err = s.Import(ctx, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, []string{`1:acme:first, "quoted"`, "2:acme:null"}, orders())
+		require.Equal(t, "a", bucket.objects["attachments/a.txt"])
+	}
+
+	{ // failed imports roll back the tables and write no blobs
+		delete(bucket.objects, "attachments/a.txt")
+		_, err := s.Import(ctx, archive(t, map[string]string{
+			manifestName:              `{"format":1,"tables":["orgs","public.orders"],"blobs":["attachments/a.txt"]}`,
+			"blobs/attachments/a.txt": "a",
+			"tables/orgs.csv":         "id,name\nnot a number,acme\n",
+		}))
+		require.Error(t, err)
+		require.Len(t, orders(), 2)
+		require.NotContains(t, bucket.objects, "attachments/a.txt")
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/errs"
+)
+
+func init() {
+	errs.RegisterMapper(pgErrorCode)
+}
+
+// pgErrorCode maps postgres errors to error codes, so a missing row is NotFound and a unique
+// violation is AlreadyExists wherever errs.CodeOf is used.
+func pgErrorCode(err error) (errs.Code, bool) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.CodeNotFound, true
+	}
+
+	var perr *pgconn.PgError
+	if !errors.As(err, &perr) {
+		return 0, false
+	}
+
+	switch perr.Code {
+	case "23505": // unique_violation
+		return errs.CodeAlreadyExists, true
+	case "23503", "23514": // foreign_key_violation, check_violation
+		return errs.CodeFailedPrecondition, true
+	case "23502", "22P02", "22001", "22003": // not_null_violation, invalid_text_representation, string_data_right_truncation, numeric_value_out_of_range
+		return errs.CodeInvalidArgument, true
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return errs.CodeAborted, true
+	case "57014": // query_canceled
+		return errs.CodeDeadlineExceeded, true
+	case "53300", "57P03": // too_many_connections, cannot_connect_now
+		return errs.CodeUnavailable, true
+	}
+	return errs.CodeInternal, true
+}
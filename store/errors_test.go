@@ -0,0 +1,18 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgErrorCode(t *testing.T) {
+	require.Equal(t, errs.CodeNotFound, errs.CodeOf(fmt.Errorf("get user: %w", pgx.ErrNoRows)))
+	require.Equal(t, errs.CodeAlreadyExists, errs.CodeOf(&pgconn.PgError{Code: "23505"}))
+	require.Equal(t, errs.CodeAborted, errs.CodeOf(&pgconn.PgError{Code: "40001"}))
+	require.Equal(t, errs.CodeInternal, errs.CodeOf(&pgconn.PgError{Code: "XX000"}))
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	DefaultTextSearchConfig = "english"
+	DefaultSearchLimit      = 20
+	MaxSearchLimit          = 100
+)
+
+// WeightedColumn is a text column included in a tsvector with weight A, B, C or D.
+type WeightedColumn struct {
+	Name   string
+	Weight string
+}
+
+// EnsureTSVector adds a generated tsvector column built from columns to table, and a gin index on it.
+// it is safe to call on every startup as existing column and index are kept.
+// example:
+//
+//	err := store.EnsureTSVector(ctx, pool, "articles", "search", "english",
+//		store.WeightedColumn{Name: "title", Weight: "A"},
+//		store.WeightedColumn{Name: "body", Weight: "B"})
+func EnsureTSVector(ctx context.Context, pool *pgxpool.Pool, table, column, config string, columns ...WeightedColumn) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("at least one column is required to build %s", column)
+	}
+	if config == "" {
+		config = DefaultTextSearchConfig
+	}
+
+	parts := make([]string, 0, len(columns))
+	for _, c := range columns {
+		weight := strings.ToUpper(c.Weight)
+		if weight == "" {
+			weight = "D"
+		}
+		if !strings.Contains("ABCD", weight) || len(weight) != 1 {
+			return fmt.Errorf("invalid tsvector weight %q for column %s", c.Weight, c.Name)
+		}
+		parts = append(parts, fmt.Sprintf("setweight(to_tsvector(%s, coalesce(%s, '')), '%s')",
+			quoteLiteral(config), pgx.Identifier{c.Name}.Sanitize(), weight))
+	}
+
+	tableIdent := QuoteIdentifier(table)
+	columnIdent := pgx.Identifier{column}.Sanitize()
+	indexIdent := pgx.Identifier{strings.ReplaceAll(table, ".", "_") + "_" + column + "_idx"}.Sanitize()
+
+	if _, err := pool.Exec(ctx, fmt.Sprintf("alter table %s add column if not exists %s tsvector generated always as (%s) stored",
+		tableIdent, columnIdent, strings.Join(parts, " || "))); err != nil {
+		return err
+	}
+
+	_, err := pool.Exec(ctx, fmt.Sprintf("create index if not exists %s on %s using gin (%s)", indexIdent, tableIdent, columnIdent))
+	return err
+}
+
+// TextSearch builds a ranked full text search query using websearch_to_tsquery, so users can type
+// queries like `"exact phrase" -excluded or other`.
+type TextSearch struct {
+	Table string
+	// Vector is the tsvector column to match against
+	Vector string
+	// Config is the text search config, DefaultTextSearchConfig if empty
+	Config string
+	// Columns to select, the rank is always selected as the last column and a headline after it if Highlight is set
+	Columns []string
+	// Highlight is the text column used to build the headline, html escaped with matches wrapped in <b></b>
+	Highlight string
+	// Where is an extra condition and its args, placeholders must start after the ones used by the search ($3)
+	Where     string
+	WhereArgs []interface{}
+
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// SQL returns the query and its args. limit is capped at MaxSearchLimit.
+func (s TextSearch) SQL() (string, []interface{}) {
+	config := s.Config
+	if config == "" {
+		config = DefaultTextSearchConfig
+	}
+
+	limit := s.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	offset := s.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	vector := pgx.Identifier{s.Vector}.Sanitize()
+	columns := make([]string, 0, len(s.Columns)+2)
+	for _, c := range s.Columns {
+		columns = append(columns, pgx.Identifier{c}.Sanitize())
+	}
+	columns = append(columns, fmt.Sprintf("ts_rank(%s, query) as rank", vector))
+	if s.Highlight != "" {
+		columns = append(columns, headline(pgx.Identifier{s.Highlight}.Sanitize())+" as headline")
+	}
+
+	args := []interface{}{config, s.Query}
+	where := vector + " @@ query"
+	if s.Where != "" {
+		where += " and (" + s.Where + ")"
+		args = append(args, s.WhereArgs...)
+	}
+	args = append(args, limit, offset)
+
+	return fmt.Sprintf("select %s from %s, websearch_to_tsquery($1::regconfig, $2) query where %s order by rank desc limit $%d offset $%d",
+		strings.Join(columns, ", "), QuoteIdentifier(s.Table), where, len(args)-1, len(args)), args
+}
+
+// Count returns a query counting all matches, for pagination.
+func (s TextSearch) Count() (string, []interface{}) {
+	config := s.Config
+	if config == "" {
+		config = DefaultTextSearchConfig
+	}
+
+	args := []interface{}{config, s.Query}
+	where := pgx.Identifier{s.Vector}.Sanitize() + " @@ websearch_to_tsquery($1::regconfig, $2)"
+	if s.Where != "" {
+		where += " and (" + s.Where + ")"
+		args = append(args, s.WhereArgs...)
+	}
+	return fmt.Sprintf("select count(*) from %s where %s", QuoteIdentifier(s.Table), where), args
+}
+
+// headline marks matches of column with control characters stripped from the text, escapes the
+// rest and only then turns the marks into <b></b>, so the text can not inject its own tags.
+func headline(column string) string {
+	h := fmt.Sprintf("ts_headline($1::regconfig, translate(%s, chr(2) || chr(3), ''), query, "+
+		"'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2')", column)
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"'", "&#39;"}} {
+		h = fmt.Sprintf("replace(%s, %s, %s)", h, quoteLiteral(r[0]), quoteLiteral(r[1]))
+	}
+	return fmt.Sprintf("replace(replace(%s, chr(2), '<b>'), chr(3), '</b>')", h)
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
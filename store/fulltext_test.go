@@ -0,0 +1,35 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextSearchSQL(t *testing.T) {
+	{ // defaults
+		query, args := TextSearch{Table: "public.articles", Vector: "search", Columns: []string{"id", "title"}, Query: "foo -bar"}.SQL()
+		require.Equal(t, `select "id", "title", ts_rank("search", query) as rank from "public"."articles", websearch_to_tsquery($1::regconfig, $2) query `+
+			`where "search" @@ query order by rank desc limit $3 offset $4`, query)
+		require.Equal(t, []interface{}{"english", "foo -bar", DefaultSearchLimit, 0}, args)
+	}
+
+	{ // highlight, extra condition and limits
+		s := TextSearch{
+			Table: "articles", Vector: "search", Config: "simple", Columns: []string{"id"}, Highlight: "body",
+			Where: "author_id = $3", WhereArgs: []interface{}{7},
+			Query: "foo", Limit: 1000, Offset: 20,
+		}
+		query, args := s.SQL()
+		require.Equal(t, `select "id", ts_rank("search", query) as rank, `+
+			`replace(replace(replace(replace(replace(replace(replace(`+
+			`ts_headline($1::regconfig, translate("body", chr(2) || chr(3), ''), query, 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2'), `+
+			`'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'), chr(2), '<b>'), chr(3), '</b>') as headline `+
+			`from "articles", websearch_to_tsquery($1::regconfig, $2) query where "search" @@ query and (author_id = $3) order by rank desc limit $4 offset $5`, query)
+		require.Equal(t, []interface{}{"simple", "foo", 7, MaxSearchLimit, 20}, args)
+
+		query, args = s.Count()
+		require.Equal(t, `select count(*) from "articles" where "search" @@ websearch_to_tsquery($1::regconfig, $2) and (author_id = $3)`, query)
+		require.Equal(t, []interface{}{"simple", "foo", 7}, args)
+	}
+}
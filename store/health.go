@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/puddle"
+)
+
+// Health is the state of the database as seen by WithHealth, its Probe is meant for readiness probes
+// so instances stop receiving traffic while the database is down and get it back once it recovers.
+type Health struct {
+	onChange func(err error)
+
+	mu  sync.RWMutex
+	err error
+}
+
+// NewHealth returns a healthy Health. onChange, if not nil, is called when the database goes down with
+// the error and when it is back with nil.
+func NewHealth(onChange func(err error)) *Health {
+	return &Health{onChange: onChange}
+}
+
+// Probe returns the error of the last failed ping, nil once a ping succeeds again.
+func (h *Health) Probe() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.err
+}
+
+func (h *Health) set(err error) {
+	h.mu.Lock()
+	changed := (h.err == nil) != (err == nil)
+	h.err = err
+	h.mu.Unlock()
+
+	if changed && h.onChange != nil {
+		h.onChange(err)
+	}
+}
+
+// monitor pings every interval until ctx is done or the pool is closed.
+func (h *Health) monitor(ctx context.Context, ping func(ctx context.Context) error, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, interval)
+			err := ping(pingCtx)
+			cancel()
+			if ctx.Err() != nil || errors.Is(err, puddle.ErrClosedPool) {
+				return
+			}
+			h.set(err)
+		}
+	}
+}
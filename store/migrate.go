@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const migrationsTable = "gox_migrations"
+
+// migrationsLockID is the advisory lock held while migrating, so instances starting together do not
+// run the same migrations.
+const migrationsLockID = 7241983
+
+var (
+	ErrSchemaBehind  = errors.New("database schema has pending migrations")
+	ErrSchemaDrifted = errors.New("database schema has drifted from the migrations")
+)
+
+// Migration is a sql file named like 0001_create_users.sql, versions are the numeric prefix.
+type Migration struct {
+	Version  int64  `json:"version"`
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"`
+	SQL      string `json:"-"`
+
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrationStatus compares the migrations of the binary with the ones applied to the database.
+type MigrationStatus struct {
+	Applied []Migration `json:"applied"`
+	Pending []Migration `json:"pending"`
+	// Mismatched are applied migrations whose file changed afterwards
+	Mismatched []Migration `json:"mismatched"`
+	// Unknown are applied migrations without a file, like ones of a newer release
+	Unknown []Migration `json:"unknown"`
+
+	latest int64
+}
+
+// Err returns ErrSchemaDrifted if a migration was changed or is unknown, ErrSchemaBehind if some are
+// pending and nil when the database is up to date. unknown migrations newer than the last file are
+// from a newer release, which is expected while it rolls out, and are not drift.
+func (s *MigrationStatus) Err() error {
+	if len(s.Mismatched) > 0 {
+		return ErrSchemaDrifted
+	}
+	for _, m := range s.Unknown {
+		if m.Version <= s.latest {
+			return ErrSchemaDrifted
+		}
+	}
+	if len(s.Pending) > 0 {
+		return ErrSchemaBehind
+	}
+	return nil
+}
+
+// LoadMigrations reads the .sql files of dir in fsys, sorted by version.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int64]string)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s must start with a version number", e.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, e.Name())
+		}
+		seen[version] = e.Name()
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     e.Name(),
+			Checksum: hex.EncodeToString(sum[:]),
+			SQL:      string(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations of dir in fsys, each in its own transaction. it refuses to
+// run when the schema drifted.
+// example:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	err := store.Migrate(ctx, pool, migrations, "migrations")
+func Migrate(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, dir string) error {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationsLockID); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationsLockID)
+	}()
+
+	if err := ensureMigrationsTable(ctx, conn.Conn()); err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, conn.Conn())
+	if err != nil {
+		return err
+	}
+
+	status := compareMigrations(migrations, applied)
+	if len(status.Mismatched) > 0 || len(status.Unknown) > 0 {
+		return ErrSchemaDrifted
+	}
+
+	for _, m := range status.Pending {
+		err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.SQL); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO "+migrationsTable+" (version, name, checksum) VALUES ($1, $2, $3)",
+				m.Version, m.Name, m.Checksum)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetMigrationStatus compares the migrations of dir in fsys with the ones applied to db. it only reads,
+// a database without the migrations table has none applied.
+func GetMigrationStatus(ctx context.Context, db Querier, fsys fs.FS, dir string) (*MigrationStatus, error) {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return compareMigrations(migrations, applied), nil
+}
+
+// MigrationStatusHandler serves the MigrationStatus as json, with status 409 when the schema is behind
+// or drifted. it is meant for internal admin servers.
+func MigrationStatusHandler(db Querier, fsys fs.FS, dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := GetMigrationStatus(r.Context(), db, fsys, dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		code := http.StatusOK
+		if status.Err() != nil {
+			code = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
+
+// MigrationProbe returns a readiness probe failing while migrations of the binary are not applied, so
+// instances of a release do not get traffic before their migrations ran. it only reads, and migrations
+// applied by a newer release or changed afterwards do not fail it, so instances of the previous
+// release stay ready during a rolling deploy.
+func MigrationProbe(db Querier, fsys fs.FS, dir string, timeout time.Duration) func() error {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		status, err := GetMigrationStatus(ctx, db, fsys, dir)
+		if err != nil {
+			return err
+		}
+		if len(status.Pending) > 0 {
+			return fmt.Errorf("%w: %d pending, the first is %s", ErrSchemaBehind, len(status.Pending), status.Pending[0].Name)
+		}
+		return nil
+	}
+}
+
+// SchemaVersion returns the version of the last migration applied to db, 0 if none was.
+func SchemaVersion(ctx context.Context, db Querier) (int64, error) {
+	var version int64
+	err := db.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM "+migrationsTable).Scan(&version)
+	var perr *pgconn.PgError
+	if errors.As(err, &perr) && perr.Code == "42P01" { // undefined_table
+		return 0, nil
+	}
+	return version, err
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+migrationsTable+` (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+func appliedMigrations(ctx context.Context, db Querier) ([]Migration, error) {
+	rows, err := db.Query(ctx, "SELECT version, name, checksum, applied_at FROM "+migrationsTable+" ORDER BY version")
+	var perr *pgconn.PgError
+	if errors.As(err, &perr) && perr.Code == "42P01" { // undefined_table
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []Migration
+	for rows.Next() {
+		var m Migration
+		var appliedAt time.Time
+		if err := rows.Scan(&m.Version, &m.Name, &m.Checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		m.AppliedAt = &appliedAt
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+func compareMigrations(migrations, applied []Migration) *MigrationStatus {
+	status := &MigrationStatus{Applied: []Migration{}, Pending: []Migration{}, Mismatched: []Migration{}, Unknown: []Migration{}}
+
+	files := make(map[int64]Migration, len(migrations))
+	for _, m := range migrations {
+		files[m.Version] = m
+		if m.Version > status.latest {
+			status.latest = m.Version
+		}
+	}
+
+	done := make(map[int64]bool, len(applied))
+	for _, a := range applied {
+		done[a.Version] = true
+		f, ok := files[a.Version]
+		switch {
+		case !ok:
+			status.Unknown = append(status.Unknown, a)
+		case f.Checksum != a.Checksum:
+			status.Mismatched = append(status.Mismatched, a)
+		default:
+			status.Applied = append(status.Applied, a)
+		}
+	}
+
+	for _, m := range migrations {
+		if !done[m.Version] {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return status
+}
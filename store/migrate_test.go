@@ -0,0 +1,60 @@
+package store
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationStatus(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_create_users.sql":  {Data: []byte("CREATE TABLE users (id bigserial PRIMARY KEY);")},
+		"migrations/0002_add_email.sql":     {Data: []byte("ALTER TABLE users ADD COLUMN email text;")},
+		"migrations/0003_create_orders.sql": {Data: []byte("CREATE TABLE orders (id bigserial PRIMARY KEY);")},
+		"migrations/README.md":              {Data: []byte("docs")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "migrations")
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	require.Equal(t, int64(1), migrations[0].Version)
+
+	{ // up to date
+		status := compareMigrations(migrations, migrations)
+		require.Len(t, status.Applied, 3)
+		require.NoError(t, status.Err())
+	}
+
+	{ // behind
+		status := compareMigrations(migrations, migrations[:1])
+		require.Len(t, status.Pending, 2)
+		require.ErrorIs(t, status.Err(), ErrSchemaBehind)
+	}
+
+	{ // changed after being applied
+		changed := migrations[0]
+		changed.Checksum = "other"
+		status := compareMigrations(migrations, []Migration{changed})
+		require.Len(t, status.Mismatched, 1)
+		require.ErrorIs(t, status.Err(), ErrSchemaDrifted)
+	}
+
+	{ // applied by a newer release
+		status := compareMigrations(migrations[:2], migrations)
+		require.Equal(t, int64(3), status.Unknown[0].Version)
+		require.NoError(t, status.Err())
+	}
+
+	{ // applied but its file was removed
+		status := compareMigrations([]Migration{migrations[0], migrations[2]}, migrations)
+		require.Equal(t, int64(2), status.Unknown[0].Version)
+		require.ErrorIs(t, status.Err(), ErrSchemaDrifted)
+	}
+
+	{ // duplicate versions are rejected
+		fsys["migrations/0002_other.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		_, err := LoadMigrations(fsys, "migrations")
+		require.Error(t, err)
+	}
+}
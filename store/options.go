@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DefaultHealthInterval is how often WithHealth pings the database.
+const DefaultHealthInterval = 5 * time.Second
+
+type poolConfig struct {
+	health         *Health
+	healthInterval time.Duration
+
+	minConns   int32
+	statements map[string]string
+	warmup     *Warmup
+
+	statementTimeout time.Duration
+	idleInTxTimeout  time.Duration
+}
+
+type Option func(*poolConfig) error
+
+// WithHealth pings the database every interval until the pool is closed and keeps the result in h.
+// during an outage each ping is a reconnect attempt, the first one succeeding flips h back.
+func WithHealth(h *Health, interval time.Duration) Option {
+	return func(c *poolConfig) error {
+		if h == nil {
+			return errors.New("health must not be nil")
+		}
+		if interval <= 0 {
+			interval = DefaultHealthInterval
+		}
+		c.health = h
+		c.healthInterval = interval
+		return nil
+	}
+}
+
+// WithMinConns sets the number of connections the pool keeps open, WithWarmup opens them at startup.
+func WithMinConns(n int32) Option {
+	return func(c *poolConfig) error {
+		if n < 0 {
+			return errors.New("min conns must not be negative")
+		}
+		c.minConns = n
+		return nil
+	}
+}
+
+// WithPreparedStatements prepares statements, keyed by name, on every new connection so queries can
+// be run by name without paying for parsing and planning on first use.
+// example:
+//
+//	store.WithPreparedStatements(map[string]string{
+//		"get_user": "SELECT id, email FROM users WHERE id = $1",
+//	})
+//	...
+//	pool.QueryRow(ctx, "get_user", id)
+func WithPreparedStatements(statements map[string]string) Option {
+	return func(c *poolConfig) error {
+		c.statements = statements
+		return nil
+	}
+}
+
+// WithWarmup opens the WithMinConns connections, at least one, in the background once the pool is
+// created. w.Probe fails until they are open, so it can hold back readiness after a deploy.
+func WithWarmup(w *Warmup) Option {
+	return func(c *poolConfig) error {
+		if w == nil {
+			return errors.New("warmup must not be nil")
+		}
+		c.warmup = w
+		return nil
+	}
+}
+
+// WithStatementTimeout sets statement_timeout of every connection, so postgres cancels statements
+// running longer than d even when the client is gone.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(c *poolConfig) error {
+		c.statementTimeout = d
+		return nil
+	}
+}
+
+// WithIdleInTransactionTimeout sets idle_in_transaction_session_timeout of every connection, so
+// transactions left open by a stuck client do not hold locks forever.
+func WithIdleInTransactionTimeout(d time.Duration) Option {
+	return func(c *poolConfig) error {
+		c.idleInTxTimeout = d
+		return nil
+	}
+}
+
+func (c *poolConfig) apply(conf *pgxpool.Config) {
+	if c.statementTimeout > 0 {
+		conf.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.statementTimeout.Milliseconds(), 10)
+	}
+	if c.idleInTxTimeout > 0 {
+		conf.ConnConfig.RuntimeParams["idle_in_transaction_session_timeout"] = strconv.FormatInt(c.idleInTxTimeout.Milliseconds(), 10)
+	}
+
+	if c.minConns > 0 {
+		conf.MinConns = c.minConns
+		if conf.MaxConns < c.minConns {
+			conf.MaxConns = c.minConns
+		}
+	}
+
+	if len(c.statements) > 0 {
+		statements := c.statements
+		afterConnect := conf.AfterConnect
+		conf.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			for name, sql := range statements {
+				if _, err := conn.Prepare(ctx, name, sql); err != nil {
+					return fmt.Errorf("prepare %s: %w", name, err)
+				}
+			}
+			if afterConnect != nil {
+				return afterConnect(ctx, conn)
+			}
+			return nil
+		}
+	}
+}
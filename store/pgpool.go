@@ -3,10 +3,16 @@ package store
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/diag"
+	"github.com/mirzakhany/gox/misc"
 	"github.com/mirzakhany/gox/os"
 )
 
@@ -18,9 +24,25 @@ type ConnConfig struct {
 	Port     int    `env:"DB_PORT,required" envDefault:"5432"`
 	User     string `env:"DB_USER,required" envDefault:"test"`
 	Password string `env:"DB_PASSWORD,required" envDefault:"test"`
+
+	// Hosts lists hosts like "db1:5432" which are tried in order, they replace Host and Port when set
+	Hosts []string `env:"DB_HOSTS" envSeparator:","`
+	// TargetSessionAttrs is "any" or "read-write", with "read-write" hosts in recovery are skipped
+	// so the pool follows the primary after a failover
+	TargetSessionAttrs string `env:"DB_TARGET_SESSION_ATTRS" envDefault:"any"`
 }
 
-func NewPgPool(ctx context.Context, c *ConnConfig) (*pgxpool.Pool, error) {
+// NewPgPool connects to postgres and checks the connection. with Hosts set, a connection is made to the
+// first host which is up and matches TargetSessionAttrs, new connections fail over the same way.
+// example:
+//
+//	health := store.NewHealth(func(err error) {
+//		logger.Warn("database health changed", zap.Error(err))
+//	})
+//	pool, err := store.NewPgPool(ctx, nil, store.WithHealth(health, 5*time.Second))
+//	...
+//	probe.New(nil, probe.WithProbe(probe.Readiness, health.Probe))
+func NewPgPool(ctx context.Context, c *ConnConfig, options ...Option) (*pgxpool.Pool, error) {
 	if c == nil {
 		c = &ConnConfig{}
 		if err := os.LoadFromEnv(c); err != nil {
@@ -28,16 +50,35 @@ func NewPgPool(ctx context.Context, c *ConnConfig) (*pgxpool.Pool, error) {
 		}
 	}
 
-	conf, err := pgxpool.ParseConfig(defaultDSN)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse default dsn %+v", err)
+	cfg := &poolConfig{}
+	for _, o := range options {
+		if err := o(cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	conf.ConnConfig.Host = c.Host
-	conf.ConnConfig.Port = uint16(c.Port)
-	conf.ConnConfig.Database = c.Database
-	conf.ConnConfig.User = c.User
-	conf.ConnConfig.Password = c.Password
+	var conf *pgxpool.Config
+	var err error
+	if len(c.Hosts) > 0 {
+		conf, err = pgxpool.ParseConfig(multiHostDSN(c))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse multi host dsn %+v", err)
+		}
+	} else {
+		conf, err = pgxpool.ParseConfig(defaultDSN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse default dsn %+v", err)
+		}
+
+		conf.ConnConfig.Host = c.Host
+		if conf.ConnConfig.Port, err = misc.IntToUint16(c.Port); err != nil {
+			return nil, fmt.Errorf("invalid port %d: %w", c.Port, err)
+		}
+		conf.ConnConfig.Database = c.Database
+		conf.ConnConfig.User = c.User
+		conf.ConnConfig.Password = c.Password
+	}
+	cfg.apply(conf)
 
 	pool, err := pgxpool.ConnectConfig(ctx, conf)
 	if err != nil {
@@ -48,9 +89,66 @@ func NewPgPool(ctx context.Context, c *ConnConfig) (*pgxpool.Pool, error) {
 		return nil, err
 	}
 
+	if cfg.health != nil {
+		// ctx often only bounds the connect, the monitor and warmup run until the pool is closed
+		go cfg.health.monitor(ctxutil.Detach(ctx), pool.Ping, cfg.healthInterval)
+	}
+
+	if cfg.warmup != nil {
+		go cfg.warmup.run(ctxutil.Detach(ctx), int(conf.MinConns), func(ctx context.Context) (func(), error) {
+			conn, err := pool.Acquire(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return conn.Release, nil
+		})
+	}
+
 	return pool, nil
 }
 
+// multiHostDSN returns a dsn with all hosts, libpq style, so pgconn sets up the fallbacks between them.
+// hosts are listed apart from their ports since urls can not hold several ipv6 hosts.
+func multiHostDSN(c *ConnConfig) string {
+	hosts := make([]string, len(c.Hosts))
+	ports := make([]string, len(c.Hosts))
+	for i, h := range c.Hosts {
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			// no port, like "db1", "::1" or "[::1]"
+			host, port = strings.Trim(h, "[]"), strconv.Itoa(c.Port)
+		}
+		hosts[i], ports[i] = host, port
+	}
+
+	attrs := c.TargetSessionAttrs
+	if attrs == "" {
+		attrs = "any"
+	}
+
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable target_session_attrs=%s",
+		dsnValue(strings.Join(hosts, ",")), dsnValue(strings.Join(ports, ",")), dsnValue(c.User),
+		dsnValue(c.Password), dsnValue(c.Database), dsnValue(attrs))
+}
+
+// dsnValue quotes v for a keyword/value connection string.
+func dsnValue(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// PoolStats returns the stats of pool for diag.WithPool.
+func PoolStats(pool *pgxpool.Pool) diag.PoolStats {
+	s := pool.Stat()
+	return diag.PoolStats{
+		TotalConns:    s.TotalConns(),
+		IdleConns:     s.IdleConns(),
+		AcquiredConns: s.AcquiredConns(),
+		MaxConns:      s.MaxConns(),
+		AcquireCount:  s.AcquireCount(),
+		AcquireWait:   s.AcquireDuration(),
+	}
+}
+
 func IsNoRowError(err error) bool {
 	return err == pgx.ErrNoRows
 }
@@ -59,3 +157,15 @@ func IsDuplicateConstraintError(err error, constraintName string) bool {
 	perr, ok := err.(*pgconn.PgError)
 	return ok && perr.Code == "23505" && perr.ConstraintName == constraintName
 }
+
+// CopyRows bulk inserts rows into table using the postgres copy protocol and returns the number of rows copied.
+// table can be schema qualified, like "public.users".
+func CopyRows(ctx context.Context, pool *pgxpool.Pool, table string, columns []string, rows [][]interface{}) (int64, error) {
+	return pool.CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, pgx.CopyFromRows(rows))
+}
+
+// QuoteIdentifier quotes name for use in sql, like a table or database name. names with dots are
+// quoted part by part, so schema qualified tables like "public.users" keep working.
+func QuoteIdentifier(name string) string {
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize()
+}
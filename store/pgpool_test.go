@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jackc/puddle"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	require.Equal(t, `"users"`, QuoteIdentifier("users"))
+	require.Equal(t, `"public"."users"`, QuoteIdentifier("public.users"))
+	require.Equal(t, `"odd""name"`, QuoteIdentifier(`odd"name`))
+}
+
+func TestMultiHostDSN(t *testing.T) {
+	c := &ConnConfig{
+		Database:           "users",
+		Port:               5432,
+		User:               "app",
+		Password:           `p@ss w'or\d`,
+		Hosts:              []string{"db1", "db2:5433", "::1", "[fe80::1]:5434"},
+		TargetSessionAttrs: "read-write",
+	}
+
+	conf, err := pgxpool.ParseConfig(multiHostDSN(c))
+	require.NoError(t, err)
+	require.Equal(t, "db1", conf.ConnConfig.Host)
+	require.Equal(t, uint16(5432), conf.ConnConfig.Port)
+	require.Equal(t, `p@ss w'or\d`, conf.ConnConfig.Password)
+	require.NotNil(t, conf.ConnConfig.ValidateConnect)
+
+	var fallbacks []string
+	for _, f := range conf.ConnConfig.Fallbacks {
+		fallbacks = append(fallbacks, net.JoinHostPort(f.Host, strconv.Itoa(int(f.Port))))
+	}
+	require.Subset(t, fallbacks, []string{"db2:5433", "[::1]:5432", "[fe80::1]:5434"})
+}
+
+func TestPoolStats(t *testing.T) {
+	conf, err := pgxpool.ParseConfig(defaultDSN + " pool_max_conns=7")
+	require.NoError(t, err)
+	conf.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), conf)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	stats := PoolStats(pool)
+	require.Equal(t, int32(7), stats.MaxConns)
+	require.Zero(t, stats.TotalConns)
+}
+
+func TestHealth(t *testing.T) {
+	var mu sync.Mutex
+	var changes []error
+	h := NewHealth(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, err)
+	})
+
+	down := errors.New("connection refused")
+	results := make(chan error)
+	ping := func(ctx context.Context) error { return <-results }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.monitor(ctx, ping, time.Millisecond)
+
+	results <- down
+	results <- down
+	results <- nil
+	results <- nil
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changes) == 2
+	}, time.Second, time.Millisecond)
+
+	require.Equal(t, []error{down, nil}, changes)
+	require.NoError(t, h.Probe())
+
+	// the monitor stops once the pool is closed
+	stopped := make(chan struct{})
+	go func() {
+		h.monitor(context.Background(), func(context.Context) error { return puddle.ErrClosedPool }, time.Millisecond)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("monitor kept pinging a closed pool")
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	{ // connections are held together then released
+		w := NewWarmup()
+		require.ErrorIs(t, w.Probe(), ErrWarmingUp)
+
+		held, released := 0, 0
+		w.run(context.Background(), 3, func(ctx context.Context) (func(), error) {
+			held++
+			require.Zero(t, released)
+			return func() { released++ }, nil
+		})
+
+		<-w.Done()
+		require.NoError(t, w.Probe())
+		require.Equal(t, 3, held)
+		require.Equal(t, 3, released)
+	}
+
+	{ // failures are reported and retried by the next probe
+		w := NewWarmup()
+		var attempts int32
+		w.run(context.Background(), 0, func(ctx context.Context) (func(), error) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return nil, errors.New("too many connections")
+			}
+			return func() {}, nil
+		})
+		require.EqualError(t, w.Probe(), "too many connections")
+		require.Eventually(t, func() bool { return w.Probe() == nil }, time.Second, time.Millisecond)
+		require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	}
+
+	{ // warmups of closed pools are not retried
+		w := NewWarmup()
+		var attempts int32
+		w.run(context.Background(), 1, func(ctx context.Context) (func(), error) {
+			atomic.AddInt32(&attempts, 1)
+			return nil, puddle.ErrClosedPool
+		})
+		require.ErrorIs(t, w.Probe(), puddle.ErrClosedPool)
+		require.ErrorIs(t, w.Probe(), puddle.ErrClosedPool)
+		require.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	}
+}
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mirzakhany/gox/ctxutil"
+)
+
+const (
+	// SessionTokenHeader carries the session token of ReadYourWrites for api clients.
+	SessionTokenHeader = "X-Session-Token"
+	// SessionTokenCookie carries the session token of ReadYourWrites for browsers.
+	SessionTokenCookie = "gox_session_lsn"
+)
+
+// LSN is a position in the write ahead log of postgres.
+type LSN uint64
+
+// ParseLSN parses the text form of postgres, like "16/B374D848".
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+	return LSN(h<<32 | l), nil
+}
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint64(l)>>32, uint64(l)&0xFFFFFFFF)
+}
+
+// Session tracks the last write of a client so its reads see it.
+type Session struct {
+	mu  sync.Mutex
+	lsn LSN
+}
+
+// LSN returns the position of the last write of the session.
+func (s *Session) LSN() LSN {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lsn
+}
+
+// Advance moves the session to lsn, if it is ahead.
+func (s *Session) Advance(lsn LSN) {
+	s.mu.Lock()
+	if lsn > s.lsn {
+		s.lsn = lsn
+	}
+	s.mu.Unlock()
+}
+
+var sessionKey = ctxutil.NewKey[*Session]("read your writes session")
+
+// WithSession returns a copy of ctx whose reads on a SplitPool see writes up to lsn.
+func WithSession(ctx context.Context, lsn LSN) (context.Context, *Session) {
+	s := &Session{lsn: lsn}
+	return sessionKey.Set(ctx, s), s
+}
+
+// SessionFrom returns the session of ctx, nil if there is none.
+func SessionFrom(ctx context.Context) *Session {
+	s, _ := sessionKey.Get(ctx)
+	return s
+}
+
+type replica struct {
+	db Querier
+
+	mu       sync.Mutex
+	replayed LSN
+}
+
+// SplitPool sends writes to the primary and spreads reads over the replicas. with a session in the
+// context, reads go to replicas which replayed the writes of the session, or to the primary if none did.
+type SplitPool struct {
+	primary  Querier
+	replicas []*replica
+	next     uint32
+}
+
+// NewSplitPool returns a pool writing to primary and reading from replicas, which are usually pools
+// made by NewPgPool.
+// example:
+//
+//	db := store.NewSplitPool(primary, replica1, replica2)
+//	router.Use(store.ReadYourWrites)
+//	...
+//	_, err := db.Primary().Exec(ctx, "update users set name = $1 where id = $2", name, id)
+//	err = db.Written(ctx)
+//	...
+//	reader, err := db.Read(ctx)
+//	err = reader.QueryRow(ctx, "select name from users where id = $1", id).Scan(&name)
+func NewSplitPool(primary Querier, replicas ...Querier) *SplitPool {
+	p := &SplitPool{primary: primary}
+	for _, r := range replicas {
+		p.replicas = append(p.replicas, &replica{db: r})
+	}
+	return p
+}
+
+// Primary returns the pool of the primary, for writes and transactions.
+func (p *SplitPool) Primary() Querier {
+	return p.primary
+}
+
+// Written advances the session of ctx to the current position of the primary, call it after committing
+// writes which later reads of the session must see.
+func (p *SplitPool) Written(ctx context.Context) error {
+	s := SessionFrom(ctx)
+	if s == nil {
+		return nil
+	}
+	lsn, err := queryLSN(ctx, p.primary, "select pg_current_wal_lsn()::text")
+	if err != nil {
+		return err
+	}
+	s.Advance(lsn)
+	return nil
+}
+
+// Read returns a replica which caught up with the session of ctx, the primary if none did or there
+// are no replicas. replicas failing to report their position are skipped.
+func (p *SplitPool) Read(ctx context.Context) (Querier, error) {
+	if len(p.replicas) == 0 {
+		return p.primary, nil
+	}
+	var want LSN
+	if s := SessionFrom(ctx); s != nil {
+		want = s.LSN()
+	}
+
+	start := int(atomic.AddUint32(&p.next, 1))
+	for i := range p.replicas {
+		r := p.replicas[(start+i)%len(p.replicas)]
+		if want == 0 || r.caughtUp(ctx, want) {
+			return r.db, nil
+		}
+	}
+	return p.primary, nil
+}
+
+// caughtUp tells whether the replica replayed want, asking it only when the last known position is behind.
+func (r *replica) caughtUp(ctx context.Context, want LSN) bool {
+	r.mu.Lock()
+	replayed := r.replayed
+	r.mu.Unlock()
+	if replayed >= want {
+		return true
+	}
+
+	// on a primary, like after a failover, there is nothing to replay
+	lsn, err := queryLSN(ctx, r.db, "select coalesce(pg_last_wal_replay_lsn(), pg_current_wal_lsn())::text")
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	if lsn > r.replayed {
+		r.replayed = lsn
+	}
+	r.mu.Unlock()
+	return lsn >= want
+}
+
+func queryLSN(ctx context.Context, db Querier, query string) (LSN, error) {
+	var s string
+	if err := db.QueryRow(ctx, query).Scan(&s); err != nil {
+		return 0, err
+	}
+	return ParseLSN(s)
+}
+
+// ReadYourWrites starts a session with the token of the request, from the X-Session-Token header or
+// the gox_session_lsn cookie, and returns the advanced token in both when the request wrote.
+func ReadYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(SessionTokenHeader)
+		if token == "" {
+			if c, err := r.Cookie(SessionTokenCookie); err == nil {
+				token = c.Value
+			}
+		}
+		// invalid tokens only cost the consistency of the session
+		lsn, _ := ParseLSN(token)
+
+		ctx, s := WithSession(r.Context(), lsn)
+		next.ServeHTTP(&sessionWriter{ResponseWriter: w, session: s, initial: lsn}, r.WithContext(ctx))
+	})
+}
+
+type sessionWriter struct {
+	http.ResponseWriter
+	session     *Session
+	initial     LSN
+	wroteHeader bool
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *sessionWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if lsn := w.session.LSN(); lsn > w.initial {
+		w.Header().Set(SessionTokenHeader, lsn.String())
+		http.SetCookie(w, &http.Cookie{Name: SessionTokenCookie, Value: lsn.String(), Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
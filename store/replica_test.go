@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// lsnDB reports lsn as its wal position and counts the queries.
+type lsnDB struct {
+	Querier
+	lsn     string
+	err     error
+	queries int
+}
+
+func (db *lsnDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	db.queries++
+	return lsnRow{db}
+}
+
+type lsnRow struct {
+	db *lsnDB
+}
+
+func (r lsnRow) Scan(dest ...interface{}) error {
+	if r.db.err != nil {
+		return r.db.err
+	}
+	*dest[0].(*string) = r.db.lsn
+	return nil
+}
+
+func TestLSN(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	require.NoError(t, err)
+	require.Equal(t, LSN(0x16B374D848), lsn)
+	require.Equal(t, "16/B374D848", lsn.String())
+
+	for _, s := range []string{"", "16", "x/1", "1/x"} {
+		_, err := ParseLSN(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestSplitPool(t *testing.T) {
+	primary := &lsnDB{lsn: "0/200"}
+	behind, ahead := &lsnDB{lsn: "0/100"}, &lsnDB{lsn: "0/300"}
+	p := NewSplitPool(primary, behind, ahead)
+
+	{ // without a session any replica serves reads, without asking for positions
+		seen := map[Querier]bool{}
+		for i := 0; i < 4; i++ {
+			db, err := p.Read(context.Background())
+			require.NoError(t, err)
+			seen[db] = true
+		}
+		require.Len(t, seen, 2)
+		require.Zero(t, behind.queries+ahead.queries)
+	}
+
+	ctx, s := WithSession(context.Background(), 0)
+	require.NoError(t, p.Written(ctx))
+	require.Equal(t, LSN(0x200), s.LSN())
+
+	{ // only the replica which caught up serves the session
+		for i := 0; i < 4; i++ {
+			db, err := p.Read(ctx)
+			require.NoError(t, err)
+			require.Same(t, ahead, db)
+		}
+		// the position of the replica is remembered
+		require.Equal(t, 1, ahead.queries)
+	}
+
+	{ // the primary serves when no replica caught up
+		primary.lsn = "0/400"
+		ahead.err = errors.New("down")
+		require.NoError(t, p.Written(ctx))
+		db, err := p.Read(ctx)
+		require.NoError(t, err)
+		require.Same(t, primary, db)
+	}
+
+	{ // no replicas
+		db, err := NewSplitPool(primary).Read(ctx)
+		require.NoError(t, err)
+		require.Same(t, primary, db)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	primary := &lsnDB{lsn: "0/200"}
+	p := NewSplitPool(primary, &lsnDB{lsn: "0/100"})
+
+	h := ReadYourWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			require.NoError(t, p.Written(r.Context()))
+		}
+		db, err := p.Read(r.Context())
+		require.NoError(t, err)
+		if db == Querier(primary) {
+			w.Header().Set("X-Read-From", "primary")
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	{ // writes return the token
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		require.Equal(t, "0/200", rec.Header().Get(SessionTokenHeader))
+		require.Contains(t, rec.Header().Get("Set-Cookie"), SessionTokenCookie+"=0/200")
+	}
+
+	{ // reads with the token are pinned to the primary until the replica caught up
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(SessionTokenHeader, "0/200")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, "primary", rec.Header().Get("X-Read-From"))
+		require.Empty(t, rec.Header().Get(SessionTokenHeader))
+	}
+
+	{ // the cookie works like the header
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: SessionTokenCookie, Value: "0/200"})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, "primary", rec.Header().Get("X-Read-From"))
+	}
+
+	{ // without a token replicas serve
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Empty(t, rec.Header().Get("X-Read-From"))
+	}
+}
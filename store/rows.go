@@ -0,0 +1,54 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// RowIterator returns a function which yields each row of rows as strings and io.EOF once all rows are read.
+// rows are closed when the iteration ends, callers still defer rows.Close() for iterations stopped
+// early, like by a failed write. it can be passed to rest.WriteCSV and rest.WriteXLSX to stream the
+// result of a query without loading it into memory.
+func RowIterator(rows pgx.Rows) func() ([]string, error) {
+	return func() ([]string, error) {
+		if !rows.Next() {
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+
+		values, err := rows.Values()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		out := make([]string, len(values))
+		for i, v := range values {
+			out[i] = formatValue(v)
+		}
+		return out, nil
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/multierr"
+)
+
+// DefaultShardReplicas is the number of points of each shard on the ring of ConsistentHash.
+const DefaultShardReplicas = 128
+
+// Shard is one of the databases data is split over.
+type Shard struct {
+	Name string
+	Pool *pgxpool.Pool
+	// Health, if set, is used by the probe of the router instead of pinging the shard
+	Health *Health
+}
+
+// Strategy returns the name of the shard of key.
+type Strategy func(ctx context.Context, key string) (string, error)
+
+// ConsistentHash places the shards on a hash ring with replicas points each, DefaultShardReplicas if
+// zero. adding a shard moves only the keys of its part of the ring.
+func ConsistentHash(names []string, replicas int) Strategy {
+	if replicas <= 0 {
+		replicas = DefaultShardReplicas
+	}
+	type point struct {
+		hash uint64
+		name string
+	}
+	ring := make([]point, 0, len(names)*replicas)
+	for _, name := range names {
+		for i := 0; i < replicas; i++ {
+			ring = append(ring, point{hash: hashKey(name + "#" + strconv.Itoa(i)), name: name})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	return func(_ context.Context, key string) (string, error) {
+		if len(ring) == 0 {
+			return "", errors.New("store: no shards")
+		}
+		h := hashKey(key)
+		i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		if i == len(ring) {
+			i = 0
+		}
+		return ring[i].name, nil
+	}
+}
+
+// LookupTable returns the shard lookup finds for key, like from a table of tenants, and uses fallback
+// for keys it does not know. fallback may be nil to fail for unknown keys.
+func LookupTable(lookup func(ctx context.Context, key string) (shard string, ok bool, err error), fallback Strategy) Strategy {
+	return func(ctx context.Context, key string) (string, error) {
+		shard, ok, err := lookup(ctx, key)
+		if err != nil || ok {
+			return shard, err
+		}
+		if fallback == nil {
+			return "", errs.NotFound("no shard for %s", key)
+		}
+		return fallback(ctx, key)
+	}
+}
+
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	// fnv alone spreads similar keys like tenant-1 and tenant-2 poorly over the ring
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+type ShardOption func(*ShardRouter) error
+
+// WithStrategy sets how keys are mapped to shards, ConsistentHash of the shards by default.
+func WithStrategy(s Strategy) ShardOption {
+	return func(r *ShardRouter) error {
+		r.strategy = s
+		return nil
+	}
+}
+
+// WithShardMetrics registers the gox_store_shard_routed_total counter and the connection gauges of
+// the pools of the shards, labeled by shard, with reg.
+func WithShardMetrics(reg prometheus.Registerer) ShardOption {
+	return func(r *ShardRouter) error {
+		routed, err := metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace, Subsystem: "store", Name: "shard_routed_total",
+			Help: "Number of lookups routed to the shard.",
+		}, []string{"shard"}))
+		if err != nil {
+			return err
+		}
+		if err := reg.Register(&shardCollector{r: r}); err != nil {
+			return err
+		}
+		r.routed = routed
+		return nil
+	}
+}
+
+// ShardRouter maps keys, like tenant or user ids, to the pool of their shard.
+type ShardRouter struct {
+	shards   map[string]Shard
+	names    []string
+	strategy Strategy
+	routed   *prometheus.CounterVec
+}
+
+// NewShardRouter returns a router over shards.
+// example:
+//
+//	router, err := store.NewShardRouter([]store.Shard{{Name: "eu-1", Pool: eu1}, {Name: "eu-2", Pool: eu2}},
+//		store.WithShardMetrics(prometheus.DefaultRegisterer))
+//	probe.New(nil, probe.WithProbe(probe.Readiness, router.Probe))
+//	...
+//	ctx = store.WithShard(ctx, tenantID)
+//	pool, err := router.For(ctx)
+func NewShardRouter(shards []Shard, options ...ShardOption) (*ShardRouter, error) {
+	r := &ShardRouter{shards: make(map[string]Shard, len(shards))}
+	for _, s := range shards {
+		if s.Name == "" || s.Pool == nil {
+			return nil, errors.New("store: shards need a name and a pool")
+		}
+		if _, ok := r.shards[s.Name]; ok {
+			return nil, fmt.Errorf("store: duplicate shard %s", s.Name)
+		}
+		r.shards[s.Name] = s
+		r.names = append(r.names, s.Name)
+	}
+	if len(r.names) == 0 {
+		return nil, errors.New("store: no shards")
+	}
+	sort.Strings(r.names)
+
+	for _, o := range options {
+		if err := o(r); err != nil {
+			return nil, err
+		}
+	}
+	if r.strategy == nil {
+		r.strategy = ConsistentHash(r.names, 0)
+	}
+	return r, nil
+}
+
+// Shard returns the shard of key.
+func (r *ShardRouter) Shard(ctx context.Context, key string) (Shard, error) {
+	name, err := r.strategy(ctx, key)
+	if err != nil {
+		return Shard{}, err
+	}
+	s, ok := r.shards[name]
+	if !ok {
+		return Shard{}, fmt.Errorf("store: unknown shard %s for %s", name, key)
+	}
+	if r.routed != nil {
+		r.routed.WithLabelValues(name).Inc()
+	}
+	return s, nil
+}
+
+// Pool returns the pool of the shard of key.
+func (r *ShardRouter) Pool(ctx context.Context, key string) (*pgxpool.Pool, error) {
+	s, err := r.Shard(ctx, key)
+	return s.Pool, err
+}
+
+var shardKey = ctxutil.NewKey[string]("shard key")
+
+// WithShard returns a copy of ctx whose queries go to the shard of key, see ShardRouter.For.
+func WithShard(ctx context.Context, key string) context.Context {
+	return shardKey.Set(ctx, key)
+}
+
+// For returns the pool of the shard of the key set WithShard.
+func (r *ShardRouter) For(ctx context.Context) (*pgxpool.Pool, error) {
+	key, ok := shardKey.Get(ctx)
+	if !ok {
+		return nil, errs.New(errs.CodeFailedPrecondition, "no shard key in context")
+	}
+	return r.Pool(ctx, key)
+}
+
+// Shards returns the shards sorted by name.
+func (r *ShardRouter) Shards() []Shard {
+	shards := make([]Shard, len(r.names))
+	for i, name := range r.names {
+		shards[i] = r.shards[name]
+	}
+	return shards
+}
+
+// Check returns the error of each unhealthy shard by name.
+func (r *ShardRouter) Check(ctx context.Context) map[string]error {
+	failed := map[string]error{}
+	for _, s := range r.Shards() {
+		var err error
+		if s.Health != nil {
+			err = s.Health.Probe()
+		} else {
+			pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			err = s.Pool.Ping(pingCtx)
+			cancel()
+		}
+		if err != nil {
+			failed[s.Name] = err
+		}
+	}
+	return failed
+}
+
+// Probe fails when any shard is unhealthy, since requests routed to it fail.
+func (r *ShardRouter) Probe() error {
+	var err error
+	failed := r.Check(context.Background())
+	for _, name := range r.names {
+		if ferr, ok := failed[name]; ok {
+			err = multierr.Append(err, fmt.Errorf("shard %s: %w", name, ferr))
+		}
+	}
+	return err
+}
+
+// shardCollector exports the connection stats of the pools of the shards.
+type shardCollector struct {
+	r *ShardRouter
+}
+
+var (
+	shardConnsDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "store", "shard_conns"),
+		"Number of connections of the pool of the shard by state.", []string{"shard", "state"}, nil)
+	shardMaxConnsDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "store", "shard_max_conns"),
+		"Maximum size of the pool of the shard.", []string{"shard"}, nil)
+	shardAcquireWaitDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "store", "shard_acquire_wait_seconds_total"),
+		"Time spent waiting for connections of the pool of the shard.", []string{"shard"}, nil)
+)
+
+func (c *shardCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- shardConnsDesc
+	ch <- shardMaxConnsDesc
+	ch <- shardAcquireWaitDesc
+}
+
+func (c *shardCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.r.Shards() {
+		stat := s.Pool.Stat()
+		ch <- prometheus.MustNewConstMetric(shardConnsDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()), s.Name, "acquired")
+		ch <- prometheus.MustNewConstMetric(shardConnsDesc, prometheus.GaugeValue, float64(stat.IdleConns()), s.Name, "idle")
+		ch <- prometheus.MustNewConstMetric(shardConnsDesc, prometheus.GaugeValue, float64(stat.TotalConns()), s.Name, "total")
+		ch <- prometheus.MustNewConstMetric(shardMaxConnsDesc, prometheus.GaugeValue, float64(stat.MaxConns()), s.Name)
+		ch <- prometheus.MustNewConstMetric(shardAcquireWaitDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds(), s.Name)
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/ctxutil"
+)
+
+// DefaultQueryTimeout bounds queries run by QueryWithTimeout when the context sets no other timeout.
+const DefaultQueryTimeout = 5 * time.Second
+
+// Querier is implemented by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+var queryTimeoutKey = ctxutil.NewKey[time.Duration]("query timeout")
+
+// WithQueryTimeout returns a copy of ctx in which queries run by QueryWithTimeout and friends are
+// bounded by d, like for a route which is allowed slower queries.
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return queryTimeoutKey.Set(ctx, d)
+}
+
+// QueryTimeout returns the timeout of queries in ctx, DefaultQueryTimeout unless set by WithQueryTimeout.
+func QueryTimeout(ctx context.Context) time.Duration {
+	if d, ok := queryTimeoutKey.Get(ctx); ok && d > 0 {
+		return d
+	}
+	return DefaultQueryTimeout
+}
+
+// QueryWithTimeout runs a query with ctx limited to QueryTimeout(ctx), the deadline of ctx is kept when
+// it is sooner. the timeout ends when the rows are closed or read to the end.
+// example:
+//
+//	rows, err := store.QueryWithTimeout(r.Context(), pool, "SELECT id, email FROM users WHERE org_id = $1", orgID)
+func QueryWithTimeout(ctx context.Context, q Querier, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := ctxutil.WithDeadlineCap(ctx, QueryTimeout(ctx))
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+// QueryRowWithTimeout is QueryRow with the timeout of QueryWithTimeout, it ends when the row is scanned.
+func QueryRowWithTimeout(ctx context.Context, q Querier, sql string, args ...interface{}) pgx.Row {
+	ctx, cancel := ctxutil.WithDeadlineCap(ctx, QueryTimeout(ctx))
+	return &timeoutRow{row: q.QueryRow(ctx, sql, args...), cancel: cancel}
+}
+
+// ExecWithTimeout is Exec with the timeout of QueryWithTimeout.
+func ExecWithTimeout(ctx context.Context, q Querier, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, cancel := ctxutil.WithDeadlineCap(ctx, QueryTimeout(ctx))
+	defer cancel()
+	return q.Exec(ctx, sql, args...)
+}
+
+type timeoutRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+	return false
+}
+
+func (r *timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+type timeoutRow struct {
+	row    pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return r.row.Scan(dest...)
+}
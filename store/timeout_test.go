@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+type deadlineQuerier struct {
+	deadline time.Duration
+}
+
+func (q *deadlineQuerier) Query(ctx context.Context, _ string, _ ...interface{}) (pgx.Rows, error) {
+	return nil, nil
+}
+
+func (q *deadlineQuerier) QueryRow(ctx context.Context, _ string, _ ...interface{}) pgx.Row {
+	return nil
+}
+
+func (q *deadlineQuerier) Exec(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+	deadline, _ := ctx.Deadline()
+	q.deadline = time.Until(deadline)
+	return nil, nil
+}
+
+func TestQueryTimeout(t *testing.T) {
+	q := &deadlineQuerier{}
+
+	{ // default timeout
+		_, err := ExecWithTimeout(context.Background(), q, "SELECT 1")
+		require.NoError(t, err)
+		require.InDelta(t, DefaultQueryTimeout, q.deadline, float64(time.Second))
+	}
+
+	{ // timeout set on the context
+		_, err := ExecWithTimeout(WithQueryTimeout(context.Background(), 30*time.Second), q, "SELECT 1")
+		require.NoError(t, err)
+		require.InDelta(t, 30*time.Second, q.deadline, float64(time.Second))
+	}
+
+	{ // sooner deadline of the request wins
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := ExecWithTimeout(ctx, q, "SELECT 1")
+		require.NoError(t, err)
+		require.LessOrEqual(t, q.deadline, time.Second)
+	}
+}
+
+func TestStatementTimeoutOptions(t *testing.T) {
+	conf, err := pgxpool.ParseConfig(defaultDSN)
+	require.NoError(t, err)
+
+	cfg := &poolConfig{}
+	require.NoError(t, WithStatementTimeout(2*time.Second)(cfg))
+	require.NoError(t, WithIdleInTransactionTimeout(time.Minute)(cfg))
+	cfg.apply(conf)
+
+	require.Equal(t, "2000", conf.ConnConfig.RuntimeParams["statement_timeout"])
+	require.Equal(t, "60000", conf.ConnConfig.RuntimeParams["idle_in_transaction_session_timeout"])
+}
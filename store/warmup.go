@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/puddle"
+)
+
+var ErrWarmingUp = errors.New("database connections are warming up")
+
+// Warmup tracks the warmup of a pool created with WithWarmup.
+type Warmup struct {
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu      sync.Mutex
+	err     error
+	running bool
+	retry   func()
+}
+
+func NewWarmup() *Warmup {
+	return &Warmup{done: make(chan struct{}), err: ErrWarmingUp}
+}
+
+// Probe returns ErrWarmingUp until the connections are open, or the error which stopped the warmup.
+// a failed warmup, like of a database which was briefly unreachable, is started again by the next
+// Probe, so it returns nil once a later attempt succeeds.
+func (w *Warmup) Probe() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil && w.err != ErrWarmingUp && !w.running && w.retry != nil {
+		w.running = true
+		go w.retry()
+	}
+	return w.err
+}
+
+// Done is closed when the first warmup is over, successfully or not.
+func (w *Warmup) Done() <-chan struct{} {
+	return w.done
+}
+
+// run holds n connections at once so the pool has to open all of them, then gives them back. failed
+// attempts are retried by Probe until ctx is done or the pool is closed.
+func (w *Warmup) run(ctx context.Context, n int, acquire func(ctx context.Context) (release func(), err error)) {
+	if n < 1 {
+		n = 1
+	}
+
+	w.mu.Lock()
+	w.running = true
+	w.retry = func() {
+		if ctx.Err() == nil {
+			w.attempt(ctx, n, acquire)
+			return
+		}
+		w.mu.Lock()
+		w.running = false
+		w.mu.Unlock()
+	}
+	w.mu.Unlock()
+	w.attempt(ctx, n, acquire)
+}
+
+func (w *Warmup) attempt(ctx context.Context, n int, acquire func(ctx context.Context) (release func(), err error)) {
+	var err error
+	releases := make([]func(), 0, n)
+	for i := 0; i < n; i++ {
+		var release func()
+		if release, err = acquire(ctx); err != nil {
+			break
+		}
+		releases = append(releases, release)
+	}
+	for _, release := range releases {
+		release()
+	}
+
+	w.mu.Lock()
+	w.err, w.running = err, false
+	if errors.Is(err, puddle.ErrClosedPool) {
+		// the pool is gone, there is nothing to retry
+		w.retry = nil
+	}
+	w.mu.Unlock()
+	w.doneOnce.Do(func() { close(w.done) })
+}
@@ -0,0 +1,291 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/mirzakhany/gox/group"
+)
+
+// Pipeline runs connected stages. the first failing stage cancels the context of all the others
+// and its error is returned by Wait.
+// example:
+//
+//	p, ctx := stream.New(ctx)
+//	ids := stream.From(p, userIDs)
+//	users := stream.FanOut(p, ids, 8, loadUser)
+//	batches := stream.Batch(p, users, 100, time.Second)
+//	stream.ForEach(p, batches, exportBatch)
+//	err := p.Wait()
+type Pipeline struct {
+	g *group.Group
+}
+
+func New(ctx context.Context, options ...group.Option) (*Pipeline, context.Context) {
+	g, ctx := group.New(ctx, options...)
+	return &Pipeline{g: g}, ctx
+}
+
+// Wait blocks until all stages are done and returns the first error.
+func (p *Pipeline) Wait() error {
+	return p.g.Wait()
+}
+
+func (p *Pipeline) stage(name string, fn func(ctx context.Context) error) {
+	p.g.Go(name, fn)
+}
+
+func send[T any](ctx context.Context, out chan<- T, v T) error {
+	select {
+	case out <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// From emits items.
+func From[T any](p *Pipeline, items []T) <-chan T {
+	out := make(chan T)
+	p.stage("from", func(ctx context.Context) error {
+		defer close(out)
+		for _, v := range items {
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+// Generate emits values returned by next until it returns false or an error.
+func Generate[T any](p *Pipeline, next func(ctx context.Context) (T, bool, error)) <-chan T {
+	out := make(chan T)
+	p.stage("generate", func(ctx context.Context) error {
+		defer close(out)
+		for {
+			v, ok, err := next(ctx)
+			if err != nil || !ok {
+				return err
+			}
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+	})
+	return out
+}
+
+// Map emits fn of each value of in. an error of fn stops the pipeline.
+func Map[T, R any](p *Pipeline, in <-chan T, fn func(ctx context.Context, v T) (R, error)) <-chan R {
+	return FanOut(p, in, 1, fn)
+}
+
+// FanOut is like Map but runs fn on workers goroutines, so values may be emitted out of order.
+func FanOut[T, R any](p *Pipeline, in <-chan T, workers int, fn func(ctx context.Context, v T) (R, error)) <-chan R {
+	if workers < 1 {
+		workers = 1
+	}
+
+	outs := make([]<-chan R, workers)
+	for i := range outs {
+		out := make(chan R)
+		outs[i] = out
+		p.stage("map", func(ctx context.Context) error {
+			defer close(out)
+			for v := range in {
+				r, err := fn(ctx, v)
+				if err != nil {
+					return err
+				}
+				if err := send(ctx, out, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if workers == 1 {
+		return outs[0]
+	}
+	return FanIn(p, outs...)
+}
+
+// FanIn merges values of ins into one channel.
+func FanIn[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	done := make(chan struct{}, len(ins))
+
+	for _, in := range ins {
+		in := in
+		p.stage("fan in", func(ctx context.Context) error {
+			defer func() { done <- struct{}{} }()
+			for v := range in {
+				if err := send(ctx, out, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	p.stage("fan in close", func(ctx context.Context) error {
+		for range ins {
+			<-done
+		}
+		close(out)
+		return nil
+	})
+	return out
+}
+
+// Filter emits values of in for which keep returns true.
+func Filter[T any](p *Pipeline, in <-chan T, keep func(v T) bool) <-chan T {
+	out := make(chan T)
+	p.stage("filter", func(ctx context.Context) error {
+		defer close(out)
+		for v := range in {
+			if !keep(v) {
+				continue
+			}
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+// Buffer decouples a slow consumer from its producer by holding up to size values.
+func Buffer[T any](p *Pipeline, in <-chan T, size int) <-chan T {
+	out := make(chan T, size)
+	p.stage("buffer", func(ctx context.Context) error {
+		defer close(out)
+		for v := range in {
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+// Batch groups values of in into slices of up to size values. a partial batch is emitted when
+// maxWait passes since its first value, 0 means to wait until the batch is full.
+func Batch[T any](p *Pipeline, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	out := make(chan []T)
+	p.stage("batch", func(ctx context.Context) error {
+		defer close(out)
+
+		var (
+			batch   []T
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		flush := func() error {
+			if timer != nil {
+				timer.Stop()
+				timeout = nil
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			b := batch
+			batch = nil
+			return send(ctx, out, b)
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return flush()
+				}
+				if len(batch) == 0 && maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					timeout = timer.C
+				}
+				batch = append(batch, v)
+				if len(batch) >= size {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			case <-timeout:
+				if err := flush(); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+	return out
+}
+
+// Window groups values of in received during each period of d. empty windows are not emitted.
+func Window[T any](p *Pipeline, in <-chan T, d time.Duration) <-chan []T {
+	out := make(chan []T)
+	p.stage("window", func(ctx context.Context) error {
+		defer close(out)
+
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		var window []T
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					if len(window) == 0 {
+						return nil
+					}
+					return send(ctx, out, window)
+				}
+				window = append(window, v)
+			case <-ticker.C:
+				if len(window) == 0 {
+					continue
+				}
+				if err := send(ctx, out, window); err != nil {
+					return err
+				}
+				window = nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+	return out
+}
+
+// ForEach consumes in, calling fn for each value. an error of fn stops the pipeline,
+// and no more values are handled once the pipeline is stopped.
+func ForEach[T any](p *Pipeline, in <-chan T, fn func(ctx context.Context, v T) error) {
+	p.stage("for each", func(ctx context.Context) error {
+		for v := range in {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(ctx, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Collect consumes in and returns a function returning all its values, to be called after Wait.
+// when the pipeline failed, it returns the values collected until then.
+func Collect[T any](p *Pipeline, in <-chan T) func() []T {
+	var out []T
+	ForEach(p, in, func(_ context.Context, v T) error {
+		out = append(out, v)
+		return nil
+	})
+	return func() []T { return out }
+}
@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	p, _ := New(context.Background())
+
+	nums := From(p, []int{1, 2, 3, 4, 5, 6, 7})
+	even := Filter(p, nums, func(v int) bool { return v%2 == 0 })
+	strs := FanOut(p, even, 3, func(_ context.Context, v int) (string, error) {
+		return strconv.Itoa(v * 10), nil
+	})
+	result := Collect(p, Buffer(p, strs, 2))
+
+	require.NoError(t, p.Wait())
+	out := result()
+	sort.Strings(out)
+	require.Equal(t, []string{"20", "40", "60"}, out)
+}
+
+func TestPipelineError(t *testing.T) {
+	failed := errors.New("failed")
+	p, ctx := New(context.Background())
+
+	// an endless source must be stopped by the failure of a later stage
+	i := 0
+	nums := Generate(p, func(ctx context.Context) (int, bool, error) {
+		i++
+		return i, true, nil
+	})
+	mapped := Map(p, nums, func(_ context.Context, v int) (int, error) {
+		if v == 3 {
+			return 0, failed
+		}
+		return v, nil
+	})
+	Collect(p, mapped)
+
+	require.ErrorIs(t, p.Wait(), failed)
+	require.Error(t, ctx.Err())
+}
+
+func TestBatchAndWindow(t *testing.T) {
+	{ // batch by size, with the rest flushed at the end
+		p, _ := New(context.Background())
+		batches := Collect(p, Batch(p, From(p, []int{1, 2, 3, 4, 5}), 2, 0))
+		require.NoError(t, p.Wait())
+		require.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, batches())
+	}
+
+	{ // batch by time
+		p, _ := New(context.Background())
+		in := make(chan int)
+		batches := Collect(p, Batch(p, in, 10, 10*time.Millisecond))
+
+		in <- 1
+		time.Sleep(30 * time.Millisecond)
+		in <- 2
+		close(in)
+
+		require.NoError(t, p.Wait())
+		require.Equal(t, [][]int{{1}, {2}}, batches())
+	}
+
+	{ // window
+		p, _ := New(context.Background())
+		windows := Collect(p, Window(p, From(p, []int{1, 2, 3}), time.Hour))
+		require.NoError(t, p.Wait())
+		require.Equal(t, [][]int{{1, 2, 3}}, windows())
+	}
+}
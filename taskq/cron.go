@@ -0,0 +1,231 @@
+package taskq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	goxlog "github.com/mirzakhany/gox/log"
+	"go.uber.org/zap"
+)
+
+// Cron is a parsed cron expression.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny tell whether the day fields are *, when both are restricted either matches
+	domAny, dowAny bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// ParseCron parses the five fields minute, hour, day of month, month and day of week, each a *, a
+// number, a range like 1-5, a list like 1,15 or a step like */10, or a descriptor like @daily.
+func ParseCron(spec string) (*Cron, error) {
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("taskq: cron %q needs 5 fields", spec)
+	}
+
+	c := &Cron{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("taskq: cron %q: %w", spec, err)
+		}
+		*sets[i] = set
+	}
+	// sunday is 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if r, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			rng, step = r, n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t matching the expression, in the location of t. the zero time
+// is returned for expressions which never match, like the 30th of february.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Schedule enqueues a task of Kind with Payload whenever Spec, a cron expression in UTC, matches.
+type Schedule struct {
+	// Name identifies the schedule, it must be unique and stable across deploys
+	Name     string
+	Spec     string
+	Kind     string
+	Payload  interface{}
+	Priority Priority
+}
+
+type schedule struct {
+	Schedule
+	cron *Cron
+	next time.Time
+}
+
+// Scheduler enqueues the tasks of schedules on time. every instance may run one: each run of a
+// schedule is enqueued with a key of its name and time, so it is enqueued once.
+type Scheduler struct {
+	queue     *Queue
+	schedules []*schedule
+	logger    *zap.Logger
+}
+
+// NewScheduler returns a scheduler of schedules enqueuing to queue, logger may be nil.
+// example:
+//
+//	scheduler, err := taskq.NewScheduler(queue, []taskq.Schedule{
+//		{Name: "nightly-report", Spec: "0 3 * * *", Kind: "report"},
+//	}, logger)
+//	runner, err := gox.NewRunner(gox.WithComponents(scheduler, worker))
+func NewScheduler(queue *Queue, schedules []Schedule, logger *zap.Logger) (*Scheduler, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	s := &Scheduler{queue: queue, logger: logger}
+	names := map[string]bool{}
+	for _, sc := range schedules {
+		if sc.Name == "" || names[sc.Name] {
+			return nil, errors.New("taskq: schedules need unique names")
+		}
+		names[sc.Name] = true
+		c, err := ParseCron(sc.Spec)
+		if err != nil {
+			return nil, err
+		}
+		s.schedules = append(s.schedules, &schedule{Schedule: sc, cron: c})
+	}
+	return s, nil
+}
+
+func (s *Scheduler) Name() string {
+	return "taskq-scheduler"
+}
+
+// Run enqueues the runs of the schedules until ctx is done. runs missed while no instance was running
+// are not enqueued later.
+func (s *Scheduler) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	now := clk.Now().UTC()
+	for _, sc := range s.schedules {
+		sc.next = sc.cron.Next(now)
+	}
+
+	for {
+		var wake time.Time
+		for _, sc := range s.schedules {
+			if !sc.next.IsZero() && (wake.IsZero() || sc.next.Before(wake)) {
+				wake = sc.next
+			}
+		}
+		if wake.IsZero() {
+			<-ctx.Done()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clk.After(wake.Sub(clk.Now())):
+		}
+
+		now := clk.Now().UTC()
+		for _, sc := range s.schedules {
+			for !sc.next.IsZero() && !sc.next.After(now) {
+				s.enqueue(ctx, sc)
+				sc.next = sc.cron.Next(sc.next)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) enqueue(ctx context.Context, sc *schedule) {
+	key := "cron:" + sc.Name + ":" + strconv.FormatInt(sc.next.Unix(), 10)
+	_, err := s.queue.Enqueue(ctx, sc.Kind, sc.Payload, RunAt(sc.next), WithPriority(sc.Priority), WithKey(key))
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		s.logger.Error("enqueue scheduled task failed", zap.String("schedule", sc.Name), goxlog.Err(err))
+	}
+}
@@ -0,0 +1,234 @@
+package taskq
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/misc"
+	"github.com/mirzakhany/gox/rest"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultDeadLetterPageSize = 50
+	MaxDeadLetterPageSize     = 500
+)
+
+// DeadLetterAction is a change made to a failed task.
+type DeadLetterAction string
+
+const (
+	ActionEdit   DeadLetterAction = "edit"
+	ActionReplay DeadLetterAction = "replay"
+)
+
+// AuditEntry records who changed a failed task.
+type AuditEntry struct {
+	Action DeadLetterAction
+	TaskID string
+	Queue  string
+	Kind   string
+	// Actor is the user id of the rest.RequestMeta of the request, or the one given to the cli
+	Actor string
+	// Before and After are the payloads of edits
+	Before json.RawMessage
+	After  json.RawMessage
+}
+
+// Auditor stores audit entries, by default they are logged without the payloads, which may hold
+// personal data.
+type Auditor func(ctx context.Context, entry AuditEntry)
+
+type DeadLetterOption func(*DeadLetters) error
+
+// WithAuditor sets where audit entries of edits and replays go.
+func WithAuditor(audit Auditor) DeadLetterOption {
+	return func(d *DeadLetters) error {
+		d.audit = audit
+		return nil
+	}
+}
+
+// WithDeadLetterAuthorizer is called for every request of the endpoints before it is handled, a
+// returned error is written with status 403 unless it carries its own code. the endpoints reject
+// every request without it, routers protected otherwise can allow all with a func returning nil.
+func WithDeadLetterAuthorizer(authorize func(r *http.Request) error) DeadLetterOption {
+	return func(d *DeadLetters) error {
+		d.authorize = authorize
+		return nil
+	}
+}
+
+func WithDeadLetterLogger(logger *zap.Logger) DeadLetterOption {
+	return func(d *DeadLetters) error {
+		d.logger = logger
+		return nil
+	}
+}
+
+// DeadLetters lists, edits and replays the tasks which ran out of attempts, recording who changed them.
+// example:
+//
+//	dl, err := taskq.NewDeadLetters(tasks, taskq.WithDeadLetterAuthorizer(requireRole("ops")),
+//		taskq.WithDeadLetterLogger(logger))
+//	...
+//	router.Route("/admin/dead-letters", dl.Mount)
+type DeadLetters struct {
+	store     DeadLetterStore
+	audit     Auditor
+	authorize func(r *http.Request) error
+	logger    *zap.Logger
+}
+
+func NewDeadLetters(store DeadLetterStore, options ...DeadLetterOption) (*DeadLetters, error) {
+	d := &DeadLetters{store: store, logger: zap.NewNop()}
+	for _, o := range options {
+		if err := o(d); err != nil {
+			return nil, err
+		}
+	}
+	if d.audit == nil {
+		logger := d.logger
+		d.audit = func(_ context.Context, entry AuditEntry) {
+			logger.Info("dead letter changed", zap.String("action", string(entry.Action)), zap.String("task", entry.TaskID),
+				zap.String("queue", entry.Queue), zap.String("kind", entry.Kind), zap.String("actor", entry.Actor),
+				zap.Int("before_size", len(entry.Before)), zap.Int("after_size", len(entry.After)))
+		}
+	}
+	return d, nil
+}
+
+// List returns the failed tasks of queue, of all queues if it is empty, last failed first.
+func (d *DeadLetters) List(ctx context.Context, queue string, limit, offset int) ([]Task, error) {
+	return d.store.Failed(ctx, queue, limit, offset)
+}
+
+func (d *DeadLetters) Get(ctx context.Context, id string) (*Task, error) {
+	return d.store.Get(ctx, id)
+}
+
+// Edit replaces the payload of the failed task id on behalf of actor.
+func (d *DeadLetters) Edit(ctx context.Context, actor, id string, payload json.RawMessage) (*Task, error) {
+	if !json.Valid(payload) {
+		return nil, errs.Invalid("payload must be valid json")
+	}
+	before, err := d.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.store.SetPayload(ctx, id, payload); err != nil {
+		return nil, err
+	}
+	d.audit(ctx, AuditEntry{Action: ActionEdit, TaskID: id, Queue: before.Queue, Kind: before.Kind, Actor: actor,
+		Before: before.Payload, After: payload})
+	return d.store.Get(ctx, id)
+}
+
+// Replay enqueues the failed task id again on behalf of actor, it runs right away with all its attempts.
+func (d *DeadLetters) Replay(ctx context.Context, actor, id string) (*Task, error) {
+	if err := d.store.Replay(ctx, id); err != nil {
+		return nil, err
+	}
+	t, err := d.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	d.audit(ctx, AuditEntry{Action: ActionReplay, TaskID: id, Queue: t.Queue, Kind: t.Kind, Actor: actor})
+	return t, nil
+}
+
+// Mount adds the endpoints to router:
+//
+//	GET  /?queue=emails&limit=50&offset=0  failed tasks
+//	GET  /{id}                             a task
+//	PUT  /{id}/payload                     replace the payload of a failed task with the json body
+//	POST /{id}/replay                      run a failed task again
+//
+// without WithDeadLetterAuthorizer every request is rejected with 403.
+func (d *DeadLetters) Mount(router chi.Router) {
+	router.Get("/", d.authorized(d.list))
+	router.Get("/{id}", d.authorized(d.get))
+	router.Put("/{id}/payload", d.authorized(d.edit))
+	router.Post("/{id}/replay", d.authorized(d.replay))
+}
+
+func (d *DeadLetters) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d.authorize == nil {
+			rest.WriteErr(w, errs.Forbidden("dead letters have no authorizer"))
+			return
+		}
+		if err := d.authorize(r); err != nil {
+			if errs.CodeOf(err) == errs.CodeUnknown {
+				err = errs.WithCode(err, errs.CodePermissionDenied)
+			}
+			rest.WriteErr(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func actor(r *http.Request) string {
+	if meta, ok := rest.RequestMetaFrom(r.Context()); ok {
+		return meta.UserID
+	}
+	return ""
+}
+
+func (d *DeadLetters) list(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	limit, err := misc.ParseInt(values.Get("limit"), DefaultDeadLetterPageSize, 1, MaxDeadLetterPageSize)
+	if err != nil {
+		rest.WriteErr(w, errs.Invalid("limit must be between 1 and %d", MaxDeadLetterPageSize))
+		return
+	}
+	offset, err := misc.ParseInt(values.Get("offset"), 0, 0, math.MaxInt)
+	if err != nil {
+		rest.WriteErr(w, errs.Invalid("offset must not be negative"))
+		return
+	}
+
+	tasks, err := d.List(r.Context(), values.Get("queue"), limit, offset)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": tasks})
+}
+
+func (d *DeadLetters) get(w http.ResponseWriter, r *http.Request) {
+	t, err := d.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, t)
+}
+
+func (d *DeadLetters) edit(w http.ResponseWriter, r *http.Request) {
+	var payload json.RawMessage
+	if code, err := rest.ReadJSON(r, &payload); err != nil {
+		rest.WriteError(w, code, err.Error())
+		return
+	}
+	t, err := d.Edit(r.Context(), actor(r), chi.URLParam(r, "id"), payload)
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, t)
+}
+
+func (d *DeadLetters) replay(w http.ResponseWriter, r *http.Request) {
+	t, err := d.Replay(r.Context(), actor(r), chi.URLParam(r, "id"))
+	if err != nil {
+		rest.WriteErr(w, err)
+		return
+	}
+	rest.WriteJSON(w, http.StatusOK, t)
+}
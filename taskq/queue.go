@@ -0,0 +1,115 @@
+package taskq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+)
+
+// DefaultMaxAttempts is how often a task runs before it fails.
+const DefaultMaxAttempts = 5
+
+// TaskOption configures a task when it is enqueued.
+type TaskOption func(*Task)
+
+// RunAt delays the task until t.
+func RunAt(t time.Time) TaskOption {
+	return func(task *Task) {
+		task.RunAt = t.UTC()
+	}
+}
+
+// RunAfter delays the task by d.
+func RunAfter(d time.Duration) TaskOption {
+	return func(task *Task) {
+		task.RunAt = task.RunAt.Add(d)
+	}
+}
+
+// WithPriority sets the priority of the task, PriorityNormal by default.
+func WithPriority(p Priority) TaskOption {
+	return func(task *Task) {
+		task.Priority = p
+	}
+}
+
+// WithMaxAttempts sets how often the task runs before it fails, DefaultMaxAttempts by default.
+func WithMaxAttempts(n int) TaskOption {
+	return func(task *Task) {
+		task.MaxAttempts = n
+	}
+}
+
+// WithKey makes the task unique in its queue, enqueuing another task with key fails with ErrDuplicate
+// until the finished one is deleted.
+func WithKey(key string) TaskOption {
+	return func(task *Task) {
+		task.Key = key
+	}
+}
+
+// Queue enqueues tasks for the workers of a queue.
+type Queue struct {
+	store Store
+	name  string
+}
+
+// NewQueue returns the queue name of store, DefaultQueue if empty.
+// example:
+//
+//	tasks, err := taskq.NewPgStore(ctx, pool)
+//	emails := taskq.NewQueue(tasks, "emails")
+//	_, err = emails.Enqueue(ctx, "welcome", Welcome{UserID: id}, taskq.RunAfter(time.Hour))
+func NewQueue(store Store, name string) *Queue {
+	if name == "" {
+		name = DefaultQueue
+	}
+	return &Queue{store: store, name: name}
+}
+
+// Name returns the name of the queue.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Enqueue adds a task of kind with payload encoded as json, due right away unless options delay it.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}, options ...TaskOption) (*Task, error) {
+	var raw json.RawMessage
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	}
+
+	now := clock.FromContext(ctx).Now().UTC()
+	t := &Task{
+		ID:          newID(),
+		Queue:       q.name,
+		Kind:        kind,
+		Payload:     raw,
+		State:       StatePending,
+		RunAt:       now,
+		MaxAttempts: DefaultMaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, o := range options {
+		o(t)
+	}
+	if err := q.store.Enqueue(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
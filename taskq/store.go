@@ -0,0 +1,440 @@
+package taskq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+)
+
+const tasksTable = "gox_tasks"
+
+// PgStore keeps tasks in postgres, workers of many instances claim them with skip locked.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the tasks of db, creating their table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+tasksTable+` (
+		id text PRIMARY KEY,
+		queue text NOT NULL,
+		kind text NOT NULL,
+		key text,
+		payload jsonb,
+		priority int NOT NULL,
+		state text NOT NULL,
+		run_at timestamptz NOT NULL,
+		locked_until timestamptz,
+		attempts int NOT NULL,
+		max_attempts int NOT NULL,
+		last_error text NOT NULL DEFAULT '',
+		created_at timestamptz NOT NULL,
+		updated_at timestamptz NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS gox_tasks_key ON `+tasksTable+` (queue, key) WHERE key IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS gox_tasks_due ON `+tasksTable+` (queue, priority DESC, run_at) WHERE state IN ('pending', 'running');
+	CREATE INDEX IF NOT EXISTS gox_tasks_oldest ON `+tasksTable+` (queue, run_at) WHERE state IN ('pending', 'running');
+	CREATE INDEX IF NOT EXISTS gox_tasks_finished ON `+tasksTable+` (queue, updated_at) WHERE state IN ('done', 'failed')`)
+	if err != nil {
+		return nil, err
+	}
+	return OpenPgStore(db), nil
+}
+
+// OpenPgStore returns the tasks of db without creating their table, for tools like gox dlq which
+// must not change the schema of the databases they inspect.
+func OpenPgStore(db store.Querier) *PgStore {
+	return &PgStore{db: db}
+}
+
+func (s *PgStore) Enqueue(ctx context.Context, t *Task) error {
+	var key, payload interface{}
+	if t.Key != "" {
+		key = t.Key
+	}
+	if len(t.Payload) > 0 {
+		payload = string(t.Payload)
+	}
+	_, err := s.db.Exec(ctx, `INSERT INTO `+tasksTable+` (id, queue, kind, key, payload, priority, state, run_at, attempts, max_attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 0, $9, $10, $10)`,
+		t.ID, t.Queue, t.Kind, key, payload, t.Priority, t.State, t.RunAt, t.MaxAttempts, t.CreatedAt)
+	if store.IsDuplicateConstraintError(err, "gox_tasks_key") {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// leaseExpired is the last error of tasks whose lease ran out on their last attempt.
+const leaseExpired = "lease ran out on the last attempt"
+
+func (s *PgStore) Claim(ctx context.Context, queue string, lease time.Duration, lane Lane) (*Task, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	_, err := s.db.Exec(ctx, `UPDATE `+tasksTable+` SET state = $3, last_error = $4, locked_until = NULL, updated_at = $2
+		WHERE queue = $1 AND state = 'running' AND locked_until <= $2 AND attempts >= max_attempts`,
+		queue, now, StateFailed, leaseExpired)
+	if err != nil {
+		return nil, err
+	}
+
+	order := "priority DESC, run_at"
+	if lane == LaneOldest {
+		order = "run_at"
+	}
+	t, err := scanTask(s.db.QueryRow(ctx, `UPDATE `+tasksTable+` SET state = $3, attempts = attempts + 1, locked_until = $4, updated_at = $2
+		WHERE id = (
+			SELECT id FROM `+tasksTable+`
+			WHERE queue = $1 AND (state = 'pending' AND run_at <= $2 OR state = 'running' AND locked_until <= $2 AND attempts < max_attempts)
+			ORDER BY `+order+` LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+taskColumns,
+		queue, now, StateRunning, now.Add(lease)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+func (s *PgStore) Complete(ctx context.Context, id string, attempt int) error {
+	return s.update(ctx, "UPDATE "+tasksTable+" SET state = $3, locked_until = NULL, updated_at = $4 WHERE "+leased,
+		id, attempt, StateDone, clock.FromContext(ctx).Now().UTC())
+}
+
+func (s *PgStore) Retry(ctx context.Context, id string, attempt int, runAt time.Time, lastErr string) error {
+	return s.update(ctx, "UPDATE "+tasksTable+" SET state = $3, run_at = $4, last_error = $5, locked_until = NULL, updated_at = $6 WHERE "+leased,
+		id, attempt, StatePending, runAt, lastErr, clock.FromContext(ctx).Now().UTC())
+}
+
+func (s *PgStore) Fail(ctx context.Context, id string, attempt int, lastErr string) error {
+	return s.update(ctx, "UPDATE "+tasksTable+" SET state = $3, last_error = $4, locked_until = NULL, updated_at = $5 WHERE "+leased,
+		id, attempt, StateFailed, lastErr, clock.FromContext(ctx).Now().UTC())
+}
+
+// leased matches task $1 while it runs its $2-th attempt.
+const leased = "id = $1 AND attempts = $2 AND state = 'running'"
+
+func (s *PgStore) update(ctx context.Context, query string, args ...interface{}) error {
+	tag, err := s.db.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// DeleteFinished removes done and failed tasks last updated before t, which frees their keys.
+func (s *PgStore) DeleteFinished(ctx context.Context, t time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM "+tasksTable+" WHERE state IN ($1, $2) AND updated_at < $3", StateDone, StateFailed, t)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *PgStore) Stats(ctx context.Context, queue string) (Stats, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	var stats Stats
+	var oldest *time.Time
+	var finished int64
+	// both parts only read the rows of their partial index, not the whole history of the queue
+	err := s.db.QueryRow(ctx, `SELECT
+			count(*) FILTER (WHERE state = 'pending' AND run_at <= $2 OR state = 'running' AND locked_until <= $2),
+			count(*) FILTER (WHERE state = 'running' AND locked_until > $2),
+			min(run_at) FILTER (WHERE state = 'pending' AND run_at <= $2),
+			(SELECT count(*) FROM `+tasksTable+` WHERE queue = $1 AND state IN ('done', 'failed') AND updated_at > $3)
+		FROM `+tasksTable+` WHERE queue = $1 AND state IN ('pending', 'running')`, queue, now, now.Add(-StatsWindow)).
+		Scan(&stats.Depth, &stats.Running, &oldest, &finished)
+	if err != nil {
+		return stats, err
+	}
+	if oldest != nil {
+		stats.Lag = now.Sub(*oldest)
+	}
+	stats.Rate = float64(finished) / StatsWindow.Seconds()
+	return stats, nil
+}
+
+const taskColumns = "id, queue, kind, key, payload, priority, state, run_at, attempts, max_attempts, last_error, created_at, updated_at"
+
+func scanTask(row pgx.Row) (*Task, error) {
+	var t Task
+	var key *string
+	var payload []byte
+	err := row.Scan(&t.ID, &t.Queue, &t.Kind, &key, &payload, &t.Priority, &t.State, &t.RunAt, &t.Attempts, &t.MaxAttempts, &t.LastError, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		t.Key = *key
+	}
+	t.Payload = payload
+	return &t, nil
+}
+
+func (s *PgStore) Failed(ctx context.Context, queue string, limit, offset int) ([]Task, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+taskColumns+" FROM "+tasksTable+
+		" WHERE state = $1 AND ($2 = '' OR queue = $2) ORDER BY updated_at DESC, id LIMIT $3 OFFSET $4",
+		StateFailed, queue, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *t)
+	}
+	return tasks, rows.Err()
+}
+
+func (s *PgStore) Get(ctx context.Context, id string) (*Task, error) {
+	t, err := scanTask(s.db.QueryRow(ctx, "SELECT "+taskColumns+" FROM "+tasksTable+" WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.NotFound("task not found")
+	}
+	return t, err
+}
+
+func (s *PgStore) SetPayload(ctx context.Context, id string, payload json.RawMessage) error {
+	return s.updateFailed(ctx, "UPDATE "+tasksTable+" SET payload = $3, updated_at = $4 WHERE id = $1 AND state = $2",
+		id, StateFailed, string(payload), clock.FromContext(ctx).Now().UTC())
+}
+
+func (s *PgStore) Replay(ctx context.Context, id string) error {
+	now := clock.FromContext(ctx).Now().UTC()
+	return s.updateFailed(ctx, "UPDATE "+tasksTable+" SET state = $3, attempts = 0, run_at = $4, updated_at = $4 WHERE id = $1 AND state = $2",
+		id, StateFailed, StatePending, now)
+}
+
+// updateFailed runs an update of a failed task, telling missing tasks from ones which are not failed.
+func (s *PgStore) updateFailed(ctx context.Context, query string, args ...interface{}) error {
+	tag, err := s.db.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+	t, err := s.Get(ctx, args[0].(string))
+	if err != nil {
+		return err
+	}
+	return notFailed(t)
+}
+
+func notFailed(t *Task) error {
+	return errs.New(errs.CodeFailedPrecondition, "task is %s, only failed tasks can be changed", t.State)
+}
+
+// MemoryStore keeps tasks in memory, for tests and local development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tasks  map[string]*Task
+	locked map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tasks: make(map[string]*Task), locked: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Enqueue(_ context.Context, t *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.Key != "" {
+		for _, other := range s.tasks {
+			if other.Queue == t.Queue && other.Key == t.Key {
+				return ErrDuplicate
+			}
+		}
+	}
+	c := *t
+	s.tasks[t.ID] = &c
+	return nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, queue string, lease time.Duration, lane Lane) (*Task, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*Task
+	for _, t := range s.tasks {
+		if t.Queue != queue {
+			continue
+		}
+		expired := t.State == StateRunning && !s.locked[t.ID].After(now)
+		if expired && t.Attempts >= t.MaxAttempts {
+			t.State, t.LastError, t.UpdatedAt = StateFailed, leaseExpired, now
+			delete(s.locked, t.ID)
+			continue
+		}
+		if t.State == StatePending && !t.RunAt.After(now) || expired {
+			due = append(due, t)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if lane == LanePriority && due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		if !due[i].RunAt.Equal(due[j].RunAt) {
+			return due[i].RunAt.Before(due[j].RunAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	t := due[0]
+	t.State, t.UpdatedAt = StateRunning, now
+	t.Attempts++
+	s.locked[t.ID] = now.Add(lease)
+	c := *t
+	return &c, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, id string, attempt int) error {
+	return s.update(ctx, id, attempt, func(t *Task) { t.State = StateDone })
+}
+
+func (s *MemoryStore) Retry(ctx context.Context, id string, attempt int, runAt time.Time, lastErr string) error {
+	return s.update(ctx, id, attempt, func(t *Task) { t.State, t.RunAt, t.LastError = StatePending, runAt, lastErr })
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, id string, attempt int, lastErr string) error {
+	return s.update(ctx, id, attempt, func(t *Task) { t.State, t.LastError = StateFailed, lastErr })
+}
+
+func (s *MemoryStore) update(ctx context.Context, id string, attempt int, fn func(t *Task)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok || t.State != StateRunning || t.Attempts != attempt {
+		return ErrLeaseLost
+	}
+	fn(t)
+	t.UpdatedAt = clock.FromContext(ctx).Now().UTC()
+	delete(s.locked, id)
+	return nil
+}
+
+func (s *MemoryStore) Failed(_ context.Context, queue string, limit, offset int) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := []Task{}
+	for _, t := range s.tasks {
+		if t.State == StateFailed && (queue == "" || t.Queue == queue) {
+			tasks = append(tasks, *t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].UpdatedAt.Equal(tasks[j].UpdatedAt) {
+			return tasks[i].UpdatedAt.After(tasks[j].UpdatedAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	if offset >= len(tasks) {
+		return []Task{}, nil
+	}
+	tasks = tasks[offset:]
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, errs.NotFound("task not found")
+	}
+	c := *t
+	return &c, nil
+}
+
+func (s *MemoryStore) SetPayload(ctx context.Context, id string, payload json.RawMessage) error {
+	return s.updateFailed(ctx, id, func(t *Task) { t.Payload = payload })
+}
+
+func (s *MemoryStore) Replay(ctx context.Context, id string) error {
+	now := clock.FromContext(ctx).Now().UTC()
+	return s.updateFailed(ctx, id, func(t *Task) { t.State, t.Attempts, t.RunAt = StatePending, 0, now })
+}
+
+func (s *MemoryStore) updateFailed(ctx context.Context, id string, fn func(t *Task)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return errs.NotFound("task not found")
+	}
+	if t.State != StateFailed {
+		return notFailed(t)
+	}
+	fn(t)
+	t.UpdatedAt = clock.FromContext(ctx).Now().UTC()
+	return nil
+}
+
+func (s *MemoryStore) Stats(ctx context.Context, queue string) (Stats, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats Stats
+	var finished int64
+	for _, t := range s.tasks {
+		if t.Queue != queue {
+			continue
+		}
+		switch {
+		case t.State == StatePending && !t.RunAt.After(now):
+			stats.Depth++
+			if lag := now.Sub(t.RunAt); lag > stats.Lag {
+				stats.Lag = lag
+			}
+		case t.State == StateRunning && !s.locked[t.ID].After(now):
+			stats.Depth++
+		case t.State == StateRunning:
+			stats.Running++
+		case (t.State == StateDone || t.State == StateFailed) && t.UpdatedAt.After(now.Add(-StatsWindow)):
+			finished++
+		}
+	}
+	stats.Rate = float64(finished) / StatsWindow.Seconds()
+	return stats, nil
+}
+
+// Tasks returns the tasks of queue ordered by creation.
+func (s *MemoryStore) Tasks(queue string) []Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tasks []Task
+	for _, t := range s.tasks {
+		if t.Queue == queue {
+			tasks = append(tasks, *t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].CreatedAt.Equal(tasks[j].CreatedAt) {
+			return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
@@ -0,0 +1,123 @@
+// Package taskq runs tasks in the background with retries, at a later time, on cron schedules and by
+// priority. tasks are kept in a Store, PgStore for postgres, so they survive restarts.
+package taskq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DefaultQueue is the queue of workers and queues created without a name.
+const DefaultQueue = "default"
+
+// State of a task.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	// StateFailed is the state of tasks which ran out of attempts
+	StateFailed State = "failed"
+)
+
+// Priority orders the tasks of a queue which are due, higher ones run first.
+type Priority int
+
+const (
+	PriorityLow    Priority = -10
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 10
+)
+
+// Lane orders the due tasks of a queue when claiming one.
+type Lane int
+
+const (
+	// LanePriority claims the task with the highest priority, the one due first among equal ones
+	LanePriority Lane = iota
+	// LaneOldest claims the task due first regardless of its priority, so low priority tasks are not
+	// starved by a steady stream of higher ones
+	LaneOldest
+)
+
+var (
+	// ErrDuplicate is returned when enqueuing a task whose key is taken in its queue.
+	ErrDuplicate = errors.New("taskq: a task with this key exists")
+	// ErrLeaseLost is returned when storing the outcome of an attempt of a task which was claimed again
+	// after the lease of the attempt ran out, the outcome is dropped.
+	ErrLeaseLost = errors.New("taskq: the lease of the attempt ran out and the task was claimed again")
+)
+
+// Task is a unit of background work of a kind, run by the handler of its kind.
+type Task struct {
+	ID    string `json:"id"`
+	Queue string `json:"queue"`
+	Kind  string `json:"kind"`
+	// Key is optional, only one task of a queue has a key, see WithKey
+	Key         string          `json:"key,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Priority    Priority        `json:"priority"`
+	State       State           `json:"state"`
+	RunAt       time.Time       `json:"run_at"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Decode reads the payload into v.
+func (t *Task) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// Store keeps tasks, MemoryStore and PgStore implement it.
+type Store interface {
+	// Enqueue adds t, ErrDuplicate if its key is taken
+	Enqueue(ctx context.Context, t *Task) error
+	// Claim returns the next due task of queue in lane and leases it for lease, nil if there is none.
+	// tasks whose lease ran out, like ones of crashed workers, are due again unless it was their last
+	// attempt, then they fail
+	Claim(ctx context.Context, queue string, lease time.Duration, lane Lane) (*Task, error)
+	// Complete, Retry and Fail store the outcome of the attempt-th run of task id, ErrLeaseLost if the
+	// task was claimed again since
+	Complete(ctx context.Context, id string, attempt int) error
+	// Retry makes the task due again at runAt
+	Retry(ctx context.Context, id string, attempt int, runAt time.Time, lastErr string) error
+	Fail(ctx context.Context, id string, attempt int, lastErr string) error
+}
+
+// DeadLetterStore gives access to failed tasks, MemoryStore and PgStore implement it. changing tasks
+// which are not failed is a errs.CodeFailedPrecondition error.
+type DeadLetterStore interface {
+	// Failed returns the failed tasks of queue, of all queues if it is empty, last failed first
+	Failed(ctx context.Context, queue string, limit, offset int) ([]Task, error)
+	Get(ctx context.Context, id string) (*Task, error)
+	// SetPayload replaces the payload of a failed task, like to fix the input it failed on
+	SetPayload(ctx context.Context, id string, payload json.RawMessage) error
+	// Replay makes a failed task due right away, with its attempts reset
+	Replay(ctx context.Context, id string) error
+}
+
+// Stats describe the backlog of a queue.
+type Stats struct {
+	// Depth is the number of tasks which are due and wait for a worker
+	Depth int64
+	// Running is the number of tasks being run
+	Running int64
+	// Lag is how long the oldest due task waits for a worker
+	Lag time.Duration
+	// Rate is the number of tasks finished per second over the last StatsWindow
+	Rate float64
+}
+
+// StatsWindow is the period the rate of Stats is measured over.
+const StatsWindow = time.Minute
+
+// StatsStore reports the backlog of queues, MemoryStore and PgStore implement it.
+type StatsStore interface {
+	Stats(ctx context.Context, queue string) (Stats, error)
+}
@@ -0,0 +1,388 @@
+package taskq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/mirzakhany/gox/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	reg := prometheus.NewRegistry()
+	s := NewMemoryStore()
+	q := NewQueue(s, "")
+	w, err := NewWorker(s, "", WithBackoff(func(int) time.Duration { return time.Minute }), WithMetrics(reg))
+	require.NoError(t, err)
+
+	var ran []string
+	w.Handle("echo", func(ctx context.Context, task *Task) error {
+		var msg string
+		require.NoError(t, task.Decode(&msg))
+		ran = append(ran, msg)
+		return nil
+	})
+
+	{ // due tasks run by priority, delayed ones when they are due
+		_, err := q.Enqueue(ctx, "echo", "later", RunAfter(time.Hour), WithPriority(PriorityHigh))
+		require.NoError(t, err)
+		_, err = q.Enqueue(ctx, "echo", "low", WithPriority(PriorityLow))
+		require.NoError(t, err)
+		_, err = q.Enqueue(ctx, "echo", "high", WithPriority(PriorityHigh))
+		require.NoError(t, err)
+		_, err = q.Enqueue(ctx, "echo", "normal")
+		require.NoError(t, err)
+
+		for {
+			ok, err := w.RunNext(ctx)
+			require.NoError(t, err)
+			if !ok {
+				break
+			}
+		}
+		require.Equal(t, []string{"high", "normal", "low"}, ran)
+
+		fake.Advance(time.Hour)
+		ok, err := w.RunNext(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "later", ran[3])
+	}
+
+	{ // keys are unique in a queue
+		_, err := q.Enqueue(ctx, "echo", "once", WithKey("k"))
+		require.NoError(t, err)
+		_, err = q.Enqueue(ctx, "echo", "once", WithKey("k"))
+		require.ErrorIs(t, err, ErrDuplicate)
+		_, err = NewQueue(s, "other").Enqueue(ctx, "echo", "once", WithKey("k"))
+		require.NoError(t, err)
+	}
+
+	{ // failures are retried after the backoff until they run out of attempts
+		fails := 0
+		w.Handle("flaky", func(context.Context, *Task) error { fails++; return errors.New("boom") })
+		task, err := q.Enqueue(ctx, "flaky", nil, WithMaxAttempts(2))
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			for {
+				ok, err := w.RunNext(ctx)
+				require.NoError(t, err)
+				if !ok {
+					break
+				}
+			}
+			fake.Advance(time.Minute)
+		}
+		require.Equal(t, 2, fails)
+		got := find(s, task.ID)
+		require.Equal(t, StateFailed, got.State)
+		require.Equal(t, "boom", got.LastError)
+
+		require.Equal(t, float64(2), testutil.ToFloat64(w.metrics.Failed.WithLabelValues("flaky")))
+		require.Equal(t, float64(1), testutil.ToFloat64(w.metrics.Retries.WithLabelValues("flaky")))
+	}
+
+	{ // errors which can not succeed on retry fail right away
+		w.Handle("invalid", func(context.Context, *Task) error { return errs.Invalid("bad payload") })
+		task, err := q.Enqueue(ctx, "invalid", nil, WithMaxAttempts(3))
+		require.NoError(t, err)
+		for ok := true; ok; ok, _ = w.RunNext(ctx) {
+		}
+		got := find(s, task.ID)
+		require.Equal(t, StateFailed, got.State)
+		require.Equal(t, 1, got.Attempts)
+	}
+
+	{ // panics and unknown kinds fail
+		w.Handle("panic", func(context.Context, *Task) error { panic("oops") })
+		p, err := q.Enqueue(ctx, "panic", nil, WithMaxAttempts(1))
+		require.NoError(t, err)
+		u, err := q.Enqueue(ctx, "unknown", nil)
+		require.NoError(t, err)
+		for ok := true; ok; ok, _ = w.RunNext(ctx) {
+		}
+		require.Equal(t, StateFailed, find(s, p.ID).State)
+		require.Equal(t, StateFailed, find(s, u.ID).State)
+		require.Equal(t, 1, find(s, u.ID).Attempts)
+	}
+
+	{ // tasks of crashed workers are due again after their lease
+		_, err := q.Enqueue(ctx, "echo", "crashed")
+		require.NoError(t, err)
+		claimed, err := s.Claim(ctx, DefaultQueue, time.Minute, LanePriority)
+		require.NoError(t, err)
+		again, err := s.Claim(ctx, DefaultQueue, time.Minute, LanePriority)
+		require.NoError(t, err)
+		require.Nil(t, again)
+
+		fake.Advance(time.Minute)
+		again, err = s.Claim(ctx, DefaultQueue, time.Minute, LanePriority)
+		require.NoError(t, err)
+		require.Equal(t, claimed.ID, again.ID)
+		require.Equal(t, 2, again.Attempts)
+
+		// the outcome of the first attempt is dropped
+		require.ErrorIs(t, s.Complete(ctx, claimed.ID, claimed.Attempts), ErrLeaseLost)
+		require.Equal(t, StateRunning, find(s, claimed.ID).State)
+		require.NoError(t, s.Complete(ctx, again.ID, again.Attempts))
+		require.Equal(t, StateDone, find(s, claimed.ID).State)
+	}
+
+	{ // tasks whose lease ran out on their last attempt fail
+		task, err := q.Enqueue(ctx, "echo", "stuck", WithMaxAttempts(1))
+		require.NoError(t, err)
+		_, err = s.Claim(ctx, DefaultQueue, time.Minute, LanePriority)
+		require.NoError(t, err)
+
+		fake.Advance(time.Minute)
+		again, err := s.Claim(ctx, DefaultQueue, time.Minute, LanePriority)
+		require.NoError(t, err)
+		require.Nil(t, again)
+		got := find(s, task.ID)
+		require.Equal(t, StateFailed, got.State)
+		require.Equal(t, 1, got.Attempts)
+	}
+}
+
+func TestWorkerFairShare(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	s := NewMemoryStore()
+	q := NewQueue(s, "")
+	w, err := NewWorker(s, "", WithFairShare(3))
+	require.NoError(t, err)
+
+	var ran []string
+	w.Handle("echo", func(ctx context.Context, task *Task) error {
+		var msg string
+		require.NoError(t, task.Decode(&msg))
+		ran = append(ran, msg)
+		return nil
+	})
+
+	// a steady stream of high priority tasks does not starve the older low priority one
+	_, err = q.Enqueue(ctx, "echo", "low", WithPriority(PriorityLow))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		fake.Advance(time.Second)
+		_, err = q.Enqueue(ctx, "echo", "high", WithPriority(PriorityHigh))
+		require.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		ok, err := w.RunNext(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	require.Equal(t, []string{"high", "high", "low"}, ran)
+}
+
+func find(s *MemoryStore, id string) Task {
+	for _, q := range []string{DefaultQueue, "other"} {
+		for _, t := range s.Tasks(q) {
+			if t.ID == id {
+				return t
+			}
+		}
+	}
+	return Task{}
+}
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return tm
+	}
+
+	for _, tc := range []struct {
+		spec, after, next string
+	}{
+		{"*/15 * * * *", "2024-03-01 12:07", "2024-03-01 12:15"},
+		{"0 3 * * *", "2024-03-01 03:00", "2024-03-02 03:00"},
+		{"@hourly", "2024-03-01 12:59", "2024-03-01 13:00"},
+		{"30 9 * * 1-5", "2024-03-01 10:00", "2024-03-04 09:30"}, // friday to monday
+		{"0 0 1,15 * *", "2024-03-02 00:00", "2024-03-15 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 * * 7", "2024-03-01 00:00", "2024-03-03 00:00"},  // sunday
+		{"0 0 13 * 5", "2024-03-02 00:00", "2024-03-08 00:00"}, // the 13th or a friday
+	} {
+		c, err := ParseCron(tc.spec)
+		require.NoError(t, err, tc.spec)
+		require.Equal(t, at(tc.next), c.Next(at(tc.after)), tc.spec)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(spec)
+		require.Error(t, err, spec)
+	}
+
+	c, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, c.Next(at("2024-01-01 00:00")).IsZero())
+}
+
+func TestScheduler(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 7, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(clock.WithContext(context.Background(), fake))
+	defer cancel()
+
+	s := NewMemoryStore()
+	q := NewQueue(s, "")
+	schedules := []Schedule{{Name: "sync", Spec: "*/15 * * * *", Kind: "sync", Priority: PriorityHigh}}
+
+	{ // invalid schedules
+		_, err := NewScheduler(q, []Schedule{{Name: "a", Spec: "bad"}}, nil)
+		require.Error(t, err)
+		_, err = NewScheduler(q, append(schedules, schedules...), nil)
+		require.Error(t, err)
+	}
+
+	// two instances enqueue each run once
+	done := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		sc, err := NewScheduler(q, schedules, nil)
+		require.NoError(t, err)
+		go func() {
+			_ = sc.Run(ctx)
+			done <- struct{}{}
+		}()
+	}
+
+	require.Eventually(t, func() bool { return fake.Waiters() == 2 }, time.Second, time.Millisecond)
+	fake.Advance(8 * time.Minute)
+	require.Eventually(t, func() bool { return fake.Waiters() == 2 }, time.Second, time.Millisecond)
+	fake.Advance(15 * time.Minute)
+	require.Eventually(t, func() bool { return fake.Waiters() == 2 && len(s.Tasks(DefaultQueue)) == 2 }, time.Second, time.Millisecond)
+
+	tasks := s.Tasks(DefaultQueue)
+	require.Equal(t, time.Date(2024, 3, 1, 12, 15, 0, 0, time.UTC), tasks[0].RunAt)
+	require.Equal(t, time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), tasks[1].RunAt)
+	require.Equal(t, PriorityHigh, tasks[0].Priority)
+
+	cancel()
+	<-done
+	<-done
+}
+
+func TestDeadLetters(t *testing.T) {
+	testDeadLetters(t, NewMemoryStore())
+}
+
+func TestPgDeadLetters(t *testing.T) {
+	s, err := NewPgStore(context.Background(), goxtest.NewTestDB(t))
+	require.NoError(t, err)
+	testDeadLetters(t, s)
+}
+
+func testDeadLetters(t *testing.T, s interface {
+	Store
+	DeadLetterStore
+}) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	q := NewQueue(s, "emails")
+	w, err := NewWorker(s, "emails")
+	require.NoError(t, err)
+	var sent []string
+	w.Handle("send", func(ctx context.Context, task *Task) error {
+		var to string
+		require.NoError(t, task.Decode(&to))
+		if to == "" {
+			return errors.New("no recipient")
+		}
+		sent = append(sent, to)
+		return nil
+	})
+
+	failed, err := q.Enqueue(ctx, "send", "", WithMaxAttempts(1))
+	require.NoError(t, err)
+	pending, err := q.Enqueue(ctx, "send", "later@example.com", RunAfter(time.Hour))
+	require.NoError(t, err)
+	ok, err := w.RunNext(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	var audit []AuditEntry
+	dl, err := NewDeadLetters(s, WithAuditor(func(_ context.Context, entry AuditEntry) { audit = append(audit, entry) }),
+		WithDeadLetterAuthorizer(func(r *http.Request) error {
+			if r.Header.Get("X-User-Id") != "ops-1" {
+				return errors.New("not an operator")
+			}
+			return nil
+		}))
+	require.NoError(t, err)
+	open, err := NewDeadLetters(s)
+	require.NoError(t, err)
+	router := chi.NewRouter()
+	router.Use(rest.GatewayMeta)
+	router.Route("/dead-letters", dl.Mount)
+	router.Route("/open", open.Mount)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-User-Id", "ops-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r.WithContext(ctx))
+		return w
+	}
+
+	{ // the endpoints need an authorized user, and reject everyone without an authorizer
+		r := httptest.NewRequest(http.MethodGet, "/dead-letters", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r.WithContext(ctx))
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.Equal(t, http.StatusForbidden, do(http.MethodGet, "/open", "").Code)
+	}
+
+	{ // failed tasks are listed
+		res := do(http.MethodGet, "/dead-letters?queue=emails", "")
+		require.Equal(t, http.StatusOK, res.Code)
+		var page struct{ Items []Task }
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+		require.Len(t, page.Items, 1)
+		require.Equal(t, failed.ID, page.Items[0].ID)
+		require.Equal(t, "no recipient", page.Items[0].LastError)
+
+		require.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/dead-letters?limit=0", "").Code)
+		require.Equal(t, http.StatusNotFound, do(http.MethodGet, "/dead-letters/missing", "").Code)
+	}
+
+	{ // only failed tasks can be changed
+		require.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/dead-letters/"+pending.ID+"/replay", "").Code)
+		require.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/dead-letters/"+failed.ID+"/payload", "{").Code)
+		require.Empty(t, audit)
+	}
+
+	{ // fixed tasks are replayed with their attempts
+		require.Equal(t, http.StatusOK, do(http.MethodPut, "/dead-letters/"+failed.ID+"/payload", `"fixed@example.com"`).Code)
+		require.Equal(t, http.StatusOK, do(http.MethodPost, "/dead-letters/"+failed.ID+"/replay", "").Code)
+
+		ok, err := w.RunNext(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []string{"fixed@example.com"}, sent)
+
+		require.Len(t, audit, 2)
+		require.Equal(t, AuditEntry{Action: ActionEdit, TaskID: failed.ID, Queue: "emails", Kind: "send", Actor: "ops-1",
+			Before: json.RawMessage(`""`), After: json.RawMessage(`"fixed@example.com"`)}, audit[0])
+		require.Equal(t, ActionReplay, audit[1].Action)
+	}
+}
@@ -0,0 +1,296 @@
+package taskq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/diag"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/group"
+	goxlog "github.com/mirzakhany/gox/log"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultConcurrency  = 4
+	DefaultPollInterval = time.Second
+	// DefaultLease is how long a task may run before it is given to another worker
+	DefaultLease = 5 * time.Minute
+	// DefaultFairShare makes every fifth claim of a worker take the task due first regardless of priority
+	DefaultFairShare = 5
+)
+
+// Handler runs a task, returning an error retries it after a backoff until it runs out of attempts.
+// errors with a code which is not errs.Code.Retryable, like errs.Invalid, fail the task right away.
+type Handler func(ctx context.Context, t *Task) error
+
+type Option func(*Worker) error
+
+// WithConcurrency sets how many tasks run at once, DefaultConcurrency by default.
+func WithConcurrency(n int) Option {
+	return func(w *Worker) error {
+		if n <= 0 {
+			return errors.New("taskq: concurrency must be positive")
+		}
+		w.concurrency = n
+		return nil
+	}
+}
+
+// WithPollInterval sets how long idle workers wait before looking for due tasks again.
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Worker) error {
+		w.pollInterval = d
+		return nil
+	}
+}
+
+// WithLease sets how long a task may run, its context is canceled after it and it is given to another worker.
+func WithLease(d time.Duration) Option {
+	return func(w *Worker) error {
+		if d <= 0 {
+			return errors.New("taskq: lease must be positive")
+		}
+		w.lease = d
+		return nil
+	}
+}
+
+// WithFairShare makes every n-th claim of a worker take the task due first regardless of its priority,
+// LaneOldest, while the others take the one with the highest priority, DefaultFairShare by default. so
+// low priority tasks make progress while higher ones keep coming, 1 ignores priorities.
+func WithFairShare(n int) Option {
+	return func(w *Worker) error {
+		if n <= 0 {
+			return errors.New("taskq: fair share must be positive")
+		}
+		w.fairShare = n
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before retrying a task which failed for the attempts-th time,
+// DefaultBackoff by default.
+func WithBackoff(backoff func(attempts int) time.Duration) Option {
+	return func(w *Worker) error {
+		w.backoff = backoff
+		return nil
+	}
+}
+
+// WithMetrics registers the metrics.Async metrics of the "taskq" subsystem with reg, labeled by kind.
+// the lag is how long after its run at the last task of the kind was claimed.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(w *Worker) error {
+		m, err := metrics.NewAsync(reg, "taskq")
+		if err != nil {
+			return err
+		}
+		w.metrics = m
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(w *Worker) error {
+		w.logger = logger
+		return nil
+	}
+}
+
+// DefaultBackoff doubles the delay from a second, up to an hour.
+func DefaultBackoff(attempts int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// Worker runs the due tasks of a queue with the handlers of their kinds.
+type Worker struct {
+	store        Store
+	queue        string
+	concurrency  int
+	pollInterval time.Duration
+	lease        time.Duration
+	fairShare    int
+	backoff      func(attempts int) time.Duration
+	logger       *zap.Logger
+	metrics      *metrics.Async
+
+	claims uint64
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewWorker returns a worker of queue, DefaultQueue if empty. register handlers with Handle before
+// running it.
+// example:
+//
+//	worker, err := taskq.NewWorker(tasks, "emails", taskq.WithConcurrency(8))
+//	worker.Handle("welcome", func(ctx context.Context, t *taskq.Task) error {
+//		var w Welcome
+//		if err := t.Decode(&w); err != nil {
+//			return err
+//		}
+//		return sendWelcome(ctx, w.UserID)
+//	})
+//	runner, err := gox.NewRunner(gox.WithComponents(worker))
+func NewWorker(store Store, queue string, options ...Option) (*Worker, error) {
+	if queue == "" {
+		queue = DefaultQueue
+	}
+	w := &Worker{
+		store:        store,
+		queue:        queue,
+		concurrency:  DefaultConcurrency,
+		pollInterval: DefaultPollInterval,
+		lease:        DefaultLease,
+		fairShare:    DefaultFairShare,
+		backoff:      DefaultBackoff,
+		logger:       zap.NewNop(),
+		handlers:     make(map[string]Handler),
+	}
+	for _, o := range options {
+		if err := o(w); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Handle sets the handler of tasks of kind.
+func (w *Worker) Handle(kind string, h Handler) {
+	w.mu.Lock()
+	w.handlers[kind] = h
+	w.mu.Unlock()
+}
+
+func (w *Worker) Name() string {
+	return "taskq-" + w.queue
+}
+
+func (w *Worker) Describe() map[string]interface{} {
+	return map[string]interface{}{"queue": w.queue, "concurrency": w.concurrency, "lease": w.lease.String(), "fair_share": w.fairShare}
+}
+
+// Run runs tasks until ctx is done, then waits for the running ones.
+func (w *Worker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	clk := clock.FromContext(ctx)
+	for ctx.Err() == nil {
+		ran, err := w.RunNext(ctx)
+		if err != nil {
+			w.logger.Error("claim task failed", zap.String("queue", w.queue), goxlog.Err(err))
+		}
+		if ran {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-clk.After(w.pollInterval):
+		}
+	}
+}
+
+// RunNext runs the next due task and tells whether there was one.
+func (w *Worker) RunNext(ctx context.Context) (bool, error) {
+	lane := LanePriority
+	if atomic.AddUint64(&w.claims, 1)%uint64(w.fairShare) == 0 {
+		lane = LaneOldest
+	}
+	t, err := w.store.Claim(ctx, w.queue, w.lease, lane)
+	if err != nil || t == nil {
+		return false, err
+	}
+	w.process(ctx, t)
+	return true, nil
+}
+
+func (w *Worker) process(ctx context.Context, t *Task) {
+	logger := w.logger.With(zap.String("queue", t.Queue), zap.String("task", t.ID), zap.String("kind", t.Kind), zap.Int("attempt", t.Attempts))
+
+	w.mu.RLock()
+	h, ok := w.handlers[t.Kind]
+	w.mu.RUnlock()
+
+	clk := clock.FromContext(ctx)
+	now := clk.Now()
+	if w.metrics != nil {
+		w.metrics.SetLag(t.Kind, now.Sub(t.RunAt))
+	}
+
+	var err error
+	if ok {
+		runCtx, cancel := context.WithTimeout(ctx, w.lease)
+		err = safeRun(runCtx, h, t)
+		cancel()
+	} else {
+		err = fmt.Errorf("no handler for kind %s", t.Kind)
+	}
+	if w.metrics != nil {
+		w.metrics.ObserveDuration(t.Kind, clk.Since(now), err)
+	}
+
+	// the outcome is stored even when ctx ended while the task ran
+	storeCtx, cancel := context.WithTimeout(ctxutil.Detach(ctx), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case err == nil:
+		err = w.store.Complete(storeCtx, t.ID, t.Attempts)
+	case !ok || t.Attempts >= t.MaxAttempts || !errs.CodeOf(err).Retryable():
+		logger.Error("task failed", goxlog.Err(err))
+		err = w.store.Fail(storeCtx, t.ID, t.Attempts, err.Error())
+	default:
+		logger.Warn("task failed, retrying", goxlog.Err(err))
+		if w.metrics != nil {
+			w.metrics.Retry(t.Kind)
+		}
+		runAt := clk.Now().UTC().Add(w.backoff(t.Attempts))
+		err = w.store.Retry(storeCtx, t.ID, t.Attempts, runAt, err.Error())
+	}
+	switch {
+	case errors.Is(err, ErrLeaseLost):
+		logger.Warn("task outcome dropped, its lease ran out", goxlog.Err(err))
+	case err != nil:
+		logger.Error("task state update failed", goxlog.Err(err))
+	}
+}
+
+func safeRun(ctx context.Context, h Handler, t *Task) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			stack := debug.Stack()
+			diag.RecordPanic("task "+t.Kind, rec, stack)
+			err = &group.PanicError{Value: rec, Stack: stack}
+		}
+	}()
+	return h(ctx, t)
+}
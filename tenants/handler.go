@@ -0,0 +1,127 @@
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+)
+
+// Authorizer decides whether the request may use the tenant endpoints, a returned error is written
+// with status 403 unless it carries its own code, see errs.CodeOf.
+type Authorizer func(r *http.Request) error
+
+// Handler returns the endpoints managing tenants, mount it on an internal router:
+//
+//	GET    /                  lists the tenants
+//	POST   /                  creates a tenant, {"id": "acme", "name": "Acme Inc"}
+//	GET    /{id}              the state of a tenant, with the error of its last failed operation
+//	POST   /{id}/provision    retries provisioning a failed tenant
+//	POST   /{id}/suspend
+//	POST   /{id}/resume
+//	DELETE /{id}
+func (m *Manager) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Use(m.authorized)
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		tenants, err := m.tenants.List(r.Context())
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		if tenants == nil {
+			tenants = []*Tenant{}
+		}
+		rest.WriteJSON(w, http.StatusOK, tenants)
+	})
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			rest.WriteErr(w, errs.Invalid("invalid tenant: %s", err))
+			return
+		}
+		t, err := m.Create(r.Context(), body.ID, body.Name)
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		rest.WriteJSON(w, http.StatusCreated, t)
+	})
+	router.Get("/{id}", m.handle(m.Get))
+	router.Post("/{id}/provision", m.handle(m.Provision))
+	router.Post("/{id}/suspend", m.handle(m.Suspend))
+	router.Post("/{id}/resume", m.handle(m.Resume))
+	router.Delete("/{id}", m.handle(m.Delete))
+	return router
+}
+
+func (m *Manager) handle(fn func(ctx context.Context, id string) (*Tenant, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := fn(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			rest.WriteErr(w, err)
+			return
+		}
+		rest.WriteJSON(w, http.StatusOK, t)
+	}
+}
+
+func (m *Manager) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.authorize != nil {
+			if err := m.authorize(r); err != nil {
+				if errs.CodeOf(err) == errs.CodeUnknown {
+					err = errs.WithCode(err, errs.CodePermissionDenied)
+				}
+				rest.WriteErr(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware sets the tenant returned by resolve, like from the host name or a token, as the tenant of
+// the request context, see ID. requests of unknown or deleted tenants are answered with 404, of
+// suspended ones with 403 and of tenants being provisioned or deleted with 503. an empty tenant
+// passes the request on without one. tenants are cached for the WithCacheTTL of the manager.
+func (m *Manager) Middleware(resolve func(r *http.Request) (string, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := resolve(r)
+			if err != nil {
+				rest.WriteErr(w, err)
+				return
+			}
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			t, err := m.cached(r.Context(), id)
+			if err != nil {
+				rest.WriteErr(w, err)
+				return
+			}
+			switch t.State {
+			case StateActive:
+			case StateSuspended:
+				rest.WriteErr(w, errs.Forbidden("tenant %s is suspended", id))
+				return
+			case StateDeleted:
+				rest.WriteErr(w, errs.NotFound("tenant %s not found", id))
+				return
+			default:
+				rest.WriteErr(w, errs.New(errs.CodeUnavailable, "tenant %s is %s", id, t.State))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package tenants
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/rest"
+)
+
+// Limiter limits the request rate of each tenant with the token buckets of rest.RateLimit, so one
+// tenant can not starve the others.
+type Limiter struct {
+	defaults Limits
+	buckets  *rest.MemoryRateLimitStore
+
+	mu     sync.Mutex
+	limits map[string]Limits
+}
+
+// NewLimiter returns a limiter applying defaults to tenants without own limits, a zero rate does not
+// limit them.
+func NewLimiter(defaults Limits) *Limiter {
+	return &Limiter{defaults: defaults, buckets: rest.NewMemoryRateLimitStore(), limits: map[string]Limits{}}
+}
+
+// Update replaces the limits of the tenants. buckets keep their tokens, so changing the limits of a
+// tenant does not hand it a new burst.
+func (l *Limiter) Update(limits map[string]Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// limitsOf returns the limits of tenant with defaults filled in.
+func (l *Limiter) limitsOf(tenant string) Limits {
+	l.mu.Lock()
+	limits := l.limits[tenant]
+	l.mu.Unlock()
+	if limits.RequestsPerSecond <= 0 {
+		limits.RequestsPerSecond = l.defaults.RequestsPerSecond
+	}
+	if limits.Burst <= 0 {
+		limits.Burst = l.defaults.Burst
+	}
+	if limits.Burst <= 0 {
+		limits.Burst = int(math.Ceil(limits.RequestsPerSecond))
+	}
+	return limits
+}
+
+// Allow takes a token of tenant, or returns how long to wait for the next one.
+func (l *Limiter) Allow(ctx context.Context, tenant string) (bool, time.Duration) {
+	limits := l.limitsOf(tenant)
+	if limits.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+	// the memory store only fails on a zero rate or burst, which limitsOf rules out
+	ok, wait, _ := l.buckets.Take(ctx, tenant, limits.RequestsPerSecond, limits.Burst)
+	return ok, wait
+}
+
+// Middleware answers requests of tenants over their rate with 429 and Retry-After. it must run after
+// Manager.Middleware, requests without a tenant pass.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := ID(r.Context())
+		if tenant != "" {
+			if ok, wait := l.Allow(r.Context(), tenant); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				rest.WriteErr(w, errs.New(errs.CodeResourceExhausted, "rate limit of tenant %s exceeded", tenant))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DefaultPoolIdleTimeout is how long the pool of a tenant stays connected without being used.
+const DefaultPoolIdleTimeout = 10 * time.Minute
+
+// poolDrainDelay is how long a replaced pool stays open at least, for callers which got it just before.
+const poolDrainDelay = 30 * time.Second
+
+type tenantPool struct {
+	pool *pgxpool.Pool
+	used time.Time
+}
+
+// Pools keeps a connection pool per tenant, sized by the MaxConns of its limits, so a tenant running
+// expensive queries only exhausts its own pool. pools are connected on first use and closed after
+// DefaultPoolIdleTimeout without use.
+type Pools struct {
+	config   *pgxpool.Config
+	defaults Limits
+
+	mu      sync.Mutex
+	limits  map[string]Limits
+	pools   map[string]*tenantPool
+	retired []*tenantPool
+}
+
+// NewPools returns pools connecting with copies of config, tenants without own limits get
+// defaults.MaxConns connections, or the MaxConns of config.
+func NewPools(config *pgxpool.Config, defaults Limits) *Pools {
+	return &Pools{config: config, defaults: defaults, limits: map[string]Limits{}, pools: map[string]*tenantPool{}}
+}
+
+func (p *Pools) maxConns(tenant string) int32 {
+	if n := p.limits[tenant].MaxConns; n > 0 {
+		return n
+	}
+	if p.defaults.MaxConns > 0 {
+		return p.defaults.MaxConns
+	}
+	return p.config.MaxConns
+}
+
+// Update replaces the limits of the tenants. pools whose size changed are replaced on their next use,
+// the old ones drain and are closed once none of their connections is in use.
+func (p *Pools) Update(limits map[string]Limits) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limits = limits
+	for tenant, tp := range p.pools {
+		if tp.pool.Config().MaxConns != p.maxConns(tenant) {
+			delete(p.pools, tenant)
+			p.retired = append(p.retired, tp)
+		}
+	}
+}
+
+// drained retires the pools idle for DefaultPoolIdleTimeout and returns the retired ones which were
+// last handed out poolDrainDelay ago and have no connection in use, p.mu must be held.
+func (p *Pools) drained(now time.Time) []*pgxpool.Pool {
+	for tenant, tp := range p.pools {
+		if now.Sub(tp.used) >= DefaultPoolIdleTimeout {
+			delete(p.pools, tenant)
+			p.retired = append(p.retired, tp)
+		}
+	}
+
+	var drained []*pgxpool.Pool
+	retired := p.retired[:0]
+	for _, tp := range p.retired {
+		if now.Sub(tp.used) >= poolDrainDelay && tp.pool.Stat().AcquiredConns() == 0 {
+			drained = append(drained, tp.pool)
+			continue
+		}
+		retired = append(retired, tp)
+	}
+	p.retired = retired
+	return drained
+}
+
+func closeAll(pools []*pgxpool.Pool) {
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// Pool returns the pool of tenant, connecting it if needed. drained pools are closed on the way.
+func (p *Pools) Pool(ctx context.Context, tenant string) (*pgxpool.Pool, error) {
+	now := clock.FromContext(ctx).Now()
+	p.mu.Lock()
+	tp, ok := p.pools[tenant]
+	if ok {
+		tp.used = now
+	}
+	conf := p.config.Copy()
+	conf.MaxConns = p.maxConns(tenant)
+	drained := p.drained(now)
+	p.mu.Unlock()
+	closeAll(drained)
+	if ok {
+		return tp.pool, nil
+	}
+
+	if conf.MinConns > conf.MaxConns {
+		conf.MinConns = conf.MaxConns
+	}
+	// connecting does not block the pools of other tenants
+	pool, err := pgxpool.ConnectConfig(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if other, ok := p.pools[tenant]; ok {
+		// nobody got the new pool yet, it can be closed right away
+		go pool.Close()
+		return other.pool, nil
+	}
+	p.pools[tenant] = &tenantPool{pool: pool, used: now}
+	return pool, nil
+}
+
+// For returns the pool of the tenant of ctx, see ID.
+func (p *Pools) For(ctx context.Context) (*pgxpool.Pool, error) {
+	tenant := ID(ctx)
+	if tenant == "" {
+		return nil, errs.New(errs.CodeFailedPrecondition, "no tenant in context")
+	}
+	return p.Pool(ctx, tenant)
+}
+
+// Close closes the pools of all tenants, waiting for their connections in use to be released.
+func (p *Pools) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for tenant, tp := range p.pools {
+		tp.pool.Close()
+		delete(p.pools, tenant)
+	}
+	for _, tp := range p.retired {
+		tp.pool.Close()
+	}
+	p.retired = nil
+}
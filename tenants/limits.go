@@ -0,0 +1,171 @@
+package tenants
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/store"
+	"go.uber.org/zap"
+)
+
+const (
+	limitsTable = "gox_tenant_limits"
+
+	DefaultReloadInterval = 30 * time.Second
+)
+
+// Limits isolate a tenant from noisy neighbours, zero values use the defaults of the limiter or pools.
+type Limits struct {
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	Burst             int     `json:"burst,omitempty"`
+	// MaxConns is the size of the connection pool of the tenant
+	MaxConns int32 `json:"max_conns,omitempty"`
+}
+
+// LimitStore provides the limits of tenants by id, tenants without limits use the defaults.
+type LimitStore interface {
+	TenantLimits(ctx context.Context) (map[string]Limits, error)
+}
+
+// StaticLimits is a LimitStore of fixed limits.
+type StaticLimits map[string]Limits
+
+func (s StaticLimits) TenantLimits(context.Context) (map[string]Limits, error) {
+	return s, nil
+}
+
+// PgLimitStore keeps the limits of tenants in postgres, so they can be changed at runtime.
+type PgLimitStore struct {
+	db store.Querier
+}
+
+// NewPgLimitStore returns the limits of db, creating their table if needed.
+func NewPgLimitStore(ctx context.Context, db store.Querier) (*PgLimitStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+limitsTable+` (
+		tenant text PRIMARY KEY,
+		requests_per_second double precision NOT NULL DEFAULT 0,
+		burst integer NOT NULL DEFAULT 0,
+		max_conns integer NOT NULL DEFAULT 0,
+		updated_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgLimitStore{db: db}, nil
+}
+
+func (s *PgLimitStore) TenantLimits(ctx context.Context) (map[string]Limits, error) {
+	rows, err := s.db.Query(ctx, "SELECT tenant, requests_per_second, burst, max_conns FROM "+limitsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := map[string]Limits{}
+	for rows.Next() {
+		var tenant string
+		var l Limits
+		if err := rows.Scan(&tenant, &l.RequestsPerSecond, &l.Burst, &l.MaxConns); err != nil {
+			return nil, err
+		}
+		limits[tenant] = l
+	}
+	return limits, rows.Err()
+}
+
+// Set stores the limits of tenant.
+func (s *PgLimitStore) Set(ctx context.Context, tenant string, l Limits) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO "+limitsTable+" (tenant, requests_per_second, burst, max_conns, updated_at) VALUES ($1, $2, $3, $4, $5) "+
+		"ON CONFLICT (tenant) DO UPDATE SET requests_per_second = excluded.requests_per_second, burst = excluded.burst, "+
+		"max_conns = excluded.max_conns, updated_at = excluded.updated_at",
+		tenant, l.RequestsPerSecond, l.Burst, l.MaxConns, clock.FromContext(ctx).Now())
+	return err
+}
+
+// LimitsWatcher loads the limits of tenants from a store and passes them to its listeners, like a
+// Limiter and Pools, whenever they change. it is a gox.Component reloading them, so limits change
+// without restarts.
+type LimitsWatcher struct {
+	store    LimitStore
+	interval time.Duration
+	logger   *zap.Logger
+
+	mu        sync.Mutex
+	limits    map[string]Limits
+	listeners []func(map[string]Limits)
+}
+
+// NewLimitsWatcher returns a watcher of store reloading every interval, DefaultReloadInterval if zero.
+// example:
+//
+//	watcher := tenants.NewLimitsWatcher(limitStore, 0, logger)
+//	limiter := tenants.NewLimiter(tenants.Limits{RequestsPerSecond: 50, Burst: 100})
+//	pools := tenants.NewPools(poolConfig, tenants.Limits{MaxConns: 4})
+//	watcher.OnChange(limiter.Update)
+//	watcher.OnChange(pools.Update)
+//	err := watcher.Load(ctx)
+//	runner, err := gox.NewRunner(gox.WithComponents(watcher, ...))
+func NewLimitsWatcher(store LimitStore, interval time.Duration, logger *zap.Logger) *LimitsWatcher {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &LimitsWatcher{store: store, interval: interval, logger: logger}
+}
+
+// OnChange adds a listener, called with the current limits if they are loaded already.
+func (w *LimitsWatcher) OnChange(fn func(map[string]Limits)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+	if w.limits != nil {
+		fn(w.limits)
+	}
+}
+
+// Load loads the limits and notifies the listeners if they changed.
+func (w *LimitsWatcher) Load(ctx context.Context) error {
+	limits, err := w.store.TenantLimits(ctx)
+	if err != nil {
+		return err
+	}
+	if limits == nil {
+		limits = map[string]Limits{}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.limits != nil && reflect.DeepEqual(w.limits, limits) {
+		return nil
+	}
+	w.limits = limits
+	for _, fn := range w.listeners {
+		fn(limits)
+	}
+	return nil
+}
+
+func (w *LimitsWatcher) Name() string {
+	return "tenant-limits"
+}
+
+// Run reloads the limits every interval until ctx is done, failures are logged and the current
+// limits stay.
+func (w *LimitsWatcher) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for {
+		select {
+		case <-clk.After(w.interval):
+		case <-ctx.Done():
+			return nil
+		}
+		if err := w.Load(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Error("reload tenant limits failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = time.Second
+	// DefaultCacheTTL is how long Middleware uses a looked up tenant, changes made by other instances
+	// apply after it
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// ids are used in schema and database names, so they are restricted to what needs no quoting
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_]{0,62}$`)
+
+// Step is a part of a lifecycle operation of a provisioner. steps of all provisioners run in one
+// transaction, so sql changes roll back together, but steps are retried and must be idempotent.
+type Step func(ctx context.Context, tx pgx.Tx, t Tenant) error
+
+// Provisioner sets up what a tenant needs, like its schema, seed data or default flags. Create is
+// required, the other steps run when a tenant is suspended, resumed or deleted if they are set.
+type Provisioner struct {
+	Name    string
+	Create  Step
+	Suspend Step
+	Resume  Step
+	Delete  Step
+}
+
+var (
+	registeredMu sync.Mutex
+	registered   []Provisioner
+)
+
+// Register adds a provisioner to the ones of managers created without WithProvisioners, like in the
+// init function of the package owning the tenant data. provisioners run in the order they are
+// registered, and in reverse order on delete.
+// example:
+//
+//	func init() {
+//		tenants.Register(tenants.Provisioner{
+//			Name: "schema",
+//			Create: func(ctx context.Context, tx pgx.Tx, t tenants.Tenant) error {
+//				_, err := tx.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS tenant_"+t.ID)
+//				return err
+//			},
+//			Delete: func(ctx context.Context, tx pgx.Tx, t tenants.Tenant) error {
+//				_, err := tx.Exec(ctx, "DROP SCHEMA IF EXISTS tenant_"+t.ID+" CASCADE")
+//				return err
+//			},
+//		})
+//	}
+func Register(p Provisioner) {
+	if err := p.validate(); err != nil {
+		panic(err)
+	}
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, p)
+}
+
+func (p Provisioner) validate() error {
+	if p.Name == "" || p.Create == nil {
+		return errors.New("tenants: provisioners need a name and a create step")
+	}
+	return nil
+}
+
+// TxBeginner is implemented by *pgxpool.Pool and *pgx.Conn.
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type Option func(*Manager) error
+
+// WithProvisioners sets the provisioners instead of the registered ones.
+func WithProvisioners(provisioners ...Provisioner) Option {
+	return func(m *Manager) error {
+		for _, p := range provisioners {
+			if err := p.validate(); err != nil {
+				return err
+			}
+		}
+		m.provisioners = provisioners
+		return nil
+	}
+}
+
+// WithRetries sets how often a failed operation is retried, DefaultRetries by default.
+func WithRetries(n int) Option {
+	return func(m *Manager) error {
+		m.retries = n
+		return nil
+	}
+}
+
+// WithRetryDelay sets the delay before the first retry, it doubles with each retry.
+func WithRetryDelay(d time.Duration) Option {
+	return func(m *Manager) error {
+		m.retryDelay = d
+		return nil
+	}
+}
+
+// WithAuthorizer is called for every request of the Handler before it is handled.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(m *Manager) error {
+		m.authorize = authorize
+		return nil
+	}
+}
+
+// WithCacheTTL sets how long Middleware caches tenants, DefaultCacheTTL by default, 0 looks them up
+// for every request.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(m *Manager) error {
+		m.cacheTTL = ttl
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(m *Manager) error {
+		m.logger = logger
+		return nil
+	}
+}
+
+// Manager creates, suspends, resumes and deletes tenants by running the steps of the provisioners.
+type Manager struct {
+	db           TxBeginner
+	tenants      Store
+	provisioners []Provisioner
+	retries      int
+	retryDelay   time.Duration
+	authorize    Authorizer
+	logger       *zap.Logger
+	cacheTTL     time.Duration
+
+	cacheMu   sync.Mutex
+	cache     map[string]cachedTenant
+	lastSweep time.Time
+}
+
+type cachedTenant struct {
+	tenant  *Tenant
+	expires time.Time
+}
+
+// NewManager returns a manager of the tenants in store, running provisioners in transactions of db.
+// example:
+//
+//	tenantStore, err := tenants.NewPgStore(ctx, pool)
+//	manager, err := tenants.NewManager(pool, tenantStore, tenants.WithZapLogger(logger))
+//	internal.Mount("/tenants", manager.Handler())
+//	router.Use(manager.Middleware(tenantFromHost))
+func NewManager(db TxBeginner, tenants Store, options ...Option) (*Manager, error) {
+	registeredMu.Lock()
+	provisioners := append([]Provisioner(nil), registered...)
+	registeredMu.Unlock()
+
+	m := &Manager{
+		db:           db,
+		tenants:      tenants,
+		provisioners: provisioners,
+		retries:      DefaultRetries,
+		retryDelay:   DefaultRetryDelay,
+		logger:       zap.NewNop(),
+		cacheTTL:     DefaultCacheTTL,
+		cache:        map[string]cachedTenant{},
+	}
+	for _, o := range options {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Create stores a tenant and provisions it. when provisioning fails after all retries the tenant is
+// returned in StateFailed with the error, Provision retries it.
+func (m *Manager) Create(ctx context.Context, id, name string) (*Tenant, error) {
+	if !validID.MatchString(id) {
+		return nil, errs.Invalid("tenant id must be lower case letters, digits and underscores")
+	}
+	now := storedTime(clock.FromContext(ctx).Now())
+	t := &Tenant{ID: id, Name: name, State: StateProvisioning, CreatedAt: now, UpdatedAt: now}
+	if err := m.tenants.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	return m.Provision(ctx, id)
+}
+
+// Provision runs the create steps of a tenant which is provisioning or failed.
+func (m *Manager) Provision(ctx context.Context, id string) (*Tenant, error) {
+	return m.transition(ctx, id, []State{StateProvisioning, StateFailed}, StateProvisioning, StateActive, StateFailed,
+		func(p Provisioner) Step { return p.Create }, false)
+}
+
+// Suspend runs the suspend steps of an active tenant, Middleware refuses requests of suspended tenants.
+func (m *Manager) Suspend(ctx context.Context, id string) (*Tenant, error) {
+	return m.transition(ctx, id, []State{StateActive}, StateActive, StateSuspended, StateActive,
+		func(p Provisioner) Step { return p.Suspend }, false)
+}
+
+// Resume runs the resume steps of a suspended tenant.
+func (m *Manager) Resume(ctx context.Context, id string) (*Tenant, error) {
+	return m.transition(ctx, id, []State{StateSuspended}, StateSuspended, StateActive, StateSuspended,
+		func(p Provisioner) Step { return p.Resume }, false)
+}
+
+// Delete runs the delete steps of the provisioners in reverse order. the tenant is kept in StateDeleted,
+// failed deletes stay in StateDeleting and can be retried.
+func (m *Manager) Delete(ctx context.Context, id string) (*Tenant, error) {
+	return m.transition(ctx, id, []State{StateActive, StateSuspended, StateFailed, StateDeleting}, StateDeleting, StateDeleted, StateDeleting,
+		func(p Provisioner) Step { return p.Delete }, true)
+}
+
+// Get returns the tenant with id.
+func (m *Manager) Get(ctx context.Context, id string) (*Tenant, error) {
+	return m.tenants.Get(ctx, id)
+}
+
+// transition moves a tenant in one of from to during through the steps, then to done, or to failed
+// with the error of the steps. moving to during is conditional on the tenant being unchanged, so of
+// concurrent transitions of any instance only one runs the steps.
+func (m *Manager) transition(ctx context.Context, id string, from []State, during, done, failed State, step func(Provisioner) Step, reverse bool) (*Tenant, error) {
+	t, err := m.tenants.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || t.State == s
+	}
+	if !allowed {
+		return t, errs.New(errs.CodeFailedPrecondition, "tenant %s is %s", id, t.State)
+	}
+	if err := m.save(ctx, t, during, ""); err != nil {
+		if errs.CodeOf(err) == errs.CodeAlreadyExists {
+			err = errs.New(errs.CodeFailedPrecondition, "tenant %s is being changed", id)
+		}
+		return nil, err
+	}
+
+	var steps []Provisioner
+	for _, p := range m.provisioners {
+		if step(p) != nil {
+			steps = append(steps, p)
+		}
+	}
+	if reverse {
+		for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	}
+
+	if err := m.run(ctx, *t, steps, step); err != nil {
+		m.logger.Error("tenant operation failed", zap.String("tenant", id), zap.String("state", string(during)), zap.Error(err))
+		if serr := m.save(ctx, t, failed, err.Error()); serr != nil {
+			return nil, serr
+		}
+		return t, err
+	}
+	if err := m.save(ctx, t, done, ""); err != nil {
+		return nil, err
+	}
+	m.logger.Info("tenant state changed", zap.String("tenant", id), zap.String("state", string(done)))
+	return t, nil
+}
+
+// save moves t to state if it was not changed since it was read.
+func (m *Manager) save(ctx context.Context, t *Tenant, state State, reason string) error {
+	prev := *t
+	t.State, t.Error, t.UpdatedAt = state, reason, storedTime(clock.FromContext(ctx).Now())
+	if !t.UpdatedAt.After(prev.UpdatedAt) {
+		// keeps update times unique with coarse or fake clocks
+		t.UpdatedAt = prev.UpdatedAt.Add(time.Microsecond)
+	}
+	err := m.tenants.Update(ctx, t, prev.State, prev.UpdatedAt)
+	if err != nil {
+		*t = prev
+	}
+	m.forget(t.ID)
+	return err
+}
+
+// storedTime rounds t to the microseconds postgres keeps, so update times compare equal once stored.
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// run runs the steps in a transaction, retrying it with a doubling delay.
+func (m *Manager) run(ctx context.Context, t Tenant, provisioners []Provisioner, step func(Provisioner) Step) error {
+	clk := clock.FromContext(ctx)
+	delay := m.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := m.transact(ctx, func(tx pgx.Tx) error {
+			for _, p := range provisioners {
+				if err := step(p)(ctx, tx, t); err != nil {
+					return fmt.Errorf("%s: %w", p.Name, err)
+				}
+			}
+			return nil
+		})
+		if err == nil || attempt >= m.retries {
+			return err
+		}
+		m.logger.Warn("tenant operation failed, retrying", zap.String("tenant", t.ID), zap.Int("attempt", attempt+1), zap.Error(err))
+
+		select {
+		case <-clk.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *Manager) transact(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// cached returns the tenant id from the cache of Middleware, loading it from the store when needed.
+func (m *Manager) cached(ctx context.Context, id string) (*Tenant, error) {
+	if m.cacheTTL <= 0 {
+		return m.tenants.Get(ctx, id)
+	}
+	now := clock.FromContext(ctx).Now()
+	m.cacheMu.Lock()
+	c, ok := m.cache[id]
+	m.cacheMu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.tenant, nil
+	}
+
+	t, err := m.tenants.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	if now.Sub(m.lastSweep) >= m.cacheTTL {
+		for k, c := range m.cache {
+			if !now.Before(c.expires) {
+				delete(m.cache, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.cache[id] = cachedTenant{tenant: t, expires: now.Add(m.cacheTTL)}
+	return t, nil
+}
+
+// forget drops tenant id from the cache, after it was changed.
+func (m *Manager) forget(id string) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	delete(m.cache, id)
+}
@@ -0,0 +1,131 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/store"
+)
+
+const tenantsTable = "gox_tenants"
+
+// State is the lifecycle state of a tenant.
+type State string
+
+const (
+	StateProvisioning State = "provisioning"
+	StateActive       State = "active"
+	StateSuspended    State = "suspended"
+	StateDeleting     State = "deleting"
+	StateDeleted      State = "deleted"
+	// StateFailed is set when provisioners failed after all retries, provisioning can be retried
+	StateFailed State = "failed"
+)
+
+// Tenant is a customer of the service, whose data is provisioned by the registered provisioners.
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var idKey = ctxutil.NewKey[string]("tenant")
+
+// WithID returns a copy of ctx for the tenant id, which Middleware sets for requests.
+func WithID(ctx context.Context, id string) context.Context {
+	return idKey.Set(ctx, id)
+}
+
+// ID returns the tenant of ctx, empty if there is none.
+func ID(ctx context.Context) string {
+	id, _ := idKey.Get(ctx)
+	return id
+}
+
+// Store keeps tenants, PgStore for postgres.
+type Store interface {
+	// Create fails with an errs.Conflict error when the id is taken
+	Create(ctx context.Context, t *Tenant) error
+	// Update stores t if the stored tenant is still in state from and was last updated at updatedAt,
+	// an errs.Conflict error tells it was changed since
+	Update(ctx context.Context, t *Tenant, from State, updatedAt time.Time) error
+	Get(ctx context.Context, id string) (*Tenant, error)
+	List(ctx context.Context) ([]*Tenant, error)
+}
+
+// PgStore stores tenants in postgres.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the tenants of db, creating their table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+tenantsTable+` (
+		id text PRIMARY KEY,
+		name text NOT NULL,
+		state text NOT NULL,
+		error text NOT NULL DEFAULT '',
+		created_at timestamptz NOT NULL,
+		updated_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+func (s *PgStore) Create(ctx context.Context, t *Tenant) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO "+tenantsTable+" (id, name, state, error, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		t.ID, t.Name, t.State, t.Error, t.CreatedAt, t.UpdatedAt)
+	if store.IsDuplicateConstraintError(err, tenantsTable+"_pkey") {
+		return errs.Conflict("tenant %s already exists", t.ID)
+	}
+	return err
+}
+
+func (s *PgStore) Update(ctx context.Context, t *Tenant, from State, updatedAt time.Time) error {
+	tag, err := s.db.Exec(ctx, "UPDATE "+tenantsTable+" SET name = $2, state = $3, error = $4, updated_at = $5 WHERE id = $1 AND state = $6 AND updated_at = $7",
+		t.ID, t.Name, t.State, t.Error, t.UpdatedAt, from, updatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.Conflict("tenant %s was changed concurrently", t.ID)
+	}
+	return nil
+}
+
+func (s *PgStore) Get(ctx context.Context, id string) (*Tenant, error) {
+	t := &Tenant{}
+	err := s.db.QueryRow(ctx, "SELECT id, name, state, error, created_at, updated_at FROM "+tenantsTable+" WHERE id = $1", id).
+		Scan(&t.ID, &t.Name, &t.State, &t.Error, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.NotFound("tenant %s not found", id)
+	}
+	return t, err
+}
+
+func (s *PgStore) List(ctx context.Context) ([]*Tenant, error) {
+	rows, err := s.db.Query(ctx, "SELECT id, name, state, error, created_at, updated_at FROM "+tenantsTable+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		t := &Tenant{}
+		if err := rows.Scan(&t.ID, &t.Name, &t.State, &t.Error, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
@@ -0,0 +1,255 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/errs"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	tenants map[string]Tenant
+}
+
+func (s *memoryStore) Create(_ context.Context, t *Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[t.ID]; ok {
+		return errs.Conflict("tenant %s already exists", t.ID)
+	}
+	s.tenants[t.ID] = *t
+	return nil
+}
+
+func (s *memoryStore) Update(_ context.Context, t *Tenant, from State, updatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := s.tenants[t.ID]; stored.State != from || !stored.UpdatedAt.Equal(updatedAt) {
+		return errs.Conflict("tenant %s was changed concurrently", t.ID)
+	}
+	s.tenants[t.ID] = *t
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, id string) (*Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return nil, errs.NotFound("tenant %s not found", id)
+	}
+	return &t, nil
+}
+
+func (s *memoryStore) List(context.Context) ([]*Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tenants []*Tenant
+	for _, t := range s.tenants {
+		t := t
+		tenants = append(tenants, &t)
+	}
+	return tenants, nil
+}
+
+// racingStore changes the tenant right after it was read when race is set, like another instance would.
+type racingStore struct {
+	*memoryStore
+	race bool
+}
+
+func (s *racingStore) Get(ctx context.Context, id string) (*Tenant, error) {
+	t, err := s.memoryStore.Get(ctx, id)
+	if err == nil && s.race {
+		s.race = false
+		changed := *t
+		changed.UpdatedAt = changed.UpdatedAt.Add(time.Second)
+		_ = s.memoryStore.Update(ctx, &changed, t.State, t.UpdatedAt)
+	}
+	return t, err
+}
+
+// fakeDB records the statements of committed transactions.
+type fakeDB struct {
+	committed []string
+}
+
+type fakeTx struct {
+	pgx.Tx
+	db         *fakeDB
+	statements []string
+	done       bool
+}
+
+func (db *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+func (tx *fakeTx) Exec(_ context.Context, sql string, _ ...interface{}) (pgconn.CommandTag, error) {
+	tx.statements = append(tx.statements, sql)
+	return nil, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	tx.db.committed = append(tx.db.committed, tx.statements...)
+	tx.done = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	tx.done = true
+	return nil
+}
+
+func execStep(sql string) Step {
+	return func(ctx context.Context, tx pgx.Tx, t Tenant) error {
+		_, err := tx.Exec(ctx, strings.ReplaceAll(sql, "$tenant", t.ID))
+		return err
+	}
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDB{}
+	failures := 0
+	m, err := NewManager(db, &memoryStore{tenants: map[string]Tenant{}}, WithRetries(2), WithRetryDelay(time.Millisecond), WithProvisioners(
+		Provisioner{Name: "schema", Create: execStep("CREATE SCHEMA $tenant"), Delete: execStep("DROP SCHEMA $tenant")},
+		Provisioner{Name: "seed", Create: func(ctx context.Context, tx pgx.Tx, t Tenant) error {
+			if failures > 0 {
+				failures--
+				return errors.New("seed failed")
+			}
+			return execStep("INSERT INTO $tenant.plans")(ctx, tx, t)
+		}, Suspend: execStep("UPDATE flags SET enabled = false WHERE tenant = '$tenant'"), Delete: execStep("DELETE FROM flags WHERE tenant = '$tenant'")},
+	))
+	require.NoError(t, err)
+
+	{ // failed attempts roll back and are retried
+		failures = 2
+		tenant, err := m.Create(ctx, "acme", "Acme Inc")
+		require.NoError(t, err)
+		require.Equal(t, StateActive, tenant.State)
+		require.Equal(t, []string{"CREATE SCHEMA acme", "INSERT INTO acme.plans"}, db.committed)
+	}
+
+	{ // failures after all retries leave the tenant failed until it is provisioned again
+		failures = 3
+		tenant, err := m.Create(ctx, "globex", "")
+		require.EqualError(t, err, "seed: seed failed")
+		require.Equal(t, StateFailed, tenant.State)
+		require.Equal(t, "seed: seed failed", tenant.Error)
+
+		tenant, err = m.Provision(ctx, "globex")
+		require.NoError(t, err)
+		require.Equal(t, StateActive, tenant.State)
+		require.Empty(t, tenant.Error)
+	}
+
+	{ // lifecycle
+		db.committed = nil
+		tenant, err := m.Suspend(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, StateSuspended, tenant.State)
+		_, err = m.Suspend(ctx, "acme")
+		require.Equal(t, errs.CodeFailedPrecondition, errs.CodeOf(err))
+
+		tenant, err = m.Resume(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, StateActive, tenant.State)
+
+		tenant, err = m.Delete(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, StateDeleted, tenant.State)
+		require.Equal(t, []string{"UPDATE flags SET enabled = false WHERE tenant = 'acme'", "DELETE FROM flags WHERE tenant = 'acme'", "DROP SCHEMA acme"}, db.committed)
+	}
+
+	{ // tenants changed by another instance since they were read are not changed again
+		s := &racingStore{memoryStore: &memoryStore{tenants: map[string]Tenant{}}}
+		other, err := NewManager(db, s, WithProvisioners(Provisioner{Name: "noop", Create: execStep("SELECT 1")}))
+		require.NoError(t, err)
+		_, err = other.Create(ctx, "initech", "")
+		require.NoError(t, err)
+
+		s.race = true
+		_, err = other.Suspend(ctx, "initech")
+		require.Equal(t, errs.CodeFailedPrecondition, errs.CodeOf(err))
+		tenant, err := other.Get(ctx, "initech")
+		require.NoError(t, err)
+		require.Equal(t, StateActive, tenant.State)
+	}
+
+	{ // invalid and taken ids
+		_, err := m.Create(ctx, "Acme; DROP", "")
+		require.Equal(t, errs.CodeInvalidArgument, errs.CodeOf(err))
+		_, err = m.Create(ctx, "globex", "")
+		require.Equal(t, errs.CodeAlreadyExists, errs.CodeOf(err))
+	}
+}
+
+func TestHandlerAndMiddleware(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+	tenants := &memoryStore{tenants: map[string]Tenant{}}
+	m, err := NewManager(&fakeDB{}, tenants, WithProvisioners(
+		Provisioner{Name: "schema", Create: execStep("CREATE SCHEMA $tenant")},
+	))
+	require.NoError(t, err)
+	h := m.Handler()
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", `{"id":"acme","name":"Acme"}`).Code)
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", `{"id":"globex"}`).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/globex/suspend", "").Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/globex/suspend", "").Code)
+	w := serve(http.MethodGet, "/globex", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"state":"suspended"`)
+
+	app := m.Middleware(func(r *http.Request) (string, error) {
+		return strings.Split(r.Host, ".")[0], nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(ID(r.Context())))
+	}))
+	request := func(host string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		r.Host = host
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+	w = request("acme.example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "acme", w.Body.String())
+	require.Equal(t, http.StatusForbidden, request("globex.example.com").Code)
+	require.Equal(t, http.StatusNotFound, request("initech.example.com").Code)
+
+	{ // tenants are cached, changes of other instances apply after the ttl
+		other, err := NewManager(&fakeDB{}, tenants, WithProvisioners(Provisioner{Name: "noop", Create: execStep("SELECT 1")}))
+		require.NoError(t, err)
+		_, err = other.Suspend(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, request("acme.example.com").Code)
+		fake.Advance(DefaultCacheTTL)
+		require.Equal(t, http.StatusForbidden, request("acme.example.com").Code)
+
+		_, err = m.Resume(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, request("acme.example.com").Code, "own changes apply at once")
+	}
+}
@@ -0,0 +1,259 @@
+package timers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/store"
+)
+
+const timersTable = "gox_timers"
+
+// Store keeps timers, MemoryStore and PgStore implement it.
+type Store interface {
+	// Set adds or replaces the timer with the id of t, bumping its version and clearing its failure. it
+	// sets the version and creation time of t
+	Set(ctx context.Context, t *Timer) error
+	// Cancel removes timer id, it returns whether there was one
+	Cancel(ctx context.Context, id string) (bool, error)
+	Get(ctx context.Context, id string) (*Timer, error)
+	// Claim returns a due timer which has not failed and leases it for lease, nil if there is none.
+	// timers whose lease ran out, like ones of crashed instances, are due again
+	Claim(ctx context.Context, lease time.Duration) (*Timer, error)
+	// Next returns when the next timer which has not failed is due, false if there is none
+	Next(ctx context.Context) (time.Time, bool, error)
+	// Done removes timer id unless it was set again after version
+	Done(ctx context.Context, id string, version int64) error
+	// Retry makes timer id due again at at, unless it was set again after version
+	Retry(ctx context.Context, id string, version int64, at time.Time) error
+	// Fail marks timer id failed with lastErr, unless it was set again after version
+	Fail(ctx context.Context, id string, version int64, lastErr string) error
+}
+
+// PgStore keeps timers in postgres, instances claim due timers with skip locked.
+type PgStore struct {
+	db store.Querier
+}
+
+// NewPgStore returns the timers of db, creating their table if needed.
+func NewPgStore(ctx context.Context, db store.Querier) (*PgStore, error) {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+timersTable+` (
+		id text PRIMARY KEY,
+		kind text NOT NULL,
+		payload jsonb,
+		fire_at timestamptz NOT NULL,
+		due_at timestamptz NOT NULL,
+		version bigint NOT NULL,
+		attempts int NOT NULL DEFAULT 0,
+		failed boolean NOT NULL DEFAULT false,
+		last_error text NOT NULL DEFAULT '',
+		created_at timestamptz NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS gox_timers_due ON `+timersTable+` (due_at) WHERE NOT failed`)
+	if err != nil {
+		return nil, err
+	}
+	return &PgStore{db: db}, nil
+}
+
+const timerColumns = "id, kind, payload, fire_at, version, attempts, failed, last_error, created_at"
+
+func scanTimer(row pgx.Row) (*Timer, error) {
+	var t Timer
+	var payload []byte
+	if err := row.Scan(&t.ID, &t.Kind, &payload, &t.At, &t.Version, &t.Attempts, &t.Failed, &t.LastError, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Payload = payload
+	return &t, nil
+}
+
+func (s *PgStore) Set(ctx context.Context, t *Timer) error {
+	var payload interface{}
+	if len(t.Payload) > 0 {
+		payload = string(t.Payload)
+	}
+	return s.db.QueryRow(ctx, `INSERT INTO `+timersTable+` (id, kind, payload, fire_at, due_at, version, created_at)
+		VALUES ($1, $2, $3, $4, $4, 1, $5)
+		ON CONFLICT (id) DO UPDATE SET kind = excluded.kind, payload = excluded.payload, fire_at = excluded.fire_at,
+			due_at = excluded.due_at, version = `+timersTable+`.version + 1, attempts = 0, failed = false, last_error = ''
+		RETURNING version, created_at`,
+		t.ID, t.Kind, payload, t.At, clock.FromContext(ctx).Now().UTC()).Scan(&t.Version, &t.CreatedAt)
+}
+
+func (s *PgStore) Cancel(ctx context.Context, id string) (bool, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM "+timersTable+" WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *PgStore) Get(ctx context.Context, id string) (*Timer, error) {
+	t, err := scanTimer(s.db.QueryRow(ctx, "SELECT "+timerColumns+" FROM "+timersTable+" WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+func (s *PgStore) Claim(ctx context.Context, lease time.Duration) (*Timer, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	t, err := scanTimer(s.db.QueryRow(ctx, `UPDATE `+timersTable+` SET due_at = $2, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM `+timersTable+` WHERE due_at <= $1 AND NOT failed ORDER BY due_at LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+timerColumns, now, now.Add(lease)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+func (s *PgStore) Next(ctx context.Context) (time.Time, bool, error) {
+	var next *time.Time
+	if err := s.db.QueryRow(ctx, "SELECT min(due_at) FROM "+timersTable+" WHERE NOT failed").Scan(&next); err != nil {
+		return time.Time{}, false, err
+	}
+	if next == nil {
+		return time.Time{}, false, nil
+	}
+	return *next, true, nil
+}
+
+func (s *PgStore) Done(ctx context.Context, id string, version int64) error {
+	_, err := s.db.Exec(ctx, "DELETE FROM "+timersTable+" WHERE id = $1 AND version = $2", id, version)
+	return err
+}
+
+func (s *PgStore) Retry(ctx context.Context, id string, version int64, at time.Time) error {
+	_, err := s.db.Exec(ctx, "UPDATE "+timersTable+" SET due_at = $3 WHERE id = $1 AND version = $2", id, version, at)
+	return err
+}
+
+func (s *PgStore) Fail(ctx context.Context, id string, version int64, lastErr string) error {
+	_, err := s.db.Exec(ctx, "UPDATE "+timersTable+" SET failed = true, last_error = $3 WHERE id = $1 AND version = $2",
+		id, version, lastErr)
+	return err
+}
+
+type memoryTimer struct {
+	Timer
+	due time.Time
+}
+
+// MemoryStore keeps timers in memory, for tests and local development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	timers map[string]*memoryTimer
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{timers: map[string]*memoryTimer{}}
+}
+
+func (s *MemoryStore) Set(ctx context.Context, t *Timer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *t
+	c.Version, c.Attempts, c.CreatedAt = 1, 0, clock.FromContext(ctx).Now().UTC()
+	c.Failed, c.LastError = false, ""
+	if old, ok := s.timers[t.ID]; ok {
+		c.Version, c.CreatedAt = old.Version+1, old.CreatedAt
+	}
+	s.timers[t.ID] = &memoryTimer{Timer: c, due: c.At}
+	t.Version, t.CreatedAt = c.Version, c.CreatedAt
+	return nil
+}
+
+func (s *MemoryStore) Cancel(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.timers[id]
+	delete(s.timers, id)
+	return ok, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (*Timer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.timers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := t.Timer
+	return &c, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, lease time.Duration) (*Timer, error) {
+	now := clock.FromContext(ctx).Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*memoryTimer
+	for _, t := range s.timers {
+		if !t.Failed && !t.due.After(now) {
+			due = append(due, t)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].due.Equal(due[j].due) {
+			return due[i].due.Before(due[j].due)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	t := due[0]
+	t.due = now.Add(lease)
+	t.Attempts++
+	c := t.Timer
+	return &c, nil
+}
+
+func (s *MemoryStore) Next(_ context.Context) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, t := range s.timers {
+		if !t.Failed && (next.IsZero() || t.due.Before(next)) {
+			next = t.due
+		}
+	}
+	return next, !next.IsZero(), nil
+}
+
+func (s *MemoryStore) Done(_ context.Context, id string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[id]; ok && t.Version == version {
+		delete(s.timers, id)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Retry(_ context.Context, id string, version int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[id]; ok && t.Version == version {
+		t.due = at
+	}
+	return nil
+}
+
+func (s *MemoryStore) Fail(_ context.Context, id string, version int64, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[id]; ok && t.Version == version {
+		t.Failed, t.LastError = true, lastErr
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+// Package timers fires callbacks at given times, like reminders and escalations. timers are kept in a
+// Store, PgStore for postgres, so they fire after restarts and on one instance only.
+package timers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/ctxutil"
+	"github.com/mirzakhany/gox/errs"
+	goxlog "github.com/mirzakhany/gox/log"
+	"github.com/mirzakhany/gox/metrics"
+	"github.com/mirzakhany/gox/taskq"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxWait is the longest the timers wait before looking for due timers, in case timers were
+	// set by other instances
+	DefaultMaxWait = 30 * time.Second
+	// DefaultLease is how long a callback may run before its timer fires again on another instance
+	DefaultLease = time.Minute
+	// DefaultMaxAttempts is how often a timer fires before it is marked failed
+	DefaultMaxAttempts = 10
+)
+
+var ErrNotFound = errs.NotFound("timer not found")
+
+// Timer fires the handler of its kind once at At.
+type Timer struct {
+	// ID names the timer, setting a timer with the same id replaces it, like "remind:order:42"
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	At      time.Time       `json:"at"`
+	// Version is bumped each time the timer is set
+	Version int64 `json:"version"`
+	// Attempts counts the times the timer fired, more than one if callbacks failed
+	Attempts int `json:"attempts"`
+	// Failed is set when the callback failed on every attempt, failed timers do not fire until they
+	// are set again
+	Failed    bool      `json:"failed,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Decode reads the payload into v.
+func (t *Timer) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// Handler is called when a timer fires, returning an error or panicking fires it again after a backoff.
+type Handler func(ctx context.Context, t *Timer) error
+
+type Option func(*Timers) error
+
+// WithMaxWait sets the longest the timers wait before looking for due timers, DefaultMaxWait by
+// default. timers set through the same Timers wake it up right away.
+func WithMaxWait(d time.Duration) Option {
+	return func(t *Timers) error {
+		if d <= 0 {
+			return errors.New("timers: max wait must be positive")
+		}
+		t.maxWait = d
+		return nil
+	}
+}
+
+// WithLease sets how long a callback may run, DefaultLease by default.
+func WithLease(d time.Duration) Option {
+	return func(t *Timers) error {
+		if d <= 0 {
+			return errors.New("timers: lease must be positive")
+		}
+		t.lease = d
+		return nil
+	}
+}
+
+// WithMaxAttempts sets how often a timer fires before it is marked failed, DefaultMaxAttempts by
+// default.
+func WithMaxAttempts(n int) Option {
+	return func(t *Timers) error {
+		if n <= 0 {
+			return errors.New("timers: max attempts must be positive")
+		}
+		t.maxAttempts = n
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before firing a timer whose callback failed for the attempts-th time,
+// taskq.DefaultBackoff by default.
+func WithBackoff(backoff func(attempts int) time.Duration) Option {
+	return func(t *Timers) error {
+		t.backoff = backoff
+		return nil
+	}
+}
+
+// WithMetrics registers the metrics.Async metrics of the "timers" subsystem with reg, labeled by kind.
+// the lag is how late the last timer of the kind fired.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(t *Timers) error {
+		m, err := metrics.NewAsync(reg, "timers")
+		if err != nil {
+			return err
+		}
+		t.metrics = m
+		return nil
+	}
+}
+
+func WithZapLogger(logger *zap.Logger) Option {
+	return func(t *Timers) error {
+		t.logger = logger
+		return nil
+	}
+}
+
+// Timers sets timers and fires the due ones with the handlers of their kinds. instead of polling at a
+// fixed interval it sleeps until the next timer is due, so timers fire on time.
+type Timers struct {
+	store       Store
+	maxWait     time.Duration
+	lease       time.Duration
+	maxAttempts int
+	backoff     func(attempts int) time.Duration
+	metrics     *metrics.Async
+	logger      *zap.Logger
+
+	wake chan struct{}
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// New returns the timers of store, register handlers with Handle before running it. it is a
+// gox.Component to add to the Runner.
+// example:
+//
+//	t, err := timers.New(store, timers.WithMetrics(prometheus.DefaultRegisterer))
+//	t.Handle("escalate", func(ctx context.Context, tm *timers.Timer) error {
+//		var ticket TicketRef
+//		if err := tm.Decode(&ticket); err != nil {
+//			return err
+//		}
+//		return tickets.Escalate(ctx, ticket.ID)
+//	})
+//	...
+//	err = t.After(ctx, "escalate:"+ticket.ID, "escalate", 24*time.Hour, TicketRef{ID: ticket.ID})
+//	// answered in time
+//	_, err = t.Cancel(ctx, "escalate:"+ticket.ID)
+func New(store Store, options ...Option) (*Timers, error) {
+	t := &Timers{
+		store:       store,
+		maxWait:     DefaultMaxWait,
+		lease:       DefaultLease,
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     taskq.DefaultBackoff,
+		logger:      zap.NewNop(),
+		wake:        make(chan struct{}, 1),
+		handlers:    map[string]Handler{},
+	}
+	for _, o := range options {
+		if err := o(t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Handle sets the handler of timers of kind.
+func (t *Timers) Handle(kind string, h Handler) {
+	t.mu.Lock()
+	t.handlers[kind] = h
+	t.mu.Unlock()
+}
+
+// Set sets timer id of kind to fire at at with payload encoded as json, replacing the timer with the
+// same id if any.
+func (t *Timers) Set(ctx context.Context, id, kind string, at time.Time, payload interface{}) (*Timer, error) {
+	if id == "" || kind == "" {
+		return nil, errors.New("timers: id and kind must not be empty")
+	}
+	tm := &Timer{ID: id, Kind: kind, At: at.UTC()}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("timers: encode payload: %w", err)
+		}
+		tm.Payload = data
+	}
+	if err := t.store.Set(ctx, tm); err != nil {
+		return nil, err
+	}
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return tm, nil
+}
+
+// After is Set with a time d from now.
+func (t *Timers) After(ctx context.Context, id, kind string, d time.Duration, payload interface{}) (*Timer, error) {
+	return t.Set(ctx, id, kind, clock.FromContext(ctx).Now().Add(d), payload)
+}
+
+// Cancel removes timer id, it returns whether there was one.
+func (t *Timers) Cancel(ctx context.Context, id string) (bool, error) {
+	return t.store.Cancel(ctx, id)
+}
+
+func (t *Timers) Name() string {
+	return "timers"
+}
+
+func (t *Timers) Describe() map[string]interface{} {
+	return map[string]interface{}{"max_wait": t.maxWait.String(), "lease": t.lease.String(), "max_attempts": t.maxAttempts}
+}
+
+// Run fires due timers until ctx is done.
+func (t *Timers) Run(ctx context.Context) error {
+	clk := clock.FromContext(ctx)
+	for ctx.Err() == nil {
+		fired, err := t.FireNext(ctx)
+		if err != nil {
+			t.logger.Error("claim timer failed", goxlog.Err(err))
+		}
+		if fired {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-t.wake:
+		case <-clk.After(t.wait(ctx)):
+		}
+	}
+	return nil
+}
+
+// wait returns how long to sleep until the next timer is due, at most maxWait.
+func (t *Timers) wait(ctx context.Context) time.Duration {
+	next, ok, err := t.store.Next(ctx)
+	if err != nil {
+		t.logger.Error("find next timer failed", goxlog.Err(err))
+		return t.maxWait
+	}
+	if !ok {
+		return t.maxWait
+	}
+	d := next.Sub(clock.FromContext(ctx).Now())
+	if d > t.maxWait {
+		return t.maxWait
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// FireNext fires the next due timer and tells whether there was one.
+func (t *Timers) FireNext(ctx context.Context) (bool, error) {
+	tm, err := t.store.Claim(ctx, t.lease)
+	if err != nil || tm == nil {
+		return false, err
+	}
+	t.fire(ctx, tm)
+	return true, nil
+}
+
+func (t *Timers) fire(ctx context.Context, tm *Timer) {
+	logger := t.logger.With(zap.String("timer", tm.ID), zap.String("kind", tm.Kind), zap.Int("attempt", tm.Attempts))
+	clk := clock.FromContext(ctx)
+	now := clk.Now()
+	if t.metrics != nil {
+		t.metrics.SetLag(tm.Kind, now.Sub(tm.At))
+	}
+
+	err := t.call(ctx, tm)
+	if t.metrics != nil {
+		t.metrics.ObserveDuration(tm.Kind, clk.Since(now), err)
+	}
+
+	// the state is kept even when ctx is canceled while the callback ran, like on shutdown
+	stateCtx := ctxutil.Detach(ctx)
+	switch {
+	case err == nil:
+		err = t.store.Done(stateCtx, tm.ID, tm.Version)
+	case tm.Attempts >= t.maxAttempts:
+		logger.Error("timer callback failed, giving up", goxlog.Err(err))
+		err = t.store.Fail(stateCtx, tm.ID, tm.Version, err.Error())
+	default:
+		logger.Warn("timer callback failed, retrying", goxlog.Err(err))
+		if t.metrics != nil {
+			t.metrics.Retry(tm.Kind)
+		}
+		err = t.store.Retry(stateCtx, tm.ID, tm.Version, now.Add(t.backoff(tm.Attempts)))
+	}
+	if err != nil {
+		logger.Error("timer state update failed", goxlog.Err(err))
+	}
+}
+
+// call runs the handler of tm, returning panics as errors.
+func (t *Timers) call(ctx context.Context, tm *Timer) (err error) {
+	t.mu.RLock()
+	h, ok := t.handlers[tm.Kind]
+	t.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler for kind %s", tm.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("timer callback panicked: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, t.lease)
+	defer cancel()
+	return h(ctx, tm)
+}
+
+// EnqueueTask returns a Handler enqueuing a task of the kind and with the payload of the timer in q,
+// for callbacks which should run with the retries and concurrency of a taskq worker. a timer fired again
+// after its task was enqueued does not enqueue it twice, while the timer set again, even after it fired,
+// enqueues a new task.
+// example:
+//
+//	t.Handle("remind", timers.EnqueueTask(taskq.NewQueue(tasks, "emails")))
+func EnqueueTask(q *taskq.Queue, options ...taskq.TaskOption) Handler {
+	return func(ctx context.Context, tm *Timer) error {
+		// the version starts over once a fired timer is removed, created_at and the time tell the
+		// timers set with the same id apart
+		key := fmt.Sprintf("timer:%s:%d:%d:%d", tm.ID, tm.CreatedAt.UnixNano(), tm.Version, tm.At.UnixNano())
+		opts := append([]taskq.TaskOption{taskq.WithKey(key)}, options...)
+		_, err := q.Enqueue(ctx, tm.Kind, tm.Payload, opts...)
+		if errors.Is(err, taskq.ErrDuplicate) {
+			return nil
+		}
+		return err
+	}
+}
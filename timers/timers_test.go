@@ -0,0 +1,203 @@
+package timers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mirzakhany/gox/clock"
+	"github.com/mirzakhany/gox/goxtest"
+	"github.com/mirzakhany/gox/taskq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimers(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	reg := prometheus.NewRegistry()
+	s := NewMemoryStore()
+	tm, err := New(s, WithMetrics(reg), WithMaxWait(24*time.Hour), WithBackoff(func(int) time.Duration { return time.Minute }))
+	require.NoError(t, err)
+
+	var fired []string
+	failing := true
+	tm.Handle("remind", func(ctx context.Context, timer *Timer) error {
+		var user string
+		require.NoError(t, timer.Decode(&user))
+		fired = append(fired, user)
+		return nil
+	})
+	tm.Handle("escalate", func(ctx context.Context, timer *Timer) error {
+		if failing {
+			return errors.New("pager is down")
+		}
+		fired = append(fired, timer.ID)
+		return nil
+	})
+	fireAll := func() {
+		for {
+			ok, err := tm.FireNext(ctx)
+			require.NoError(t, err)
+			if !ok {
+				return
+			}
+		}
+	}
+
+	{ // timers fire once when due
+		_, err := tm.After(ctx, "remind:1", "remind", time.Hour, "alice")
+		require.NoError(t, err)
+		_, err = tm.After(ctx, "remind:2", "remind", 2*time.Hour, "bob")
+		require.NoError(t, err)
+
+		fireAll()
+		require.Empty(t, fired)
+		require.Equal(t, time.Hour, tm.wait(ctx))
+
+		fake.Advance(time.Hour)
+		fireAll()
+		fireAll()
+		require.Equal(t, []string{"alice"}, fired)
+	}
+
+	{ // timers are replaced by id and can be canceled
+		_, err := tm.After(ctx, "remind:2", "remind", 3*time.Hour, "carol")
+		require.NoError(t, err)
+		fake.Advance(2 * time.Hour)
+		fireAll()
+		require.Equal(t, []string{"alice"}, fired)
+
+		ok, err := tm.Cancel(ctx, "remind:2")
+		require.NoError(t, err)
+		require.True(t, ok)
+		fake.Advance(2 * time.Hour)
+		fireAll()
+		require.Equal(t, []string{"alice"}, fired)
+		require.Equal(t, 24*time.Hour, tm.wait(ctx))
+	}
+
+	{ // failed callbacks fire again after the backoff
+		_, err := tm.After(ctx, "escalate:7", "escalate", time.Minute, nil)
+		require.NoError(t, err)
+		fake.Advance(time.Minute)
+		fireAll()
+		got, err := s.Get(ctx, "escalate:7")
+		require.NoError(t, err)
+		require.Equal(t, 1, got.Attempts)
+
+		failing = false
+		fake.Advance(time.Minute)
+		fireAll()
+		require.Equal(t, []string{"alice", "escalate:7"}, fired)
+		_, err = s.Get(ctx, "escalate:7")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		require.Equal(t, float64(1), testutil.ToFloat64(tm.metrics.Retries.WithLabelValues("escalate")))
+		require.Equal(t, float64(60), testutil.ToFloat64(tm.metrics.Lag.WithLabelValues("escalate")))
+	}
+
+	{ // timers enqueue tasks once
+		tasks := taskq.NewMemoryStore()
+		tm.Handle("digest", EnqueueTask(taskq.NewQueue(tasks, "emails")))
+		timer, err := tm.After(ctx, "digest:1", "digest", 0, "alice")
+		require.NoError(t, err)
+		fireAll()
+		require.NoError(t, EnqueueTask(taskq.NewQueue(tasks, "emails"))(ctx, timer))
+
+		queued := tasks.Tasks("emails")
+		require.Len(t, queued, 1)
+		require.Equal(t, "digest", queued[0].Kind)
+		require.JSONEq(t, `"alice"`, string(queued[0].Payload))
+
+		// the same timer set again after it fired is a new reminder
+		fake.Advance(time.Hour)
+		_, err = tm.After(ctx, "digest:1", "digest", 0, "alice")
+		require.NoError(t, err)
+		fireAll()
+		require.Len(t, tasks.Tasks("emails"), 2)
+	}
+}
+
+func TestTimersFailures(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx := clock.WithContext(context.Background(), fake)
+
+	s := NewMemoryStore()
+	tm, err := New(s, WithMaxAttempts(2), WithBackoff(func(int) time.Duration { return time.Minute }))
+	require.NoError(t, err)
+	tm.Handle("crash", func(ctx context.Context, timer *Timer) error {
+		panic("nil map")
+	})
+
+	_, err = tm.After(ctx, "crash:1", "crash", 0, nil)
+	require.NoError(t, err)
+
+	{ // panics are retried
+		ok, err := tm.FireNext(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		got, err := s.Get(ctx, "crash:1")
+		require.NoError(t, err)
+		require.Equal(t, 1, got.Attempts)
+		require.False(t, got.Failed)
+	}
+
+	{ // timers failing every attempt are marked failed and do not fire again
+		fake.Advance(time.Minute)
+		ok, err := tm.FireNext(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		got, err := s.Get(ctx, "crash:1")
+		require.NoError(t, err)
+		require.True(t, got.Failed)
+		require.Contains(t, got.LastError, "nil map")
+
+		fake.Advance(time.Hour)
+		ok, err = tm.FireNext(ctx)
+		require.NoError(t, err)
+		require.False(t, ok)
+		_, ok, err = s.Next(ctx)
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+
+	{ // setting a failed timer again clears the failure
+		_, err := tm.After(ctx, "crash:1", "crash", 0, nil)
+		require.NoError(t, err)
+		got, err := s.Get(ctx, "crash:1")
+		require.NoError(t, err)
+		require.False(t, got.Failed)
+		require.Empty(t, got.LastError)
+	}
+}
+
+func TestTimersRun(t *testing.T) {
+	fake := goxtest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(clock.WithContext(context.Background(), fake))
+	defer cancel()
+
+	tm, err := New(NewMemoryStore())
+	require.NoError(t, err)
+	fired := make(chan string, 1)
+	tm.Handle("remind", func(ctx context.Context, timer *Timer) error {
+		fired <- timer.ID
+		return nil
+	})
+
+	done := make(chan error)
+	go func() { done <- tm.Run(ctx) }()
+
+	// a timer set while running wakes it up, it then sleeps until the timer is due
+	_, err = tm.After(ctx, "remind:1", "remind", 10*time.Second, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return fake.Waiters() == 2 }, time.Second, time.Millisecond)
+	fake.Advance(10 * time.Second)
+	require.Equal(t, "remind:1", <-fired)
+
+	cancel()
+	require.NoError(t, <-done)
+}
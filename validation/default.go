@@ -0,0 +1,109 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	defaultOnce      sync.Once
+	defaultValidator *validator.Validate
+
+	translatorMu sync.RWMutex
+	translator   ut.Translator
+)
+
+// Default returns the validator shared by os.LoadFromEnv, rest.BindJSON and importer. custom tags,
+// struct level validations and translations registered on it apply everywhere. registrations are not
+// safe to run concurrently with validations, so they must be done at startup.
+// example:
+//
+//	func init() {
+//		_ = validation.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+//			return usernameRegex.MatchString(fl.Field().String())
+//		})
+//	}
+func Default() *validator.Validate {
+	defaultOnce.Do(func() {
+		defaultValidator = New()
+	})
+	return defaultValidator
+}
+
+// RegisterValidation adds a custom tag to the default validator.
+func RegisterValidation(tag string, fn validator.Func, callValidationEvenIfNull ...bool) error {
+	return Default().RegisterValidation(tag, fn, callValidationEvenIfNull...)
+}
+
+// RegisterStructValidation adds a struct level validation for given types to the default validator.
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) {
+	Default().RegisterStructValidation(fn, types...)
+}
+
+// RegisterTranslation adds a translation of tag to the default validator and sets trans as the translator
+// used by Messages.
+func RegisterTranslation(tag string, trans ut.Translator, registerFn validator.RegisterTranslationsFunc, translationFn validator.TranslationFunc) error {
+	if err := Default().RegisterTranslation(tag, trans, registerFn, translationFn); err != nil {
+		return err
+	}
+	SetTranslator(trans)
+	return nil
+}
+
+// SetTranslator sets the translator used by Messages, like one with the default translations of
+// github.com/go-playground/validator/v10/translations/en registered.
+func SetTranslator(trans ut.Translator) {
+	translatorMu.Lock()
+	defer translatorMu.Unlock()
+	translator = trans
+}
+
+// Struct validates s using the default validator.
+func Struct(s interface{}) error {
+	return Default().Struct(s)
+}
+
+// Messages returns a human readable message per invalid field of err, translated if a translator is set.
+// errors which are not validation errors are returned under the "" key.
+func Messages(err error) map[string]string {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return map[string]string{"": err.Error()}
+	}
+
+	translatorMu.RLock()
+	trans := translator
+	translatorMu.RUnlock()
+
+	out := make(map[string]string, len(verrs))
+	for _, e := range verrs {
+		if trans != nil {
+			out[e.Namespace()] = e.Translate(trans)
+			continue
+		}
+		out[e.Namespace()] = fmt.Sprintf("%s failed on the '%s' rule", e.Field(), e.Tag())
+	}
+	return out
+}
+
+// Message joins Messages of err into one string, sorted by field.
+func Message(err error) string {
+	msgs := Messages(err)
+	keys := make([]string, 0, len(msgs))
+	for k := range msgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, msgs[k])
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail validates email and returns it with surrounding spaces and display name removed
+// and the domain lower cased. the local part is kept as is, as it is case-sensitive by the spec.
+func NormalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	if at <= 0 || !strings.Contains(addr.Address[at:], ".") {
+		return "", ErrInvalidEmail
+	}
+	return addr.Address[:at] + strings.ToLower(addr.Address[at:]), nil
+}
+
+// CanonicalEmail returns a form of email to detect duplicate accounts. it is lower cased, the +tag
+// is removed and for gmail addresses dots are removed too, so John.Doe+news@gmail.com and
+// johndoe@googlemail.com are the same. it must only be used for comparison, never to send emails.
+func CanonicalEmail(email string) (string, error) {
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	normalized = strings.ToLower(normalized)
+	at := strings.LastIndex(normalized, "@")
+	local, domain := normalized[:at], normalized[at+1:]
+
+	if i := strings.Index(local, "+"); i > 0 {
+		local = local[:i]
+	}
+
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		domain = "gmail.com"
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain, nil
+}
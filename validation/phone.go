@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// NormalizePhone converts a phone number to E.164, like +989121234567. spaces, dashes, dots and
+// parentheses are removed and the 00 international prefix is replaced by +. numbers without an
+// international prefix are considered national numbers of defaultCountryCode, like "98" or "1",
+// with their leading trunk 0 removed. defaultCountryCode can be empty to only accept international numbers.
+func NormalizePhone(number, defaultCountryCode string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	n := b.String()
+	switch {
+	case strings.HasPrefix(n, "+"):
+	case strings.HasPrefix(n, "00"):
+		n = "+" + n[2:]
+	case defaultCountryCode != "":
+		n = "+" + strings.TrimPrefix(defaultCountryCode, "+") + strings.TrimPrefix(n, "0")
+	default:
+		return "", ErrInvalidPhone
+	}
+
+	if !IsE164(n) {
+		return "", ErrInvalidPhone
+	}
+	return n, nil
+}
+
+// IsE164 reports if number is in E.164 format, a + followed by up to 15 digits.
+func IsE164(number string) bool {
+	if len(number) < 8 || len(number) > 16 || number[0] != '+' || number[1] == '0' {
+		return false
+	}
+	for _, r := range number[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		input   string
+		country string
+		want    string
+		err     bool
+	}{
+		{input: "+98 912 123 4567", want: "+989121234567"},
+		{input: "0098-912-123-4567", want: "+989121234567"},
+		{input: "0912 123 4567", country: "98", want: "+989121234567"},
+		{input: "(415) 555-2671", country: "+1", want: "+14155552671"},
+		{input: "415 555 2671", err: true},
+		{input: "+1 415 abc", err: true},
+		{input: "+12", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := NormalizePhone(c.input, c.country)
+			if c.err {
+				require.ErrorIs(t, err, ErrInvalidPhone)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	n, err := NormalizeEmail(" John Doe <John.Doe+news@GMail.com> ")
+	require.NoError(t, err)
+	require.Equal(t, "John.Doe+news@gmail.com", n)
+
+	c, err := CanonicalEmail("John.Doe+news@GMail.com")
+	require.NoError(t, err)
+	require.Equal(t, "johndoe@gmail.com", c)
+
+	c, err = CanonicalEmail("Foo.Bar+x@example.com")
+	require.NoError(t, err)
+	require.Equal(t, "foo.bar@example.com", c)
+
+	_, err = NormalizeEmail("foo@localhost")
+	require.ErrorIs(t, err, ErrInvalidEmail)
+	_, err = NormalizeEmail("foo")
+	require.ErrorIs(t, err, ErrInvalidEmail)
+}
+
+func TestIBANAndVAT(t *testing.T) {
+	require.True(t, IsIBAN("GB82 WEST 1234 5698 7654 32"))
+	require.True(t, IsIBAN("de89370400440532013000"))
+	require.False(t, IsIBAN("GB82 WEST 1234 5698 7654 33"))
+	require.False(t, IsIBAN("XX82WEST12345698765432"))
+
+	require.True(t, IsVAT("DE123456789"))
+	require.True(t, IsVAT("NL 1234.56.789.B01"))
+	require.False(t, IsVAT("DE12345678"))
+	require.False(t, IsVAT("US123456789"))
+}
+
+func TestRegister(t *testing.T) {
+	type account struct {
+		Phone string `validate:"phone"`
+		IBAN  string `validate:"omitempty,iban"`
+	}
+
+	v := New()
+	require.NoError(t, v.Struct(account{Phone: "+14155552671", IBAN: "GB82WEST12345698765432"}))
+	require.NoError(t, v.Struct(account{Phone: "+14155552671"}))
+	require.Error(t, v.Struct(account{Phone: "4155552671"}))
+	require.Error(t, v.Struct(account{Phone: "+14155552671", IBAN: "GB00"}))
+}
+
+func TestDefault(t *testing.T) {
+	type user struct {
+		Name string `validate:"lowercase_name"`
+		Age  int    `validate:"gte=18"`
+	}
+
+	require.NoError(t, RegisterValidation("lowercase_name", func(fl validator.FieldLevel) bool {
+		return strings.ToLower(fl.Field().String()) == fl.Field().String()
+	}))
+	require.Same(t, Default(), Default())
+
+	require.NoError(t, Struct(user{Name: "foo", Age: 20}))
+
+	err := Struct(user{Name: "Foo", Age: 10})
+	require.Equal(t, map[string]string{
+		"user.Name": "Name failed on the 'lowercase_name' rule",
+		"user.Age":  "Age failed on the 'gte' rule",
+	}, Messages(err))
+	require.Equal(t, "Age failed on the 'gte' rule; Name failed on the 'lowercase_name' rule", Message(err))
+}
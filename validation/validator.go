@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+)
+
+// Register adds the custom tags of this package to v:
+//
+//	phone: a phone number in E.164 format
+//	iban:  a valid iban, spaces allowed
+//	vat:   an EU vat number with its country prefix
+//	email_normalized: an email which is already normalized by NormalizeEmail
+func Register(v *validator.Validate) error {
+	validations := map[string]func(string) bool{
+		"phone": IsE164,
+		"iban":  IsIBAN,
+		"vat":   IsVAT,
+		"email_normalized": func(s string) bool {
+			n, err := NormalizeEmail(s)
+			return err == nil && n == s
+		},
+	}
+
+	for tag, fn := range validations {
+		fn := fn
+		if err := v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return fn(fl.Field().String())
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// New returns a validator with the custom tags of this package registered.
+func New() *validator.Validate {
+	v := validator.New()
+	if err := Register(v); err != nil {
+		// tags are static, failing to register them is a programming error
+		panic(err)
+	}
+	return v
+}